@@ -7,6 +7,7 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -116,6 +117,7 @@ type Config struct {
 	APIKeys      []string
 	PublicPaths  []string
 	Session      SessionConfig
+	JWT          *JWTConfig // Bearer token authentication; nil disables it
 }
 
 // HashPassword creates a bcrypt hash of the given password.
@@ -148,6 +150,20 @@ func Middleware(cfg Config) func(http.Handler) http.Handler {
 				}
 			}
 
+			// A bearer token is checked on its own: an invalid one is rejected
+			// rather than redirected to the login page.
+			if token, ok := bearerToken(r); ok && cfg.JWT != nil {
+				id, err := cfg.JWT.ValidateToken(r.Context(), token)
+				if err != nil {
+					slog.Warn("Rejected bearer token", "path", r.URL.Path, "error", err)
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithUsername(r.Context(), id.Username)))
+				return
+			}
+
 			// Check session cookie
 			if cookie, err := r.Cookie(sessionCookieName); err == nil {
 				if _, valid := ValidateSessionToken(cookie.Value, cfg.Session); valid {
@@ -174,6 +190,15 @@ func Middleware(cfg Config) func(http.Handler) http.Handler {
 	}
 }
 
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
 // isBrowserRequest returns true if the request appears to come from a browser.
 func isBrowserRequest(r *http.Request) bool {
 	accept := r.Header.Get("Accept")
@@ -0,0 +1,451 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJWTLeeway is how far a token's exp and nbf may be off to allow for
+// clock skew between this server and the identity provider.
+const DefaultJWTLeeway = time.Minute
+
+// DefaultUsernameClaim is the claim that names the user when none is configured.
+const DefaultUsernameClaim = "sub"
+
+// JWTConfig configures bearer token authentication with JWTs issued by an
+// OIDC provider. Tokens must be signed by a key from Keys and carry the
+// configured issuer and audience and an unexpired exp.
+type JWTConfig struct {
+	Keys          KeySource
+	Issuer        string        // Required iss claim
+	Audience      string        // Required entry of the aud claim
+	UsernameClaim string        // Claim used as the username (default: sub)
+	RoleClaim     string        // Claim holding the user's roles, a string or list
+	AllowedRoles  []string      // Roles allowed in; empty allows any valid token
+	Leeway        time.Duration // Allowed clock skew (default: DefaultJWTLeeway)
+}
+
+// KeySource finds the key that verifies a token. kid is the token's key ID,
+// empty when it has none. The key is an *rsa.PublicKey, an *ecdsa.PublicKey,
+// or a []byte secret for HMAC tokens.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// NewStaticKey returns a KeySource with a single key, used whatever the
+// token's key ID.
+func NewStaticKey(key any) KeySource {
+	return staticKey{key: key}
+}
+
+type staticKey struct {
+	key any
+}
+
+func (k staticKey) Key(context.Context, string) (any, error) {
+	return k.key, nil
+}
+
+// ParsePublicKeyPEM parses a PEM encoded RSA or ECDSA public key, as a PKIX
+// "PUBLIC KEY" block or an X.509 certificate.
+func ParsePublicKeyPEM(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	default:
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+// Identity is the user a validated token names.
+type Identity struct {
+	Username string
+	Roles    []string
+}
+
+// ValidateToken checks a JWT's signature, issuer, audience and validity period
+// and, when AllowedRoles is set, that it carries one of them.
+func (c *JWTConfig) ValidateToken(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("invalid header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	key, err := c.Keys.Key(ctx, header.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("invalid claims: %w", err)
+	}
+	if err := c.checkClaims(claims, time.Now()); err != nil {
+		return Identity{}, err
+	}
+
+	usernameClaim := c.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = DefaultUsernameClaim
+	}
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		return Identity{}, fmt.Errorf("token has no %s claim", usernameClaim)
+	}
+	id := Identity{Username: username}
+	if c.RoleClaim != "" {
+		id.Roles = stringList(claims[c.RoleClaim])
+	}
+	if len(c.AllowedRoles) > 0 && !slices.ContainsFunc(id.Roles, func(r string) bool { return slices.Contains(c.AllowedRoles, r) }) {
+		return Identity{}, fmt.Errorf("user %s has none of the allowed roles", username)
+	}
+	return id, nil
+}
+
+// checkClaims checks the registered claims: iss, aud, exp and nbf.
+func (c *JWTConfig) checkClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != c.Issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !slices.Contains(stringList(claims["aud"]), c.Audience) {
+		return errors.New("token is not for this audience")
+	}
+	leeway := c.Leeway
+	if leeway == 0 {
+		leeway = DefaultJWTLeeway
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.Add(-leeway).After(time.Unix(int64(exp), 0)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// stringList reads a claim that is either a string or a list of strings.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks sig over signed with key. The algorithm must match the
+// key's type, so an RSA public key can never be used as an HMAC secret.
+func verifySignature(alg string, key any, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] == "ES" {
+			if curve := k.Curve.Params().Name; curve != esCurves[alg] {
+				return fmt.Errorf("algorithm %q does not match the key's curve %s", alg, curve)
+			}
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if len(sig) != 2*size {
+				return errors.New("invalid signature length")
+			}
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if !ecdsa.Verify(k, digest, r, s) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+	case []byte:
+		if alg[:2] == "HS" {
+			mac := hmac.New(hash.New, k)
+			mac.Write([]byte(signed))
+			if !hmac.Equal(mac.Sum(nil), sig) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("algorithm %q does not match the key", alg)
+}
+
+// esCurves is the curve each ECDSA algorithm is defined with (RFC 7518 section 3.4).
+var esCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// jwksMinRefresh is the shortest time between fetches of a JWKS, so tokens
+// with unknown key IDs cannot make every request hit the identity provider.
+const jwksMinRefresh = time.Minute
+
+// JWKS is a KeySource that fetches the keys from a JSON Web Key Set URL, such
+// as an OIDC provider's jwks_uri. Keys are cached and refetched when a token
+// names an unknown key, at most once per jwksMinRefresh. The fetch runs without
+// the lock, so tokens with cached keys are not held up by it.
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	mu         sync.Mutex
+	keys       map[string]any
+	fetchedAt  time.Time
+	fetchErr   error         // error of the last fetch, nil if it succeeded
+	refreshing chan struct{} // closed when the fetch in progress completes (nil when none is)
+}
+
+// NewJWKS returns a KeySource for the key set at url.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Key returns the key with the given ID, or the only key in the set when the
+// token has no key ID.
+func (j *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	j.mu.Lock()
+	if key, ok := j.lookup(kid); ok {
+		j.mu.Unlock()
+		return key, nil
+	}
+	if j.refreshing == nil {
+		if time.Since(j.fetchedAt) < jwksMinRefresh {
+			j.mu.Unlock()
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		// Not tied to this request, so its cancellation does not fail the others waiting
+		j.refreshing = make(chan struct{})
+		go j.refresh(context.WithoutCancel(ctx))
+	}
+	done := j.refreshing
+	j.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	if j.fetchErr != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", j.fetchErr)
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+// refresh fetches the key set, keeping the cached keys if it fails, and wakes
+// the requests waiting for it.
+func (j *JWKS) refresh(ctx context.Context) {
+	keys, err := j.fetch(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = time.Now()
+	j.fetchErr = err
+	if err == nil {
+		j.keys = keys
+	}
+	close(j.refreshing)
+	j.refreshing = nil
+}
+
+func (j *JWKS) lookup(kid string) (any, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of other types are skipped so one unusual key does not break the set
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// jwk is one JSON Web Key. Only RSA and EC public keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type contextKey int
+
+const usernameKey contextKey = iota
+
+// WithUsername returns a copy of ctx carrying the authenticated username.
+func WithUsername(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, usernameKey, username)
+}
+
+// UsernameFromContext returns the username Middleware authenticated from a
+// bearer token, or "" for other kinds of authentication.
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey).(string)
+	return username
+}
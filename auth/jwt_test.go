@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// signRS256 builds a token signed with testRSAKey.
+func signRS256(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	header := map[string]any{"alg": "RS256", "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15 failed: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func testClaims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":   "https://idp.example.com/",
+		"aud":   []string{"crdb-cluster-history", "other"},
+		"sub":   "user-123",
+		"email": "alice@example.com",
+		"roles": []string{"viewer", "operator"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+func testJWTConfig() *JWTConfig {
+	return &JWTConfig{
+		Keys:     NewStaticKey(&testRSAKey.PublicKey),
+		Issuer:   "https://idp.example.com/",
+		Audience: "crdb-cluster-history",
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		config  func(*JWTConfig)
+		claims  map[string]any
+		token   func(string) string
+		wantErr string
+		want    string
+	}{
+		{name: "valid token", want: "user-123"},
+		{name: "single audience string", claims: map[string]any{"aud": "crdb-cluster-history"}, want: "user-123"},
+		{name: "username claim", config: func(c *JWTConfig) { c.UsernameClaim = "email" }, want: "alice@example.com"},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}, wantErr: "expired"},
+		{name: "expired within leeway", claims: map[string]any{"exp": time.Now().Add(-30 * time.Second).Unix()}, want: "user-123"},
+		{name: "no expiry", claims: map[string]any{"exp": nil}, wantErr: "no expiry"},
+		{name: "not valid yet", claims: map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}, wantErr: "not valid yet"},
+		{name: "wrong audience", claims: map[string]any{"aud": "someone-else"}, wantErr: "audience"},
+		{name: "wrong issuer", claims: map[string]any{"iss": "https://evil.example.com/"}, wantErr: "issuer"},
+		{name: "missing username claim", config: func(c *JWTConfig) { c.UsernameClaim = "preferred_username" }, wantErr: "preferred_username"},
+		{
+			name:   "allowed role",
+			config: func(c *JWTConfig) { c.RoleClaim, c.AllowedRoles = "roles", []string{"admin", "operator"} },
+			want:   "user-123",
+		},
+		{
+			name:    "no allowed role",
+			config:  func(c *JWTConfig) { c.RoleClaim, c.AllowedRoles = "roles", []string{"admin"} },
+			wantErr: "allowed roles",
+		},
+		{
+			name: "tampered claims",
+			token: func(tok string) string {
+				parts := strings.Split(tok, ".")
+				parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"https://idp.example.com/","aud":"crdb-cluster-history","sub":"admin","exp":9999999999}`))
+				return strings.Join(parts, ".")
+			},
+			wantErr: "verification error",
+		},
+		{
+			name: "alg none",
+			token: func(tok string) string {
+				parts := strings.Split(tok, ".")
+				parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+				return parts[0] + "." + parts[1] + "."
+			},
+			wantErr: "unsupported algorithm",
+		},
+		{
+			name: "HMAC with the public key as secret",
+			token: func(tok string) string {
+				parts := strings.Split(tok, ".")
+				parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+				return strings.Join(parts, ".")
+			},
+			wantErr: "does not match the key",
+		},
+		{name: "malformed", token: func(string) string { return "not-a-jwt" }, wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := testJWTConfig()
+			if tt.config != nil {
+				tt.config(cfg)
+			}
+			token := signRS256(t, "", testClaims(tt.claims))
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+			id, err := cfg.ValidateToken(ctx, token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateToken failed: %v", err)
+			}
+			if id.Username != tt.want {
+				t.Errorf("Expected username %q, got %q", tt.want, id.Username)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(testRSAKey.N.Bytes()), "e": b64([]byte{1, 0, 1})},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer srv.Close()
+
+	cfg := testJWTConfig()
+	cfg.Keys = NewJWKS(srv.URL)
+	ctx := context.Background()
+
+	if _, err := cfg.ValidateToken(ctx, signRS256(t, "rsa-1", testClaims(nil))); err != nil {
+		t.Errorf("RSA token from the key set: %v", err)
+	}
+
+	// An ES256 token signed with the EC key in the set
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": "ec-1"}) + "." + encodeSegment(t, testClaims(nil))
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	if _, err := cfg.ValidateToken(ctx, signed+"."+b64(sig)); err != nil {
+		t.Errorf("EC token from the key set: %v", err)
+	}
+
+	// Unknown key IDs refetch the set, but not more than once per jwksMinRefresh
+	for range 3 {
+		if _, err := cfg.ValidateToken(ctx, signRS256(t, "rotated", testClaims(nil))); err == nil || !strings.Contains(err.Error(), "unknown key ID") {
+			t.Errorf("Expected an unknown key ID error, got %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("Expected the key set to be fetched once, got %d", n)
+	}
+}
+
+// signES builds a token signed by key with the given ES algorithm, whatever the
+// key's curve.
+func signES(t *testing.T, alg string, hash crypto.Hash, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": alg}) + "." + encodeSegment(t, testClaims(nil))
+	h := hash.New()
+	h.Write([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	sig := append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestValidateTokenECCurve(t *testing.T) {
+	t.Parallel()
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		alg     string
+		hash    crypto.Hash
+		key     *ecdsa.PrivateKey
+		wantErr bool
+	}{
+		{"ES256 with P-256", "ES256", crypto.SHA256, p256, false},
+		{"ES384 with P-384", "ES384", crypto.SHA384, p384, false},
+		{"ES384 with P-256", "ES384", crypto.SHA384, p256, true},
+		{"ES256 with P-384", "ES256", crypto.SHA256, p384, true},
+		{"ES512 with P-384", "ES512", crypto.SHA512, p384, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testJWTConfig()
+			cfg.Keys = NewStaticKey(&tt.key.PublicKey)
+			_, err := cfg.ValidateToken(context.Background(), signES(t, tt.alg, tt.hash, tt.key))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "curve") {
+					t.Errorf("Expected a curve mismatch error, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("ValidateToken failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestJWKSFetchDoesNotBlockCachedKeys(t *testing.T) {
+	t.Parallel()
+	b64 := base64.RawURLEncoding.EncodeToString
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release // the refetch for an unknown key ID hangs until released
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "n": b64(testRSAKey.N.Bytes()), "e": b64([]byte{1, 0, 1})},
+		}})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	jwks := NewJWKS(srv.URL)
+	cfg := testJWTConfig()
+	cfg.Keys = jwks
+	ctx := context.Background()
+	if _, err := cfg.ValidateToken(ctx, signRS256(t, "rsa-1", testClaims(nil))); err != nil {
+		t.Fatalf("RSA token from the key set: %v", err)
+	}
+
+	// Let the next unknown key ID refetch, and leave that fetch hanging
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Now().Add(-jwksMinRefresh)
+	jwks.mu.Unlock()
+	unknown := make(chan error, 1)
+	go func() {
+		_, err := cfg.ValidateToken(ctx, signRS256(t, "rotated", testClaims(nil)))
+		unknown <- err
+	}()
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Tokens with a cached key are validated while the fetch is in progress
+	cached := make(chan error, 1)
+	go func() {
+		_, err := cfg.ValidateToken(ctx, signRS256(t, "rsa-1", testClaims(nil)))
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Errorf("Cached key during a fetch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("A token with a cached key waited for the JWKS fetch")
+	}
+
+	// A cancelled request stops waiting for the fetch
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := jwks.Key(cancelled, "rotated"); err == nil {
+		t.Error("Expected an error for a cancelled request waiting on the fetch")
+	}
+
+	release <- struct{}{}
+	if err := <-unknown; err == nil || !strings.Contains(err.Error(), "unknown key ID") {
+		t.Errorf("Expected an unknown key ID error once the fetch completes, got %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("Expected one refetch, got %d fetches", n)
+	}
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	t.Parallel()
+	der, err := x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	key, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePublicKeyPEM failed: %v", err)
+	}
+	if pub, ok := key.(*rsa.PublicKey); !ok || !pub.Equal(&testRSAKey.PublicKey) {
+		t.Errorf("Unexpected key %T", key)
+	}
+	if _, err := ParsePublicKeyPEM([]byte("not pem")); err == nil {
+		t.Error("Expected an error for data without PEM")
+	}
+}
+
+func TestMiddleware_BearerToken(t *testing.T) {
+	t.Parallel()
+	cfg := testBasicAuthConfig()
+	cfg.APIKeys = []string{"key-1"}
+	cfg.JWT = testJWTConfig()
+
+	var gotUser string
+	handler := Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = UsernameFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(setup func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/changes", nil)
+		req.Header.Set("Accept", "text/html")
+		setup(req)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+signRS256(t, "", testClaims(nil))) })
+	if w.Code != http.StatusOK || gotUser != "user-123" {
+		t.Errorf("Valid token: expected 200 as user-123, got %d as %q", w.Code, gotUser)
+	}
+
+	// Invalid tokens get 401, even from a browser, instead of the login redirect
+	for name, claims := range map[string]map[string]any{
+		"expired":        {"exp": time.Now().Add(-time.Hour).Unix()},
+		"wrong audience": {"aud": "someone-else"},
+	} {
+		w := serve(func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+signRS256(t, "", testClaims(claims))) })
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), "invalid_token") {
+			t.Errorf("%s token: expected 401 with invalid_token, got %d %q", name, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// Basic Auth and API keys keep working alongside bearer tokens
+	gotUser = ""
+	if w := serve(func(r *http.Request) { r.SetBasicAuth("admin", "secret") }); w.Code != http.StatusOK || gotUser != "" {
+		t.Errorf("Basic Auth: expected 200, got %d", w.Code)
+	}
+	if w := serve(func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") }); w.Code != http.StatusOK {
+		t.Errorf("API key: expected 200, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+type BackupConfig struct {
+	HistoryURL  string // Connection to history database
+	OutputPath  string // Output file path (empty for default)
+	TablePrefix string // Prefix for history table names (empty for none)
+}
+
+type RestoreConfig struct {
+	HistoryURL  string // Connection to the (empty) history database to restore into
+	InputPath   string // Backup archive written by backup
+	TablePrefix string // Prefix for history table names (empty for none)
+}
+
+// ParseBackupArgs parses the backup command's arguments, returning the output
+// path (empty for the default). Backup takes no flags and at most one path.
+func ParseBackupArgs(args []string) (string, error) {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 1 {
+		return "", fmt.Errorf("backup takes at most one output path, got %d arguments", fs.NArg())
+	}
+	return fs.Arg(0), nil
+}
+
+// backupOutputPath returns the path a backup is written to: path, or a
+// timestamped name in the working directory when path is empty.
+func backupOutputPath(path string, now time.Time) string {
+	if path != "" {
+		return path
+	}
+	return fmt.Sprintf("crdb-cluster-history-backup-%s.zip", now.Format("20060102-150405"))
+}
+
+// RunBackup writes the whole history database to a zip archive that restore
+// can load into another database. The archive is written to a temporary file
+// next to the output path and only renamed into place once complete.
+func RunBackup(ctx context.Context, cfg BackupConfig) error {
+	slog.Info("Connecting to history database")
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	defer store.Close()
+
+	outputPath := backupOutputPath(cfg.OutputPath, time.Now())
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), filepath.Base(outputPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
+
+	manifest, err := store.Backup(ctx, tmp)
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	var total int64
+	for _, n := range manifest.Rows {
+		total += n
+	}
+	slog.Info("Backup complete", "file", outputPath, "rows", total, "snapshots", manifest.Rows["snapshots"], "changes", manifest.Rows["changes"])
+	return nil
+}
+
+// RunRestore loads a backup archive into an empty history database.
+func RunRestore(ctx context.Context, cfg RestoreConfig) error {
+	f, err := os.Open(cfg.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	slog.Info("Connecting to history database")
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	defer store.Close()
+
+	summary, err := store.Restore(ctx, f, info.Size(), exportMarkerKey)
+	if err != nil {
+		return err
+	}
+	if summary.Skipped > 0 {
+		slog.Warn("Skipped rows referring to rows missing from the backup", "rows", summary.Skipped)
+	}
+	var total int64
+	for _, n := range summary.Rows {
+		total += n
+	}
+	slog.Info("Restore complete", "rows", total, "snapshots", summary.Rows["snapshots"], "changes", summary.Rows["changes"])
+	return nil
+}
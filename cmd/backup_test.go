@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestParseBackupArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "no arguments", args: nil, want: ""},
+		{name: "output path", args: []string{"backups/history.zip"}, want: "backups/history.zip"},
+		{name: "path after terminator", args: []string{"--", "-history.zip"}, want: "-history.zip"},
+		{name: "extra argument", args: []string{"a.zip", "b.zip"}, wantErr: true},
+		{name: "unknown flag", args: []string{"--output", "a.zip"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBackupArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got path %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBackupArgs failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected path %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBackupOutputPath(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+
+	if got := backupOutputPath("", now); got != "crdb-cluster-history-backup-20240305-140709.zip" {
+		t.Errorf("Expected timestamped default path, got %q", got)
+	}
+	if got := backupOutputPath("out/history.zip", now); got != "out/history.zip" {
+		t.Errorf("Expected the given path to be kept, got %q", got)
+	}
+}
+
+func TestRunBackup(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	settings := []storage.Setting{
+		{Variable: "backup.cli.test", Value: "v1", SettingType: "s", Description: "CLI backup test"},
+	}
+	if err := store.SaveSnapshot(ctx, testClusterID, settings, "v25.1.0"); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	outputPath := filepath.Join(tmpDir, "history.zip")
+
+	if err := RunBackup(ctx, BackupConfig{HistoryURL: historyURL, OutputPath: outputPath}); err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	zr, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer zr.Close()
+	hasManifest := false
+	for _, f := range zr.File {
+		if f.Name == "manifest.json" {
+			hasManifest = true
+		}
+	}
+	if !hasManifest {
+		t.Error("Expected manifest.json in backup")
+	}
+
+	// The temporary file is renamed into place, leaving nothing else behind
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the backup in the output directory, got %d entries", len(entries))
+	}
+}
+
+func TestRunBackupMissingOutputDirectory(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	outputPath := filepath.Join(t.TempDir(), "missing", "history.zip")
+	if err := RunBackup(ctx, BackupConfig{HistoryURL: historyURL, OutputPath: outputPath}); err == nil {
+		t.Fatal("Expected an error for an output path in a missing directory")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+type CompactConfig struct {
+	HistoryURL  string        // Connection to history database
+	ClusterID   string        // Cluster ID to compact (empty for DefaultClusterID)
+	All         bool          // Compact every cluster in the history database
+	Window      time.Duration // Runs of changes returning to an earlier value within this long are collapsed
+	Output      io.Writer     // Where the summary is printed (nil for stdout)
+	TablePrefix string        // Prefix for history table names (empty for none)
+}
+
+// compactStore is the subset of storage operations compact needs.
+type compactStore interface {
+	ListClusters(ctx context.Context) ([]string, error)
+	CompactReverts(ctx context.Context, clusterID string, window time.Duration) (storage.CompactionResult, error)
+}
+
+// compactClusters compacts each cluster's reverts, printing a line per cluster.
+func compactClusters(ctx context.Context, store compactStore, clusters []string, window time.Duration, out io.Writer) error {
+	for _, clusterID := range clusters {
+		result, err := store.CompactReverts(ctx, clusterID, window)
+		if err != nil {
+			return fmt.Errorf("failed to compact cluster %s: %w", clusterID, err)
+		}
+		fmt.Fprintf(out, "%s: removed %d changes in %d revert sequences\n", clusterID, result.Removed, result.Sequences)
+	}
+	return nil
+}
+
+// RunCompact collapses runs of changes that return a setting to an earlier value
+// within the configured window.
+func RunCompact(ctx context.Context, cfg CompactConfig) error {
+	if cfg.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+
+	slog.Info("Connecting to history database")
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	defer store.Close()
+
+	var clusters []string
+	if cfg.All {
+		clusters, err = store.ListClusters(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list clusters: %w", err)
+		}
+	} else {
+		clusterID := cfg.ClusterID
+		if clusterID == "" {
+			clusterID = DefaultClusterID
+		}
+		clusters = []string{clusterID}
+	}
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	return compactClusters(ctx, store, clusters, cfg.Window, out)
+}
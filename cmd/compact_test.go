@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestCompactClusters(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer store.Close()
+
+	for _, v := range []string{"1", "2", "1", "2", "3"} {
+		settings := []storage.Setting{{Variable: "compact.setting", Value: v, SettingType: "s"}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := compactClusters(ctx, store, []string{"prod"}, time.Hour, &out); err != nil {
+		t.Fatalf("compactClusters failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "prod: removed 2 changes in 1 revert sequences") {
+		t.Errorf("Unexpected summary: %q", out.String())
+	}
+
+	changes, err := store.GetChanges(ctx, "prod", 10)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(changes) != 2 || changes[len(changes)-1].OldValue != "1" || changes[0].NewValue != "3" {
+		t.Errorf("Expected the history to still go from 1 to 3 in 2 changes, got %+v", changes)
+	}
+}
+
+func TestRunCompactRequiresWindow(t *testing.T) {
+	err := RunCompact(context.Background(), CompactConfig{HistoryURL: "postgresql://localhost/history"})
+	if err == nil || !strings.Contains(err.Error(), "window") {
+		t.Errorf("Expected a window error, got %v", err)
+	}
+}
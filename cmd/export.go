@@ -3,67 +3,128 @@ package cmd
 import (
 	"archive/zip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"crdb-cluster-history/storage"
 )
 
 type ExportConfig struct {
-	HistoryURL string // Connection to history database
-	OutputPath string // Output file path (empty for default)
-	ClusterID  string // Specific cluster ID to export (empty for all)
-	ExportAll  bool   // Export all clusters (creates one CSV per cluster)
+	HistoryURL      string                  // Connection to history database
+	OutputPath      string                  // Output file path (empty for default)
+	ClusterID       string                  // Cluster ID to export (empty for DefaultClusterID, unless ExportAll)
+	ExportAll       bool                    // Export all clusters when ClusterID is empty (one CSV per cluster)
+	TimestampFormat storage.TimestampFormat // Timezone and precision for detected_at (zero value is RFC3339)
+	Incremental     bool                    // Only export changes newer than the last incremental export
+	IncrementalLag  time.Duration           // Incremental exports stop at the first change detected this recently (zero for none)
+	Reproducible    bool                    // Fixed zip timestamps and a content-derived default filename
+	Summary         bool                    // Add a per-cluster summary CSV of the exported changes
+	Format          string                  // Format of the changes files: csv (default) or json
+	TablePrefix     string                  // Prefix for history table names (empty for none)
+	Redactor        *storage.Redactor       // Redacts sensitive metadata values (nil for none)
 }
 
+// DefaultClusterID is the cluster ID used in single-cluster (environment variable)
+// mode, and exported or followed when no cluster is named.
+const DefaultClusterID = "default"
+
+// exportMarkerKey is the metadata key holding the highest change ID written by the
+// last successful incremental export of a cluster.
+const exportMarkerKey = storage.MetadataExportMarker
+
+// DefaultIncrementalLag is how recently detected a change can be and still be
+// written by an incremental export. Saves take well under this long to commit.
+const DefaultIncrementalLag = time.Minute
+
+// errUnsettled stops an incremental export at a change too recent to be settled.
+var errUnsettled = errors.New("change detected within the incremental lag")
+
+// Formats of the changes files in an export archive.
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// reproducibleModTime is the modification time stamped on every zip entry of a
+// reproducible export: the earliest time the zip format can represent.
+var reproducibleModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func RunExport(ctx context.Context, cfg ExportConfig) error {
+	format := cfg.Format
+	switch format {
+	case "":
+		format = exportFormatCSV
+	case exportFormatCSV, exportFormatJSON:
+	default:
+		return fmt.Errorf("invalid format %q (use csv or json)", format)
+	}
+
 	// Connect to history database
 	slog.Info("Connecting to history database")
-	store, err := storage.New(ctx, cfg.HistoryURL)
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
 	if err != nil {
 		return fmt.Errorf("failed to connect to history database: %w", err)
 	}
 	defer store.Close()
 
-	// Determine output path
-	outputPath := cfg.OutputPath
-	if outputPath == "" {
-		outputPath = fmt.Sprintf("crdb-cluster-history-export-%s.zip", time.Now().Format("20060102-150405"))
+	clusterIDs, err := exportClusterIDs(ctx, store, cfg)
+	if err != nil {
+		return err
+	}
+	if len(clusterIDs) == 0 {
+		slog.Info("No clusters found in database")
+		return nil
 	}
 
-	// Create zip file
-	zipFile, err := os.Create(outputPath)
+	// Determine output path. A reproducible export without an explicit path is
+	// written to a temporary file and renamed after its content hash once complete.
+	outputPath := cfg.OutputPath
+	contentNamed := outputPath == "" && cfg.Reproducible
+	var zipFile *os.File
+	if contentNamed {
+		zipFile, err = os.CreateTemp(".", "crdb-cluster-history-export-*.zip.tmp")
+		if err == nil {
+			outputPath = zipFile.Name()
+			defer func() {
+				if contentNamed {
+					os.Remove(outputPath) // not renamed: the export failed or was empty
+				}
+			}()
+		}
+	} else {
+		if outputPath == "" {
+			outputPath = fmt.Sprintf("crdb-cluster-history-export-%s.zip", time.Now().Format("20060102-150405"))
+		}
+		zipFile, err = os.Create(outputPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
 	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
+	digest := sha256.New()
+	zipWriter := zip.NewWriter(io.MultiWriter(zipFile, digest))
 	defer zipWriter.Close()
 
-	// Determine which clusters to export
-	var clusterIDs []string
-	if cfg.ClusterID != "" {
-		// Export specific cluster
-		clusterIDs = []string{cfg.ClusterID}
-	} else if cfg.ExportAll {
-		// Export all clusters from database
-		clusterIDs, err = store.ListClusters(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to list clusters: %w", err)
-		}
-		if len(clusterIDs) == 0 {
-			slog.Info("No clusters found in database")
-			return nil
+	createEntry := func(name string) (io.Writer, error) {
+		if !cfg.Reproducible {
+			return zipWriter.Create(name)
 		}
-		slog.Info("Found clusters to export", "count", len(clusterIDs))
-	} else {
-		clusterIDs = []string{"default"}
+		return zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: reproducibleModTime})
 	}
 
 	totalChanges := 0
+	// Markers are only advanced once the whole archive has been written
+	markers := make(map[string]int64)
 	for _, clusterID := range clusterIDs {
 		// Get source cluster ID for this config cluster ID (if available)
 		sourceClusterID, err := store.GetSourceClusterID(ctx, clusterID)
@@ -71,30 +132,94 @@ func RunExport(ctx context.Context, cfg ExportConfig) error {
 			sourceClusterID = clusterID
 		}
 
-		// Create CSV file inside zip
-		csvFileName := fmt.Sprintf("crdb-cluster-history-%s.csv", sourceClusterID)
-		csvFile, err := zipWriter.Create(csvFileName)
+		// Create the changes file inside zip, named for its format
+		changesFileName := fmt.Sprintf("crdb-cluster-history-%s.%s", sourceClusterID, format)
+		changesFile, err := createEntry(changesFileName)
 		if err != nil {
-			return fmt.Errorf("failed to create CSV in zip for cluster %s: %w", clusterID, err)
+			return fmt.Errorf("failed to create %s in zip for cluster %s: %w", changesFileName, clusterID, err)
+		}
+
+		// Stream changes directly to the file
+		var changeWriter storage.ChangeWriter
+		if format == exportFormatJSON {
+			changeWriter = storage.NewJSONChangeWriter(changesFile).WithTimestampFormat(cfg.TimestampFormat)
+		} else {
+			changeWriter = storage.NewCSVChangeWriter(changesFile).WithTimestampFormat(cfg.TimestampFormat)
+		}
+		if err := changeWriter.WriteHeader(); err != nil {
+			return fmt.Errorf("failed to write header for cluster %s: %w", clusterID, err)
 		}
 
-		// Stream changes directly to CSV
-		csvWriter := storage.NewCSVChangeWriter(csvFile)
-		if err := csvWriter.WriteHeader(); err != nil {
-			return fmt.Errorf("failed to write CSV header for cluster %s: %w", clusterID, err)
+		// Count every written change into the summary, when one is wanted
+		var summary *storage.ExportSummary
+		write := changeWriter.WriteChange
+		if cfg.Summary {
+			summary = &storage.ExportSummary{}
+			write = func(c storage.Change) error {
+				if err := changeWriter.WriteChange(c); err != nil {
+					return err
+				}
+				summary.Add(c)
+				return nil
+			}
 		}
 
 		count := 0
-		err = store.StreamChanges(ctx, clusterID, func(c storage.Change) error {
-			count++
-			return csvWriter.WriteChange(c)
-		})
+		if cfg.Incremental {
+			// Assigned rather than declared, so a stream error reaches the check below
+			var afterID int64
+			afterID, err = getExportMarker(ctx, store, clusterID)
+			if err != nil {
+				return err
+			}
+			maxID := afterID
+			cutoff := time.Now().Add(-cfg.IncrementalLag)
+			err = store.StreamChangesAfter(ctx, clusterID, afterID, untilUnsettled(cutoff, func(id int64, c storage.Change) error {
+				count++
+				if id > maxID {
+					maxID = id
+				}
+				return write(c)
+			}))
+			if errors.Is(err, errUnsettled) {
+				err = nil
+			}
+			if maxID > afterID {
+				markers[clusterID] = maxID
+			}
+		} else {
+			err = store.StreamChanges(ctx, clusterID, func(c storage.Change) error {
+				count++
+				return write(c)
+			})
+		}
 		if err != nil {
 			return fmt.Errorf("failed to stream changes for cluster %s: %w", clusterID, err)
 		}
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
-			return fmt.Errorf("CSV error for cluster %s: %w", clusterID, err)
+		if err := changeWriter.Close(); err != nil {
+			return fmt.Errorf("failed to write changes for cluster %s: %w", clusterID, err)
+		}
+
+		if summary != nil {
+			summaryFile, err := createEntry(fmt.Sprintf("crdb-cluster-history-%s-summary.csv", sourceClusterID))
+			if err != nil {
+				return fmt.Errorf("failed to create summary in zip for cluster %s: %w", clusterID, err)
+			}
+			if err := summary.WriteCSV(summaryFile, cfg.TimestampFormat); err != nil {
+				return fmt.Errorf("failed to write summary for cluster %s: %w", clusterID, err)
+			}
+		}
+
+		md, err := store.GetAllMetadata(ctx, clusterID)
+		if err != nil {
+			return fmt.Errorf("failed to get metadata for cluster %s: %w", clusterID, err)
+		}
+		mdFile, err := createEntry(fmt.Sprintf("crdb-cluster-history-%s-metadata.json", sourceClusterID))
+		if err != nil {
+			return fmt.Errorf("failed to create metadata in zip for cluster %s: %w", clusterID, err)
+		}
+		if err := storage.WriteMetadataJSON(mdFile, clusterID, storage.ExportedMetadata(md, cfg.Redactor)); err != nil {
+			return fmt.Errorf("failed to write metadata for cluster %s: %w", clusterID, err)
 		}
 
 		if count == 0 {
@@ -114,6 +239,88 @@ func RunExport(ctx context.Context, cfg ExportConfig) error {
 		return nil
 	}
 
+	// Close explicitly so a failed write is reported before any marker moves
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalize zip: %w", err)
+	}
+	if err := zipFile.Close(); err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+	if contentNamed {
+		finalPath := fmt.Sprintf("crdb-cluster-history-export-%s.zip", hex.EncodeToString(digest.Sum(nil))[:16])
+		if err := os.Rename(outputPath, finalPath); err != nil {
+			return fmt.Errorf("failed to rename export file: %w", err)
+		}
+		outputPath = finalPath
+		contentNamed = false
+	}
+
+	for clusterID, maxID := range markers {
+		if err := store.SetMetadata(ctx, clusterID, exportMarkerKey, strconv.FormatInt(maxID, 10)); err != nil {
+			return fmt.Errorf("failed to update export marker for cluster %s: %w", clusterID, err)
+		}
+	}
+
 	slog.Info("Export completed", "total_changes", totalChanges, "output", outputPath)
 	return nil
 }
+
+// clusterLister lists the clusters that have history.
+type clusterLister interface {
+	ListClusters(ctx context.Context) ([]string, error)
+}
+
+// exportClusterIDs returns the clusters an export covers: the named cluster (or
+// DefaultClusterID when none is named), or every cluster with history when
+// ExportAll is set without a cluster. A named cluster without history is an error,
+// so a mistyped ID is not mistaken for a cluster with nothing to export.
+func exportClusterIDs(ctx context.Context, store clusterLister, cfg ExportConfig) ([]string, error) {
+	clusters, err := store.ListClusters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
+	}
+	if cfg.ClusterID == "" && cfg.ExportAll {
+		slog.Info("Found clusters to export", "count", len(clusters))
+		return clusters, nil
+	}
+
+	clusterID := cfg.ClusterID
+	if clusterID == "" {
+		clusterID = DefaultClusterID
+	}
+	if !slices.Contains(clusters, clusterID) {
+		return nil, fmt.Errorf("cluster %q has no history (clusters with history: %s)", clusterID, strings.Join(clusters, ", "))
+	}
+	return []string{clusterID}, nil
+}
+
+// untilUnsettled wraps fn to stop at the first change detected at or after
+// cutoff with errUnsettled. Change IDs in CockroachDB come from unique_rowid and
+// do not follow commit order, so a save still committing can hold a lower ID
+// than a change already visible. Stopping at the first recent change, rather
+// than skipping it, keeps the marker below any ID that can still appear.
+func untilUnsettled(cutoff time.Time, fn func(int64, storage.Change) error) func(int64, storage.Change) error {
+	return func(id int64, c storage.Change) error {
+		if !c.DetectedAt.Before(cutoff) {
+			return errUnsettled
+		}
+		return fn(id, c)
+	}
+}
+
+// getExportMarker returns the highest change ID exported by the last incremental
+// export of the cluster, or 0 if it has never been exported incrementally.
+func getExportMarker(ctx context.Context, store *storage.Store, clusterID string) (int64, error) {
+	value, err := store.GetMetadata(ctx, clusterID, exportMarkerKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get export marker for cluster %s: %w", clusterID, err)
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid export marker %q for cluster %s: %w", value, clusterID, err)
+	}
+	return id, nil
+}
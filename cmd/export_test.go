@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -90,6 +95,79 @@ func TestRunExport(t *testing.T) {
 	}
 }
 
+func TestRunExportIncludesMetadata(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	clusterID := "export-metadata-" + time.Now().Format("20060102150405.000")
+	t.Cleanup(func() { store.CleanupOldChanges(context.Background(), clusterID, 0) })
+	for _, v := range []string{"v1", "v2"} {
+		settings := []storage.Setting{{Variable: "export.metadata.test", Value: v, SettingType: "s"}}
+		if err := store.SaveSnapshot(ctx, clusterID, settings, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+	if err := store.SetDatabaseVersion(ctx, clusterID, "CockroachDB CCL v25.1.0"); err != nil {
+		t.Fatalf("SetDatabaseVersion failed: %v", err)
+	}
+	for k, v := range map[string]string{"license.key": "secret-value", exportMarkerKey: "1"} {
+		if err := store.SetMetadata(ctx, clusterID, k, v); err != nil {
+			t.Fatalf("SetMetadata(%s) failed: %v", k, err)
+		}
+	}
+
+	cfg := ExportConfig{
+		HistoryURL: historyURL,
+		OutputPath: filepath.Join(t.TempDir(), "export.zip"),
+		ClusterID:  clusterID,
+		Redactor:   storage.NewRedactor(storage.RedactorConfig{Enabled: true}),
+	}
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("RunExport failed: %v", err)
+	}
+
+	zr, err := zip.OpenReader(cfg.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	defer zr.Close()
+	var md storage.MetadataExport
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, "-metadata.json") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		err = json.NewDecoder(rc).Decode(&md)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", f.Name, err)
+		}
+	}
+	if md.ClusterID != clusterID {
+		t.Fatalf("Expected a metadata file for %s, got %+v", clusterID, md)
+	}
+	if got := md.Metadata["database_version"]; got != "CockroachDB CCL v25.1.0" {
+		t.Errorf("Expected database_version in metadata, got %q", got)
+	}
+	if got := md.Metadata["license.key"]; got != storage.RedactedPlaceholder {
+		t.Errorf("Expected sensitive metadata to be redacted, got %q", got)
+	}
+	if got, ok := md.Metadata[exportMarkerKey]; ok {
+		t.Errorf("Expected the export marker left out of the metadata, got %q", got)
+	}
+}
+
 func TestRunExportDefaultPath(t *testing.T) {
 	historyURL := getHistoryURL(t)
 
@@ -146,3 +224,407 @@ func TestRunExportDefaultPath(t *testing.T) {
 		t.Error("Expected default output file to be created")
 	}
 }
+
+// readExportedCSV returns the data rows of the first CSV file in the zip at path.
+func readExportedCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".csv") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		defer rc.Close()
+		records, err := csv.NewReader(rc).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read CSV: %v", err)
+		}
+		return records[1:]
+	}
+	t.Fatal("Expected a CSV file in zip")
+	return nil
+}
+
+func TestRunExportIncremental(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	clusterID := "export-incremental-" + time.Now().Format("20060102150405.000")
+	t.Cleanup(func() { store.CleanupOldChanges(context.Background(), clusterID, 0) })
+
+	save := func(value string) {
+		t.Helper()
+		settings := []storage.Setting{{Variable: "export.incremental.test", Value: value, SettingType: "s"}}
+		if err := store.SaveSnapshot(ctx, clusterID, settings, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+	save("v1")
+	save("v2")
+	save("v3")
+
+	tmpDir := t.TempDir()
+	cfg := ExportConfig{
+		HistoryURL:     historyURL,
+		OutputPath:     filepath.Join(tmpDir, "first.zip"),
+		ClusterID:      clusterID,
+		Incremental:    true,
+		IncrementalLag: time.Hour,
+	}
+
+	// Changes detected within the lag are left for a later export
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("Lagged incremental export failed: %v", err)
+	}
+	if _, err := os.Stat(cfg.OutputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no archive while every change is within the lag, got %v", err)
+	}
+	if marker, _ := store.GetMetadata(ctx, clusterID, exportMarkerKey); marker != "" {
+		t.Errorf("Expected the marker to stay unset while every change is within the lag, got %q", marker)
+	}
+
+	cfg.IncrementalLag = 0
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("First incremental export failed: %v", err)
+	}
+	if rows := readExportedCSV(t, cfg.OutputPath); len(rows) != 2 {
+		t.Fatalf("Expected 2 changes in first export, got %d", len(rows))
+	}
+
+	save("v4")
+
+	cfg.OutputPath = filepath.Join(tmpDir, "second.zip")
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("Second incremental export failed: %v", err)
+	}
+	rows := readExportedCSV(t, cfg.OutputPath)
+	if len(rows) != 1 || !slices.Contains(rows[0], "v4") {
+		t.Errorf("Expected only the new change in second export, got %v", rows)
+	}
+
+	// Nothing new: no archive is written and the marker stays put
+	cfg.OutputPath = filepath.Join(tmpDir, "third.zip")
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("Third incremental export failed: %v", err)
+	}
+	if _, err := os.Stat(cfg.OutputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no archive when there are no new changes, got %v", err)
+	}
+}
+
+func TestUntilUnsettled(t *testing.T) {
+	cutoff := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// IDs follow insertion, not commit order: change 3 is recent, and change 4
+	// was detected earlier by a save that committed later
+	changes := []struct {
+		id         int64
+		detectedAt time.Time
+	}{
+		{1, cutoff.Add(-time.Hour)},
+		{2, cutoff.Add(-time.Second)},
+		{3, cutoff},
+		{4, cutoff.Add(-time.Minute)},
+	}
+
+	var seen []int64
+	fn := untilUnsettled(cutoff, func(id int64, c storage.Change) error {
+		seen = append(seen, id)
+		return nil
+	})
+	var err error
+	for _, c := range changes {
+		if err = fn(c.id, storage.Change{DetectedAt: c.detectedAt}); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, errUnsettled) {
+		t.Errorf("Expected errUnsettled at the first recent change, got %v", err)
+	}
+	if !slices.Equal(seen, []int64{1, 2}) {
+		t.Errorf("Expected only the changes before the first recent one, got %v", seen)
+	}
+}
+
+func TestRunExportIncrementalFailureKeepsMarker(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	clusterID := "export-incremental-fail-" + time.Now().Format("20060102150405.000")
+	t.Cleanup(func() { store.CleanupOldChanges(context.Background(), clusterID, 0) })
+
+	for _, v := range []string{"v1", "v2"} {
+		settings := []storage.Setting{{Variable: "export.incremental.test", Value: v, SettingType: "s"}}
+		if err := store.SaveSnapshot(ctx, clusterID, settings, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+
+	cfg := ExportConfig{
+		HistoryURL:  historyURL,
+		OutputPath:  filepath.Join(t.TempDir(), "missing-dir", "export.zip"),
+		ClusterID:   clusterID,
+		Incremental: true,
+	}
+	if err := RunExport(ctx, cfg); err == nil {
+		t.Fatal("Expected export to an unwritable path to fail")
+	}
+
+	marker, err := store.GetMetadata(ctx, clusterID, exportMarkerKey)
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if marker != "" {
+		t.Errorf("Expected marker to stay unset after a failed export, got %q", marker)
+	}
+}
+
+func TestRunExportReproducible(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	clusterID := "export-reproducible-" + time.Now().Format("20060102150405.000")
+	t.Cleanup(func() { store.CleanupOldChanges(context.Background(), clusterID, 0) })
+
+	for _, v := range []string{"v1", "v2", "v3"} {
+		settings := []storage.Setting{
+			{Variable: "export.reproducible.a", Value: v, SettingType: "s"},
+			{Variable: "export.reproducible.b", Value: v, SettingType: "s"},
+		}
+		if err := store.SaveSnapshot(ctx, clusterID, settings, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+
+	// Chdir to temp dir so the content-named output doesn't pollute the workspace
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	tmpDir := t.TempDir()
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalDir)
+
+	cfg := ExportConfig{HistoryURL: historyURL, ClusterID: clusterID, Reproducible: true}
+	var archives [][]byte
+	for _, name := range []string{"first.zip", "second.zip"} {
+		cfg.OutputPath = name
+		if err := RunExport(ctx, cfg); err != nil {
+			t.Fatalf("RunExport failed: %v", err)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read export: %v", err)
+		}
+		archives = append(archives, data)
+	}
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("Expected reproducible exports of the same data to be byte-identical")
+	}
+
+	cfg.OutputPath = ""
+	if err := RunExport(ctx, cfg); err != nil {
+		t.Fatalf("RunExport failed: %v", err)
+	}
+	files, err := filepath.Glob("crdb-cluster-history-export-*")
+	if err != nil {
+		t.Fatalf("Failed to glob: %v", err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".zip") {
+		t.Fatalf("Expected a single content-named archive, got %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if !bytes.Equal(data, archives[0]) {
+		t.Error("Expected the content-named archive to match the explicit-path exports")
+	}
+}
+
+func TestExportClusterIDs(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, id := range []string{DefaultClusterID, "prod", "staging"} {
+		if err := store.SaveSnapshot(ctx, id, []storage.Setting{{Variable: "a", Value: "1"}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshot failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     ExportConfig
+		want    []string
+		wantErr bool
+	}{
+		{"default cluster", ExportConfig{}, []string{DefaultClusterID}, false},
+		{"named cluster", ExportConfig{ClusterID: "prod"}, []string{"prod"}, false},
+		{"named cluster wins over all", ExportConfig{ClusterID: "prod", ExportAll: true}, []string{"prod"}, false},
+		{"all clusters", ExportConfig{ExportAll: true}, []string{DefaultClusterID, "prod", "staging"}, false},
+		{"unknown cluster", ExportConfig{ClusterID: "prdo"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exportClusterIDs(ctx, store, tt.cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "prod") {
+					t.Errorf("Expected an error listing the known clusters, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exportClusterIDs failed: %v", err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("exportClusterIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunExportSingleCluster(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	suffix := time.Now().Format("150405.000000")
+	target := "single-" + suffix
+	other := "other-" + suffix
+	for _, clusterID := range []string{target, other} {
+		for _, v := range []string{"1", "2"} {
+			settings := []storage.Setting{{Variable: "export.single." + clusterID, Value: v}}
+			if err := store.SaveSnapshot(ctx, clusterID, settings, "v25.1.0"); err != nil {
+				t.Fatalf("Failed to save snapshot: %v", err)
+			}
+		}
+	}
+	sourceID := "src-" + suffix
+	if err := store.SetSourceClusterID(ctx, target, sourceID); err != nil {
+		t.Fatalf("Failed to set source cluster ID: %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "single.zip")
+	if err := RunExport(ctx, ExportConfig{HistoryURL: historyURL, OutputPath: outputPath, ClusterID: target}); err != nil {
+		t.Fatalf("RunExport failed: %v", err)
+	}
+
+	zr, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	zr.Close()
+	want := []string{"crdb-cluster-history-" + sourceID + ".csv", "crdb-cluster-history-" + sourceID + "-metadata.json"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Expected zip entries %v, got %v", want, names)
+	}
+
+	rows := readExportedCSV(t, outputPath)
+	if len(rows) != 1 || !slices.Contains(rows[0], "export.single."+target) {
+		t.Errorf("Expected only the target cluster's change, got %v", rows)
+	}
+
+	err = RunExport(ctx, ExportConfig{HistoryURL: historyURL, OutputPath: outputPath, ClusterID: "missing-" + suffix})
+	if err == nil || !strings.Contains(err.Error(), "has no history") {
+		t.Errorf("Expected an error for a cluster without history, got %v", err)
+	}
+}
+
+func TestRunExportJSON(t *testing.T) {
+	historyURL := getHistoryURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	clusterID := "json-" + time.Now().Format("150405.000000")
+	for _, v := range []string{"1", "2"} {
+		if err := store.SaveSnapshot(ctx, clusterID, []storage.Setting{{Variable: "export.json.test", Value: v}}, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "json.zip")
+	if err := RunExport(ctx, ExportConfig{HistoryURL: historyURL, OutputPath: outputPath, ClusterID: clusterID, Format: "json"}); err != nil {
+		t.Fatalf("RunExport failed: %v", err)
+	}
+
+	zr, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	defer zr.Close()
+	f := zr.File[0]
+	if f.Name != "crdb-cluster-history-"+clusterID+".json" {
+		t.Fatalf("Expected a JSON changes file, got %s", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	var rows []map[string]string
+	if err := json.NewDecoder(rc).Decode(&rows); err != nil {
+		t.Fatalf("Invalid JSON in %s: %v", f.Name, err)
+	}
+	if len(rows) != 1 || rows[0]["variable"] != "export.json.test" || rows[0]["old_value"] != "1" || rows[0]["new_value"] != "2" {
+		t.Errorf("Expected the one change, got %v", rows)
+	}
+}
+
+func TestRunExportInvalidFormat(t *testing.T) {
+	err := RunExport(context.Background(), ExportConfig{Format: "xml"})
+	if err == nil || !strings.Contains(err.Error(), `invalid format "xml"`) {
+		t.Errorf("Expected an invalid format error, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+type GenConfigConfig struct {
+	Sample     []byte    // Commented example configuration to write
+	OutputPath string    // File to write (empty or "-" for Output)
+	Force      bool      // Overwrite OutputPath if it exists
+	Output     io.Writer // Where the example is written without OutputPath (nil for stdout)
+}
+
+// RunGenConfig writes the example configuration, refusing to replace an existing
+// file unless Force is set.
+func RunGenConfig(cfg GenConfigConfig) error {
+	if cfg.OutputPath == "" || cfg.OutputPath == "-" {
+		out := cfg.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		_, err := out.Write(cfg.Sample)
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if cfg.Force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	// Owner-only, since the file is about to hold database credentials
+	f, err := os.OpenFile(cfg.OutputPath, flags, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists (use --force to overwrite it)", cfg.OutputPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	if _, err := f.Write(cfg.Sample); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	slog.Info("Wrote example configuration", "path", cfg.OutputPath)
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunGenConfig(t *testing.T) {
+	sample := []byte("poll_interval: 15m\n")
+
+	t.Run("stdout", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := RunGenConfig(GenConfigConfig{Sample: sample, Output: &out}); err != nil {
+			t.Fatalf("RunGenConfig failed: %v", err)
+		}
+		if out.String() != string(sample) {
+			t.Errorf("Output = %q, want %q", out.String(), sample)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "clusters.yaml")
+		if err := RunGenConfig(GenConfigConfig{Sample: sample, OutputPath: path}); err != nil {
+			t.Fatalf("RunGenConfig failed: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != string(sample) {
+			t.Errorf("File = %q, %v; want %q", got, err, sample)
+		}
+	})
+
+	t.Run("existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "clusters.yaml")
+		if err := os.WriteFile(path, []byte("mine"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := RunGenConfig(GenConfigConfig{Sample: sample, OutputPath: path})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected an already exists error, got %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "mine" {
+			t.Errorf("Existing file was modified: %q", got)
+		}
+
+		if err := RunGenConfig(GenConfigConfig{Sample: sample, OutputPath: path, Force: true}); err != nil {
+			t.Fatalf("RunGenConfig with Force failed: %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != string(sample) {
+			t.Errorf("File after Force = %q, want %q", got, sample)
+		}
+	})
+}
@@ -18,6 +18,7 @@ type InitConfig struct {
 	Username       string // Username for the history user
 	Password       string // Password for the history user (optional in insecure mode)
 	SourceUsername string // Username for monitoring the source cluster (optional; receives VIEWCLUSTERMETADATA grant)
+	TablePrefix    string // Prefix for history table names (optional)
 }
 
 func RunInit(ctx context.Context, cfg InitConfig) error {
@@ -111,7 +112,7 @@ func RunInit(ctx context.Context, cfg InitConfig) error {
 		return fmt.Errorf("building history database URL: %w", err)
 	}
 	slog.Info("Running schema migrations", "database", cfg.DatabaseName)
-	if err := storage.Migrate(ctx, historyURL); err != nil {
+	if err := storage.Migrate(ctx, historyURL, storage.WithTablePrefix(cfg.TablePrefix)); err != nil {
 		return fmt.Errorf("schema migration failed: %w", err)
 	}
 
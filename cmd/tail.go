@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// DefaultTailInterval is how often tail polls the history database for new changes.
+const DefaultTailInterval = 2 * time.Second
+
+type TailConfig struct {
+	HistoryURL      string                  // Connection to history database
+	ClusterID       string                  // Cluster ID to follow (empty for DefaultClusterID)
+	All             bool                    // Follow every cluster in the history database
+	Interval        time.Duration           // Poll interval (zero uses DefaultTailInterval)
+	TimestampFormat storage.TimestampFormat // Timezone and precision for printed timestamps
+	Output          io.Writer               // Where changes are printed (nil for stdout)
+	TablePrefix     string                  // Prefix for history table names (empty for none)
+}
+
+// tailStore is the subset of storage operations tail needs.
+type tailStore interface {
+	ListClusters(ctx context.Context) ([]string, error)
+	GetChangesWithAnnotations(ctx context.Context, clusterID string, limit int) ([]storage.ChangeWithAnnotation, error)
+	StreamChangesAfter(ctx context.Context, clusterID string, afterID int64, fn func(int64, storage.Change) error) error
+}
+
+// tailer prints changes detected after it started, remembering the last change ID
+// printed for each cluster.
+type tailer struct {
+	store    tailStore
+	clusters []string // fixed clusters to follow; nil follows every cluster
+	tf       storage.TimestampFormat
+	out      io.Writer
+	cursors  map[string]int64
+	primed   bool
+}
+
+func newTailer(store tailStore, clusters []string, tf storage.TimestampFormat, out io.Writer) *tailer {
+	return &tailer{store: store, clusters: clusters, tf: tf, out: out, cursors: make(map[string]int64)}
+}
+
+// prime positions every known cluster at its newest change, so only changes
+// detected from now on are printed. Clusters that appear later are printed in full.
+func (t *tailer) prime(ctx context.Context) error {
+	clusters, err := t.clusterIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, clusterID := range clusters {
+		latest, err := t.store.GetChangesWithAnnotations(ctx, clusterID, 1)
+		if err != nil {
+			return fmt.Errorf("failed to get latest change for cluster %s: %w", clusterID, err)
+		}
+		t.cursors[clusterID] = 0
+		if len(latest) > 0 {
+			t.cursors[clusterID] = latest[0].ID
+		}
+	}
+	t.primed = true
+	return nil
+}
+
+// poll prints the changes detected since the previous poll and returns how many it printed.
+func (t *tailer) poll(ctx context.Context) (int, error) {
+	if !t.primed {
+		if err := t.prime(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	clusters, err := t.clusterIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	printed := 0
+	for _, clusterID := range clusters {
+		cursor := t.cursors[clusterID]
+		err := t.store.StreamChangesAfter(ctx, clusterID, cursor, func(id int64, c storage.Change) error {
+			if id > cursor {
+				cursor = id
+			}
+			printed++
+			_, err := fmt.Fprintf(t.out, "%s  %s  %s  %s → %s\n",
+				t.tf.Format(c.DetectedAt), clusterID, c.Variable, tailValue(c.OldValue), tailValue(c.NewValue))
+			return err
+		})
+		t.cursors[clusterID] = cursor
+		if err != nil {
+			return printed, fmt.Errorf("failed to read changes for cluster %s: %w", clusterID, err)
+		}
+	}
+	return printed, nil
+}
+
+func (t *tailer) clusterIDs(ctx context.Context) ([]string, error) {
+	if t.clusters != nil {
+		return t.clusters, nil
+	}
+	clusters, err := t.store.ListClusters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
+	}
+	return clusters, nil
+}
+
+// tailValue marks the empty side of an added or removed setting with a dash.
+func tailValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// RunTail prints changes as they are detected until ctx is cancelled.
+func RunTail(ctx context.Context, cfg TailConfig) error {
+	slog.Info("Connecting to history database")
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	defer store.Close()
+
+	var clusters []string
+	if !cfg.All {
+		clusterID := cfg.ClusterID
+		if clusterID == "" {
+			clusterID = DefaultClusterID
+		}
+		clusters = []string{clusterID}
+	}
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultTailInterval
+	}
+
+	t := newTailer(store, clusters, cfg.TimestampFormat, out)
+	if err := t.prime(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := t.poll(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				slog.Warn("Failed to poll for changes", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestTailerPoll(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer store.Close()
+
+	save := func(clusterID, value string) {
+		t.Helper()
+		settings := []storage.Setting{{Variable: "tail.setting", Value: value, SettingType: "s"}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	save("prod", "1")
+	save("prod", "2") // existing change, not printed
+
+	var out bytes.Buffer
+	tl := newTailer(store, []string{"prod"}, storage.TimestampFormat{}, &out)
+	if err := tl.prime(ctx); err != nil {
+		t.Fatalf("prime failed: %v", err)
+	}
+
+	save("prod", "3")
+	save("staging", "1") // not followed
+	save("staging", "2")
+
+	n, err := tl.poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if n != 1 || !strings.Contains(out.String(), "prod  tail.setting  2 → 3") {
+		t.Errorf("Expected only the new prod change, got %d: %q", n, out.String())
+	}
+
+	out.Reset()
+	if n, err := tl.poll(ctx); err != nil || n != 0 || out.Len() != 0 {
+		t.Errorf("Expected nothing on an idle poll, got %d, %v: %q", n, err, out.String())
+	}
+}
+
+func TestTailerPollAll(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer store.Close()
+
+	save := func(clusterID, value string) {
+		t.Helper()
+		settings := []storage.Setting{{Variable: "tail.setting", Value: value, SettingType: "s"}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	save("prod", "1")
+	save("prod", "2")
+
+	var out bytes.Buffer
+	tl := newTailer(store, nil, storage.TimestampFormat{}, &out)
+	if err := tl.prime(ctx); err != nil {
+		t.Fatalf("prime failed: %v", err)
+	}
+
+	save("prod", "3")
+	save("staging", "a") // cluster first seen after tail started
+	save("staging", "b")
+
+	n, err := tl.poll(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	got := out.String()
+	if n != 2 || !strings.Contains(got, "prod  tail.setting  2 → 3") || !strings.Contains(got, "staging  tail.setting  a → b") {
+		t.Errorf("Expected new changes from both clusters, got %d: %q", n, got)
+	}
+}
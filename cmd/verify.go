@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"crdb-cluster-history/storage"
+)
+
+type VerifyConfig struct {
+	HistoryURL  string    // Connection to history database
+	Repair      bool      // Delete orphan settings and annotations
+	Output      io.Writer // Where the report is printed (nil for stdout)
+	TablePrefix string    // Prefix for history table names (empty for none)
+}
+
+// integrityStore is the subset of storage operations verify needs.
+type integrityStore interface {
+	VerifyIntegrity(ctx context.Context, repair bool) (storage.IntegrityReport, error)
+}
+
+// verifyStore checks store's integrity and prints a line per kind of anomaly.
+// It fails when anomalies remain after any repair.
+func verifyStore(ctx context.Context, store integrityStore, repair bool, out io.Writer) error {
+	report, err := store.VerifyIntegrity(ctx, repair)
+	if err != nil {
+		return fmt.Errorf("failed to verify history: %w", err)
+	}
+	fmt.Fprintf(out, "orphan settings: %d\n", report.OrphanSettings)
+	fmt.Fprintf(out, "orphan annotations: %d\n", report.OrphanAnnotations)
+	for _, clusterID := range report.OrphanChangeClusters() {
+		fmt.Fprintf(out, "orphan changes: %s: %d (the cluster has no snapshots)\n", clusterID, report.OrphanChanges[clusterID])
+	}
+	if repair {
+		fmt.Fprintf(out, "repaired: %d\n", report.Repaired)
+	}
+	if remaining := report.Problems() - report.Repaired; remaining > 0 {
+		return fmt.Errorf("found %d integrity problems", remaining)
+	}
+	return nil
+}
+
+// RunVerify checks the history database for rows referring to data that no
+// longer exists, optionally deleting the orphans that can be repaired.
+func RunVerify(ctx context.Context, cfg VerifyConfig) error {
+	slog.Info("Connecting to history database")
+	store, err := storage.New(ctx, cfg.HistoryURL, storage.WithTablePrefix(cfg.TablePrefix))
+	if err != nil {
+		return fmt.Errorf("failed to connect to history database: %w", err)
+	}
+	defer store.Close()
+
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	return verifyStore(ctx, store, cfg.Repair, out)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/storage"
+)
+
+// fakeIntegrityStore reports a fixed set of anomalies, repairing the orphan
+// settings and annotations when asked.
+type fakeIntegrityStore struct {
+	report storage.IntegrityReport
+}
+
+func (f fakeIntegrityStore) VerifyIntegrity(ctx context.Context, repair bool) (storage.IntegrityReport, error) {
+	report := f.report
+	if repair {
+		report.Repaired = report.OrphanSettings + report.OrphanAnnotations
+	}
+	return report, nil
+}
+
+func TestVerifyStore(t *testing.T) {
+	ctx := context.Background()
+	settingsOnly := fakeIntegrityStore{storage.IntegrityReport{OrphanSettings: 3}}
+	withChanges := fakeIntegrityStore{storage.IntegrityReport{OrphanAnnotations: 1, OrphanChanges: map[string]int64{"gone": 2}}}
+
+	tests := []struct {
+		name    string
+		store   fakeIntegrityStore
+		repair  bool
+		wantErr string
+		wantOut []string
+	}{
+		{name: "consistent", store: fakeIntegrityStore{}, wantOut: []string{"orphan settings: 0"}},
+		{name: "orphan settings", store: settingsOnly, wantErr: "found 3 integrity problems", wantOut: []string{"orphan settings: 3"}},
+		{name: "repaired", store: settingsOnly, repair: true, wantOut: []string{"repaired: 3"}},
+		{
+			name: "orphan changes are not repaired", store: withChanges, repair: true,
+			wantErr: "found 2 integrity problems",
+			wantOut: []string{"orphan annotations: 1", "orphan changes: gone: 2", "repaired: 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := verifyStore(ctx, tt.store, tt.repair, &out)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("verifyStore failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Expected %q in the report, got %q", want, out.String())
+				}
+			}
+		})
+	}
+}
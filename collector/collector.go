@@ -2,53 +2,168 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"crdb-cluster-history/config"
 	"crdb-cluster-history/storage"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // versionRegex extracts the version number (e.g., "v25.4.2") from the full version string
 var versionRegex = regexp.MustCompile(`v\d+\.\d+\.\d+`)
 
+// ErrSuspiciousCollection is returned when a collection returns no settings, or
+// far fewer than expected, and is not saved. Saving it would record every missing
+// setting as removed, and every one as added again once collection recovers.
+var ErrSuspiciousCollection = errors.New("suspicious collection")
+
 // Store defines the storage operations needed by the collector.
 type Store interface {
-	SaveSnapshot(ctx context.Context, clusterID string, settings []storage.Setting, version string) error
+	SaveCollectedSnapshot(ctx context.Context, clusterID string, settings []storage.Setting, version, query string, pollInterval time.Duration, label string, raw json.RawMessage) ([]storage.Change, error)
 	CleanupOldSnapshots(ctx context.Context, clusterID string, retention time.Duration) (int64, error)
-	CleanupOldChanges(ctx context.Context, clusterID string, retention time.Duration) (int64, error)
+	CleanupOldChangesKeeping(ctx context.Context, clusterID string, retention time.Duration, keep storage.KeepChanges) (int64, error)
+	CompactReverts(ctx context.Context, clusterID string, window time.Duration) (storage.CompactionResult, error)
 	SetSourceClusterID(ctx context.Context, clusterID, sourceClusterID string) error
+	HistoryClusterID(ctx context.Context) (string, error)
 	SetDatabaseVersion(ctx context.Context, clusterID, version string) error
+	GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]storage.Setting, error)
+	RebaselineRequested(ctx context.Context, clusterID string) (bool, error)
+}
+
+// Notifier receives the changes detected by each collection.
+type Notifier interface {
+	Notify(ctx context.Context, clusterID string, changes []storage.Change)
+}
+
+// Notifiers fans changes out to several notifiers in order.
+type Notifiers []Notifier
+
+// Notify passes the changes to each notifier.
+func (ns Notifiers) Notify(ctx context.Context, clusterID string, changes []storage.Change) {
+	for _, n := range ns {
+		n.Notify(ctx, clusterID, changes)
+	}
 }
 
 type Collector struct {
 	pool                *pgxpool.Pool
+	readPool            *pgxpool.Pool // runs the collection query when set (nil uses pool)
 	store               Store
 	clusterID           string        // Config cluster ID (e.g., "prod", "staging")
 	interval            time.Duration
 	retention           time.Duration
+	keepChanges         storage.KeepChanges // each variable's most recent changes kept through retention cleanup
+	compactWindow       time.Duration       // reverts within this long are compacted (0 disables)
+	compactInterval     time.Duration       // how often revert compaction runs
+	lastCompaction      time.Time           // when revert compaction last ran
+	diff                storage.DiffOptions // how values are compared by dry runs, matching the store
+	query               string // recorded with each snapshot it produces
+	tenant              string // virtual cluster to collect from (empty for the cluster itself)
+	zoneConfigs         bool   // collect zone configurations instead of cluster settings
+	asOf                string // AS OF SYSTEM TIME expression for the collection query (empty for current values)
+	label               config.SnapshotLabel // where each snapshot's label is read from (zero for none)
+	schedule            config.CollectionSchedule // windows scheduled collections are limited to (zero for always)
+	notifier            Notifier
+	removalGrace        int                        // collections a setting must be absent before it is recorded as removed
+	lastSettings        map[string]storage.Setting // settings saved by the previous collection, for removalGrace
+	absentCount         map[string]int             // consecutive collections each previously seen setting has been missing
+	maxValueLength      int                        // values longer than this are stored truncated (0 keeps them whole)
+	rawOutput           bool                       // store each collection's complete query result with its snapshot
+	minSettings         int                        // collections with fewer settings are not saved
+	maxDropPercent      int                        // collections this much smaller than the last saved one are not saved (0 disables)
+	lastCount           int                        // number of settings saved by the previous collection, for maxDropPercent
+	seeded              bool                       // lastCount and lastSettings have been loaded from the latest stored snapshot
+	stateMu             sync.Mutex                 // guards lastSettings, absentCount, lastCount and seeded, which dry runs read during collections
+	anchor              string                     // setting every trustworthy collection includes once seen (empty disables)
+	paused              atomic.Bool // when set, scheduled collections are skipped
 	sourceClusterIDDone bool // true after first attempt (success or failure) to avoid retrying
+	monitorsHistory     atomic.Bool // set when the source cluster is the one holding the history database
+	selfMonitoringOK    bool        // monitoring the history database's cluster is intended
+	selfMonitoringSkip  []string    // variable globs dropped from collections while monitorsHistory is set
+	recentErrors        errorLog    // last errors of scheduled collections, for the errors endpoint
 }
 
 func New(ctx context.Context, clusterID, connString string, store Store, interval time.Duration) (*Collector, error) {
-	pool, err := pgxpool.New(ctx, connString)
+	pool, err := OpenPool(ctx, connString, PoolOptions{})
 	if err != nil {
 		return nil, err
 	}
-	// Verify the connection works
-	if err := pool.Ping(ctx); err != nil {
-		pool.Close()
-		return nil, err
-	}
+	return NewWithPool(clusterID, pool, store, interval), nil
+}
+
+// NewWithPool creates a collector reading from a pool opened with OpenPool. The
+// collector closes it on Close.
+func NewWithPool(clusterID string, pool *pgxpool.Pool, store Store, interval time.Duration) *Collector {
 	return &Collector{
 		pool:      pool,
 		store:     store,
 		clusterID: clusterID,
 		interval:  interval,
 		retention: 0, // No cleanup by default
-	}, nil
+		query:     storage.DefaultCollectionQuery,
+	}
+}
+
+// PoolOptions configures the connection pools opened to source clusters.
+type PoolOptions struct {
+	// TLSMinVersion is the lowest TLS version accepted (zero keeps Go's default).
+	TLSMinVersion uint16
+
+	// ApplicationName tags the connections in the source cluster's session and
+	// statement views, unless the connection string sets application_name.
+	// Empty sets none.
+	ApplicationName string
+
+	// IdleTimeout closes connections left unused this long, so a collector polling
+	// infrequently holds no connections between collections. Zero keeps pgx's
+	// default of 30 minutes.
+	IdleTimeout time.Duration
+}
+
+// OpenPool connects to a source cluster and verifies the connection works.
+func OpenPool(ctx context.Context, connString string, opts PoolOptions) (*pgxpool.Pool, error) {
+	poolConfig, err := newPoolConfig(connString, opts)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+func newPoolConfig(connString string, opts PoolOptions) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	storage.SetTLSMinVersion(&poolConfig.ConnConfig.Config, opts.TLSMinVersion)
+	storage.SetApplicationName(&poolConfig.ConnConfig.Config, opts.ApplicationName)
+	if opts.IdleTimeout > 0 {
+		poolConfig.MaxConnIdleTime = opts.IdleTimeout
+		poolConfig.MinConns = 0
+		// Idle connections are only closed by the health check, so run it at
+		// least as often as the timeout.
+		poolConfig.HealthCheckPeriod = min(poolConfig.HealthCheckPeriod, opts.IdleTimeout)
+	}
+	return poolConfig, nil
 }
 
 // ClusterID returns the cluster ID for this collector.
@@ -58,6 +173,94 @@ func (c *Collector) ClusterID() string {
 
 func (c *Collector) Close() {
 	c.pool.Close()
+	if c.readPool != nil {
+		c.readPool.Close()
+	}
+}
+
+// WithReadPool runs the collection query through pool instead of the primary
+// connection, e.g. to read from a follower. The collector closes it on Close.
+func (c *Collector) WithReadPool(pool *pgxpool.Pool) *Collector {
+	c.readPool = pool
+	return c
+}
+
+// WithAsOfSystemTime runs the collection query AS OF SYSTEM TIME expr (e.g.
+// "follower_read_timestamp()"), a historical read that any replica can serve
+// without contending with foreground traffic. An empty expr reads current values.
+func (c *Collector) WithAsOfSystemTime(expr string) *Collector {
+	c.asOf = expr
+	c.query = collectionQuery(c.show(), c.tenant, c.asOf)
+	return c
+}
+
+// WithTenant collects the settings of the named virtual cluster instead of the
+// cluster's own, which requires a connection to the system tenant.
+func (c *Collector) WithTenant(name string) *Collector {
+	c.tenant = name
+	c.query = collectionQuery(c.show(), c.tenant, c.asOf)
+	return c
+}
+
+// WithZoneConfigs collects the cluster's zone configurations instead of its
+// settings, each stored as a setting named by its target (e.g. "DATABASE app")
+// with its CONFIGURE ZONE statement as the value. Use a collector of its own,
+// under its own cluster ID, so zone configuration changes are detected apart
+// from cluster settings. Zone configurations are not per tenant, so this
+// replaces WithTenant.
+func (c *Collector) WithZoneConfigs(enabled bool) *Collector {
+	c.zoneConfigs = enabled
+	if enabled {
+		c.tenant = ""
+	}
+	c.query = collectionQuery(c.show(), c.tenant, c.asOf)
+	return c
+}
+
+// show returns the SHOW statement the collection query is built from.
+func (c *Collector) show() string {
+	if c.zoneConfigs {
+		return storage.ZoneConfigQuery
+	}
+	return storage.DefaultCollectionQuery
+}
+
+// collectionQuery returns the query that runs show, for tenant (empty for the
+// cluster itself) as of asOf. SHOW statements do not take AS OF SYSTEM TIME,
+// so the historical form selects from the SHOW output, keeping its columns and
+// their order. Tenant names are validated by config, so quoting is not needed.
+func collectionQuery(show, tenant, asOf string) string {
+	query := show
+	if tenant != "" {
+		query = fmt.Sprintf("%s FOR VIRTUAL CLUSTER ['%s']", query, tenant)
+	}
+	if asOf == "" {
+		return query
+	}
+	return fmt.Sprintf("SELECT * FROM [%s] AS OF SYSTEM TIME %s", query, asOf)
+}
+
+// collectionPool returns the pool the collection query runs on.
+func (c *Collector) collectionPool() *pgxpool.Pool {
+	if c.readPool != nil {
+		return c.readPool
+	}
+	return c.pool
+}
+
+// WithSnapshotLabel stamps each snapshot with a label read at collection time
+// from the source described by l, e.g. the release being deployed.
+func (c *Collector) WithSnapshotLabel(l config.SnapshotLabel) *Collector {
+	c.label = l
+	return c
+}
+
+// WithCollectionSchedule limits scheduled collections, and the cleanup that
+// follows them, to the schedule's windows. Collections triggered through
+// Collect are not limited.
+func (c *Collector) WithCollectionSchedule(schedule config.CollectionSchedule) *Collector {
+	c.schedule = schedule
+	return c
 }
 
 // WithRetention sets the data retention period. Data older than this will be cleaned up.
@@ -66,9 +269,130 @@ func (c *Collector) WithRetention(retention time.Duration) *Collector {
 	return c
 }
 
+// WithKeepChanges keeps each variable's most recent changes, as counted by keep,
+// when changes older than the retention period are cleaned up.
+func (c *Collector) WithKeepChanges(keep storage.KeepChanges) *Collector {
+	c.keepChanges = keep
+	return c
+}
+
+// WithRevertCompaction collapses runs of changes that return a setting to an
+// earlier value within window, at most once per interval. See
+// storage.Store.CompactReverts.
+func (c *Collector) WithRevertCompaction(window, interval time.Duration) *Collector {
+	c.compactWindow = window
+	c.compactInterval = interval
+	return c
+}
+
+// WithDiffOptions sets how dry runs compare values, which should match the
+// options the store detects changes with.
+func (c *Collector) WithDiffOptions(opts storage.DiffOptions) *Collector {
+	c.diff = opts
+	return c
+}
+
+// WithNotifier sets a notifier that is called with the changes detected by each collection.
+func (c *Collector) WithNotifier(n Notifier) *Collector {
+	c.notifier = n
+	return c
+}
+
+// WithRemovalGrace requires a setting to be missing from n consecutive collections
+// before it is recorded as removed. Until then the last known value is carried
+// forward, so a momentarily truncated SHOW CLUSTER SETTINGS result does not
+// produce removals followed by additions. Values of 1 or less disable the grace.
+func (c *Collector) WithRemovalGrace(n int) *Collector {
+	c.removalGrace = n
+	c.absentCount = make(map[string]int)
+	return c
+}
+
+// WithMaxValueLength stores setting values longer than n bytes truncated, with a
+// marker holding the full length and a digest of the full value so changes beyond
+// the cut are still detected. Values of 0 or less keep values whole.
+func (c *Collector) WithMaxValueLength(n int) *Collector {
+	c.maxValueLength = n
+	return c
+}
+
+// WithRawOutput stores the complete result of each collection query with its
+// snapshot, every column of every row as the cluster returned it, for
+// forensics. Values are stored before any truncation or exclusion.
+func (c *Collector) WithRawOutput(enabled bool) *Collector {
+	c.rawOutput = enabled
+	return c
+}
+
+// WithCountGuard refuses to save a collection with fewer than minSettings settings,
+// or one that shrank by dropPercent or more since the previous collection, so a
+// connection to the wrong database or with too few privileges is reported as an
+// error instead of recording every setting as removed. An empty collection is
+// always refused. A dropPercent of 0 disables the shrink check.
+func (c *Collector) WithCountGuard(minSettings, dropPercent int) *Collector {
+	c.minSettings = minSettings
+	c.maxDropPercent = dropPercent
+	return c
+}
+
+// WithAnchorSetting names a setting the cluster always reports, such as
+// "version". A collection missing it, when the last saved snapshot had it, is
+// refused as suspicious: a monitoring user that lost privileges can be shown a
+// filtered subset of the settings, which would otherwise be recorded as mass
+// removals. An empty name disables the check.
+func (c *Collector) WithAnchorSetting(variable string) *Collector {
+	c.anchor = variable
+	return c
+}
+
+// Pause stops scheduled collection and cleanup until Resume is called.
+// The connection pool is kept open so resuming is immediate.
+func (c *Collector) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume re-enables scheduled collection after Pause.
+func (c *Collector) Resume() {
+	c.paused.Store(false)
+}
+
+// MonitorsHistoryDatabase reports whether the source cluster was found to be the
+// cluster holding the history database, which is almost always a misconfigured
+// database_url. It is known after the first collection.
+func (c *Collector) MonitorsHistoryDatabase() bool {
+	return c.monitorsHistory.Load()
+}
+
+// WithSelfMonitoring sets how a source cluster found to hold the history
+// database is treated. If allowed, it is logged without a warning and
+// SelfMonitoringAllowed reports it as intended. Either way, variables matching
+// the exclude globs are left out of its collections, so settings churned by
+// writing the history don't show up as changes.
+func (c *Collector) WithSelfMonitoring(allowed bool, exclude []string) *Collector {
+	c.selfMonitoringOK = allowed
+	c.selfMonitoringSkip = exclude
+	return c
+}
+
+// SelfMonitoringAllowed reports whether monitoring the history database's own
+// cluster was configured as intended.
+func (c *Collector) SelfMonitoringAllowed() bool {
+	return c.selfMonitoringOK
+}
+
+// Paused reports whether scheduled collection is paused.
+func (c *Collector) Paused() bool {
+	return c.paused.Load()
+}
+
 func (c *Collector) Start(ctx context.Context) {
+	// A collection already running when ctx is cancelled finishes, so the
+	// changes it detects are saved and their notifications queued. The caller
+	// bounds how long shutdown waits for it.
+	work := context.WithoutCancel(ctx)
+
 	// Run immediately on start
-	c.collectAndCleanup(ctx)
+	c.collectAndCleanup(work)
 
 	ticker := time.NewTicker(c.interval)
 	defer ticker.Stop()
@@ -78,21 +402,47 @@ func (c *Collector) Start(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			c.collectAndCleanup(ctx)
+			c.collectAndCleanup(work)
 		}
 	}
 }
 
 func (c *Collector) collectAndCleanup(ctx context.Context) {
+	if c.Paused() {
+		slog.Info("Collection paused, skipping", "cluster", c.clusterID)
+		return
+	}
+	if !c.schedule.Allows(time.Now()) {
+		slog.Info("Outside collection schedule, skipping", "cluster", c.clusterID)
+		return
+	}
+
+	failed := false
 	if err := c.collect(ctx); err != nil {
 		slog.Error("Collection error", "cluster", c.clusterID, "error", err)
+		c.recordError(StageCollect, err)
+		failed = true
 	}
 
 	if c.retention > 0 {
 		if err := c.cleanup(ctx); err != nil {
 			slog.Error("Cleanup error", "cluster", c.clusterID, "error", err)
+			c.recordError(StageCleanup, err)
+			failed = true
 		}
 	}
+
+	if c.compactWindow > 0 && time.Since(c.lastCompaction) >= c.compactInterval {
+		if err := c.compactReverts(ctx); err != nil {
+			slog.Error("Revert compaction error", "cluster", c.clusterID, "error", err)
+			c.recordError(StageCompaction, err)
+			failed = true
+		}
+	}
+
+	if !failed {
+		c.recentErrors.resolve()
+	}
 }
 
 // Collect triggers an immediate collection. Useful for testing or manual triggers.
@@ -105,7 +455,7 @@ func (c *Collector) cleanup(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	changes, err := c.store.CleanupOldChanges(ctx, c.clusterID, c.retention)
+	changes, err := c.store.CleanupOldChangesKeeping(ctx, c.clusterID, c.retention, c.keepChanges)
 	if err != nil {
 		return err
 	}
@@ -115,6 +465,18 @@ func (c *Collector) cleanup(ctx context.Context) error {
 	return nil
 }
 
+func (c *Collector) compactReverts(ctx context.Context) error {
+	c.lastCompaction = time.Now()
+	result, err := c.store.CompactReverts(ctx, c.clusterID, c.compactWindow)
+	if err != nil {
+		return err
+	}
+	if result.Removed > 0 {
+		slog.Info("Revert compaction completed", "cluster", c.clusterID, "changes_removed", result.Removed, "sequences", result.Sequences)
+	}
+	return nil
+}
+
 func (c *Collector) collect(ctx context.Context) error {
 	slog.Info("Collecting cluster settings", "cluster", c.clusterID)
 
@@ -135,39 +497,437 @@ func (c *Collector) collect(ctx context.Context) error {
 
 	shortVersion := extractShortVersion(fullVersion)
 
-	rows, err := c.pool.Query(ctx, "SHOW CLUSTER SETTINGS")
+	settings, raw, err := c.fetchSettings(ctx)
 	if err != nil {
 		return err
 	}
+	if err := c.checkCollection(ctx, settings); err != nil {
+		return err
+	}
+	settings = c.applySelfMonitoringExclude(settings)
+	settings = c.applyMaxValueLength(settings)
+	settings, commitGrace := c.applyRemovalGrace(settings)
+
+	changes, err := c.store.SaveCollectedSnapshot(ctx, c.clusterID, settings, shortVersion, c.query, c.interval, c.snapshotLabel(ctx), raw)
+	if err != nil {
+		return err
+	}
+
+	c.stateMu.Lock()
+	commitGrace()
+	c.lastCount = len(settings)
+	c.stateMu.Unlock()
+	slog.Info("Collected settings", "cluster", c.clusterID, "count", len(settings), "changes", len(changes))
+
+	if c.notifier != nil && len(changes) > 0 {
+		c.notifier.Notify(ctx, c.clusterID, changes)
+	}
+	return nil
+}
+
+// maxLabelLength caps the length of a stored snapshot label, in bytes.
+const maxLabelLength = 256
+
+// snapshotLabel reads the label of the snapshot being collected. A label that
+// can't be read is logged and left empty rather than failing the collection.
+func (c *Collector) snapshotLabel(ctx context.Context) string {
+	var label string
+	switch {
+	case c.label.Env != "":
+		label = os.Getenv(c.label.Env)
+	case c.label.Query != "":
+		var err error
+		if label, err = c.queryLabel(ctx); err != nil {
+			slog.Warn("Failed to read snapshot label", "cluster", c.clusterID, "error", err)
+			return ""
+		}
+	}
+	label = strings.TrimSpace(label)
+	if len(label) > maxLabelLength {
+		label = strings.ToValidUTF8(label[:maxLabelLength], "")
+	}
+	return label
+}
+
+// queryLabel runs the label query in a read-only transaction and returns its
+// value, or "" if it returned no row or NULL.
+func (c *Collector) queryLabel(ctx context.Context) (string, error) {
+	if err := checkLabelQuery(c.label.Query); err != nil {
+		return "", err
+	}
+	tx, err := c.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var v any
+	err = tx.QueryRow(ctx, c.label.Query).Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && v == nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(v), nil
+}
+
+// fetchSettings runs the collection query. When raw output is kept, it also
+// returns every row of the result, all columns keyed by name, as JSON; raw is
+// nil otherwise.
+func (c *Collector) fetchSettings(ctx context.Context) (settings []storage.Setting, raw json.RawMessage, err error) {
+	rows, err := sourceDB{c.collectionPool()}.Query(ctx, c.query)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer rows.Close()
 
+	var rec *rawRecorder
+	if c.rawOutput {
+		rec = &rawRecorder{rows: []map[string]any{}}
+	}
+
+	switch {
+	case c.zoneConfigs:
+		settings, err = scanZoneConfigs(rows, rec)
+	case c.tenant != "":
+		settings, err = scanTenantSettings(rows, rec)
+	default:
+		for rows.Next() {
+			if err := rec.record(rows); err != nil {
+				return nil, nil, err
+			}
+			var s storage.Setting
+			var origin string
+			// SHOW CLUSTER SETTINGS returns: variable, value, setting_type, description, default_value, origin
+			if err := rows.Scan(&s.Variable, &s.Value, &s.SettingType, &s.Description, &s.DefaultValue, &origin); err != nil {
+				return nil, nil, err
+			}
+			settings = append(settings, s)
+		}
+		err = rows.Err()
+	}
+	if err != nil || rec == nil {
+		return settings, nil, err
+	}
+	raw, err = json.Marshal(rec.rows)
+	return settings, raw, err
+}
+
+// rawRecorder keeps the rows of a query result for WithRawOutput. A nil
+// recorder records nothing.
+type rawRecorder struct {
+	rows []map[string]any
+}
+
+// record adds the current row, its columns keyed by name.
+func (r *rawRecorder) record(rows pgx.Rows) error {
+	if r == nil {
+		return nil
+	}
+	values, err := rows.Values()
+	if err != nil {
+		return err
+	}
+	row := make(map[string]any, len(values))
+	for i, fd := range rows.FieldDescriptions() {
+		row[fd.Name] = values[i]
+	}
+	r.rows = append(r.rows, row)
+	return nil
+}
+
+// scanTenantSettings reads the output of SHOW CLUSTER SETTINGS FOR VIRTUAL
+// CLUSTER by column name, since it does not have the same columns as the
+// cluster's own SHOW CLUSTER SETTINGS across versions.
+func scanTenantSettings(rows pgx.Rows, rec *rawRecorder) ([]storage.Setting, error) {
 	var settings []storage.Setting
 	for rows.Next() {
+		if err := rec.record(rows); err != nil {
+			return nil, err
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
 		var s storage.Setting
-		var defaultValue, origin string
-		// SHOW CLUSTER SETTINGS returns: variable, value, setting_type, description, default_value, origin
-		if err := rows.Scan(&s.Variable, &s.Value, &s.SettingType, &s.Description, &defaultValue, &origin); err != nil {
-			return err
+		for i, fd := range rows.FieldDescriptions() {
+			v, _ := values[i].(string)
+			switch fd.Name {
+			case "variable":
+				s.Variable = v
+			case "value":
+				s.Value = v
+			case "setting_type", "type":
+				s.SettingType = v
+			case "description":
+				s.Description = v
+			case "default_value":
+				s.DefaultValue = v
+			}
 		}
 		settings = append(settings, s)
 	}
+	return settings, rows.Err()
+}
 
-	if err := rows.Err(); err != nil {
-		return err
+// scanZoneConfigs reads the output of SHOW ALL ZONE CONFIGURATIONS by column
+// name into settings of type storage.ZoneConfigType: the target as the
+// variable and the raw CONFIGURE ZONE statement, which spans several lines, as
+// the value.
+func scanZoneConfigs(rows pgx.Rows, rec *rawRecorder) ([]storage.Setting, error) {
+	var settings []storage.Setting
+	for rows.Next() {
+		if err := rec.record(rows); err != nil {
+			return nil, err
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		s := storage.Setting{SettingType: storage.ZoneConfigType}
+		for i, fd := range rows.FieldDescriptions() {
+			v, _ := values[i].(string)
+			switch fd.Name {
+			case "target":
+				s.Variable = v
+			case "raw_config_sql":
+				s.Value = v
+			}
+		}
+		settings = append(settings, s)
+	}
+	return settings, rows.Err()
+}
+
+// DryRunResult is what a collection would store, found without storing anything.
+type DryRunResult struct {
+	ClusterID     string           `json:"cluster_id"`
+	Version       string           `json:"version"`
+	SettingsCount int              `json:"settings_count"`
+	Baseline      bool             `json:"baseline"` // No snapshot is stored yet, so the collection would be the first
+	Changes       []storage.Change `json:"changes"`  // Changes the collection would record
+}
+
+// CollectDryRun runs the collection query and diffs the result against the latest
+// stored snapshot, returning what a collection would record without writing
+// anything, e.g. to check connectivity and privileges for a new cluster. The
+// count guard applies as it would to a real collection; the removal grace does
+// not, since it depends on consecutive collections.
+func (c *Collector) CollectDryRun(ctx context.Context) (*DryRunResult, error) {
+	fullVersion, err := c.fetchVersion(ctx)
+	if err != nil {
+		slog.Warn("Failed to fetch database version", "cluster", c.clusterID, "error", err)
+	}
+	version := extractShortVersion(fullVersion)
+
+	settings, _, err := c.fetchSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCollection(ctx, settings); err != nil {
+		return nil, err
+	}
+	settings = c.applySelfMonitoringExclude(settings)
+	settings = c.applyMaxValueLength(settings)
+
+	prev, err := c.store.GetLatestSnapshot(ctx, c.clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latest snapshot: %w", err)
 	}
+	changes := storage.DiffSettings(c.clusterID, prev, settings, version, c.diff)
+	if changes == nil {
+		changes = []storage.Change{}
+	}
+
+	slog.Info("Dry-run collection", "cluster", c.clusterID, "count", len(settings), "changes", len(changes))
+	return &DryRunResult{
+		ClusterID:     c.clusterID,
+		Version:       version,
+		SettingsCount: len(settings),
+		Baseline:      prev == nil,
+		Changes:       changes,
+	}, nil
+}
 
-	if err := c.store.SaveSnapshot(ctx, c.clusterID, settings, shortVersion); err != nil {
+// checkCollection returns ErrSuspiciousCollection when settings fail the count
+// guard or the anchor check. Collections and dry runs both call it, so a dry run
+// after a restart is refused exactly when the next collection would be.
+func (c *Collector) checkCollection(ctx context.Context, settings []storage.Setting) error {
+	if err := c.seedFromStore(ctx); err != nil {
+		return err
+	}
+	if err := c.checkCount(ctx, len(settings)); err != nil {
 		return err
 	}
+	return c.checkAnchor(ctx, settings)
+}
+
+// seedFromStore loads lastCount and lastSettings from the latest stored snapshot
+// on the first collection after a restart, so the shrink check and the removal
+// grace apply to it as well. The absence counts are not stored, so a setting
+// missing across a restart starts its grace over.
+func (c *Collector) seedFromStore(ctx context.Context) error {
+	if c.maxDropPercent <= 0 && c.removalGrace <= 1 {
+		return nil
+	}
+	c.stateMu.Lock()
+	seeded := c.seeded
+	c.stateMu.Unlock()
+	if seeded {
+		return nil
+	}
+	prev, err := c.store.GetLatestSnapshot(ctx, c.clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to read latest snapshot: %w", err)
+	}
+
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.seeded {
+		// A concurrent collection or dry run seeded first, and may have saved since
+		return nil
+	}
+	c.lastCount = len(prev)
+	if c.removalGrace > 1 {
+		c.lastSettings = prev
+	}
+	c.seeded = true
+	return nil
+}
+
+// checkCount returns ErrSuspiciousCollection when a collection of n settings is
+// empty, below minSettings, or has shrunk by maxDropPercent or more since the last
+// saved collection. A pending rebaseline accepts a shrink, so a legitimate one
+// can be recorded; the rebaseline is only read when the shrink would be refused.
+func (c *Collector) checkCount(ctx context.Context, n int) error {
+	c.stateMu.Lock()
+	lastCount := c.lastCount
+	c.stateMu.Unlock()
 
-	slog.Info("Collected settings", "cluster", c.clusterID, "count", len(settings))
+	switch {
+	case n == 0:
+		return fmt.Errorf("%w: cluster %s returned no settings", ErrSuspiciousCollection, c.clusterID)
+	case n < c.minSettings:
+		return fmt.Errorf("%w: cluster %s returned %d settings, fewer than the minimum of %d", ErrSuspiciousCollection, c.clusterID, n, c.minSettings)
+	case c.maxDropPercent > 0 && lastCount > 0 && (lastCount-n)*100 >= lastCount*c.maxDropPercent:
+		rebaseline, err := c.store.RebaselineRequested(ctx, c.clusterID)
+		if err != nil {
+			return fmt.Errorf("failed to read rebaseline request: %w", err)
+		}
+		if rebaseline {
+			slog.Warn("Settings count dropped, accepted for the requested rebaseline", "cluster", c.clusterID, "count", n, "previous", lastCount)
+			return nil
+		}
+		return fmt.Errorf("%w: cluster %s returned %d settings, down from %d (limit %d%% drop); request a rebaseline if the drop is expected", ErrSuspiciousCollection, c.clusterID, n, lastCount, c.maxDropPercent)
+	}
 	return nil
 }
 
+// checkAnchor returns ErrSuspiciousCollection when the anchor setting is missing
+// from settings but present in the last saved snapshot. The snapshot is only
+// read when the anchor is missing, so a cluster that never reports it is
+// collected as usual.
+func (c *Collector) checkAnchor(ctx context.Context, settings []storage.Setting) error {
+	if c.anchor == "" {
+		return nil
+	}
+	for _, s := range settings {
+		if s.Variable == c.anchor {
+			return nil
+		}
+	}
+	prev, err := c.store.GetLatestSnapshot(ctx, c.clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to read latest snapshot: %w", err)
+	}
+	if _, ok := prev[c.anchor]; !ok {
+		return nil
+	}
+	return fmt.Errorf("%w: cluster %s returned %d settings without %s, which the last snapshot had; the monitoring user may have lost privileges",
+		ErrSuspiciousCollection, c.clusterID, len(settings), c.anchor)
+}
+
+// applyRemovalGrace adds back settings from the previous collection that are
+// missing from this one but have not yet been absent for removalGrace
+// consecutive collections. The returned commit records this collection as the
+// previous one; call it with stateMu held, and only once the collection is
+// saved, so a failed save does not count towards the grace.
+func (c *Collector) applyRemovalGrace(settings []storage.Setting) ([]storage.Setting, func()) {
+	if c.removalGrace <= 1 {
+		return settings, func() {}
+	}
+
+	c.stateMu.Lock()
+	absentCount := make(map[string]int, len(c.absentCount))
+	for variable, n := range c.absentCount {
+		absentCount[variable] = n
+	}
+	lastSettings := c.lastSettings
+	c.stateMu.Unlock()
+
+	present := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		present[s.Variable] = true
+		delete(absentCount, s.Variable)
+	}
+
+	for variable, prev := range lastSettings {
+		if present[variable] {
+			continue
+		}
+		absentCount[variable]++
+		if absentCount[variable] < c.removalGrace {
+			slog.Warn("Setting missing from collection, deferring removal", "cluster", c.clusterID, "variable", variable, "absent", absentCount[variable], "grace", c.removalGrace)
+			settings = append(settings, prev)
+		} else {
+			delete(absentCount, variable)
+		}
+	}
+
+	saved := make(map[string]storage.Setting, len(settings))
+	for _, s := range settings {
+		saved[s.Variable] = s
+	}
+	return settings, func() {
+		c.lastSettings = saved
+		c.absentCount = absentCount
+	}
+}
+
+// applySelfMonitoringExclude drops the variables matching selfMonitoringSkip when
+// the source cluster holds the history database.
+func (c *Collector) applySelfMonitoringExclude(settings []storage.Setting) []storage.Setting {
+	if len(c.selfMonitoringSkip) == 0 || !c.monitorsHistory.Load() {
+		return settings
+	}
+	return slices.DeleteFunc(settings, func(s storage.Setting) bool {
+		return slices.ContainsFunc(c.selfMonitoringSkip, func(pattern string) bool {
+			return storage.MatchGlob(pattern, s.Variable)
+		})
+	})
+}
+
+// applyMaxValueLength truncates values longer than maxValueLength in place.
+func (c *Collector) applyMaxValueLength(settings []storage.Setting) []storage.Setting {
+	if c.maxValueLength <= 0 {
+		return settings
+	}
+	for i, s := range settings {
+		if len(s.Value) > c.maxValueLength {
+			slog.Debug("Truncating long setting value", "cluster", c.clusterID, "variable", s.Variable, "bytes", len(s.Value))
+			settings[i].Value = storage.TruncateValue(s.Value, c.maxValueLength)
+		}
+		// Truncated the same way, a long value still compares equal to its default
+		settings[i].DefaultValue = storage.TruncateValue(s.DefaultValue, c.maxValueLength)
+	}
+	return settings
+}
+
 // fetchVersion queries the database version string.
 func (c *Collector) fetchVersion(ctx context.Context) (string, error) {
 	var version string
-	err := c.pool.QueryRow(ctx, "SELECT version()").Scan(&version)
+	err := sourceDB{c.pool}.QueryRow(ctx, stmtVersion).Scan(&version)
 	return version, err
 }
 
@@ -186,15 +946,38 @@ func (c *Collector) updateSourceClusterID(ctx context.Context) error {
 	}
 	defer conn.Release()
 
-	// crdb_internal requires allow_unsafe_internals in newer CockroachDB versions
-	if _, err := conn.Exec(ctx, "SET allow_unsafe_internals = true"); err != nil {
+	db := sourceDB{conn}
+	if _, err := db.Exec(ctx, stmtAllowUnsafeInternals); err != nil {
 		return err
 	}
 
 	var sourceClusterID string
-	err = conn.QueryRow(ctx, "SELECT crdb_internal.cluster_id()::TEXT").Scan(&sourceClusterID)
+	err = db.QueryRow(ctx, stmtSourceClusterID).Scan(&sourceClusterID)
 	if err != nil {
 		return err
 	}
+	c.checkSelfMonitoring(ctx, sourceClusterID)
 	return c.store.SetSourceClusterID(ctx, c.clusterID, sourceClusterID)
 }
+
+// checkSelfMonitoring warns when the source cluster is the cluster holding the
+// history database, usually a database_url copied from history_database_url,
+// unless that was configured as intended. Collection continues either way.
+func (c *Collector) checkSelfMonitoring(ctx context.Context, sourceClusterID string) {
+	historyClusterID, err := c.store.HistoryClusterID(ctx)
+	if err != nil {
+		slog.Debug("Failed to read history cluster ID", "cluster", c.clusterID, "error", err)
+		return
+	}
+	if historyClusterID == "" || historyClusterID != sourceClusterID {
+		return
+	}
+	c.monitorsHistory.Store(true)
+	if c.selfMonitoringOK {
+		slog.Info("Source cluster holds the history database, as configured", "cluster", c.clusterID,
+			"source_cluster_id", sourceClusterID, "excluded_variables", c.selfMonitoringSkip)
+		return
+	}
+	slog.Warn("SOURCE CLUSTER IS THE HISTORY DATABASE: check this cluster's database_url; its history will mix in the collector's own cluster",
+		"cluster", c.clusterID, "source_cluster_id", sourceClusterID)
+}
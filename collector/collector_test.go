@@ -2,14 +2,21 @@ package collector
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"crdb-cluster-history/config"
 	"crdb-cluster-history/storage"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func uniqueClusterID(t *testing.T) string {
@@ -149,6 +156,353 @@ func TestCollect(t *testing.T) {
 	t.Logf("Collected %d settings", len(snapshot))
 }
 
+func TestCollectRecordsQuery(t *testing.T) {
+	ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+
+	if err := coll.collect(ctx); err != nil {
+		t.Fatalf("collect() failed: %v", err)
+	}
+
+	snapshots, err := store.ListSnapshots(ctx, clusterID, 1)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Expected 1 snapshot, got %+v, %v", snapshots, err)
+	}
+	if snapshots[0].Query != coll.query {
+		t.Errorf("Expected stored query %q, got %q", coll.query, snapshots[0].Query)
+	}
+	if got := time.Duration(snapshots[0].PollIntervalSeconds) * time.Second; got != coll.interval {
+		t.Errorf("Expected stored poll interval %v, got %v", coll.interval, got)
+	}
+}
+
+func TestSnapshotLabelFromEnv(t *testing.T) {
+	t.Setenv("TEST_RELEASE_TAG", "  release-2025.10  ")
+	t.Setenv("TEST_LONG_TAG", strings.Repeat("é", maxLabelLength))
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		label config.SnapshotLabel
+		want  string
+	}{
+		{"none", config.SnapshotLabel{}, ""},
+		{"trimmed", config.SnapshotLabel{Env: "TEST_RELEASE_TAG"}, "release-2025.10"},
+		{"unset variable", config.SnapshotLabel{Env: "TEST_UNSET_TAG"}, ""},
+		{"truncated on a character boundary", config.SnapshotLabel{Env: "TEST_LONG_TAG"}, strings.Repeat("é", maxLabelLength/2)},
+		{"refused query", config.SnapshotLabel{Query: "DELETE FROM releases"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := (&Collector{clusterID: "test"}).WithSnapshotLabel(tt.label)
+			if got := c.snapshotLabel(ctx); got != tt.want {
+				t.Errorf("snapshotLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectRecordsSnapshotLabel(t *testing.T) {
+	t.Setenv("TEST_RELEASE_TAG", "release-42")
+
+	for _, label := range []config.SnapshotLabel{
+		{Env: "TEST_RELEASE_TAG"},
+		{Query: "SELECT 'release-42'"},
+	} {
+		ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+		coll.WithSnapshotLabel(label)
+		if err := coll.collect(ctx); err != nil {
+			t.Fatalf("collect() failed: %v", err)
+		}
+
+		snapshots, err := store.ListSnapshots(ctx, clusterID, 1)
+		if err != nil || len(snapshots) != 1 {
+			t.Fatalf("Expected 1 snapshot, got %+v, %v", snapshots, err)
+		}
+		if snapshots[0].Label != "release-42" {
+			t.Errorf("Label from %+v = %q, want release-42", label, snapshots[0].Label)
+		}
+	}
+}
+
+func TestRemovalGrace(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	coll := (&Collector{clusterID: "prod", store: store}).WithRemovalGrace(2)
+
+	full := []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "2"}}
+	truncated := []storage.Setting{{Variable: "a", Value: "1"}}
+
+	// Each poll is the settings the cluster returned and the changes expected
+	polls := []struct {
+		settings []storage.Setting
+		want     []string
+	}{
+		{full, nil},
+		{truncated, nil}, // one-poll disappearance is suppressed
+		{full, nil},      // and coming back is not an addition
+		{truncated, nil},
+		{truncated, []string{"b removed"}}, // persistent disappearance is recorded
+		{truncated, nil},
+		{full, []string{"b added"}},
+	}
+	for i, p := range polls {
+		settings, commit := coll.applyRemovalGrace(p.settings)
+		changes, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0")
+		if err != nil {
+			t.Fatalf("poll %d: SaveSnapshotWithChanges failed: %v", i, err)
+		}
+		commit()
+
+		var got []string
+		for _, c := range changes {
+			switch {
+			case c.NewValue == "":
+				got = append(got, c.Variable+" removed")
+			case c.OldValue == "":
+				got = append(got, c.Variable+" added")
+			default:
+				got = append(got, c.Variable+" modified")
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(p.want) {
+			t.Errorf("poll %d: changes = %v, want %v", i, got, p.want)
+		}
+	}
+}
+
+func TestRemovalGraceDisabled(t *testing.T) {
+	coll := &Collector{clusterID: "prod"}
+	settings := []storage.Setting{{Variable: "a", Value: "1"}}
+
+	if got, _ := coll.applyRemovalGrace(settings); len(got) != 1 {
+		t.Errorf("Expected settings unchanged without a grace, got %+v", got)
+	}
+}
+
+func TestRemovalGraceCommitsOnlySavedCollections(t *testing.T) {
+	coll := (&Collector{clusterID: "prod"}).WithRemovalGrace(2)
+	full := []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "2"}}
+	truncated := []storage.Setting{{Variable: "a", Value: "1"}}
+
+	_, commit := coll.applyRemovalGrace(full)
+	commit()
+	// Collections whose save failed are not counted, however many there are
+	for range 3 {
+		coll.applyRemovalGrace(truncated)
+	}
+	if got, _ := coll.applyRemovalGrace(truncated); len(got) != 2 {
+		t.Errorf("Expected b carried forward after failed saves, got %+v", got)
+	}
+}
+
+func TestRemovalGraceSeededFromStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "2"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	// A restarted collector carries b forward as the previous one would have
+	coll := (&Collector{clusterID: "prod", store: store}).WithRemovalGrace(2)
+	if err := coll.seedFromStore(ctx); err != nil {
+		t.Fatalf("seedFromStore failed: %v", err)
+	}
+	got, _ := coll.applyRemovalGrace([]storage.Setting{{Variable: "a", Value: "1"}})
+	if len(got) != 2 {
+		t.Errorf("Expected b carried forward after a restart, got %+v", got)
+	}
+}
+
+func TestMaxValueLength(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	coll := (&Collector{clusterID: "prod", store: store}).WithMaxValueLength(32)
+
+	jumbo := func(suffix string) []storage.Setting {
+		return []storage.Setting{
+			{Variable: "small", Value: "1"},
+			{Variable: "jumbo", Value: strings.Repeat("x", 1000) + suffix},
+		}
+	}
+
+	polls := []struct {
+		settings []storage.Setting
+		want     int
+	}{
+		{jumbo("a"), 0},
+		{jumbo("a"), 0}, // an unchanged jumbo value is not a change
+		{jumbo("b"), 1}, // a change past the cut is still detected
+	}
+	for i, p := range polls {
+		changes, err := store.SaveSnapshotWithChanges(ctx, "prod", coll.applyMaxValueLength(p.settings), "v1.0")
+		if err != nil {
+			t.Fatalf("poll %d: SaveSnapshotWithChanges failed: %v", i, err)
+		}
+		if len(changes) != p.want {
+			t.Fatalf("poll %d: got %d changes, want %d: %+v", i, len(changes), p.want, changes)
+		}
+		for _, c := range changes {
+			if c.Variable != "jumbo" || len(c.NewValue) > 100 || !strings.Contains(c.NewValue, "truncated 1001 bytes") {
+				t.Errorf("poll %d: expected a truncated jumbo change, got %+v", i, c)
+			}
+		}
+	}
+
+	latest, err := store.GetLatestSnapshot(ctx, "prod")
+	if err != nil {
+		t.Fatalf("GetLatestSnapshot failed: %v", err)
+	}
+	if latest["small"].Value != "1" {
+		t.Errorf("Expected short values to be stored whole, got %q", latest["small"].Value)
+	}
+}
+
+func TestCountGuard(t *testing.T) {
+	tests := []struct {
+		name        string
+		minSettings int
+		dropPercent int
+		lastCount   int
+		count       int
+		wantErr     bool
+		rebaseline  bool
+	}{
+		{"empty is always refused", 0, 0, 0, 0, true, false},
+		{"empty after a full collection", 0, 0, 1000, 0, true, false},
+		{"first collection without a guard", 0, 0, 0, 1, false, false},
+		{"below minimum", 500, 0, 0, 499, true, false},
+		{"at minimum", 500, 0, 0, 500, false, false},
+		{"90% drop", 0, 50, 1000, 100, true, false},
+		{"drop at the limit", 0, 50, 1000, 500, true, false},
+		{"drop under the limit", 0, 50, 1000, 501, false, false},
+		{"90% drop without a drop guard", 0, 0, 1000, 100, false, false},
+		{"growth", 0, 50, 1000, 1200, false, false},
+		{"no previous collection skips the drop check", 0, 50, 0, 100, false, false},
+		{"90% drop with a pending rebaseline", 0, 50, 1000, 100, false, true},
+		{"empty with a pending rebaseline", 0, 50, 1000, 0, true, true},
+		{"below minimum with a pending rebaseline", 500, 50, 1000, 100, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := storage.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			if tt.rebaseline {
+				if err := store.RequestRebaseline(ctx, "prod"); err != nil {
+					t.Fatalf("RequestRebaseline failed: %v", err)
+				}
+			}
+			coll := (&Collector{clusterID: "prod", store: store}).WithCountGuard(tt.minSettings, tt.dropPercent)
+			coll.lastCount = tt.lastCount
+
+			err = coll.checkCount(ctx, tt.count)
+			if tt.wantErr {
+				if !errors.Is(err, ErrSuspiciousCollection) {
+					t.Errorf("checkCount(%d) = %v, want ErrSuspiciousCollection", tt.count, err)
+				}
+			} else if err != nil {
+				t.Errorf("checkCount(%d) unexpected error: %v", tt.count, err)
+			}
+		})
+	}
+}
+
+func TestCountGuardSeededFromStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	var settings []storage.Setting
+	for i := range 10 {
+		settings = append(settings, storage.Setting{Variable: fmt.Sprintf("s%d", i), Value: "1"})
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	// A restarted collector guards its first collection with the stored count
+	coll := (&Collector{clusterID: "prod", store: store}).WithCountGuard(0, 50)
+	if err := coll.seedFromStore(ctx); err != nil {
+		t.Fatalf("seedFromStore failed: %v", err)
+	}
+	if coll.lastCount != 10 {
+		t.Errorf("lastCount = %d, want the stored snapshot's 10", coll.lastCount)
+	}
+	if err := coll.checkCount(ctx, 2); !errors.Is(err, ErrSuspiciousCollection) {
+		t.Errorf("checkCount(2) = %v, want ErrSuspiciousCollection", err)
+	}
+
+	// Later collections keep the count they saved rather than reading it again
+	coll.lastCount = 4
+	if err := coll.seedFromStore(ctx); err != nil || coll.lastCount != 4 {
+		t.Errorf("second seedFromStore = %v with lastCount %d, want the in-memory 4", err, coll.lastCount)
+	}
+
+	// A dry run on a restarted collector is refused as its first collection would be
+	restarted := (&Collector{clusterID: "prod", store: store}).WithCountGuard(0, 50)
+	if err := restarted.checkCollection(ctx, settings[:2]); !errors.Is(err, ErrSuspiciousCollection) {
+		t.Errorf("checkCollection after a restart = %v, want ErrSuspiciousCollection", err)
+	}
+
+	// Without a drop guard, nothing is read
+	unguarded := &Collector{clusterID: "prod", store: store}
+	if err := unguarded.seedFromStore(ctx); err != nil || unguarded.lastCount != 0 {
+		t.Errorf("seedFromStore without a guard = %v with lastCount %d, want 0", err, unguarded.lastCount)
+	}
+}
+
+func TestAnchorSetting(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	full := []storage.Setting{{Variable: "version", Value: "25.4"}, {Variable: "a", Value: "1"}, {Variable: "b", Value: "2"}}
+	filtered := []storage.Setting{{Variable: "a", Value: "1"}}
+	coll := (&Collector{clusterID: "prod", store: store}).WithAnchorSetting("version")
+
+	// Before any snapshot there is nothing to compare against
+	if err := coll.checkAnchor(ctx, filtered); err != nil {
+		t.Errorf("Expected no error without a snapshot, got %v", err)
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "prod", full, "v25.4.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	if err := coll.checkAnchor(ctx, full); err != nil {
+		t.Errorf("Expected a collection with the anchor to pass, got %v", err)
+	}
+	err = coll.checkAnchor(ctx, filtered)
+	if !errors.Is(err, ErrSuspiciousCollection) || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("Expected ErrSuspiciousCollection naming the anchor, got %v", err)
+	}
+
+	// A cluster whose snapshots never had the anchor is collected as usual, as
+	// is any cluster with the check disabled
+	other := (&Collector{clusterID: "other", store: store}).WithAnchorSetting("version")
+	if _, err := store.SaveSnapshotWithChanges(ctx, "other", filtered, "v25.4.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	if err := other.checkAnchor(ctx, filtered); err != nil {
+		t.Errorf("Expected no error when the last snapshot lacked the anchor, got %v", err)
+	}
+	if err := (&Collector{clusterID: "prod", store: store}).checkAnchor(ctx, filtered); err != nil {
+		t.Errorf("Expected no error with the check disabled, got %v", err)
+	}
+}
+
 func TestStart(t *testing.T) {
 	ctx, store, coll, clusterID := setupCollectorTest(t, 5*time.Second, 1*time.Second)
 
@@ -205,6 +559,101 @@ func TestWithRetention(t *testing.T) {
 	}
 }
 
+type recordingNotifier struct {
+	calls int
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, clusterID string, changes []storage.Change) {
+	n.calls++
+}
+
+func TestWithNotifier(t *testing.T) {
+	ctx, _, coll, _ := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+
+	n := &recordingNotifier{}
+	if result := coll.WithNotifier(n); result != coll {
+		t.Error("WithNotifier should return the same collector for chaining")
+	}
+
+	// Two back-to-back collections normally see identical settings, so the
+	// notifier must not be invoked when no changes were detected.
+	for range 2 {
+		if err := coll.Collect(ctx); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+	}
+	if n.calls != 0 {
+		t.Errorf("Expected no notifications without changes, got %d", n.calls)
+	}
+}
+
+func TestNotifiersFanOut(t *testing.T) {
+	a, b := &recordingNotifier{}, &recordingNotifier{}
+	Notifiers{a, b}.Notify(context.Background(), "prod", []storage.Change{{Variable: "kv.rangefeed.enabled"}})
+
+	if a.calls != 1 || b.calls != 1 {
+		t.Errorf("Expected each notifier called once, got %d and %d", a.calls, b.calls)
+	}
+}
+
+func TestPausedCollectorSkipsCollection(t *testing.T) {
+	ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+
+	coll.Pause()
+	if !coll.Paused() {
+		t.Fatal("Expected collector to be paused")
+	}
+
+	coll.collectAndCleanup(ctx)
+
+	snapshots, err := store.ListSnapshots(ctx, clusterID, 10)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots while paused, got %d", len(snapshots))
+	}
+
+	coll.Resume()
+	coll.collectAndCleanup(ctx)
+
+	snapshots, err = store.ListSnapshots(ctx, clusterID, 10)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("Expected 1 snapshot after resume, got %d", len(snapshots))
+	}
+}
+
+func TestCollectionScheduleSkipsCollection(t *testing.T) {
+	ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+
+	// A window only on tomorrow excludes now
+	tomorrow := strings.ToLower(time.Now().UTC().Add(24 * time.Hour).Weekday().String()[:3])
+	coll.WithCollectionSchedule(config.CollectionSchedule{Windows: []string{tomorrow + " 00:00-24:00"}})
+	coll.collectAndCleanup(ctx)
+
+	snapshots, err := store.ListSnapshots(ctx, clusterID, 10)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots outside the schedule, got %d", len(snapshots))
+	}
+
+	coll.WithCollectionSchedule(config.CollectionSchedule{Windows: []string{"00:00-24:00"}})
+	coll.collectAndCleanup(ctx)
+
+	snapshots, err = store.ListSnapshots(ctx, clusterID, 10)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("Expected 1 snapshot inside the schedule, got %d", len(snapshots))
+	}
+}
+
 func TestCollectAndCleanup(t *testing.T) {
 	ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
 
@@ -274,3 +723,429 @@ func TestCleanupWithRetention(t *testing.T) {
 		t.Fatalf("cleanup() failed: %v", err)
 	}
 }
+
+// historyIDStore reports a fixed history cluster ID; other methods are not used.
+type historyIDStore struct {
+	Store
+	id string
+}
+
+func (s historyIDStore) HistoryClusterID(ctx context.Context) (string, error) {
+	return s.id, nil
+}
+
+func TestCheckSelfMonitoring(t *testing.T) {
+	tests := []struct {
+		name      string
+		historyID string
+		sourceID  string
+		want      bool
+	}{
+		{"same cluster on both connections", "2f3c9e1a", "2f3c9e1a", true},
+		{"different clusters", "2f3c9e1a", "7b0d44c2", false},
+		{"file storage has no cluster", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{clusterID: "prod", store: historyIDStore{id: tt.historyID}}
+			c.checkSelfMonitoring(context.Background(), tt.sourceID)
+			if got := c.MonitorsHistoryDatabase(); got != tt.want {
+				t.Errorf("MonitorsHistoryDatabase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelfMonitoringExclude(t *testing.T) {
+	collected := func() []storage.Setting {
+		return []storage.Setting{
+			{Variable: "kv.rangefeed.enabled", Value: "true"},
+			{Variable: "sql.stats.flush.interval", Value: "10m"},
+			{Variable: "sql.stats.automatic_collection.enabled", Value: "true"},
+		}
+	}
+	variables := func(settings []storage.Setting) []string {
+		var names []string
+		for _, s := range settings {
+			names = append(names, s.Variable)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		sourceID string // the history database is on cluster "2f3c9e1a"
+		allowed  bool
+		want     []string
+	}{
+		{"co-located", "2f3c9e1a", true, []string{"kv.rangefeed.enabled"}},
+		{"co-located, warned", "2f3c9e1a", false, []string{"kv.rangefeed.enabled"}},
+		{"separate clusters", "7b0d44c2", true, []string{"kv.rangefeed.enabled", "sql.stats.flush.interval", "sql.stats.automatic_collection.enabled"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := (&Collector{clusterID: "default", store: historyIDStore{id: "2f3c9e1a"}}).WithSelfMonitoring(tt.allowed, []string{"SQL.STATS.*"})
+			c.checkSelfMonitoring(context.Background(), tt.sourceID)
+
+			if got := variables(c.applySelfMonitoringExclude(collected())); !slices.Equal(got, tt.want) {
+				t.Errorf("Collected %v, want %v", got, tt.want)
+			}
+			if c.SelfMonitoringAllowed() != tt.allowed {
+				t.Errorf("SelfMonitoringAllowed() = %v, want %v", c.SelfMonitoringAllowed(), tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCollectionPool(t *testing.T) {
+	// pgxpool connects lazily, so these pools never touch the network.
+	primary, err := pgxpool.New(context.Background(), "postgresql://root@primary.invalid:26257/defaultdb")
+	if err != nil {
+		t.Fatalf("pgxpool.New failed: %v", err)
+	}
+	read, err := pgxpool.New(context.Background(), "postgresql://root@follower.invalid:26257/defaultdb")
+	if err != nil {
+		t.Fatalf("pgxpool.New failed: %v", err)
+	}
+
+	c := &Collector{clusterID: "prod", pool: primary, query: storage.DefaultCollectionQuery}
+	if c.collectionPool() != primary {
+		t.Error("Expected the primary pool without a read pool")
+	}
+	c.WithReadPool(read)
+	if c.collectionPool() != read {
+		t.Error("Expected the read pool to run the collection query")
+	}
+	c.Close()
+}
+
+func TestWithAsOfSystemTimeFollowerReads(t *testing.T) {
+	c := &Collector{query: storage.DefaultCollectionQuery}
+	c.WithAsOfSystemTime("follower_read_timestamp()")
+	if want := "SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME follower_read_timestamp()"; c.query != want {
+		t.Errorf("query = %q, want %q", c.query, want)
+	}
+}
+
+func TestCollectDryRun(t *testing.T) {
+	ctx, store, coll, clusterID := setupCollectorTest(t, 30*time.Second, 15*time.Minute)
+
+	result, err := coll.CollectDryRun(ctx)
+	if err != nil {
+		t.Fatalf("CollectDryRun failed: %v", err)
+	}
+	if !result.Baseline || len(result.Changes) != 0 || result.SettingsCount == 0 {
+		t.Errorf("Expected a baseline with settings and no changes, got %+v", result)
+	}
+	if snapshots, _ := store.ListSnapshots(ctx, clusterID, 10); len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshots after a dry run, got %d", len(snapshots))
+	}
+
+	// Store a doctored snapshot so the next collection has something to detect.
+	if err := coll.Collect(ctx); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	latest, err := store.GetLatestSnapshot(ctx, clusterID)
+	if err != nil {
+		t.Fatalf("GetLatestSnapshot failed: %v", err)
+	}
+	var doctored string
+	for variable := range latest {
+		if doctored == "" || variable < doctored {
+			doctored = variable
+		}
+	}
+	var settings []storage.Setting
+	for _, s := range latest {
+		if s.Variable == doctored {
+			s.Value = "dry-run-test"
+		}
+		settings = append(settings, s)
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, clusterID, settings, "v0.0.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	changesBefore, _ := store.GetChanges(ctx, clusterID, 1000)
+	snapshotsBefore, _ := store.ListSnapshots(ctx, clusterID, 1000)
+
+	result, err = coll.CollectDryRun(ctx)
+	if err != nil {
+		t.Fatalf("CollectDryRun failed: %v", err)
+	}
+	if result.Baseline || len(result.Changes) != 1 || result.Changes[0].Variable != doctored || result.Changes[0].OldValue != "dry-run-test" {
+		t.Errorf("Expected the doctored setting as the only change, got %+v", result.Changes)
+	}
+	if changes, _ := store.GetChanges(ctx, clusterID, 1000); len(changes) != len(changesBefore) {
+		t.Errorf("Expected no changes written by the dry run, had %d, now %d", len(changesBefore), len(changes))
+	}
+	if snapshots, _ := store.ListSnapshots(ctx, clusterID, 1000); len(snapshots) != len(snapshotsBefore) {
+		t.Errorf("Expected no snapshots written by the dry run, had %d, now %d", len(snapshotsBefore), len(snapshots))
+	}
+
+	// A real collection records what the dry run reported.
+	if err := coll.Collect(ctx); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	changes, _ := store.GetChanges(ctx, clusterID, 1000)
+	if len(changes) != len(changesBefore)+1 || changes[0].Variable != doctored {
+		t.Errorf("Expected the real collection to record the dry-run change, got %+v", changes)
+	}
+}
+
+func TestCollectDryRunDuringCollection(t *testing.T) {
+	ctx, _, coll, _ := setupCollectorTest(t, 60*time.Second, 15*time.Minute)
+	coll.WithCountGuard(0, 50).WithRemovalGrace(2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 3 {
+			if err := coll.Collect(ctx); err != nil {
+				t.Errorf("Collect failed: %v", err)
+			}
+		}
+	}()
+	for range 3 {
+		if _, err := coll.CollectDryRun(ctx); err != nil {
+			t.Errorf("CollectDryRun failed: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCollectionStateSharedWithDryRuns(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	settings := []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "2"}}
+	coll := (&Collector{clusterID: "prod", store: store}).WithCountGuard(0, 50).WithRemovalGrace(2)
+
+	// The state a collection commits is read by dry runs started meanwhile, as
+	// by the dry-run endpoint; run with -race to check it is guarded.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			if err := coll.checkCollection(ctx, settings); err != nil {
+				t.Errorf("collection checkCollection failed: %v", err)
+				return
+			}
+			saved, commit := coll.applyRemovalGrace(settings)
+			coll.stateMu.Lock()
+			commit()
+			coll.lastCount = len(saved)
+			coll.stateMu.Unlock()
+		}
+	}()
+	for range 50 {
+		if err := coll.checkCollection(ctx, settings); err != nil {
+			t.Errorf("dry-run checkCollection failed: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestNewPoolConfig(t *testing.T) {
+	const connString = "postgresql://root@localhost:26257/defaultdb?sslmode=require"
+
+	defaults, err := newPoolConfig(connString, PoolOptions{})
+	if err != nil {
+		t.Fatalf("newPoolConfig failed: %v", err)
+	}
+
+	cfg, err := newPoolConfig(connString, PoolOptions{TLSMinVersion: tls.VersionTLS13, IdleTimeout: 10 * time.Second, ApplicationName: "crdb-cluster-history/v1.2.3"})
+	if err != nil {
+		t.Fatalf("newPoolConfig failed: %v", err)
+	}
+	if cfg.MaxConnIdleTime != 10*time.Second || cfg.MinConns != 0 {
+		t.Errorf("MaxConnIdleTime, MinConns = %v, %d; want 10s, 0", cfg.MaxConnIdleTime, cfg.MinConns)
+	}
+	if cfg.HealthCheckPeriod != 10*time.Second {
+		t.Errorf("HealthCheckPeriod = %v, want the idle timeout", cfg.HealthCheckPeriod)
+	}
+	if cfg.ConnConfig.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("TLS MinVersion = %x, want TLS 1.3", cfg.ConnConfig.TLSConfig.MinVersion)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["application_name"]; got != "crdb-cluster-history/v1.2.3" {
+		t.Errorf("application_name = %q, want crdb-cluster-history/v1.2.3", got)
+	}
+	if _, ok := defaults.ConnConfig.RuntimeParams["application_name"]; ok {
+		t.Error("Expected no application_name without one configured")
+	}
+
+	// An idle timeout longer than the health check period leaves the period alone
+	cfg, err = newPoolConfig(connString, PoolOptions{IdleTimeout: time.Hour})
+	if err != nil {
+		t.Fatalf("newPoolConfig failed: %v", err)
+	}
+	if cfg.HealthCheckPeriod != defaults.HealthCheckPeriod || cfg.MaxConnIdleTime != time.Hour {
+		t.Errorf("HealthCheckPeriod, MaxConnIdleTime = %v, %v; want %v, 1h", cfg.HealthCheckPeriod, cfg.MaxConnIdleTime, defaults.HealthCheckPeriod)
+	}
+}
+
+func TestIdleConnectionsClosedBetweenCollections(t *testing.T) {
+	sourceURL, historyURL := getTestURLs(t)
+	clusterID := uniqueClusterID(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	pool, err := OpenPool(ctx, sourceURL, PoolOptions{IdleTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("OpenPool failed: %v", err)
+	}
+	coll := NewWithPool(clusterID, pool, store, time.Hour)
+	defer coll.Close()
+
+	for i := range 2 {
+		if err := coll.collect(ctx); err != nil {
+			t.Fatalf("collect() %d failed: %v", i, err)
+		}
+		if pool.Stat().TotalConns() == 0 {
+			t.Fatalf("Expected an open connection right after collection %d", i)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.Stat().TotalConns() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Idle connections not closed after collection %d: %d open", i, pool.Stat().TotalConns())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func TestWithZoneConfigs(t *testing.T) {
+	c := (&Collector{query: storage.DefaultCollectionQuery}).WithTenant("app").WithZoneConfigs(true)
+	if c.query != storage.ZoneConfigQuery {
+		t.Errorf("query = %q, want %q", c.query, storage.ZoneConfigQuery)
+	}
+	c.WithAsOfSystemTime("follower_read_timestamp()")
+	if want := "SELECT * FROM [SHOW ALL ZONE CONFIGURATIONS] AS OF SYSTEM TIME follower_read_timestamp()"; c.query != want {
+		t.Errorf("query = %q, want %q", c.query, want)
+	}
+}
+
+func TestZoneConfigChangesDetectedSeparately(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	zonesID := config.ZoneConfigClusterID("prod")
+	coll := (&Collector{clusterID: zonesID, store: store}).WithZoneConfigs(true).WithMaxValueLength(64)
+
+	settings := []storage.Setting{{Variable: "kv.rangefeed.enabled", Value: "true", SettingType: "b"}}
+	zones := func(ttl int) []storage.Setting {
+		return []storage.Setting{
+			{Variable: "RANGE default", Value: "ALTER RANGE default CONFIGURE ZONE USING\n\trange_min_bytes = 134217728,\n\tnum_replicas = 3", SettingType: storage.ZoneConfigType},
+			{Variable: "DATABASE app", Value: fmt.Sprintf("ALTER DATABASE app CONFIGURE ZONE USING\n\tnum_replicas = 5,\n\tconstraints = '[+region=us-east1]',\n\tgc.ttlseconds = %d", ttl), SettingType: storage.ZoneConfigType},
+		}
+	}
+
+	for i, ttl := range []int{14400, 14400, 600} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+			t.Fatalf("poll %d: saving settings failed: %v", i, err)
+		}
+		if _, err := store.SaveSnapshotWithChanges(ctx, zonesID, coll.applyMaxValueLength(zones(ttl)), "v1.0"); err != nil {
+			t.Fatalf("poll %d: saving zone configs failed: %v", i, err)
+		}
+	}
+
+	changes, err := store.GetChanges(ctx, zonesID, 10)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	// The gc.ttlseconds edit is past the 64-byte cut, so it is detected through
+	// the digest of the truncated value.
+	if len(changes) != 1 || changes[0].Variable != "DATABASE app" || !strings.Contains(changes[0].NewValue, "truncated") {
+		t.Errorf("Expected one truncated change to DATABASE app, got %+v", changes)
+	}
+	if changes, _ := store.GetChanges(ctx, "prod", 10); len(changes) != 0 {
+		t.Errorf("Expected no cluster setting changes, got %+v", changes)
+	}
+}
+
+func TestCollectZoneConfigs(t *testing.T) {
+	sourceURL, historyURL := getTestURLs(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	pool, err := OpenPool(ctx, sourceURL, PoolOptions{})
+	if err != nil {
+		t.Fatalf("OpenPool failed: %v", err)
+	}
+	defer pool.Close()
+	database := fmt.Sprintf("zone_test_%d", time.Now().UnixNano())
+	if _, err := pool.Exec(ctx, "CREATE DATABASE "+database); err != nil {
+		t.Fatalf("CREATE DATABASE failed: %v", err)
+	}
+	t.Cleanup(func() { pool.Exec(context.Background(), "DROP DATABASE "+database) })
+	configure := func(ttl int) {
+		t.Helper()
+		if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s CONFIGURE ZONE USING gc.ttlseconds = %d", database, ttl)); err != nil {
+			t.Fatalf("CONFIGURE ZONE failed: %v", err)
+		}
+	}
+
+	clusterID := uniqueClusterID(t)
+	zonesID := config.ZoneConfigClusterID(clusterID)
+	settingsColl, err := New(ctx, clusterID, sourceURL, store, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer settingsColl.Close()
+	zonesColl, err := New(ctx, zonesID, sourceURL, store, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer zonesColl.Close()
+	zonesColl.WithZoneConfigs(true)
+
+	configure(3600)
+	for _, c := range []*Collector{settingsColl, zonesColl} {
+		if err := c.collect(ctx); err != nil {
+			t.Fatalf("collect() %s failed: %v", c.ClusterID(), err)
+		}
+	}
+	configure(7200)
+	for _, c := range []*Collector{settingsColl, zonesColl} {
+		if err := c.collect(ctx); err != nil {
+			t.Fatalf("collect() %s failed: %v", c.ClusterID(), err)
+		}
+	}
+
+	target := "DATABASE " + database
+	changes, err := store.GetChanges(ctx, zonesID, 100)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Variable != target || !strings.Contains(changes[0].NewValue, "gc.ttlseconds = 7200") {
+		t.Errorf("Expected one change to %s, got %+v", target, changes)
+	}
+	settingChanges, err := store.GetChanges(ctx, clusterID, 100)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	for _, c := range settingChanges {
+		if c.Variable == target {
+			t.Errorf("Zone configuration change recorded with the cluster settings: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxRecentErrors is how many errors each collector remembers.
+const MaxRecentErrors = 50
+
+// Stages of scheduled collection an error can come from.
+const (
+	StageCollect    = "collect"
+	StageCleanup    = "cleanup"
+	StageCompaction = "compaction"
+)
+
+// CollectionError is a failure of a scheduled collection or its housekeeping.
+type CollectionError struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Message string    `json:"message"`
+}
+
+// errorLog is a ring buffer of a collector's last MaxRecentErrors errors. The
+// zero value is empty and ready to use.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []CollectionError // ring storage, at most MaxRecentErrors long
+	next    int               // index the next entry is written to once full
+	failing bool              // the newest entry is from the latest scheduled run
+}
+
+// add records an error.
+func (l *errorLog) add(e CollectionError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failing = true
+	if len(l.entries) < MaxRecentErrors {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % MaxRecentErrors
+}
+
+// recent returns up to limit errors, newest first. A limit of 0 or less
+// returns them all.
+func (l *errorLog) recent(limit int) []CollectionError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := len(l.entries)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	result := make([]CollectionError, 0, limit)
+	for i := 0; i < limit; i++ {
+		// The newest entry is just before next, wrapping around
+		result = append(result, l.entries[(l.next-1-i+2*n)%n])
+	}
+	return result
+}
+
+// resolve marks the latest scheduled run as successful, so last no longer
+// reports the errors of earlier runs.
+func (l *errorLog) resolve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failing = false
+}
+
+// last returns the newest error if the latest scheduled run failed, or nil.
+func (l *errorLog) last() *CollectionError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.failing || len(l.entries) == 0 {
+		return nil
+	}
+	e := l.entries[(l.next-1+len(l.entries))%len(l.entries)]
+	return &e
+}
+
+// recordError remembers an error from a stage of scheduled collection.
+func (c *Collector) recordError(stage string, err error) {
+	c.recentErrors.add(CollectionError{Time: time.Now(), Stage: stage, Message: err.Error()})
+}
+
+// RecentErrors returns up to limit of the collector's most recent scheduled
+// collection errors, newest first. A limit of 0 or less returns all that are
+// kept, at most MaxRecentErrors.
+func (c *Collector) RecentErrors(limit int) []CollectionError {
+	return c.recentErrors.recent(limit)
+}
+
+// LastError returns the newest error of the collector's latest scheduled
+// collection, or of the cleanup and compaction that follow it, or nil if that
+// run succeeded.
+func (c *Collector) LastError() *CollectionError {
+	return c.recentErrors.last()
+}
+
+// RecentErrors returns a cluster's most recent collection errors, newest first.
+func (m *Manager) RecentErrors(clusterID string, limit int) ([]CollectionError, error) {
+	c, ok := m.GetCollector(clusterID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, clusterID)
+	}
+	return c.RecentErrors(limit), nil
+}
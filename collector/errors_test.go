@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestErrorLogKeepsNewest(t *testing.T) {
+	var l errorLog
+	if got := l.recent(0); len(got) != 0 {
+		t.Errorf("Expected an empty log, got %+v", got)
+	}
+
+	for i := range MaxRecentErrors + 5 {
+		l.add(CollectionError{Stage: StageCollect, Message: fmt.Sprint(i)})
+	}
+	all := l.recent(0)
+	if len(all) != MaxRecentErrors {
+		t.Fatalf("Expected %d errors kept, got %d", MaxRecentErrors, len(all))
+	}
+	if all[0].Message != fmt.Sprint(MaxRecentErrors+4) || all[len(all)-1].Message != "5" {
+		t.Errorf("Expected newest first down to the oldest kept, got %s ... %s", all[0].Message, all[len(all)-1].Message)
+	}
+	if got := l.recent(2); len(got) != 2 || got[1].Message != fmt.Sprint(MaxRecentErrors+3) {
+		t.Errorf("Expected the 2 newest errors, got %+v", got)
+	}
+}
+
+func TestErrorLogLast(t *testing.T) {
+	var l errorLog
+	if got := l.last(); got != nil {
+		t.Errorf("Expected no last error for an empty log, got %+v", got)
+	}
+	for i := range MaxRecentErrors + 2 {
+		l.add(CollectionError{Stage: StageCleanup, Message: fmt.Sprint(i)})
+	}
+	if got := l.last(); got == nil || got.Message != fmt.Sprint(MaxRecentErrors+1) {
+		t.Errorf("Expected the newest error, got %+v", got)
+	}
+	l.resolve()
+	if got := l.last(); got != nil {
+		t.Errorf("Expected no last error after a successful run, got %+v", got)
+	}
+	if got := l.recent(0); len(got) != MaxRecentErrors {
+		t.Errorf("Expected resolve to keep the recent errors, got %d", len(got))
+	}
+}
+
+func TestCollectionErrorsRecorded(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	// Nothing listens on port 1, so every collection fails to connect
+	pool, err := pgxpool.New(context.Background(), "postgres://root@127.0.0.1:1/defaultdb?sslmode=disable&connect_timeout=2")
+	if err != nil {
+		t.Fatalf("pgxpool.New failed: %v", err)
+	}
+	c := NewWithPool("prod", pool, store, time.Hour)
+	t.Cleanup(c.Close)
+	m := &Manager{collectors: map[string]*Collector{"prod": c}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	before := time.Now()
+	c.collectAndCleanup(ctx)
+	c.collectAndCleanup(ctx)
+
+	recent, err := m.RecentErrors("prod", 1)
+	if err != nil {
+		t.Fatalf("RecentErrors failed: %v", err)
+	}
+	if len(recent) != 1 || recent[0].Stage != StageCollect || recent[0].Message == "" || recent[0].Time.Before(before) {
+		t.Errorf("Expected the failed collection's error, got %+v", recent)
+	}
+	if all, _ := m.RecentErrors("prod", 0); len(all) != 2 {
+		t.Errorf("Expected both failed collections recorded, got %+v", all)
+	}
+	if st := m.Status(); len(st) != 1 || !strings.HasPrefix(st[0].LastError, StageCollect+": ") {
+		t.Errorf("Expected the failed collection as the status's last error, got %+v", st)
+	}
+	if _, err := m.RecentErrors("unknown", 0); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("RecentErrors(unknown) error = %v, want ErrUnknownCluster", err)
+	}
+}
@@ -5,33 +5,107 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
 )
 
+// ErrUnknownCluster is returned when a cluster ID has no collector.
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// ErrTooManyClusters is returned by NewManager when more history clusters are
+// configured than max_clusters allows.
+var ErrTooManyClusters = errors.New("too many clusters")
+
+// Status describes the state of a single collector.
+type Status struct {
+	ClusterID string `json:"cluster_id"`
+	Paused    bool   `json:"paused"`
+
+	// MonitorsHistoryDatabase is set when the source cluster is the cluster
+	// holding the history database, which is usually a misconfiguration.
+	// SelfMonitoringAllowed is set when it was configured as intended.
+	MonitorsHistoryDatabase bool `json:"monitors_history_database,omitempty"`
+	SelfMonitoringAllowed   bool `json:"self_monitoring_allowed,omitempty"`
+
+	// StartupError is set for a cluster skipped at startup because its collector
+	// could not be created, which is retried until it can be, or because it was
+	// past max_clusters, which is not.
+	StartupError string `json:"startup_error,omitempty"`
+
+	// LastError is the newest error of the collector's latest scheduled
+	// collection or its housekeeping, as "<stage>: <message>". It is cleared by
+	// the next run that succeeds.
+	LastError string `json:"last_error,omitempty"`
+}
+
 type Manager struct {
 	collectors map[string]*Collector
+	failed     map[string]*failedCluster // clusters skipped at startup, with SkipFailedClusters
+	overLimit  []string                  // clusters past MaxClusters, never collected
 	mu         sync.RWMutex
+
+	// What retried clusters are created with
+	cfg           *config.Config
+	poolOpts      PoolOptions
+	store         Store
+	clusterStores map[string]Store
+	notifier      Notifier
+}
+
+// failedCluster is a cluster whose collector could not be created.
+type failedCluster struct {
+	cluster config.ClusterConfig
+	err     error
 }
 
+// retryConnectTimeout bounds each attempt to create a skipped cluster's collector.
+const retryConnectTimeout = 30 * time.Second
+
+// NewManager creates a collector for every cluster in cfg. If one cannot be
+// created, e.g. because its cluster is unreachable, NewManager fails, unless
+// cfg.SkipFailedClusters is set: the cluster is then skipped, reported by
+// Status, and retried by Start every cfg.FailedClusterRetry. More clusters than
+// cfg.MaxClusters fail with ErrTooManyClusters before any is connected to, or
+// with SkipFailedClusters the clusters past the cap are reported by Status and
+// never collected.
 func NewManager(ctx context.Context, cfg *config.Config, store Store) (*Manager, error) {
 	m := &Manager{
 		collectors: make(map[string]*Collector),
+		failed:     make(map[string]*failedCluster),
+		cfg:        cfg,
+		poolOpts:   PoolOptions{TLSMinVersion: cfg.TLSMinVersion(), IdleTimeout: cfg.SourceIdleTimeout.Duration(), ApplicationName: cfg.ApplicationName},
+		store:      store,
 	}
 
-	retention := cfg.Retention.Duration()
-	for _, cluster := range cfg.Clusters {
-		collector, err := New(ctx, cluster.ID, cluster.DatabaseURL, store, cfg.PollInterval.Duration())
-		if err != nil {
-			m.Close()
-			return nil, fmt.Errorf("failed to create collector for cluster %s: %w", cluster.ID, err)
+	clusters := cfg.HistoryClusters()
+	if cfg.MaxClusters > 0 && len(clusters) > cfg.MaxClusters {
+		if !cfg.SkipFailedClusters {
+			return nil, fmt.Errorf("%w: %d configured, counting tenants and zone configurations, but max_clusters is %d",
+				ErrTooManyClusters, len(clusters), cfg.MaxClusters)
 		}
-
-		if retention > 0 {
-			collector.WithRetention(retention)
+		for _, cluster := range clusters[cfg.MaxClusters:] {
+			m.overLimit = append(m.overLimit, cluster.ID)
 		}
+		slog.Warn("More clusters configured than max_clusters, skipping the rest", "max_clusters", cfg.MaxClusters, "skipped", m.overLimit)
+		clusters = clusters[:cfg.MaxClusters]
+	}
 
+	for _, cluster := range clusters {
+		collector, err := m.newCollector(ctx, cluster, store)
+		if err != nil {
+			if !cfg.SkipFailedClusters {
+				m.Close()
+				return nil, err
+			}
+			slog.Error("Skipping cluster", "cluster", cluster.ID, "error", err, "retry", cfg.FailedClusterRetry.Duration())
+			m.failed[cluster.ID] = &failedCluster{cluster: cluster, err: err}
+			continue
+		}
 		m.collectors[cluster.ID] = collector
 		slog.Info("Created collector", "cluster", cluster.ID, "name", cluster.Name)
 	}
@@ -39,22 +113,196 @@ func NewManager(ctx context.Context, cfg *config.Config, store Store) (*Manager,
 	return m, nil
 }
 
+// newCollector connects to a cluster and creates its collector as configured.
+func (m *Manager) newCollector(ctx context.Context, cluster config.ClusterConfig, store Store) (*Collector, error) {
+	cfg := m.cfg
+	pool, err := OpenPool(ctx, cluster.DatabaseURL, m.poolOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collector for cluster %s: %w", cluster.ID, err)
+	}
+	collector := NewWithPool(cluster.ID, pool, store, cfg.PollInterval.Duration())
+
+	if retention := cfg.Retention.Duration(); retention > 0 {
+		collector.WithRetention(retention)
+		collector.WithKeepChanges(storage.KeepChanges{PerVariable: cfg.KeepChangesPerVariable, Variables: cfg.KeepChangesFor})
+	}
+	if cfg.CompactRevertsWindow > 0 {
+		collector.WithRevertCompaction(cfg.CompactRevertsWindow.Duration(), cfg.CompactRevertsInterval.Duration())
+	}
+	if cfg.RemovalGrace > 1 {
+		collector.WithRemovalGrace(cfg.RemovalGrace)
+	}
+	if cfg.MaxValueLength > 0 {
+		collector.WithMaxValueLength(cfg.MaxValueLength)
+	}
+	collector.WithRawOutput(cfg.StoreRawOutput)
+	if cluster.ZoneConfigsOf != "" {
+		// min_settings, max_settings_drop, and anchor_setting describe
+		// cluster settings, not the handful of zone configurations a cluster
+		// has, where dropping one or two is a large share and legitimate.
+		collector.WithCountGuard(0, 0)
+	} else {
+		collector.WithCountGuard(cfg.MinSettings, cfg.MaxSettingsDrop)
+		if cfg.AnchorSetting != config.AnchorSettingNone {
+			collector.WithAnchorSetting(cfg.AnchorSetting)
+		}
+	}
+	collector.WithDiffOptions(storage.DiffOptions{CaseInsensitive: cfg.CaseInsensitiveValues})
+	collector.WithTenant(cluster.Tenant)
+	collector.WithZoneConfigs(cluster.ZoneConfigsOf != "")
+	collector.WithAsOfSystemTime(asOfSystemTime(cluster))
+	collector.WithSnapshotLabel(cfg.ClusterSnapshotLabel(cluster))
+	collector.WithCollectionSchedule(cfg.ClusterCollectionSchedule(cluster))
+	collector.WithSelfMonitoring(cfg.SelfMonitoring == config.SelfMonitoringAllow, cfg.SelfMonitoringExclude)
+	if cluster.ReadDatabaseURL != "" {
+		readPool, err := OpenPool(ctx, cluster.ReadDatabaseURL, m.poolOpts)
+		if err != nil {
+			collector.Close()
+			return nil, fmt.Errorf("failed to connect to read database for cluster %s: %w", cluster.ID, err)
+		}
+		collector.WithReadPool(readPool)
+	}
+	return collector, nil
+}
+
+// asOfSystemTime returns the AS OF SYSTEM TIME expression a cluster's collection
+// query runs with, or "" to read current values.
+func asOfSystemTime(cluster config.ClusterConfig) string {
+	switch {
+	case cluster.FollowerReads:
+		return "follower_read_timestamp()"
+	case cluster.AsOfSystemTime != 0:
+		return "'" + strconv.FormatFloat(cluster.AsOfSystemTime.Duration().Seconds(), 'f', -1, 64) + "s'"
+	}
+	return ""
+}
+
+// WithNotifier sets the notifier on every managed collector.
+func (m *Manager) WithNotifier(n Notifier) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notifier = n
+	for _, c := range m.collectors {
+		c.WithNotifier(n)
+	}
+	return m
+}
+
+// Start runs every collector until ctx is cancelled, retrying clusters skipped
+// at startup until their collectors can be created.
 func (m *Manager) Start(ctx context.Context) {
 	m.mu.RLock()
 	var wg sync.WaitGroup
 
 	for clusterID, collector := range m.collectors {
+		startCollector(ctx, &wg, clusterID, collector)
+	}
+	retry := len(m.failed) > 0
+	m.mu.RUnlock()
+
+	if retry {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			slog.Info("Starting collector", "cluster", clusterID)
-			collector.Start(ctx)
-			slog.Info("Stopped collector", "cluster", clusterID)
+			m.retryFailed(ctx, &wg)
 		}()
 	}
+	wg.Wait()
+}
+
+// startCollector runs a collector in its own goroutine, tracked by wg.
+func startCollector(ctx context.Context, wg *sync.WaitGroup, clusterID string, collector *Collector) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slog.Info("Starting collector", "cluster", clusterID)
+		collector.Start(ctx)
+		slog.Info("Stopped collector", "cluster", clusterID)
+	}()
+}
+
+// retryFailed retries the clusters skipped at startup every FailedClusterRetry,
+// starting each collector that can now be created, until none are left or ctx
+// is cancelled.
+func (m *Manager) retryFailed(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(m.cfg.FailedClusterRetry.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m.retryFailedOnce(ctx, wg) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// retryFailedOnce tries once to create the collector of each skipped cluster,
+// returning how many are still skipped.
+func (m *Manager) retryFailedOnce(ctx context.Context, wg *sync.WaitGroup) int {
+	m.mu.RLock()
+	var pending []config.ClusterConfig
+	for _, f := range m.failed {
+		pending = append(pending, f.cluster)
+	}
 	m.mu.RUnlock()
 
-	wg.Wait()
+	for _, cluster := range pending {
+		attemptCtx, cancel := context.WithTimeout(ctx, retryConnectTimeout)
+		collector, err := m.newCollector(attemptCtx, cluster, m.storeFor(cluster.ID))
+		cancel()
+
+		m.mu.Lock()
+		if err != nil {
+			m.failed[cluster.ID].err = err
+			m.mu.Unlock()
+			slog.Warn("Skipped cluster still failing", "cluster", cluster.ID, "error", err)
+			continue
+		}
+		if m.notifier != nil {
+			collector.WithNotifier(m.notifier)
+		}
+		delete(m.failed, cluster.ID)
+		m.collectors[cluster.ID] = collector
+		m.mu.Unlock()
+
+		slog.Info("Created collector for previously skipped cluster", "cluster", cluster.ID, "name", cluster.Name)
+		startCollector(ctx, wg, cluster.ID, collector)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.failed)
+}
+
+// storeFor returns the store a cluster's history is saved to.
+func (m *Manager) storeFor(clusterID string) Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if store, ok := m.clusterStores[clusterID]; ok {
+		return store
+	}
+	return m.store
+}
+
+// WithClusterStores saves the history of the given clusters to their own stores
+// instead of the store passed to NewManager. Call it before Start.
+func (m *Manager) WithClusterStores(stores map[string]Store) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clusterStores = stores
+	for id, store := range stores {
+		if c, ok := m.collectors[id]; ok {
+			c.store = store
+		}
+	}
+	return m
 }
 
 func (m *Manager) Close() {
@@ -75,6 +323,66 @@ func (m *Manager) GetCollector(clusterID string) (*Collector, bool) {
 	return c, ok
 }
 
+// Pause pauses scheduled collection for a cluster.
+func (m *Manager) Pause(clusterID string) error {
+	c, ok := m.GetCollector(clusterID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCluster, clusterID)
+	}
+	c.Pause()
+	slog.Info("Paused collector", "cluster", clusterID)
+	return nil
+}
+
+// Resume resumes scheduled collection for a cluster.
+func (m *Manager) Resume(clusterID string) error {
+	c, ok := m.GetCollector(clusterID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCluster, clusterID)
+	}
+	c.Resume()
+	slog.Info("Resumed collector", "cluster", clusterID)
+	return nil
+}
+
+// DryRun runs a collection for a cluster without storing anything and returns
+// what it would record.
+func (m *Manager) DryRun(ctx context.Context, clusterID string) (*DryRunResult, error) {
+	c, ok := m.GetCollector(clusterID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, clusterID)
+	}
+	return c.CollectDryRun(ctx)
+}
+
+// Status returns the state of every collector, sorted by cluster ID.
+func (m *Manager) Status() []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(m.collectors)+len(m.failed)+len(m.overLimit))
+	for id, c := range m.collectors {
+		st := Status{
+			ClusterID:               id,
+			Paused:                  c.Paused(),
+			MonitorsHistoryDatabase: c.MonitorsHistoryDatabase(),
+			SelfMonitoringAllowed:   c.SelfMonitoringAllowed(),
+		}
+		if e := c.LastError(); e != nil {
+			st.LastError = e.Stage + ": " + e.Message
+		}
+		statuses = append(statuses, st)
+	}
+	for id, f := range m.failed {
+		statuses = append(statuses, Status{ClusterID: id, StartupError: f.err.Error()})
+	}
+	for _, id := range m.overLimit {
+		statuses = append(statuses, Status{ClusterID: id, StartupError: fmt.Sprintf("not collected: over max_clusters of %d", m.cfg.MaxClusters)})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ClusterID < statuses[j].ClusterID })
+	return statuses
+}
+
 func (m *Manager) ClusterIDs() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
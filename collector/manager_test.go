@@ -2,6 +2,9 @@ package collector
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -90,6 +93,158 @@ func TestNewManagerInvalidURL(t *testing.T) {
 	}
 }
 
+// unreachableURL is a source cluster nothing listens on.
+const unreachableURL = "postgresql://root@127.0.0.1:1/defaultdb?sslmode=disable&connect_timeout=2"
+
+func TestNewManagerSkipsFailedClusters(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	cfg := &config.Config{
+		PollInterval:       config.Duration(time.Hour),
+		FailedClusterRetry: config.Duration(time.Hour),
+		Clusters: []config.ClusterConfig{
+			{Name: "Bad", ID: "bad", DatabaseURL: unreachableURL},
+			{Name: "Worse", ID: "worse", DatabaseURL: unreachableURL},
+		},
+	}
+
+	if _, err := NewManager(ctx, cfg, store); err == nil {
+		t.Fatal("Expected NewManager to fail fast by default")
+	}
+
+	cfg.SkipFailedClusters = true
+	manager, err := NewManager(ctx, cfg, store)
+	if err != nil {
+		t.Fatalf("NewManager() with skip_failed_clusters failed: %v", err)
+	}
+	t.Cleanup(manager.Close)
+
+	if ids := manager.ClusterIDs(); len(ids) != 0 {
+		t.Errorf("Expected no running collectors, got %v", ids)
+	}
+	statuses := manager.Status()
+	if len(statuses) != 2 || statuses[0].ClusterID != "bad" || statuses[1].ClusterID != "worse" {
+		t.Fatalf("Expected both skipped clusters in Status(), got %+v", statuses)
+	}
+	for _, st := range statuses {
+		if st.StartupError == "" {
+			t.Errorf("Expected a startup error for %s", st.ClusterID)
+		}
+	}
+
+	if remaining := manager.retryFailedOnce(ctx, &sync.WaitGroup{}); remaining != 2 {
+		t.Errorf("Expected both clusters still skipped after a retry, got %d", remaining)
+	}
+
+	// Start returns once cancelled even while clusters are being retried
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		manager.Start(runCtx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after cancellation")
+	}
+}
+
+func TestNewManagerMaxClusters(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	cfg := &config.Config{
+		PollInterval:       config.Duration(time.Hour),
+		FailedClusterRetry: config.Duration(time.Hour),
+		MaxClusters:        2,
+		Clusters: []config.ClusterConfig{
+			{Name: "One", ID: "one", DatabaseURL: unreachableURL, Tenants: []string{"app"}},
+			{Name: "Two", ID: "two", DatabaseURL: unreachableURL},
+		},
+	}
+
+	if _, err := NewManager(ctx, cfg, store); !errors.Is(err, ErrTooManyClusters) {
+		t.Fatalf("Expected ErrTooManyClusters for 3 history clusters over a cap of 2, got %v", err)
+	}
+
+	cfg.SkipFailedClusters = true
+	manager, err := NewManager(ctx, cfg, store)
+	if err != nil {
+		t.Fatalf("NewManager() with skip_failed_clusters failed: %v", err)
+	}
+	t.Cleanup(manager.Close)
+
+	statuses := manager.Status()
+	if len(statuses) != 3 {
+		t.Fatalf("Expected all three clusters in Status(), got %+v", statuses)
+	}
+	for _, st := range statuses {
+		overLimit := strings.Contains(st.StartupError, "max_clusters")
+		if overLimit != (st.ClusterID == "two") {
+			t.Errorf("%s: startup error %q, want only two reported over max_clusters", st.ClusterID, st.StartupError)
+		}
+	}
+	if remaining := manager.retryFailedOnce(ctx, &sync.WaitGroup{}); remaining != 2 {
+		t.Errorf("Expected only the two clusters under the cap retried, got %d", remaining)
+	}
+}
+
+func TestNewManagerSkippedClusterDoesNotBlockOthers(t *testing.T) {
+	sourceURL, _ := getTestURLs(t)
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	cfg := &config.Config{
+		PollInterval:       config.Duration(time.Hour),
+		FailedClusterRetry: config.Duration(time.Hour),
+		SkipFailedClusters: true,
+		Clusters: []config.ClusterConfig{
+			{Name: "Good", ID: "good", DatabaseURL: sourceURL},
+			{Name: "Bad", ID: "bad", DatabaseURL: unreachableURL},
+		},
+	}
+	manager, err := NewManager(ctx, cfg, store)
+	if err != nil {
+		t.Fatalf("NewManager() failed: %v", err)
+	}
+	t.Cleanup(manager.Close)
+
+	if ids := manager.ClusterIDs(); len(ids) != 1 || ids[0] != "good" {
+		t.Fatalf("Expected only the good cluster running, got %v", ids)
+	}
+	if err := manager.Collect(ctx); err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	if snapshot, err := store.GetLatestSnapshot(ctx, "good"); err != nil || len(snapshot) == 0 {
+		t.Errorf("Expected the good cluster collected, got %d settings, %v", len(snapshot), err)
+	}
+
+	// Once the cluster is reachable, a retry starts its collector
+	manager.mu.Lock()
+	manager.failed["bad"].cluster.DatabaseURL = sourceURL
+	manager.mu.Unlock()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	if remaining := manager.retryFailedOnce(runCtx, &wg); remaining != 0 {
+		t.Errorf("Expected no clusters left to retry, got %d", remaining)
+	}
+	if _, ok := manager.GetCollector("bad"); !ok {
+		t.Error("Expected the retried cluster to have a collector")
+	}
+	cancel()
+	wg.Wait()
+}
+
 func TestManagerCollect(t *testing.T) {
 	sourceURL, _ := getTestURLs(t)
 
@@ -127,3 +282,117 @@ func TestManagerClusterIDs(t *testing.T) {
 		}
 	}
 }
+
+func TestManagerPauseResume(t *testing.T) {
+	m := &Manager{collectors: map[string]*Collector{
+		"prod":    {clusterID: "prod"},
+		"staging": {clusterID: "staging"},
+	}}
+
+	if err := m.Pause("prod"); err != nil {
+		t.Fatalf("Pause() failed: %v", err)
+	}
+
+	want := []Status{{ClusterID: "prod", Paused: true}, {ClusterID: "staging", Paused: false}}
+	if got := m.Status(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Status() = %+v, want %+v", got, want)
+	}
+
+	if err := m.Resume("prod"); err != nil {
+		t.Fatalf("Resume() failed: %v", err)
+	}
+	if m.Status()[0].Paused {
+		t.Error("Expected prod to be resumed")
+	}
+
+	if err := m.Pause("unknown"); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("Pause(unknown) error = %v, want ErrUnknownCluster", err)
+	}
+	if err := m.Resume("unknown"); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("Resume(unknown) error = %v, want ErrUnknownCluster", err)
+	}
+}
+
+func TestManagerWithClusterStores(t *testing.T) {
+	ctx := context.Background()
+	primary, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	shard, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	m := &Manager{collectors: map[string]*Collector{
+		"prod":    {clusterID: "prod", store: primary},
+		"staging": {clusterID: "staging", store: primary},
+	}}
+	m.WithClusterStores(map[string]Store{"staging": shard, "unknown": shard})
+
+	settings := []storage.Setting{{Variable: "a.b", Value: "1"}}
+	for _, id := range []string{"prod", "staging"} {
+		c, _ := m.GetCollector(id)
+		if _, err := c.store.SaveCollectedSnapshot(ctx, id, settings, "v1.0", "", 0, "", nil); err != nil {
+			t.Fatalf("SaveCollectedSnapshot(%s) failed: %v", id, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name  string
+		store *storage.FileStore
+		want  string
+	}{
+		{"primary", primary, "prod"},
+		{"shard", shard, "staging"},
+	} {
+		clusters, err := tt.store.ListClusters(ctx)
+		if err != nil {
+			t.Fatalf("ListClusters failed: %v", err)
+		}
+		if len(clusters) != 1 || clusters[0] != tt.want {
+			t.Errorf("%s store has clusters %v, want [%s]", tt.name, clusters, tt.want)
+		}
+	}
+}
+
+func TestNewManagerReadDatabaseURL(t *testing.T) {
+	sourceURL, _ := getTestURLs(t)
+
+	ctx, manager := setupManagerTest(t, []config.ClusterConfig{
+		{Name: "Test1", ID: "test1", DatabaseURL: sourceURL, ReadDatabaseURL: sourceURL},
+	})
+
+	c, _ := manager.GetCollector("test1")
+	if c.readPool == nil || c.collectionPool() != c.readPool {
+		t.Fatal("Expected the read database to be used for collection")
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Errorf("Collect through the read database failed: %v", err)
+	}
+}
+
+func TestAsOfSystemTimeQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster config.ClusterConfig
+		want    string
+	}{
+		{"not configured", config.ClusterConfig{}, "SHOW CLUSTER SETTINGS"},
+		{"interval", config.ClusterConfig{AsOfSystemTime: config.Duration(-10 * time.Second)}, "SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME '-10s'"},
+		{"fractional interval", config.ClusterConfig{AsOfSystemTime: config.Duration(-1500 * time.Millisecond)}, "SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME '-1.5s'"},
+		{"follower reads", config.ClusterConfig{FollowerReads: true}, "SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME follower_read_timestamp()"},
+		{"tenant", config.ClusterConfig{Tenant: "app"}, "SHOW CLUSTER SETTINGS FOR VIRTUAL CLUSTER ['app']"},
+		{"tenant with follower reads", config.ClusterConfig{Tenant: "app", FollowerReads: true}, "SELECT * FROM [SHOW CLUSTER SETTINGS FOR VIRTUAL CLUSTER ['app']] AS OF SYSTEM TIME follower_read_timestamp()"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{query: storage.DefaultCollectionQuery}
+			c.WithAsOfSystemTime(asOfSystemTime(tt.cluster))
+			c.WithTenant(tt.cluster.Tenant)
+			if c.query != tt.want {
+				t.Errorf("query = %q, want %q", c.query, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Statements the collector runs against source clusters. The monitoring
+// credential is only ever used for these, so the collector's footprint on a
+// source cluster can be audited from this file. A new statement must be added
+// to allowedStatements, or it is refused before it reaches the cluster.
+const (
+	stmtVersion              = "SELECT version()"
+	stmtAllowUnsafeInternals = "SET allow_unsafe_internals = true" // crdb_internal requires it in newer versions
+	stmtSourceClusterID      = "SELECT crdb_internal.cluster_id()::TEXT"
+)
+
+// allowedStatements are the only statements sourceDB runs, besides the tenant,
+// zone configuration, and historical collection queries matched by
+// allowedCollectionQuery.
+var allowedStatements = []string{
+	storage.DefaultCollectionQuery,
+	stmtVersion,
+	stmtAllowUnsafeInternals,
+	stmtSourceClusterID,
+}
+
+// allowedCollectionQuery matches the collection queries built by collectionQuery
+// for a tenant, zone configurations, follower reads, or a fixed
+// as_of_system_time interval.
+var allowedCollectionQuery = func() *regexp.Regexp {
+	show := `(` + regexp.QuoteMeta(storage.DefaultCollectionQuery) + `( FOR VIRTUAL CLUSTER \['[a-z0-9-]+'\])?|` +
+		regexp.QuoteMeta(storage.ZoneConfigQuery) + `)`
+	asOf := `(follower_read_timestamp\(\)|'-[0-9]+(\.[0-9]+)?s')`
+	return regexp.MustCompile(`^(` + show + `|SELECT \* FROM \[` + show + `\] AS OF SYSTEM TIME ` + asOf + `)$`)
+}()
+
+// allowedLabelQuery matches a configured snapshot label query: a single SELECT.
+// It is the one statement not fixed here, so the collector runs it in a
+// read-only transaction (see Collector.queryLabel) rather than through sourceDB.
+var allowedLabelQuery = regexp.MustCompile(`(?is)^\s*SELECT\s[^;]*;?\s*$`)
+
+// ErrStatementNotAllowed is returned for a statement missing from the allowlist.
+var ErrStatementNotAllowed = errors.New("statement not allowed")
+
+// checkStatement returns ErrStatementNotAllowed unless sql is allowlisted.
+func checkStatement(sql string) error {
+	if slices.Contains(allowedStatements, sql) || allowedCollectionQuery.MatchString(sql) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrStatementNotAllowed, sql)
+}
+
+// checkLabelQuery returns ErrStatementNotAllowed unless sql is a single SELECT.
+func checkLabelQuery(sql string) error {
+	if allowedLabelQuery.MatchString(sql) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrStatementNotAllowed, sql)
+}
+
+// sourceQuerier is the part of a pgx pool or connection the collector uses.
+type sourceQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// sourceDB runs statements against a source cluster, refusing any that are not
+// allowlisted. Every statement the collector sends goes through it.
+type sourceDB struct {
+	q sourceQuerier
+}
+
+func (db sourceDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := checkStatement(sql); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return db.q.Exec(ctx, sql, args...)
+}
+
+func (db sourceDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := checkStatement(sql); err != nil {
+		return nil, err
+	}
+	return db.q.Query(ctx, sql, args...)
+}
+
+func (db sourceDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := checkStatement(sql); err != nil {
+		return errRow{err}
+	}
+	return db.q.QueryRow(ctx, sql, args...)
+}
+
+// errRow is a pgx.Row whose Scan returns err.
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
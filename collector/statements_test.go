@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestCheckStatement(t *testing.T) {
+	allowed := append([]string{
+		collectionQuery(storage.DefaultCollectionQuery, "", asOfSystemTime(config.ClusterConfig{FollowerReads: true})),
+		collectionQuery(storage.DefaultCollectionQuery, "", asOfSystemTime(config.ClusterConfig{AsOfSystemTime: config.Duration(-10 * time.Second)})),
+		collectionQuery(storage.DefaultCollectionQuery, "", asOfSystemTime(config.ClusterConfig{AsOfSystemTime: config.Duration(-1500 * time.Millisecond)})),
+		collectionQuery(storage.DefaultCollectionQuery, "app", ""),
+		collectionQuery(storage.DefaultCollectionQuery, "analytics-2", asOfSystemTime(config.ClusterConfig{FollowerReads: true})),
+		collectionQuery(storage.ZoneConfigQuery, "", ""),
+		collectionQuery(storage.ZoneConfigQuery, "", asOfSystemTime(config.ClusterConfig{FollowerReads: true})),
+	}, allowedStatements...)
+	for _, sql := range allowed {
+		if err := checkStatement(sql); err != nil {
+			t.Errorf("checkStatement(%q) = %v, want allowed", sql, err)
+		}
+	}
+
+	for _, sql := range []string{
+		"SET CLUSTER SETTING sql.defaults.distsql = 'off'",
+		"show cluster settings",
+		"SHOW ALL CLUSTER SETTINGS",
+		"SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME '-10s'; DROP TABLE users",
+		"SELECT * FROM [SHOW CLUSTER SETTINGS] AS OF SYSTEM TIME now()",
+		"SHOW CLUSTER SETTINGS FOR VIRTUAL CLUSTER ['app'||(SELECT 'x')]",
+		"SHOW CLUSTER SETTINGS FOR VIRTUAL CLUSTER system",
+		"SHOW ALL ZONE CONFIGURATIONS FOR VIRTUAL CLUSTER ['app']",
+		"SHOW ZONE CONFIGURATION FROM DATABASE app",
+	} {
+		if err := checkStatement(sql); !errors.Is(err, ErrStatementNotAllowed) {
+			t.Errorf("checkStatement(%q) = %v, want ErrStatementNotAllowed", sql, err)
+		}
+	}
+}
+
+func TestCheckLabelQuery(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT 'v1.2.3'",
+		"select tag from deploys.releases order by deployed_at desc limit 1;",
+		"  SELECT\n  value FROM system.settings WHERE name = 'version'",
+	} {
+		if err := checkLabelQuery(sql); err != nil {
+			t.Errorf("checkLabelQuery(%q) = %v, want allowed", sql, err)
+		}
+	}
+
+	for _, sql := range []string{
+		"",
+		"DELETE FROM releases",
+		"SELECT 1; DROP TABLE releases",
+		"WITH d AS (DELETE FROM releases RETURNING tag) SELECT tag FROM d",
+		"SELECTED",
+	} {
+		if err := checkLabelQuery(sql); !errors.Is(err, ErrStatementNotAllowed) {
+			t.Errorf("checkLabelQuery(%q) = %v, want ErrStatementNotAllowed", sql, err)
+		}
+	}
+}
+
+// recordingQuerier records the statements that reach it and runs none of them.
+type recordingQuerier struct {
+	statements []string
+}
+
+func (q *recordingQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q.statements = append(q.statements, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (q *recordingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.statements = append(q.statements, sql)
+	return nil, nil
+}
+
+func (q *recordingQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.statements = append(q.statements, sql)
+	return errRow{nil}
+}
+
+func TestSourceDBRefusesUnlistedStatements(t *testing.T) {
+	q := &recordingQuerier{}
+	db := sourceDB{q}
+	ctx := context.Background()
+	const unlisted = "DELETE FROM system.users"
+
+	if _, err := db.Exec(ctx, unlisted); !errors.Is(err, ErrStatementNotAllowed) {
+		t.Errorf("Exec: expected ErrStatementNotAllowed, got %v", err)
+	}
+	if _, err := db.Query(ctx, unlisted); !errors.Is(err, ErrStatementNotAllowed) {
+		t.Errorf("Query: expected ErrStatementNotAllowed, got %v", err)
+	}
+	if err := db.QueryRow(ctx, unlisted).Scan(); !errors.Is(err, ErrStatementNotAllowed) {
+		t.Errorf("QueryRow: expected ErrStatementNotAllowed, got %v", err)
+	}
+	if len(q.statements) != 0 {
+		t.Errorf("Expected no unlisted statement to reach the cluster, got %v", q.statements)
+	}
+
+	db.Exec(ctx, stmtAllowUnsafeInternals)
+	if len(q.statements) != 1 {
+		t.Errorf("Expected the allowlisted statement to be run, got %v", q.statements)
+	}
+}
+
+// statementLog is a pgx tracer that records every statement sent on a connection.
+type statementLog struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (l *statementLog) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statements = append(l.statements, data.SQL)
+	return ctx
+}
+
+func (l *statementLog) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+}
+
+func TestCollectorIssuesOnlyAllowedStatements(t *testing.T) {
+	sourceURL, historyURL := getTestURLs(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store, err := storage.New(ctx, historyURL)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	log := &statementLog{}
+	poolConfig, err := pgxpool.ParseConfig(sourceURL)
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	poolConfig.ConnConfig.Tracer = log
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatalf("NewWithConfig failed: %v", err)
+	}
+
+	c := &Collector{pool: pool, store: store, clusterID: uniqueClusterID(t), interval: time.Hour, query: storage.DefaultCollectionQuery}
+	defer c.Close()
+	if err := c.Collect(ctx); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if _, err := c.CollectDryRun(ctx); err != nil {
+		t.Fatalf("CollectDryRun failed: %v", err)
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(log.statements) == 0 {
+		t.Fatal("Expected the tracer to record statements")
+	}
+	for _, sql := range log.statements {
+		if err := checkStatement(sql); err != nil {
+			t.Errorf("Collector issued an unlisted statement: %v", err)
+		}
+	}
+}
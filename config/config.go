@@ -2,12 +2,22 @@
 package config
 
 import (
+	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,6 +26,242 @@ type ClusterConfig struct {
 	Name        string `yaml:"name"`         // Display name (e.g., "Production", "Staging")
 	ID          string `yaml:"id"`           // Unique identifier (slug, e.g., "prod", "staging")
 	DatabaseURL string `yaml:"database_url"` // Connection string to monitored cluster
+	Environment string `yaml:"environment"`  // Optional environment label (e.g., "production", "staging")
+	Region      string `yaml:"region"`       // Optional region label (e.g., "us-east-1")
+	Color       string `yaml:"color"`        // Optional display color as a hex code (e.g., "#d32f2f")
+
+	// ExpectedSettings maps variables to the values they should have; the scorecard
+	// endpoint reports whether the latest snapshot meets each expectation.
+	ExpectedSettings map[string]string `yaml:"expected_settings"`
+
+	// HistoryDatabaseURL stores this cluster's history in its own database instead
+	// of the top-level history_database_url. Clusters naming the same URL share it.
+	HistoryDatabaseURL string `yaml:"history_database_url"`
+
+	// ReadDatabaseURL, when set, is used only for the collection query, e.g. to
+	// read settings from a follower away from busy leaseholders. The cluster ID and
+	// version are still read through DatabaseURL.
+	ReadDatabaseURL string `yaml:"read_database_url"`
+
+	// FollowerReads runs the collection query AS OF SYSTEM TIME
+	// follower_read_timestamp(), so any replica can serve it.
+	FollowerReads bool `yaml:"follower_reads"`
+
+	// AsOfSystemTime runs the collection query AS OF SYSTEM TIME this far in the
+	// past (a negative duration such as "-10s"), a consistent read that does not
+	// contend with writes. Zero reads current values. Exclusive with FollowerReads.
+	AsOfSystemTime Duration `yaml:"as_of_system_time"`
+
+	// Tenants names virtual clusters whose settings are collected alongside the
+	// cluster's own. Each is tracked as its own history cluster, with the ID
+	// returned by TenantClusterID, so its changes never mix with the cluster's.
+	Tenants []string `yaml:"tenants"`
+
+	// ZoneConfigs also collects the cluster's zone configurations (SHOW ALL ZONE
+	// CONFIGURATIONS). They are tracked as their own history cluster, with the ID
+	// returned by ZoneConfigClusterID, so their changes are detected separately
+	// from the cluster settings'.
+	ZoneConfigs bool `yaml:"zone_configs"`
+
+	// Webhooks are notified of this cluster's changes in addition to the top-level
+	// webhooks, or instead of them when ReplaceWebhooks is set.
+	Webhooks        []Webhook `yaml:"webhooks"`
+	ReplaceWebhooks bool      `yaml:"replace_webhooks"`
+
+	// SnapshotLabel overrides the top-level snapshot_label for this cluster.
+	SnapshotLabel SnapshotLabel `yaml:"snapshot_label"`
+
+	// CollectionSchedule overrides the top-level collection_schedule for this
+	// cluster.
+	CollectionSchedule CollectionSchedule `yaml:"collection_schedule"`
+
+	// Tenant is the virtual cluster this entry collects from. It is set only on
+	// the entries HistoryClusters derives from Tenants.
+	Tenant string `yaml:"-"`
+
+	// ZoneConfigsOf is the cluster whose zone configurations this entry collects.
+	// It is set only on the entries HistoryClusters derives from ZoneConfigs.
+	ZoneConfigsOf string `yaml:"-"`
+}
+
+// Webhook is a notification channel set in the configuration: each collection's
+// changes to variables matching Variables are POSTed to URL, as they are for a
+// subscription created through the API.
+type Webhook struct {
+	URL       string `yaml:"url"`
+	Variables string `yaml:"variables"` // Variable glob; empty matches every variable
+}
+
+// FilterPreset is a named list of variable globs offered as a quick filter on
+// the changes dashboard, e.g. the settings one team cares about.
+type FilterPreset struct {
+	Name      string   `yaml:"name"`
+	Variables []string `yaml:"variables"`
+}
+
+// PageLimits are the number of rows list pages and endpoints return without a
+// limit parameter, and the largest limit they accept. Zero fields take the
+// defaults (DefaultPageSize and so on).
+type PageLimits struct {
+	// PageSize is the number of changes or annotations returned without a
+	// limit, and the number of changes the dashboard shows.
+	PageSize int `yaml:"page_size"`
+	// MaxChanges is the largest limit accepted for changes and annotations.
+	MaxChanges int `yaml:"max_changes"`
+	// SnapshotPageSize is the number of snapshots listed without a limit.
+	SnapshotPageSize int `yaml:"snapshot_page_size"`
+	// MaxSnapshots is the largest limit accepted for snapshots.
+	MaxSnapshots int `yaml:"max_snapshots"`
+}
+
+// SnapshotLabel stamps each snapshot with a label read at collection time, such
+// as the release being deployed: the value of the environment variable Env, or
+// the single value returned by Query, a SELECT run on the source cluster in a
+// read-only transaction. At most one may be set.
+type SnapshotLabel struct {
+	Env   string `yaml:"env"`
+	Query string `yaml:"query"`
+}
+
+// CollectionSchedule limits scheduled collections to time-of-day windows, such
+// as business hours. Each window is "[DAYS ]HH:MM-HH:MM": DAYS is a day ("sat")
+// or a range of days ("mon-fri"), every day when omitted, and a window whose end
+// is before its start runs past midnight into the next day. Times are in
+// Timezone, UTC when empty. With no windows, every scheduled collection runs.
+type CollectionSchedule struct {
+	Timezone string   `yaml:"timezone"`
+	Windows  []string `yaml:"windows"`
+}
+
+// collectionWindow is a parsed CollectionSchedule window.
+type collectionWindow struct {
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes since midnight
+}
+
+// weekdays maps the day names accepted in collection windows.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseCollectionWindow parses a window such as "mon-fri 09:00-18:00".
+func parseCollectionWindow(s string) (collectionWindow, error) {
+	var w collectionWindow
+	fields := strings.Fields(s)
+	var times string
+	switch len(fields) {
+	case 1:
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		times = fields[0]
+	case 2:
+		first, last, isRange := strings.Cut(strings.ToLower(fields[0]), "-")
+		if !isRange {
+			last = first
+		}
+		from, ok1 := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok1 || !ok2 {
+			return w, fmt.Errorf("window %q: days must be a day or range of days such as mon-fri", s)
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == to {
+				break
+			}
+		}
+		times = fields[1]
+	default:
+		return w, fmt.Errorf("window %q must be [DAYS ]HH:MM-HH:MM", s)
+	}
+
+	startStr, endStr, ok := strings.Cut(times, "-")
+	start, err1 := parseClock(startStr)
+	end, err2 := parseClock(endStr)
+	if !ok || err1 != nil || err2 != nil {
+		return w, fmt.Errorf("window %q must be [DAYS ]HH:MM-HH:MM", s)
+	}
+	if start == 24*60 || start == end {
+		return w, fmt.Errorf("window %q: start must be before 24:00 and differ from end", s)
+	}
+	w.start, w.end = start, end
+	return w, nil
+}
+
+// parseClock parses a time of day, "00:00" to "24:00", as minutes since midnight.
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hours, err1 := strconv.Atoi(h)
+	minutes, err2 := strconv.Atoi(m)
+	if !ok || len(m) != 2 || err1 != nil || err2 != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// contains reports whether t, already in the schedule's timezone, is in the window.
+func (w collectionWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && m >= w.start && m < w.end
+	}
+	// Past midnight, the early hours belong to the window of the day before
+	if m >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return m < w.end && w.days[(t.Weekday()+6)%7]
+}
+
+// validate checks the timezone and every window.
+func (cs CollectionSchedule) validate() error {
+	var errs []error
+	if cs.Timezone != "" {
+		if _, err := time.LoadLocation(cs.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("timezone %q: %w", cs.Timezone, err))
+		}
+	}
+	for _, window := range cs.Windows {
+		if _, err := parseCollectionWindow(window); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Allows reports whether a scheduled collection may run at t. It is always true
+// without windows. Invalid windows, which validation rejects, never match.
+func (cs CollectionSchedule) Allows(t time.Time) bool {
+	if len(cs.Windows) == 0 {
+		return true
+	}
+	if cs.Timezone != "" {
+		if loc, err := time.LoadLocation(cs.Timezone); err == nil {
+			t = t.In(loc)
+		}
+	} else {
+		t = t.UTC()
+	}
+	for _, window := range cs.Windows {
+		if w, err := parseCollectionWindow(window); err == nil && w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelQueryRe matches an acceptable snapshot label query: a single SELECT.
+var labelQueryRe = regexp.MustCompile(`(?is)^\s*SELECT\s[^;]*;?\s*$`)
+
+// validate checks that at most one label source is set and that a query is a
+// single SELECT.
+func (l SnapshotLabel) validate() error {
+	if l.Env != "" && l.Query != "" {
+		return errors.New("env and query are mutually exclusive")
+	}
+	if l.Query != "" && !labelQueryRe.MatchString(l.Query) {
+		return fmt.Errorf("query %q must be a single SELECT statement", l.Query)
+	}
+	return nil
 }
 
 // Config is the root configuration structure.
@@ -25,11 +271,205 @@ type Config struct {
 	PollInterval       Duration        `yaml:"poll_interval"`
 	Retention          Duration        `yaml:"retention"`
 	HTTPPort           string          `yaml:"http_port"`
+
+	// KeepChangesPerVariable keeps each variable's most recent changes through
+	// retention cleanup, however old they are. 0 keeps none beyond the cutoff.
+	KeepChangesPerVariable int `yaml:"keep_changes_per_variable"`
+
+	// KeepChangesFor overrides KeepChangesPerVariable for individual variables.
+	KeepChangesFor map[string]int `yaml:"keep_changes_for"`
+
+	// CompactRevertsWindow collapses runs of changes that return a setting to an
+	// earlier value within this long, keeping a count of them. 0 disables it.
+	CompactRevertsWindow Duration `yaml:"compact_reverts_window"`
+
+	// CompactRevertsInterval is how often revert compaction runs.
+	CompactRevertsInterval Duration `yaml:"compact_reverts_interval"`
+
+	// IntegrityCheckInterval is how often the server checks each history store
+	// for orphan rows (see storage.IntegrityReport). 0 disables the check.
+	IntegrityCheckInterval Duration `yaml:"integrity_check_interval"`
+
+	// IntegrityRepair deletes the orphan settings and annotations the
+	// integrity check finds, instead of only reporting them.
+	IntegrityRepair bool `yaml:"integrity_repair"`
+
+	// SkipFailedClusters starts collecting the other clusters when a cluster's
+	// collector cannot be created at startup, e.g. because the cluster is
+	// unreachable, instead of refusing to start. Skipped clusters are reported
+	// by the collector status and health endpoints and retried every
+	// FailedClusterRetry.
+	SkipFailedClusters bool `yaml:"skip_failed_clusters"`
+
+	// FailedClusterRetry is how often clusters skipped at startup are retried.
+	FailedClusterRetry Duration `yaml:"failed_cluster_retry"`
+
+	// MaxClusters caps the number of history clusters collected, counting
+	// tenants and zone configurations, as a guard against a configuration
+	// directory merge fanning out to far more collectors than intended. Past
+	// it, startup fails, or with SkipFailedClusters the clusters beyond the cap
+	// are left uncollected. 0 takes DefaultMaxClusters.
+	MaxClusters int `yaml:"max_clusters"`
+
+	// RemovalGrace is the number of consecutive collections a setting must be
+	// missing from before it is recorded as removed. 0 or 1 records it immediately.
+	RemovalGrace int `yaml:"removal_grace"`
+
+	// MaxValueLength truncates setting values longer than this many bytes before
+	// they are stored, keeping a digest of the full value for change detection.
+	// 0 stores values whole.
+	MaxValueLength int `yaml:"max_value_length"`
+
+	// StoreRawOutput keeps the complete output of each collection query with its
+	// snapshot, including columns that aren't otherwise stored, for forensics.
+	StoreRawOutput bool `yaml:"store_raw_output"`
+
+	// MinSettings is the fewest settings a collection may return and still be saved.
+	// A collection with no settings is never saved.
+	MinSettings int `yaml:"min_settings"`
+
+	// MaxSettingsDrop refuses to save a collection whose setting count dropped by
+	// this percentage or more since the previous collection. 0 disables the check.
+	// A requested rebaseline accepts the drop.
+	MaxSettingsDrop int `yaml:"max_settings_drop"`
+
+	// AnchorSetting is a setting every collection is expected to include. A
+	// collection missing it, when the last snapshot had it, is refused instead of
+	// recording the settings a privilege loss hid as removed. Defaults to
+	// DefaultAnchorSetting; AnchorSettingNone disables the check.
+	AnchorSetting string `yaml:"anchor_setting"`
+
+	// TablePrefix is prepended to every history table name (e.g. "crdbhist_"), so the
+	// history database can be shared with other applications. Empty means no prefix.
+	TablePrefix string `yaml:"table_prefix"`
+
+	// DataDir stores history as flat JSON files under this directory instead of in
+	// a history database. Mutually exclusive with HistoryDatabaseURL.
+	DataDir string `yaml:"data_dir"`
+
+	// CaseInsensitiveValues are variable globs (e.g., "*" or "sql.defaults.*") whose
+	// values are compared without regard to case when detecting changes, so an
+	// enum rendered "ON" by one version and "on" by the next is not a change.
+	// The collected values are stored unchanged.
+	CaseInsensitiveValues []string `yaml:"case_insensitive_values"`
+
+	// Webhooks are notified of every cluster's changes, except clusters that set
+	// replace_webhooks. See ClusterWebhooks.
+	Webhooks []Webhook `yaml:"webhooks"`
+
+	// ExpectedDifferences are variable globs (e.g., "kv.snapshot_rebalance.*") whose
+	// differences are known and excluded from comparison results.
+	ExpectedDifferences []string `yaml:"expected_differences"`
+
+	// FilterPresets are offered as quick filters on the changes dashboard, in order.
+	FilterPresets []FilterPreset `yaml:"filter_presets"`
+
+	// PageLimits bound the rows the dashboard and list endpoints return.
+	PageLimits PageLimits `yaml:"page_limits"`
+
+	// LandingPage is the page "/" redirects to (one of LandingPages). Empty or "/"
+	// serves the changes dashboard at "/".
+	LandingPage string `yaml:"landing_page"`
+
+	// ChangeLinkTemplate is a URL rendered for each change to link it to external
+	// tooling (e.g. a ticket search or a dashboard at the change's time). See
+	// web.ChangeLinkPlaceholders for the placeholders it may use. Empty adds no links.
+	ChangeLinkTemplate string `yaml:"change_link_template"`
+
+	// AllowInsecureConnections permits source and history database URLs that
+	// can connect without TLS (sslmode=disable, allow, or prefer, the default
+	// when no sslmode is given), e.g. for local
+	// development against an insecure cluster. See CheckConnectionSecurity.
+	AllowInsecureConnections bool `yaml:"allow_insecure_connections"`
+
+	// SourceIdleTimeout closes source cluster connections left unused this long,
+	// so collectors polling infrequently don't hold connections open between
+	// collections. Zero keeps the driver default (30m).
+	SourceIdleTimeout Duration `yaml:"source_idle_timeout"`
+
+	// ApplicationName is the application_name of source and history database
+	// connections, so DBAs can identify them in CockroachDB's session and
+	// statement views. Empty uses "crdb-cluster-history/<version>". A connection
+	// string's own application_name takes precedence.
+	ApplicationName string `yaml:"application_name"`
+
+	// DatabaseTLSMinVersion is the lowest TLS version ("1.2" or "1.3") accepted
+	// on source and history database connections. Empty keeps Go's default (1.2).
+	DatabaseTLSMinVersion string `yaml:"database_tls_min_version"`
+
+	// SnapshotLabel labels every cluster's snapshots, except clusters that set
+	// their own. See ClusterSnapshotLabel.
+	SnapshotLabel SnapshotLabel `yaml:"snapshot_label"`
+
+	// CollectionSchedule limits when every cluster is collected, except clusters
+	// that set their own. See ClusterCollectionSchedule.
+	CollectionSchedule CollectionSchedule `yaml:"collection_schedule"`
+
+	// SelfMonitoring is how a source cluster found to hold the history database
+	// is treated: SelfMonitoringWarn (the default) or SelfMonitoringAllow.
+	SelfMonitoring string `yaml:"self_monitoring"`
+
+	// SelfMonitoringExclude are variable globs left out of collections from a
+	// source cluster that holds the history database, for settings that writing
+	// the history itself churns.
+	SelfMonitoringExclude []string `yaml:"self_monitoring_exclude"`
+}
+
+// Accepted self_monitoring values.
+const (
+	// SelfMonitoringWarn logs a warning and lists the cluster on /health, since
+	// a source database_url copied from history_database_url is a common mistake.
+	SelfMonitoringWarn = "warn"
+
+	// SelfMonitoringAllow accepts a source cluster holding the history database
+	// as intended, e.g. a single-cluster development setup.
+	SelfMonitoringAllow = "allow"
+)
+
+// TLSVersions maps the accepted database_tls_min_version values to TLS versions.
+var TLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
 }
 
+// LandingPages are the pages that may be configured as the landing page.
+var LandingPages = []string{"/", "/compare", "/history"}
+
 const (
 	DefaultHTTPPort     = "8080"
 	DefaultPollInterval = 15 * time.Minute
+
+	// DefaultCompactRevertsInterval is how often revert compaction runs when
+	// compact_reverts_window is set.
+	DefaultCompactRevertsInterval = 24 * time.Hour
+
+	// DefaultFailedClusterRetry is how often clusters skipped at startup are
+	// retried when skip_failed_clusters is set.
+	DefaultFailedClusterRetry = time.Minute
+
+	// DefaultMaxClusters is the number of history clusters collected unless
+	// max_clusters says otherwise.
+	DefaultMaxClusters = 100
+
+	// DefaultAnchorSetting is the setting collections are checked for. Every
+	// cluster reports its version, whatever the monitoring user's privileges.
+	DefaultAnchorSetting = "version"
+
+	// AnchorSettingNone disables the anchor setting check.
+	AnchorSettingNone = "none"
+
+	// Default PageLimits.
+	DefaultPageSize         = 100
+	DefaultMaxChanges       = 1000
+	DefaultSnapshotPageSize = 100
+	DefaultMaxSnapshots     = 1000
+
+	// BaseConfigFile is the file in a config directory that holds the global
+	// settings. It may also list clusters.
+	BaseConfigFile = "base.yaml"
+
+	// maxLabelLength bounds the free-form display labels (environment, region).
+	maxLabelLength = 64
 )
 
 // Duration is a wrapper around time.Duration that supports YAML unmarshaling.
@@ -47,12 +487,33 @@ func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
 	}
 	parsed, err := time.ParseDuration(s)
 	if err != nil {
-		return fmt.Errorf("invalid duration %q: %w", s, err)
+		return &DurationError{Line: value.Line, Column: value.Column, Value: s, Err: err}
 	}
 	*d = Duration(parsed)
 	return nil
 }
 
+// DurationError reports a duration in a YAML document that could not be parsed.
+type DurationError struct {
+	Path   string // Field path such as "clusters[1].retention", filled in by Load
+	Line   int    // Position of the value in the document
+	Column int
+	Value  string
+	Err    error
+}
+
+func (e *DurationError) Error() string {
+	field := ""
+	if e.Path != "" {
+		field = e.Path + ": "
+	}
+	return fmt.Sprintf("line %d: %sinvalid duration %q: %v", e.Line, field, e.Value, e.Err)
+}
+
+func (e *DurationError) Unwrap() error {
+	return e.Err
+}
+
 // Duration returns the time.Duration value.
 func (d Duration) Duration() time.Duration {
 	return time.Duration(d)
@@ -65,20 +526,167 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := root.Decode(&cfg); err != nil {
+		var durErr *DurationError
+		if errors.As(err, &durErr) {
+			durErr.Path = fieldPath(&root, durErr.Line, durErr.Column)
+		}
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	// Apply defaults
-	if cfg.HTTPPort == "" {
-		cfg.HTTPPort = DefaultHTTPPort
+	cfg.applyDefaults()
+	return &cfg, nil
+}
+
+// fieldPath returns the path of the value at line and column in a YAML document,
+// such as "clusters[1].retention", or "" if no value is there.
+func fieldPath(node *yaml.Node, line, column int) string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if path := fieldPath(child, line, column); path != "" {
+				return path
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Line == line && value.Column == column {
+				return key.Value
+			}
+			if path := fieldPath(value, line, column); path != "" {
+				if strings.HasPrefix(path, "[") {
+					return key.Value + path
+				}
+				return key.Value + "." + path
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if child.Line == line && child.Column == column {
+				return fmt.Sprintf("[%d]", i)
+			}
+			if path := fieldPath(child, line, column); path != "" {
+				if strings.HasPrefix(path, "[") {
+					return fmt.Sprintf("[%d]%s", i, path)
+				}
+				return fmt.Sprintf("[%d].%s", i, path)
+			}
+		}
 	}
-	if cfg.PollInterval == 0 {
-		cfg.PollInterval = Duration(DefaultPollInterval)
+	return ""
+}
+
+// clusterFragment is a config directory file other than the base file: it may
+// only list clusters.
+type clusterFragment struct {
+	Clusters []ClusterConfig `yaml:"clusters"`
+}
+
+// LoadDir reads configuration from a directory of YAML files, so that clusters
+// owned by different teams can live in separate files. Global settings come from
+// BaseConfigFile; every other *.yaml file contributes cluster entries only.
+// Files are merged in name order, and a cluster ID defined in more than one
+// file is an error.
+func LoadDir(dir string) (*Config, error) {
+	basePath := filepath.Join(dir, BaseConfigFile)
+	cfg, err := Load(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", basePath, err)
 	}
 
-	return &cfg, nil
+	definedIn := make(map[string]string, len(cfg.Clusters))
+	for _, cluster := range cfg.Clusters {
+		definedIn[cluster.ID] = BaseConfigFile
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if name == BaseConfigFile {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var fragment clusterFragment
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&fragment); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: failed to parse config file (only clusters may be set outside %s): %w", name, BaseConfigFile, err)
+		}
+
+		for _, cluster := range fragment.Clusters {
+			// Empty IDs are reported by Validate
+			if prev, ok := definedIn[cluster.ID]; ok && cluster.ID != "" {
+				return nil, fmt.Errorf("%s: duplicate cluster id %s (already defined in %s)", name, cluster.ID, prev)
+			}
+			definedIn[cluster.ID] = name
+		}
+		cfg.Clusters = append(cfg.Clusters, fragment.Clusters...)
+	}
+
+	return cfg, nil
+}
+
+// applyDefaults fills in unset optional settings.
+func (c *Config) applyDefaults() {
+	if c.HTTPPort == "" {
+		c.HTTPPort = DefaultHTTPPort
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = Duration(DefaultPollInterval)
+	}
+	if c.CompactRevertsInterval == 0 {
+		c.CompactRevertsInterval = Duration(DefaultCompactRevertsInterval)
+	}
+	if c.FailedClusterRetry == 0 {
+		c.FailedClusterRetry = Duration(DefaultFailedClusterRetry)
+	}
+	if c.MaxClusters == 0 {
+		c.MaxClusters = DefaultMaxClusters
+	}
+	if c.AnchorSetting == "" {
+		c.AnchorSetting = DefaultAnchorSetting
+	}
+	c.PageLimits.applyDefaults()
+}
+
+func (l *PageLimits) applyDefaults() {
+	if l.PageSize == 0 {
+		l.PageSize = DefaultPageSize
+	}
+	if l.MaxChanges == 0 {
+		l.MaxChanges = DefaultMaxChanges
+	}
+	if l.SnapshotPageSize == 0 {
+		l.SnapshotPageSize = DefaultSnapshotPageSize
+	}
+	if l.MaxSnapshots == 0 {
+		l.MaxSnapshots = DefaultMaxSnapshots
+	}
+}
+
+func (l PageLimits) validate() error {
+	switch {
+	case l.PageSize < 0 || l.MaxChanges < 0 || l.SnapshotPageSize < 0 || l.MaxSnapshots < 0:
+		return errors.New("limits must not be negative")
+	case l.PageSize > l.MaxChanges:
+		return fmt.Errorf("page_size %d exceeds max_changes %d", l.PageSize, l.MaxChanges)
+	case l.SnapshotPageSize > l.MaxSnapshots:
+		return fmt.Errorf("snapshot_page_size %d exceeds max_snapshots %d", l.SnapshotPageSize, l.MaxSnapshots)
+	}
+	return nil
 }
 
 // LoadFromEnv creates a configuration from environment variables.
@@ -86,37 +694,92 @@ func Load(path string) (*Config, error) {
 func LoadFromEnv() (*Config, error) {
 	sourceURL := os.Getenv("DATABASE_URL")
 	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	dataDir := os.Getenv("DATA_DIR")
 
 	if sourceURL == "" {
 		return nil, errors.New("DATABASE_URL environment variable is required")
 	}
-	if historyURL == "" {
-		return nil, errors.New("HISTORY_DATABASE_URL environment variable is required")
+	if historyURL == "" && dataDir == "" {
+		return nil, errors.New("HISTORY_DATABASE_URL (or DATA_DIR) environment variable is required")
 	}
 
 	cfg := &Config{
 		HistoryDatabaseURL: historyURL,
+		DataDir:            dataDir,
 		Clusters: []ClusterConfig{{
 			Name:        "Default",
 			ID:          "default",
 			DatabaseURL: sourceURL,
 		}},
-		PollInterval: Duration(ParseDurationEnv("POLL_INTERVAL", DefaultPollInterval)),
-		Retention:    Duration(ParseDurationEnv("RETENTION", 0)),
-		HTTPPort:     GetEnvDefault("HTTP_PORT", DefaultHTTPPort),
+		PollInterval:           Duration(ParseDurationEnv("POLL_INTERVAL", DefaultPollInterval)),
+		Retention:              Duration(ParseDurationEnv("RETENTION", 0)),
+		KeepChangesPerVariable: ParseIntEnv("KEEP_CHANGES_PER_VARIABLE", 0),
+		CompactRevertsWindow:   Duration(ParseDurationEnv("COMPACT_REVERTS_WINDOW", 0)),
+		CompactRevertsInterval: Duration(ParseDurationEnv("COMPACT_REVERTS_INTERVAL", DefaultCompactRevertsInterval)),
+		IntegrityCheckInterval: Duration(ParseDurationEnv("INTEGRITY_CHECK_INTERVAL", 0)),
+		IntegrityRepair:        ParseBoolEnv("INTEGRITY_REPAIR", false),
+		SkipFailedClusters:     ParseBoolEnv("SKIP_FAILED_CLUSTERS", false),
+		FailedClusterRetry:     Duration(ParseDurationEnv("FAILED_CLUSTER_RETRY", DefaultFailedClusterRetry)),
+		MaxClusters:            ParseIntEnv("MAX_CLUSTERS", DefaultMaxClusters),
+		CaseInsensitiveValues:  ParseListEnv("CASE_INSENSITIVE_VALUES"),
+		HTTPPort:               GetEnvDefault("HTTP_PORT", DefaultHTTPPort),
+		RemovalGrace:           ParseIntEnv("REMOVAL_GRACE", 0),
+		MaxValueLength:         ParseIntEnv("MAX_VALUE_LENGTH", 0),
+		StoreRawOutput:         ParseBoolEnv("STORE_RAW_OUTPUT", false),
+		MinSettings:            ParseIntEnv("MIN_SETTINGS", 0),
+		MaxSettingsDrop:        ParseIntEnv("MAX_SETTINGS_DROP", 0),
+		AnchorSetting:          GetEnvDefault("ANCHOR_SETTING", DefaultAnchorSetting),
+		TablePrefix:            os.Getenv("TABLE_PREFIX"),
+		LandingPage:            os.Getenv("LANDING_PAGE"),
+
+		ChangeLinkTemplate: os.Getenv("CHANGE_LINK_TEMPLATE"),
+
+		AllowInsecureConnections: ParseBoolEnv("ALLOW_INSECURE_CONNECTIONS", false),
+		DatabaseTLSMinVersion:    os.Getenv("DATABASE_TLS_MIN_VERSION"),
+		SourceIdleTimeout:        Duration(ParseDurationEnv("SOURCE_IDLE_TIMEOUT", 0)),
+		ApplicationName:          os.Getenv("APPLICATION_NAME"),
+
+		SnapshotLabel: SnapshotLabel{
+			Env:   os.Getenv("SNAPSHOT_LABEL_ENV"),
+			Query: os.Getenv("SNAPSHOT_LABEL_QUERY"),
+		},
+
+		CollectionSchedule: CollectionSchedule{
+			Timezone: os.Getenv("COLLECTION_TIMEZONE"),
+			Windows:  ParseListEnv("COLLECTION_WINDOWS"),
+		},
+
+		SelfMonitoring:        os.Getenv("SELF_MONITORING"),
+		SelfMonitoringExclude: ParseListEnv("SELF_MONITORING_EXCLUDE"),
+
+		PageLimits: PageLimits{
+			PageSize:         ParseIntEnv("PAGE_SIZE", DefaultPageSize),
+			MaxChanges:       ParseIntEnv("MAX_CHANGES_LIMIT", DefaultMaxChanges),
+			SnapshotPageSize: ParseIntEnv("SNAPSHOT_PAGE_SIZE", DefaultSnapshotPageSize),
+			MaxSnapshots:     ParseIntEnv("MAX_SNAPSHOTS_LIMIT", DefaultMaxSnapshots),
+		},
 	}
 
 	return cfg, nil
 }
 
 // LoadAuto tries to load configuration from a file, falling back to environment variables.
-// It checks for CLUSTERS_CONFIG env var, then clusters.yaml, then falls back to env vars.
+// It checks for CLUSTERS_CONFIG env var, then CLUSTERS_CONFIG_DIR, then clusters.yaml,
+// then falls back to env vars.
 func LoadAuto() (*Config, error) {
-	// Check for explicit config file path
 	configPath := os.Getenv("CLUSTERS_CONFIG")
+	configDir := os.Getenv("CLUSTERS_CONFIG_DIR")
+	if configPath != "" && configDir != "" {
+		return nil, errors.New("CLUSTERS_CONFIG and CLUSTERS_CONFIG_DIR are mutually exclusive")
+	}
+
+	// Check for explicit config file path or directory
 	if configPath != "" {
 		return Load(configPath)
 	}
+	if configDir != "" {
+		return LoadDir(configDir)
+	}
 
 	// Check for default config file
 	if _, err := os.Stat("clusters.yaml"); err == nil {
@@ -127,47 +790,266 @@ func LoadAuto() (*Config, error) {
 	return LoadFromEnv()
 }
 
-// Validate checks the configuration for errors.
+// ValidationError lists every problem Validate found, so a large configuration
+// can be fixed in one pass.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d configuration problems:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the individual problems, for errors.Is and errors.As.
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// Validate checks the configuration for errors. It reports every problem found
+// as a *ValidationError, naming the index, ID, and name of each offending cluster.
 func (c *Config) Validate() error {
-	if c.HistoryDatabaseURL == "" {
-		return errors.New("history_database_url is required")
+	var problems []error
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.HistoryDatabaseURL == "" && c.DataDir == "" {
+		fail("history_database_url is required (or data_dir for file storage)")
+	}
+	if c.HistoryDatabaseURL != "" && c.DataDir != "" {
+		fail("history_database_url and data_dir are mutually exclusive")
 	}
 
 	if len(c.Clusters) == 0 {
-		return errors.New("at least one cluster must be configured")
+		fail("at least one cluster must be configured")
 	}
 
 	// Check for duplicate IDs
-	seenIDs := make(map[string]bool)
+	seenIDs := make(map[string]int)
 	for i, cluster := range c.Clusters {
+		label := clusterLabel(i, cluster)
 		if cluster.ID == "" {
-			return fmt.Errorf("cluster[%d]: id is required", i)
+			fail("%s: id is required", label)
+		} else if !IsValidID(cluster.ID) {
+			// Validate ID format (alphanumeric, hyphens, underscores)
+			fail("%s: id %q contains invalid characters (use only alphanumeric, hyphens, underscores)", label, cluster.ID)
 		}
 		if cluster.Name == "" {
-			return fmt.Errorf("cluster[%d]: name is required", i)
+			fail("%s: name is required", label)
 		}
 		if cluster.DatabaseURL == "" {
-			return fmt.Errorf("cluster[%d] (%s): database_url is required", i, cluster.ID)
+			fail("%s: database_url is required", label)
+		}
+		if cluster.HistoryDatabaseURL != "" && c.DataDir != "" {
+			fail("%s: history_database_url cannot be combined with data_dir", label)
+		}
+		if cluster.AsOfSystemTime > 0 {
+			fail("%s: as_of_system_time must be a negative interval such as -10s", label)
+		}
+		if cluster.AsOfSystemTime != 0 && cluster.FollowerReads {
+			fail("%s: as_of_system_time and follower_reads are mutually exclusive", label)
+		}
+		for _, err := range validateDisplayMetadata(cluster) {
+			fail("%s: %w", label, err)
+		}
+		for j, hook := range cluster.Webhooks {
+			if err := validateWebhook(hook); err != nil {
+				fail("%s: webhooks[%d]: %w", label, j, err)
+			}
+		}
+		if err := cluster.SnapshotLabel.validate(); err != nil {
+			fail("%s: snapshot_label: %w", label, err)
+		}
+		if err := cluster.CollectionSchedule.validate(); err != nil {
+			fail("%s: collection_schedule: %w", label, err)
+		}
+		seenTenants := make(map[string]bool, len(cluster.Tenants))
+		for _, tenant := range cluster.Tenants {
+			if !IsValidTenantName(tenant) {
+				fail("%s: tenant %q is not a valid virtual cluster name (use lowercase letters, digits, and hyphens)", label, tenant)
+			} else if seenTenants[tenant] {
+				fail("%s: duplicate tenant: %s", label, tenant)
+			}
+			seenTenants[tenant] = true
+		}
+		if cluster.ZoneConfigs && seenTenants[ZoneConfigsSuffix] {
+			fail("%s: tenant %q cannot be collected with zone_configs, whose history uses the same ID", label, ZoneConfigsSuffix)
 		}
 
-		// Validate ID format (alphanumeric, hyphens, underscores)
-		if !isValidID(cluster.ID) {
-			return fmt.Errorf("cluster[%d]: id %q contains invalid characters (use only alphanumeric, hyphens, underscores)", i, cluster.ID)
+		if first, ok := seenIDs[cluster.ID]; ok && cluster.ID != "" {
+			fail("%s: duplicate cluster id: %s (also cluster[%d])", label, cluster.ID, first)
+		} else {
+			seenIDs[cluster.ID] = i
 		}
+	}
 
-		if seenIDs[cluster.ID] {
-			return fmt.Errorf("duplicate cluster id: %s", cluster.ID)
+	for i, hook := range c.Webhooks {
+		if err := validateWebhook(hook); err != nil {
+			fail("webhooks[%d]: %w", i, err)
+		}
+	}
+	presetNames := make(map[string]bool)
+	for i, preset := range c.FilterPresets {
+		switch {
+		case preset.Name == "":
+			fail("filter_presets[%d]: name is required", i)
+		case presetNames[preset.Name]:
+			fail("filter_presets[%d]: duplicate name: %s", i, preset.Name)
+		}
+		presetNames[preset.Name] = true
+		if len(preset.Variables) == 0 {
+			fail("filter_presets[%d]: variables is required", i)
 		}
-		seenIDs[cluster.ID] = true
+	}
+	if err := c.PageLimits.validate(); err != nil {
+		fail("page_limits: %w", err)
+	}
+	if err := c.SnapshotLabel.validate(); err != nil {
+		fail("snapshot_label: %w", err)
+	}
+	if err := c.CollectionSchedule.validate(); err != nil {
+		fail("collection_schedule: %w", err)
+	}
+	switch c.SelfMonitoring {
+	case "", SelfMonitoringWarn, SelfMonitoringAllow:
+	default:
+		fail("self_monitoring must be %q or %q, got %q", SelfMonitoringWarn, SelfMonitoringAllow, c.SelfMonitoring)
 	}
 
 	if c.PollInterval.Duration() < time.Second {
-		return errors.New("poll_interval must be at least 1 second")
+		fail("poll_interval must be at least 1 second")
+	}
+	if c.SourceIdleTimeout < 0 {
+		fail("source_idle_timeout must not be negative")
+	}
+	if c.RemovalGrace < 0 {
+		fail("removal_grace must not be negative")
+	}
+	if c.KeepChangesPerVariable < 0 {
+		fail("keep_changes_per_variable must not be negative")
+	}
+	for _, variable := range slices.Sorted(maps.Keys(c.KeepChangesFor)) {
+		if c.KeepChangesFor[variable] < 0 {
+			fail("keep_changes_for: %s must not be negative", variable)
+		}
+	}
+	if c.CompactRevertsWindow < 0 {
+		fail("compact_reverts_window must not be negative")
+	}
+	if c.CompactRevertsWindow > 0 && c.CompactRevertsInterval < Duration(time.Minute) {
+		fail("compact_reverts_interval must be at least 1 minute")
+	}
+	if c.IntegrityCheckInterval < 0 {
+		fail("integrity_check_interval must not be negative")
+	}
+	if c.IntegrityCheckInterval > 0 && c.IntegrityCheckInterval < Duration(time.Minute) {
+		fail("integrity_check_interval must be at least 1 minute")
+	}
+	if c.SkipFailedClusters && c.FailedClusterRetry < Duration(time.Second) {
+		fail("failed_cluster_retry must be at least 1 second")
+	}
+	if c.MaxClusters < 0 {
+		fail("max_clusters must not be negative")
+	}
+	if c.MaxValueLength < 0 {
+		fail("max_value_length must not be negative")
+	}
+	if c.MinSettings < 0 {
+		fail("min_settings must not be negative")
+	}
+	if c.MaxSettingsDrop < 0 || c.MaxSettingsDrop > 100 {
+		fail("max_settings_drop must be a percentage between 0 and 100")
+	}
+	if c.TablePrefix != "" && !IsValidTablePrefix(c.TablePrefix) {
+		fail("table_prefix %q is invalid (use lowercase letters, digits, and underscores, starting with a letter)", c.TablePrefix)
+	}
+	if c.LandingPage != "" && !slices.Contains(LandingPages, c.LandingPage) {
+		fail("landing_page %q is invalid (use one of %s)", c.LandingPage, strings.Join(LandingPages, ", "))
+	}
+	if _, ok := TLSVersions[c.DatabaseTLSMinVersion]; c.DatabaseTLSMinVersion != "" && !ok {
+		fail("database_tls_min_version %q is invalid (use 1.2 or 1.3)", c.DatabaseTLSMinVersion)
 	}
 
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
 	return nil
 }
 
+// TLSMinVersion returns the minimum TLS version for database connections, or 0
+// for Go's default.
+func (c *Config) TLSMinVersion() uint16 {
+	return TLSVersions[c.DatabaseTLSMinVersion]
+}
+
+// CheckConnectionSecurity rejects source and history database URLs that connect
+// without TLS, unless AllowInsecureConnections is set, so a production cluster is
+// not monitored over plaintext by accident. sslmode=disable never uses TLS,
+// sslmode=allow tries plaintext first, and sslmode=prefer, the default, falls
+// back to plaintext when TLS fails; only require and stricter always use TLS.
+func (c *Config) CheckConnectionSecurity() error {
+	if c.AllowInsecureConnections {
+		return nil
+	}
+	var problems []error
+	check := func(label, connString string) {
+		if connString == "" {
+			return
+		}
+		cfg, err := pgconn.ParseConfig(connString)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", label, err))
+			return
+		}
+		insecure := cfg.TLSConfig == nil
+		for _, fallback := range cfg.Fallbacks {
+			if fallback.TLSConfig == nil {
+				insecure = true
+			}
+		}
+		if insecure {
+			problems = append(problems, fmt.Errorf("%s can connect without TLS; use sslmode=require or stricter, or set allow_insecure_connections", label))
+		}
+	}
+
+	check("history_database_url", c.HistoryDatabaseURL)
+	for i, cluster := range c.Clusters {
+		label := clusterLabel(i, cluster)
+		check(label+": database_url", cluster.DatabaseURL)
+		check(label+": read_database_url", cluster.ReadDatabaseURL)
+		check(label+": history_database_url", cluster.HistoryDatabaseURL)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// clusterLabel identifies a cluster in validation errors by its position in the
+// list and, when set, its ID and name.
+func clusterLabel(i int, cluster ClusterConfig) string {
+	label := fmt.Sprintf("cluster[%d]", i)
+	switch {
+	case cluster.ID != "" && cluster.Name != "":
+		label += fmt.Sprintf(" (%s, %q)", cluster.ID, cluster.Name)
+	case cluster.ID != "":
+		label += fmt.Sprintf(" (%s)", cluster.ID)
+	case cluster.Name != "":
+		label += fmt.Sprintf(" (%q)", cluster.Name)
+	}
+	return label
+}
+
 // GetCluster returns a cluster configuration by ID.
 func (c *Config) GetCluster(id string) (*ClusterConfig, bool) {
 	for i := range c.Clusters {
@@ -178,6 +1060,122 @@ func (c *Config) GetCluster(id string) (*ClusterConfig, bool) {
 	return nil, false
 }
 
+// HistoryClusters returns every cluster whose history is tracked: each configured
+// cluster followed by one entry per tenant it lists, then one for its zone
+// configurations if it collects them. A tenant entry copies its cluster's
+// settings, with the ID from TenantClusterID and Tenant set, but never collects
+// zone configurations, which belong to the system tenant; a zone
+// configuration entry does the same with ZoneConfigClusterID and ZoneConfigsOf,
+// without the expected settings, which name cluster settings.
+func (c *Config) HistoryClusters() []ClusterConfig {
+	var clusters []ClusterConfig
+	for _, cluster := range c.Clusters {
+		clusters = append(clusters, cluster)
+		for _, tenant := range cluster.Tenants {
+			t := cluster
+			t.ID = TenantClusterID(cluster.ID, tenant)
+			t.Name = fmt.Sprintf("%s (%s)", cluster.Name, tenant)
+			t.Tenants = nil
+			t.ZoneConfigs = false
+			t.Tenant = tenant
+			clusters = append(clusters, t)
+		}
+		if cluster.ZoneConfigs {
+			z := cluster
+			z.ID = ZoneConfigClusterID(cluster.ID)
+			z.Name = fmt.Sprintf("%s (zone configs)", cluster.Name)
+			z.Tenants = nil
+			z.ZoneConfigs = false
+			z.ZoneConfigsOf = cluster.ID
+			z.ExpectedSettings = nil
+			clusters = append(clusters, z)
+		}
+	}
+	return clusters
+}
+
+// ClusterWebhooks maps each history cluster with webhooks to notify to those
+// webhooks: the top-level webhooks followed by the cluster's own, or only the
+// cluster's own when it sets replace_webhooks. Tenants use their cluster's.
+func (c *Config) ClusterWebhooks() map[string][]Webhook {
+	hooks := make(map[string][]Webhook)
+	for _, cluster := range c.HistoryClusters() {
+		var resolved []Webhook
+		if !cluster.ReplaceWebhooks {
+			resolved = append(resolved, c.Webhooks...)
+		}
+		resolved = append(resolved, cluster.Webhooks...)
+		if len(resolved) > 0 {
+			hooks[cluster.ID] = resolved
+		}
+	}
+	return hooks
+}
+
+// ClusterSnapshotLabel returns where a cluster's snapshot labels come from: its
+// own snapshot_label if set, otherwise the top-level one.
+func (c *Config) ClusterSnapshotLabel(cluster ClusterConfig) SnapshotLabel {
+	if cluster.SnapshotLabel != (SnapshotLabel{}) {
+		return cluster.SnapshotLabel
+	}
+	return c.SnapshotLabel
+}
+
+// ClusterCollectionSchedule returns the collection schedule for a cluster: its
+// own when it sets windows, otherwise the top-level one. A cluster's windows
+// without a timezone use the top-level timezone.
+func (c *Config) ClusterCollectionSchedule(cluster ClusterConfig) CollectionSchedule {
+	if len(cluster.CollectionSchedule.Windows) == 0 {
+		return c.CollectionSchedule
+	}
+	schedule := cluster.CollectionSchedule
+	if schedule.Timezone == "" {
+		schedule.Timezone = c.CollectionSchedule.Timezone
+	}
+	return schedule
+}
+
+// validateWebhook checks that a webhook has an absolute http or https URL.
+func validateWebhook(hook Webhook) error {
+	if hook.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an absolute http or https URL", hook.URL)
+	}
+	return nil
+}
+
+// TenantClusterID returns the history cluster ID of a tenant of a cluster, e.g.
+// "prod.app" for tenant "app" of cluster "prod".
+func TenantClusterID(clusterID, tenant string) string {
+	return clusterID + "." + tenant
+}
+
+// ZoneConfigsSuffix ends the history cluster ID of a cluster's zone
+// configurations. It reads as a tenant name, so no tenant may use it.
+const ZoneConfigsSuffix = "zones"
+
+// ZoneConfigClusterID returns the history cluster ID of a cluster's zone
+// configurations, e.g. "prod.zones" for cluster "prod".
+func ZoneConfigClusterID(clusterID string) string {
+	return clusterID + "." + ZoneConfigsSuffix
+}
+
+// ClusterHistoryURLs maps each cluster whose history lives outside the top-level
+// history database to its own history database URL. Tenants share their
+// cluster's history database.
+func (c *Config) ClusterHistoryURLs() map[string]string {
+	urls := make(map[string]string)
+	for _, cluster := range c.HistoryClusters() {
+		if cluster.HistoryDatabaseURL != "" && cluster.HistoryDatabaseURL != c.HistoryDatabaseURL {
+			urls[cluster.ID] = cluster.HistoryDatabaseURL
+		}
+	}
+	return urls
+}
+
 // ClusterIDs returns a list of all cluster IDs.
 func (c *Config) ClusterIDs() []string {
 	ids := make([]string, len(c.Clusters))
@@ -187,8 +1185,23 @@ func (c *Config) ClusterIDs() []string {
 	return ids
 }
 
-// isValidID checks if a string is a valid cluster ID.
-func isValidID(s string) bool {
+// IsValidTablePrefix reports whether s can prefix SQL table names without quoting:
+// a lowercase letter followed by lowercase letters, digits, and underscores.
+func IsValidTablePrefix(s string) bool {
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case i > 0 && ((r >= '0' && r <= '9') || r == '_'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// IsValidID reports whether s is a valid cluster ID: non-empty and made up of
+// letters, digits, hyphens, and underscores.
+func IsValidID(s string) bool {
 	if s == "" {
 		return false
 	}
@@ -200,6 +1213,68 @@ func isValidID(s string) bool {
 	return true
 }
 
+// IsValidHistoryID reports whether s is a valid cluster ID or the ID of one of a
+// cluster's tenants, as returned by TenantClusterID.
+func IsValidHistoryID(s string) bool {
+	clusterID, tenant, ok := strings.Cut(s, ".")
+	if !ok {
+		return IsValidID(s)
+	}
+	return IsValidID(clusterID) && IsValidTenantName(tenant)
+}
+
+// IsValidTenantName reports whether s is a valid virtual cluster name: lowercase
+// letters, digits, and hyphens, neither starting nor ending with a hyphen.
+func IsValidTenantName(s string) bool {
+	for i, r := range s {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+		case r == '-' && i > 0 && i < len(s)-1:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validateDisplayMetadata checks the optional environment, region, color, and
+// expected settings fields, returning every problem found.
+func validateDisplayMetadata(cluster ClusterConfig) []error {
+	var errs []error
+	if len(cluster.Environment) > maxLabelLength {
+		errs = append(errs, fmt.Errorf("environment must be at most %d characters", maxLabelLength))
+	}
+	if len(cluster.Region) > maxLabelLength {
+		errs = append(errs, fmt.Errorf("region must be at most %d characters", maxLabelLength))
+	}
+	if cluster.Color != "" && !isValidHexColor(cluster.Color) {
+		errs = append(errs, fmt.Errorf("color %q must be a hex color like #abc or #aabbcc", cluster.Color))
+	}
+	for variable := range cluster.ExpectedSettings {
+		if strings.TrimSpace(variable) == "" {
+			errs = append(errs, errors.New("expected_settings must not contain an empty variable name"))
+			break
+		}
+	}
+	return errs
+}
+
+// isValidHexColor checks if a string is a CSS hex color in #rgb or #rrggbb form.
+func isValidHexColor(s string) bool {
+	if len(s) != 4 && len(s) != 7 {
+		return false
+	}
+	if s[0] != '#' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetEnvDefault returns an environment variable value or a default.
 func GetEnvDefault(key, defaultValue string) string {
 	if v := os.Getenv(key); v != "" {
@@ -221,3 +1296,41 @@ func ParseDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return d
 }
+
+// ParseListEnv parses a comma-separated list from an environment variable,
+// dropping empty items. It returns nil when the variable is unset or empty.
+func ParseListEnv(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseBoolEnv parses a boolean from an environment variable.
+func ParseBoolEnv(key string, defaultValue bool) bool {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return defaultValue
+	}
+	return b
+}
+
+// ParseIntEnv parses an integer from an environment variable.
+func ParseIntEnv(key string, defaultValue int) int {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultValue
+	}
+	return i
+}
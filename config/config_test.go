@@ -1,11 +1,17 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func writeTestConfig(t *testing.T, content string) string {
@@ -89,6 +95,220 @@ clusters:
 	}
 }
 
+func TestLoadDisplayMetadata(t *testing.T) {
+	t.Parallel()
+	configPath := writeTestConfig(t, `
+history_database_url: "postgresql://localhost/history"
+clusters:
+  - name: "Production"
+    id: "prod"
+    database_url: "postgresql://localhost/prod"
+    environment: "production"
+    region: "us-east-1"
+    color: "#d32f2f"
+  - name: "Dev"
+    id: "dev"
+    database_url: "postgresql://localhost/dev"
+`)
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	prod := cfg.Clusters[0]
+	if prod.Environment != "production" {
+		t.Errorf("Environment = %q, want production", prod.Environment)
+	}
+	if prod.Region != "us-east-1" {
+		t.Errorf("Region = %q, want us-east-1", prod.Region)
+	}
+	if prod.Color != "#d32f2f" {
+		t.Errorf("Color = %q, want #d32f2f", prod.Color)
+	}
+
+	dev := cfg.Clusters[1]
+	if dev.Environment != "" || dev.Region != "" || dev.Color != "" {
+		t.Errorf("Expected empty display metadata for dev, got %+v", dev)
+	}
+}
+
+func TestLoadExpectedDifferences(t *testing.T) {
+	t.Parallel()
+	configPath := writeTestConfig(t, `
+history_database_url: "postgresql://localhost/history"
+expected_differences:
+  - "kv.snapshot_rebalance.*"
+  - "server.mem_budget"
+clusters:
+  - name: "Production"
+    id: "prod"
+    database_url: "postgresql://localhost/prod"
+`)
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	want := []string{"kv.snapshot_rebalance.*", "server.mem_budget"}
+	if strings.Join(cfg.ExpectedDifferences, ",") != strings.Join(want, ",") {
+		t.Errorf("ExpectedDifferences = %v, want %v", cfg.ExpectedDifferences, want)
+	}
+}
+
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"base.yaml": `
+history_database_url: "postgresql://history@localhost:26257/history"
+poll_interval: 5m
+clusters:
+  - name: "Shared"
+    id: "shared"
+    database_url: "postgresql://root@shared:26257/defaultdb"
+`,
+		"payments.yaml": `
+clusters:
+  - name: "Payments Prod"
+    id: "payments-prod"
+    database_url: "postgresql://root@payments:26257/defaultdb"
+`,
+		"analytics.yaml": `
+clusters:
+  - name: "Analytics"
+    id: "analytics"
+    database_url: "postgresql://root@analytics:26257/defaultdb"
+  - name: "Analytics Staging"
+    id: "analytics-staging"
+    database_url: "postgresql://root@analytics-staging:26257/defaultdb"
+`,
+		"empty.yaml": "",
+		"notes.txt":  "not yaml: [",
+		"legacy.yml": "not loaded: [",
+	})
+
+	cfg, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if cfg.HistoryDatabaseURL != "postgresql://history@localhost:26257/history" {
+		t.Errorf("HistoryDatabaseURL = %q, want the base file's", cfg.HistoryDatabaseURL)
+	}
+	if cfg.PollInterval.Duration() != 5*time.Minute {
+		t.Errorf("PollInterval = %v, want 5m", cfg.PollInterval.Duration())
+	}
+	if cfg.HTTPPort != DefaultHTTPPort {
+		t.Errorf("HTTPPort = %q, want default %q", cfg.HTTPPort, DefaultHTTPPort)
+	}
+
+	// Base clusters first, then the other files in name order
+	want := []string{"shared", "analytics", "analytics-staging", "payments-prod"}
+	got := cfg.ClusterIDs()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ClusterIDs() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadDirErrors(t *testing.T) {
+	base := `history_database_url: "postgresql://history@localhost:26257/history"
+clusters:
+  - name: "Prod"
+    id: "prod"
+    database_url: "postgresql://root@prod:26257/defaultdb"
+`
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "duplicate ID across files",
+			files: map[string]string{
+				"base.yaml": base,
+				"team-a.yaml": `clusters:
+  - {name: "Staging", id: "staging", database_url: "postgresql://a"}`,
+				"team-b.yaml": `clusters:
+  - {name: "Staging B", id: "staging", database_url: "postgresql://b"}`,
+			},
+			wantErr: "team-b.yaml: duplicate cluster id staging (already defined in team-a.yaml)",
+		},
+		{
+			name: "duplicate of a base cluster",
+			files: map[string]string{
+				"base.yaml": base,
+				"team.yaml": `clusters:
+  - {name: "Prod again", id: "prod", database_url: "postgresql://b"}`,
+			},
+			wantErr: "already defined in base.yaml",
+		},
+		{
+			name: "global setting outside base file",
+			files: map[string]string{
+				"base.yaml": base,
+				"team.yaml": `poll_interval: 1m`,
+			},
+			wantErr: "team.yaml: failed to parse config file (only clusters may be set outside base.yaml)",
+		},
+		{
+			name:    "missing base file",
+			files:   map[string]string{"team.yaml": `clusters: []`},
+			wantErr: "base.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadDir(writeConfigDir(t, tt.files))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAutoConfigDir(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"base.yaml": `history_database_url: "postgresql://history@localhost:26257/history"`,
+		"prod.yaml": `clusters:
+  - {name: "Prod", id: "prod", database_url: "postgresql://prod"}`,
+	})
+	t.Setenv("CLUSTERS_CONFIG", "")
+	t.Setenv("CLUSTERS_CONFIG_DIR", dir)
+
+	cfg, err := LoadAuto()
+	if err != nil {
+		t.Fatalf("LoadAuto() error = %v", err)
+	}
+	if ids := cfg.ClusterIDs(); len(ids) != 1 || ids[0] != "prod" {
+		t.Errorf("ClusterIDs() = %v, want [prod]", ids)
+	}
+
+	t.Setenv("CLUSTERS_CONFIG", filepath.Join(dir, "base.yaml"))
+	if _, err := LoadAuto(); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("Expected mutually exclusive error, got %v", err)
+	}
+}
+
 func TestLoadFromEnv(t *testing.T) {
 	t.Setenv("DATABASE_URL", "postgresql://root@localhost:26257/defaultdb")
 	t.Setenv("HISTORY_DATABASE_URL", "postgresql://history@localhost:26257/history")
@@ -135,6 +355,16 @@ func TestLoadFromEnvMissingVars(t *testing.T) {
 	if err == nil {
 		t.Error("LoadFromEnv() should fail when HISTORY_DATABASE_URL is missing")
 	}
+
+	t.Setenv("DATA_DIR", t.TempDir())
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() should accept DATA_DIR in place of HISTORY_DATABASE_URL: %v", err)
+	}
+	if cfg.DataDir == "" || cfg.HistoryDatabaseURL != "" {
+		t.Errorf("Expected DataDir set and no HistoryDatabaseURL, got %+v", cfg)
+	}
 }
 
 func TestValidate(t *testing.T) {
@@ -167,6 +397,30 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "history_database_url is required",
 		},
+		{
+			name: "data dir instead of history url",
+			config: Config{
+				DataDir: "/var/lib/crdb-cluster-history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "history url and data dir",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				DataDir:            "/var/lib/crdb-cluster-history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "mutually exclusive",
+		},
 		{
 			name: "no clusters",
 			config: Config{
@@ -238,6 +492,53 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid characters",
 		},
+		{
+			name: "valid display metadata",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Environment: "production", Region: "us-east-1", Color: "#D32F2F"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid color",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Color: "red"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "must be a hex color",
+		},
+		{
+			name: "empty expected setting variable",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", ExpectedSettings: map[string]string{" ": "true"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "expected_settings",
+		},
+		{
+			name: "environment too long",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Environment: strings.Repeat("x", 65)},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "environment must be at most",
+		},
 		{
 			name: "poll interval too short",
 			config: Config{
@@ -250,94 +551,867 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "at least 1 second",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.config.Validate()
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("Validate() should have failed")
-				} else if tt.errMsg != "" && !strings.Contains(err.Error(), tt.errMsg) {
-					t.Errorf("Validate() error = %q, want error containing %q", err.Error(), tt.errMsg)
-				}
-			} else if err != nil {
-				t.Errorf("Validate() unexpected error: %v", err)
-			}
-		})
-	}
-}
-
-func TestGetCluster(t *testing.T) {
-	t.Parallel()
-	cfg := &Config{
-		Clusters: []ClusterConfig{
-			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod"},
-			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		{
+			name: "negative removal grace",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				RemovalGrace: -1,
+			},
+			wantErr: true,
+			errMsg:  "removal_grace must not be negative",
 		},
-	}
-
-	// Find existing cluster
-	cluster, found := cfg.GetCluster("prod")
-	if !found {
-		t.Error("GetCluster(prod) should find cluster")
-	}
-	if cluster.Name != "Production" {
-		t.Errorf("GetCluster(prod).Name = %q, want Production", cluster.Name)
-	}
-
-	// Find non-existent cluster
-	_, found = cfg.GetCluster("nonexistent")
-	if found {
-		t.Error("GetCluster(nonexistent) should not find cluster")
-	}
-}
-
-func TestClusterIDs(t *testing.T) {
-	t.Parallel()
-	cfg := &Config{
-		Clusters: []ClusterConfig{
-			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod"},
-			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		{
+			name: "revert compaction too frequent",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:           Duration(5 * time.Minute),
+				CompactRevertsWindow:   Duration(time.Hour),
+				CompactRevertsInterval: Duration(time.Second),
+			},
+			wantErr: true,
+			errMsg:  "compact_reverts_interval must be at least 1 minute",
 		},
-	}
-
-	ids := cfg.ClusterIDs()
-	if len(ids) != 2 {
-		t.Fatalf("len(ClusterIDs()) = %d, want 2", len(ids))
-	}
-	if ids[0] != "prod" {
-		t.Errorf("ClusterIDs()[0] = %q, want prod", ids[0])
-	}
-	if ids[1] != "staging" {
-		t.Errorf("ClusterIDs()[1] = %q, want staging", ids[1])
-	}
-}
-
-func TestIsValidID(t *testing.T) {
-	t.Parallel()
-	tests := []struct {
-		id    string
-		valid bool
-	}{
-		{"prod", true},
-		{"staging", true},
-		{"prod-us-east", true},
-		{"prod_us_east", true},
-		{"Prod123", true},
-		{"123", true},
-		{"prod us", false},        // space
-		{"prod.us", false},        // dot
-		{"prod/us", false},        // slash
-		{"prod@us", false},        // at sign
-		{"", false},               // empty
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.id, func(t *testing.T) {
-			if got := isValidID(tt.id); got != tt.valid {
-				t.Errorf("isValidID(%q) = %v, want %v", tt.id, got, tt.valid)
-			}
+		{
+			name: "failed cluster retry too short",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:       Duration(5 * time.Minute),
+				SkipFailedClusters: true,
+				FailedClusterRetry: Duration(time.Millisecond),
+			},
+			wantErr: true,
+			errMsg:  "failed_cluster_retry must be at least 1 second",
+		},
+		{
+			name: "negative max clusters",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				MaxClusters:  -1,
+			},
+			wantErr: true,
+			errMsg:  "max_clusters must not be negative",
+		},
+		{
+			name: "negative keep changes for a variable",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:           Duration(5 * time.Minute),
+				KeepChangesPerVariable: 5,
+				KeepChangesFor:         map[string]int{"sql.defaults.distsql": -1},
+			},
+			wantErr: true,
+			errMsg:  "keep_changes_for: sql.defaults.distsql must not be negative",
+		},
+		{
+			name: "negative max value length",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:   Duration(5 * time.Minute),
+				MaxValueLength: -1,
+			},
+			wantErr: true,
+			errMsg:  "max_value_length must not be negative",
+		},
+		{
+			name: "valid table prefix",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				TablePrefix:  "crdbhist_",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid table prefix",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				TablePrefix:  "hist-",
+			},
+			wantErr: true,
+			errMsg:  "table_prefix",
+		},
+		{
+			name: "valid landing page",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				LandingPage:  "/compare",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid landing page",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				LandingPage:  "https://example.com",
+			},
+			wantErr: true,
+			errMsg:  "landing_page",
+		},
+		{
+			name: "page size above max",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				PageLimits:   PageLimits{PageSize: 500, MaxChanges: 200, SnapshotPageSize: 100, MaxSnapshots: 1000},
+			},
+			wantErr: true,
+			errMsg:  "page_limits: page_size 500 exceeds max_changes 200",
+		},
+		{
+			name: "integrity check interval too short",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:           Duration(5 * time.Minute),
+				IntegrityCheckInterval: Duration(time.Second),
+			},
+			wantErr: true,
+			errMsg:  "integrity_check_interval must be at least 1 minute",
+		},
+		{
+			name: "duplicate filter preset",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				FilterPresets: []FilterPreset{
+					{Name: "SQL", Variables: []string{"sql.*"}},
+					{Name: "SQL", Variables: []string{"sql.defaults.*"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "filter_presets[1]: duplicate name: SQL",
+		},
+		{
+			name: "filter preset without variables",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:  Duration(5 * time.Minute),
+				FilterPresets: []FilterPreset{{Name: "SQL"}},
+			},
+			wantErr: true,
+			errMsg:  "filter_presets[0]: variables is required",
+		},
+		{
+			name: "negative min settings",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				MinSettings:  -1,
+			},
+			wantErr: true,
+			errMsg:  "min_settings must not be negative",
+		},
+		{
+			name: "max settings drop over 100",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:    Duration(5 * time.Minute),
+				MaxSettingsDrop: 150,
+			},
+			wantErr: true,
+			errMsg:  "max_settings_drop",
+		},
+		{
+			name: "cluster history database with data dir",
+			config: Config{
+				DataDir: "/var/lib/crdb-history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", HistoryDatabaseURL: "postgresql://localhost/history_b"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "history_database_url cannot be combined with data_dir",
+		},
+		{
+			name: "as of system time in the past",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", AsOfSystemTime: Duration(-10 * time.Second)},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "positive as of system time",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", AsOfSystemTime: Duration(10 * time.Second)},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "as_of_system_time must be a negative interval",
+		},
+		{
+			name: "as of system time with follower reads",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", AsOfSystemTime: Duration(-10 * time.Second), FollowerReads: true},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "as_of_system_time and follower_reads are mutually exclusive",
+		},
+		{
+			name: "tenants",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Tenants: []string{"app", "analytics-2"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid tenant name",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Tenants: []string{"App_1"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  `tenant "App_1" is not a valid virtual cluster name`,
+		},
+		{
+			name: "duplicate tenant",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Tenants: []string{"app", "app"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  "duplicate tenant: app",
+		},
+		{
+			name: "tenant named like the zone configs history",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Tenants: []string{"zones"}, ZoneConfigs: true},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  `tenant "zones" cannot be collected with zone_configs`,
+		},
+		{
+			name: "webhooks",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Webhooks: []Webhook{{URL: "https://hooks.example.com/prod", Variables: "kv.*"}}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				Webhooks:     []Webhook{{URL: "http://hooks.example.com/all"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "webhook without url",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval: Duration(5 * time.Minute),
+				Webhooks:     []Webhook{{Variables: "kv.*"}},
+			},
+			wantErr: true,
+			errMsg:  "webhooks[0]: url is required",
+		},
+		{
+			name: "cluster webhook not http",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", Webhooks: []Webhook{{URL: "ftp://hooks.example.com"}}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  `webhooks[0]: url "ftp://hooks.example.com" must be an absolute http or https URL`,
+		},
+		{
+			name: "invalid collection window",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test",
+						CollectionSchedule: CollectionSchedule{Windows: []string{"weekdays 09:00-18:00"}}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  `collection_schedule: window "weekdays 09:00-18:00": days must be a day or range of days`,
+		},
+		{
+			name: "invalid collection timezone",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:       Duration(5 * time.Minute),
+				CollectionSchedule: CollectionSchedule{Timezone: "Mars/Olympus", Windows: []string{"09:00-18:00"}},
+			},
+			wantErr: true,
+			errMsg:  `collection_schedule: timezone "Mars/Olympus"`,
+		},
+		{
+			name: "snapshot label with env and query",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:  Duration(5 * time.Minute),
+				SnapshotLabel: SnapshotLabel{Env: "RELEASE_TAG", Query: "SELECT 1"},
+			},
+			wantErr: true,
+			errMsg:  "snapshot_label: env and query are mutually exclusive",
+		},
+		{
+			name: "cluster snapshot label query not a select",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", SnapshotLabel: SnapshotLabel{Query: "SELECT 1; DROP TABLE releases"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: true,
+			errMsg:  `snapshot_label: query "SELECT 1; DROP TABLE releases" must be a single SELECT statement`,
+		},
+		{
+			name: "snapshot label query",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test", SnapshotLabel: SnapshotLabel{Query: "select tag from deploys.releases order by at desc limit 1;"}},
+				},
+				PollInterval: Duration(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown self monitoring mode",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:   Duration(5 * time.Minute),
+				SelfMonitoring: "ignore",
+			},
+			wantErr: true,
+			errMsg:  `self_monitoring must be "warn" or "allow", got "ignore"`,
+		},
+		{
+			name: "negative source idle timeout",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:      Duration(5 * time.Minute),
+				SourceIdleTimeout: Duration(-time.Second),
+			},
+			wantErr: true,
+			errMsg:  "source_idle_timeout must not be negative",
+		},
+		{
+			name: "database tls min version",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:          Duration(5 * time.Minute),
+				DatabaseTLSMinVersion: "1.3",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid database tls min version",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://localhost/history",
+				Clusters: []ClusterConfig{
+					{Name: "Test", ID: "test", DatabaseURL: "postgresql://localhost/test"},
+				},
+				PollInterval:          Duration(5 * time.Minute),
+				DatabaseTLSMinVersion: "1.1",
+			},
+			wantErr: true,
+			errMsg:  `database_tls_min_version "1.1" is invalid`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Validate() should have failed")
+				} else if tt.errMsg != "" && !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+			} else if err != nil {
+				t.Errorf("Validate() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckConnectionSecurity(t *testing.T) {
+	const secure = "postgresql://readonly@prod:26257/defaultdb?sslmode=verify-full"
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name: "tls",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://history@localhost:26257/history?sslmode=require",
+				Clusters:           []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: secure}},
+			},
+		},
+		{
+			name: "file store",
+			config: Config{
+				DataDir:  "/var/lib/crdb-cluster-history",
+				Clusters: []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: secure}},
+			},
+		},
+		{
+			name: "default sslmode",
+			config: Config{
+				DataDir:  "/var/lib/crdb-cluster-history",
+				Clusters: []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: "postgresql://readonly@prod:26257/defaultdb"}},
+			},
+			wantErr: `"Prod"): database_url can connect without TLS`,
+		},
+		{
+			name: "prefer",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://history@localhost:26257/history?sslmode=prefer",
+				Clusters:           []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: secure}},
+			},
+			wantErr: "history_database_url can connect without TLS",
+		},
+		{
+			name: "disable",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://history@localhost:26257/history?sslmode=disable",
+				Clusters:           []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: secure}},
+			},
+			wantErr: "history_database_url can connect without TLS",
+		},
+		{
+			name: "allow",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://history@localhost:26257/history?sslmode=require",
+				Clusters:           []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: "postgresql://readonly@prod:26257/defaultdb?sslmode=allow"}},
+			},
+			wantErr: `"Prod"): database_url can connect without TLS`,
+		},
+		{
+			name: "insecure read database",
+			config: Config{
+				HistoryDatabaseURL: "postgresql://history@localhost:26257/history?sslmode=require",
+				Clusters:           []ClusterConfig{{Name: "Prod", ID: "prod", DatabaseURL: secure, ReadDatabaseURL: "host=follower sslmode=disable"}},
+			},
+			wantErr: `"Prod"): read_database_url can connect without TLS`,
+		},
+		{
+			name: "insecure allowed",
+			config: Config{
+				HistoryDatabaseURL:       "postgresql://history@localhost:26257/history?sslmode=disable",
+				Clusters:                 []ClusterConfig{{Name: "Dev", ID: "dev", DatabaseURL: "postgresql://root@localhost:26257/defaultdb?sslmode=disable"}},
+				AllowInsecureConnections: true,
+			},
+		},
+	}
+
+	t.Setenv("PGSSLMODE", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.CheckConnectionSecurity()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckConnectionSecurity() unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckConnectionSecurity() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnvAllowInsecureConnections(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgresql://root@localhost:26257/defaultdb?sslmode=disable")
+	t.Setenv("HISTORY_DATABASE_URL", "postgresql://history@localhost:26257/history?sslmode=disable")
+	t.Setenv("DATABASE_TLS_MIN_VERSION", "1.3")
+
+	t.Setenv("ALLOW_INSECURE_CONNECTIONS", "")
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.CheckConnectionSecurity() == nil {
+		t.Error("Expected sslmode=disable to be rejected without ALLOW_INSECURE_CONNECTIONS")
+	}
+	if cfg.TLSMinVersion() != tls.VersionTLS13 {
+		t.Errorf("TLSMinVersion() = %x, want TLS 1.3", cfg.TLSMinVersion())
+	}
+
+	t.Setenv("ALLOW_INSECURE_CONNECTIONS", "true")
+	cfg, err = LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if err := cfg.CheckConnectionSecurity(); err != nil {
+		t.Errorf("Expected ALLOW_INSECURE_CONNECTIONS to permit sslmode=disable, got %v", err)
+	}
+}
+
+func TestGetCluster(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		Clusters: []ClusterConfig{
+			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod"},
+			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		},
+	}
+
+	// Find existing cluster
+	cluster, found := cfg.GetCluster("prod")
+	if !found {
+		t.Error("GetCluster(prod) should find cluster")
+	}
+	if cluster.Name != "Production" {
+		t.Errorf("GetCluster(prod).Name = %q, want Production", cluster.Name)
+	}
+
+	// Find non-existent cluster
+	_, found = cfg.GetCluster("nonexistent")
+	if found {
+		t.Error("GetCluster(nonexistent) should not find cluster")
+	}
+}
+
+func TestClusterIDs(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		Clusters: []ClusterConfig{
+			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod"},
+			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		},
+	}
+
+	ids := cfg.ClusterIDs()
+	if len(ids) != 2 {
+		t.Fatalf("len(ClusterIDs()) = %d, want 2", len(ids))
+	}
+	if ids[0] != "prod" {
+		t.Errorf("ClusterIDs()[0] = %q, want prod", ids[0])
+	}
+	if ids[1] != "staging" {
+		t.Errorf("ClusterIDs()[1] = %q, want staging", ids[1])
+	}
+}
+
+func TestClusterHistoryURLs(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		HistoryDatabaseURL: "postgresql://history_a",
+		Clusters: []ClusterConfig{
+			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod"},
+			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging", HistoryDatabaseURL: "postgresql://history_b"},
+			{Name: "Dev", ID: "dev", DatabaseURL: "postgresql://dev", HistoryDatabaseURL: "postgresql://history_a"},
+		},
+	}
+
+	urls := cfg.ClusterHistoryURLs()
+	if len(urls) != 1 || urls["staging"] != "postgresql://history_b" {
+		t.Errorf("ClusterHistoryURLs() = %v, want only staging on history_b", urls)
+	}
+}
+
+func TestHistoryClusters(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		HistoryDatabaseURL: "postgresql://history_a",
+		Clusters: []ClusterConfig{
+			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod", HistoryDatabaseURL: "postgresql://history_b", Tenants: []string{"app", "analytics"}},
+			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		},
+	}
+
+	clusters := cfg.HistoryClusters()
+	var ids []string
+	for _, c := range clusters {
+		ids = append(ids, c.ID+"/"+c.Tenant)
+	}
+	if want := []string{"prod/", "prod.app/app", "prod.analytics/analytics", "staging/"}; !slices.Equal(ids, want) {
+		t.Fatalf("HistoryClusters() IDs/tenants = %v, want %v", ids, want)
+	}
+	if tenant := clusters[1]; tenant.Name != "Production (app)" || tenant.DatabaseURL != "postgresql://prod" || tenant.Tenants != nil {
+		t.Errorf("HistoryClusters()[1] = %+v, want a copy of prod named for its tenant", tenant)
+	}
+
+	urls := cfg.ClusterHistoryURLs()
+	if urls["prod.app"] != "postgresql://history_b" || urls["prod.analytics"] != "postgresql://history_b" {
+		t.Errorf("ClusterHistoryURLs() = %v, want tenants on their cluster's history database", urls)
+	}
+}
+
+func TestHistoryClustersZoneConfigs(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{
+		Clusters: []ClusterConfig{
+			{Name: "Production", ID: "prod", DatabaseURL: "postgresql://prod", Tenants: []string{"app"}, ZoneConfigs: true, ExpectedSettings: map[string]string{"kv.rangefeed.enabled": "true"}},
+			{Name: "Staging", ID: "staging", DatabaseURL: "postgresql://staging"},
+		},
+	}
+
+	clusters := cfg.HistoryClusters()
+	var ids []string
+	for _, c := range clusters {
+		ids = append(ids, c.ID+"/"+c.ZoneConfigsOf)
+	}
+	if want := []string{"prod/", "prod.app/", "prod.zones/prod", "staging/"}; !slices.Equal(ids, want) {
+		t.Fatalf("HistoryClusters() IDs/zone configs of = %v, want %v", ids, want)
+	}
+	if tenant := clusters[1]; tenant.ZoneConfigs {
+		t.Errorf("HistoryClusters()[1] = %+v, want a tenant without zone configs", tenant)
+	}
+	zones := clusters[2]
+	if zones.Name != "Production (zone configs)" || zones.DatabaseURL != "postgresql://prod" || zones.Tenants != nil || zones.ZoneConfigs || zones.ExpectedSettings != nil {
+		t.Errorf("HistoryClusters()[2] = %+v, want a copy of prod for its zone configs", zones)
+	}
+	if !IsValidHistoryID(zones.ID) {
+		t.Errorf("IsValidHistoryID(%q) = false, want true", zones.ID)
+	}
+}
+
+func TestClusterWebhooks(t *testing.T) {
+	t.Parallel()
+	global := Webhook{URL: "https://hooks.example.com/all"}
+	prod := Webhook{URL: "https://hooks.example.com/prod", Variables: "kv.*"}
+	staging := Webhook{URL: "https://hooks.example.com/staging"}
+	cfg := &Config{
+		Webhooks: []Webhook{global},
+		Clusters: []ClusterConfig{
+			{ID: "prod", Webhooks: []Webhook{prod}, Tenants: []string{"app"}},
+			{ID: "staging", Webhooks: []Webhook{staging}, ReplaceWebhooks: true},
+			{ID: "dev"},
+			{ID: "quiet", ReplaceWebhooks: true},
+		},
+	}
+
+	hooks := cfg.ClusterWebhooks()
+	want := map[string][]Webhook{
+		"prod":     {global, prod},
+		"prod.app": {global, prod},
+		"staging":  {staging},
+		"dev":      {global},
+	}
+	if len(hooks) != len(want) {
+		t.Errorf("ClusterWebhooks() = %v, want %v", hooks, want)
+	}
+	for id, w := range want {
+		if !slices.Equal(hooks[id], w) {
+			t.Errorf("ClusterWebhooks()[%s] = %v, want %v", id, hooks[id], w)
+		}
+	}
+}
+
+func TestClusterSnapshotLabel(t *testing.T) {
+	t.Parallel()
+	global := SnapshotLabel{Env: "RELEASE_TAG"}
+	own := SnapshotLabel{Query: "SELECT tag FROM releases"}
+	cfg := &Config{SnapshotLabel: global}
+
+	if got := cfg.ClusterSnapshotLabel(ClusterConfig{ID: "prod"}); got != global {
+		t.Errorf("Without its own label, got %+v, want %+v", got, global)
+	}
+	if got := cfg.ClusterSnapshotLabel(ClusterConfig{ID: "prod", SnapshotLabel: own}); got != own {
+		t.Errorf("With its own label, got %+v, want %+v", got, own)
+	}
+}
+
+func TestCollectionScheduleAllows(t *testing.T) {
+	t.Parallel()
+	// 2025-06-02 is a Monday
+	at := func(day int, clock string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", fmt.Sprintf("2025-06-%02d %s", day, clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		name     string
+		schedule CollectionSchedule
+		at       time.Time
+		want     bool
+	}{
+		{"no windows", CollectionSchedule{}, at(7, "03:00"), true},
+		{"inside business hours", CollectionSchedule{Windows: []string{"mon-fri 09:00-18:00"}}, at(2, "09:00"), true},
+		{"end is exclusive", CollectionSchedule{Windows: []string{"mon-fri 09:00-18:00"}}, at(2, "18:00"), false},
+		{"weekend", CollectionSchedule{Windows: []string{"mon-fri 09:00-18:00"}}, at(7, "12:00"), false},
+		{"second window", CollectionSchedule{Windows: []string{"mon-fri 09:00-18:00", "sat 10:00-12:00"}}, at(7, "11:00"), true},
+		{"every day", CollectionSchedule{Windows: []string{"00:00-24:00"}}, at(8, "23:59"), true},
+		{"past midnight, evening", CollectionSchedule{Windows: []string{"fri 22:00-02:00"}}, at(6, "23:00"), true},
+		{"past midnight, next morning", CollectionSchedule{Windows: []string{"fri 22:00-02:00"}}, at(7, "01:00"), true},
+		{"past midnight, wrong day", CollectionSchedule{Windows: []string{"fri 22:00-02:00"}}, at(6, "01:00"), false},
+		{"range wrapping the week", CollectionSchedule{Windows: []string{"sat-mon 00:00-24:00"}}, at(1, "12:00"), true},
+		{"timezone", CollectionSchedule{Timezone: "America/New_York", Windows: []string{"mon 09:00-10:00"}}, at(2, "13:30"), true},
+	}
+	for _, tt := range tests {
+		if err := tt.schedule.validate(); err != nil {
+			t.Fatalf("%s: invalid schedule: %v", tt.name, err)
+		}
+		if got := tt.schedule.Allows(tt.at); got != tt.want {
+			t.Errorf("%s: Allows(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+
+	for _, window := range []string{"09:00", "mon-fri 9-18", "10:00-10:00", "00:00-25:00", "mon fri 09:00-10:00", "09:60-10:00"} {
+		if err := (CollectionSchedule{Windows: []string{window}}).validate(); err == nil {
+			t.Errorf("Expected window %q to be rejected", window)
+		}
+	}
+}
+
+func TestClusterCollectionSchedule(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{CollectionSchedule: CollectionSchedule{Timezone: "Europe/Paris", Windows: []string{"mon-fri 08:00-20:00"}}}
+
+	if got := cfg.ClusterCollectionSchedule(ClusterConfig{ID: "prod"}); !slices.Equal(got.Windows, cfg.CollectionSchedule.Windows) {
+		t.Errorf("Without its own schedule, got %+v", got)
+	}
+	got := cfg.ClusterCollectionSchedule(ClusterConfig{ID: "prod", CollectionSchedule: CollectionSchedule{Windows: []string{"sat 10:00-12:00"}}})
+	if !slices.Equal(got.Windows, []string{"sat 10:00-12:00"}) || got.Timezone != "Europe/Paris" {
+		t.Errorf("With its own windows, got %+v, want them in the top-level timezone", got)
+	}
+}
+
+func TestIsValidHistoryID(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"prod", true},
+		{"prod.app", true},
+		{"prod_us.analytics-2", true},
+		{"prod.", false},
+		{".app", false},
+		{"prod.App", false},
+		{"prod.-app", false},
+		{"prod.app-", false},
+		{"prod.app.us", false},
+		{"prod/us", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := IsValidHistoryID(tt.id); got != tt.valid {
+				t.Errorf("IsValidHistoryID(%q) = %v, want %v", tt.id, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestIsValidID(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"prod", true},
+		{"staging", true},
+		{"prod-us-east", true},
+		{"prod_us_east", true},
+		{"Prod123", true},
+		{"123", true},
+		{"prod us", false},        // space
+		{"prod.us", false},        // dot
+		{"prod/us", false},        // slash
+		{"prod@us", false},        // at sign
+		{"", false},               // empty
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := IsValidID(tt.id); got != tt.valid {
+				t.Errorf("IsValidID(%q) = %v, want %v", tt.id, got, tt.valid)
+			}
 		})
 	}
 }
@@ -367,6 +1441,98 @@ clusters:
 	}
 }
 
+func TestDurationUnmarshalError(t *testing.T) {
+	t.Parallel()
+	configPath := writeTestConfig(t, `history_database_url: "postgresql://localhost/history"
+poll_interval: 30s
+retention: 30 days
+clusters:
+  - name: "Test"
+    id: "test"
+    database_url: "postgresql://localhost/test"
+`)
+
+	_, err := Load(configPath)
+	var durErr *DurationError
+	if !errors.As(err, &durErr) {
+		t.Fatalf("Expected a DurationError, got %v", err)
+	}
+	if durErr.Path != "retention" || durErr.Line != 3 || durErr.Value != "30 days" {
+		t.Errorf("Unexpected DurationError: %+v", durErr)
+	}
+	if !strings.Contains(err.Error(), `line 3: retention: invalid duration "30 days"`) {
+		t.Errorf("Expected the line and field in the error, got %q", err.Error())
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	t.Parallel()
+	var root yaml.Node
+	doc := `poll_interval: 5m
+clusters:
+  - id: prod
+  - id: staging
+    expected_settings:
+      kv.rangefeed.enabled: "true"
+`
+	if err := yaml.Unmarshal([]byte(doc), &root); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	tests := []struct {
+		line, column int
+		want         string
+	}{
+		{1, 16, "poll_interval"},
+		{4, 9, "clusters[1].id"},
+		{6, 29, "clusters[1].expected_settings.kv.rangefeed.enabled"},
+		{2, 1, ""},
+	}
+	for _, tt := range tests {
+		if got := fieldPath(&root, tt.line, tt.column); got != tt.want {
+			t.Errorf("fieldPath(%d, %d) = %q, want %q", tt.line, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		Clusters: []ClusterConfig{
+			{ID: "prod", DatabaseURL: "postgresql://prod", Color: "red"},
+			{Name: "Staging", ID: "prod", Environment: strings.Repeat("x", 65)},
+		},
+	}
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	want := []string{
+		"history_database_url is required",
+		"cluster[0] (prod): name is required",
+		`cluster[0] (prod): color "red" must be a hex color`,
+		`cluster[1] (prod, "Staging"): database_url is required`,
+		`cluster[1] (prod, "Staging"): environment must be at most`,
+		`cluster[1] (prod, "Staging"): duplicate cluster id: prod (also cluster[0])`,
+		"poll_interval must be at least 1 second",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Errorf("Expected %d problems, got %d: %v", len(want), len(verr.Problems), err)
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, fmt.Sprintf("%d configuration problems:", len(verr.Problems))) {
+		t.Errorf("Expected a problem count heading, got %q", msg)
+	}
+	for _, w := range want {
+		if !strings.Contains(msg, w) {
+			t.Errorf("Expected error to report %q, got:\n%s", w, msg)
+		}
+	}
+}
+
 func TestGetEnvDefault(t *testing.T) {
 	t.Setenv("TEST_GET_ENV", "test_value")
 
@@ -203,6 +203,7 @@ func TestFreshMigrationCompletes(t *testing.T) {
 		"changes",
 		"metadata",
 		"annotations",
+		"subscriptions",
 	}
 	for _, table := range expectedTables {
 		var exists bool
@@ -224,8 +225,8 @@ func TestFreshMigrationCompletes(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to read migration version: %v", err)
 	}
-	if maxVersion != 6 {
-		t.Errorf("Expected migration version 6, got %d", maxVersion)
+	if maxVersion != storage.LatestSchemaVersion() {
+		t.Errorf("Expected migration version %d, got %d", storage.LatestSchemaVersion(), maxVersion)
 	}
 	t.Logf("Migration version: %d", maxVersion)
 }
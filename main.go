@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	_ "embed"
 	"flag"
 	"fmt"
 	"log"
@@ -10,14 +11,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Embed timezone data for TIMESTAMP_TIMEZONE on minimal images
 
 	"crdb-cluster-history/auth"
 	"crdb-cluster-history/cmd"
 	"crdb-cluster-history/collector"
 	"crdb-cluster-history/config"
+	"crdb-cluster-history/metrics"
+	"crdb-cluster-history/notify"
 	"crdb-cluster-history/storage"
 	"crdb-cluster-history/web"
 )
@@ -25,6 +30,11 @@ import (
 // Version is set at build time via -ldflags
 var Version = "dev"
 
+// sampleConfig is the commented example configuration written by gen-config.
+//
+//go:embed clusters.yaml.example
+var sampleConfig []byte
+
 func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
@@ -34,6 +44,24 @@ func main() {
 		case "export":
 			runExport()
 			return
+		case "tail":
+			runTail()
+			return
+		case "gen-config":
+			runGenConfig()
+			return
+		case "compact":
+			runCompact()
+			return
+		case "verify":
+			runVerify()
+			return
+		case "backup":
+			runBackup()
+			return
+		case "restore":
+			runRestore()
+			return
 		case "-h", "--help", "help":
 			usage()
 			return
@@ -56,6 +84,11 @@ func runExport() {
 	clusterID := fs.String("cluster", "", "Cluster ID to export")
 	fs.StringVar(clusterID, "c", "", "Cluster ID to export (shorthand)")
 	fs.BoolVar(exportAll, "a", false, "Export all clusters (shorthand)")
+	incremental := fs.Bool("incremental", false, "Only export changes since the last incremental export")
+	incrementalLag := fs.Duration("incremental-lag", cmd.DefaultIncrementalLag, "Leave changes detected this recently to the next incremental export")
+	reproducible := fs.Bool("reproducible", false, "Produce byte-identical archives for identical data")
+	summary := fs.Bool("summary", false, "Add a summary CSV of each cluster's exported changes")
+	format := fs.String("format", "csv", "Format of the changes files: csv or json")
 	fs.Parse(os.Args[2:])
 
 	historyURL := os.Getenv("HISTORY_DATABASE_URL")
@@ -69,10 +102,18 @@ func runExport() {
 	defer cancel()
 
 	cfg := cmd.ExportConfig{
-		HistoryURL: historyURL,
-		OutputPath: outputPath,
-		ClusterID:  *clusterID,
-		ExportAll:  *exportAll,
+		HistoryURL:      historyURL,
+		OutputPath:      outputPath,
+		ClusterID:       commandClusterID(*clusterID, *exportAll),
+		ExportAll:       *exportAll,
+		TimestampFormat: setupTimestampFormat(),
+		Incremental:     *incremental,
+		IncrementalLag:  *incrementalLag,
+		Reproducible:    *reproducible,
+		Summary:         *summary,
+		Format:          *format,
+		TablePrefix:     os.Getenv("TABLE_PREFIX"),
+		Redactor:        setupRedactor(),
 	}
 
 	if err := cmd.RunExport(ctx, cfg); err != nil {
@@ -80,6 +121,180 @@ func runExport() {
 	}
 }
 
+func runTail() {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	all := fs.Bool("all", false, "Follow all clusters")
+	clusterID := fs.String("cluster", "", "Cluster ID to follow")
+	fs.StringVar(clusterID, "c", "", "Cluster ID to follow (shorthand)")
+	fs.BoolVar(all, "a", false, "Follow all clusters (shorthand)")
+	interval := fs.Duration("interval", cmd.DefaultTailInterval, "How often to poll for new changes")
+	fs.Parse(os.Args[2:])
+
+	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	if historyURL == "" {
+		log.Fatal("HISTORY_DATABASE_URL environment variable is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg := cmd.TailConfig{
+		HistoryURL:      historyURL,
+		ClusterID:       commandClusterID(*clusterID, *all),
+		All:             *all,
+		Interval:        *interval,
+		TimestampFormat: setupTimestampFormat(),
+		TablePrefix:     os.Getenv("TABLE_PREFIX"),
+	}
+
+	if err := cmd.RunTail(ctx, cfg); err != nil {
+		log.Fatalf("Tail failed: %v", err)
+	}
+}
+
+func runCompact() {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	all := fs.Bool("all", false, "Compact all clusters")
+	clusterID := fs.String("cluster", "", "Cluster ID to compact")
+	fs.StringVar(clusterID, "c", "", "Cluster ID to compact (shorthand)")
+	fs.BoolVar(all, "a", false, "Compact all clusters (shorthand)")
+	window := fs.Duration("window", 0, "Collapse changes that return a setting to an earlier value within this long")
+	fs.Parse(os.Args[2:])
+
+	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	if historyURL == "" {
+		log.Fatal("HISTORY_DATABASE_URL environment variable is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cfg := cmd.CompactConfig{
+		HistoryURL:  historyURL,
+		ClusterID:   commandClusterID(*clusterID, *all),
+		All:         *all,
+		Window:      *window,
+		TablePrefix: os.Getenv("TABLE_PREFIX"),
+	}
+
+	if err := cmd.RunCompact(ctx, cfg); err != nil {
+		log.Fatalf("Compaction failed: %v", err)
+	}
+}
+
+func runVerify() {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Delete orphan settings and annotations")
+	fs.Parse(os.Args[2:])
+
+	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	if historyURL == "" {
+		log.Fatal("HISTORY_DATABASE_URL environment variable is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cfg := cmd.VerifyConfig{
+		HistoryURL:  historyURL,
+		Repair:      *repair,
+		TablePrefix: os.Getenv("TABLE_PREFIX"),
+	}
+
+	if err := cmd.RunVerify(ctx, cfg); err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+}
+
+func runBackup() {
+	outputPath, err := cmd.ParseBackupArgs(os.Args[2:])
+	if err != nil {
+		log.Fatalf("Invalid backup arguments: %v", err)
+	}
+
+	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	if historyURL == "" {
+		log.Fatal("HISTORY_DATABASE_URL environment variable is required")
+	}
+
+	// Copying a whole history can take longer than the other commands
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	cfg := cmd.BackupConfig{
+		HistoryURL:  historyURL,
+		OutputPath:  outputPath,
+		TablePrefix: os.Getenv("TABLE_PREFIX"),
+	}
+
+	if err := cmd.RunBackup(ctx, cfg); err != nil {
+		log.Fatalf("Backup failed: %v", err)
+	}
+}
+
+func runRestore() {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Parse(os.Args[2:])
+
+	historyURL := os.Getenv("HISTORY_DATABASE_URL")
+	if historyURL == "" {
+		log.Fatal("HISTORY_DATABASE_URL environment variable is required")
+	}
+	if fs.Arg(0) == "" {
+		log.Fatal("restore requires the path of a backup archive")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	cfg := cmd.RestoreConfig{
+		HistoryURL:  historyURL,
+		InputPath:   fs.Arg(0),
+		TablePrefix: os.Getenv("TABLE_PREFIX"),
+	}
+
+	if err := cmd.RunRestore(ctx, cfg); err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+}
+
+func runGenConfig() {
+	fs := flag.NewFlagSet("gen-config", flag.ExitOnError)
+	force := fs.Bool("force", false, "Overwrite the output file if it exists")
+	fs.Parse(os.Args[2:])
+
+	cfg := cmd.GenConfigConfig{
+		Sample:     sampleConfig,
+		OutputPath: fs.Arg(0), // first non-flag argument
+		Force:      *force,
+	}
+	if err := cmd.RunGenConfig(cfg); err != nil {
+		log.Fatalf("gen-config failed: %v", err)
+	}
+}
+
+// commandClusterID returns the cluster export or tail targets. When neither
+// --cluster nor --all is given this is the first cluster of the configuration file,
+// the same default as the web UI, or "default" in single-cluster (environment) mode.
+func commandClusterID(flagValue string, all bool) string {
+	if flagValue != "" || all {
+		return flagValue
+	}
+	if os.Getenv("CLUSTERS_CONFIG") == "" && os.Getenv("CLUSTERS_CONFIG_DIR") == "" {
+		if _, err := os.Stat("clusters.yaml"); err != nil {
+			return cmd.DefaultClusterID
+		}
+	}
+	cfg, err := config.LoadAuto()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if len(cfg.Clusters) == 0 {
+		log.Fatal("Configuration has no clusters; use --cluster to choose one")
+	}
+	return cfg.Clusters[0].ID
+}
+
 func runInit() {
 	adminURL := os.Getenv("DATABASE_URL")
 	if adminURL == "" {
@@ -100,6 +315,7 @@ func runInit() {
 		Username:       username,
 		Password:       password,
 		SourceUsername: sourceUsername,
+		TablePrefix:    os.Getenv("TABLE_PREFIX"),
 	}
 
 	if err := cmd.RunInit(ctx, cfg); err != nil {
@@ -115,49 +331,196 @@ func runServer() {
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	if err := cfg.CheckConnectionSecurity(); err != nil {
+		log.Fatalf("Insecure database connection: %v", err)
+	}
+	if cfg.ApplicationName == "" {
+		cfg.ApplicationName = "crdb-cluster-history/" + Version
+	}
 	logClusterConfig(cfg)
+	changeLink, err := web.ParseChangeLinkTemplate(cfg.ChangeLinkTemplate)
+	if err != nil {
+		log.Fatalf("Invalid configuration: change_link_template: %v", err)
+	}
 
 	tlsEnabled := getEnvBool("TLS_ENABLED", false)
 	authCfg := setupAuth(tlsEnabled)
 	rateLimiter := setupRateLimiter()
 	redactor := setupRedactor()
+	timeFormat := setupTimestampFormat()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	rateLimiter.StartCleanup(ctx)
 
-	store, err := storage.New(ctx, cfg.HistoryDatabaseURL)
+	store, err := openStore(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
 
+	clusterStores, closeClusterStores, err := openClusterStores(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer closeClusterStores()
+
+	registry := metrics.NewRegistry()
+	dispatcher := setupDispatcher(store, redactor).WithChannels(webhookChannels(cfg))
+	// Deliveries outlive ctx so the final collection's notifications can be
+	// flushed after the collectors stop.
+	notifyCtx, stopNotify := context.WithCancel(context.Background())
+	defer stopNotify()
+	notifyDone := make(chan struct{})
+	go func() {
+		dispatcher.Run(notifyCtx)
+		close(notifyDone)
+	}()
+	notifier := collector.Notifiers{dispatcher, registry}
+	// Collections that detect changes drop the cluster's cached snapshot
+	var snapshotCache *web.SnapshotCache
+	if ttl := config.ParseDurationEnv("SNAPSHOT_CACHE_TTL", web.DefaultSnapshotCacheTTL); ttl > 0 {
+		snapshotCache = web.NewSnapshotCache(ttl)
+		notifier = append(notifier, snapshotCache)
+	}
+	manager, collectorsDone := startCollectors(ctx, cfg, store, clusterStores, notifier)
+	startIntegrityChecks(ctx, cfg, store, clusterStores)
+
 	webServer, err := web.New(store,
 		web.WithRedactor(redactor),
-		web.WithClusters(cfg.Clusters),
+		web.WithClusters(cfg.HistoryClusters()),
 		web.WithDefaultClusterID(cfg.Clusters[0].ID),
 		web.WithAuthConfig(authCfg),
+		web.WithExpectedDifferences(cfg.ExpectedDifferences),
+		web.WithFilterPresets(cfg.FilterPresets),
+		web.WithPageLimits(cfg.PageLimits),
+		web.WithCollectors(manager),
+		web.WithTimestampFormat(timeFormat),
+		web.WithMetrics(registry),
+		web.WithVersion(Version),
+		web.WithLandingPage(cfg.LandingPage),
+		web.WithClusterStores(webStores(clusterStores)),
+		web.WithPollInterval(cfg.PollInterval.Duration()),
+		web.WithRecentWindow(config.ParseDurationEnv("RECENT_CHANGE_WINDOW", web.DefaultRecentWindow)),
+		web.WithChangeLinkTemplate(changeLink),
+		web.WithSnapshotCache(snapshotCache),
+		web.WithServedByHeader(getEnvBool("SERVED_BY_HEADER", false)),
+		web.WithGraphQL(getEnvBool("GRAPHQL_ENABLED", false)),
+		web.WithMaxConcurrentExports(getEnvInt("EXPORT_MAX_CONCURRENT", web.DefaultMaxConcurrentExports)),
 	)
 	if err != nil {
 		log.Fatalf("Failed to initialize web server: %v", err)
 	}
 
-	startCollectors(ctx, cfg, store)
-
 	tlsCertFile := os.Getenv("TLS_CERT_FILE")
 	tlsKeyFile := os.Getenv("TLS_KEY_FILE")
-	handler := setupMiddleware(webServer.Handler(), authCfg, rateLimiter, tlsEnabled)
+	handler := setupMiddleware(webServer.Handler(), webServer.ServedBy, authCfg, rateLimiter, tlsEnabled)
 	server := newHTTPServer(cfg.HTTPPort, handler, tlsEnabled, tlsCertFile, tlsKeyFile)
 
 	go startServer(server, tlsEnabled, cfg.HTTPPort, tlsCertFile, tlsKeyFile)
 	awaitShutdown(server, cancel)
+	flushNotifications(collectorsDone, dispatcher, stopNotify, notifyDone)
+}
+
+// historyStore is the storage backend used by the server.
+type historyStore interface {
+	web.Store
+	collector.Store
+	VerifyIntegrity(ctx context.Context, repair bool) (storage.IntegrityReport, error)
+	Close()
+}
+
+// openStore opens the history database, or the file store when data_dir is configured.
+func openStore(ctx context.Context, cfg *config.Config) (historyStore, error) {
+	if cfg.DataDir != "" {
+		slog.Info("Using file storage", "dir", cfg.DataDir)
+		store, err := storage.NewFileStore(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		return store.WithDiffOptions(diffOptions(cfg)), nil
+	}
+	return storage.New(ctx, cfg.HistoryDatabaseURL, storeOptions(cfg)...)
+}
+
+// storeOptions configures a history database store from cfg.
+func storeOptions(cfg *config.Config) []storage.Option {
+	return []storage.Option{
+		storage.WithTablePrefix(cfg.TablePrefix),
+		storage.WithTLSMinVersion(cfg.TLSMinVersion()),
+		storage.WithApplicationName(cfg.ApplicationName),
+		storage.WithDiffOptions(diffOptions(cfg)),
+	}
+}
+
+// diffOptions returns how collected values are compared for change detection.
+func diffOptions(cfg *config.Config) storage.DiffOptions {
+	return storage.DiffOptions{CaseInsensitive: cfg.CaseInsensitiveValues}
+}
+
+// webhookChannels turns each cluster's configured webhooks into the fixed
+// notification channels of the dispatcher.
+func webhookChannels(cfg *config.Config) map[string][]storage.Subscription {
+	channels := make(map[string][]storage.Subscription)
+	for clusterID, hooks := range cfg.ClusterWebhooks() {
+		for _, hook := range hooks {
+			pattern := hook.Variables
+			if pattern == "" {
+				pattern = "*"
+			}
+			channels[clusterID] = append(channels[clusterID], storage.Subscription{
+				ClusterID:       clusterID,
+				VariablePattern: pattern,
+				TargetURL:       hook.URL,
+				CreatedBy:       "config",
+			})
+		}
+	}
+	return channels
+}
+
+// openClusterStores opens the history databases of clusters configured with
+// their own history_database_url, one store per distinct URL, keyed by cluster.
+// The returned function closes them.
+func openClusterStores(ctx context.Context, cfg *config.Config) (map[string]historyStore, func(), error) {
+	stores := make(map[string]historyStore)
+	byURL := make(map[string]historyStore)
+	closeAll := func() {
+		for _, store := range byURL {
+			store.Close()
+		}
+	}
+	for clusterID, url := range cfg.ClusterHistoryURLs() {
+		store, ok := byURL[url]
+		if !ok {
+			slog.Info("Using separate history database", "cluster", clusterID)
+			opened, err := storage.New(ctx, url, storeOptions(cfg)...)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("history database for cluster %s: %w", clusterID, err)
+			}
+			store = opened
+			byURL[url] = store
+		}
+		stores[clusterID] = store
+	}
+	return stores, closeAll, nil
+}
+
+// webStores converts per-cluster stores for web.WithClusterStores.
+func webStores(stores map[string]historyStore) map[string]web.Store {
+	converted := make(map[string]web.Store, len(stores))
+	for id, store := range stores {
+		converted[id] = store
+	}
+	return converted
 }
 
 func logClusterConfig(cfg *config.Config) {
 	if len(cfg.Clusters) > 1 {
 		slog.Info("Multi-cluster mode", "clusters", len(cfg.Clusters))
 		for _, c := range cfg.Clusters {
-			slog.Info("Cluster configured", "name", c.Name, "id", c.ID)
+			slog.Info("Cluster configured", "name", c.Name, "id", c.ID, "tenants", c.Tenants)
 		}
 	} else {
 		slog.Info("Single-cluster mode", "cluster", cfg.Clusters[0].ID)
@@ -188,12 +551,55 @@ func setupAuth(tlsEnabled bool) auth.Config {
 		}
 		authCfg.PasswordHash = hash
 		authCfg.Session = auth.NewSessionConfig(tlsEnabled)
-		slog.Info("Authentication enabled", "user", authCfg.Username)
+		authCfg.JWT = setupJWT()
+		slog.Info("Authentication enabled", "user", authCfg.Username, "bearer_tokens", authCfg.JWT != nil)
 	}
 
 	return authCfg
 }
 
+// setupJWT configures bearer token authentication when a JWKS URL or public key
+// file is set, or returns nil.
+func setupJWT() *auth.JWTConfig {
+	jwksURL := os.Getenv("AUTH_JWT_JWKS_URL")
+	keyFile := os.Getenv("AUTH_JWT_PUBLIC_KEY_FILE")
+	if jwksURL == "" && keyFile == "" {
+		return nil
+	}
+	if jwksURL != "" && keyFile != "" {
+		log.Fatal("Set only one of AUTH_JWT_JWKS_URL and AUTH_JWT_PUBLIC_KEY_FILE")
+	}
+
+	jwtCfg := &auth.JWTConfig{
+		Issuer:        os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:      os.Getenv("AUTH_JWT_AUDIENCE"),
+		UsernameClaim: config.GetEnvDefault("AUTH_JWT_USERNAME_CLAIM", auth.DefaultUsernameClaim),
+		RoleClaim:     os.Getenv("AUTH_JWT_ROLE_CLAIM"),
+		AllowedRoles:  auth.ParseAPIKeys(os.Getenv("AUTH_JWT_ALLOWED_ROLES")),
+	}
+	if jwtCfg.Issuer == "" || jwtCfg.Audience == "" {
+		log.Fatal("AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE are required for bearer token authentication")
+	}
+	if len(jwtCfg.AllowedRoles) > 0 && jwtCfg.RoleClaim == "" {
+		log.Fatal("AUTH_JWT_ALLOWED_ROLES requires AUTH_JWT_ROLE_CLAIM")
+	}
+
+	if jwksURL != "" {
+		jwtCfg.Keys = auth.NewJWKS(jwksURL)
+	} else {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			log.Fatalf("Failed to read AUTH_JWT_PUBLIC_KEY_FILE: %v", err)
+		}
+		key, err := auth.ParsePublicKeyPEM(data)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_JWT_PUBLIC_KEY_FILE: %v", err)
+		}
+		jwtCfg.Keys = auth.NewStaticKey(key)
+	}
+	return jwtCfg
+}
+
 func setupRateLimiter() *web.RateLimiter {
 	enabled := getEnvBool("RATE_LIMIT_ENABLED", false)
 	rps := getEnvFloat("RATE_LIMIT_RPS", 10)
@@ -214,6 +620,7 @@ func setupRedactor() *storage.Redactor {
 	redactCfg := storage.RedactorConfig{
 		Enabled:            getEnvBool("REDACT_SENSITIVE", false),
 		AdditionalPatterns: os.Getenv("REDACT_PATTERNS"),
+		Descriptions:       getEnvBool("REDACT_DESCRIPTIONS", false),
 	}
 	redactor := storage.NewRedactor(redactCfg)
 	if redactCfg.Enabled {
@@ -222,38 +629,110 @@ func setupRedactor() *storage.Redactor {
 	return redactor
 }
 
-func startCollectors(ctx context.Context, cfg *config.Config, store *storage.Store) {
-	if len(cfg.Clusters) > 1 {
-		manager, err := collector.NewManager(ctx, cfg, store)
-		if err != nil {
-			log.Fatalf("Failed to initialize collector manager: %v", err)
-		}
-		go func() {
-			<-ctx.Done()
-			manager.Close()
-		}()
-		go manager.Start(ctx)
-	} else {
-		cluster := cfg.Clusters[0]
-		coll, err := collector.New(ctx, cluster.ID, cluster.DatabaseURL, store, cfg.PollInterval.Duration())
+// setupDispatcher creates the webhook dispatcher with a retrying delivery queue,
+// so a briefly unavailable receiver doesn't lose notifications or block collection.
+func setupDispatcher(store notify.SubscriptionLister, redactor *storage.Redactor) *notify.Dispatcher {
+	queueCfg := notify.QueueConfig{
+		Size:           getEnvInt("NOTIFY_QUEUE_SIZE", notify.DefaultQueueSize),
+		MaxAttempts:    getEnvInt("NOTIFY_MAX_ATTEMPTS", notify.DefaultMaxAttempts),
+		InitialBackoff: config.ParseDurationEnv("NOTIFY_RETRY_BACKOFF", notify.DefaultInitialBackoff),
+		MaxBackoff:     config.ParseDurationEnv("NOTIFY_MAX_BACKOFF", notify.DefaultMaxBackoff),
+		Timeout:        config.ParseDurationEnv("NOTIFY_TIMEOUT", notify.DefaultTimeout),
+	}
+	if path := os.Getenv("NOTIFY_DEAD_LETTER_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
 		if err != nil {
-			log.Fatalf("Failed to initialize collector: %v", err)
+			log.Fatalf("Failed to open notification dead-letter file: %v", err)
 		}
-		if cfg.Retention.Duration() > 0 {
-			coll.WithRetention(cfg.Retention.Duration())
-			slog.Info("Data retention configured", "retention", cfg.Retention.Duration())
+		queueCfg.DeadLetter = f
+		slog.Info("Notification dead-letter log enabled", "path", path)
+	}
+	return notify.NewDispatcher(store, redactor).WithQueue(queueCfg)
+}
+
+func setupTimestampFormat() storage.TimestampFormat {
+	timezone := os.Getenv("TIMESTAMP_TIMEZONE")
+	precision := os.Getenv("TIMESTAMP_PRECISION")
+	f, err := storage.ParseTimestampFormat(timezone, precision)
+	if err != nil {
+		log.Fatalf("Invalid timestamp format: %v", err)
+	}
+	if timezone != "" || precision != "" {
+		slog.Info("Timestamp format configured", "timezone", timezone, "precision", precision)
+	}
+	return f
+}
+
+// startCollectors starts collecting every configured cluster until ctx is
+// cancelled. The returned channel is closed once collection has stopped.
+func startCollectors(ctx context.Context, cfg *config.Config, store collector.Store, clusterStores map[string]historyStore, notifier collector.Notifier) (*collector.Manager, <-chan struct{}) {
+	manager, err := collector.NewManager(ctx, cfg, store)
+	if err != nil {
+		log.Fatalf("Failed to initialize collector manager: %v", err)
+	}
+	manager.WithNotifier(notifier)
+	collectorStores := make(map[string]collector.Store, len(clusterStores))
+	for id, s := range clusterStores {
+		collectorStores[id] = s
+	}
+	manager.WithClusterStores(collectorStores)
+	if cfg.Retention.Duration() > 0 {
+		slog.Info("Data retention configured", "retention", cfg.Retention.Duration())
+	}
+	done := make(chan struct{})
+	go func() {
+		manager.Start(ctx)
+		manager.Close()
+		close(done)
+	}()
+	return manager, done
+}
+
+// startIntegrityChecks checks each history store for orphan rows every
+// integrity_check_interval until ctx is done, logging what it finds.
+func startIntegrityChecks(ctx context.Context, cfg *config.Config, store historyStore, clusterStores map[string]historyStore) {
+	interval := cfg.IntegrityCheckInterval.Duration()
+	if interval <= 0 {
+		return
+	}
+	stores := []historyStore{store}
+	for _, s := range clusterStores {
+		if !slices.Contains(stores, s) {
+			stores = append(stores, s)
 		}
-		go func() {
-			<-ctx.Done()
-			coll.Close()
-		}()
-		go coll.Start(ctx)
 	}
+	slog.Info("History integrity checks enabled", "interval", interval, "repair", cfg.IntegrityRepair)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, s := range stores {
+				report, err := s.VerifyIntegrity(ctx, cfg.IntegrityRepair)
+				if err != nil {
+					slog.Error("History integrity check failed", "error", err)
+					continue
+				}
+				if report.Problems() > 0 {
+					slog.Warn("History integrity problems found",
+						"orphan_settings", report.OrphanSettings,
+						"orphan_annotations", report.OrphanAnnotations,
+						"orphan_change_clusters", report.OrphanChangeClusters(),
+						"repaired", report.Repaired)
+				}
+			}
+		}
+	}()
 }
 
-func setupMiddleware(handler http.Handler, authCfg auth.Config, rateLimiter *web.RateLimiter, tlsEnabled bool) http.Handler {
+func setupMiddleware(handler http.Handler, servedBy func(http.Handler) http.Handler, authCfg auth.Config, rateLimiter *web.RateLimiter, tlsEnabled bool) http.Handler {
 	return web.ChainMiddleware(
 		handler,
+		servedBy, // outermost, so rejected requests carry it too
 		auth.Middleware(authCfg),
 		rateLimiter.Middleware,
 		web.SecurityHeaders(tlsEnabled),
@@ -316,38 +795,133 @@ func awaitShutdown(server *http.Server, cancel context.CancelFunc) {
 	server.Shutdown(shutdownCtx)
 }
 
+// flushNotifications waits for in-flight collections to finish, stops the
+// delivery workers, and delivers the notifications still queued. Everything
+// is bounded by NOTIFY_DRAIN_TIMEOUT; deliveries not made in time go to the
+// dead-letter log.
+func flushNotifications(collectorsDone <-chan struct{}, dispatcher *notify.Dispatcher, stopNotify context.CancelFunc, notifyDone <-chan struct{}) {
+	grace := config.ParseDurationEnv("NOTIFY_DRAIN_TIMEOUT", notify.DefaultDrainTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	select {
+	case <-collectorsDone:
+	case <-ctx.Done():
+		slog.Warn("Collection still running at shutdown, not waiting for it", "timeout", grace)
+	}
+	stopNotify()
+	<-notifyDone
+	dispatcher.Drain(ctx)
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, `Usage: %s [command]
 
 Commands:
   init           Initialize the history database and user
   export [path]  Export changes to a zipped CSV file (includes cluster_id)
+  tail           Print changes as they are detected (Ctrl-C to stop)
+  gen-config [path]  Write a commented example clusters.yaml (to stdout without path)
+  compact        Collapse changes that a setting later reverted (requires --window)
+  verify         Check the history database for orphan rows
+  backup [path]  Write the whole history database to a zip archive
+  restore <path> Load a backup archive into an empty history database
   (none)         Run the cluster history server
 
 Export Flags:
   --all, -a              Export all clusters
-  --cluster, -c ID       Cluster ID to export
+  --cluster, -c ID       Cluster ID to export (default: first configured cluster,
+                         or "default" in single-cluster mode)
+  --incremental          Only export changes since the last incremental export
+  --incremental-lag DUR  Stop an incremental export at the first change detected
+                         this recently, left for the next one (default: 1m)
+  --reproducible         Fixed zip timestamps and a content-hash default filename
+  --summary              Add a summary CSV (totals, time range, counts per kind)
+  --format FORMAT        Changes files as csv (default) or json: an array of
+                         objects with the CSV's columns
+
+Tail Flags:
+  --all, -a              Follow all clusters
+  --cluster, -c ID       Cluster ID to follow (default: as for export)
+  --interval DURATION    Poll interval (default: 2s)
+
+Compact Flags:
+  --all, -a              Compact all clusters
+  --cluster, -c ID       Cluster ID to compact (default: as for export)
+  --window DURATION      Collapse changes that return a setting to an earlier
+                         value within this long
+
+Verify Flags:
+  --repair               Delete orphan settings and annotations (orphan changes
+                         are only reported)
+
+Gen-config Flags:
+  --force                Overwrite path if it already exists
 
 Configuration:
   The server can be configured via a YAML file or environment variables.
   Configuration is loaded in this order:
   1. CLUSTERS_CONFIG env var (path to YAML config file)
-  2. clusters.yaml in current directory
-  3. Environment variables (single-cluster mode)
+  2. CLUSTERS_CONFIG_DIR env var (directory of YAML files; globals in base.yaml)
+  3. clusters.yaml in current directory
+  4. Environment variables (single-cluster mode)
 
 Environment Variables:
   DATABASE_URL          CockroachDB connection string (required)
   HISTORY_DATABASE_URL  Connection to history database (required for server/export)
+  DATA_DIR              Store history as flat files in this directory instead (server only)
+  TABLE_PREFIX          Prefix for history table names (default: none)
   SOURCE_USERNAME       Source cluster monitoring user (init only, optional; grants VIEWCLUSTERMETADATA)
   POLL_INTERVAL         Collection interval (default: 15m)
   RETENTION             Data retention period, e.g., 720h for 30 days (default: unlimited)
+  CASE_INSENSITIVE_VALUES    Variable globs whose values compare case-insensitively (comma-separated)
+  KEEP_CHANGES_PER_VARIABLE  Keep each variable's latest N changes past retention (default: 0)
+  COMPACT_REVERTS_WINDOW     Collapse changes that return a setting to an earlier value within this long (default: 0, disabled)
+  COMPACT_REVERTS_INTERVAL   How often revert compaction runs (default: 24h)
+  INTEGRITY_CHECK_INTERVAL   How often to check the history for orphan rows (default: 0, disabled)
+  INTEGRITY_REPAIR           Delete orphan settings and annotations the check finds (default: false)
+  SKIP_FAILED_CLUSTERS  Start without clusters that can't be reached at startup, retrying them (default: false)
+  FAILED_CLUSTER_RETRY  How often skipped clusters are retried (default: 1m)
+  MAX_CLUSTERS          Most clusters collected, counting tenants and zone configs (default: 100)
+  SOURCE_IDLE_TIMEOUT   Close source connections unused this long (default: 30m)
+  APPLICATION_NAME      application_name of database connections (default: crdb-cluster-history/<version>)
+  COLLECTION_WINDOWS    Only collect within these windows, e.g. "mon-fri 09:00-18:00" (comma-separated)
+  COLLECTION_TIMEZONE   Timezone of COLLECTION_WINDOWS (default: UTC)
+  SNAPSHOT_LABEL_ENV    Label each snapshot with this environment variable's value (optional)
+  SNAPSHOT_LABEL_QUERY  Label each snapshot with the result of this SELECT on the source (optional)
+  SELF_MONITORING       Source cluster holding the history database: warn or allow (default: warn)
+  SELF_MONITORING_EXCLUDE    Variable globs left out when the source holds the history database (comma-separated)
+  REMOVAL_GRACE         Collections a setting must be missing before it is recorded as removed (default: 1)
+  MAX_VALUE_LENGTH      Store setting values longer than this many bytes truncated (default: 0, no limit)
+  STORE_RAW_OUTPUT      Keep each collection query's complete output for forensics (default: false)
+  MIN_SETTINGS          Refuse to save collections with fewer settings (default: 0; empty is always refused)
+  MAX_SETTINGS_DROP     Refuse to save collections this many percent smaller than the last (default: 0, disabled)
+  ANCHOR_SETTING        Refuse collections missing this setting when the last snapshot had it (default: version, none disables)
   HTTP_PORT             Web server port (default: 8080)
+  LANDING_PAGE          Page / redirects to: /, /compare, or /history (default: /)
+  SNAPSHOT_CACHE_TTL    Reuse each cluster's latest snapshot this long between requests (default: 10s, 0 disables)
+  RECENT_CHANGE_WINDOW  Highlight changes detected within this long as new on the dashboard (default: 24h, 0 disables)
+  CHANGE_LINK_TEMPLATE  URL linked from each change; {cluster}, {variable}, {detected_at}, {detected_at_ms} are substituted
+  SERVED_BY_HEADER      Set X-Served-By with the version, host, cluster and store on responses (default: false)
+  EXPORT_MAX_CONCURRENT Most /export requests served at once; others get 429 (default: 2)
+  GRAPHQL_ENABLED       Serve a GraphQL API at /graphql (default: false)
+  PAGE_SIZE             Changes shown on the dashboard and returned without limit= (default: 100)
+  MAX_CHANGES_LIMIT     Largest limit= accepted for changes and annotations (default: 1000)
+  SNAPSHOT_PAGE_SIZE    Snapshots listed without limit= (default: 100)
+  MAX_SNAPSHOTS_LIMIT   Largest limit= accepted for snapshots (default: 1000)
 
 Security:
   AUTH_ENABLED          Enable authentication (default: false)
   AUTH_USERNAME          Username for Basic Auth (default: admin)
   AUTH_PASSWORD          Password for Basic Auth (required if AUTH_ENABLED=true)
   AUTH_API_KEYS          Comma-separated API keys
+  AUTH_JWT_JWKS_URL      JWKS URL of an OIDC provider; enables Authorization: Bearer JWTs
+  AUTH_JWT_PUBLIC_KEY_FILE  PEM public key verifying JWTs (instead of AUTH_JWT_JWKS_URL)
+  AUTH_JWT_ISSUER        Required JWT issuer (iss)
+  AUTH_JWT_AUDIENCE      Required JWT audience (aud)
+  AUTH_JWT_USERNAME_CLAIM  Claim used as the username (default: sub)
+  AUTH_JWT_ROLE_CLAIM    Claim holding the user's roles
+  AUTH_JWT_ALLOWED_ROLES Comma-separated roles allowed in (default: any)
   TLS_ENABLED           Enable HTTPS (default: false)
   TLS_CERT_FILE         Path to TLS certificate file
   TLS_KEY_FILE          Path to TLS private key file
@@ -356,6 +930,9 @@ Security:
   RATE_LIMIT_BURST      Burst capacity (default: 20)
   REDACT_SENSITIVE      Redact sensitive values (default: false)
   REDACT_PATTERNS       Additional patterns to redact (comma-separated)
+  REDACT_DESCRIPTIONS   Also redact descriptions of sensitive settings (default: false)
+  ALLOW_INSECURE_CONNECTIONS  Allow database URLs with sslmode=disable, allow, or prefer (default: false)
+  DATABASE_TLS_MIN_VERSION    Minimum TLS version for database connections: 1.2 or 1.3 (default: 1.2)
 `, os.Args[0])
 }
 
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"crdb-cluster-history/cmd"
+	"crdb-cluster-history/config"
 )
 
 func TestListenAddress(t *testing.T) {
@@ -110,3 +116,53 @@ func TestGetEnvInt(t *testing.T) {
 		})
 	}
 }
+
+func TestSampleConfigLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	if err := cmd.RunGenConfig(cmd.GenConfigConfig{Sample: sampleConfig, OutputPath: path}); err != nil {
+		t.Fatalf("RunGenConfig failed: %v", err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Generated config does not load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Generated config is invalid: %v", err)
+	}
+	if err := cfg.CheckConnectionSecurity(); err != nil {
+		t.Errorf("Generated config fails the connection security check: %v", err)
+	}
+	if len(cfg.Clusters) == 0 {
+		t.Error("Generated config has no clusters")
+	}
+}
+
+// TestSampleConfigCoversEveryField keeps the example in step with the config
+// structs: every YAML key must appear in it, set or commented out.
+func TestSampleConfigCoversEveryField(t *testing.T) {
+	sample := string(sampleConfig)
+	seen := make(map[reflect.Type]bool)
+	var check func(typ reflect.Type)
+	check = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map || typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] {
+			return
+		}
+		seen[typ] = true
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if key == "" || key == "-" {
+				continue
+			}
+			if !strings.Contains(sample, key+":") {
+				t.Errorf("clusters.yaml.example does not mention %s (%s.%s)", key, typ.Name(), field.Name)
+			}
+			check(field.Type)
+		}
+	}
+	check(reflect.TypeFor[config.Config]())
+}
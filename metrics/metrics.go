@@ -0,0 +1,95 @@
+// Package metrics exposes collection statistics in the Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"crdb-cluster-history/storage"
+)
+
+// ChangesMetric is the name of the counter of detected setting changes.
+const ChangesMetric = "crdb_cluster_history_setting_changes_total"
+
+// changeKey identifies one series of the changes counter.
+type changeKey struct {
+	cluster  string
+	category string
+}
+
+// Registry counts detected changes by cluster and variable category.
+// It implements collector.Notifier to receive changes and http.Handler to expose them.
+type Registry struct {
+	mu      sync.Mutex
+	changes map[changeKey]uint64
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{changes: make(map[changeKey]uint64)}
+}
+
+// Category returns the coarse category of a variable: its first dot-separated
+// segment (e.g. "kv" for kv.rangefeed.enabled). Using only the top-level prefix
+// keeps the number of label values small.
+func Category(variable string) string {
+	category, _, _ := strings.Cut(variable, ".")
+	return category
+}
+
+// Notify counts the changes detected for a cluster.
+func (r *Registry) Notify(ctx context.Context, clusterID string, changes []storage.Change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range changes {
+		r.changes[changeKey{cluster: clusterID, category: Category(c.Variable)}]++
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text format, with series sorted
+// by cluster and category.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Setting changes detected, by cluster and variable category.\n", ChangesMetric)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", ChangesMetric)
+
+	r.mu.Lock()
+	keys := make([]changeKey, 0, len(r.changes))
+	for k := range r.changes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].cluster != keys[j].cluster {
+			return keys[i].cluster < keys[j].cluster
+		}
+		return keys[i].category < keys[j].category
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s{cluster=\"%s\",category=\"%s\"} %d\n", ChangesMetric, escapeLabel(k.cluster), escapeLabel(k.category), r.changes[k])
+	}
+	r.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// escapeLabel escapes a label value per the Prometheus text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		variable string
+		want     string
+	}{
+		{"kv.rangefeed.enabled", "kv"},
+		{"sql.defaults.distsql", "sql"},
+		{"server.time_until_store_dead", "server"},
+		{"version", "version"},
+	}
+
+	for _, tt := range tests {
+		if got := Category(tt.variable); got != tt.want {
+			t.Errorf("Category(%q) = %q, want %q", tt.variable, got, tt.want)
+		}
+	}
+}
+
+func TestNotifyIncrementsCategoryCounter(t *testing.T) {
+	r := NewRegistry()
+	ctx := context.Background()
+
+	r.Notify(ctx, "prod", []storage.Change{{Variable: "kv.rangefeed.enabled", OldValue: "false", NewValue: "true"}})
+	r.Notify(ctx, "prod", []storage.Change{
+		{Variable: "kv.rangefeed.enabled", OldValue: "true", NewValue: "false"},
+		{Variable: "sql.defaults.distsql", OldValue: "auto", NewValue: "on"},
+	})
+	r.Notify(ctx, "staging", []storage.Change{{Variable: "kv.closed_timestamp.target_duration"}})
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`# TYPE crdb_cluster_history_setting_changes_total counter`,
+		`crdb_cluster_history_setting_changes_total{cluster="prod",category="kv"} 2`,
+		`crdb_cluster_history_setting_changes_total{cluster="prod",category="sql"} 1`,
+		`crdb_cluster_history_setting_changes_total{cluster="staging",category="kv"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+
+	// Series are sorted by cluster, then category
+	if strings.Index(out, `cluster="prod",category="sql"`) > strings.Index(out, `cluster="staging"`) {
+		t.Errorf("Expected series sorted by cluster:\n%s", out)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel() = %q", got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Notify(context.Background(), "prod", []storage.Change{{Variable: "kv.rangefeed.enabled"}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), `category="kv"} 1`) {
+		t.Errorf("Expected kv counter in body:\n%s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
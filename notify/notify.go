@@ -0,0 +1,155 @@
+// Package notify delivers detected setting changes to external consumers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// DefaultTimeout bounds a single webhook delivery.
+const DefaultTimeout = 10 * time.Second
+
+// SubscriptionLister defines the storage operations needed by the dispatcher.
+type SubscriptionLister interface {
+	ListSubscriptions(ctx context.Context, clusterID string) ([]storage.Subscription, error)
+}
+
+// Payload is the JSON body POSTed to a subscription's target URL.
+type Payload struct {
+	SubscriptionID int64            `json:"subscription_id"` // 0 for a configured channel
+	ClusterID      string           `json:"cluster_id"`
+	Changes        []storage.Change `json:"changes"`
+}
+
+// Dispatcher sends changes to the subscriptions registered for a cluster.
+type Dispatcher struct {
+	store    SubscriptionLister
+	client   *http.Client
+	redactor *storage.Redactor
+	queue    *Queue                            // nil delivers inline
+	channels map[string][]storage.Subscription // configured channels by cluster ID
+}
+
+// NewDispatcher creates a dispatcher that looks up subscriptions in store.
+// If redactor is non-nil, sensitive values are redacted before delivery.
+func NewDispatcher(store SubscriptionLister, redactor *storage.Redactor) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		client:   &http.Client{Timeout: DefaultTimeout},
+		redactor: redactor,
+	}
+}
+
+// WithQueue makes Notify hand deliveries to a background queue that retries
+// failures, instead of sending them inline. Run must be called to start delivery.
+func (d *Dispatcher) WithQueue(cfg QueueConfig) *Dispatcher {
+	d.queue = NewQueue(cfg, d.deliver)
+	return d
+}
+
+// WithChannels adds fixed channels, keyed by cluster ID, that are notified of
+// that cluster's changes alongside its stored subscriptions. Channels have no
+// subscription ID.
+func (d *Dispatcher) WithChannels(channels map[string][]storage.Subscription) *Dispatcher {
+	d.channels = channels
+	return d
+}
+
+// Run processes queued deliveries until ctx is cancelled. It returns
+// immediately if no queue is configured.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d.queue != nil {
+		d.queue.Run(ctx)
+	}
+}
+
+// Drain delivers the notifications left queued after Run returned, until ctx is
+// done; see Queue.Drain. It does nothing if no queue is configured.
+func (d *Dispatcher) Drain(ctx context.Context) {
+	if d.queue != nil {
+		d.queue.Drain(ctx)
+	}
+}
+
+// Notify delivers the changes detected for a cluster to every matching subscription
+// and configured channel.
+// Delivery failures are logged and do not affect other subscriptions.
+func (d *Dispatcher) Notify(ctx context.Context, clusterID string, changes []storage.Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	stored, err := d.store.ListSubscriptions(ctx, clusterID)
+	if err != nil {
+		// Configured channels don't depend on the store, so still notify them
+		slog.Error("Failed to list subscriptions", "cluster", clusterID, "error", err)
+	}
+	subs := append(slices.Clone(d.channels[clusterID]), stored...)
+
+	if d.redactor != nil {
+		changes = d.redactor.RedactChanges(changes)
+	}
+
+	for _, sub := range subs {
+		matched := MatchChanges(sub, changes)
+		if len(matched) == 0 {
+			continue
+		}
+		if d.queue != nil {
+			d.queue.Enqueue(sub, matched)
+			continue
+		}
+		if err := d.deliver(ctx, sub, matched); err != nil {
+			slog.Warn("Subscription delivery failed", "subscription", sub.ID, "cluster", clusterID, "error", err)
+			continue
+		}
+		slog.Info("Delivered changes to subscription", "subscription", sub.ID, "cluster", clusterID, "count", len(matched))
+	}
+}
+
+// MatchChanges returns the changes whose variable matches the subscription's pattern.
+func MatchChanges(sub storage.Subscription, changes []storage.Change) []storage.Change {
+	var matched []storage.Change
+	for _, c := range changes {
+		if sub.Matches(c.Variable) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sub storage.Subscription, changes []storage.Change) error {
+	body, err := json.Marshal(Payload{
+		SubscriptionID: sub.ID,
+		ClusterID:      sub.ClusterID,
+		Changes:        changes,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+type staticLister []storage.Subscription
+
+func (l staticLister) ListSubscriptions(ctx context.Context, clusterID string) ([]storage.Subscription, error) {
+	var subs []storage.Subscription
+	for _, s := range l {
+		if s.ClusterID == clusterID {
+			subs = append(subs, s)
+		}
+	}
+	return subs, nil
+}
+
+// recordingTarget is an httptest server that records received payloads.
+func recordingTarget(t *testing.T) (*httptest.Server, func() []Payload) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		mu.Lock()
+		received = append(received, p)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []Payload {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Payload(nil), received...)
+	}
+}
+
+func TestMatchChanges(t *testing.T) {
+	t.Parallel()
+	sub := storage.Subscription{VariablePattern: "kv.rangefeed.*"}
+	changes := []storage.Change{
+		{Variable: "kv.rangefeed.enabled"},
+		{Variable: "sql.defaults.distsql"},
+		{Variable: "kv.rangefeed.concurrent_catchup_iterators"},
+	}
+
+	matched := MatchChanges(sub, changes)
+	if len(matched) != 2 {
+		t.Fatalf("Expected 2 matched changes, got %d", len(matched))
+	}
+	for _, c := range matched {
+		if c.Variable == "sql.defaults.distsql" {
+			t.Error("sql.defaults.distsql should not match kv.rangefeed.*")
+		}
+	}
+
+	if got := MatchChanges(sub, nil); len(got) != 0 {
+		t.Errorf("Expected no matches for empty changes, got %d", len(got))
+	}
+}
+
+func TestDispatcherDeliversMatchingChanges(t *testing.T) {
+	t.Parallel()
+	srv, received := recordingTarget(t)
+
+	lister := staticLister{
+		{ID: 1, ClusterID: "prod", VariablePattern: "kv.*", TargetURL: srv.URL},
+		{ID: 2, ClusterID: "prod", VariablePattern: "server.*", TargetURL: srv.URL},
+		{ID: 3, ClusterID: "staging", VariablePattern: "*", TargetURL: srv.URL},
+	}
+	d := NewDispatcher(lister, nil)
+
+	now := time.Now()
+	d.Notify(context.Background(), "prod", []storage.Change{
+		{ClusterID: "prod", DetectedAt: now, Variable: "kv.rangefeed.enabled", OldValue: "false", NewValue: "true"},
+		{ClusterID: "prod", DetectedAt: now, Variable: "sql.defaults.distsql", OldValue: "auto", NewValue: "on"},
+	})
+
+	payloads := received()
+	if len(payloads) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(payloads))
+	}
+	p := payloads[0]
+	if p.SubscriptionID != 1 || p.ClusterID != "prod" {
+		t.Errorf("Unexpected payload header: %+v", p)
+	}
+	if len(p.Changes) != 1 || p.Changes[0].Variable != "kv.rangefeed.enabled" || p.Changes[0].NewValue != "true" {
+		t.Errorf("Unexpected payload changes: %+v", p.Changes)
+	}
+}
+
+func TestDispatcherRedactsSensitiveValues(t *testing.T) {
+	t.Parallel()
+	srv, received := recordingTarget(t)
+
+	lister := staticLister{{ID: 1, ClusterID: "prod", VariablePattern: "*", TargetURL: srv.URL}}
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	d := NewDispatcher(lister, redactor)
+
+	d.Notify(context.Background(), "prod", []storage.Change{
+		{ClusterID: "prod", Variable: "server.password", OldValue: "old", NewValue: "new"},
+	})
+
+	payloads := received()
+	if len(payloads) != 1 || len(payloads[0].Changes) != 1 {
+		t.Fatalf("Expected 1 delivery with 1 change, got %+v", payloads)
+	}
+	if payloads[0].Changes[0].NewValue != storage.RedactedPlaceholder {
+		t.Errorf("Expected redacted value, got %q", payloads[0].Changes[0].NewValue)
+	}
+}
+
+func TestDispatcherContinuesAfterFailure(t *testing.T) {
+	t.Parallel()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	srv, received := recordingTarget(t)
+
+	lister := staticLister{
+		{ID: 1, ClusterID: "prod", VariablePattern: "*", TargetURL: failing.URL},
+		{ID: 2, ClusterID: "prod", VariablePattern: "*", TargetURL: srv.URL},
+	}
+	d := NewDispatcher(lister, nil)
+
+	d.Notify(context.Background(), "prod", []storage.Change{{ClusterID: "prod", Variable: "a.b"}})
+
+	if got := len(received()); got != 1 {
+		t.Errorf("Expected delivery to the healthy target, got %d", got)
+	}
+}
+
+func TestDispatcherNotifiesClusterChannels(t *testing.T) {
+	t.Parallel()
+	prodTarget, prodReceived := recordingTarget(t)
+	stagingTarget, stagingReceived := recordingTarget(t)
+
+	d := NewDispatcher(staticLister{}, nil).WithChannels(map[string][]storage.Subscription{
+		"prod":    {{ClusterID: "prod", VariablePattern: "*", TargetURL: prodTarget.URL}},
+		"staging": {{ClusterID: "staging", VariablePattern: "*", TargetURL: stagingTarget.URL}},
+	})
+
+	d.Notify(context.Background(), "prod", []storage.Change{{ClusterID: "prod", Variable: "a.b", NewValue: "1"}})
+
+	payloads := prodReceived()
+	if len(payloads) != 1 || payloads[0].ClusterID != "prod" || payloads[0].SubscriptionID != 0 {
+		t.Fatalf("Expected one delivery to prod's channel, got %+v", payloads)
+	}
+	if got := stagingReceived(); len(got) != 0 {
+		t.Errorf("Expected no delivery to staging's channel, got %+v", got)
+	}
+}
+
+// failingLister fails every subscription lookup.
+type failingLister struct{}
+
+func (failingLister) ListSubscriptions(ctx context.Context, clusterID string) ([]storage.Subscription, error) {
+	return nil, errors.New("history database unavailable")
+}
+
+func TestDispatcherNotifiesChannelsWithoutStore(t *testing.T) {
+	t.Parallel()
+	srv, received := recordingTarget(t)
+
+	d := NewDispatcher(failingLister{}, nil).WithChannels(map[string][]storage.Subscription{
+		"prod": {{ClusterID: "prod", VariablePattern: "kv.*", TargetURL: srv.URL}},
+	})
+
+	d.Notify(context.Background(), "prod", []storage.Change{
+		{ClusterID: "prod", Variable: "kv.rangefeed.enabled"},
+		{ClusterID: "prod", Variable: "sql.defaults.distsql"},
+	})
+
+	payloads := received()
+	if len(payloads) != 1 || len(payloads[0].Changes) != 1 || payloads[0].Changes[0].Variable != "kv.rangefeed.enabled" {
+		t.Errorf("Expected the channel to receive the matching change, got %+v", payloads)
+	}
+}
@@ -0,0 +1,262 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// Queue defaults, used for zero-valued QueueConfig fields.
+const (
+	DefaultQueueSize      = 1000
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+	DefaultWorkers        = 2
+	DefaultDrainTimeout   = 10 * time.Second
+)
+
+// errShutdown is recorded for deliveries that never got an attempt before shutdown.
+var errShutdown = errors.New("not delivered before shutdown")
+
+// QueueConfig configures the delivery queue.
+type QueueConfig struct {
+	Size           int           // Maximum pending deliveries; further deliveries are dropped
+	MaxAttempts    int           // Attempts per delivery, including the first
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each failure
+	MaxBackoff     time.Duration // Upper bound on the retry delay
+	Timeout        time.Duration // Time limit for a single attempt
+	Workers        int           // Deliveries sent concurrently
+
+	// DeadLetter, if set, receives one JSON line per delivery that exhausted its retries.
+	DeadLetter io.Writer
+}
+
+func (c QueueConfig) withDefaults() QueueConfig {
+	if c.Size <= 0 {
+		c.Size = DefaultQueueSize
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = DefaultInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Workers <= 0 {
+		c.Workers = DefaultWorkers
+	}
+	return c
+}
+
+// SendFunc delivers changes to a single subscription.
+type SendFunc func(ctx context.Context, sub storage.Subscription, changes []storage.Change) error
+
+// delivery is a pending send to one subscription.
+type delivery struct {
+	sub      storage.Subscription
+	changes  []storage.Change
+	attempts int   // attempts made so far
+	err      error // error from the last attempt
+}
+
+// DeadLetter is the JSON line written for a delivery that exhausted its retries.
+type DeadLetter struct {
+	FailedAt  time.Time `json:"failed_at"`
+	TargetURL string    `json:"target_url"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Payload
+}
+
+// Queue delivers notifications in the background, retrying failures with
+// exponential backoff. Enqueue never blocks: when the queue is full the
+// delivery is dropped with a warning, so collection is never held up.
+type Queue struct {
+	cfg   QueueConfig
+	send  SendFunc
+	items chan delivery
+
+	interruptedMu sync.Mutex
+	interrupted   []*delivery // deliveries in progress when Run stopped
+
+	deadLetterMu sync.Mutex
+}
+
+// NewQueue creates a queue that sends deliveries with send. Call Run to start it.
+func NewQueue(cfg QueueConfig, send SendFunc) *Queue {
+	cfg = cfg.withDefaults()
+	return &Queue{
+		cfg:   cfg,
+		send:  send,
+		items: make(chan delivery, cfg.Size),
+	}
+}
+
+// Enqueue schedules changes for delivery to sub. It returns false, after logging
+// a warning, if the queue is full.
+func (q *Queue) Enqueue(sub storage.Subscription, changes []storage.Change) bool {
+	select {
+	case q.items <- delivery{sub: sub, changes: changes}:
+		return true
+	default:
+		slog.Warn("Notification queue full, dropping delivery", "subscription", sub.ID, "cluster", sub.ClusterID, "count", len(changes))
+		return false
+	}
+}
+
+// Run processes deliveries until ctx is cancelled. Deliveries still queued or
+// waiting to retry when it returns are kept for Drain.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-q.items:
+					if !q.process(ctx, &d) {
+						q.interruptedMu.Lock()
+						q.interrupted = append(q.interrupted, &d)
+						q.interruptedMu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Drain delivers what Run left behind: deliveries still queued and those
+// interrupted between retries. Each keeps its remaining attempts and backoff.
+// Deliveries not finished when ctx is done are written to the dead-letter log,
+// so a shutdown never drops a notification silently. Call Drain after Run has
+// returned.
+func (q *Queue) Drain(ctx context.Context) {
+	q.interruptedMu.Lock()
+	pending := q.interrupted
+	q.interrupted = nil
+	q.interruptedMu.Unlock()
+	for queued := true; queued; {
+		select {
+		case d := <-q.items:
+			pending = append(pending, &d)
+		default:
+			queued = false
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	slog.Info("Delivering queued notifications before shutdown", "count", len(pending))
+	work := make(chan *delivery, len(pending))
+	for _, d := range pending {
+		work <- d
+	}
+	close(work)
+
+	var wg sync.WaitGroup
+	for range min(q.cfg.Workers, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range work {
+				if !q.process(ctx, d) {
+					err := d.err
+					if err == nil {
+						err = errShutdown
+					}
+					q.deadLetter(*d, d.attempts, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// process sends a delivery, retrying with backoff until it succeeds or runs out
+// of attempts, and reports true once it is finished either way. It returns
+// false if ctx is cancelled first; an attempt cut short by the cancellation is
+// not counted.
+func (q *Queue) process(ctx context.Context, d *delivery) bool {
+	for d.attempts < q.cfg.MaxAttempts {
+		if ctx.Err() != nil {
+			return false
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+		err := q.send(attemptCtx, d.sub, d.changes)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return false
+		}
+		d.attempts++
+		if err == nil {
+			slog.Info("Delivered changes to subscription", "subscription", d.sub.ID, "cluster", d.sub.ClusterID, "count", len(d.changes), "attempts", d.attempts)
+			return true
+		}
+		d.err = err
+		if d.attempts == q.cfg.MaxAttempts {
+			break
+		}
+
+		wait := q.backoff(d.attempts)
+		slog.Warn("Subscription delivery failed, retrying", "subscription", d.sub.ID, "attempt", d.attempts, "retry_in", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+
+	q.deadLetter(*d, d.attempts, d.err)
+	return true
+}
+
+// backoff returns the delay after the given failed attempt (1-based).
+func (q *Queue) backoff(attempt int) time.Duration {
+	wait := q.cfg.InitialBackoff
+	for i := 1; i < attempt && wait < q.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, q.cfg.MaxBackoff)
+}
+
+func (q *Queue) deadLetter(d delivery, attempts int, err error) {
+	slog.Error("Subscription delivery failed, giving up", "subscription", d.sub.ID, "cluster", d.sub.ClusterID, "attempts", attempts, "error", err)
+	if q.cfg.DeadLetter == nil {
+		return
+	}
+
+	line, mErr := json.Marshal(DeadLetter{
+		FailedAt:  time.Now(),
+		TargetURL: d.sub.TargetURL,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		Payload:   Payload{SubscriptionID: d.sub.ID, ClusterID: d.sub.ClusterID, Changes: d.changes},
+	})
+	if mErr != nil {
+		slog.Error("Failed to encode dead letter", "subscription", d.sub.ID, "error", mErr)
+		return
+	}
+
+	q.deadLetterMu.Lock()
+	defer q.deadLetterMu.Unlock()
+	if _, wErr := q.cfg.DeadLetter.Write(append(line, '\n')); wErr != nil {
+		slog.Error("Failed to write dead letter", "subscription", d.sub.ID, "error", wErr)
+	}
+}
@@ -0,0 +1,267 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// deadLetterLog collects dead-letter lines and signals each write.
+type deadLetterLog struct {
+	mu      sync.Mutex
+	lines   [][]byte
+	written chan struct{}
+}
+
+func newDeadLetterLog() *deadLetterLog {
+	return &deadLetterLog{written: make(chan struct{}, 10)}
+}
+
+func (l *deadLetterLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.lines = append(l.lines, append([]byte(nil), p...))
+	l.mu.Unlock()
+	l.written <- struct{}{}
+	return len(p), nil
+}
+
+func runQueue(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestQueueRetriesThenSucceeds(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	delivered := make(chan struct{})
+	send := func(ctx context.Context, sub storage.Subscription, changes []storage.Change) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("receiver down")
+		}
+		close(delivered)
+		return nil
+	}
+
+	dead := newDeadLetterLog()
+	q := NewQueue(QueueConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, DeadLetter: dead}, send)
+	runQueue(t, q)
+
+	if !q.Enqueue(storage.Subscription{ID: 1, ClusterID: "prod"}, []storage.Change{{Variable: "a.b"}}) {
+		t.Fatal("Enqueue failed")
+	}
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Delivery did not succeed, attempts = %d", attempts.Load())
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+	if len(dead.written) != 0 {
+		t.Error("Expected no dead letter after a successful retry")
+	}
+}
+
+func TestQueueExhaustedRetriesGoToDeadLetter(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	send := func(ctx context.Context, sub storage.Subscription, changes []storage.Change) error {
+		attempts.Add(1)
+		return errors.New("unexpected status 503")
+	}
+
+	dead := newDeadLetterLog()
+	q := NewQueue(QueueConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, DeadLetter: dead}, send)
+	runQueue(t, q)
+
+	sub := storage.Subscription{ID: 7, ClusterID: "prod", TargetURL: "https://hooks.example.com/crdb"}
+	q.Enqueue(sub, []storage.Change{{ClusterID: "prod", Variable: "kv.rangefeed.enabled", NewValue: "true"}})
+
+	select {
+	case <-dead.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a dead letter")
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("Expected 2 attempts, got %d", got)
+	}
+
+	dead.mu.Lock()
+	defer dead.mu.Unlock()
+	var dl DeadLetter
+	if err := json.Unmarshal(dead.lines[0], &dl); err != nil {
+		t.Fatalf("Failed to parse dead letter %q: %v", dead.lines[0], err)
+	}
+	if dl.SubscriptionID != 7 || dl.TargetURL != sub.TargetURL || dl.Attempts != 2 || dl.Error != "unexpected status 503" {
+		t.Errorf("Unexpected dead letter: %+v", dl)
+	}
+	if len(dl.Changes) != 1 || dl.Changes[0].Variable != "kv.rangefeed.enabled" {
+		t.Errorf("Expected the undelivered changes in the dead letter, got %+v", dl.Changes)
+	}
+}
+
+func TestQueueDrainFlushesOnShutdown(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var sent []int64
+	failedOnce := false
+	send := func(ctx context.Context, sub storage.Subscription, changes []storage.Change) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if sub.ID == 1 && !failedOnce {
+			failedOnce = true
+			return errors.New("receiver down")
+		}
+		sent = append(sent, sub.ID)
+		return nil
+	}
+
+	dead := newDeadLetterLog()
+	// A long backoff leaves subscription 1 waiting to retry when Run stops
+	q := NewQueue(QueueConfig{Workers: 1, InitialBackoff: time.Hour, DeadLetter: dead}, send)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	q.Enqueue(storage.Subscription{ID: 1}, []storage.Change{{Variable: "a.b"}})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		waiting := failedOnce
+		mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("First attempt was never made")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Enqueue(storage.Subscription{ID: 2}, []storage.Change{{Variable: "c.d"}})
+	q.Enqueue(storage.Subscription{ID: 3}, []storage.Change{{Variable: "e.f"}})
+	cancel()
+	<-done
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	q.Drain(drainCtx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(sent)
+	if !slices.Equal(sent, []int64{1, 2, 3}) {
+		t.Errorf("Expected every queued delivery to be sent on shutdown, got %v", sent)
+	}
+	if len(dead.written) != 0 {
+		t.Error("Expected no dead letters when the drain finishes in time")
+	}
+}
+
+func TestQueueDrainDeadLettersWhenTimeRunsOut(t *testing.T) {
+	t.Parallel()
+	send := func(ctx context.Context, sub storage.Subscription, changes []storage.Change) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	dead := newDeadLetterLog()
+	q := NewQueue(QueueConfig{Workers: 1, DeadLetter: dead}, send)
+	q.Enqueue(storage.Subscription{ID: 1}, []storage.Change{{Variable: "a.b"}})
+	q.Enqueue(storage.Subscription{ID: 2}, []storage.Change{{Variable: "c.d"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	q.Drain(ctx)
+
+	dead.mu.Lock()
+	defer dead.mu.Unlock()
+	if len(dead.lines) != 2 {
+		t.Fatalf("Expected both undelivered notifications in the dead-letter log, got %d", len(dead.lines))
+	}
+	for _, line := range dead.lines {
+		var dl DeadLetter
+		if err := json.Unmarshal(line, &dl); err != nil {
+			t.Fatalf("Failed to parse dead letter %q: %v", line, err)
+		}
+		if dl.Error != errShutdown.Error() || dl.Attempts != 0 {
+			t.Errorf("Unexpected dead letter: %+v", dl)
+		}
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	t.Parallel()
+	q := NewQueue(QueueConfig{Size: 1}, func(context.Context, storage.Subscription, []storage.Change) error { return nil })
+
+	// Not running, so nothing drains the queue
+	if !q.Enqueue(storage.Subscription{ID: 1}, nil) {
+		t.Fatal("Expected first delivery to be queued")
+	}
+	if q.Enqueue(storage.Subscription{ID: 2}, nil) {
+		t.Error("Expected delivery to be dropped when the queue is full")
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	t.Parallel()
+	q := NewQueue(QueueConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, nil)
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := q.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDispatcherWithQueueDoesNotBlock(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		received <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+
+	lister := staticLister{{ID: 1, ClusterID: "prod", VariablePattern: "*", TargetURL: srv.URL}}
+	d := NewDispatcher(lister, nil).WithQueue(QueueConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx)
+	t.Cleanup(cancel)
+
+	start := time.Now()
+	d.Notify(context.Background(), "prod", []storage.Change{{ClusterID: "prod", Variable: "a.b"}})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify blocked for %v with a slow receiver", elapsed)
+	}
+
+	close(release)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected queued delivery to arrive")
+	}
+}
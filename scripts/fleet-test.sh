@@ -168,6 +168,7 @@ generate_config() {
 
 history_database_url: "postgresql://history_user@localhost:${SQL_PORT_BASE}/cluster_history?sslmode=disable"
 poll_interval: 30s
+allow_insecure_connections: true
 http_port: "${APP_PORT}"
 
 clusters:
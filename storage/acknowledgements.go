@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Acknowledgement records that a change was reviewed, so triage views can hide it.
+// Unlike an annotation it carries no explanation, only who reviewed it and when.
+type Acknowledgement struct {
+	ChangeID       int64     `json:"change_id,string"`
+	AcknowledgedBy string    `json:"acknowledged_by"`
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+}
+
+// ChangeWithAcknowledgement combines a Change with its ID and optional Acknowledgement.
+type ChangeWithAcknowledgement struct {
+	Change
+	ID              int64            `json:"id,string"`                 // String to avoid JavaScript precision loss
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"` // nil if not acknowledged
+}
+
+// AcknowledgeChange marks a change as reviewed. Acknowledging a change again keeps
+// the first acknowledgement, which is returned.
+func (s *Store) AcknowledgeChange(ctx context.Context, changeID int64, acknowledgedBy string) (*Acknowledgement, error) {
+	_, err := s.pool.Exec(ctx,
+		s.sql(`INSERT INTO acknowledgements (change_id, acknowledged_by, acknowledged_at)
+		 VALUES ($1, $2, NOW())
+		 ON CONFLICT (change_id) DO NOTHING`),
+		changeID, acknowledgedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var a Acknowledgement
+	err = s.pool.QueryRow(ctx,
+		s.sql(`SELECT change_id, acknowledged_by, acknowledged_at FROM acknowledgements WHERE change_id = $1`),
+		changeID,
+	).Scan(&a.ChangeID, &a.AcknowledgedBy, &a.AcknowledgedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetChangesWithAcknowledgements retrieves recent changes with their acknowledgements.
+// If unacknowledgedOnly is true, acknowledged changes are left out.
+func (s *Store) GetChangesWithAcknowledgements(ctx context.Context, clusterID string, unacknowledgedOnly bool, limit int) ([]ChangeWithAcknowledgement, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT c.id, c.cluster_id, c.detected_at, c.variable, c.old_value, c.new_value, c.description, c.version,
+		        k.acknowledged_by, k.acknowledged_at
+		 FROM changes c
+		 LEFT JOIN acknowledgements k ON k.change_id = c.id
+		 WHERE c.cluster_id = $1 AND (NOT $2 OR k.change_id IS NULL)
+		 ORDER BY c.detected_at DESC, c.id DESC
+		 LIMIT $3`),
+		clusterID, unacknowledgedOnly, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []ChangeWithAcknowledgement{}
+	for rows.Next() {
+		var cwa ChangeWithAcknowledgement
+		var cnf changeNullableFields
+		var ackBy *string
+		var ackAt *time.Time
+		err := rows.Scan(
+			&cwa.ID, &cwa.ClusterID, &cwa.DetectedAt, &cwa.Variable, &cnf.OldValue, &cnf.NewValue, &cnf.Description, &cnf.Version,
+			&ackBy, &ackAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cnf.applyTo(&cwa.Change)
+		if ackAt != nil {
+			cwa.Acknowledgement = &Acknowledgement{ChangeID: cwa.ID, AcknowledgedAt: *ackAt}
+			if ackBy != nil {
+				cwa.Acknowledgement.AcknowledgedBy = *ackBy
+			}
+		}
+		results = append(results, cwa)
+	}
+	return results, rows.Err()
+}
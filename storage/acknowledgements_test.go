@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestAcknowledgeChange(t *testing.T) {
+	store, ctx := setupStoreTest(t, 10*time.Second)
+	changeID := saveTestChange(t, ctx, store, "test.ack.setting")
+
+	ack, err := store.AcknowledgeChange(ctx, changeID, "reviewer")
+	if err != nil {
+		t.Fatalf("AcknowledgeChange failed: %v", err)
+	}
+	if ack.ChangeID != changeID || ack.AcknowledgedBy != "reviewer" || ack.AcknowledgedAt.IsZero() {
+		t.Errorf("Unexpected acknowledgement: %+v", ack)
+	}
+
+	// Acknowledging again keeps the first acknowledgement
+	again, err := store.AcknowledgeChange(ctx, changeID, "someone-else")
+	if err != nil {
+		t.Fatalf("Second AcknowledgeChange failed: %v", err)
+	}
+	if again.AcknowledgedBy != "reviewer" {
+		t.Errorf("Expected the first acknowledgement to be kept, got %+v", again)
+	}
+
+	var pgErr *pgconn.PgError
+	if _, err := store.AcknowledgeChange(ctx, -1, "reviewer"); !errors.As(err, &pgErr) || pgErr.Code != "23503" {
+		t.Errorf("Expected a foreign key violation for an unknown change, got %v", err)
+	}
+}
+
+func TestGetChangesWithAcknowledgements(t *testing.T) {
+	store, ctx := setupStoreTest(t, 10*time.Second)
+	acked := saveTestChange(t, ctx, store, "test.ack.first")
+	s3 := []Setting{{Variable: "test.ack.first", Value: "v2"}, {Variable: "test.ack.second", Value: "x"}}
+	if err := store.SaveSnapshot(ctx, testClusterID, s3, "v1.0"); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	if _, err := store.AcknowledgeChange(ctx, acked, "reviewer"); err != nil {
+		t.Fatalf("AcknowledgeChange failed: %v", err)
+	}
+
+	all, err := store.GetChangesWithAcknowledgements(ctx, testClusterID, false, 10)
+	if err != nil {
+		t.Fatalf("GetChangesWithAcknowledgements failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(all))
+	}
+	for _, c := range all {
+		if (c.ID == acked) != (c.Acknowledgement != nil) {
+			t.Errorf("Change %d (%s) has acknowledgement %+v", c.ID, c.Variable, c.Acknowledgement)
+		}
+	}
+
+	pending, err := store.GetChangesWithAcknowledgements(ctx, testClusterID, true, 10)
+	if err != nil {
+		t.Fatalf("GetChangesWithAcknowledgements (unacknowledged) failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Variable != "test.ack.second" {
+		t.Errorf("Expected only the unacknowledged change, got %+v", pending)
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// WithApplicationName sets the application_name of connections to the history
+// database, so they can be told apart in CockroachDB's session and statement
+// views. Empty, or an application_name in the connection string, keeps the
+// connection string's.
+func WithApplicationName(name string) Option {
+	return func(s *Store) {
+		s.applicationName = name
+	}
+}
+
+// SetApplicationName sets the application_name cfg connects with, unless the
+// connection string already chose one. Empty leaves cfg unchanged.
+func SetApplicationName(cfg *pgconn.Config, name string) {
+	if name == "" {
+		return
+	}
+	if _, ok := cfg.RuntimeParams["application_name"]; ok {
+		return
+	}
+	if cfg.RuntimeParams == nil {
+		cfg.RuntimeParams = make(map[string]string)
+	}
+	cfg.RuntimeParams["application_name"] = name
+}
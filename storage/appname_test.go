@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSetApplicationName(t *testing.T) {
+	cfg, err := pgconn.ParseConfig("postgresql://history@localhost:26257/history?sslmode=disable")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	SetApplicationName(cfg, "crdb-cluster-history/v1.2.3")
+	if got := cfg.RuntimeParams["application_name"]; got != "crdb-cluster-history/v1.2.3" {
+		t.Errorf("application_name = %q, want crdb-cluster-history/v1.2.3", got)
+	}
+
+	// The connection string's own name wins
+	explicit, err := pgconn.ParseConfig("postgresql://history@localhost:26257/history?sslmode=disable&application_name=ops")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	SetApplicationName(explicit, "crdb-cluster-history/v1.2.3")
+	if got := explicit.RuntimeParams["application_name"]; got != "ops" {
+		t.Errorf("application_name = %q, want the connection string's ops", got)
+	}
+
+	unnamed, err := pgconn.ParseConfig("postgresql://history@localhost:26257/history?sslmode=disable")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	SetApplicationName(unnamed, "")
+	if _, ok := unnamed.RuntimeParams["application_name"]; ok {
+		t.Error("Expected an empty name to set no application_name")
+	}
+}
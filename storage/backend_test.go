@@ -0,0 +1,952 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backend is the subset of storage methods shared by Store and FileStore that the
+// collector and the read APIs depend on.
+type backend interface {
+	SaveSnapshotWithChanges(ctx context.Context, clusterID string, settings []Setting, version string) ([]Change, error)
+	SaveCollectedSnapshot(ctx context.Context, clusterID string, settings []Setting, version, query string, pollInterval time.Duration, label string, raw json.RawMessage) ([]Change, error)
+	GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]Setting, error)
+	ListSnapshots(ctx context.Context, clusterID string, limit int) ([]SnapshotInfo, error)
+	GetSnapshotByID(ctx context.Context, snapshotID int64) (map[string]Setting, error)
+	GetRawOutput(ctx context.Context, snapshotID int64) (json.RawMessage, error)
+	GetSettingsAt(ctx context.Context, clusterID string, at time.Time) (map[string]Setting, error)
+	GetChanges(ctx context.Context, clusterID string, limit int) ([]Change, error)
+	GetChangesInRange(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]Change, error)
+	SearchChanges(ctx context.Context, clusterID, query string, limit int) ([]Change, error)
+	StreamChanges(ctx context.Context, clusterID string, fn func(Change) error) error
+	StreamChangesAfter(ctx context.Context, clusterID string, afterID int64, fn func(int64, Change) error) error
+	GetChangesWithAnnotations(ctx context.Context, clusterID string, limit int) ([]ChangeWithAnnotation, error)
+	GetChangesWithAnnotationsPaged(ctx context.Context, clusterID string, limit, offset int) ([]ChangeWithAnnotation, error)
+	CountChanges(ctx context.Context, clusterID string) (int64, error)
+	HasChange(ctx context.Context, changeID int64) (bool, error)
+	GetTopChangedSettings(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]SettingChangeCount, error)
+	CountChangesByCluster(ctx context.Context, since time.Time) ([]ClusterChangeCount, error)
+	CleanupOldSnapshots(ctx context.Context, clusterID string, retention time.Duration) (int64, error)
+	CleanupOldChanges(ctx context.Context, clusterID string, retention time.Duration) (int64, error)
+	CleanupOldChangesKeeping(ctx context.Context, clusterID string, retention time.Duration, keep KeepChanges) (int64, error)
+	CompactReverts(ctx context.Context, clusterID string, window time.Duration) (CompactionResult, error)
+	SetSourceClusterID(ctx context.Context, clusterID, sourceClusterID string) error
+	GetSourceClusterID(ctx context.Context, clusterID string) (string, error)
+	SetDatabaseVersion(ctx context.Context, clusterID, version string) error
+	GetDatabaseVersion(ctx context.Context, clusterID string) (string, error)
+	ListClusters(ctx context.Context) ([]string, error)
+	ListClustersWithPrefix(ctx context.Context, prefix string, limit int) ([]string, error)
+	RequestRebaseline(ctx context.Context, clusterID string) error
+	RebaselineRequested(ctx context.Context, clusterID string) (bool, error)
+}
+
+var (
+	_ backend = (*Store)(nil)
+	_ backend = (*FileStore)(nil)
+)
+
+func TestStoreBackend(t *testing.T) {
+	runBackendSuite(t, func(t *testing.T) (backend, context.Context) {
+		store, ctx := setupStoreTest(t, 30*time.Second)
+		return store, ctx
+	})
+}
+
+func TestFileStoreBackend(t *testing.T) {
+	runBackendSuite(t, func(t *testing.T) (backend, context.Context) {
+		store, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore failed: %v", err)
+		}
+		t.Cleanup(store.Close)
+		return store, context.Background()
+	})
+}
+
+// runBackendSuite exercises the behavior every storage backend must share.
+// Each subtest uses its own cluster ID so backends with shared state stay isolated.
+func runBackendSuite(t *testing.T, newBackend func(t *testing.T) (backend, context.Context)) {
+	clusterFor := func(t *testing.T) string {
+		return strings.ReplaceAll(t.Name(), "/", "-")
+	}
+
+	t.Run("DetectsChanges", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		changes, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{
+			{Variable: "modified", Value: "old", SettingType: "s"},
+			{Variable: "removed", Value: "gone", SettingType: "s"},
+		}, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("Expected no changes for the first snapshot, got %+v", changes)
+		}
+
+		changes, err = b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{
+			{Variable: "modified", Value: "new", SettingType: "s"},
+			{Variable: "added", Value: "here", SettingType: "s"},
+		}, "v1.1")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 3 {
+			t.Fatalf("Expected 3 changes, got %+v", changes)
+		}
+
+		stored, err := b.GetChanges(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		if len(stored) != 3 {
+			t.Fatalf("Expected 3 stored changes, got %+v", stored)
+		}
+		if c := findChange(stored, "modified"); c == nil || c.OldValue != "old" || c.NewValue != "new" || c.Version != "v1.1" {
+			t.Errorf("Unexpected modified change: %+v", c)
+		}
+		if c := findChange(stored, "added"); c == nil || c.OldValue != "" || c.NewValue != "here" {
+			t.Errorf("Unexpected added change: %+v", c)
+		}
+		if c := findChange(stored, "removed"); c == nil || c.OldValue != "gone" || c.NewValue != "" {
+			t.Errorf("Unexpected removed change: %+v", c)
+		}
+		for _, c := range stored {
+			if c.ClusterID != clusterID {
+				t.Errorf("Expected cluster %q, got %q", clusterID, c.ClusterID)
+			}
+		}
+
+		latest, err := b.GetLatestSnapshot(ctx, clusterID)
+		if err != nil {
+			t.Fatalf("GetLatestSnapshot failed: %v", err)
+		}
+		if len(latest) != 2 || latest["modified"].Value != "new" || latest["added"].SettingType != "s" {
+			t.Errorf("Unexpected latest snapshot: %+v", latest)
+		}
+
+		if latest, err := b.GetLatestSnapshot(ctx, clusterID+"-none"); err != nil || latest != nil {
+			t.Errorf("Expected nil snapshot for unknown cluster, got %+v, %v", latest, err)
+		}
+	})
+
+	t.Run("Snapshots", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "3"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		snapshots, err := b.ListSnapshots(ctx, clusterID, 2)
+		if err != nil {
+			t.Fatalf("ListSnapshots failed: %v", err)
+		}
+		if len(snapshots) != 2 {
+			t.Fatalf("Expected 2 snapshots, got %d", len(snapshots))
+		}
+		if !snapshots[0].CollectedAt.After(snapshots[1].CollectedAt) {
+			t.Errorf("Expected newest first, got %v then %v", snapshots[0].CollectedAt, snapshots[1].CollectedAt)
+		}
+
+		settings, err := b.GetSnapshotByID(ctx, snapshots[1].ID)
+		if err != nil {
+			t.Fatalf("GetSnapshotByID failed: %v", err)
+		}
+		if settings["a"].Value != "2" {
+			t.Errorf("Expected second snapshot value 2, got %+v", settings)
+		}
+
+		if settings, err := b.GetSnapshotByID(ctx, 1<<62); err != nil || settings != nil {
+			t.Errorf("Expected nil for unknown snapshot, got %+v, %v", settings, err)
+		}
+	})
+
+	t.Run("SnapshotQuery", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: "1"}}, "v1.0")
+		if _, err := b.SaveCollectedSnapshot(ctx, clusterID, []Setting{{Variable: "a", Value: "2"}}, "v1.0", "SHOW ALL CLUSTER SETTINGS", 5*time.Minute, "release-42", nil); err != nil {
+			t.Fatalf("SaveCollectedSnapshot failed: %v", err)
+		}
+
+		snapshots, err := b.ListSnapshots(ctx, clusterID, 10)
+		if err != nil || len(snapshots) != 2 {
+			t.Fatalf("Expected 2 snapshots, got %+v, %v", snapshots, err)
+		}
+		if snapshots[0].Query != "SHOW ALL CLUSTER SETTINGS" {
+			t.Errorf("Expected the recorded query, got %q", snapshots[0].Query)
+		}
+		if snapshots[1].Query != DefaultCollectionQuery {
+			t.Errorf("Expected the default query, got %q", snapshots[1].Query)
+		}
+		if snapshots[0].PollIntervalSeconds != 300 {
+			t.Errorf("Expected the recorded poll interval of 300s, got %d", snapshots[0].PollIntervalSeconds)
+		}
+		if snapshots[1].PollIntervalSeconds != 0 {
+			t.Errorf("Expected no poll interval when unknown, got %d", snapshots[1].PollIntervalSeconds)
+		}
+		if snapshots[0].Label != "release-42" || snapshots[1].Label != "" {
+			t.Errorf("Expected labels %q and none, got %q and %q", "release-42", snapshots[0].Label, snapshots[1].Label)
+		}
+	})
+
+	t.Run("RawOutput", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		raw := json.RawMessage(`[{"variable": "a", "value": "2", "origin": "override", "public": true}]`)
+		b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: "1"}}, "v1.0")
+		if _, err := b.SaveCollectedSnapshot(ctx, clusterID, []Setting{{Variable: "a", Value: "2"}}, "v1.0", DefaultCollectionQuery, 0, "", raw); err != nil {
+			t.Fatalf("SaveCollectedSnapshot failed: %v", err)
+		}
+		snapshots, err := b.ListSnapshots(ctx, clusterID, 10)
+		if err != nil || len(snapshots) != 2 {
+			t.Fatalf("Expected 2 snapshots, got %+v, %v", snapshots, err)
+		}
+
+		got, err := b.GetRawOutput(ctx, snapshots[0].ID)
+		if err != nil {
+			t.Fatalf("GetRawOutput failed: %v", err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(got, &rows); err != nil {
+			t.Fatalf("Raw output is not a JSON array of rows: %v: %s", err, got)
+		}
+		if len(rows) != 1 || rows[0]["origin"] != "override" || rows[0]["public"] != true {
+			t.Errorf("Expected the raw row with its unmodeled columns, got %s", got)
+		}
+
+		if got, err := b.GetRawOutput(ctx, snapshots[1].ID); err != nil || got != nil {
+			t.Errorf("Expected no raw output for a snapshot saved without it, got %s, %v", got, err)
+		}
+		if got, err := b.GetRawOutput(ctx, 1<<62); err != nil || got != nil {
+			t.Errorf("Expected no raw output for an unknown snapshot, got %s, %v", got, err)
+		}
+	})
+
+	t.Run("DuplicateVariables", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: "1"}}, "v1.0")
+		changes, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{
+			{Variable: "a", Value: "2"},
+			{Variable: "a", Value: "3"},
+		}, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 1 || changes[0].NewValue != "3" {
+			t.Errorf("Expected one change to the last value, got %+v", changes)
+		}
+
+		snapshots, err := b.ListSnapshots(ctx, clusterID, 1)
+		if err != nil || len(snapshots) != 1 {
+			t.Fatalf("Expected 1 snapshot, got %+v, %v", snapshots, err)
+		}
+		settings, err := b.GetSnapshotByID(ctx, snapshots[0].ID)
+		if err != nil {
+			t.Fatalf("GetSnapshotByID failed: %v", err)
+		}
+		if len(settings) != 1 || settings["a"].Value != "3" {
+			t.Errorf("Expected the snapshot to keep the last value, got %+v", settings)
+		}
+	})
+
+	t.Run("ChangeOrderAndIDs", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "3", "4"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		var streamed []Change
+		err := b.StreamChanges(ctx, clusterID, func(c Change) error {
+			streamed = append(streamed, c)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StreamChanges failed: %v", err)
+		}
+		if len(streamed) != 3 || streamed[0].NewValue != "4" || streamed[2].NewValue != "2" {
+			t.Errorf("Expected 3 changes newest first, got %+v", streamed)
+		}
+
+		limited, err := b.GetChanges(ctx, clusterID, 2)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		if len(limited) != 2 || limited[0].NewValue != "4" {
+			t.Errorf("Expected the 2 newest changes, got %+v", limited)
+		}
+
+		withIDs, err := b.GetChangesWithAnnotations(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChangesWithAnnotations failed: %v", err)
+		}
+		seen := make(map[int64]bool)
+		for _, c := range withIDs {
+			if c.ID == 0 || seen[c.ID] {
+				t.Errorf("Expected unique non-zero change IDs, got %d", c.ID)
+			}
+			seen[c.ID] = true
+		}
+	})
+
+	t.Run("PagedChanges", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "3", "4", "5"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		count, err := b.CountChanges(ctx, clusterID)
+		if err != nil || count != 4 {
+			t.Errorf("CountChanges = %d, %v; want 4", count, err)
+		}
+
+		newest, err := b.GetChangesWithAnnotations(ctx, clusterID, 1)
+		if err != nil || len(newest) != 1 {
+			t.Fatalf("GetChangesWithAnnotations = %v, %v", newest, err)
+		}
+		for id, want := range map[int64]bool{newest[0].ID: true, -1: false} {
+			if has, err := b.HasChange(ctx, id); err != nil || has != want {
+				t.Errorf("HasChange(%d) = %v, %v; want %v", id, has, err, want)
+			}
+		}
+
+		tests := []struct {
+			limit, offset int
+			want          []string // new values, newest first
+		}{
+			{2, 0, []string{"5", "4"}},
+			{2, 2, []string{"3", "2"}},
+			{2, 3, []string{"2"}},
+			{2, 10, nil},
+			{2, -1, []string{"5", "4"}},
+		}
+		for _, tt := range tests {
+			page, err := b.GetChangesWithAnnotationsPaged(ctx, clusterID, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("GetChangesWithAnnotationsPaged(%d, %d) failed: %v", tt.limit, tt.offset, err)
+			}
+			var values []string
+			for _, c := range page {
+				values = append(values, c.NewValue)
+			}
+			if !slices.Equal(values, tt.want) {
+				t.Errorf("GetChangesWithAnnotationsPaged(%d, %d) = %v, want %v", tt.limit, tt.offset, values, tt.want)
+			}
+		}
+	})
+
+	t.Run("SameTimestampOrder", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		// One collection stamps all of its changes with the same detection time
+		initial := []Setting{{Variable: "e", Value: "1"}, {Variable: "b", Value: "1"}, {Variable: "d", Value: "1"}, {Variable: "a", Value: "1"}, {Variable: "c", Value: "1"}}
+		changed := make([]Setting, len(initial))
+		for i, s := range initial {
+			changed[i] = Setting{Variable: s.Variable, Value: "2"}
+		}
+		for _, settings := range [][]Setting{initial, changed} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		variables := func(changes []Change) []string {
+			var names []string
+			for _, c := range changes {
+				names = append(names, c.Variable)
+			}
+			return names
+		}
+		first, err := b.GetChanges(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		if len(first) != len(initial) {
+			t.Fatalf("Expected %d changes, got %d", len(initial), len(first))
+		}
+		for range 3 {
+			again, err := b.GetChanges(ctx, clusterID, 10)
+			if err != nil {
+				t.Fatalf("GetChanges failed: %v", err)
+			}
+			if !slices.Equal(variables(again), variables(first)) {
+				t.Fatalf("Expected a stable order, got %v then %v", variables(first), variables(again))
+			}
+		}
+
+		var streamed []Change
+		if err := b.StreamChanges(ctx, clusterID, func(c Change) error {
+			streamed = append(streamed, c)
+			return nil
+		}); err != nil {
+			t.Fatalf("StreamChanges failed: %v", err)
+		}
+		if !slices.Equal(variables(streamed), variables(first)) {
+			t.Errorf("Expected StreamChanges in the order of GetChanges, got %v, want %v", variables(streamed), variables(first))
+		}
+
+		withIDs, err := b.GetChangesWithAnnotations(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChangesWithAnnotations failed: %v", err)
+		}
+		for i, c := range withIDs {
+			if c.Variable != first[i].Variable {
+				t.Errorf("Expected GetChangesWithAnnotations in the order of GetChanges, got %s at %d, want %s", c.Variable, i, first[i].Variable)
+			}
+			if i > 0 && c.ID >= withIDs[i-1].ID {
+				t.Errorf("Expected same-timestamp changes by descending ID, got %d after %d", c.ID, withIDs[i-1].ID)
+			}
+		}
+	})
+
+	t.Run("StreamChangesAfter", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		streamAfter := func(afterID int64) ([]Change, int64) {
+			t.Helper()
+			var changes []Change
+			maxID := afterID
+			err := b.StreamChangesAfter(ctx, clusterID, afterID, func(id int64, c Change) error {
+				changes = append(changes, c)
+				if id > maxID {
+					maxID = id
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamChangesAfter failed: %v", err)
+			}
+			return changes, maxID
+		}
+
+		for _, v := range []string{"1", "2", "3"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+		first, marker := streamAfter(0)
+		if len(first) != 2 || first[0].NewValue != "2" || first[1].NewValue != "3" {
+			t.Fatalf("Expected 2 changes oldest first, got %+v", first)
+		}
+
+		if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: "4"}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		second, next := streamAfter(marker)
+		if len(second) != 1 || second[0].NewValue != "4" {
+			t.Errorf("Expected only the new change after the marker, got %+v", second)
+		}
+		if none, _ := streamAfter(next); len(none) != 0 {
+			t.Errorf("Expected no changes after the latest marker, got %+v", none)
+		}
+	})
+
+	t.Run("TopChangedSettings", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, vals := range [][2]string{{"1", "x"}, {"2", "x"}, {"3", "y"}} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{
+				{Variable: "churny", Value: vals[0]},
+				{Variable: "once", Value: vals[1]},
+			}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		now := time.Now()
+		counts, err := b.GetTopChangedSettings(ctx, clusterID, now.Add(-time.Hour), now.Add(time.Hour), 10)
+		if err != nil {
+			t.Fatalf("GetTopChangedSettings failed: %v", err)
+		}
+		if len(counts) != 2 || counts[0].Variable != "churny" || counts[0].Count != 2 || counts[1].Count != 1 {
+			t.Errorf("Unexpected counts: %+v", counts)
+		}
+
+		counts, err = b.GetTopChangedSettings(ctx, clusterID, now.Add(time.Hour), now.Add(2*time.Hour), 10)
+		if err != nil {
+			t.Fatalf("GetTopChangedSettings failed: %v", err)
+		}
+		if counts == nil || len(counts) != 0 {
+			t.Errorf("Expected empty non-nil result outside the window, got %#v", counts)
+		}
+	})
+
+	t.Run("ChangesInRange", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "3", "4"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "setting", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+			time.Sleep(2 * time.Millisecond) // distinct detection times
+		}
+		all, err := b.GetChanges(ctx, clusterID, 10)
+		if err != nil || len(all) != 3 {
+			t.Fatalf("GetChanges = %d changes, %v; want 3", len(all), err)
+		}
+
+		tests := []struct {
+			name     string
+			from, to time.Time
+			limit    int
+			want     []string // new values, newest first
+		}{
+			{"closed range excludes to", all[2].DetectedAt, all[0].DetectedAt, 10, []string{"3", "2"}},
+			{"open-ended", all[1].DetectedAt, time.Time{}, 10, []string{"4", "3"}},
+			{"limit keeps the newest", time.Time{}, time.Time{}, 2, []string{"4", "3"}},
+			{"empty range", all[0].DetectedAt.Add(time.Hour), time.Time{}, 10, nil},
+		}
+		for _, tt := range tests {
+			got, err := b.GetChangesInRange(ctx, clusterID, tt.from, tt.to, tt.limit)
+			if err != nil {
+				t.Fatalf("%s: GetChangesInRange failed: %v", tt.name, err)
+			}
+			var values []string
+			for _, c := range got {
+				values = append(values, c.NewValue)
+			}
+			if !slices.Equal(values, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, values, tt.want)
+			}
+		}
+	})
+
+	t.Run("SearchChanges", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		prod, staging := clusterFor(t)+"-prod", clusterFor(t)+"-staging"
+		// A token unique to the test keeps searches across all clusters from
+		// matching other tests' changes in a shared database
+		token := strings.ToLower(clusterFor(t))
+
+		for _, cluster := range []string{prod, staging} {
+			for _, v := range []string{"off", "ON_100%"} {
+				if _, err := b.SaveSnapshotWithChanges(ctx, cluster, []Setting{
+					{Variable: "kv.rangefeed." + token, Value: v},
+					{Variable: "sql.other." + token, Value: v + "-x"},
+				}, "v1.0"); err != nil {
+					t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+				}
+			}
+		}
+
+		tests := []struct {
+			name      string
+			clusterID string
+			query     string
+			limit     int
+			want      int
+		}{
+			{"variable, ignoring case", prod, "KV.RANGEFEED." + strings.ToUpper(token), 10, 1},
+			{"value", prod, "on_100", 10, 2},
+			{"wildcards are literal", prod, "100%-x", 10, 1},
+			{"no wildcard match", prod, "o%1", 10, 0},
+			{"all clusters", "", "kv.rangefeed." + token, 10, 2},
+			{"limit", "", token, 3, 3},
+		}
+		for _, tt := range tests {
+			got, err := b.SearchChanges(ctx, tt.clusterID, tt.query, tt.limit)
+			if err != nil {
+				t.Fatalf("%s: SearchChanges failed: %v", tt.name, err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("%s: got %d changes, want %d: %+v", tt.name, len(got), tt.want, got)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].DetectedAt.After(got[i-1].DetectedAt) {
+					t.Errorf("%s: changes not newest first: %+v", tt.name, got)
+				}
+			}
+		}
+	})
+
+	t.Run("CountChangesByCluster", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		busy, quiet, idle := clusterFor(t)+"-busy", clusterFor(t)+"-quiet", clusterFor(t)+"-idle"
+
+		for cluster, values := range map[string][]string{busy: {"1", "2", "3"}, quiet: {"1", "2"}, idle: {"1"}} {
+			for _, v := range values {
+				if _, err := b.SaveSnapshotWithChanges(ctx, cluster, []Setting{{Variable: "setting", Value: v}}, "v1.0"); err != nil {
+					t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+				}
+			}
+		}
+
+		counts, err := b.CountChangesByCluster(ctx, time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("CountChangesByCluster failed: %v", err)
+		}
+		// Other subtests may share the backend, so only look at this subtest's clusters.
+		byCluster := make(map[string]int)
+		var order []string
+		for _, c := range counts {
+			if c.ClusterID == busy || c.ClusterID == quiet || c.ClusterID == idle {
+				byCluster[c.ClusterID] = int(c.Count)
+				order = append(order, c.ClusterID)
+				if c.LastChanged.IsZero() {
+					t.Errorf("Expected last_changed for %s", c.ClusterID)
+				}
+			}
+		}
+		if len(order) != 2 || order[0] != busy || byCluster[busy] != 2 || byCluster[quiet] != 1 {
+			t.Errorf("Unexpected counts: %+v", counts)
+		}
+
+		counts, err = b.CountChangesByCluster(ctx, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CountChangesByCluster failed: %v", err)
+		}
+		if counts == nil || len(counts) != 0 {
+			t.Errorf("Expected empty non-nil result outside the window, got %#v", counts)
+		}
+	})
+
+	t.Run("Rebaseline", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		save := func(settings ...Setting) []Change {
+			t.Helper()
+			changes, err := b.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0")
+			if err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+			return changes
+		}
+		save(Setting{Variable: "a", Value: "1"}, Setting{Variable: "b", Value: "1"})
+		save(Setting{Variable: "a", Value: "2"}, Setting{Variable: "b", Value: "1"})
+
+		requested := func() bool {
+			t.Helper()
+			pending, err := b.RebaselineRequested(ctx, clusterID)
+			if err != nil {
+				t.Fatalf("RebaselineRequested failed: %v", err)
+			}
+			return pending
+		}
+		if requested() {
+			t.Error("Expected no rebaseline pending before one is requested")
+		}
+		if err := b.RequestRebaseline(ctx, clusterID); err != nil {
+			t.Fatalf("RequestRebaseline failed: %v", err)
+		}
+		if !requested() {
+			t.Error("Expected the requested rebaseline to be pending")
+		}
+		// A reconfiguration that modifies, adds, and removes settings records nothing.
+		if changes := save(Setting{Variable: "a", Value: "3"}, Setting{Variable: "c", Value: "1"}); len(changes) != 0 {
+			t.Errorf("Expected no changes for the new baseline, got %+v", changes)
+		}
+		if requested() {
+			t.Error("Expected the rebaseline to be done after the next snapshot")
+		}
+		// Later snapshots are compared against the new baseline.
+		changes := save(Setting{Variable: "a", Value: "4"}, Setting{Variable: "c", Value: "1"})
+		if len(changes) != 1 || changes[0].OldValue != "3" || changes[0].NewValue != "4" {
+			t.Errorf("Expected one change against the new baseline, got %+v", changes)
+		}
+
+		history, err := b.GetChanges(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		if len(history) != 2 {
+			t.Errorf("Expected earlier history to be kept, got %+v", history)
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		if v, err := b.GetSourceClusterID(ctx, clusterID); err != nil || v != "" {
+			t.Errorf("Expected empty source cluster ID, got %q, %v", v, err)
+		}
+		if err := b.SetSourceClusterID(ctx, clusterID, "abc-123"); err != nil {
+			t.Fatalf("SetSourceClusterID failed: %v", err)
+		}
+		if err := b.SetDatabaseVersion(ctx, clusterID, "v25.4.2"); err != nil {
+			t.Fatalf("SetDatabaseVersion failed: %v", err)
+		}
+		if v, _ := b.GetSourceClusterID(ctx, clusterID); v != "abc-123" {
+			t.Errorf("Expected source cluster ID abc-123, got %q", v)
+		}
+		if v, _ := b.GetDatabaseVersion(ctx, clusterID); v != "v25.4.2" {
+			t.Errorf("Expected version v25.4.2, got %q", v)
+		}
+
+		clusters, err := b.ListClusters(ctx)
+		if err != nil {
+			t.Fatalf("ListClusters failed: %v", err)
+		}
+		found := false
+		for _, c := range clusters {
+			found = found || c == clusterID
+		}
+		if !found {
+			t.Errorf("Expected %q in ListClusters, got %v", clusterID, clusters)
+		}
+	})
+
+	t.Run("ListClustersWithPrefix", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		base := clusterFor(t)
+
+		for _, suffix := range []string{"-east-1", "-east-2", "-east_3", "-west-1", "-eastx"} {
+			if err := b.SetDatabaseVersion(ctx, base+suffix, "v25.4.2"); err != nil {
+				t.Fatalf("SetDatabaseVersion failed: %v", err)
+			}
+		}
+
+		tests := []struct {
+			prefix string
+			limit  int
+			want   []string
+		}{
+			{base + "-east-", 0, []string{base + "-east-1", base + "-east-2"}},
+			{base + "-east_", 0, []string{base + "-east_3"}}, // _ is not a wildcard
+			{base + "-east", 2, []string{base + "-east-1", base + "-east-2"}},
+			{base + "-north", 0, []string{}},
+		}
+		for _, tt := range tests {
+			got, err := b.ListClustersWithPrefix(ctx, tt.prefix, tt.limit)
+			if err != nil {
+				t.Fatalf("ListClustersWithPrefix failed: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListClustersWithPrefix(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+			}
+		}
+
+		all, err := b.ListClustersWithPrefix(ctx, base, 0)
+		if err != nil {
+			t.Fatalf("ListClustersWithPrefix failed: %v", err)
+		}
+		if len(all) != 5 {
+			t.Errorf("Expected all 5 clusters without a limit, got %v", all)
+		}
+	})
+
+	t.Run("TenantsTrackedIndependently", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+		app, analytics := clusterID+".app", clusterID+".analytics"
+
+		base := []Setting{{Variable: "sql.defaults.distsql", Value: "auto", SettingType: "e"}}
+		for _, id := range []string{clusterID, app, analytics} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, id, base, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges(%s) failed: %v", id, err)
+			}
+		}
+
+		changes, err := b.SaveSnapshotWithChanges(ctx, app, []Setting{{Variable: "sql.defaults.distsql", Value: "off", SettingType: "e"}}, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 1 || changes[0].ClusterID != app {
+			t.Fatalf("Expected one change for %s, got %+v", app, changes)
+		}
+		changes, err = b.SaveSnapshotWithChanges(ctx, analytics, base, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("Expected %s unaffected by %s, got %+v", analytics, app, changes)
+		}
+
+		for id, want := range map[string]int{clusterID: 0, app: 1, analytics: 0} {
+			got, err := b.GetChanges(ctx, id, 10)
+			if err != nil {
+				t.Fatalf("GetChanges(%s) failed: %v", id, err)
+			}
+			if len(got) != want {
+				t.Errorf("GetChanges(%s) returned %d changes, want %d", id, len(got), want)
+			}
+		}
+	})
+
+	t.Run("CleanupKeepsLatestPerVariable", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		// "busy" changes 9 times and "quiet" twice
+		for i := 0; i < 10; i++ {
+			settings := []Setting{{Variable: "busy", Value: fmt.Sprint(i)}, {Variable: "quiet", Value: fmt.Sprint(i / 4)}}
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		keep := KeepChanges{PerVariable: 1, Variables: map[string]int{"busy": 3}}
+		n, err := b.CleanupOldChangesKeeping(ctx, clusterID, 0, keep)
+		if err != nil {
+			t.Fatalf("CleanupOldChangesKeeping failed: %v", err)
+		}
+		if n != 7 {
+			t.Errorf("Expected 7 changes removed, got %d", n)
+		}
+
+		changes, err := b.GetChanges(ctx, clusterID, 20)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.Variable+"="+c.NewValue)
+		}
+		slices.Sort(got)
+		if want := []string{"busy=7", "busy=8", "busy=9", "quiet=2"}; !slices.Equal(got, want) {
+			t.Errorf("Changes after cleanup = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("SettingsAt", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "3"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+		snapshots, err := b.ListSnapshots(ctx, clusterID, 10)
+		if err != nil || len(snapshots) != 3 {
+			t.Fatalf("ListSnapshots = %d snapshots, %v; want 3", len(snapshots), err)
+		}
+		first, second := snapshots[2].CollectedAt, snapshots[1].CollectedAt
+
+		if got, err := b.GetSettingsAt(ctx, clusterID, first.Add(-time.Microsecond)); err != nil || got != nil {
+			t.Errorf("GetSettingsAt before the first snapshot = %+v, %v; want nil", got, err)
+		}
+		for _, tc := range []struct {
+			at   time.Time
+			want string
+		}{
+			{first, "1"},
+			{second.Add(-time.Microsecond), "1"},
+			{second, "2"},
+			{time.Now().Add(time.Hour), "3"},
+		} {
+			got, err := b.GetSettingsAt(ctx, clusterID, tc.at)
+			if err != nil {
+				t.Fatalf("GetSettingsAt failed: %v", err)
+			}
+			if got["a"].Value != tc.want {
+				t.Errorf("GetSettingsAt(%s) a = %q, want %q", tc.at, got["a"].Value, tc.want)
+			}
+		}
+	})
+
+	t.Run("DefaultValues", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{
+			{Variable: "a", Value: "2", SettingType: "i", DefaultValue: "1"},
+			{Variable: "b", Value: "x", SettingType: "s"},
+		}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		latest, err := b.GetLatestSnapshot(ctx, clusterID)
+		if err != nil {
+			t.Fatalf("GetLatestSnapshot failed: %v", err)
+		}
+		if latest["a"].DefaultValue != "1" || latest["b"].DefaultValue != "" {
+			t.Errorf("Expected default values to round-trip, got %+v", latest)
+		}
+	})
+
+	t.Run("CompactReverts", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2", "1", "2", "3"} {
+			settings := []Setting{{Variable: "a", Value: v}, {Variable: "b", Value: "x" + v}}
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		result, err := b.CompactReverts(ctx, clusterID, time.Hour)
+		if err != nil {
+			t.Fatalf("CompactReverts failed: %v", err)
+		}
+		if result.Removed != 4 || result.Sequences != 2 {
+			t.Errorf("Expected 4 changes removed in 2 sequences, got %+v", result)
+		}
+
+		changes, err := b.GetChanges(ctx, clusterID, 10)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		got := make(map[string][]string)
+		for _, c := range slices.Backward(changes) {
+			got[c.Variable] = append(got[c.Variable], fmt.Sprintf("%s→%s+%d", c.OldValue, c.NewValue, c.CompactedReverts))
+		}
+		want := map[string][]string{
+			"a": {"1→2+2", "2→3+0"},
+			"b": {"x1→x2+2", "x2→x3+0"},
+		}
+		for v, w := range want {
+			if !slices.Equal(got[v], w) {
+				t.Errorf("Changes to %s after compaction = %v, want %v", v, got[v], w)
+			}
+		}
+
+		if result, err := b.CompactReverts(ctx, clusterID, time.Hour); err != nil || result.Removed != 0 {
+			t.Errorf("Expected a second compaction to remove nothing, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		b, ctx := newBackend(t)
+		clusterID := clusterFor(t)
+
+		for _, v := range []string{"1", "2"} {
+			if _, err := b.SaveSnapshotWithChanges(ctx, clusterID, []Setting{{Variable: "a", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+
+		if n, err := b.CleanupOldChanges(ctx, clusterID, time.Hour); err != nil || n != 0 {
+			t.Errorf("Expected nothing within retention, got %d, %v", n, err)
+		}
+		if n, err := b.CleanupOldChanges(ctx, clusterID, 0); err != nil || n != 1 {
+			t.Errorf("Expected 1 change removed, got %d, %v", n, err)
+		}
+		if n, err := b.CleanupOldSnapshots(ctx, clusterID, 0); err != nil || n != 2 {
+			t.Errorf("Expected 2 snapshots removed, got %d, %v", n, err)
+		}
+
+		if changes, _ := b.GetChanges(ctx, clusterID, 10); len(changes) != 0 {
+			t.Errorf("Expected no changes after cleanup, got %+v", changes)
+		}
+		if latest, _ := b.GetLatestSnapshot(ctx, clusterID); latest != nil {
+			t.Errorf("Expected no latest snapshot after cleanup, got %+v", latest)
+		}
+	})
+}
@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BackupFormat is the version of the backup archive layout written by Backup.
+const BackupFormat = 1
+
+// backupManifestName is the archive entry describing the backup.
+const backupManifestName = "manifest.json"
+
+// restoreBatchSize is the number of rows inserted per round trip by Restore.
+const restoreBatchSize = 500
+
+type columnKind int
+
+const (
+	textColumn columnKind = iota
+	intColumn
+	timeColumn
+	jsonColumn
+)
+
+// backupColumn is a column of a backed-up table. Columns with ref hold the ID
+// of a row in that table, which Restore rewrites to the row's new ID.
+type backupColumn struct {
+	name string
+	kind columnKind
+	ref  string
+}
+
+// backupTable describes a history table in the backup archive.
+type backupTable struct {
+	name    string
+	columns []backupColumn
+	// serial tables have a generated id column as their first column. Restore
+	// lets the target generate new IDs rather than reusing the source's.
+	serial bool
+	// key orders the rows in the archive.
+	key string
+}
+
+// backupTables lists every history table in the order Restore loads them, so
+// that the tables a row refers to are restored before it. schema_migrations is
+// not backed up: the target's own migrations bring it to the same schema.
+var backupTables = []backupTable{
+	{name: "snapshots", serial: true, key: "id", columns: []backupColumn{
+		{name: "id", kind: intColumn},
+		{name: "collected_at", kind: timeColumn},
+		{name: "cluster_id", kind: textColumn},
+		{name: "query", kind: textColumn},
+		{name: "poll_interval_seconds", kind: intColumn},
+		{name: "label", kind: textColumn},
+	}},
+	{name: "settings", serial: true, key: "id", columns: []backupColumn{
+		{name: "id", kind: intColumn},
+		{name: "snapshot_id", kind: intColumn, ref: "snapshots"},
+		{name: "variable", kind: textColumn},
+		{name: "value", kind: textColumn},
+		{name: "setting_type", kind: textColumn},
+		{name: "description", kind: textColumn},
+		{name: "default_value", kind: textColumn},
+	}},
+	{name: "raw_outputs", key: "snapshot_id", columns: []backupColumn{
+		{name: "snapshot_id", kind: intColumn, ref: "snapshots"},
+		{name: "output", kind: jsonColumn},
+	}},
+	{name: "changes", serial: true, key: "id", columns: []backupColumn{
+		{name: "id", kind: intColumn},
+		{name: "detected_at", kind: timeColumn},
+		{name: "variable", kind: textColumn},
+		{name: "old_value", kind: textColumn},
+		{name: "new_value", kind: textColumn},
+		{name: "description", kind: textColumn},
+		{name: "version", kind: textColumn},
+		{name: "cluster_id", kind: textColumn},
+		{name: "compacted_reverts", kind: intColumn},
+	}},
+	{name: "annotations", serial: true, key: "id", columns: []backupColumn{
+		{name: "id", kind: intColumn},
+		{name: "change_id", kind: intColumn, ref: "changes"},
+		{name: "content", kind: textColumn},
+		{name: "created_by", kind: textColumn},
+		{name: "created_at", kind: timeColumn},
+		{name: "updated_by", kind: textColumn},
+		{name: "updated_at", kind: timeColumn},
+		{name: "severity", kind: textColumn},
+	}},
+	{name: "acknowledgements", key: "change_id", columns: []backupColumn{
+		{name: "change_id", kind: intColumn, ref: "changes"},
+		{name: "acknowledged_by", kind: textColumn},
+		{name: "acknowledged_at", kind: timeColumn},
+	}},
+	{name: "metadata", key: "cluster_id, key", columns: []backupColumn{
+		{name: "cluster_id", kind: textColumn},
+		{name: "key", kind: textColumn},
+		{name: "value", kind: textColumn},
+		{name: "updated_at", kind: timeColumn},
+	}},
+	{name: "subscriptions", serial: true, key: "id", columns: []backupColumn{
+		{name: "id", kind: intColumn},
+		{name: "cluster_id", kind: textColumn},
+		{name: "variable_pattern", kind: textColumn},
+		{name: "target_url", kind: textColumn},
+		{name: "created_by", kind: textColumn},
+		{name: "created_at", kind: timeColumn},
+	}},
+}
+
+// BackupManifest describes a backup archive. It is stored as manifest.json
+// next to one <table>.ndjson entry per table.
+type BackupManifest struct {
+	Format        int              `json:"format"`
+	SchemaVersion int              `json:"schema_version"` // Schema the rows were read from
+	CreatedAt     time.Time        `json:"created_at"`
+	Rows          map[string]int64 `json:"rows"` // Rows written per table
+}
+
+// RestoreSummary reports what Restore loaded.
+type RestoreSummary struct {
+	Rows map[string]int64 // Rows restored per table
+	// Skipped counts the rows dropped because the row they referred to was not
+	// in the backup, such as settings orphaned before the backup was taken.
+	Skipped int64
+}
+
+// Backup writes every history table to w as a zip archive of newline-delimited
+// JSON, one entry per table plus a manifest. All tables are read in a single
+// read-only transaction, so the archive is a consistent copy even while the
+// collector keeps writing.
+func (s *Store) Backup(ctx context.Context, w io.Writer) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Format:        BackupFormat,
+		SchemaVersion: LatestSchemaVersion(),
+		CreatedAt:     time.Now().UTC(),
+		Rows:          make(map[string]int64, len(backupTables)),
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return manifest, err
+	}
+	defer tx.Rollback(ctx)
+
+	zw := zip.NewWriter(w)
+	for _, table := range backupTables {
+		entry, err := zw.Create(table.name + ".ndjson")
+		if err != nil {
+			return manifest, err
+		}
+		n, err := s.backupTable(ctx, tx, table, entry)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to back up %s: %w", table.name, err)
+		}
+		manifest.Rows[table.name] = n
+	}
+
+	entry, err := zw.Create(backupManifestName)
+	if err != nil {
+		return manifest, err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, zw.Close()
+}
+
+// backupTable writes each row of table to w as a JSON object keyed by column.
+func (s *Store) backupTable(ctx context.Context, tx pgx.Tx, table backupTable, w io.Writer) (int64, error) {
+	names := make([]string, len(table.columns))
+	for i, col := range table.columns {
+		names[i] = col.name
+		if col.kind == jsonColumn {
+			names[i] = col.name + "::STRING"
+		}
+	}
+	rows, err := tx.Query(ctx, s.sql(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		strings.Join(names, ", "), table.name, table.key)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	var n int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		row := make(map[string]any, len(values))
+		for i, col := range table.columns {
+			row[col.name] = values[i]
+		}
+		if err := enc.Encode(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// ErrRestoreTargetNotEmpty is returned by Restore when the history database
+// already holds data.
+var ErrRestoreTargetNotEmpty = errors.New("restore target is not empty")
+
+// Restore loads a backup archive written by Backup into an empty history
+// database in a single transaction, so a failed restore leaves nothing behind.
+// Rows get new IDs from the target, and every reference to a snapshot or change
+// is rewritten to match. The metadata values under changeIDKeys hold change IDs
+// too, such as the incremental export marker, and are rewritten to the newest
+// restored change at or before the ID they held.
+func (s *Store) Restore(ctx context.Context, r io.ReaderAt, size int64, changeIDKeys ...string) (RestoreSummary, error) {
+	summary := RestoreSummary{Rows: make(map[string]int64, len(backupTables))}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return summary, fmt.Errorf("not a backup archive: %w", err)
+	}
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	manifest, err := readBackupManifest(entries)
+	if err != nil {
+		return summary, err
+	}
+	for _, table := range backupTables {
+		if entries[table.name+".ndjson"] == nil {
+			return summary, fmt.Errorf("backup archive has no %s.ndjson", table.name)
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range backupTables {
+		var exists bool
+		if err := tx.QueryRow(ctx, s.sql("SELECT EXISTS (SELECT 1 FROM "+table.name+")")).Scan(&exists); err != nil {
+			return summary, fmt.Errorf("failed to check %s: %w", table.name, err)
+		}
+		if exists {
+			return summary, fmt.Errorf("%w: %s has rows", ErrRestoreTargetNotEmpty, table.name)
+		}
+	}
+
+	// newIDs maps each referenced table's IDs in the backup to the restored rows' IDs.
+	newIDs := map[string]map[int64]int64{"snapshots": {}, "changes": {}}
+	for _, table := range backupTables {
+		restored, skipped, err := s.restoreTable(ctx, tx, table, entries[table.name+".ndjson"], newIDs)
+		if err != nil {
+			return summary, fmt.Errorf("failed to restore %s: %w", table.name, err)
+		}
+		if want := manifest.Rows[table.name]; restored+skipped != want {
+			return summary, fmt.Errorf("backup of %s is incomplete: read %d rows, manifest lists %d", table.name, restored+skipped, want)
+		}
+		summary.Rows[table.name] = restored
+		summary.Skipped += skipped
+	}
+
+	if err := s.remapChangeIDKeys(ctx, tx, changeIDKeys, newIDs["changes"]); err != nil {
+		return summary, err
+	}
+	return summary, tx.Commit(ctx)
+}
+
+// readBackupManifest reads and checks the archive's manifest.
+func readBackupManifest(entries map[string]*zip.File) (BackupManifest, error) {
+	var manifest BackupManifest
+	f := entries[backupManifestName]
+	if f == nil {
+		return manifest, fmt.Errorf("backup archive has no %s", backupManifestName)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return manifest, err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("invalid %s: %w", backupManifestName, err)
+	}
+	if manifest.Format != BackupFormat {
+		return manifest, fmt.Errorf("unsupported backup format %d (this build reads format %d)", manifest.Format, BackupFormat)
+	}
+	if manifest.SchemaVersion > LatestSchemaVersion() {
+		return manifest, fmt.Errorf("backup was taken at schema version %d, newer than this build's %d", manifest.SchemaVersion, LatestSchemaVersion())
+	}
+	return manifest, nil
+}
+
+// restoreTable inserts the rows of one archive entry, returning the number
+// restored and the number skipped for referring to rows missing from the backup.
+// For a table in newIDs, it records each row's new ID under its old one.
+func (s *Store) restoreTable(ctx context.Context, tx pgx.Tx, table backupTable, f *zip.File, newIDs map[string]map[int64]int64) (restored, skipped int64, err error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rc.Close()
+
+	columns := table.columns
+	if table.serial {
+		columns = columns[1:]
+	}
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.name, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	ids := newIDs[table.name]
+	if ids != nil {
+		insert += " RETURNING id"
+	}
+	insert = s.sql(insert)
+
+	batch := &pgx.Batch{}
+	var oldIDs []int64
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		br := tx.SendBatch(ctx, batch)
+		for i := 0; i < batch.Len(); i++ {
+			if ids == nil {
+				if _, err := br.Exec(); err != nil {
+					br.Close()
+					return err
+				}
+				continue
+			}
+			var id int64
+			if err := br.QueryRow().Scan(&id); err != nil {
+				br.Close()
+				return err
+			}
+			ids[oldIDs[i]] = id
+		}
+		restored += int64(batch.Len())
+		batch = &pgx.Batch{}
+		oldIDs = oldIDs[:0]
+		return br.Close()
+	}
+
+	dec := json.NewDecoder(rc)
+	// IDs from unique_rowid() exceed a float64's precision
+	dec.UseNumber()
+	for {
+		var row map[string]any
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return restored, skipped, fmt.Errorf("row %d: %w", restored+skipped+int64(batch.Len())+1, err)
+		}
+		args, ok, err := restoreArgs(table, row, newIDs)
+		if err != nil {
+			return restored, skipped, fmt.Errorf("row %d: %w", restored+skipped+int64(batch.Len())+1, err)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		if table.serial {
+			id, err := backupInt(row[table.columns[0].name])
+			if err != nil || id == nil {
+				return restored, skipped, fmt.Errorf("row %d: invalid id", restored+skipped+int64(batch.Len())+1)
+			}
+			oldIDs = append(oldIDs, *id)
+			args = args[1:]
+		}
+		batch.Queue(insert, args...)
+		if batch.Len() >= restoreBatchSize {
+			if err := flush(); err != nil {
+				return restored, skipped, err
+			}
+		}
+	}
+	return restored, skipped, flush()
+}
+
+// restoreArgs converts a decoded row to insert arguments in column order,
+// rewriting references through newIDs. It reports false when the row refers
+// to a row that was not restored.
+func restoreArgs(table backupTable, row map[string]any, newIDs map[string]map[int64]int64) ([]any, bool, error) {
+	args := make([]any, len(table.columns))
+	for i, col := range table.columns {
+		v := row[col.name]
+		switch col.kind {
+		case intColumn:
+			n, err := backupInt(v)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", col.name, err)
+			}
+			if col.ref != "" && n != nil {
+				id, ok := newIDs[col.ref][*n]
+				if !ok {
+					return nil, false, nil
+				}
+				n = &id
+			}
+			if n == nil {
+				args[i] = nil
+			} else {
+				args[i] = *n
+			}
+		case timeColumn:
+			if v == nil {
+				args[i] = nil
+				continue
+			}
+			str, ok := v.(string)
+			if !ok {
+				return nil, false, fmt.Errorf("%s: want a timestamp, got %T", col.name, v)
+			}
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %w", col.name, err)
+			}
+			args[i] = t
+		default:
+			if v == nil {
+				args[i] = nil
+				continue
+			}
+			str, ok := v.(string)
+			if !ok {
+				return nil, false, fmt.Errorf("%s: want a string, got %T", col.name, v)
+			}
+			args[i] = str
+		}
+	}
+	return args, true, nil
+}
+
+// backupInt converts a decoded JSON number to an int64, or nil for null.
+func backupInt(v any) (*int64, error) {
+	if v == nil {
+		return nil, nil
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("want a number, got %T", v)
+	}
+	n, err := num.Int64()
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// remapChangeIDKeys rewrites the restored metadata values under keys, which
+// hold change IDs from the backup, to the newest restored change at or before
+// each. Values that are not IDs are left alone.
+func (s *Store) remapChangeIDKeys(ctx context.Context, tx pgx.Tx, keys []string, changeIDs map[int64]int64) error {
+	for _, key := range keys {
+		rows, err := tx.Query(ctx, s.sql("SELECT cluster_id, value FROM metadata WHERE key = $1"), key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		values := make(map[string]string)
+		for rows.Next() {
+			var clusterID, value string
+			if err := rows.Scan(&clusterID, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			values[clusterID] = value
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		for clusterID, value := range values {
+			old, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, err := tx.Exec(ctx, s.sql("UPDATE metadata SET value = $1 WHERE cluster_id = $2 AND key = $3"),
+				strconv.FormatInt(remapChangeID(old, changeIDs), 10), clusterID, key); err != nil {
+				return fmt.Errorf("failed to update %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// remapChangeID returns the new ID of the newest change whose old ID is at or
+// before old, or 0 when there is none. IDs grow with insertion order in both
+// databases, so a marker meaning "everything up to this change" keeps its meaning.
+func remapChangeID(old int64, changeIDs map[int64]int64) int64 {
+	var newest int64
+	for oldID, newID := range changeIDs {
+		if oldID <= old && newID > newest {
+			newest = newID
+		}
+	}
+	return newest
+}
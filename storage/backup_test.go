@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	source, ctx := setupStoreTest(t, 60*time.Second)
+	cleanupTestData(t, source)
+	t.Cleanup(func() { cleanupTestData(t, source) })
+
+	changeID := saveTestChange(t, ctx, source, "backup.setting")
+	if _, err := source.CreateAnnotation(ctx, changeID, "planned", "info", "alice"); err != nil {
+		t.Fatalf("CreateAnnotation failed: %v", err)
+	}
+	if _, err := source.AcknowledgeChange(ctx, changeID, "bob"); err != nil {
+		t.Fatalf("AcknowledgeChange failed: %v", err)
+	}
+	if _, err := source.CreateSubscription(ctx, testClusterID, "backup.*", "https://example.com/hook", "alice"); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	const markerKey = "last_export_change_id"
+	if err := source.SetMetadata(ctx, testClusterID, markerKey, strconv.FormatInt(changeID, 10)); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := source.Backup(ctx, &buf)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if manifest.Rows["snapshots"] != 2 || manifest.Rows["changes"] != 1 || manifest.Rows["annotations"] != 1 {
+		t.Errorf("manifest rows = %v, want 2 snapshots, 1 change, 1 annotation", manifest.Rows)
+	}
+
+	target, err := New(ctx, getTestDB(t), WithTablePrefix("crdbhist_restore_test_"))
+	if err != nil {
+		t.Fatalf("Failed to create restore target: %v", err)
+	}
+	t.Cleanup(target.Close)
+	truncate := func() {
+		target.pool.Exec(context.Background(), target.sql("TRUNCATE TABLE annotations, acknowledgements, raw_outputs, changes, settings, snapshots, metadata, subscriptions CASCADE"))
+	}
+	truncate()
+	t.Cleanup(truncate)
+
+	summary, err := target.Restore(ctx, bytes.NewReader(buf.Bytes()), int64(buf.Len()), markerKey)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for table, n := range manifest.Rows {
+		if summary.Rows[table] != n {
+			t.Errorf("restored %d %s rows, backed up %d", summary.Rows[table], table, n)
+		}
+	}
+
+	want, err := source.GetChangesWithAnnotations(ctx, testClusterID, 10)
+	if err != nil {
+		t.Fatalf("GetChangesWithAnnotations failed: %v", err)
+	}
+	got, err := target.GetChangesWithAnnotations(ctx, testClusterID, 10)
+	if err != nil {
+		t.Fatalf("GetChangesWithAnnotations failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("restored %d changes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Variable != want[i].Variable || got[i].OldValue != want[i].OldValue || got[i].NewValue != want[i].NewValue || !got[i].DetectedAt.Equal(want[i].DetectedAt) {
+			t.Errorf("change %d = %+v, want %+v", i, got[i].Change, want[i].Change)
+		}
+		if got[i].Annotation == nil || got[i].Annotation.Content != "planned" {
+			t.Errorf("change %d annotation = %+v, want the restored annotation", i, got[i].Annotation)
+		}
+	}
+
+	settings, err := target.GetLatestSnapshot(ctx, testClusterID)
+	if err != nil || len(settings) != 1 || settings["backup.setting"].Value != "v2" {
+		t.Errorf("latest restored snapshot = %+v, %v; want backup.setting = v2", settings, err)
+	}
+	marker, err := target.GetMetadata(ctx, testClusterID, markerKey)
+	if err != nil || marker != strconv.FormatInt(got[0].ID, 10) {
+		t.Errorf("restored export marker = %q, %v; want the restored change's ID %d", marker, err, got[0].ID)
+	}
+
+	if _, err := target.Restore(ctx, bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrRestoreTargetNotEmpty) {
+		t.Errorf("second Restore error = %v, want ErrRestoreTargetNotEmpty", err)
+	}
+}
+
+// testArchive builds a backup archive from a manifest and table entries.
+func testArchive(t *testing.T, manifest *BackupManifest, tables map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if manifest != nil {
+		w, _ := zw.Create(backupManifestName)
+		json.NewEncoder(w).Encode(manifest)
+	}
+	for name, content := range tables {
+		w, _ := zw.Create(name + ".ndjson")
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestRestoreRejectsInvalidArchives(t *testing.T) {
+	allTables := map[string]string{}
+	for _, table := range backupTables {
+		allTables[table.name] = ""
+	}
+	tests := []struct {
+		name     string
+		archive  *bytes.Reader
+		contains string
+	}{
+		{"not a zip", bytes.NewReader([]byte("hello")), "not a backup archive"},
+		{"no manifest", testArchive(t, nil, allTables), "no manifest.json"},
+		{"unknown format", testArchive(t, &BackupManifest{Format: 99}, allTables), "unsupported backup format 99"},
+		{"newer schema", testArchive(t, &BackupManifest{Format: BackupFormat, SchemaVersion: LatestSchemaVersion() + 1}, allTables), "newer than this build"},
+		{"missing table", testArchive(t, &BackupManifest{Format: BackupFormat, SchemaVersion: LatestSchemaVersion()}, nil), "no snapshots.ndjson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Archives are checked before the database is touched
+			_, err := (&Store{}).Restore(context.Background(), tt.archive, tt.archive.Size())
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Restore error = %v, want one containing %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestRestoreArgs(t *testing.T) {
+	settings := backupTables[1]
+	newIDs := map[string]map[int64]int64{"snapshots": {900719925474099267: 7}}
+
+	decode := func(line string) map[string]any {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+
+	args, ok, err := restoreArgs(settings, decode(`{"id":900719925474099301,"snapshot_id":900719925474099267,"variable":"a","value":"1","setting_type":"s","description":null,"default_value":null}`), newIDs)
+	if err != nil || !ok {
+		t.Fatalf("restoreArgs = %v, %v", ok, err)
+	}
+	if args[0] != int64(900719925474099301) {
+		t.Errorf("id = %v, want the exact backed-up ID", args[0])
+	}
+	if args[1] != int64(7) {
+		t.Errorf("snapshot_id = %v, want the restored snapshot's ID 7", args[1])
+	}
+	if args[5] != nil {
+		t.Errorf("description = %v, want nil", args[5])
+	}
+
+	if _, ok, err := restoreArgs(settings, decode(`{"id":1,"snapshot_id":5,"variable":"a","value":"1"}`), newIDs); ok || err != nil {
+		t.Errorf("orphan row: ok = %v, err = %v; want skipped", ok, err)
+	}
+	if _, _, err := restoreArgs(settings, decode(`{"id":"x","snapshot_id":900719925474099267,"variable":"a","value":"1"}`), newIDs); err == nil {
+		t.Error("expected an error for a non-numeric id")
+	}
+}
+
+func TestRemapChangeID(t *testing.T) {
+	changeIDs := map[int64]int64{100: 1, 200: 2, 300: 3}
+	tests := []struct {
+		old, want int64
+	}{
+		{50, 0},
+		{100, 1},
+		{250, 2},
+		{300, 3},
+		{1000, 3},
+	}
+	for _, tt := range tests {
+		if got := remapChangeID(tt.old, changeIDs); got != tt.want {
+			t.Errorf("remapChangeID(%d) = %d, want %d", tt.old, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CompactionResult summarises a revert compaction run.
+type CompactionResult struct {
+	Removed   int64 `json:"removed"`   // Intermediate changes deleted
+	Sequences int64 `json:"sequences"` // Revert sequences collapsed
+}
+
+// compactEntry is one change as seen by planRevertCompaction.
+type compactEntry struct {
+	DetectedAt time.Time
+	OldValue   string
+	NewValue   string
+	Compacted  int64 // changes already folded into this one
+	Protected  bool  // annotated changes are never removed
+}
+
+// compactPlan is the outcome of planning one variable's compaction: the indexes
+// to delete, and the new compacted count of each change that absorbed others.
+type compactPlan struct {
+	remove    []int
+	counts    map[int]int64
+	sequences int64
+}
+
+// planRevertCompaction plans the compaction of one variable's changes, given
+// oldest first. A run of changes that starts from a value and returns to it
+// within window has no net effect, so it is removed and counted on the change
+// before it, which stays. The values either side of the run match, so the
+// remaining changes still chain old → new, and the first change's old value
+// and the last change's new value are untouched. Runs that include a protected
+// change are left alone, as is any run at the very start, which has no earlier
+// change to carry its count.
+func planRevertCompaction(entries []compactEntry, window time.Duration) compactPlan {
+	plan := compactPlan{counts: make(map[int]int64)}
+	var kept []int // indexes into entries, oldest first
+	counts := make([]int64, len(entries))
+	for i, e := range entries {
+		counts[i] = e.Compacted
+	}
+
+	for i, e := range entries {
+		kept = append(kept, i)
+
+		// Find the earliest kept change within window that this one undoes, not
+		// crossing a protected change.
+		start := -1
+		for j := len(kept) - 1; j >= 1; j-- {
+			k := entries[kept[j]]
+			if e.DetectedAt.Sub(k.DetectedAt) > window || k.Protected {
+				break
+			}
+			if k.OldValue == e.NewValue {
+				start = j
+			}
+		}
+		if start < 0 {
+			continue
+		}
+
+		carrier := kept[start-1]
+		for _, idx := range kept[start:] {
+			counts[carrier] += 1 + counts[idx]
+			plan.remove = append(plan.remove, idx)
+			delete(plan.counts, idx)
+		}
+		plan.counts[carrier] = counts[carrier]
+		plan.sequences++
+		kept = kept[:start]
+	}
+	return plan
+}
+
+// compactVariables groups a cluster's changes by variable, each oldest first,
+// plans each group's compaction and reports the plans through apply, with the
+// group's positions in the input.
+func compactVariables(variables []string, entries []compactEntry, window time.Duration, apply func(positions []int, plan compactPlan)) CompactionResult {
+	groups := make(map[string][]int)
+	var order []string
+	for i, v := range variables {
+		if _, ok := groups[v]; !ok {
+			order = append(order, v)
+		}
+		groups[v] = append(groups[v], i)
+	}
+
+	var result CompactionResult
+	for _, v := range order {
+		positions := groups[v]
+		group := make([]compactEntry, len(positions))
+		for i, p := range positions {
+			group[i] = entries[p]
+		}
+		plan := planRevertCompaction(group, window)
+		if len(plan.remove) == 0 {
+			continue
+		}
+		result.Removed += int64(len(plan.remove))
+		result.Sequences += plan.sequences
+		apply(positions, plan)
+	}
+	return result
+}
+
+// CompactReverts collapses runs of a cluster's changes that return a setting to
+// an earlier value within window, keeping the change before each run and
+// counting the run on it as CompactedReverts. Annotated changes are never
+// removed. Unlike retention cleanup, the net effect of the history is kept.
+func (s *Store) CompactReverts(ctx context.Context, clusterID string, window time.Duration) (CompactionResult, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		s.sql(`SELECT c.id, c.variable, c.detected_at, COALESCE(c.old_value, ''), COALESCE(c.new_value, ''), c.compacted_reverts,
+		        EXISTS (SELECT 1 FROM annotations a WHERE a.change_id = c.id)
+		 FROM changes c
+		 WHERE c.cluster_id = $1
+		 ORDER BY c.variable, c.detected_at, c.id
+		 FOR UPDATE`),
+		clusterID,
+	)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	var ids []int64
+	var variables []string
+	var entries []compactEntry
+	for rows.Next() {
+		var id int64
+		var variable string
+		var e compactEntry
+		if err := rows.Scan(&id, &variable, &e.DetectedAt, &e.OldValue, &e.NewValue, &e.Compacted, &e.Protected); err != nil {
+			rows.Close()
+			return CompactionResult{}, err
+		}
+		ids = append(ids, id)
+		variables = append(variables, variable)
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return CompactionResult{}, err
+	}
+
+	var remove []int64
+	batch := &pgx.Batch{}
+	result := compactVariables(variables, entries, window, func(positions []int, plan compactPlan) {
+		for _, i := range plan.remove {
+			remove = append(remove, ids[positions[i]])
+		}
+		for i, count := range plan.counts {
+			batch.Queue(s.sql("UPDATE changes SET compacted_reverts = $2 WHERE id = $1"), ids[positions[i]], count)
+		}
+	})
+	if result.Removed == 0 {
+		return result, nil
+	}
+
+	batch.Queue(s.sql("DELETE FROM changes WHERE id = ANY($1)"), remove)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return CompactionResult{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return CompactionResult{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// compactSequence builds entries for a variable that took each of values in
+// turn, one minute apart.
+func compactSequence(values ...string) []compactEntry {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := make([]compactEntry, len(values)-1)
+	for i := range entries {
+		entries[i] = compactEntry{
+			DetectedAt: start.Add(time.Duration(i) * time.Minute),
+			OldValue:   values[i],
+			NewValue:   values[i+1],
+		}
+	}
+	return entries
+}
+
+// applyCompactPlan returns the entries plan keeps, with their updated counts.
+func applyCompactPlan(entries []compactEntry, plan compactPlan) []compactEntry {
+	var kept []compactEntry
+	for i, e := range entries {
+		if slices.Contains(plan.remove, i) {
+			continue
+		}
+		if count, ok := plan.counts[i]; ok {
+			e.Compacted = count
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+func TestPlanRevertCompaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []compactEntry
+		window    time.Duration
+		wantKept  int
+		wantCount int64 // total compacted count across kept entries
+	}{
+		{"oscillation", compactSequence("a", "b", "a", "b", "a", "b", "c"), time.Hour, 2, 4},
+		{"no revert", compactSequence("a", "b", "c", "d"), time.Hour, 3, 0},
+		{"revert at the start has no carrier", compactSequence("a", "b", "a"), time.Hour, 2, 0},
+		{"longer loop", compactSequence("a", "b", "c", "d", "b", "e"), time.Hour, 2, 3},
+		{"outside window", compactSequence("a", "b", "c", "b", "d"), 30 * time.Second, 4, 0},
+		{"inside window", compactSequence("a", "b", "c", "b", "d"), time.Minute, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planRevertCompaction(tt.entries, tt.window)
+			kept := applyCompactPlan(tt.entries, plan)
+
+			if len(kept) != tt.wantKept {
+				t.Errorf("Kept %d of %d changes, want %d", len(kept), len(tt.entries), tt.wantKept)
+			}
+			var total int64
+			for _, e := range kept {
+				total += e.Compacted
+			}
+			if total != tt.wantCount || total != int64(len(plan.remove)) {
+				t.Errorf("Compacted count = %d with %d removed, want %d", total, len(plan.remove), tt.wantCount)
+			}
+
+			// The net effect is kept: the history still starts and ends at the same
+			// values, and each change starts where the previous one ended.
+			if kept[0].OldValue != tt.entries[0].OldValue || kept[len(kept)-1].NewValue != tt.entries[len(tt.entries)-1].NewValue {
+				t.Errorf("Net effect changed: %+v", kept)
+			}
+			for i := 1; i < len(kept); i++ {
+				if kept[i].OldValue != kept[i-1].NewValue {
+					t.Errorf("Change %d starts at %q, but the previous one ended at %q", i, kept[i].OldValue, kept[i-1].NewValue)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanRevertCompactionKeepsProtected(t *testing.T) {
+	entries := compactSequence("a", "b", "c", "b", "a", "d")
+	entries[2].Protected = true // c → b
+
+	kept := applyCompactPlan(entries, planRevertCompaction(entries, time.Hour))
+	for _, e := range kept {
+		if e.Protected {
+			return
+		}
+	}
+	t.Errorf("Protected change was removed: %+v", kept)
+}
+
+func TestPlanRevertCompactionAccumulatesCounts(t *testing.T) {
+	entries := compactSequence("a", "b", "c", "b", "d")
+	entries[0].Compacted = 3 // from an earlier run
+
+	plan := planRevertCompaction(entries, time.Hour)
+	if plan.counts[0] != 5 || plan.sequences != 1 {
+		t.Errorf("Expected the first change to carry 5 in 1 sequence, got %v in %d", plan.counts, plan.sequences)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Backend names reported by Diagnostics.
+const (
+	BackendCockroachDB = "cockroachdb"
+	BackendFile        = "file"
+)
+
+// SchemaObject is a table, column, or index the current schema includes.
+type SchemaObject struct {
+	Kind    string `json:"kind"`           // "table", "column", or "index"
+	Table   string `json:"table"`          // Unprefixed table name
+	Name    string `json:"name,omitempty"` // Column or index name (empty for a table)
+	Present bool   `json:"present"`
+}
+
+// Diagnostics describes a store's backend and schema, for support.
+type Diagnostics struct {
+	Backend             string         `json:"backend"`
+	SchemaVersion       int            `json:"schema_version"`        // Newest applied migration (0 for file storage)
+	LatestSchemaVersion int            `json:"latest_schema_version"` // Newest migration this build knows
+	SchemaComplete      bool           `json:"schema_complete"`       // Every expected object is present
+	Objects             []SchemaObject `json:"objects"`
+}
+
+// expectedSchema lists the columns of each table after every migration has run.
+// Keep it in step with migrations.
+var expectedSchema = []struct {
+	table   string
+	columns []string
+	indexes []string
+}{
+	{"snapshots", []string{"id", "collected_at", "cluster_id", "query", "poll_interval_seconds", "label"}, []string{"idx_snapshots_cluster"}},
+	{"settings", []string{"id", "snapshot_id", "variable", "value", "setting_type", "description", "default_value"}, []string{"idx_settings_snapshot"}},
+	{"changes", []string{"id", "detected_at", "variable", "old_value", "new_value", "description", "version", "cluster_id", "compacted_reverts"}, []string{"idx_changes_detected", "idx_changes_cluster"}},
+	{"metadata", []string{"cluster_id", "key", "value", "updated_at"}, nil},
+	{"annotations", []string{"id", "change_id", "content", "created_by", "created_at", "updated_by", "updated_at", "severity"}, nil},
+	{"subscriptions", []string{"id", "cluster_id", "variable_pattern", "target_url", "created_by", "created_at"}, []string{"idx_subscriptions_cluster"}},
+	{"acknowledgements", []string{"change_id", "acknowledged_by", "acknowledged_at"}, nil},
+	{"raw_outputs", []string{"snapshot_id", "output"}, nil},
+	{"schema_migrations", []string{"version", "applied_at"}, nil},
+}
+
+// Diagnostics probes information_schema for every table, column, and index the
+// schema should have, and reports the applied schema version.
+func (s *Store) Diagnostics(ctx context.Context) (*Diagnostics, error) {
+	tables, err := s.schemaNames(ctx, "SELECT table_name, '' FROM information_schema.tables")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	columns, err := s.schemaNames(ctx, "SELECT table_name, column_name FROM information_schema.columns")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	indexes, err := s.schemaNames(ctx, "SELECT DISTINCT table_name, index_name FROM information_schema.statistics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	d := &Diagnostics{
+		Backend:             BackendCockroachDB,
+		LatestSchemaVersion: LatestSchemaVersion(),
+		SchemaComplete:      true,
+		Objects:             []SchemaObject{},
+	}
+	add := func(kind, table, name string, found map[[2]string]bool) {
+		// Table names carry the store's prefix; column and index names do not
+		present := found[[2]string{string(s.prefix) + table, name}]
+		d.Objects = append(d.Objects, SchemaObject{Kind: kind, Table: table, Name: name, Present: present})
+		d.SchemaComplete = d.SchemaComplete && present
+	}
+	for _, t := range expectedSchema {
+		add("table", t.table, "", tables)
+		for _, c := range t.columns {
+			add("column", t.table, c, columns)
+		}
+		for _, i := range t.indexes {
+			add("index", t.table, i, indexes)
+		}
+	}
+
+	if tables[[2]string{string(s.prefix) + "schema_migrations", ""}] {
+		migrations, err := s.SchemaMigrations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema migrations: %w", err)
+		}
+		for _, m := range migrations {
+			d.SchemaVersion = max(d.SchemaVersion, m.Version)
+		}
+	}
+	return d, nil
+}
+
+// schemaNames runs an information_schema query returning (table, name) pairs.
+// The query is not rewritten for the table prefix, since it names no store table.
+func (s *Store) schemaNames(ctx context.Context, query string) (map[[2]string]bool, error) {
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[[2]string]bool)
+	for rows.Next() {
+		var table, name string
+		if err := rows.Scan(&table, &name); err != nil {
+			return nil, err
+		}
+		names[[2]string{table, name}] = true
+	}
+	return names, rows.Err()
+}
+
+// Diagnostics reports the file backend, which has no schema to probe.
+func (s *FileStore) Diagnostics(ctx context.Context) (*Diagnostics, error) {
+	return &Diagnostics{
+		Backend:             BackendFile,
+		LatestSchemaVersion: LatestSchemaVersion(),
+		SchemaComplete:      true,
+		Objects:             []SchemaObject{},
+	}, nil
+}
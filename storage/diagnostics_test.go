@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics(t *testing.T) {
+	store, ctx := setupStoreTest(t, 30*time.Second)
+
+	d, err := store.Diagnostics(ctx)
+	if err != nil {
+		t.Fatalf("Diagnostics failed: %v", err)
+	}
+	if d.Backend != BackendCockroachDB {
+		t.Errorf("Backend = %q, want %q", d.Backend, BackendCockroachDB)
+	}
+	if d.SchemaVersion != LatestSchemaVersion() || d.LatestSchemaVersion != LatestSchemaVersion() {
+		t.Errorf("Expected schema at the latest version %d, got %d of %d", LatestSchemaVersion(), d.SchemaVersion, d.LatestSchemaVersion)
+	}
+	for _, o := range d.Objects {
+		if !o.Present {
+			t.Errorf("Expected %s %s.%s on a freshly migrated database", o.Kind, o.Table, o.Name)
+		}
+	}
+	if !d.SchemaComplete {
+		t.Error("Expected a complete schema")
+	}
+}
+
+func TestExpectedSchemaMatchesMigrations(t *testing.T) {
+	var all strings.Builder
+	for _, m := range migrations {
+		all.WriteString(m.sql)
+	}
+	sql := all.String()
+
+	for _, table := range expectedSchema {
+		if table.table == "schema_migrations" {
+			continue // created by initAndMigrate
+		}
+		if !strings.Contains(sql, "CREATE TABLE IF NOT EXISTS "+table.table+" (") {
+			t.Errorf("No migration creates table %s", table.table)
+		}
+		for _, name := range append(table.columns, table.indexes...) {
+			if !strings.Contains(sql, name) {
+				t.Errorf("No migration creates %s.%s", table.table, name)
+			}
+		}
+	}
+}
+
+func TestMigrationsAreInExpectedSchema(t *testing.T) {
+	listed := map[string]bool{}
+	for _, table := range expectedSchema {
+		listed[table.table] = true
+		for _, c := range table.columns {
+			listed[table.table+"."+c] = true
+		}
+	}
+
+	createRe := regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`)
+	addColumnRe := regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+	for _, m := range migrations {
+		for _, match := range createRe.FindAllStringSubmatch(m.sql, -1) {
+			if !listed[match[1]] {
+				t.Errorf("Migration %d creates table %s, which expectedSchema does not list", m.version, match[1])
+			}
+		}
+		for _, match := range addColumnRe.FindAllStringSubmatch(m.sql, -1) {
+			if !listed[match[1]+"."+match[2]] {
+				t.Errorf("Migration %d adds column %s.%s, which expectedSchema does not list", m.version, match[1], match[2])
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportSummary totals the changes written to an export, for a summary file
+// alongside the data. Add each exported change, then write it with WriteCSV.
+// Kinds are judged from the values as exported: an empty old value is an added
+// setting and an empty new value a removed one, so redacted changes count as
+// modified.
+type ExportSummary struct {
+	Total     int
+	Added     int
+	Removed   int
+	Modified  int
+	First     time.Time // Earliest detected_at, zero without changes
+	Last      time.Time // Latest detected_at, zero without changes
+	variables map[string]struct{}
+}
+
+// Add counts one exported change.
+func (s *ExportSummary) Add(c Change) {
+	s.Total++
+	switch {
+	case c.OldValue == "" && c.NewValue != "":
+		s.Added++
+	case c.NewValue == "" && c.OldValue != "":
+		s.Removed++
+	default:
+		s.Modified++
+	}
+	if s.First.IsZero() || c.DetectedAt.Before(s.First) {
+		s.First = c.DetectedAt
+	}
+	if c.DetectedAt.After(s.Last) {
+		s.Last = c.DetectedAt
+	}
+	if s.variables == nil {
+		s.variables = make(map[string]struct{})
+	}
+	s.variables[c.Variable] = struct{}{}
+}
+
+// Variables returns the number of distinct variables changed.
+func (s *ExportSummary) Variables() int {
+	return len(s.variables)
+}
+
+// WriteCSV writes the summary as metric,value rows, with the time range
+// rendered in format. The range is left blank when there were no changes.
+func (s *ExportSummary) WriteCSV(w io.Writer, format TimestampFormat) error {
+	var first, last string
+	if s.Total > 0 {
+		first, last = format.Format(s.First), format.Format(s.Last)
+	}
+	cw := csv.NewWriter(w)
+	cw.WriteAll([][]string{
+		{"metric", "value"},
+		{"total_changes", strconv.Itoa(s.Total)},
+		{"distinct_variables", strconv.Itoa(s.Variables())},
+		{"first_detected_at", first},
+		{"last_detected_at", last},
+		{"added", strconv.Itoa(s.Added)},
+		{"removed", strconv.Itoa(s.Removed)},
+		{"modified", strconv.Itoa(s.Modified)},
+	})
+	return cw.Error()
+}
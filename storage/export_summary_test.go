@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestExportSummary(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	changes := []Change{
+		{ClusterID: "prod", DetectedAt: base.Add(2 * time.Hour), Variable: "a", OldValue: "1", NewValue: "2"},
+		{ClusterID: "prod", DetectedAt: base, Variable: "b", OldValue: "", NewValue: "on"},
+		{ClusterID: "prod", DetectedAt: base.Add(time.Hour), Variable: "c", OldValue: "x", NewValue: ""},
+		{ClusterID: "prod", DetectedAt: base.Add(3 * time.Hour), Variable: "a", OldValue: "2", NewValue: "3"},
+	}
+
+	// Write the changes as an export would, then check the summary against the
+	// rows actually written.
+	var data bytes.Buffer
+	cw := NewCSVChangeWriter(&data)
+	if err := cw.WriteHeader(); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	var summary ExportSummary
+	for _, c := range changes {
+		if err := cw.WriteChange(c); err != nil {
+			t.Fatalf("WriteChange failed: %v", err)
+		}
+		summary.Add(c)
+	}
+	cw.Flush()
+
+	rows, err := csv.NewReader(&data).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse export: %v", err)
+	}
+	rows = rows[1:]
+	variables := make(map[string]bool)
+	var added, removed, modified int
+	first, last := rows[0][1], rows[0][1]
+	for _, row := range rows {
+		variables[row[2]] = true
+		switch {
+		case row[4] == "":
+			added++
+		case row[5] == "":
+			removed++
+		default:
+			modified++
+		}
+		first, last = min(first, row[1]), max(last, row[1])
+	}
+
+	var out bytes.Buffer
+	if err := summary.WriteCSV(&out, TimestampFormat{}); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	summaryRows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse summary: %v", err)
+	}
+	got := make(map[string]string)
+	for _, row := range summaryRows[1:] {
+		got[row[0]] = row[1]
+	}
+	want := map[string]string{
+		"total_changes":      "4",
+		"distinct_variables": "3",
+		"first_detected_at":  "2026-03-01T12:00:00Z",
+		"last_detected_at":   "2026-03-01T15:00:00Z",
+		"added":              "1",
+		"removed":            "1",
+		"modified":           "2",
+	}
+	for metric, value := range want {
+		if got[metric] != value {
+			t.Errorf("%s: expected %q, got %q", metric, value, got[metric])
+		}
+	}
+	if len(rows) != summary.Total || len(variables) != summary.Variables() ||
+		added != summary.Added || removed != summary.Removed || modified != summary.Modified ||
+		first != got["first_detected_at"] || last != got["last_detected_at"] {
+		t.Errorf("Summary %+v does not match the %d exported rows", got, len(rows))
+	}
+}
+
+func TestExportSummaryEmpty(t *testing.T) {
+	var summary ExportSummary
+	var out bytes.Buffer
+	if err := summary.WriteCSV(&out, TimestampFormat{}); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	want := "metric,value\ntotal_changes,0\ndistinct_variables,0\nfirst_detected_at,\nlast_detected_at,\nadded,0\nremoved,0\nmodified,0\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+}
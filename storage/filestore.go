@@ -0,0 +1,1138 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported is returned by FileStore for features that require the history database.
+var ErrNotSupported = errors.New("not supported by the file store")
+
+const (
+	fileChangesName     = "changes.jsonl"
+	fileMetadataName    = "metadata.json"
+	fileSnapshotsDir    = "snapshots"
+	fileSnapshotTimeFmt = "20060102T150405.000000000Z"
+	fileDirPerm         = 0o750
+	filePerm            = 0o640
+)
+
+// FileStore keeps history as flat files for environments that cannot run a
+// separate history database. Each cluster gets its own directory under the
+// data directory:
+//
+//	<dir>/<cluster>/changes.jsonl                      append-only, one change per line
+//	<dir>/<cluster>/snapshots/<id>-<collected_at>.json one file per collection
+//	<dir>/<cluster>/metadata.json                      source cluster ID and version
+//
+// The files can be copied elsewhere (e.g. with rsync) while the server runs.
+//
+// Limitations: there are no SQL queries, so all changes and the snapshot index
+// are held in memory and loaded at startup; annotations, acknowledgements, and
+// subscriptions are not supported (ErrNotSupported); and writes are not transactional, so a crash
+// between appending changes and writing the snapshot can record a change twice.
+type FileStore struct {
+	dir string
+
+	mu             sync.RWMutex
+	changes        map[string][]fileChange // per cluster, oldest first
+	snapshots      map[int64]fileSnapshotRef
+	latest         map[string]*snapshotFile // most recent snapshot per cluster
+	metadata       map[string]map[string]string
+	nextChangeID   int64
+	nextSnapshotID int64
+	diff           DiffOptions // how values are compared for change detection
+}
+
+// fileChange is a line in changes.jsonl.
+type fileChange struct {
+	ID int64 `json:"id"`
+	Change
+}
+
+// fileSnapshotRef locates a snapshot file without holding its settings in memory.
+type fileSnapshotRef struct {
+	info SnapshotInfo
+	path string
+}
+
+// snapshotFile is the contents of a snapshot file.
+type snapshotFile struct {
+	ID          int64           `json:"id"`
+	ClusterID   string          `json:"cluster_id"`
+	CollectedAt time.Time       `json:"collected_at"`
+	Query       string          `json:"query,omitempty"`
+	PollSeconds int64           `json:"poll_interval_seconds,omitempty"`
+	Label       string          `json:"label,omitempty"`
+	Settings    []fileSetting   `json:"settings"`
+	RawOutput   json.RawMessage `json:"raw_output,omitempty"`
+}
+
+type fileSetting struct {
+	Variable     string `json:"variable"`
+	Value        string `json:"value"`
+	SettingType  string `json:"setting_type"`
+	Description  string `json:"description"`
+	DefaultValue string `json:"default_value,omitempty"`
+}
+
+func (f *snapshotFile) settingsMap() map[string]Setting {
+	settings := make(map[string]Setting, len(f.Settings))
+	for _, fs := range f.Settings {
+		settings[fs.Variable] = Setting(fs)
+	}
+	return settings
+}
+
+// WithDiffOptions sets how values are compared when detecting changes. Call it
+// before the store is used.
+func (s *FileStore) WithDiffOptions(opts DiffOptions) *FileStore {
+	s.diff = opts
+	return s
+}
+
+// NewFileStore opens (creating if needed) a file store rooted at dir and loads
+// its index into memory.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, fileDirPerm); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:            dir,
+		changes:        make(map[string][]fileChange),
+		snapshots:      make(map[int64]fileSnapshotRef),
+		latest:         make(map[string]*snapshotFile),
+		metadata:       make(map[string]map[string]string),
+		nextChangeID:   1,
+		nextSnapshotID: 1,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if err := s.loadCluster(e.Name()); err != nil {
+			return nil, fmt.Errorf("loading cluster %s: %w", e.Name(), err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) loadCluster(clusterID string) error {
+	dir := filepath.Join(s.dir, clusterID)
+
+	if err := s.loadChanges(clusterID, filepath.Join(dir, fileChangesName)); err != nil {
+		return err
+	}
+	if err := s.loadSnapshots(clusterID, filepath.Join(dir, fileSnapshotsDir)); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, fileMetadataName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var md map[string]string
+		if err := json.Unmarshal(data, &md); err != nil {
+			return fmt.Errorf("%s: %w", fileMetadataName, err)
+		}
+		s.metadata[clusterID] = md
+	}
+	return nil
+}
+
+func (s *FileStore) loadChanges(clusterID, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		offset := dec.InputOffset()
+		var c fileChange
+		err := dec.Decode(&c)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// A partial last line from an interrupted append; drop it so new lines start cleanly
+			slog.Warn("Truncating partial line in changes file", "path", path, "offset", offset)
+			return truncateFile(path, offset)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		c.ClusterID = clusterID // the directory name is authoritative
+		s.changes[clusterID] = append(s.changes[clusterID], c)
+		if c.ID >= s.nextChangeID {
+			s.nextChangeID = c.ID + 1
+		}
+	}
+}
+
+// truncateFile cuts path to size, keeping the trailing newline of the last complete line.
+func truncateFile(path string, size int64) error {
+	if size > 0 {
+		size++
+	}
+	return os.Truncate(path, size)
+}
+
+func (s *FileStore) loadSnapshots(clusterID, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var latest *fileSnapshotRef
+	for _, e := range entries {
+		info, ok := parseSnapshotFileName(e.Name())
+		if !ok {
+			continue
+		}
+		info.ClusterID = clusterID
+		ref := fileSnapshotRef{info: info, path: filepath.Join(dir, e.Name())}
+		s.snapshots[info.ID] = ref
+		if info.ID >= s.nextSnapshotID {
+			s.nextSnapshotID = info.ID + 1
+		}
+		if latest == nil || info.CollectedAt.After(latest.info.CollectedAt) {
+			latest = &ref
+		}
+	}
+
+	if latest != nil {
+		snap, err := readSnapshotFile(latest.path)
+		if err != nil {
+			return err
+		}
+		s.latest[clusterID] = snap
+	}
+	return nil
+}
+
+func snapshotFileName(id int64, collectedAt time.Time) string {
+	return strconv.FormatInt(id, 10) + "-" + collectedAt.UTC().Format(fileSnapshotTimeFmt) + ".json"
+}
+
+// parseSnapshotFileName extracts the ID and collection time from a snapshot file name.
+func parseSnapshotFileName(name string) (SnapshotInfo, bool) {
+	base, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return SnapshotInfo{}, false // including leftover temporary files
+	}
+	idStr, ts, ok := strings.Cut(base, "-")
+	if !ok {
+		return SnapshotInfo{}, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return SnapshotInfo{}, false
+	}
+	collectedAt, err := time.Parse(fileSnapshotTimeFmt, ts)
+	if err != nil {
+		return SnapshotInfo{}, false
+	}
+	return SnapshotInfo{ID: id, CollectedAt: collectedAt}, true
+}
+
+func readSnapshotFile(path string) (*snapshotFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so readers (and rsync) never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// clusterDir returns the directory for a cluster, rejecting IDs that would escape the data directory.
+func (s *FileStore) clusterDir(clusterID string) (string, error) {
+	if clusterID == "" || clusterID == "." || clusterID == ".." || strings.ContainsAny(clusterID, `/\`) {
+		return "", fmt.Errorf("invalid cluster ID %q", clusterID)
+	}
+	return filepath.Join(s.dir, clusterID), nil
+}
+
+// Close is a no-op; every write is flushed to disk before it returns.
+func (s *FileStore) Close() {}
+
+// Ping verifies that the data directory is accessible.
+func (s *FileStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+// SaveSnapshot stores a snapshot and records changes against the previous one.
+func (s *FileStore) SaveSnapshot(ctx context.Context, clusterID string, settings []Setting, version string) error {
+	_, err := s.SaveSnapshotWithChanges(ctx, clusterID, settings, version)
+	return err
+}
+
+// SaveSnapshotWithChanges appends the detected changes to the cluster's changes
+// file, writes a new snapshot file, and returns the changes.
+func (s *FileStore) SaveSnapshotWithChanges(ctx context.Context, clusterID string, settings []Setting, version string) ([]Change, error) {
+	return s.SaveCollectedSnapshot(ctx, clusterID, settings, version, DefaultCollectionQuery, 0, "", nil)
+}
+
+// SaveCollectedSnapshot stores a snapshot like SaveSnapshotWithChanges, recording
+// the query that produced the settings, the poll interval, and the snapshot label
+// in the snapshot file.
+func (s *FileStore) SaveCollectedSnapshot(ctx context.Context, clusterID string, settings []Setting, version, query string, pollInterval time.Duration, label string, raw json.RawMessage) ([]Change, error) {
+	dir, err := s.clusterDir(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(dir, fileSnapshotsDir), fileDirPerm); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	settings = dedupeSettings(clusterID, settings)
+	current := make(map[string]Setting, len(settings))
+	for _, setting := range settings {
+		current[setting.Variable] = setting
+	}
+
+	// A requested rebaseline saves this snapshot without comparing it to the last.
+	var prev map[string]Setting
+	rebaseline := s.metadata[clusterID][metadataRebaseline] != ""
+	if snap := s.latest[clusterID]; snap != nil && !rebaseline {
+		prev = snap.settingsMap()
+	}
+
+	changes := detectChanges(clusterID, prev, current, now, version, s.diff)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Variable < changes[j].Variable })
+
+	// Changes are written before the snapshot: if the snapshot write fails, the next
+	// collection detects the same changes again rather than losing them.
+	records := make([]fileChange, len(changes))
+	for i, c := range changes {
+		records[i] = fileChange{ID: s.nextChangeID + int64(i), Change: c}
+	}
+	if err := appendChanges(filepath.Join(dir, fileChangesName), records); err != nil {
+		return nil, err
+	}
+	s.changes[clusterID] = append(s.changes[clusterID], records...)
+	s.nextChangeID += int64(len(records))
+
+	snap := &snapshotFile{
+		ID:          s.nextSnapshotID,
+		ClusterID:   clusterID,
+		CollectedAt: now,
+		Query:       query,
+		PollSeconds: int64(max(pollInterval, 0) / time.Second),
+		Label:       label,
+		Settings:    make([]fileSetting, len(settings)),
+		RawOutput:   raw,
+	}
+	for i, setting := range settings {
+		snap.Settings[i] = fileSetting(setting)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fileSnapshotsDir, snapshotFileName(snap.ID, now))
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	s.snapshots[snap.ID] = fileSnapshotRef{
+		info: SnapshotInfo{ID: snap.ID, ClusterID: clusterID, CollectedAt: now, Query: query, PollIntervalSeconds: snap.PollSeconds, Label: label},
+		path: path,
+	}
+	snap.RawOutput = nil // read back from the file when asked for; not kept in memory
+	s.latest[clusterID] = snap
+	s.nextSnapshotID++
+
+	if rebaseline {
+		md := make(map[string]string, len(s.metadata[clusterID]))
+		for k, v := range s.metadata[clusterID] {
+			if k != metadataRebaseline {
+				md[k] = v
+			}
+		}
+		if err := s.writeMetadataLocked(dir, clusterID, md); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// appendChanges appends records to a JSONL file and syncs it.
+func appendChanges(path string, records []fileChange) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, filePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// GetLatestSnapshot returns the most recent snapshot's settings, or nil if there are none.
+func (s *FileStore) GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]Setting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := s.latest[clusterID]
+	if snap == nil {
+		return nil, nil
+	}
+	return snap.settingsMap(), nil
+}
+
+// GetSettingsAt reconstructs a cluster's effective settings at a point in time:
+// those of the latest snapshot collected at or before at. Returns nil, nil if the
+// cluster has no snapshot that old.
+func (s *FileStore) GetSettingsAt(ctx context.Context, clusterID string, at time.Time) (map[string]Setting, error) {
+	s.mu.RLock()
+	var found *fileSnapshotRef
+	for _, ref := range s.snapshots {
+		if ref.info.ClusterID != clusterID || ref.info.CollectedAt.After(at) {
+			continue
+		}
+		if found == nil || ref.info.CollectedAt.After(found.info.CollectedAt) {
+			found = &ref
+		}
+	}
+	s.mu.RUnlock()
+	if found == nil {
+		return nil, nil
+	}
+
+	snap, err := readSnapshotFile(found.path)
+	if os.IsNotExist(err) {
+		return nil, nil // removed by cleanup since the lookup
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap.settingsMap(), nil
+}
+
+// ListSnapshots returns recent snapshots for a cluster, ordered by most recent first.
+func (s *FileStore) ListSnapshots(ctx context.Context, clusterID string, limit int) ([]SnapshotInfo, error) {
+	s.mu.RLock()
+	var refs []fileSnapshotRef
+	for _, ref := range s.snapshots {
+		if ref.info.ClusterID == clusterID {
+			refs = append(refs, ref)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].info.CollectedAt.After(refs[j].info.CollectedAt) })
+	if len(refs) > limit {
+		refs = refs[:limit]
+	}
+
+	snapshots := make([]SnapshotInfo, len(refs))
+	for i, ref := range refs {
+		if ref.info.Query == "" {
+			ref.info = s.loadSnapshotDetails(ref)
+		}
+		snapshots[i] = ref.info
+	}
+	return snapshots, nil
+}
+
+// loadSnapshotDetails reads the query, poll interval, and label of a snapshot
+// loaded at startup, whose index entry only has what the file name encodes, and
+// caches them in the index.
+func (s *FileStore) loadSnapshotDetails(ref fileSnapshotRef) SnapshotInfo {
+	info := ref.info
+	snap, err := readSnapshotFile(ref.path)
+	if err != nil {
+		// Removed by cleanup since the lookup, or unreadable; GetSnapshotByID reports the latter
+		info.Query = DefaultCollectionQuery
+		return info
+	}
+	info.Query = snap.Query
+	if info.Query == "" {
+		info.Query = DefaultCollectionQuery // written before the query was recorded
+	}
+	info.PollIntervalSeconds = snap.PollSeconds
+	info.Label = snap.Label
+
+	s.mu.Lock()
+	if cached, ok := s.snapshots[ref.info.ID]; ok {
+		cached.info = info
+		s.snapshots[ref.info.ID] = cached
+	}
+	s.mu.Unlock()
+	return info
+}
+
+// GetSnapshotByID retrieves all settings for a specific snapshot by its ID.
+// Returns nil, nil if the snapshot does not exist.
+func (s *FileStore) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[string]Setting, error) {
+	s.mu.RLock()
+	ref, ok := s.snapshots[snapshotID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	snap, err := readSnapshotFile(ref.path)
+	if os.IsNotExist(err) {
+		return nil, nil // removed by cleanup since the lookup
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap.settingsMap(), nil
+}
+
+// GetRawOutput returns the complete result of the query that produced a snapshot,
+// stored in its file. Returns nil, nil if the snapshot does not exist or was
+// collected without raw output.
+func (s *FileStore) GetRawOutput(ctx context.Context, snapshotID int64) (json.RawMessage, error) {
+	s.mu.RLock()
+	ref, ok := s.snapshots[snapshotID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	snap, err := readSnapshotFile(ref.path)
+	if os.IsNotExist(err) {
+		return nil, nil // removed by cleanup since the lookup
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap.RawOutput, nil
+}
+
+// clusterChanges returns the cluster's changes, oldest first. The returned slice
+// is never modified in place, so it can be read after the lock is released.
+func (s *FileStore) clusterChanges(clusterID string) []fileChange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes[clusterID]
+}
+
+// GetChanges returns the most recent changes for a cluster, newest first.
+func (s *FileStore) GetChanges(ctx context.Context, clusterID string, limit int) ([]Change, error) {
+	all := s.clusterChanges(clusterID)
+
+	var changes []Change
+	for i := len(all) - 1; i >= 0 && len(changes) < limit; i-- {
+		changes = append(changes, all[i].Change)
+	}
+	return changes, nil
+}
+
+// GetChangesInRange returns up to limit of a cluster's changes detected in
+// [from, to), newest first. A zero to leaves the range open-ended.
+func (s *FileStore) GetChangesInRange(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]Change, error) {
+	all := s.clusterChanges(clusterID)
+
+	var changes []Change
+	for i := len(all) - 1; i >= 0 && len(changes) < limit; i-- {
+		c := all[i]
+		if c.DetectedAt.Before(from) || (!to.IsZero() && !c.DetectedAt.Before(to)) {
+			continue
+		}
+		changes = append(changes, c.Change)
+	}
+	return changes, nil
+}
+
+// SearchChanges returns up to limit changes, newest first, whose variable, old
+// or new value, or description contains query, ignoring case. An empty
+// clusterID searches every cluster.
+func (s *FileStore) SearchChanges(ctx context.Context, clusterID, query string, limit int) ([]Change, error) {
+	s.mu.RLock()
+	var matched []fileChange
+	query = strings.ToLower(query)
+	for id, changes := range s.changes {
+		if clusterID != "" && id != clusterID {
+			continue
+		}
+		for _, c := range changes {
+			for _, field := range []string{c.Variable, c.OldValue, c.NewValue, c.Description} {
+				if strings.Contains(strings.ToLower(field), query) {
+					matched = append(matched, c)
+					break
+				}
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].DetectedAt.Equal(matched[j].DetectedAt) {
+			return matched[i].DetectedAt.After(matched[j].DetectedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	var changes []Change
+	for _, c := range matched {
+		if len(changes) == limit {
+			break
+		}
+		changes = append(changes, c.Change)
+	}
+	return changes, nil
+}
+
+// StreamChanges calls fn for each change, newest first.
+func (s *FileStore) StreamChanges(ctx context.Context, clusterID string, fn func(Change) error) error {
+	all := s.clusterChanges(clusterID)
+
+	for i := len(all) - 1; i >= 0; i-- {
+		if err := fn(all[i].Change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamChangesAfter calls fn for each change with an ID greater than afterID, oldest first.
+func (s *FileStore) StreamChangesAfter(ctx context.Context, clusterID string, afterID int64, fn func(int64, Change) error) error {
+	for _, c := range s.clusterChanges(clusterID) {
+		if c.ID <= afterID {
+			continue
+		}
+		if err := fn(c.ID, c.Change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetChangesWithAnnotations returns recent changes with their IDs. The file store
+// has no annotations, so Annotation is always nil.
+func (s *FileStore) GetChangesWithAnnotations(ctx context.Context, clusterID string, limit int) ([]ChangeWithAnnotation, error) {
+	return s.GetChangesWithAnnotationsPaged(ctx, clusterID, limit, 0)
+}
+
+// GetChangesWithAnnotationsPaged is GetChangesWithAnnotations skipping the
+// offset newest changes. A negative offset is treated as 0.
+func (s *FileStore) GetChangesWithAnnotationsPaged(ctx context.Context, clusterID string, limit, offset int) ([]ChangeWithAnnotation, error) {
+	all := s.clusterChanges(clusterID)
+
+	var results []ChangeWithAnnotation
+	for i := len(all) - 1 - max(offset, 0); i >= 0 && len(results) < limit; i-- {
+		results = append(results, ChangeWithAnnotation{Change: all[i].Change, ID: all[i].ID})
+	}
+	return results, nil
+}
+
+// GetChangesWithAcknowledgements returns recent changes with their IDs. The file
+// store has no acknowledgements, so every change is unacknowledged.
+func (s *FileStore) GetChangesWithAcknowledgements(ctx context.Context, clusterID string, unacknowledgedOnly bool, limit int) ([]ChangeWithAcknowledgement, error) {
+	all := s.clusterChanges(clusterID)
+
+	results := []ChangeWithAcknowledgement{}
+	for i := len(all) - 1; i >= 0 && len(results) < limit; i-- {
+		results = append(results, ChangeWithAcknowledgement{Change: all[i].Change, ID: all[i].ID})
+	}
+	return results, nil
+}
+
+// GetTopChangedSettings returns the variables with the most changes detected in [from, to)
+// for a cluster, ordered by count descending (ties broken by variable name).
+func (s *FileStore) GetTopChangedSettings(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]SettingChangeCount, error) {
+	byVariable := make(map[string]*SettingChangeCount)
+	for _, c := range s.clusterChanges(clusterID) {
+		if c.DetectedAt.Before(from) || !c.DetectedAt.Before(to) {
+			continue
+		}
+		count := byVariable[c.Variable]
+		if count == nil {
+			count = &SettingChangeCount{Variable: c.Variable}
+			byVariable[c.Variable] = count
+		}
+		count.Count++
+		if c.DetectedAt.After(count.LastChanged) {
+			count.LastChanged = c.DetectedAt
+		}
+	}
+
+	counts := make([]SettingChangeCount, 0, len(byVariable))
+	for _, c := range byVariable {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Variable < counts[j].Variable
+	})
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts, nil
+}
+
+// CountChanges returns the number of changes recorded for a cluster.
+func (s *FileStore) CountChanges(ctx context.Context, clusterID string) (int64, error) {
+	return int64(len(s.clusterChanges(clusterID))), nil
+}
+
+// HasChange reports whether the store holds the change with the given ID.
+func (s *FileStore) HasChange(ctx context.Context, changeID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, changes := range s.changes {
+		for _, c := range changes {
+			if c.ID == changeID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// CountChangesByCluster returns every cluster with changes detected since the given time,
+// ordered by count descending (ties broken by cluster ID).
+func (s *FileStore) CountChangesByCluster(ctx context.Context, since time.Time) ([]ClusterChangeCount, error) {
+	s.mu.RLock()
+	counts := []ClusterChangeCount{}
+	for clusterID, changes := range s.changes {
+		count := ClusterChangeCount{ClusterID: clusterID}
+		for _, c := range changes {
+			if c.DetectedAt.Before(since) {
+				continue
+			}
+			count.Count++
+			if c.DetectedAt.After(count.LastChanged) {
+				count.LastChanged = c.DetectedAt
+			}
+		}
+		if count.Count > 0 {
+			counts = append(counts, count)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].ClusterID < counts[j].ClusterID
+	})
+	return counts, nil
+}
+
+// CleanupOldSnapshots removes snapshot files older than the specified duration for a cluster.
+func (s *FileStore) CleanupOldSnapshots(ctx context.Context, clusterID string, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	var newest *fileSnapshotRef
+	for id, ref := range s.snapshots {
+		if ref.info.ClusterID != clusterID {
+			continue
+		}
+		if ref.info.CollectedAt.Before(cutoff) {
+			if err := os.Remove(ref.path); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			delete(s.snapshots, id)
+			removed++
+			continue
+		}
+		if newest == nil || ref.info.CollectedAt.After(newest.info.CollectedAt) {
+			newest = &ref
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	if newest == nil {
+		delete(s.latest, clusterID)
+		return removed, nil
+	}
+	if latest := s.latest[clusterID]; latest == nil || latest.ID != newest.info.ID {
+		snap, err := readSnapshotFile(newest.path)
+		if err != nil {
+			return removed, err
+		}
+		s.latest[clusterID] = snap
+	}
+	return removed, nil
+}
+
+// CleanupOldChanges removes changes older than the specified duration for a cluster
+// by rewriting its changes file.
+func (s *FileStore) CleanupOldChanges(ctx context.Context, clusterID string, retention time.Duration) (int64, error) {
+	return s.CleanupOldChangesKeeping(ctx, clusterID, retention, KeepChanges{})
+}
+
+// CleanupOldChangesKeeping removes change records older than retention, except
+// each variable's most recent changes as counted by keep.
+func (s *FileStore) CleanupOldChangesKeeping(ctx context.Context, clusterID string, retention time.Duration, keep KeepChanges) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Changes are stored oldest first, so walk backwards to rank each variable's newest
+	all := s.changes[clusterID]
+	recent := make([]bool, len(all))
+	seen := make(map[string]int)
+	for i := len(all) - 1; i >= 0; i-- {
+		v := all[i].Variable
+		seen[v]++
+		recent[i] = seen[v] <= keep.For(v)
+	}
+	kept := make([]fileChange, 0, len(all))
+	for i, c := range all {
+		if recent[i] || !c.DetectedAt.Before(cutoff) {
+			kept = append(kept, c)
+		}
+	}
+	removed := int64(len(all) - len(kept))
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := s.replaceChanges(clusterID, kept); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// CompactReverts collapses runs of a cluster's changes that return a setting to
+// an earlier value within window, keeping the change before each run and
+// counting the run on it as CompactedReverts.
+func (s *FileStore) CompactReverts(ctx context.Context, clusterID string, window time.Duration) (CompactionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.changes[clusterID]
+	variables := make([]string, len(all))
+	entries := make([]compactEntry, len(all))
+	for i, c := range all {
+		variables[i] = c.Variable
+		entries[i] = compactEntry{DetectedAt: c.DetectedAt, OldValue: c.OldValue, NewValue: c.NewValue, Compacted: c.CompactedReverts}
+	}
+
+	removed := make([]bool, len(all))
+	counts := make(map[int]int64)
+	result := compactVariables(variables, entries, window, func(positions []int, plan compactPlan) {
+		for _, i := range plan.remove {
+			removed[positions[i]] = true
+		}
+		for i, count := range plan.counts {
+			counts[positions[i]] = count
+		}
+	})
+	if result.Removed == 0 {
+		return result, nil
+	}
+
+	kept := make([]fileChange, 0, len(all)-int(result.Removed))
+	for i, c := range all {
+		if removed[i] {
+			continue
+		}
+		if count, ok := counts[i]; ok {
+			c.CompactedReverts = count
+		}
+		kept = append(kept, c)
+	}
+	if err := s.replaceChanges(clusterID, kept); err != nil {
+		return CompactionResult{}, err
+	}
+	return result, nil
+}
+
+// replaceChanges rewrites a cluster's changes file with changes. Callers hold s.mu.
+func (s *FileStore) replaceChanges(clusterID string, changes []fileChange) error {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, c := range changes {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	dir, err := s.clusterDir(clusterID)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, fileChangesName), []byte(buf.String())); err != nil {
+		return err
+	}
+
+	// Replace rather than modify the slice; readers may still hold the old one
+	s.changes[clusterID] = changes
+	return nil
+}
+
+// SetMetadata stores a key-value pair in the cluster's metadata file.
+func (s *FileStore) SetMetadata(ctx context.Context, clusterID, key, value string) error {
+	dir, err := s.clusterDir(clusterID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.metadata[clusterID][key]; ok && v == value {
+		return nil
+	}
+
+	md := make(map[string]string, len(s.metadata[clusterID])+1)
+	for k, v := range s.metadata[clusterID] {
+		md[k] = v
+	}
+	md[key] = value
+	return s.writeMetadataLocked(dir, clusterID, md)
+}
+
+// writeMetadataLocked replaces the cluster's metadata file with md. The caller
+// must hold s.mu for writing.
+func (s *FileStore) writeMetadataLocked(dir, clusterID string, md map[string]string) error {
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, fileDirPerm); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, fileMetadataName), data); err != nil {
+		return err
+	}
+	s.metadata[clusterID] = md
+	return nil
+}
+
+// GetMetadata retrieves a value from the cluster's metadata, or "" if it is not set.
+func (s *FileStore) GetMetadata(ctx context.Context, clusterID, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.metadata[clusterID][key], nil
+}
+
+// GetAllMetadata returns a copy of every metadata key-value pair for the cluster.
+func (s *FileStore) GetAllMetadata(ctx context.Context, clusterID string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	md := make(map[string]string, len(s.metadata[clusterID]))
+	for k, v := range s.metadata[clusterID] {
+		md[k] = v
+	}
+	return md, nil
+}
+
+// RequestRebaseline makes the cluster's next snapshot a new baseline: it is saved
+// without recording changes against the previous snapshot. History is kept.
+func (s *FileStore) RequestRebaseline(ctx context.Context, clusterID string) error {
+	return s.SetMetadata(ctx, clusterID, metadataRebaseline, "true")
+}
+
+// RebaselineRequested reports whether the cluster's next snapshot will be saved
+// as a new baseline.
+func (s *FileStore) RebaselineRequested(ctx context.Context, clusterID string) (bool, error) {
+	value, err := s.GetMetadata(ctx, clusterID, metadataRebaseline)
+	return value != "", err
+}
+
+// GetSourceClusterID retrieves the source cluster's unique ID (from crdb_internal.cluster_id()).
+func (s *FileStore) GetSourceClusterID(ctx context.Context, clusterID string) (string, error) {
+	return s.GetMetadata(ctx, clusterID, "source_cluster_id")
+}
+
+// SetSourceClusterID stores the source cluster's unique ID.
+func (s *FileStore) SetSourceClusterID(ctx context.Context, clusterID, sourceClusterID string) error {
+	return s.SetMetadata(ctx, clusterID, "source_cluster_id", sourceClusterID)
+}
+
+// HistoryClusterID returns an empty ID: file storage is not kept in a cluster.
+func (s *FileStore) HistoryClusterID(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// GetDatabaseVersion retrieves the stored database version for a specific cluster.
+func (s *FileStore) GetDatabaseVersion(ctx context.Context, clusterID string) (string, error) {
+	return s.GetMetadata(ctx, clusterID, "database_version")
+}
+
+// SetDatabaseVersion stores the database version for a specific cluster.
+func (s *FileStore) SetDatabaseVersion(ctx context.Context, clusterID, version string) error {
+	return s.SetMetadata(ctx, clusterID, "database_version", version)
+}
+
+// ListClusters returns all distinct cluster IDs that have data.
+func (s *FileStore) ListClusters(ctx context.Context) ([]string, error) {
+	return s.ListClustersWithPrefix(ctx, "", 0)
+}
+
+// ListClustersWithPrefix returns the distinct cluster IDs that have data and start
+// with prefix, in order, at most limit of them. A limit of 0 or less returns all.
+func (s *FileStore) ListClustersWithPrefix(ctx context.Context, prefix string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for id := range s.changes {
+		seen[id] = true
+	}
+	for _, ref := range s.snapshots {
+		seen[ref.info.ClusterID] = true
+	}
+	for id := range s.metadata {
+		seen[id] = true
+	}
+
+	clusters := make([]string, 0, len(seen))
+	for id := range seen {
+		if strings.HasPrefix(id, prefix) {
+			clusters = append(clusters, id)
+		}
+	}
+	sort.Strings(clusters)
+	if limit > 0 && len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	return clusters, nil
+}
+
+// CreateAnnotation is not supported by the file store.
+func (s *FileStore) CreateAnnotation(ctx context.Context, changeID int64, content, severity, createdBy string) (*Annotation, error) {
+	return nil, ErrNotSupported
+}
+
+// GetAnnotation always returns nil, nil: the file store has no annotations.
+func (s *FileStore) GetAnnotation(ctx context.Context, id int64) (*Annotation, error) {
+	return nil, nil
+}
+
+// GetAnnotationByChangeID always returns nil, nil: the file store has no annotations.
+func (s *FileStore) GetAnnotationByChangeID(ctx context.Context, changeID int64) (*Annotation, error) {
+	return nil, nil
+}
+
+// SchemaMigrations always returns an empty list: the file store has no schema.
+func (s *FileStore) SchemaMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	return []AppliedMigration{}, nil
+}
+
+// ListAnnotations always returns an empty list: the file store has no annotations.
+func (s *FileStore) ListAnnotations(ctx context.Context, severity string, limit int) ([]Annotation, error) {
+	return []Annotation{}, nil
+}
+
+// UpdateAnnotation is not supported by the file store.
+func (s *FileStore) UpdateAnnotation(ctx context.Context, id int64, content, severity, updatedBy string) error {
+	return ErrNotSupported
+}
+
+// DeleteAnnotation is not supported by the file store.
+func (s *FileStore) DeleteAnnotation(ctx context.Context, id int64) error {
+	return ErrNotSupported
+}
+
+// AcknowledgeChange is not supported by the file store.
+func (s *FileStore) AcknowledgeChange(ctx context.Context, changeID int64, acknowledgedBy string) (*Acknowledgement, error) {
+	return nil, ErrNotSupported
+}
+
+// CreateSubscription is not supported by the file store.
+func (s *FileStore) CreateSubscription(ctx context.Context, clusterID, variablePattern, targetURL, createdBy string) (*Subscription, error) {
+	return nil, ErrNotSupported
+}
+
+// GetSubscription always returns nil, nil: the file store has no subscriptions.
+func (s *FileStore) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	return nil, nil
+}
+
+// ListSubscriptions always returns no subscriptions, so notifications are never sent.
+func (s *FileStore) ListSubscriptions(ctx context.Context, clusterID string) ([]Subscription, error) {
+	return []Subscription{}, nil
+}
+
+// UpdateSubscription is not supported by the file store.
+func (s *FileStore) UpdateSubscription(ctx context.Context, id int64, variablePattern, targetURL string) error {
+	return ErrNotSupported
+}
+
+// DeleteSubscription is not supported by the file store.
+func (s *FileStore) DeleteSubscription(ctx context.Context, id int64) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreReload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, v := range []string{"1", "2"} {
+		if _, err := store.SaveCollectedSnapshot(ctx, "prod", []Setting{{Variable: "a", Value: v, Description: "<html> & co"}}, "v1.0", DefaultCollectionQuery, time.Minute, "release-"+v, nil); err != nil {
+			t.Fatalf("SaveCollectedSnapshot failed: %v", err)
+		}
+	}
+	store.SetDatabaseVersion(ctx, "prod", "v25.4.2")
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+
+	changes, err := reopened.GetChangesWithAnnotations(ctx, "prod", 10)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected 1 change after reload, got %+v, %v", changes, err)
+	}
+	if changes[0].NewValue != "2" || changes[0].Description != "<html> & co" {
+		t.Errorf("Unexpected change after reload: %+v", changes[0])
+	}
+	if latest, _ := reopened.GetLatestSnapshot(ctx, "prod"); latest["a"].Value != "2" {
+		t.Errorf("Expected latest snapshot to be reloaded, got %+v", latest)
+	}
+	if v, _ := reopened.GetDatabaseVersion(ctx, "prod"); v != "v25.4.2" {
+		t.Errorf("Expected metadata to be reloaded, got %q", v)
+	}
+
+	// IDs continue after the reloaded ones, and detection compares against the reloaded snapshot
+	if _, err := reopened.SaveSnapshotWithChanges(ctx, "prod", []Setting{{Variable: "a", Value: "3"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	after, _ := reopened.GetChangesWithAnnotations(ctx, "prod", 10)
+	if len(after) != 2 || after[0].OldValue != "2" || after[0].ID <= changes[0].ID {
+		t.Errorf("Expected a new change 2 → 3 with a higher ID, got %+v", after)
+	}
+	snapshots, _ := reopened.ListSnapshots(ctx, "prod", 10)
+	if len(snapshots) != 3 || snapshots[0].ID != 3 {
+		t.Errorf("Expected 3 snapshots with the newest ID 3, got %+v", snapshots)
+	}
+	for _, snap := range snapshots {
+		if snap.Query != DefaultCollectionQuery {
+			t.Errorf("Expected snapshot %d query to be reloaded, got %q", snap.ID, snap.Query)
+		}
+		if want := int64(60); snap.ID < 3 && snap.PollIntervalSeconds != want {
+			t.Errorf("Expected snapshot %d poll interval %ds to be reloaded, got %d", snap.ID, want, snap.PollIntervalSeconds)
+		}
+		if want := fmt.Sprintf("release-%d", snap.ID); snap.ID < 3 && snap.Label != want {
+			t.Errorf("Expected snapshot %d label %q to be reloaded, got %q", snap.ID, want, snap.Label)
+		}
+	}
+}
+
+func TestFileStoreTruncatedChangesLine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, v := range []string{"1", "2"} {
+		store.SaveSnapshotWithChanges(ctx, "prod", []Setting{{Variable: "a", Value: v}}, "v1.0")
+	}
+
+	// Simulate a crash partway through appending a line
+	path := filepath.Join(dir, "prod", fileChangesName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open changes file: %v", err)
+	}
+	f.WriteString(`{"id":99,"cluster_id":"prod","variab`)
+	f.Close()
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Expected partial line to be tolerated, got: %v", err)
+	}
+	if changes, _ := reopened.GetChanges(ctx, "prod", 10); len(changes) != 1 {
+		t.Fatalf("Expected the complete change to survive, got %+v", changes)
+	}
+
+	reopened.SaveSnapshotWithChanges(ctx, "prod", []Setting{{Variable: "a", Value: "3"}}, "v1.0")
+	again, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Expected appends after repair to be readable, got: %v", err)
+	}
+	if changes, _ := again.GetChanges(ctx, "prod", 10); len(changes) != 2 {
+		t.Errorf("Expected 2 changes after repair and append, got %+v", changes)
+	}
+}
+
+func TestFileStoreRejectsPathClusterIDs(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	for _, id := range []string{"", ".", "..", "../escape", `a\b`} {
+		if _, err := store.SaveSnapshotWithChanges(context.Background(), id, nil, "v1.0"); err == nil {
+			t.Errorf("Expected error for cluster ID %q", id)
+		}
+	}
+}
+
+func TestFileStoreUnsupportedFeatures(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	if _, err := store.CreateAnnotation(ctx, 1, "note", SeverityInfo, "admin"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("CreateAnnotation error = %v, want ErrNotSupported", err)
+	}
+	if _, err := store.CreateSubscription(ctx, "prod", "*", "https://example.com", "admin"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("CreateSubscription error = %v, want ErrNotSupported", err)
+	}
+	if subs, err := store.ListSubscriptions(ctx, ""); err != nil || len(subs) != 0 {
+		t.Errorf("Expected no subscriptions, got %+v, %v", subs, err)
+	}
+}
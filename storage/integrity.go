@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// IntegrityReport lists history rows that refer to data that no longer exists,
+// as left by rare bugs or manual edits to the history database.
+type IntegrityReport struct {
+	// OrphanSettings are settings rows without a snapshot.
+	OrphanSettings int64 `json:"orphan_settings"`
+	// OrphanAnnotations are annotations on changes that no longer exist.
+	OrphanAnnotations int64 `json:"orphan_annotations"`
+	// OrphanChanges counts, per cluster ID, the changes of clusters with no
+	// snapshots left. They are reported but never repaired, since the changes
+	// may be the only record of a decommissioned cluster's history.
+	OrphanChanges map[string]int64 `json:"orphan_changes"`
+	// Repaired is the number of orphan settings and annotations deleted.
+	Repaired int64 `json:"repaired"`
+}
+
+// Problems returns the number of anomalies found, repaired or not.
+func (r IntegrityReport) Problems() int64 {
+	n := r.OrphanSettings + r.OrphanAnnotations
+	for _, count := range r.OrphanChanges {
+		n += count
+	}
+	return n
+}
+
+// OrphanChangeClusters returns the IDs of clusters with orphan changes, sorted.
+func (r IntegrityReport) OrphanChangeClusters() []string {
+	clusters := make([]string, 0, len(r.OrphanChanges))
+	for id := range r.OrphanChanges {
+		clusters = append(clusters, id)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// VerifyIntegrity checks the history database's references: settings must
+// belong to a snapshot, annotations to a change, and changes to a cluster that
+// still has snapshots. With repair, orphan settings and annotations are
+// deleted in the same transaction.
+func (s *Store) VerifyIntegrity(ctx context.Context, repair bool) (IntegrityReport, error) {
+	report := IntegrityReport{OrphanChanges: make(map[string]int64)}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback(ctx)
+
+	const orphanSettings = "snapshot_id IS NULL OR NOT EXISTS (SELECT 1 FROM snapshots sn WHERE sn.id = st.snapshot_id)"
+	const orphanAnnotations = "NOT EXISTS (SELECT 1 FROM changes c WHERE c.id = a.change_id)"
+
+	if err := tx.QueryRow(ctx, s.sql("SELECT count(*) FROM settings st WHERE "+orphanSettings)).Scan(&report.OrphanSettings); err != nil {
+		return report, fmt.Errorf("failed to count orphan settings: %w", err)
+	}
+	if err := tx.QueryRow(ctx, s.sql("SELECT count(*) FROM annotations a WHERE "+orphanAnnotations)).Scan(&report.OrphanAnnotations); err != nil {
+		return report, fmt.Errorf("failed to count orphan annotations: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, s.sql(`
+		SELECT c.cluster_id, count(*) FROM changes c
+		WHERE NOT EXISTS (SELECT 1 FROM snapshots sn WHERE sn.cluster_id = c.cluster_id)
+		GROUP BY c.cluster_id`))
+	if err != nil {
+		return report, fmt.Errorf("failed to count orphan changes: %w", err)
+	}
+	for rows.Next() {
+		var clusterID string
+		var count int64
+		if err := rows.Scan(&clusterID, &count); err != nil {
+			rows.Close()
+			return report, err
+		}
+		report.OrphanChanges[clusterID] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("failed to count orphan changes: %w", err)
+	}
+
+	if !repair || report.OrphanSettings+report.OrphanAnnotations == 0 {
+		return report, nil
+	}
+	for _, del := range []string{
+		"DELETE FROM settings st WHERE " + orphanSettings,
+		"DELETE FROM annotations a WHERE " + orphanAnnotations,
+	} {
+		result, err := tx.Exec(ctx, s.sql(del))
+		if err != nil {
+			return report, fmt.Errorf("failed to repair: %w", err)
+		}
+		report.Repaired += result.RowsAffected()
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// VerifyIntegrity checks that every cluster with changes still has snapshots.
+// Settings are stored inside their snapshot files and the file store has no
+// annotations, so neither can be orphaned and repair has nothing to do.
+func (s *FileStore) VerifyIntegrity(ctx context.Context, repair bool) (IntegrityReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report := IntegrityReport{OrphanChanges: make(map[string]int64)}
+	for clusterID, changes := range s.changes {
+		if len(changes) > 0 && s.latest[clusterID] == nil {
+			report.OrphanChanges[clusterID] = int64(len(changes))
+		}
+	}
+	return report, nil
+}
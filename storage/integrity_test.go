@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	store, ctx := setupStoreTest(t, 30*time.Second)
+	cleanupTestData(t, store)
+	t.Cleanup(func() { cleanupTestData(t, store) })
+
+	for _, v := range []string{"1", "2"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "intact", []Setting{{Variable: "a.b", Value: v, SettingType: "s"}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	report, err := store.VerifyIntegrity(ctx, false)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if report.Problems() != 0 {
+		t.Fatalf("Expected consistent history, got %+v", report)
+	}
+
+	// A settings row without a snapshot, and changes of a cluster with none
+	if _, err := store.pool.Exec(ctx, "INSERT INTO settings (snapshot_id, variable, value) VALUES (NULL, 'lost.setting', 'x')"); err != nil {
+		t.Fatalf("Failed to seed orphan setting: %v", err)
+	}
+	if _, err := store.pool.Exec(ctx, "INSERT INTO changes (detected_at, variable, old_value, new_value, cluster_id) VALUES (now(), 'a.b', '1', '2', 'gone')"); err != nil {
+		t.Fatalf("Failed to seed orphan change: %v", err)
+	}
+
+	report, err = store.VerifyIntegrity(ctx, false)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if report.OrphanSettings != 1 || report.OrphanChanges["gone"] != 1 || len(report.OrphanChanges) != 1 || report.Repaired != 0 {
+		t.Errorf("Expected 1 orphan setting and 1 orphan change of gone, got %+v", report)
+	}
+
+	report, err = store.VerifyIntegrity(ctx, true)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity with repair failed: %v", err)
+	}
+	if report.Repaired != 1 {
+		t.Errorf("Expected the orphan setting to be repaired, got %+v", report)
+	}
+	report, err = store.VerifyIntegrity(ctx, false)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if report.OrphanSettings != 0 || report.OrphanChanges["gone"] != 1 {
+		t.Errorf("Expected orphan settings gone and orphan changes kept, got %+v", report)
+	}
+}
+
+func TestFileStoreVerifyIntegrity(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, cluster := range []string{"intact", "gone"} {
+		for _, v := range []string{"1", "2"} {
+			if _, err := store.SaveSnapshotWithChanges(ctx, cluster, []Setting{{Variable: "a.b", Value: v, SettingType: "s"}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+	}
+	report, err := store.VerifyIntegrity(ctx, false)
+	if err != nil || report.Problems() != 0 {
+		t.Fatalf("Expected consistent history, got %+v, %v", report, err)
+	}
+
+	// Every snapshot of gone is removed, leaving its change behind
+	if _, err := store.CleanupOldSnapshots(ctx, "gone", time.Nanosecond); err != nil {
+		t.Fatalf("CleanupOldSnapshots failed: %v", err)
+	}
+	report, err = store.VerifyIntegrity(ctx, true)
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if got := report.OrphanChangeClusters(); len(got) != 1 || got[0] != "gone" || report.OrphanChanges["gone"] != 1 {
+		t.Errorf("Expected 1 orphan change of gone, got %+v", report)
+	}
+	if report.Repaired != 0 {
+		t.Errorf("Expected orphan changes not to be repaired, got %+v", report)
+	}
+}
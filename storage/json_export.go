@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ChangeWriter streams changes in an export format. Call WriteHeader first,
+// then WriteChange for each change, then Close.
+type ChangeWriter interface {
+	WriteHeader() error
+	WriteChange(c Change) error
+	Close() error
+}
+
+var (
+	_ ChangeWriter = (*CSVChangeWriter)(nil)
+	_ ChangeWriter = (*JSONChangeWriter)(nil)
+)
+
+// Close flushes the remaining rows and returns any write error.
+func (cw *CSVChangeWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// exportedChange is a change as written by JSONChangeWriter: the columns of
+// the CSV export, in the same order.
+type exportedChange struct {
+	ClusterID   string `json:"cluster_id"`
+	DetectedAt  string `json:"detected_at"`
+	Variable    string `json:"variable"`
+	Version     string `json:"version"`
+	OldValue    string `json:"old_value"`
+	NewValue    string `json:"new_value"`
+	Description string `json:"description"`
+}
+
+// JSONChangeWriter streams Change records as a JSON array of objects with the
+// same fields as the CSV export. Like CSVChangeWriter, it flushes every
+// csvFlushRows changes so errors from the underlying writer surface promptly.
+type JSONChangeWriter struct {
+	w          *bufio.Writer
+	rows       int
+	timeFormat TimestampFormat
+}
+
+// NewJSONChangeWriter creates a new streaming JSON change writer.
+func NewJSONChangeWriter(w io.Writer) *JSONChangeWriter {
+	return &JSONChangeWriter{w: bufio.NewWriter(w)}
+}
+
+// WithTimestampFormat sets how detected_at is rendered. The default is RFC3339.
+func (jw *JSONChangeWriter) WithTimestampFormat(f TimestampFormat) *JSONChangeWriter {
+	jw.timeFormat = f
+	return jw
+}
+
+// WriteHeader opens the array and flushes it.
+func (jw *JSONChangeWriter) WriteHeader() error {
+	if _, err := jw.w.WriteString("["); err != nil {
+		return err
+	}
+	return jw.w.Flush()
+}
+
+// WriteChange writes a single change as an element of the array.
+func (jw *JSONChangeWriter) WriteChange(c Change) error {
+	data, err := json.Marshal(exportedChange{
+		ClusterID:   c.ClusterID,
+		DetectedAt:  jw.timeFormat.Format(c.DetectedAt),
+		Variable:    c.Variable,
+		Version:     c.Version,
+		OldValue:    c.OldValue,
+		NewValue:    c.NewValue,
+		Description: c.Description,
+	})
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if jw.rows == 0 {
+		sep = "\n"
+	}
+	if _, err := jw.w.WriteString(sep); err != nil {
+		return err
+	}
+	if _, err := jw.w.Write(data); err != nil {
+		return err
+	}
+
+	jw.rows++
+	if jw.rows%csvFlushRows == 0 {
+		return jw.w.Flush()
+	}
+	return nil
+}
+
+// Close closes the array, so that no changes are written as [], and flushes it.
+func (jw *JSONChangeWriter) Close() error {
+	closing := "\n]\n"
+	if jw.rows == 0 {
+		closing = "]\n"
+	}
+	if _, err := jw.w.WriteString(closing); err != nil {
+		return err
+	}
+	return jw.w.Flush()
+}
+
+// WriteChangesJSON writes changes to w as a JSON array with the fields of the
+// CSV export and RFC3339 timestamps. Changes without a cluster ID are written
+// with clusterID.
+func WriteChangesJSON(w io.Writer, clusterID string, changes []Change) error {
+	jw := NewJSONChangeWriter(w)
+	if err := jw.WriteHeader(); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c.ClusterID == "" {
+			c.ClusterID = clusterID
+		}
+		if err := jw.WriteChange(c); err != nil {
+			return err
+		}
+	}
+	return jw.Close()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteChangesJSON(t *testing.T) {
+	detected := time.Date(2025, 1, 15, 10, 30, 0, 123, time.UTC)
+	changes := []Change{
+		{ClusterID: "prod", DetectedAt: detected, Variable: "kv.rangefeed.enabled", OldValue: "false", NewValue: "true", Version: "v24.1", Description: "Enables rangefeeds", CompactedReverts: 2},
+		{DetectedAt: detected, Variable: "sql.defaults.distsql", NewValue: "on"},
+	}
+
+	var buf strings.Builder
+	if err := WriteChangesJSON(&buf, "staging", changes); err != nil {
+		t.Fatalf("WriteChangesJSON failed: %v", err)
+	}
+
+	var rows []map[string]string
+	if err := json.Unmarshal([]byte(buf.String()), &rows); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", buf.String(), err)
+	}
+	want := []map[string]string{
+		{"cluster_id": "prod", "detected_at": "2025-01-15T10:30:00Z", "variable": "kv.rangefeed.enabled", "version": "v24.1", "old_value": "false", "new_value": "true", "description": "Enables rangefeeds"},
+		{"cluster_id": "staging", "detected_at": "2025-01-15T10:30:00Z", "variable": "sql.defaults.distsql", "version": "", "old_value": "", "new_value": "on", "description": ""},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %d: %s", len(want), len(rows), buf.String())
+	}
+	for i := range want {
+		if len(rows[i]) != len(want[i]) {
+			t.Errorf("Row %d has fields %v, want the CSV columns", i, rows[i])
+		}
+		for k, v := range want[i] {
+			if rows[i][k] != v {
+				t.Errorf("Row %d %s = %q, want %q", i, k, rows[i][k], v)
+			}
+		}
+	}
+}
+
+func TestWriteChangesJSONEmpty(t *testing.T) {
+	for _, changes := range [][]Change{nil, {}} {
+		var buf strings.Builder
+		if err := WriteChangesJSON(&buf, "prod", changes); err != nil {
+			t.Fatalf("WriteChangesJSON failed: %v", err)
+		}
+		if got := strings.TrimSpace(buf.String()); got != "[]" {
+			t.Errorf("Expected [], got %q", got)
+		}
+	}
+}
+
+func TestJSONChangeWriterReturnsWriteErrorPromptly(t *testing.T) {
+	writeErr := errors.New("connection reset by peer")
+	jw := NewJSONChangeWriter(&failingWriter{limit: 200, err: writeErr})
+	if err := jw.WriteHeader(); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	change := Change{ClusterID: "c", DetectedAt: time.Now(), Variable: "a.b", OldValue: "1", NewValue: "2"}
+	var err error
+	var written int
+	for written = 0; written < 10*csvFlushRows; written++ {
+		if err = jw.WriteChange(change); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("Expected %q, got %v", writeErr, err)
+	}
+	if written >= csvFlushRows {
+		t.Errorf("Expected error within the first %d rows, got it after %d", csvFlushRows, written)
+	}
+}
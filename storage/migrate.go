@@ -138,14 +138,144 @@ var migrations = []migration{
 			-- different clusters from storing the same metadata key. Drop it.
 		`,
 	},
+	{
+		version:     7,
+		description: "add subscriptions table",
+		sql: `
+			CREATE TABLE IF NOT EXISTS subscriptions (
+				id SERIAL PRIMARY KEY,
+				cluster_id TEXT NOT NULL,
+				variable_pattern TEXT NOT NULL,
+				target_url TEXT NOT NULL,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				INDEX idx_subscriptions_cluster (cluster_id)
+			);
+		`,
+	},
+	{
+		// Existing snapshots were all collected with the default query.
+		version:     8,
+		description: "add query column to snapshots",
+		sql: `
+			ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS query TEXT NOT NULL DEFAULT 'SHOW CLUSTER SETTINGS';
+		`,
+	},
+	{
+		// Valid values are enforced in Go (storage.IsValidSeverity).
+		version:     9,
+		description: "add severity column to annotations",
+		sql: `
+			ALTER TABLE annotations ADD COLUMN IF NOT EXISTS severity TEXT NOT NULL DEFAULT 'info';
+		`,
+	},
+	{
+		// NULL for snapshots taken before the interval was recorded.
+		version:     10,
+		description: "add poll_interval_seconds column to snapshots",
+		sql: `
+			ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS poll_interval_seconds INT8;
+		`,
+	},
+	{
+		version:     11,
+		description: "add acknowledgements table",
+		sql: `
+			CREATE TABLE IF NOT EXISTS acknowledgements (
+				change_id INT PRIMARY KEY REFERENCES changes(id) ON DELETE CASCADE,
+				acknowledged_by TEXT NOT NULL DEFAULT '',
+				acknowledged_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			);
+		`,
+	},
+	{
+		version:     12,
+		description: "add label column to snapshots",
+		sql: `
+			ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version:     13,
+		description: "add compacted_reverts column to changes",
+		sql: `
+			ALTER TABLE changes ADD COLUMN IF NOT EXISTS compacted_reverts INT8 NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		// NULL for settings collected before the default was recorded.
+		version:     14,
+		description: "add default_value column to settings",
+		sql: `
+			ALTER TABLE settings ADD COLUMN IF NOT EXISTS default_value TEXT;
+		`,
+	},
+	{
+		version:     15,
+		description: "add raw_outputs table",
+		sql: `
+			CREATE TABLE IF NOT EXISTS raw_outputs (
+				snapshot_id INT PRIMARY KEY REFERENCES snapshots(id) ON DELETE CASCADE,
+				output JSONB NOT NULL
+			);
+		`,
+	},
+}
+
+// legacySchemaVersion is the schema version that databases created before the
+// migration system already match. Later migrations must still run on them.
+const legacySchemaVersion = 6
+
+// LatestSchemaVersion returns the version of the newest known migration.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// AppliedMigration is a row of the schema_migrations table.
+type AppliedMigration struct {
+	Version     int       `json:"version"`
+	Description string    `json:"description"`
+	AppliedAt   time.Time `json:"applied_at"`
+}
+
+// migrationDescription returns the description of a known migration version.
+func migrationDescription(version int) string {
+	for _, m := range migrations {
+		if m.version == version {
+			return m.description
+		}
+	}
+	return ""
+}
+
+// SchemaMigrations returns the applied migrations, oldest first. Concurrent
+// replicas may record the same version twice; only the first is returned.
+func (s *Store) SchemaMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT version, MIN(applied_at) FROM schema_migrations GROUP BY version ORDER BY version`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var m AppliedMigration
+		if err := rows.Scan(&m.Version, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		m.Description = migrationDescription(m.Version)
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
 }
 
 // runMigrations applies all pending migrations to the database.
 // The schema_migrations table must already exist (created by initAndMigrate).
 // All migrations are idempotent, so concurrent execution is safe.
-func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
+func runMigrations(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
 	currentVersion := 0
-	err := pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion)
+	err := pool.QueryRow(ctx, prefix.apply("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).Scan(&currentVersion)
 	if err != nil {
 		return fmt.Errorf("reading current migration version: %w", err)
 	}
@@ -165,20 +295,20 @@ func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 		slog.Info("Running migration", "version", m.version, "description", m.description)
 
 		if m.version == 5 {
-			if err := migrateMetadataPK(ctx, pool); err != nil {
+			if err := migrateMetadataPK(ctx, pool, prefix); err != nil {
 				return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
 			}
 		} else if m.version == 6 {
-			if err := dropMetadataKeyUnique(ctx, pool); err != nil {
+			if err := dropMetadataKeyUnique(ctx, pool, prefix); err != nil {
 				return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
 			}
 		} else {
-			if err := execDDL(ctx, pool, m.sql); err != nil {
+			if err := execDDL(ctx, pool, prefix.apply(m.sql)); err != nil {
 				return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
 			}
 		}
 
-		_, err := pool.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version)
+		_, err := pool.Exec(ctx, prefix.apply("INSERT INTO schema_migrations (version) VALUES ($1)"), m.version)
 		if err != nil {
 			return fmt.Errorf("recording migration %d: %w", m.version, err)
 		}
@@ -191,16 +321,16 @@ func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 // migrateMetadataPK handles the metadata table primary key migration.
 // This needs special logic because it must check the existing PK structure
 // and CockroachDB requires DROP/ADD PK in the same ALTER TABLE statement.
-func migrateMetadataPK(ctx context.Context, pool *pgxpool.Pool) error {
+func migrateMetadataPK(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
 	var pkIncludesClusterID bool
 	err := pool.QueryRow(ctx, `
 		SELECT EXISTS (
 			SELECT 1 FROM information_schema.key_column_usage
-			WHERE table_name = 'metadata'
+			WHERE table_name = $1
 			AND column_name = 'cluster_id'
-			AND constraint_name = 'metadata_pkey'
+			AND constraint_name = $2
 		)
-	`).Scan(&pkIncludesClusterID)
+	`, prefix.apply("metadata"), prefix.apply("metadata_pkey")).Scan(&pkIncludesClusterID)
 	if err != nil {
 		return err
 	}
@@ -209,7 +339,7 @@ func migrateMetadataPK(ctx context.Context, pool *pgxpool.Pool) error {
 		return nil
 	}
 
-	if err := execDDL(ctx, pool, "ALTER TABLE metadata DROP CONSTRAINT metadata_pkey, ADD PRIMARY KEY (cluster_id, key)"); err != nil && !isConstraintAlreadyExists(err) {
+	if err := execDDL(ctx, pool, prefix.apply("ALTER TABLE metadata DROP CONSTRAINT metadata_pkey, ADD PRIMARY KEY (cluster_id, key)")); err != nil && !isConstraintAlreadyExists(err) {
 		return err
 	}
 
@@ -219,16 +349,16 @@ func migrateMetadataPK(ctx context.Context, pool *pgxpool.Pool) error {
 // dropMetadataKeyUnique drops the secondary UNIQUE constraint on metadata(key) that
 // CockroachDB auto-creates when the old single-column PK is dropped in migration 5.
 // This constraint prevents different clusters from using the same metadata key.
-func dropMetadataKeyUnique(ctx context.Context, pool *pgxpool.Pool) error {
+func dropMetadataKeyUnique(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
 	var exists bool
 	err := pool.QueryRow(ctx, `
 		SELECT EXISTS (
 			SELECT 1 FROM information_schema.table_constraints
-			WHERE table_name = 'metadata'
-			AND constraint_name = 'metadata_key_key'
+			WHERE table_name = $1
+			AND constraint_name = $2
 			AND constraint_type = 'UNIQUE'
 		)
-	`).Scan(&exists)
+	`, prefix.apply("metadata"), prefix.apply("metadata_key_key")).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -237,7 +367,7 @@ func dropMetadataKeyUnique(ctx context.Context, pool *pgxpool.Pool) error {
 		return nil
 	}
 
-	return execDDL(ctx, pool, "DROP INDEX metadata_key_key CASCADE")
+	return execDDL(ctx, pool, prefix.apply("DROP INDEX metadata_key_key CASCADE"))
 }
 
 // splitStatements splits multi-statement SQL on semicolons, returning
@@ -425,42 +555,54 @@ func logDatabaseInfo(ctx context.Context, pool *pgxpool.Pool) {
 
 // Migrate connects to the given database and runs all pending schema migrations.
 // This is used by the init command to create tables as part of initialization.
-func Migrate(ctx context.Context, connString string) error {
+func Migrate(ctx context.Context, connString string, opts ...Option) error {
+	s := &Store{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.prefix.validate(); err != nil {
+		return err
+	}
+
 	pool, err := pgxpool.New(ctx, connString)
 	if err != nil {
 		return fmt.Errorf("connecting for migration: %w", err)
 	}
 	defer pool.Close()
-	return initAndMigrate(ctx, pool)
+	return initAndMigrate(ctx, pool, s.prefix)
 }
 
 // initAndMigrate creates the migration tracking table, handles existing databases,
 // then runs any pending migrations.
-func initAndMigrate(ctx context.Context, pool *pgxpool.Pool) error {
+func initAndMigrate(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
 	logDatabaseInfo(ctx, pool)
 
-	if err := execDDL(ctx, pool, `
+	if err := checkPrivileges(ctx, pool, prefix); err != nil {
+		return err
+	}
+
+	if err := execDDL(ctx, pool, prefix.apply(`
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INT NOT NULL,
 			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 		)
-	`); err != nil {
+	`)); err != nil {
 		return fmt.Errorf("creating schema_migrations table: %w", err)
 	}
 
-	if err := migrateExistingDB(ctx, pool); err != nil {
+	if err := migrateExistingDB(ctx, pool, prefix); err != nil {
 		return err
 	}
 
-	return runMigrations(ctx, pool)
+	return runMigrations(ctx, pool, prefix)
 }
 
 // migrateExistingDB detects databases created before the migration system was introduced
 // and records all migrations as applied so they aren't re-run.
 // This is needed because existing databases already have the full schema but no schema_migrations records.
-func migrateExistingDB(ctx context.Context, pool *pgxpool.Pool) error {
+func migrateExistingDB(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
 	var migrationCount int
-	err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&migrationCount)
+	err := pool.QueryRow(ctx, prefix.apply("SELECT COUNT(*) FROM schema_migrations")).Scan(&migrationCount)
 	if err != nil {
 		return err
 	}
@@ -473,9 +615,9 @@ func migrateExistingDB(ctx context.Context, pool *pgxpool.Pool) error {
 	err = pool.QueryRow(ctx, `
 		SELECT EXISTS (
 			SELECT 1 FROM information_schema.tables
-			WHERE table_name = 'snapshots'
+			WHERE table_name = $1
 		)
-	`).Scan(&hasSnapshots)
+	`, prefix.apply("snapshots")).Scan(&hasSnapshots)
 	if err != nil {
 		return err
 	}
@@ -486,7 +628,10 @@ func migrateExistingDB(ctx context.Context, pool *pgxpool.Pool) error {
 
 	slog.Info("Detected existing database, recording migration history")
 	for _, m := range migrations {
-		_, err := pool.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version)
+		if m.version > legacySchemaVersion {
+			break
+		}
+		_, err := pool.Exec(ctx, prefix.apply("INSERT INTO schema_migrations (version) VALUES ($1)"), m.version)
 		if err != nil {
 			return fmt.Errorf("recording existing migration %d: %w", m.version, err)
 		}
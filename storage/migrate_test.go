@@ -2,6 +2,7 @@ package storage
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSplitStatements(t *testing.T) {
@@ -176,3 +177,48 @@ func TestOnlyComments(t *testing.T) {
 		})
 	}
 }
+
+func TestMigrationsRecordedOnce(t *testing.T) {
+	store, ctx := setupStoreTest(t, 30*time.Second)
+
+	countRows := func() int {
+		var n int
+		if err := store.pool.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+			t.Fatalf("Failed to count migrations: %v", err)
+		}
+		return n
+	}
+
+	// Running again must not re-apply or re-record anything
+	before := countRows()
+	if err := initAndMigrate(ctx, store.pool, store.prefix); err != nil {
+		t.Fatalf("initAndMigrate failed: %v", err)
+	}
+	if after := countRows(); after != before {
+		t.Errorf("Expected %d migration records after re-running, got %d", before, after)
+	}
+
+	applied, err := store.SchemaMigrations(ctx)
+	if err != nil {
+		t.Fatalf("SchemaMigrations failed: %v", err)
+	}
+	if len(applied) != LatestSchemaVersion() {
+		t.Fatalf("Expected %d applied migrations, got %d", LatestSchemaVersion(), len(applied))
+	}
+	for i, m := range applied {
+		if m.Version != i+1 || m.Description == "" || m.AppliedAt.IsZero() {
+			t.Errorf("Unexpected migration record %d: %+v", i, m)
+		}
+	}
+}
+
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migrations[%d].version = %d, want %d", i, m.version, i+1)
+		}
+		if m.description == "" {
+			t.Errorf("migration %d has no description", m.version)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Override is a setting whose value differs from its default.
+type Override struct {
+	Variable     string `json:"variable"`
+	Value        string `json:"value"`
+	DefaultValue string `json:"default_value"`
+	SettingType  string `json:"setting_type"`
+}
+
+// FindOverrides returns the settings whose value differs from the default the
+// cluster reported with it, sorted by variable. Values are compared by setting
+// type, so "true" and "TRUE" or "1m0s" and "60s" are not overrides. Settings
+// without a recorded default are skipped. It reports false, and no overrides,
+// when no setting has one, as in snapshots taken before defaults were stored.
+func FindOverrides(settings map[string]Setting) ([]Override, bool) {
+	recorded := false
+	overrides := []Override{}
+	for _, s := range settings {
+		if s.DefaultValue == "" {
+			continue
+		}
+		recorded = true
+		if !EqualSettingValues(s.SettingType, s.Value, s.DefaultValue) {
+			overrides = append(overrides, Override{Variable: s.Variable, Value: s.Value, DefaultValue: s.DefaultValue, SettingType: s.SettingType})
+		}
+	}
+	if !recorded {
+		return nil, false
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Variable < overrides[j].Variable })
+	return overrides, true
+}
+
+// EqualSettingValues reports whether two values of a setting of the given
+// SHOW CLUSTER SETTINGS type are the same: booleans and enums ignore case,
+// numbers, durations and byte sizes compare by magnitude, and anything else,
+// or a value that doesn't parse as its type, compares as trimmed text.
+func EqualSettingValues(settingType, a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return true
+	}
+	switch settingType {
+	case "b", "e":
+		return strings.EqualFold(a, b)
+	case "i", "f":
+		x, errA := strconv.ParseFloat(a, 64)
+		y, errB := strconv.ParseFloat(b, 64)
+		return errA == nil && errB == nil && x == y
+	case "d":
+		x, okA := parseSettingDuration(a)
+		y, okB := parseSettingDuration(b)
+		return okA && okB && x == y
+	case "z":
+		x, okA := parseByteSize(a)
+		y, okB := parseByteSize(b)
+		return okA && okB && x == y
+	}
+	return false
+}
+
+// parseSettingDuration parses a duration as Go formats it ("1m30s") or as an
+// HH:MM:SS interval ("00:01:30").
+func parseSettingDuration(v string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return d, true
+	}
+	parts := strings.Split(v, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(math.Round(seconds*float64(time.Second))), true
+}
+
+// byteSizeUnits are the multipliers of the byte size suffixes CockroachDB prints
+// and accepts, keyed by lowercase suffix.
+var byteSizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40, "pib": 1 << 50,
+	"kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12, "pb": 1e15,
+}
+
+// parseByteSize parses a byte size such as "64 MiB", "1.0 GiB" or "4096".
+func parseByteSize(v string) (float64, bool) {
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-'
+	})
+	if i < 0 {
+		i = len(v)
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(v[i:]))]
+	if !ok {
+		return 0, false
+	}
+	return n * unit, true
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEqualSettingValues(t *testing.T) {
+	tests := []struct {
+		settingType, a, b string
+		want              bool
+	}{
+		{"b", "true", "TRUE", true},
+		{"b", "true", "false", false},
+		{"e", "Auto", "auto", true},
+		{"i", "10", "10.0", true},
+		{"i", "10", "11", false},
+		{"f", "0.5", "5e-1", true},
+		{"d", "1m0s", "60s", true},
+		{"d", "00:01:30", "1m30s", true},
+		{"d", "1m0s", "2m0s", false},
+		{"z", "64 MiB", "67108864", true},
+		{"z", "1.0 GiB", "1024 MiB", true},
+		{"z", "64 MiB", "64 MB", false},
+		{"s", "Foo", "foo", false},
+		{"s", " foo ", "foo", true},
+		{"d", "soon", "1m0s", false}, // unparseable falls back to text
+	}
+	for _, tt := range tests {
+		if got := EqualSettingValues(tt.settingType, tt.a, tt.b); got != tt.want {
+			t.Errorf("EqualSettingValues(%q, %q, %q) = %v, want %v", tt.settingType, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFindOverrides(t *testing.T) {
+	settings := map[string]Setting{
+		"kv.enabled":     {Variable: "kv.enabled", Value: "TRUE", SettingType: "b", DefaultValue: "true"},
+		"kv.timeout":     {Variable: "kv.timeout", Value: "2m0s", SettingType: "d", DefaultValue: "1m0s"},
+		"sql.size":       {Variable: "sql.size", Value: "128 MiB", SettingType: "z", DefaultValue: "64 MiB"},
+		"sql.name":       {Variable: "sql.name", Value: "x", SettingType: "s", DefaultValue: "x"},
+		"legacy.setting": {Variable: "legacy.setting", Value: "1", SettingType: "i"},
+	}
+	overrides, recorded := FindOverrides(settings)
+	if !recorded {
+		t.Fatal("Expected defaults to be reported as recorded")
+	}
+	var got []string
+	for _, o := range overrides {
+		got = append(got, o.Variable)
+	}
+	if want := []string{"kv.timeout", "sql.size"}; !slices.Equal(got, want) {
+		t.Errorf("Overrides = %v, want %v", got, want)
+	}
+
+	if overrides, recorded := FindOverrides(map[string]Setting{"a": {Variable: "a", Value: "1"}}); recorded || overrides != nil {
+		t.Errorf("Expected no overrides without recorded defaults, got %v, %v", overrides, recorded)
+	}
+}
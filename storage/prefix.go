@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithTablePrefix prepends prefix to the name of every table the store creates and
+// queries (e.g. "crdbhist_" gives crdbhist_snapshots, crdbhist_changes, ...), so the
+// history can share a database with other applications. The default is no prefix.
+func WithTablePrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = tablePrefix(prefix)
+	}
+}
+
+// tablePrefix rewrites the store's table names in SQL. Queries are written against
+// the bare table names and rewritten once a prefix is configured. String literals
+// and AS aliases are left alone, so a query that compares against a table's name
+// passes the prefixed name as a parameter instead.
+type tablePrefix string
+
+// tableNameRe matches the store's tables as whole identifiers, along with the
+// constraint names CockroachDB derives from them (metadata_pkey, metadata_key_key).
+// Index names such as idx_changes_cluster are scoped to their table and left as-is.
+var tableNameRe = regexp.MustCompile(`\b(?:snapshots|settings|changes|metadata|annotations|subscriptions|acknowledgements|raw_outputs|schema_migrations)(?:_pkey|_key_key)?\b`)
+
+// aliasRe matches an AS keyword ending the text before a name, which makes the
+// name a column or table alias rather than a table.
+var aliasRe = regexp.MustCompile(`(?i)\bAS\s+$`)
+
+// tablePrefixRe restricts prefixes to characters that need no quoting in SQL.
+var tablePrefixRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (p tablePrefix) validate() error {
+	if p != "" && !tablePrefixRe.MatchString(string(p)) {
+		return fmt.Errorf("invalid table prefix %q: use lowercase letters, digits, and underscores, starting with a letter", string(p))
+	}
+	return nil
+}
+
+// apply returns query with every table name prefixed, outside string literals.
+func (p tablePrefix) apply(query string) string {
+	if p == "" {
+		return query
+	}
+	var b strings.Builder
+	for query != "" {
+		// Copy the SQL up to the next literal with its table names prefixed, then
+		// the literal as it is. An escaped quote ('') reads as two adjacent literals.
+		end := strings.IndexByte(query, '\'')
+		if end < 0 {
+			end = len(query)
+		}
+		p.prefixNames(&b, query[:end])
+		query = query[end:]
+		if query == "" {
+			break
+		}
+		end = strings.IndexByte(query[1:], '\'')
+		if end < 0 {
+			end = len(query) - 2 // unterminated: copy the rest
+		}
+		b.WriteString(query[:end+2])
+		query = query[end+2:]
+	}
+	return b.String()
+}
+
+// prefixNames writes sql to b with the table names not used as aliases prefixed.
+func (p tablePrefix) prefixNames(b *strings.Builder, sql string) {
+	last := 0
+	for _, m := range tableNameRe.FindAllStringIndex(sql, -1) {
+		if aliasRe.MatchString(sql[:m[0]]) {
+			continue
+		}
+		b.WriteString(sql[last:m[0]])
+		b.WriteString(string(p))
+		b.WriteString(sql[m[0]:m[1]])
+		last = m[1]
+	}
+	b.WriteString(sql[last:])
+}
+
+// sql returns query rewritten for the store's table prefix.
+func (s *Store) sql(query string) string {
+	return s.prefix.apply(query)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTablePrefixApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "tables and aliases",
+			query: "SELECT c.id FROM changes c LEFT JOIN annotations a ON a.change_id = c.id",
+			want:  "SELECT c.id FROM p_changes c LEFT JOIN p_annotations a ON a.change_id = c.id",
+		},
+		{
+			name:  "qualified column",
+			query: "ON CONFLICT (cluster_id, key) DO UPDATE SET value = EXCLUDED.value WHERE metadata.value IS DISTINCT FROM EXCLUDED.value",
+			want:  "ON CONFLICT (cluster_id, key) DO UPDATE SET value = EXCLUDED.value WHERE p_metadata.value IS DISTINCT FROM EXCLUDED.value",
+		},
+		{
+			name:  "index names untouched",
+			query: "CREATE INDEX IF NOT EXISTS idx_changes_cluster ON changes(cluster_id)",
+			want:  "CREATE INDEX IF NOT EXISTS idx_changes_cluster ON p_changes(cluster_id)",
+		},
+		{
+			name:  "derived constraint names",
+			query: "ALTER TABLE metadata DROP CONSTRAINT metadata_pkey; DROP INDEX metadata_key_key",
+			want:  "ALTER TABLE p_metadata DROP CONSTRAINT p_metadata_pkey; DROP INDEX p_metadata_key_key",
+		},
+		{
+			name:  "string literals untouched",
+			query: "SELECT note FROM annotations WHERE note = 'settings changed' OR note = 'it''s the changes table'",
+			want:  "SELECT note FROM p_annotations WHERE note = 'settings changed' OR note = 'it''s the changes table'",
+		},
+		{
+			name:  "column aliases untouched",
+			query: "SELECT count(*) AS changes, max(id) as snapshots FROM changes",
+			want:  "SELECT count(*) AS changes, max(id) as snapshots FROM p_changes",
+		},
+		{
+			name:  "unterminated literal",
+			query: "SELECT 'changes FROM changes",
+			want:  "SELECT 'changes FROM changes",
+		},
+		{
+			name:  "collection query untouched",
+			query: "DEFAULT 'SHOW CLUSTER SETTINGS'",
+			want:  "DEFAULT 'SHOW CLUSTER SETTINGS'",
+		},
+		{
+			name:  "columns untouched",
+			query: "SELECT setting_type, snapshot_id, detected_at FROM settings",
+			want:  "SELECT setting_type, snapshot_id, detected_at FROM p_settings",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tablePrefix("p_").apply(tt.query); got != tt.want {
+				t.Errorf("apply() = %q, want %q", got, tt.want)
+			}
+			if got := tablePrefix("").apply(tt.query); got != tt.query {
+				t.Errorf("empty prefix changed the query: %q", got)
+			}
+		})
+	}
+}
+
+func TestTablePrefixAppliesToAllMigrations(t *testing.T) {
+	for _, m := range migrations {
+		prefixed := tablePrefix("p_").apply(m.sql)
+		for _, stmt := range splitStatements(prefixed) {
+			for _, kw := range []string{"TABLE IF NOT EXISTS ", "ALTER TABLE ", "REFERENCES "} {
+				if i := strings.Index(stmt, kw); i >= 0 && !strings.HasPrefix(stmt[i+len(kw):], "p_") {
+					t.Errorf("migration %d: unprefixed table after %q in %q", m.version, kw, stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestTablePrefixValidate(t *testing.T) {
+	for _, p := range []string{"", "crdbhist_", "h2_"} {
+		if err := tablePrefix(p).validate(); err != nil {
+			t.Errorf("validate(%q) = %v, want nil", p, err)
+		}
+	}
+	for _, p := range []string{"Crdb_", "1h_", "_h", "h-", "h; DROP TABLE x;", "h "} {
+		if err := tablePrefix(p).validate(); err == nil {
+			t.Errorf("validate(%q) = nil, want error", p)
+		}
+	}
+}
+
+func TestPrefixedStoreBackend(t *testing.T) {
+	runBackendSuite(t, func(t *testing.T) (backend, context.Context) {
+		return setupPrefixedStoreTest(t), context.Background()
+	})
+}
+
+func TestPrefixedStoreTables(t *testing.T) {
+	store := setupPrefixedStoreTest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, table := range []string{"snapshots", "settings", "changes", "metadata", "annotations", "subscriptions", "acknowledgements", "schema_migrations"} {
+		var exists bool
+		err := store.pool.QueryRow(ctx,
+			"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)",
+			testTablePrefix+table,
+		).Scan(&exists)
+		if err != nil {
+			t.Fatalf("checking table %s: %v", table, err)
+		}
+		if !exists {
+			t.Errorf("Expected table %s%s to exist", testTablePrefix, table)
+		}
+	}
+
+	// Annotations and subscriptions are not covered by the backend suite
+	clusterID := "prefixed-" + time.Now().Format("20060102150405.000")
+	store.SaveSnapshot(ctx, clusterID, []Setting{{Variable: "a", Value: "1"}}, "v1.0")
+	store.SaveSnapshot(ctx, clusterID, []Setting{{Variable: "a", Value: "2"}}, "v1.0")
+	changes, err := store.GetChangesWithAnnotations(ctx, clusterID, 1)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("GetChangesWithAnnotations = %+v, %v", changes, err)
+	}
+	ann, err := store.CreateAnnotation(ctx, changes[0].ID, "prefixed note", SeverityWarning, "tester")
+	if err != nil {
+		t.Fatalf("CreateAnnotation failed: %v", err)
+	}
+	if err := store.UpdateAnnotation(ctx, ann.ID, "updated", "", "tester"); err != nil {
+		t.Fatalf("UpdateAnnotation failed: %v", err)
+	}
+	if got, err := store.GetAnnotation(ctx, ann.ID); err != nil || got.Content != "updated" {
+		t.Errorf("GetAnnotation = %+v, %v", got, err)
+	}
+	if err := store.DeleteAnnotation(ctx, ann.ID); err != nil {
+		t.Errorf("DeleteAnnotation failed: %v", err)
+	}
+
+	sub, err := store.CreateSubscription(ctx, clusterID, "a*", "https://example.com/hook", "tester")
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if subs, err := store.ListSubscriptions(ctx, clusterID); err != nil || len(subs) != 1 {
+		t.Errorf("ListSubscriptions = %+v, %v", subs, err)
+	}
+	if err := store.DeleteSubscription(ctx, sub.ID); err != nil {
+		t.Errorf("DeleteSubscription failed: %v", err)
+	}
+
+	if migrations, err := store.SchemaMigrations(ctx); err != nil || len(migrations) != LatestSchemaVersion() {
+		t.Errorf("SchemaMigrations = %d rows, %v; want %d", len(migrations), err, LatestSchemaVersion())
+	}
+}
+
+// testTablePrefix is the prefix used by the prefixed-store tests.
+const testTablePrefix = "crdbhist_test_"
+
+func setupPrefixedStoreTest(t *testing.T) *Store {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	store, err := New(ctx, getTestDB(t), WithTablePrefix(testTablePrefix))
+	if err != nil {
+		t.Fatalf("Failed to create prefixed store: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storeTables lists every table the store creates, by bare name.
+var storeTables = []string{
+	"schema_migrations", "snapshots", "settings", "changes", "metadata",
+	"annotations", "subscriptions", "acknowledgements", "raw_outputs",
+}
+
+// tablePrivileges are the privileges the store needs on tables it did not create.
+var tablePrivileges = []string{"SELECT", "INSERT"}
+
+// insufficientPrivilege is the SQLSTATE for a missing grant.
+const insufficientPrivilege = "42501"
+
+// checkPrivileges verifies that the history database user can create the store's
+// tables or, failing that, that they already exist and are writable. A missing
+// grant would otherwise surface mid-run as a confusing error from a migration or
+// the first SaveSnapshot; this returns one naming the privilege to grant.
+func checkPrivileges(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) error {
+	canCreate, err := canCreateTables(ctx, pool, prefix)
+	if err != nil {
+		return fmt.Errorf("checking history database privileges: %w", err)
+	}
+	if canCreate {
+		return nil
+	}
+
+	var dbName, user string
+	if err := pool.QueryRow(ctx, "SELECT current_database(), current_user").Scan(&dbName, &user); err != nil {
+		return fmt.Errorf("checking history database privileges: %w", err)
+	}
+
+	for _, table := range storeTables {
+		name := prefix.apply(table)
+
+		var exists bool
+		err := pool.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM information_schema.tables
+				WHERE table_schema = current_schema() AND table_name = $1
+			)
+		`, name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("checking history database privileges: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("history database user %s lacks the CREATE privilege needed to create table %s in database %s; grant it with: GRANT CREATE ON DATABASE %s TO %s",
+				user, name, dbName, dbName, user)
+		}
+
+		for _, privilege := range tablePrivileges {
+			var ok bool
+			if err := pool.QueryRow(ctx, "SELECT has_table_privilege($1, $2)", name, privilege).Scan(&ok); err != nil {
+				return fmt.Errorf("checking %s privilege on table %s: %w", privilege, name, err)
+			}
+			if !ok {
+				return fmt.Errorf("history database user %s lacks the %s privilege on table %s; grant it with: GRANT %s ON TABLE %s TO %s",
+					user, privilege, name, privilege, name, user)
+			}
+		}
+	}
+	return nil
+}
+
+// canCreateTables creates a throwaway table in a transaction that is rolled back,
+// reporting false if the user isn't allowed to.
+func canCreateTables(ctx context.Context, pool *pgxpool.Pool, prefix tablePrefix) (bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Unique per call, so replicas starting together don't contend on one name
+	probe := fmt.Sprintf("%sprivilege_check_%d", prefix, time.Now().UnixNano())
+	_, err = tx.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (id INT PRIMARY KEY)", probe))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == insufficientPrivilege {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/internal/testdbsuffix"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestNewReportsMissingPrivileges(t *testing.T) {
+	adminURL := os.Getenv("DATABASE_URL")
+	if adminURL == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	adminPool, err := pgxpool.New(ctx, adminURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to admin database: %v", err)
+	}
+	defer adminPool.Close()
+
+	suffix := testdbsuffix.Suffix()
+	testDB := "privilege_check_test" + suffix
+	testUser := "history_unprivileged_user" + suffix
+	for _, stmt := range []string{
+		fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", testDB),
+		fmt.Sprintf("CREATE DATABASE %s", testDB),
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %s", testUser),
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", testDB, testUser),
+	} {
+		if _, err := adminPool.Exec(ctx, stmt); err != nil {
+			t.Skipf("Cannot set up an under-privileged role: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		adminPool.Exec(context.Background(), fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", testDB))
+		adminPool.Exec(context.Background(), fmt.Sprintf("DROP USER IF EXISTS %s", testUser))
+	})
+
+	adminDBURL := replaceDatabase(adminURL, testDB)
+	u, err := url.Parse(adminDBURL)
+	if err != nil {
+		t.Fatalf("Failed to parse DATABASE_URL: %v", err)
+	}
+	u.User = url.User(testUser)
+	userURL := u.String()
+
+	// Passwordless login only works on insecure clusters
+	userPool, err := pgxpool.New(ctx, userURL)
+	if err == nil {
+		err = userPool.Ping(ctx)
+		userPool.Close()
+	}
+	if err != nil {
+		t.Skipf("Cannot connect as %s: %v", testUser, err)
+	}
+
+	t.Run("cannot create tables", func(t *testing.T) {
+		_, err := New(ctx, userURL)
+		if err == nil || !strings.Contains(err.Error(), "lacks the CREATE privilege") || !strings.Contains(err.Error(), testUser) {
+			t.Errorf("Expected an error naming the missing CREATE privilege, got %v", err)
+		}
+	})
+
+	t.Run("tables exist but are not writable", func(t *testing.T) {
+		adminStore, err := New(ctx, adminDBURL)
+		if err != nil {
+			t.Fatalf("Failed to create schema as admin: %v", err)
+		}
+		adminStore.Close()
+
+		_, err = New(ctx, userURL)
+		if err == nil || !strings.Contains(err.Error(), "privilege on table") {
+			t.Errorf("Expected an error naming a missing table privilege, got %v", err)
+		}
+	})
+}
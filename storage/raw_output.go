@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetRawOutput returns the complete result of the query that produced a snapshot,
+// as a JSON array with one object per row keyed by column name. Returns nil, nil
+// if the snapshot does not exist or was collected without raw output.
+func (s *Store) GetRawOutput(ctx context.Context, snapshotID int64) (json.RawMessage, error) {
+	var output string
+	err := s.pool.QueryRow(ctx,
+		s.sql("SELECT output::STRING FROM raw_outputs WHERE snapshot_id = $1"),
+		snapshotID,
+	).Scan(&output)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(output), nil
+}
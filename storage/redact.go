@@ -3,6 +3,7 @@ package storage
 import (
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // RedactedPlaceholder is the replacement value for redacted settings.
@@ -21,10 +22,14 @@ var defaultSensitivePatterns = []string{
 	"*private*",
 }
 
+// defaultSensitiveRegexps are the compiled defaultSensitivePatterns, used by IsSensitive.
+var defaultSensitiveRegexps = compilePatterns(defaultSensitivePatterns)
+
 // Redactor filters sensitive setting values.
 type Redactor struct {
-	patterns []*regexp.Regexp
-	enabled  bool
+	patterns     []*regexp.Regexp
+	enabled      bool
+	descriptions bool
 }
 
 // RedactorConfig holds redaction configuration.
@@ -33,6 +38,9 @@ type RedactorConfig struct {
 	Enabled bool
 	// AdditionalPatterns are extra patterns to redact (comma-separated).
 	AdditionalPatterns string
+	// Descriptions also redacts the descriptions of sensitive settings, which
+	// can quote example values. It has no effect unless Enabled is set.
+	Descriptions bool
 }
 
 // NewRedactor creates a new redactor with the given configuration.
@@ -54,19 +62,38 @@ func NewRedactor(cfg RedactorConfig) *Redactor {
 		}
 	}
 
-	// Compile glob patterns to regex
+	return &Redactor{
+		patterns:     compilePatterns(patterns),
+		enabled:      true,
+		descriptions: cfg.Descriptions,
+	}
+}
+
+// compilePatterns compiles glob patterns to case-insensitive regexes, skipping invalid ones.
+func compilePatterns(patterns []string) []*regexp.Regexp {
 	compiled := make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
-		regex := globToRegex(p)
-		if re, err := regexp.Compile("(?i)^" + regex + "$"); err == nil {
+		if re, err := compileGlob(p); err == nil {
 			compiled = append(compiled, re)
 		}
 	}
+	return compiled
+}
 
-	return &Redactor{
-		patterns: compiled,
-		enabled:  true,
+// compileGlob compiles a glob pattern to a case-insensitive regex matching whole strings.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)^" + globToRegex(pattern) + "$")
+}
+
+// IsSensitive returns true if the variable matches one of the default sensitive patterns.
+// Unlike Redactor.ShouldRedact, it does not depend on redaction being enabled.
+func IsSensitive(variable string) bool {
+	for _, re := range defaultSensitiveRegexps {
+		if re.MatchString(variable) {
+			return true
+		}
 	}
+	return false
 }
 
 // globToRegex converts a glob pattern to a regex pattern.
@@ -89,6 +116,42 @@ func globToRegex(glob string) string {
 	return result.String()
 }
 
+// globCacheSize bounds globCache. Patterns can come from requests (e.g. a
+// compare's ignore list), so the cache is emptied when full rather than grown.
+const globCacheSize = 1024
+
+var (
+	globCacheMu sync.Mutex
+	globCache   = make(map[string]*regexp.Regexp) // nil for an invalid pattern
+)
+
+// cachedGlob returns the compiled regex for pattern, compiling it on first use,
+// or nil if the pattern is invalid.
+func cachedGlob(pattern string) *regexp.Regexp {
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+	if re, ok := globCache[pattern]; ok {
+		return re
+	}
+	re, err := compileGlob(pattern)
+	if err != nil {
+		re = nil
+	}
+	if len(globCache) >= globCacheSize {
+		clear(globCache)
+	}
+	globCache[pattern] = re
+	return re
+}
+
+// MatchGlob reports whether s matches the glob pattern, case-insensitively.
+// Supported wildcards are * (any sequence) and ? (any single character). Each
+// pattern is compiled once and reused.
+func MatchGlob(pattern, s string) bool {
+	re := cachedGlob(pattern)
+	return re != nil && re.MatchString(s)
+}
+
 // ShouldRedact returns true if the variable name matches a sensitive pattern.
 func (r *Redactor) ShouldRedact(variable string) bool {
 	if !r.enabled {
@@ -111,11 +174,29 @@ func (r *Redactor) RedactValue(variable, value string) string {
 	return value
 }
 
+// RedactDescription returns RedactedPlaceholder for the non-empty description
+// of a sensitive variable when description redaction is enabled, otherwise the
+// original description.
+func (r *Redactor) RedactDescription(variable, description string) string {
+	if r.descriptions && description != "" && r.ShouldRedact(variable) {
+		return RedactedPlaceholder
+	}
+	return description
+}
+
 // RedactChange returns a copy of the change with sensitive values redacted.
+// A redacted change has Redacted set and Changed reporting whether the real
+// values differed before redaction. Its description is redacted too when
+// description redaction is enabled.
 func (r *Redactor) RedactChange(c Change) Change {
 	result := c
-	result.OldValue = r.RedactValue(c.Variable, c.OldValue)
-	result.NewValue = r.RedactValue(c.Variable, c.NewValue)
+	if r.ShouldRedact(c.Variable) {
+		result.OldValue = RedactedPlaceholder
+		result.NewValue = RedactedPlaceholder
+		result.Redacted = true
+		result.Changed = c.OldValue != c.NewValue
+		result.Description = r.RedactDescription(c.Variable, c.Description)
+	}
 	return result
 }
 
@@ -131,3 +212,16 @@ func (r *Redactor) RedactChanges(changes []Change) []Change {
 	}
 	return result
 }
+
+// RedactMetadata returns a copy of the metadata with values of sensitive keys redacted.
+func (r *Redactor) RedactMetadata(md map[string]string) map[string]string {
+	if !r.enabled {
+		return md
+	}
+
+	result := make(map[string]string, len(md))
+	for k, v := range md {
+		result[k] = r.RedactValue(k, v)
+	}
+	return result
+}
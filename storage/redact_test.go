@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"regexp"
 	"testing"
 )
@@ -141,6 +142,58 @@ func TestRedactor_RedactChange(t *testing.T) {
 	}
 }
 
+func TestRedactor_RedactChangeChangedIndicator(t *testing.T) {
+	t.Parallel()
+	r := NewRedactor(RedactorConfig{Enabled: true})
+
+	tests := []struct {
+		name         string
+		change       Change
+		wantRedacted bool
+		wantChanged  bool
+	}{
+		{"sensitive value changed", Change{Variable: "server.password", OldValue: "a", NewValue: "b"}, true, true},
+		{"sensitive value unchanged", Change{Variable: "server.password", OldValue: "a", NewValue: "a"}, true, false},
+		{"non-sensitive change", Change{Variable: "server.host", OldValue: "a", NewValue: "b"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.RedactChange(tt.change)
+			if got.Redacted != tt.wantRedacted || got.Changed != tt.wantChanged {
+				t.Errorf("RedactChange() redacted=%v changed=%v, want redacted=%v changed=%v", got.Redacted, got.Changed, tt.wantRedacted, tt.wantChanged)
+			}
+		})
+	}
+
+	disabled := NewRedactor(RedactorConfig{Enabled: false})
+	if got := disabled.RedactChange(tests[0].change); got.Redacted || got.NewValue != "b" {
+		t.Errorf("Expected a disabled redactor to leave the change alone, got %+v", got)
+	}
+}
+
+func TestRedactor_RedactDescriptions(t *testing.T) {
+	t.Parallel()
+	r := NewRedactor(RedactorConfig{Enabled: true, Descriptions: true})
+
+	redacted := r.RedactChange(Change{Variable: "server.password", OldValue: "a", NewValue: "b", Description: "Defaults to hunter2"})
+	if redacted.Description != RedactedPlaceholder {
+		t.Errorf("expected redacted description, got %q", redacted.Description)
+	}
+	plain := r.RedactChange(Change{Variable: "server.host", OldValue: "a", NewValue: "b", Description: "Host name"})
+	if plain.Description != "Host name" {
+		t.Errorf("non-sensitive description should not be redacted, got %q", plain.Description)
+	}
+	if got := r.RedactDescription("server.password", ""); got != "" {
+		t.Errorf("empty description should stay empty, got %q", got)
+	}
+
+	// Descriptions only apply alongside value redaction
+	disabled := NewRedactor(RedactorConfig{Descriptions: true})
+	if got := disabled.RedactDescription("server.password", "Defaults to hunter2"); got != "Defaults to hunter2" {
+		t.Errorf("expected a disabled redactor to leave the description alone, got %q", got)
+	}
+}
+
 func TestRedactor_RedactChanges(t *testing.T) {
 	t.Parallel()
 	r := NewRedactor(RedactorConfig{Enabled: true})
@@ -201,3 +254,73 @@ func TestGlobToRegex(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		pattern  string
+		input    string
+		expected bool
+	}{
+		{"kv.rangefeed.*", "kv.rangefeed.enabled", true},
+		{"kv.rangefeed.*", "kv.closed_timestamp.target_duration", false},
+		{"KV.*", "kv.rangefeed.enabled", true},
+		{"sql.stats.?utomatic*", "sql.stats.automatic_collection.enabled", true},
+		{"*", "anything", true},
+		{"exact.name", "exact.name.suffix", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.input); got != tt.expected {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestMatchGlobCachesPatterns(t *testing.T) {
+	if !MatchGlob("cache.test.*", "cache.test.enabled") {
+		t.Fatal("MatchGlob(cache.test.*) did not match")
+	}
+	globCacheMu.Lock()
+	first := globCache["cache.test.*"]
+	globCacheMu.Unlock()
+	if first == nil {
+		t.Fatal("Expected the compiled pattern to be cached")
+	}
+	MatchGlob("cache.test.*", "other")
+	globCacheMu.Lock()
+	second := globCache["cache.test.*"]
+	globCacheMu.Unlock()
+	if second != first {
+		t.Error("Expected the cached pattern to be reused, got a recompiled one")
+	}
+
+	for i := range 2 * globCacheSize {
+		MatchGlob(fmt.Sprintf("cache.bound.%d", i), "x")
+	}
+	globCacheMu.Lock()
+	n := len(globCache)
+	globCacheMu.Unlock()
+	if n > globCacheSize {
+		t.Errorf("Expected at most %d cached patterns, got %d", globCacheSize, n)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		variable string
+		want     bool
+	}{
+		{"server.password_hash", true},
+		{"enterprise.license", true},
+		{"SERVER.SECRET_KEY", true},
+		{"kv.rangefeed.enabled", false},
+		{"sql.defaults.distsql", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSensitive(tt.variable); got != tt.want {
+			t.Errorf("IsSensitive(%q) = %v, want %v", tt.variable, got, tt.want)
+		}
+	}
+}
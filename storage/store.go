@@ -3,7 +3,10 @@ package storage
 import (
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"io"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,27 +14,67 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultCollectionQuery is the query the collector runs to read cluster settings.
+// Snapshots recorded before the query was stored are attributed to it.
+const DefaultCollectionQuery = "SHOW CLUSTER SETTINGS"
+
+// ZoneConfigQuery is the query the collector runs to read a cluster's zone
+// configurations, stored as settings named by their target (e.g. "RANGE
+// default") whose value is the configuration's SQL.
+const ZoneConfigQuery = "SHOW ALL ZONE CONFIGURATIONS"
+
+// ZoneConfigType is the setting type of collected zone configurations.
+const ZoneConfigType = "zone"
+
 type Setting struct {
-	Variable    string
-	Value       string
-	SettingType string
-	Description string
+	Variable     string
+	Value        string
+	SettingType  string
+	Description  string
+	DefaultValue string // as reported by the cluster; empty for snapshots taken before it was recorded
 }
 
 type Change struct {
-	ClusterID   string // Which cluster this change belongs to
-	DetectedAt  time.Time
-	Variable    string
-	OldValue    string
-	NewValue    string
-	Description string
-	Version     string
+	ClusterID   string    `json:"cluster_id"` // Which cluster this change belongs to
+	DetectedAt  time.Time `json:"detected_at"`
+	Variable    string    `json:"variable"`
+	OldValue    string    `json:"old_value"`
+	NewValue    string    `json:"new_value"`
+	Description string    `json:"description"`
+	Version     string    `json:"version"`
+
+	// CompactedReverts counts the later changes folded into this one by
+	// CompactReverts because, together, they had no net effect.
+	CompactedReverts int64 `json:"compacted_reverts,omitempty"`
+
+	// Redacted and Changed are set by Redactor.RedactChange when the values were
+	// replaced by the placeholder. Changed reports whether the real old and new
+	// values differ, so a sensitive change can be flagged without revealing it.
+	Redacted bool `json:"redacted,omitempty"`
+	Changed  bool `json:"changed,omitempty"`
+}
+
+// Annotation severities, used to surface the annotated changes that matter most.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// IsValidSeverity reports whether s is a known annotation severity.
+func IsValidSeverity(s string) bool {
+	switch s {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+		return true
+	}
+	return false
 }
 
 type Annotation struct {
 	ID        int64
 	ChangeID  int64
 	Content   string
+	Severity  string // One of the Severity constants
 	CreatedBy string
 	CreatedAt time.Time
 	UpdatedBy string    // Empty if never updated
@@ -50,10 +93,68 @@ type SnapshotInfo struct {
 	ID          int64     `json:"id,string"` // String to avoid JavaScript precision loss
 	ClusterID   string    `json:"cluster_id"`
 	CollectedAt time.Time `json:"collected_at"`
+	Query       string    `json:"query"` // The query that produced the snapshot
+
+	// PollIntervalSeconds is the collector's poll interval when the snapshot was
+	// taken, so gaps in history can be told apart from slower polling. 0 when unknown.
+	PollIntervalSeconds int64 `json:"poll_interval_seconds,omitempty"`
+
+	// Label is the collector's configured snapshot label at the time, e.g. the
+	// release being deployed. Empty when none is configured.
+	Label string `json:"label,omitempty"`
+}
+
+// SettingChangeCount is the number of changes recorded for a single variable.
+type SettingChangeCount struct {
+	Variable    string    `json:"variable"`
+	Count       int64     `json:"count"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+// ClusterChangeCount is the number of changes recorded for a single cluster.
+type ClusterChangeCount struct {
+	ClusterID   string    `json:"cluster_id"`
+	Count       int64     `json:"count"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+// KeepChanges is how many of each variable's most recent changes age-based
+// cleanup keeps, e.g. to preserve a trend however old it is.
+type KeepChanges struct {
+	PerVariable int            // kept for every variable (0 keeps none)
+	Variables   map[string]int // overrides PerVariable for the named variables
+}
+
+// For returns how many of variable's most recent changes are kept.
+func (k KeepChanges) For(variable string) int {
+	if n, ok := k.Variables[variable]; ok {
+		return n
+	}
+	return k.PerVariable
+}
+
+func (k KeepChanges) isZero() bool {
+	return k.PerVariable == 0 && len(k.Variables) == 0
+}
+
+// overrides returns the per-variable counts as parallel arrays, for SQL.
+func (k KeepChanges) overrides() ([]string, []int64) {
+	variables := make([]string, 0, len(k.Variables))
+	counts := make([]int64, 0, len(k.Variables))
+	for v, n := range k.Variables {
+		variables = append(variables, v)
+		counts = append(counts, int64(n))
+	}
+	return variables, counts
 }
 
 type Store struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	prefix tablePrefix // prepended to every table name (see WithTablePrefix)
+
+	tlsMinVersion   uint16      // minimum TLS version for connections (see WithTLSMinVersion)
+	applicationName string      // application_name of connections (see WithApplicationName)
+	diff            DiffOptions // how values are compared for change detection (see WithDiffOptions)
 }
 
 func derefString(s *string) string {
@@ -91,18 +192,33 @@ type querier interface {
 	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 }
 
-func New(ctx context.Context, connString string) (*Store, error) {
-	pool, err := pgxpool.New(ctx, connString)
+func New(ctx context.Context, connString string, opts ...Option) (*Store, error) {
+	s := &Store{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.prefix.validate(); err != nil {
+		return nil, err
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	SetTLSMinVersion(&poolConfig.ConnConfig.Config, s.tlsMinVersion)
+	SetApplicationName(&poolConfig.ConnConfig.Config, s.applicationName)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := initAndMigrate(ctx, pool); err != nil {
+	if err := initAndMigrate(ctx, pool, s.prefix); err != nil {
 		pool.Close()
 		return nil, err
 	}
 
-	return &Store{pool: pool}, nil
+	s.pool = pool
+	return s, nil
 }
 
 func (s *Store) Close() {
@@ -132,7 +248,7 @@ func (s *Store) GetLatestSnapshot(ctx context.Context, clusterID string) (map[st
 func (s *Store) getLatestSnapshotWith(ctx context.Context, q querier, clusterID string) (map[string]Setting, error) {
 	var snapshotID int64
 	err := q.QueryRow(ctx,
-		"SELECT id FROM snapshots WHERE cluster_id = $1 ORDER BY collected_at DESC LIMIT 1",
+		s.sql("SELECT id FROM snapshots WHERE cluster_id = $1 ORDER BY collected_at DESC LIMIT 1"),
 		clusterID,
 	).Scan(&snapshotID)
 	if err == pgx.ErrNoRows {
@@ -143,7 +259,7 @@ func (s *Store) getLatestSnapshotWith(ctx context.Context, q querier, clusterID
 	}
 
 	rows, err := q.Query(ctx,
-		"SELECT variable, value, setting_type, description FROM settings WHERE snapshot_id = $1",
+		s.sql("SELECT variable, value, setting_type, description, COALESCE(default_value, '') FROM settings WHERE snapshot_id = $1"),
 		snapshotID,
 	)
 	if err != nil {
@@ -154,7 +270,7 @@ func (s *Store) getLatestSnapshotWith(ctx context.Context, q querier, clusterID
 	settings := make(map[string]Setting)
 	for rows.Next() {
 		var setting Setting
-		if err := rows.Scan(&setting.Variable, &setting.Value, &setting.SettingType, &setting.Description); err != nil {
+		if err := rows.Scan(&setting.Variable, &setting.Value, &setting.SettingType, &setting.Description, &setting.DefaultValue); err != nil {
 			return nil, err
 		}
 		settings[setting.Variable] = setting
@@ -163,14 +279,32 @@ func (s *Store) getLatestSnapshotWith(ctx context.Context, q querier, clusterID
 	return settings, rows.Err()
 }
 
+// GetSettingsAt reconstructs a cluster's effective settings at a point in time:
+// those of the latest snapshot collected at or before at. Returns nil, nil if the
+// cluster has no snapshot that old.
+func (s *Store) GetSettingsAt(ctx context.Context, clusterID string, at time.Time) (map[string]Setting, error) {
+	var snapshotID int64
+	err := s.pool.QueryRow(ctx,
+		s.sql("SELECT id FROM snapshots WHERE cluster_id = $1 AND collected_at <= $2 ORDER BY collected_at DESC LIMIT 1"),
+		clusterID, at,
+	).Scan(&snapshotID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSnapshotByID(ctx, snapshotID)
+}
+
 // ListSnapshots returns recent snapshots for a cluster, ordered by most recent first.
 func (s *Store) ListSnapshots(ctx context.Context, clusterID string, limit int) ([]SnapshotInfo, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, cluster_id, collected_at
+		s.sql(`SELECT id, cluster_id, collected_at, query, poll_interval_seconds, label
 		 FROM snapshots
 		 WHERE cluster_id = $1
 		 ORDER BY collected_at DESC
-		 LIMIT $2`,
+		 LIMIT $2`),
 		clusterID, limit,
 	)
 	if err != nil {
@@ -181,9 +315,13 @@ func (s *Store) ListSnapshots(ctx context.Context, clusterID string, limit int)
 	var snapshots []SnapshotInfo
 	for rows.Next() {
 		var snap SnapshotInfo
-		if err := rows.Scan(&snap.ID, &snap.ClusterID, &snap.CollectedAt); err != nil {
+		var interval *int64
+		if err := rows.Scan(&snap.ID, &snap.ClusterID, &snap.CollectedAt, &snap.Query, &interval, &snap.Label); err != nil {
 			return nil, err
 		}
+		if interval != nil {
+			snap.PollIntervalSeconds = *interval
+		}
 		snapshots = append(snapshots, snap)
 	}
 	return snapshots, rows.Err()
@@ -193,9 +331,9 @@ func (s *Store) ListSnapshots(ctx context.Context, clusterID string, limit int)
 // Returns nil, nil if the snapshot does not exist.
 func (s *Store) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[string]Setting, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT variable, value, setting_type, description
+		s.sql(`SELECT variable, value, setting_type, description, COALESCE(default_value, '')
 		 FROM settings
-		 WHERE snapshot_id = $1`,
+		 WHERE snapshot_id = $1`),
 		snapshotID,
 	)
 	if err != nil {
@@ -206,7 +344,7 @@ func (s *Store) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[stri
 	settings := make(map[string]Setting)
 	for rows.Next() {
 		var setting Setting
-		if err := rows.Scan(&setting.Variable, &setting.Value, &setting.SettingType, &setting.Description); err != nil {
+		if err := rows.Scan(&setting.Variable, &setting.Value, &setting.SettingType, &setting.Description, &setting.DefaultValue); err != nil {
 			return nil, err
 		}
 		settings[setting.Variable] = setting
@@ -217,7 +355,7 @@ func (s *Store) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[stri
 	if len(settings) == 0 {
 		// Check if the snapshot exists but has no settings
 		var exists bool
-		err := s.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM snapshots WHERE id = $1)", snapshotID).Scan(&exists)
+		err := s.pool.QueryRow(ctx, s.sql("SELECT EXISTS(SELECT 1 FROM snapshots WHERE id = $1)"), snapshotID).Scan(&exists)
 		if err != nil {
 			return nil, err
 		}
@@ -229,9 +367,25 @@ func (s *Store) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[stri
 }
 
 func (s *Store) SaveSnapshot(ctx context.Context, clusterID string, settings []Setting, version string) error {
+	_, err := s.SaveSnapshotWithChanges(ctx, clusterID, settings, version)
+	return err
+}
+
+// SaveSnapshotWithChanges stores a snapshot like SaveSnapshot and returns the changes
+// it detected against the previous snapshot, so callers can act on them (e.g. notifications).
+func (s *Store) SaveSnapshotWithChanges(ctx context.Context, clusterID string, settings []Setting, version string) ([]Change, error) {
+	return s.SaveCollectedSnapshot(ctx, clusterID, settings, version, DefaultCollectionQuery, 0, "", nil)
+}
+
+// SaveCollectedSnapshot stores a snapshot like SaveSnapshotWithChanges, recording
+// the query that produced the settings, the collector's poll interval (0 if
+// unknown), and its snapshot label (possibly empty) so the snapshot is
+// self-describing. A non-nil raw, the query's complete result as JSON, is kept
+// alongside the snapshot for GetRawOutput.
+func (s *Store) SaveCollectedSnapshot(ctx context.Context, clusterID string, settings []Setting, version, query string, pollInterval time.Duration, label string, raw json.RawMessage) ([]Change, error) {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
@@ -240,72 +394,194 @@ func (s *Store) SaveSnapshot(ctx context.Context, clusterID string, settings []S
 	// Get previous settings for comparison (inside transaction to avoid race condition)
 	prevSettings, err := s.getLatestSnapshotWith(ctx, tx, clusterID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// A requested rebaseline saves this snapshot without comparing it to the last,
+	// and is consumed in the same transaction.
+	var rebaseline string
+	err = tx.QueryRow(ctx,
+		s.sql("DELETE FROM metadata WHERE cluster_id = $1 AND key = $2 RETURNING value"),
+		clusterID, metadataRebaseline,
+	).Scan(&rebaseline)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if rebaseline != "" {
+		prevSettings = nil
 	}
 
 	// Create new snapshot
 	var snapshotID int64
 	err = tx.QueryRow(ctx,
-		"INSERT INTO snapshots (cluster_id, collected_at) VALUES ($1, $2) RETURNING id",
-		clusterID, now,
+		s.sql("INSERT INTO snapshots (cluster_id, collected_at, query, poll_interval_seconds, label) VALUES ($1, $2, $3, $4, $5) RETURNING id"),
+		clusterID, now, query, pollIntervalSeconds(pollInterval), label,
 	).Scan(&snapshotID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	settings = dedupeSettings(clusterID, settings)
+
 	// Insert all settings using batch for efficiency
 	batch := &pgx.Batch{}
+	if raw != nil {
+		batch.Queue(s.sql("INSERT INTO raw_outputs (snapshot_id, output) VALUES ($1, $2)"), snapshotID, string(raw))
+	}
 	currentSettings := make(map[string]Setting)
 	for _, setting := range settings {
 		batch.Queue(
-			"INSERT INTO settings (snapshot_id, variable, value, setting_type, description) VALUES ($1, $2, $3, $4, $5)",
-			snapshotID, setting.Variable, setting.Value, setting.SettingType, setting.Description,
+			s.sql("INSERT INTO settings (snapshot_id, variable, value, setting_type, description, default_value) VALUES ($1, $2, $3, $4, $5, $6)"),
+			snapshotID, setting.Variable, setting.Value, setting.SettingType, setting.Description, setting.DefaultValue,
 		)
 		currentSettings[setting.Variable] = setting
 	}
 
+	changes := detectChanges(clusterID, prevSettings, currentSettings, now, version, s.diff)
+	for _, c := range changes {
+		// Added settings have a NULL old value and removed settings a NULL new value
+		var oldValue, newValue any = c.OldValue, c.NewValue
+		if _, existed := prevSettings[c.Variable]; !existed {
+			oldValue = nil
+		}
+		if _, exists := currentSettings[c.Variable]; !exists {
+			newValue = nil
+		}
+		batch.Queue(
+			s.sql("INSERT INTO changes (cluster_id, detected_at, variable, old_value, new_value, description, version) VALUES ($1, $2, $3, $4, $5, $6, $7)"),
+			clusterID, now, c.Variable, oldValue, newValue, c.Description, version,
+		)
+	}
+
+	// Execute batch
+	br := tx.SendBatch(ctx, batch)
+	if err := br.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// DiffOptions tunes how values are compared when detecting changes. The stored
+// values are always the raw ones collected.
+type DiffOptions struct {
+	// CaseInsensitive holds globs of variables (see MatchGlob) whose values are
+	// compared without regard to case, e.g. an enum rendered "ON" by one version
+	// and "on" by the next. "*" matches every setting.
+	CaseInsensitive []string
+}
+
+// WithDiffOptions sets how values are compared when detecting changes.
+func WithDiffOptions(opts DiffOptions) Option {
+	return func(s *Store) {
+		s.diff = opts
+	}
+}
+
+// equalValues reports whether a and b are the same value of variable.
+func (o DiffOptions) equalValues(variable, a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, pattern := range o.CaseInsensitive {
+		if MatchGlob(pattern, variable) {
+			return strings.EqualFold(a, b)
+		}
+	}
+	return false
+}
+
+// detectChanges compares the current settings against the previous snapshot and
+// returns the modified, added, and removed settings as changes. Additions are
+// only reported when there is a previous snapshot to compare against.
+func detectChanges(clusterID string, prev, current map[string]Setting, now time.Time, version string, opts DiffOptions) []Change {
+	var changes []Change
+
 	// Check for modified or new settings
-	for variable, current := range currentSettings {
-		if prev, exists := prevSettings[variable]; exists {
-			if prev.Value != current.Value {
-				batch.Queue(
-					"INSERT INTO changes (cluster_id, detected_at, variable, old_value, new_value, description, version) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-					clusterID, now, variable, prev.Value, current.Value, current.Description, version,
-				)
+	for variable, cur := range current {
+		if p, exists := prev[variable]; exists {
+			if !opts.equalValues(variable, p.Value, cur.Value) {
+				changes = append(changes, Change{ClusterID: clusterID, DetectedAt: now, Variable: variable, OldValue: p.Value, NewValue: cur.Value, Description: cur.Description, Version: version})
 			}
-		} else if prevSettings != nil {
+		} else if prev != nil {
 			// New setting (only record if we had previous snapshot)
-			batch.Queue(
-				"INSERT INTO changes (cluster_id, detected_at, variable, old_value, new_value, description, version) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-				clusterID, now, variable, nil, current.Value, current.Description, version,
-			)
+			changes = append(changes, Change{ClusterID: clusterID, DetectedAt: now, Variable: variable, NewValue: cur.Value, Description: cur.Description, Version: version})
 		}
 	}
 
 	// Check for removed settings
-	for variable, prev := range prevSettings {
-		if _, exists := currentSettings[variable]; !exists {
-			batch.Queue(
-				"INSERT INTO changes (cluster_id, detected_at, variable, old_value, new_value, description, version) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-				clusterID, now, variable, prev.Value, nil, prev.Description, version,
-			)
+	for variable, p := range prev {
+		if _, exists := current[variable]; !exists {
+			changes = append(changes, Change{ClusterID: clusterID, DetectedAt: now, Variable: variable, OldValue: p.Value, Description: p.Description, Version: version})
 		}
 	}
 
-	// Execute batch
-	br := tx.SendBatch(ctx, batch)
-	if err := br.Close(); err != nil {
-		return err
+	return changes
+}
+
+// DiffSettings returns the changes saving settings would record against prev,
+// the settings of the cluster's latest snapshot (nil if it has none), sorted by
+// variable. Nothing is stored.
+func DiffSettings(clusterID string, prev map[string]Setting, settings []Setting, version string, opts DiffOptions) []Change {
+	settings = dedupeSettings(clusterID, settings)
+	current := make(map[string]Setting, len(settings))
+	for _, setting := range settings {
+		current[setting.Variable] = setting
+	}
+	changes := detectChanges(clusterID, prev, current, time.Now(), version, opts)
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Variable, b.Variable) })
+	return changes
+}
+
+// pollIntervalSeconds converts a poll interval for storage, with NULL for unknown.
+func pollIntervalSeconds(d time.Duration) any {
+	if d <= 0 {
+		return nil
 	}
+	return int64(d / time.Second)
+}
 
-	return tx.Commit(ctx)
+// dedupeSettings drops repeated variables from settings, keeping the last value
+// seen for each at the position of its first occurrence. The source query should
+// never return a variable twice, so duplicates are logged as a data-quality problem.
+func dedupeSettings(clusterID string, settings []Setting) []Setting {
+	index := make(map[string]int, len(settings))
+	var duplicates []string
+	deduped := settings
+	for i, setting := range settings {
+		j, seen := index[setting.Variable]
+		if !seen {
+			index[setting.Variable] = len(index)
+			if duplicates != nil {
+				deduped = append(deduped, setting)
+			}
+			continue
+		}
+		if duplicates == nil {
+			// First duplicate: copy so the caller's slice is left untouched
+			deduped = append(make([]Setting, 0, len(settings)), settings[:i]...)
+		}
+		if !slices.Contains(duplicates, setting.Variable) {
+			duplicates = append(duplicates, setting.Variable)
+		}
+		deduped[j] = setting
+	}
+	if duplicates == nil {
+		return settings
+	}
+	slog.Warn("Collected settings contain duplicate variables, keeping the last value of each",
+		"cluster", clusterID, "variables", duplicates, "received", len(settings), "kept", len(deduped))
+	return deduped
 }
 
 // scanChange scans a single row from a changes query into a Change.
 func scanChange(rows pgx.Rows) (Change, error) {
 	var c Change
 	var nf changeNullableFields
-	if err := rows.Scan(&c.ClusterID, &c.DetectedAt, &c.Variable, &nf.OldValue, &nf.NewValue, &nf.Description, &nf.Version); err != nil {
+	if err := rows.Scan(&c.ClusterID, &c.DetectedAt, &c.Variable, &nf.OldValue, &nf.NewValue, &nf.Description, &nf.Version, &c.CompactedReverts); err != nil {
 		return Change{}, err
 	}
 	nf.applyTo(&c)
@@ -313,10 +589,31 @@ func scanChange(rows pgx.Rows) (Change, error) {
 }
 
 func (s *Store) GetChanges(ctx context.Context, clusterID string, limit int) ([]Change, error) {
-	rows, err := s.pool.Query(ctx,
-		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version FROM changes WHERE cluster_id = $1 ORDER BY detected_at DESC LIMIT $2",
+	return s.queryChanges(ctx,
+		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE cluster_id = $1 ORDER BY detected_at DESC, id DESC LIMIT $2",
 		clusterID, limit,
 	)
+}
+
+// GetChangesInRange returns up to limit of a cluster's changes detected in
+// [from, to), newest first. A zero to leaves the range open-ended.
+func (s *Store) GetChangesInRange(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]Change, error) {
+	if to.IsZero() {
+		return s.queryChanges(ctx,
+			"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE cluster_id = $1 AND detected_at >= $2 ORDER BY detected_at DESC, id DESC LIMIT $3",
+			clusterID, from, limit,
+		)
+	}
+	return s.queryChanges(ctx,
+		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE cluster_id = $1 AND detected_at >= $2 AND detected_at < $3 ORDER BY detected_at DESC, id DESC LIMIT $4",
+		clusterID, from, to, limit,
+	)
+}
+
+// queryChanges runs a query selecting the columns scanChange reads and
+// collects its rows.
+func (s *Store) queryChanges(ctx context.Context, query string, args ...any) ([]Change, error) {
+	rows, err := s.pool.Query(ctx, s.sql(query), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -338,7 +635,7 @@ func (s *Store) GetChanges(ctx context.Context, clusterID string, limit int) ([]
 // This is suitable for large exports where loading all changes at once would use too much memory.
 func (s *Store) StreamChanges(ctx context.Context, clusterID string, fn func(Change) error) error {
 	rows, err := s.pool.Query(ctx,
-		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version FROM changes WHERE cluster_id = $1 ORDER BY detected_at DESC",
+		s.sql("SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE cluster_id = $1 ORDER BY detected_at DESC, id DESC"),
 		clusterID,
 	)
 	if err != nil {
@@ -359,10 +656,41 @@ func (s *Store) StreamChanges(ctx context.Context, clusterID string, fn func(Cha
 	return rows.Err()
 }
 
+// StreamChangesAfter calls fn for each change with an ID greater than afterID, oldest
+// first, passing the change ID so callers can track how far they have read.
+// Incremental exports use this to resume from the last exported change. IDs come
+// from unique_rowid and do not follow commit order, so a change committed later
+// can have a lower ID than one already returned; see cmd.untilUnsettled.
+func (s *Store) StreamChangesAfter(ctx context.Context, clusterID string, afterID int64, fn func(int64, Change) error) error {
+	rows, err := s.pool.Query(ctx,
+		s.sql("SELECT id, cluster_id, detected_at, variable, old_value, new_value, description, version FROM changes WHERE cluster_id = $1 AND id > $2 ORDER BY id"),
+		clusterID, afterID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var c Change
+		var nf changeNullableFields
+		if err := rows.Scan(&id, &c.ClusterID, &c.DetectedAt, &c.Variable, &nf.OldValue, &nf.NewValue, &nf.Description, &nf.Version); err != nil {
+			return err
+		}
+		nf.applyTo(&c)
+		if err := fn(id, c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetAllChanges retrieves changes for all clusters (used for export).
 func (s *Store) GetAllChanges(ctx context.Context, limit int) ([]Change, error) {
 	rows, err := s.pool.Query(ctx,
-		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version FROM changes ORDER BY detected_at DESC LIMIT $1",
+		s.sql("SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes ORDER BY detected_at DESC, id DESC LIMIT $1"),
 		limit,
 	)
 	if err != nil {
@@ -382,12 +710,101 @@ func (s *Store) GetAllChanges(ctx context.Context, limit int) ([]Change, error)
 	return changes, rows.Err()
 }
 
+// SearchChanges returns up to limit changes, newest first, whose variable, old
+// or new value, or description contains query, ignoring case. An empty
+// clusterID searches every cluster.
+func (s *Store) SearchChanges(ctx context.Context, clusterID, query string, limit int) ([]Change, error) {
+	const match = "(variable ILIKE $1 OR old_value ILIKE $1 OR new_value ILIKE $1 OR description ILIKE $1)"
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+	if clusterID == "" {
+		return s.queryChanges(ctx,
+			"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE "+match+" ORDER BY detected_at DESC, id DESC LIMIT $2",
+			pattern, limit,
+		)
+	}
+	return s.queryChanges(ctx,
+		"SELECT cluster_id, detected_at, variable, old_value, new_value, description, version, compacted_reverts FROM changes WHERE "+match+" AND cluster_id = $2 ORDER BY detected_at DESC, id DESC LIMIT $3",
+		pattern, clusterID, limit,
+	)
+}
+
+// GetTopChangedSettings returns the variables with the most changes detected in [from, to)
+// for a cluster, ordered by count descending (ties broken by variable name).
+func (s *Store) GetTopChangedSettings(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]SettingChangeCount, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT variable, count(*), max(detected_at)
+		 FROM changes
+		 WHERE cluster_id = $1 AND detected_at >= $2 AND detected_at < $3
+		 GROUP BY variable
+		 ORDER BY count(*) DESC, variable
+		 LIMIT $4`),
+		clusterID, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []SettingChangeCount{}
+	for rows.Next() {
+		var c SettingChangeCount
+		if err := rows.Scan(&c.Variable, &c.Count, &c.LastChanged); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// CountChanges returns the number of changes recorded for a cluster.
+func (s *Store) CountChanges(ctx context.Context, clusterID string) (int64, error) {
+	var count int64
+	err := s.pool.QueryRow(ctx, s.sql("SELECT count(*) FROM changes WHERE cluster_id = $1"), clusterID).Scan(&count)
+	return count, err
+}
+
+// HasChange reports whether the store holds the change with the given ID.
+func (s *Store) HasChange(ctx context.Context, changeID int64) (bool, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, s.sql("SELECT EXISTS(SELECT 1 FROM changes WHERE id = $1)"), changeID).Scan(&exists)
+	return exists, err
+}
+
+// CountChangesByCluster returns every cluster with changes detected since the given time,
+// ordered by count descending (ties broken by cluster ID). Clusters without changes are omitted.
+func (s *Store) CountChangesByCluster(ctx context.Context, since time.Time) ([]ClusterChangeCount, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT cluster_id, count(*), max(detected_at)
+		 FROM changes
+		 WHERE detected_at >= $1
+		 GROUP BY cluster_id
+		 ORDER BY count(*) DESC, cluster_id`),
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []ClusterChangeCount{}
+	for rows.Next() {
+		var c ClusterChangeCount
+		if err := rows.Scan(&c.ClusterID, &c.Count, &c.LastChanged); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
 // CleanupOldSnapshots removes snapshots older than the specified duration for a specific cluster.
 // Associated settings are automatically deleted via ON DELETE CASCADE.
 func (s *Store) CleanupOldSnapshots(ctx context.Context, clusterID string, retention time.Duration) (int64, error) {
 	cutoff := time.Now().Add(-retention)
 	result, err := s.pool.Exec(ctx,
-		"DELETE FROM snapshots WHERE cluster_id = $1 AND collected_at < $2",
+		s.sql("DELETE FROM snapshots WHERE cluster_id = $1 AND collected_at < $2"),
 		clusterID, cutoff,
 	)
 	if err != nil {
@@ -398,10 +815,37 @@ func (s *Store) CleanupOldSnapshots(ctx context.Context, clusterID string, reten
 
 // CleanupOldChanges removes change records older than the specified duration for a specific cluster.
 func (s *Store) CleanupOldChanges(ctx context.Context, clusterID string, retention time.Duration) (int64, error) {
+	return s.CleanupOldChangesKeeping(ctx, clusterID, retention, KeepChanges{})
+}
+
+// CleanupOldChangesKeeping removes change records older than the specified
+// duration for a specific cluster, except each variable's most recent changes
+// as counted by keep.
+func (s *Store) CleanupOldChangesKeeping(ctx context.Context, clusterID string, retention time.Duration, keep KeepChanges) (int64, error) {
 	cutoff := time.Now().Add(-retention)
+	if keep.isZero() {
+		result, err := s.pool.Exec(ctx,
+			s.sql("DELETE FROM changes WHERE cluster_id = $1 AND detected_at < $2"),
+			clusterID, cutoff,
+		)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected(), nil
+	}
+
+	// Rank each variable's changes newest first; the per-variable count is looked
+	// up by position in the parallel override arrays, falling back to the default.
+	variables, counts := keep.overrides()
 	result, err := s.pool.Exec(ctx,
-		"DELETE FROM changes WHERE cluster_id = $1 AND detected_at < $2",
-		clusterID, cutoff,
+		s.sql(`DELETE FROM changes WHERE cluster_id = $1 AND detected_at < $2 AND id NOT IN (
+			SELECT id FROM (
+				SELECT id, variable, row_number() OVER (PARTITION BY variable ORDER BY detected_at DESC, id DESC) AS rn
+				FROM changes WHERE cluster_id = $1
+			) AS ranked
+			WHERE rn <= COALESCE(($5::INT8[])[array_position($4::STRING[], variable)], $3)
+		)`),
+		clusterID, cutoff, keep.PerVariable, variables, counts,
 	)
 	if err != nil {
 		return 0, err
@@ -412,9 +856,9 @@ func (s *Store) CleanupOldChanges(ctx context.Context, clusterID string, retenti
 // SetMetadata stores a key-value pair in the metadata table for a specific cluster.
 func (s *Store) SetMetadata(ctx context.Context, clusterID, key, value string) error {
 	_, err := s.pool.Exec(ctx,
-		`INSERT INTO metadata (cluster_id, key, value, updated_at) VALUES ($1, $2, $3, NOW())
+		s.sql(`INSERT INTO metadata (cluster_id, key, value, updated_at) VALUES ($1, $2, $3, NOW())
 		 ON CONFLICT (cluster_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
-		 WHERE metadata.value IS DISTINCT FROM EXCLUDED.value`,
+		 WHERE metadata.value IS DISTINCT FROM EXCLUDED.value`),
 		clusterID, key, value,
 	)
 	return err
@@ -424,7 +868,7 @@ func (s *Store) SetMetadata(ctx context.Context, clusterID, key, value string) e
 func (s *Store) GetMetadata(ctx context.Context, clusterID, key string) (string, error) {
 	var value string
 	err := s.pool.QueryRow(ctx,
-		"SELECT value FROM metadata WHERE cluster_id = $1 AND key = $2",
+		s.sql("SELECT value FROM metadata WHERE cluster_id = $1 AND key = $2"),
 		clusterID, key,
 	).Scan(&value)
 	if err == pgx.ErrNoRows {
@@ -433,6 +877,45 @@ func (s *Store) GetMetadata(ctx context.Context, clusterID, key string) (string,
 	return value, err
 }
 
+// GetAllMetadata retrieves every metadata key-value pair stored for a specific cluster.
+func (s *Store) GetAllMetadata(ctx context.Context, clusterID string) (map[string]string, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql("SELECT key, value FROM metadata WHERE cluster_id = $1"),
+		clusterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	md := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		md[key] = value
+	}
+	return md, rows.Err()
+}
+
+// metadataRebaseline is the metadata key marking a cluster whose next snapshot
+// is saved as a new baseline.
+const metadataRebaseline = "rebaseline_requested"
+
+// RequestRebaseline makes the cluster's next snapshot a new baseline: it is saved
+// without recording changes against the previous snapshot. History is kept.
+func (s *Store) RequestRebaseline(ctx context.Context, clusterID string) error {
+	return s.SetMetadata(ctx, clusterID, metadataRebaseline, "true")
+}
+
+// RebaselineRequested reports whether the cluster's next snapshot will be saved
+// as a new baseline.
+func (s *Store) RebaselineRequested(ctx context.Context, clusterID string) (bool, error) {
+	value, err := s.GetMetadata(ctx, clusterID, metadataRebaseline)
+	return value != "", err
+}
+
 // GetSourceClusterID retrieves the source cluster's unique ID (from crdb_internal.cluster_id()).
 func (s *Store) GetSourceClusterID(ctx context.Context, clusterID string) (string, error) {
 	return s.GetMetadata(ctx, clusterID, "source_cluster_id")
@@ -443,6 +926,25 @@ func (s *Store) SetSourceClusterID(ctx context.Context, clusterID, sourceCluster
 	return s.SetMetadata(ctx, clusterID, "source_cluster_id", sourceClusterID)
 }
 
+// HistoryClusterID returns the unique ID of the cluster holding the history database,
+// so a source cluster that is the history cluster itself can be detected.
+func (s *Store) HistoryClusterID(ctx context.Context) (string, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	// crdb_internal requires allow_unsafe_internals in newer CockroachDB versions
+	if _, err := conn.Exec(ctx, "SET allow_unsafe_internals = true"); err != nil {
+		return "", err
+	}
+
+	var id string
+	err = conn.QueryRow(ctx, "SELECT crdb_internal.cluster_id()::TEXT").Scan(&id)
+	return id, err
+}
+
 // GetDatabaseVersion retrieves the stored database version for a specific cluster.
 func (s *Store) GetDatabaseVersion(ctx context.Context, clusterID string) (string, error) {
 	return s.GetMetadata(ctx, clusterID, "database_version")
@@ -455,15 +957,29 @@ func (s *Store) SetDatabaseVersion(ctx context.Context, clusterID, version strin
 
 // ListClusters returns all distinct cluster IDs that have data.
 func (s *Store) ListClusters(ctx context.Context) ([]string, error) {
-	rows, err := s.pool.Query(ctx,
-		`SELECT cluster_id FROM (
+	return s.ListClustersWithPrefix(ctx, "", 0)
+}
+
+// likeEscaper escapes the LIKE wildcards in a literal prefix.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListClustersWithPrefix returns the distinct cluster IDs that have data and start
+// with prefix, in order, at most limit of them. A limit of 0 or less returns all.
+func (s *Store) ListClustersWithPrefix(ctx context.Context, prefix string, limit int) ([]string, error) {
+	query := `SELECT cluster_id FROM (
 			SELECT cluster_id FROM snapshots
 			UNION
 			SELECT cluster_id FROM changes
 			UNION
 			SELECT cluster_id FROM metadata
-		) ORDER BY cluster_id`,
-	)
+		) WHERE cluster_id LIKE $1 ORDER BY cluster_id`
+	args := []any{likeEscaper.Replace(prefix) + "%"}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+
+	rows, err := s.pool.Query(ctx, s.sql(query), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -481,10 +997,18 @@ func (s *Store) ListClusters(ctx context.Context) ([]string, error) {
 	return clusters, rows.Err()
 }
 
+// csvFlushRows is how many rows CSVChangeWriter buffers before flushing to the
+// underlying writer and checking for write errors.
+const csvFlushRows = 100
+
 // NewCSVChangeWriter creates a writer that streams Change records as CSV rows.
 // Call WriteHeader first, then WriteChange for each row, then Flush.
+// Rows are flushed periodically so that errors from the underlying writer
+// (e.g. a disconnected HTTP client) are returned from WriteChange promptly.
 type CSVChangeWriter struct {
-	w *csv.Writer
+	w          *csv.Writer
+	rows       int
+	timeFormat TimestampFormat
 }
 
 // NewCSVChangeWriter creates a new streaming CSV change writer.
@@ -492,22 +1016,43 @@ func NewCSVChangeWriter(w io.Writer) *CSVChangeWriter {
 	return &CSVChangeWriter{w: csv.NewWriter(w)}
 }
 
-// WriteHeader writes the CSV header row.
+// WithTimestampFormat sets how detected_at is rendered. The default is RFC3339.
+func (cw *CSVChangeWriter) WithTimestampFormat(f TimestampFormat) *CSVChangeWriter {
+	cw.timeFormat = f
+	return cw
+}
+
+// WriteHeader writes the CSV header row and flushes it.
 func (cw *CSVChangeWriter) WriteHeader() error {
-	return cw.w.Write([]string{"cluster_id", "detected_at", "variable", "version", "old_value", "new_value", "description"})
+	if err := cw.w.Write([]string{"cluster_id", "detected_at", "variable", "version", "old_value", "new_value", "description"}); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
 }
 
 // WriteChange writes a single change as a CSV row.
+// Every csvFlushRows rows the buffer is flushed and any write error is returned.
 func (cw *CSVChangeWriter) WriteChange(c Change) error {
-	return cw.w.Write([]string{
+	err := cw.w.Write([]string{
 		c.ClusterID,
-		c.DetectedAt.Format(time.RFC3339),
+		cw.timeFormat.Format(c.DetectedAt),
 		c.Variable,
 		c.Version,
 		c.OldValue,
 		c.NewValue,
 		c.Description,
 	})
+	if err != nil {
+		return err
+	}
+
+	cw.rows++
+	if cw.rows%csvFlushRows == 0 {
+		cw.w.Flush()
+		return cw.w.Error()
+	}
+	return nil
 }
 
 // Flush flushes any buffered CSV data.
@@ -520,16 +1065,54 @@ func (cw *CSVChangeWriter) Error() error {
 	return cw.w.Error()
 }
 
+// MetadataExport is the per-cluster metadata document written alongside the
+// changes CSV in export archives.
+type MetadataExport struct {
+	ClusterID string            `json:"cluster_id"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// MetadataExportMarker is the metadata key holding the highest change ID written
+// by the last successful incremental export of a cluster.
+const MetadataExportMarker = "last_export_change_id"
+
+// ExportedMetadata returns the metadata to write into an export: md without the
+// keys holding this tool's own state, the export marker and a pending
+// rebaseline, which describe the history database rather than the cluster. Values
+// of sensitive keys are redacted when redactor is set.
+func ExportedMetadata(md map[string]string, redactor *Redactor) map[string]string {
+	result := make(map[string]string, len(md))
+	for k, v := range md {
+		if k != MetadataExportMarker && k != metadataRebaseline {
+			result[k] = v
+		}
+	}
+	if redactor != nil {
+		result = redactor.RedactMetadata(result)
+	}
+	return result
+}
+
+// WriteMetadataJSON writes the cluster's metadata as an indented JSON document.
+func WriteMetadataJSON(w io.Writer, clusterID string, md map[string]string) error {
+	if md == nil {
+		md = map[string]string{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(MetadataExport{ClusterID: clusterID, Metadata: md})
+}
+
 // CreateAnnotation creates a new annotation for a change.
 // Returns the created annotation with its ID populated.
-func (s *Store) CreateAnnotation(ctx context.Context, changeID int64, content, createdBy string) (*Annotation, error) {
+func (s *Store) CreateAnnotation(ctx context.Context, changeID int64, content, severity, createdBy string) (*Annotation, error) {
 	var a Annotation
 	err := s.pool.QueryRow(ctx,
-		`INSERT INTO annotations (change_id, content, created_by, created_at)
-		 VALUES ($1, $2, $3, NOW())
-		 RETURNING id, change_id, content, created_by, created_at`,
-		changeID, content, createdBy,
-	).Scan(&a.ID, &a.ChangeID, &a.Content, &a.CreatedBy, &a.CreatedAt)
+		s.sql(`INSERT INTO annotations (change_id, content, severity, created_by, created_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 RETURNING id, change_id, content, severity, created_by, created_at`),
+		changeID, content, severity, createdBy,
+	).Scan(&a.ID, &a.ChangeID, &a.Content, &a.Severity, &a.CreatedBy, &a.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -541,10 +1124,30 @@ func (s *Store) GetAnnotation(ctx context.Context, id int64) (*Annotation, error
 	var a Annotation
 	var nf annotationNullableFields
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, change_id, content, created_by, created_at, updated_by, updated_at
-		 FROM annotations WHERE id = $1`,
+		s.sql(`SELECT id, change_id, content, severity, created_by, created_at, updated_by, updated_at
+		 FROM annotations WHERE id = $1`),
 		id,
-	).Scan(&a.ID, &a.ChangeID, &a.Content, &a.CreatedBy, &a.CreatedAt, &nf.UpdatedBy, &nf.UpdatedAt)
+	).Scan(&a.ID, &a.ChangeID, &a.Content, &a.Severity, &a.CreatedBy, &a.CreatedAt, &nf.UpdatedBy, &nf.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	nf.applyTo(&a)
+	return &a, nil
+}
+
+// GetAnnotationByChangeID retrieves the annotation of a change. Returns nil, nil
+// if the change has none.
+func (s *Store) GetAnnotationByChangeID(ctx context.Context, changeID int64) (*Annotation, error) {
+	var a Annotation
+	var nf annotationNullableFields
+	err := s.pool.QueryRow(ctx,
+		s.sql(`SELECT id, change_id, content, severity, created_by, created_at, updated_by, updated_at
+		 FROM annotations WHERE change_id = $1`),
+		changeID,
+	).Scan(&a.ID, &a.ChangeID, &a.Content, &a.Severity, &a.CreatedBy, &a.CreatedAt, &nf.UpdatedBy, &nf.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -555,12 +1158,41 @@ func (s *Store) GetAnnotation(ctx context.Context, id int64) (*Annotation, error
 	return &a, nil
 }
 
-// UpdateAnnotation updates an existing annotation.
-func (s *Store) UpdateAnnotation(ctx context.Context, id int64, content, updatedBy string) error {
+// ListAnnotations returns the most recently created annotations, newest first.
+// If severity is non-empty, only annotations with that severity are returned.
+func (s *Store) ListAnnotations(ctx context.Context, severity string, limit int) ([]Annotation, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT id, change_id, content, severity, created_by, created_at, updated_by, updated_at
+		 FROM annotations
+		 WHERE $1 = '' OR severity = $1
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $2`),
+		severity, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := []Annotation{}
+	for rows.Next() {
+		var a Annotation
+		var nf annotationNullableFields
+		if err := rows.Scan(&a.ID, &a.ChangeID, &a.Content, &a.Severity, &a.CreatedBy, &a.CreatedAt, &nf.UpdatedBy, &nf.UpdatedAt); err != nil {
+			return nil, err
+		}
+		nf.applyTo(&a)
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+// UpdateAnnotation updates an existing annotation. An empty severity keeps the current one.
+func (s *Store) UpdateAnnotation(ctx context.Context, id int64, content, severity, updatedBy string) error {
 	result, err := s.pool.Exec(ctx,
-		`UPDATE annotations SET content = $1, updated_by = $2, updated_at = NOW()
-		 WHERE id = $3`,
-		content, updatedBy, id,
+		s.sql(`UPDATE annotations SET content = $1, severity = COALESCE(NULLIF($2, ''), severity), updated_by = $3, updated_at = NOW()
+		 WHERE id = $4`),
+		content, severity, updatedBy, id,
 	)
 	if err != nil {
 		return err
@@ -574,7 +1206,7 @@ func (s *Store) UpdateAnnotation(ctx context.Context, id int64, content, updated
 // DeleteAnnotation removes an annotation.
 func (s *Store) DeleteAnnotation(ctx context.Context, id int64) error {
 	result, err := s.pool.Exec(ctx,
-		`DELETE FROM annotations WHERE id = $1`,
+		s.sql(`DELETE FROM annotations WHERE id = $1`),
 		id,
 	)
 	if err != nil {
@@ -588,15 +1220,22 @@ func (s *Store) DeleteAnnotation(ctx context.Context, id int64) error {
 
 // GetChangesWithAnnotations retrieves changes with their annotations using a LEFT JOIN.
 func (s *Store) GetChangesWithAnnotations(ctx context.Context, clusterID string, limit int) ([]ChangeWithAnnotation, error) {
+	return s.GetChangesWithAnnotationsPaged(ctx, clusterID, limit, 0)
+}
+
+// GetChangesWithAnnotationsPaged is GetChangesWithAnnotations skipping the
+// offset newest changes, for paging back through history. A negative offset
+// is treated as 0.
+func (s *Store) GetChangesWithAnnotationsPaged(ctx context.Context, clusterID string, limit, offset int) ([]ChangeWithAnnotation, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT c.id, c.cluster_id, c.detected_at, c.variable, c.old_value, c.new_value, c.description, c.version,
-		        a.id, a.content, a.created_by, a.created_at, a.updated_by, a.updated_at
+		s.sql(`SELECT c.id, c.cluster_id, c.detected_at, c.variable, c.old_value, c.new_value, c.description, c.version,
+		        a.id, a.content, a.severity, a.created_by, a.created_at, a.updated_by, a.updated_at
 		 FROM changes c
 		 LEFT JOIN annotations a ON a.change_id = c.id
 		 WHERE c.cluster_id = $1
-		 ORDER BY c.detected_at DESC
-		 LIMIT $2`,
-		clusterID, limit,
+		 ORDER BY c.detected_at DESC, c.id DESC
+		 LIMIT $2 OFFSET $3`),
+		clusterID, limit, max(offset, 0),
 	)
 	if err != nil {
 		return nil, err
@@ -608,13 +1247,13 @@ func (s *Store) GetChangesWithAnnotations(ctx context.Context, clusterID string,
 		var cwa ChangeWithAnnotation
 		var cnf changeNullableFields
 		var annID *int64
-		var annContent, annCreatedBy *string
+		var annContent, annSeverity, annCreatedBy *string
 		var annCreatedAt *time.Time
 		var anf annotationNullableFields
 
 		err := rows.Scan(
 			&cwa.ID, &cwa.ClusterID, &cwa.DetectedAt, &cwa.Variable, &cnf.OldValue, &cnf.NewValue, &cnf.Description, &cnf.Version,
-			&annID, &annContent, &annCreatedBy, &annCreatedAt, &anf.UpdatedBy, &anf.UpdatedAt,
+			&annID, &annContent, &annSeverity, &annCreatedBy, &annCreatedAt, &anf.UpdatedBy, &anf.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -628,6 +1267,7 @@ func (s *Store) GetChangesWithAnnotations(ctx context.Context, clusterID string,
 				ID:        *annID,
 				ChangeID:  cwa.ID,
 				Content:   *annContent,
+				Severity:  *annSeverity,
 				CreatedBy: *annCreatedBy,
 				CreatedAt: *annCreatedAt,
 			}
@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -109,7 +113,7 @@ func cleanupTestData(t *testing.T, store *Store) {
 	t.Helper()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	store.pool.Exec(ctx, "TRUNCATE TABLE annotations, changes, settings, snapshots, metadata CASCADE")
+	store.pool.Exec(ctx, "TRUNCATE TABLE annotations, acknowledgements, changes, settings, snapshots, metadata, subscriptions CASCADE")
 }
 
 // findChange returns the first change matching the given variable name, or nil.
@@ -568,7 +572,7 @@ func TestAnnotationCRUD(t *testing.T) {
 	store, ctx := setupStoreTest(t, 10*time.Second)
 	changeID := saveTestChange(t, ctx, store, "annotation.test")
 
-	ann, err := store.CreateAnnotation(ctx, changeID, "Test note", "testuser")
+	ann, err := store.CreateAnnotation(ctx, changeID, "Test note", SeverityInfo, "testuser")
 	if err != nil {
 		t.Fatalf("CreateAnnotation failed: %v", err)
 	}
@@ -596,7 +600,15 @@ func TestAnnotationCRUD(t *testing.T) {
 		t.Errorf("Expected content 'Test note', got '%s'", retrieved.Content)
 	}
 
-	err = store.UpdateAnnotation(ctx, ann.ID, "Updated note", "otheruser")
+	byChange, err := store.GetAnnotationByChangeID(ctx, changeID)
+	if err != nil {
+		t.Fatalf("GetAnnotationByChangeID failed: %v", err)
+	}
+	if byChange == nil || byChange.ID != ann.ID {
+		t.Errorf("Expected annotation %d for change %d, got %+v", ann.ID, changeID, byChange)
+	}
+
+	err = store.UpdateAnnotation(ctx, ann.ID, "Updated note", "", "otheruser")
 	if err != nil {
 		t.Fatalf("UpdateAnnotation failed: %v", err)
 	}
@@ -610,6 +622,9 @@ func TestAnnotationCRUD(t *testing.T) {
 	if updated.UpdatedAt.IsZero() {
 		t.Error("Expected non-zero updated_at after update")
 	}
+	if updated.Severity != SeverityInfo {
+		t.Errorf("Expected severity to be kept when not given, got '%s'", updated.Severity)
+	}
 
 	err = store.DeleteAnnotation(ctx, ann.ID)
 	if err != nil {
@@ -632,7 +647,13 @@ func TestAnnotationNotFound(t *testing.T) {
 		t.Error("Expected nil for non-existent annotation")
 	}
 
-	err = store.UpdateAnnotation(ctx, 999999, "content", "user")
+	changeID := saveTestChange(t, ctx, store, "annotation.none")
+	ann, err = store.GetAnnotationByChangeID(ctx, changeID)
+	if err != nil || ann != nil {
+		t.Errorf("Expected nil for a change without an annotation, got %+v, %v", ann, err)
+	}
+
+	err = store.UpdateAnnotation(ctx, 999999, "content", "", "user")
 	if err == nil {
 		t.Error("Expected error for updating non-existent annotation")
 	}
@@ -643,11 +664,59 @@ func TestAnnotationNotFound(t *testing.T) {
 	}
 }
 
+func TestIsValidSeverity(t *testing.T) {
+	for _, sev := range []string{SeverityInfo, SeverityWarning, SeverityCritical} {
+		if !IsValidSeverity(sev) {
+			t.Errorf("Expected %q to be valid", sev)
+		}
+	}
+	for _, sev := range []string{"", "Critical", "error"} {
+		if IsValidSeverity(sev) {
+			t.Errorf("Expected %q to be invalid", sev)
+		}
+	}
+}
+
+func TestListAnnotationsBySeverity(t *testing.T) {
+	store, ctx := setupStoreTest(t, 10*time.Second)
+	changeID := saveTestChange(t, ctx, store, "severity.test")
+
+	ann, err := store.CreateAnnotation(ctx, changeID, "Breaks replication", SeverityCritical, "user")
+	if err != nil {
+		t.Fatalf("CreateAnnotation failed: %v", err)
+	}
+	if ann.Severity != SeverityCritical {
+		t.Errorf("Expected severity critical, got '%s'", ann.Severity)
+	}
+
+	critical, err := store.ListAnnotations(ctx, SeverityCritical, 100)
+	if err != nil {
+		t.Fatalf("ListAnnotations failed: %v", err)
+	}
+	if len(critical) == 0 || critical[0].ID != ann.ID {
+		t.Errorf("Expected the critical annotation first, got %+v", critical)
+	}
+
+	warnings, _ := store.ListAnnotations(ctx, SeverityWarning, 100)
+	for _, a := range warnings {
+		if a.ID == ann.ID {
+			t.Error("Expected critical annotation to be excluded from warnings")
+		}
+	}
+
+	if err := store.UpdateAnnotation(ctx, ann.ID, "Only a warning", SeverityWarning, "user"); err != nil {
+		t.Fatalf("UpdateAnnotation failed: %v", err)
+	}
+	if updated, _ := store.GetAnnotation(ctx, ann.ID); updated.Severity != SeverityWarning {
+		t.Errorf("Expected severity warning after update, got '%s'", updated.Severity)
+	}
+}
+
 func TestAnnotationCascadeDelete(t *testing.T) {
 	store, ctx := setupStoreTest(t, 10*time.Second)
 	changeID := saveTestChange(t, ctx, store, "cascade.test")
 
-	ann, err := store.CreateAnnotation(ctx, changeID, "Will be deleted", "user")
+	ann, err := store.CreateAnnotation(ctx, changeID, "Will be deleted", SeverityInfo, "user")
 	if err != nil {
 		t.Fatalf("Failed to create annotation: %v", err)
 	}
@@ -697,7 +766,7 @@ func TestGetChangesWithAnnotations(t *testing.T) {
 		}
 	}
 
-	_, err = store.CreateAnnotation(ctx, changes[0].ID, "First change note", "user")
+	_, err = store.CreateAnnotation(ctx, changes[0].ID, "First change note", SeverityInfo, "user")
 	if err != nil {
 		t.Fatalf("Failed to create annotation: %v", err)
 	}
@@ -731,13 +800,13 @@ func TestAnnotationDuplicateFails(t *testing.T) {
 	store, ctx := setupStoreTest(t, 10*time.Second)
 	changeID := saveTestChange(t, ctx, store, "dup.test")
 
-	_, err := store.CreateAnnotation(ctx, changeID, "First", "user")
+	_, err := store.CreateAnnotation(ctx, changeID, "First", SeverityInfo, "user")
 	if err != nil {
 		t.Fatalf("First CreateAnnotation failed: %v", err)
 	}
 
 	// UNIQUE constraint should reject a second annotation on the same change
-	_, err = store.CreateAnnotation(ctx, changeID, "Second", "user")
+	_, err = store.CreateAnnotation(ctx, changeID, "Second", SeverityInfo, "user")
 	if err == nil {
 		t.Error("Expected error for duplicate annotation on same change")
 	}
@@ -943,3 +1012,253 @@ func TestGetAllChanges(t *testing.T) {
 	}
 }
 
+func TestGetTopChangedSettings(t *testing.T) {
+	store, ctx := setupStoreTest(t, 15*time.Second)
+
+	clusterID := "top-changes-" + time.Now().Format("20060102150405.000")
+	from := time.Now().Add(-time.Minute)
+
+	// churny changes 3 times, stable once, steady never
+	for _, v := range []string{"1", "2", "3", "4"} {
+		stable := "a"
+		if v == "4" {
+			stable = "b"
+		}
+		settings := []Setting{
+			{Variable: "top.churny", Value: v, SettingType: "s"},
+			{Variable: "top.stable", Value: stable, SettingType: "s"},
+			{Variable: "top.steady", Value: "x", SettingType: "s"},
+		}
+		if err := store.SaveSnapshot(ctx, clusterID, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshot failed: %v", err)
+		}
+	}
+	to := time.Now().Add(time.Minute)
+
+	counts, err := store.GetTopChangedSettings(ctx, clusterID, from, to, 10)
+	if err != nil {
+		t.Fatalf("GetTopChangedSettings failed: %v", err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 changed settings, got %+v", counts)
+	}
+	if counts[0].Variable != "top.churny" || counts[0].Count != 3 {
+		t.Errorf("Expected top.churny with 3 changes first, got %+v", counts[0])
+	}
+	if counts[1].Variable != "top.stable" || counts[1].Count != 1 {
+		t.Errorf("Expected top.stable with 1 change second, got %+v", counts[1])
+	}
+	if counts[0].LastChanged.IsZero() {
+		t.Error("Expected LastChanged to be set")
+	}
+
+	limited, err := store.GetTopChangedSettings(ctx, clusterID, from, to, 1)
+	if err != nil {
+		t.Fatalf("GetTopChangedSettings with limit failed: %v", err)
+	}
+	if len(limited) != 1 {
+		t.Errorf("Expected 1 result with limit=1, got %d", len(limited))
+	}
+
+	outside, err := store.GetTopChangedSettings(ctx, clusterID, to, to.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("GetTopChangedSettings outside range failed: %v", err)
+	}
+	if len(outside) != 0 {
+		t.Errorf("Expected no results outside the time range, got %+v", outside)
+	}
+}
+
+// failingWriter accepts limit bytes and then returns err for every write.
+type failingWriter struct {
+	limit int
+	err   error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, w.err
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestCSVChangeWriterReturnsWriteErrorPromptly(t *testing.T) {
+	writeErr := errors.New("connection reset by peer")
+	fw := &failingWriter{limit: 200, err: writeErr}
+
+	cw := NewCSVChangeWriter(fw)
+	if err := cw.WriteHeader(); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	change := Change{ClusterID: "c", DetectedAt: time.Now(), Variable: "a.b", OldValue: "1", NewValue: "2"}
+	var err error
+	var written int
+	for written = 0; written < 10*csvFlushRows; written++ {
+		if err = cw.WriteChange(change); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		t.Fatal("Expected WriteChange to return the underlying write error")
+	}
+	if !errors.Is(err, writeErr) {
+		t.Errorf("Expected %q, got %v", writeErr, err)
+	}
+	if written >= csvFlushRows {
+		t.Errorf("Expected error within the first %d rows, got it after %d", csvFlushRows, written)
+	}
+}
+
+func TestCSVChangeWriterFlushesPeriodically(t *testing.T) {
+	var buf strings.Builder
+	cw := NewCSVChangeWriter(&buf)
+	if err := cw.WriteHeader(); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	headerLen := buf.Len()
+	if headerLen == 0 {
+		t.Fatal("Expected header to be flushed immediately")
+	}
+
+	change := Change{ClusterID: "c", DetectedAt: time.Now(), Variable: "a.b"}
+	for range csvFlushRows {
+		if err := cw.WriteChange(change); err != nil {
+			t.Fatalf("WriteChange failed: %v", err)
+		}
+	}
+
+	if got := strings.Count(buf.String(), "\n"); got != csvFlushRows+1 {
+		t.Errorf("Expected %d flushed lines without an explicit Flush, got %d", csvFlushRows+1, got)
+	}
+}
+
+func TestDedupeSettingsWarnsAndKeepsLast(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	settings := []Setting{
+		{Variable: "a", Value: "1"},
+		{Variable: "b", Value: "1"},
+		{Variable: "a", Value: "2"},
+		{Variable: "c", Value: "1"},
+		{Variable: "a", Value: "3"},
+	}
+	got := dedupeSettings("prod", settings)
+
+	want := []Setting{{Variable: "a", Value: "3"}, {Variable: "b", Value: "1"}, {Variable: "c", Value: "1"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("dedupeSettings() = %+v, want %+v", got, want)
+	}
+	if settings[0].Value != "1" || len(settings) != 5 {
+		t.Errorf("Expected the input slice to be left untouched, got %+v", settings)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "duplicate variables") || !strings.Contains(out, "variables=[a]") || !strings.Contains(out, "cluster=prod") {
+		t.Errorf("Expected a duplicate variable warning, got %q", out)
+	}
+
+	logs.Reset()
+	unique := []Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "1"}}
+	if got := dedupeSettings("prod", unique); !slices.Equal(got, unique) {
+		t.Errorf("dedupeSettings() = %+v, want %+v", got, unique)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected no warning without duplicates, got %q", logs.String())
+	}
+}
+
+func TestDiffSettingsCaseInsensitive(t *testing.T) {
+	prev := map[string]Setting{
+		"sql.defaults.vectorize": {Variable: "sql.defaults.vectorize", Value: "ON"},
+		"server.mode":            {Variable: "server.mode", Value: "Auto"},
+	}
+	settings := []Setting{
+		{Variable: "sql.defaults.vectorize", Value: "on"},
+		{Variable: "server.mode", Value: "auto"},
+	}
+
+	tests := []struct {
+		name string
+		opts DiffOptions
+		want []string
+	}{
+		{"case sensitive", DiffOptions{}, []string{"server.mode", "sql.defaults.vectorize"}},
+		{"every setting", DiffOptions{CaseInsensitive: []string{"*"}}, nil},
+		{"matching settings only", DiffOptions{CaseInsensitive: []string{"sql.defaults.*"}}, []string{"server.mode"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range DiffSettings("prod", prev, settings, "v1.0", tt.opts) {
+				got = append(got, c.Variable)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("DiffSettings() changed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A real change is still detected
+	changed := []Setting{{Variable: "sql.defaults.vectorize", Value: "off"}, {Variable: "server.mode", Value: "auto"}}
+	if changes := DiffSettings("prod", prev, changed, "v1.0", DiffOptions{CaseInsensitive: []string{"*"}}); len(changes) != 1 || changes[0].NewValue != "off" {
+		t.Errorf("Expected ON -> off to be a change, got %+v", changes)
+	}
+}
+
+func TestFileStoreCaseInsensitiveKeepsRawValue(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.WithDiffOptions(DiffOptions{CaseInsensitive: []string{"*"}})
+	ctx := context.Background()
+
+	for _, v := range []string{"ON", "on"} {
+		changes, err := store.SaveSnapshotWithChanges(ctx, "prod", []Setting{{Variable: "a.b", Value: v}}, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("Expected no change for %q, got %+v", v, changes)
+		}
+	}
+	latest, err := store.GetLatestSnapshot(ctx, "prod")
+	if err != nil {
+		t.Fatalf("GetLatestSnapshot failed: %v", err)
+	}
+	if got := latest["a.b"].Value; got != "on" {
+		t.Errorf("Expected the raw collected value %q to be stored, got %q", "on", got)
+	}
+}
+
+func TestSaveSnapshotStoresOneRowPerDuplicateVariable(t *testing.T) {
+	store, ctx := setupStoreTest(t, 10*time.Second)
+	clusterID := "duplicate-variables"
+
+	err := store.SaveSnapshot(ctx, clusterID, []Setting{
+		{Variable: "dup.setting", Value: "1"},
+		{Variable: "dup.setting", Value: "2"},
+	}, "v1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+
+	var rows int
+	err = store.pool.QueryRow(ctx,
+		"SELECT count(*) FROM settings s JOIN snapshots sn ON sn.id = s.snapshot_id WHERE sn.cluster_id = $1",
+		clusterID,
+	).Scan(&rows)
+	if err != nil {
+		t.Fatalf("Failed to count settings: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("Expected 1 stored setting, got %d", rows)
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Subscription registers an external consumer's interest in changes to variables
+// matching a glob pattern on a cluster. Matching changes are POSTed to TargetURL.
+type Subscription struct {
+	ID              int64     `json:"id"`
+	ClusterID       string    `json:"cluster_id"`
+	VariablePattern string    `json:"variable_pattern"`
+	TargetURL       string    `json:"target_url"`
+	CreatedBy       string    `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Matches returns true if the subscription's variable pattern matches the given variable.
+func (sub Subscription) Matches(variable string) bool {
+	return MatchGlob(sub.VariablePattern, variable)
+}
+
+func scanSubscription(row pgx.Row) (*Subscription, error) {
+	var sub Subscription
+	err := row.Scan(&sub.ID, &sub.ClusterID, &sub.VariablePattern, &sub.TargetURL, &sub.CreatedBy, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// CreateSubscription registers a new subscription and returns it with its ID populated.
+func (s *Store) CreateSubscription(ctx context.Context, clusterID, variablePattern, targetURL, createdBy string) (*Subscription, error) {
+	return scanSubscription(s.pool.QueryRow(ctx,
+		s.sql(`INSERT INTO subscriptions (cluster_id, variable_pattern, target_url, created_by, created_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 RETURNING id, cluster_id, variable_pattern, target_url, created_by, created_at`),
+		clusterID, variablePattern, targetURL, createdBy,
+	))
+}
+
+// GetSubscription retrieves a subscription by its ID.
+// Returns nil, nil if the subscription does not exist.
+func (s *Store) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	sub, err := scanSubscription(s.pool.QueryRow(ctx,
+		s.sql(`SELECT id, cluster_id, variable_pattern, target_url, created_by, created_at
+		 FROM subscriptions WHERE id = $1`),
+		id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// ListSubscriptions returns subscriptions for a cluster, or for all clusters when clusterID is empty.
+func (s *Store) ListSubscriptions(ctx context.Context, clusterID string) ([]Subscription, error) {
+	rows, err := s.pool.Query(ctx,
+		s.sql(`SELECT id, cluster_id, variable_pattern, target_url, created_by, created_at
+		 FROM subscriptions
+		 WHERE $1 = '' OR cluster_id = $1
+		 ORDER BY id`),
+		clusterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscription changes the variable pattern and target URL of an existing subscription.
+func (s *Store) UpdateSubscription(ctx context.Context, id int64, variablePattern, targetURL string) error {
+	result, err := s.pool.Exec(ctx,
+		s.sql(`UPDATE subscriptions SET variable_pattern = $1, target_url = $2 WHERE id = $3`),
+		variablePattern, targetURL, id,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSubscription removes a subscription.
+func (s *Store) DeleteSubscription(ctx context.Context, id int64) error {
+	result, err := s.pool.Exec(ctx, s.sql(`DELETE FROM subscriptions WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
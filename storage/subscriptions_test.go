@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionCRUD(t *testing.T) {
+	store, ctx := setupStoreTest(t, 10*time.Second)
+	cleanupTestData(t, store)
+
+	sub, err := store.CreateSubscription(ctx, testClusterID, "kv.rangefeed.*", "http://example.com/hook", "testuser")
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if sub.ID == 0 {
+		t.Error("Expected non-zero subscription ID")
+	}
+	if sub.CreatedBy != "testuser" {
+		t.Errorf("Expected createdBy 'testuser', got '%s'", sub.CreatedBy)
+	}
+
+	if _, err := store.CreateSubscription(ctx, "other-cluster", "*", "http://example.com/other", ""); err != nil {
+		t.Fatalf("CreateSubscription for other cluster failed: %v", err)
+	}
+
+	subs, err := store.ListSubscriptions(ctx, testClusterID)
+	if err != nil {
+		t.Fatalf("ListSubscriptions failed: %v", err)
+	}
+	if len(subs) != 1 || subs[0].ID != sub.ID {
+		t.Errorf("Expected only the test cluster subscription, got %+v", subs)
+	}
+
+	all, err := store.ListSubscriptions(ctx, "")
+	if err != nil {
+		t.Fatalf("ListSubscriptions (all) failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Expected 2 subscriptions across clusters, got %d", len(all))
+	}
+
+	if err := store.UpdateSubscription(ctx, sub.ID, "sql.*", "http://example.com/new"); err != nil {
+		t.Fatalf("UpdateSubscription failed: %v", err)
+	}
+	updated, err := store.GetSubscription(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetSubscription failed: %v", err)
+	}
+	if updated.VariablePattern != "sql.*" || updated.TargetURL != "http://example.com/new" {
+		t.Errorf("Expected updated subscription, got %+v", updated)
+	}
+
+	if err := store.DeleteSubscription(ctx, sub.ID); err != nil {
+		t.Fatalf("DeleteSubscription failed: %v", err)
+	}
+	deleted, err := store.GetSubscription(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetSubscription after delete failed: %v", err)
+	}
+	if deleted != nil {
+		t.Error("Expected nil after delete")
+	}
+	if err := store.DeleteSubscription(ctx, sub.ID); err == nil {
+		t.Error("Expected error deleting non-existent subscription")
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	t.Parallel()
+	sub := Subscription{VariablePattern: "kv.rangefeed.*"}
+	if !sub.Matches("kv.rangefeed.enabled") {
+		t.Error("Expected kv.rangefeed.enabled to match")
+	}
+	if sub.Matches("sql.defaults.distsql") {
+		t.Error("Expected sql.defaults.distsql not to match")
+	}
+}
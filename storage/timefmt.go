@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimestampFormat controls the timezone and precision used when rendering
+// timestamps in exports, API responses, and the UI.
+// The zero value keeps each timestamp's own location at one-second precision (RFC3339).
+type TimestampFormat struct {
+	// Location converts timestamps to a fixed timezone; nil keeps the stored location.
+	Location *time.Location
+	// Precision is the smallest unit rendered: time.Second, time.Millisecond,
+	// time.Microsecond, or time.Nanosecond. Zero means time.Second.
+	Precision time.Duration
+}
+
+// ParseTimestampFormat builds a TimestampFormat from a timezone name ("" to keep
+// stored timezones, "UTC", "Local", or an IANA name like "America/New_York") and a
+// precision ("", "s", "ms", "us", or "ns").
+func ParseTimestampFormat(timezone, precision string) (TimestampFormat, error) {
+	var f TimestampFormat
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return f, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		f.Location = loc
+	}
+
+	switch strings.ToLower(precision) {
+	case "", "s":
+		f.Precision = time.Second
+	case "ms":
+		f.Precision = time.Millisecond
+	case "us":
+		f.Precision = time.Microsecond
+	case "ns":
+		f.Precision = time.Nanosecond
+	default:
+		return f, fmt.Errorf("invalid timestamp precision %q (use s, ms, us, or ns)", precision)
+	}
+
+	return f, nil
+}
+
+// Apply converts t to the configured location and truncates it to the configured precision.
+func (f TimestampFormat) Apply(t time.Time) time.Time {
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	return t.Truncate(f.precision())
+}
+
+// Format renders t as RFC3339 with fixed-width fractional seconds for the
+// configured precision, so rendered values sort in time order.
+func (f TimestampFormat) Format(t time.Time) string {
+	return f.Apply(t).Format("2006-01-02T15:04:05" + f.fraction() + "Z07:00")
+}
+
+// FormatDisplay renders t for human display ("2006-01-02 15:04:05"), adding
+// fractional seconds for sub-second precision and the zone abbreviation when
+// a timezone is configured.
+func (f TimestampFormat) FormatDisplay(t time.Time) string {
+	layout := "2006-01-02 15:04:05" + f.fraction()
+	if f.Location != nil {
+		layout += " MST"
+	}
+	return f.Apply(t).Format(layout)
+}
+
+// ApplyToChanges returns a copy of changes with DetectedAt converted by Apply.
+func (f TimestampFormat) ApplyToChanges(changes []Change) []Change {
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		c.DetectedAt = f.Apply(c.DetectedAt)
+		result[i] = c
+	}
+	return result
+}
+
+func (f TimestampFormat) precision() time.Duration {
+	if f.Precision <= 0 {
+		return time.Second
+	}
+	return f.Precision
+}
+
+// fraction returns the fractional-seconds layout for the configured precision.
+func (f TimestampFormat) fraction() string {
+	switch p := f.precision(); {
+	case p >= time.Second:
+		return ""
+	case p >= time.Millisecond:
+		return ".000"
+	case p >= time.Microsecond:
+		return ".000000"
+	default:
+		return ".000000000"
+	}
+}
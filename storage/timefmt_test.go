@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		timezone  string
+		precision string
+		wantPrec  time.Duration
+		wantErr   bool
+	}{
+		{"defaults", "", "", time.Second, false},
+		{"utc millis", "UTC", "ms", time.Millisecond, false},
+		{"named location micros", "America/New_York", "us", time.Microsecond, false},
+		{"nanos uppercase", "", "NS", time.Nanosecond, false},
+		{"invalid timezone", "Mars/Olympus_Mons", "", 0, true},
+		{"invalid precision", "", "minutes", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseTimestampFormat(tt.timezone, tt.precision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimestampFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if f.Precision != tt.wantPrec {
+				t.Errorf("Precision = %v, want %v", f.Precision, tt.wantPrec)
+			}
+			if (tt.timezone == "") != (f.Location == nil) {
+				t.Errorf("Location = %v for timezone %q", f.Location, tt.timezone)
+			}
+		})
+	}
+}
+
+func TestTimestampFormatConvertsTimezone(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	ts := time.Date(2025, 1, 15, 19, 30, 0, 123456789, tokyo) // 10:30:00.123456789 UTC
+
+	utc, err := ParseTimestampFormat("UTC", "")
+	if err != nil {
+		t.Fatalf("ParseTimestampFormat failed: %v", err)
+	}
+	if got := utc.Format(ts); got != "2025-01-15T10:30:00Z" {
+		t.Errorf("UTC Format = %q, want 2025-01-15T10:30:00Z", got)
+	}
+
+	ny, err := ParseTimestampFormat("America/New_York", "ms")
+	if err != nil {
+		t.Fatalf("ParseTimestampFormat failed: %v", err)
+	}
+	if got := ny.Format(ts); got != "2025-01-15T05:30:00.123-05:00" {
+		t.Errorf("New York Format = %q, want 2025-01-15T05:30:00.123-05:00", got)
+	}
+	if got := ny.FormatDisplay(ts); got != "2025-01-15 05:30:00.123 EST" {
+		t.Errorf("New York FormatDisplay = %q, want 2025-01-15 05:30:00.123 EST", got)
+	}
+	if got := ny.Apply(ts); !got.Equal(ts.Truncate(time.Millisecond)) || got.Location() != ny.Location {
+		t.Errorf("Apply = %v, want same instant in %v truncated to ms", got, ny.Location)
+	}
+}
+
+func TestTimestampFormatDefaultKeepsRFC3339(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	ts := time.Date(2025, 1, 15, 19, 30, 0, 999, tokyo)
+
+	var f TimestampFormat
+	if got, want := f.Format(ts), ts.Format(time.RFC3339); got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	if got, want := f.FormatDisplay(ts), ts.Format("2006-01-02 15:04:05"); got != want {
+		t.Errorf("FormatDisplay = %q, want %q", got, want)
+	}
+}
+
+func TestTimestampFormatFixedWidthFraction(t *testing.T) {
+	f := TimestampFormat{Location: time.UTC, Precision: time.Microsecond}
+	ts := time.Date(2025, 1, 15, 10, 30, 0, 100_000_000, time.UTC)
+
+	if got := f.Format(ts); got != "2025-01-15T10:30:00.100000Z" {
+		t.Errorf("Format = %q, want trailing zeros kept for ordering", got)
+	}
+}
+
+func TestCSVChangeWriterTimestampFormat(t *testing.T) {
+	f, err := ParseTimestampFormat("UTC", "ms")
+	if err != nil {
+		t.Fatalf("ParseTimestampFormat failed: %v", err)
+	}
+
+	var buf strings.Builder
+	cw := NewCSVChangeWriter(&buf).WithTimestampFormat(f)
+	ts := time.Date(2025, 1, 15, 11, 30, 0, 250_000_000, time.FixedZone("CET", 60*60))
+	if err := cw.WriteChange(Change{ClusterID: "c", DetectedAt: ts, Variable: "a.b"}); err != nil {
+		t.Fatalf("WriteChange failed: %v", err)
+	}
+	cw.Flush()
+
+	if !strings.HasPrefix(buf.String(), "c,2025-01-15T10:30:00.250Z,a.b,") {
+		t.Errorf("Unexpected CSV row: %q", buf.String())
+	}
+}
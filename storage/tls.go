@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// WithTLSMinVersion requires at least version (e.g. tls.VersionTLS13) on TLS
+// connections to the history database. Zero keeps Go's default minimum.
+func WithTLSMinVersion(version uint16) Option {
+	return func(s *Store) {
+		s.tlsMinVersion = version
+	}
+}
+
+// SetTLSMinVersion raises the minimum TLS version of every TLS configuration pgx
+// may try for cfg, including its fallbacks. Zero leaves cfg unchanged.
+func SetTLSMinVersion(cfg *pgconn.Config, version uint16) {
+	if version == 0 {
+		return
+	}
+	if cfg.TLSConfig != nil {
+		cfg.TLSConfig.MinVersion = version
+	}
+	for _, fb := range cfg.Fallbacks {
+		if fb.TLSConfig != nil {
+			fb.TLSConfig.MinVersion = version
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSetTLSMinVersion(t *testing.T) {
+	t.Setenv("PGSSLMODE", "")
+	// prefer tries TLS first and falls back to plaintext
+	cfg, err := pgconn.ParseConfig("postgresql://history@localhost:26257/history?sslmode=prefer")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	SetTLSMinVersion(cfg, tls.VersionTLS13)
+
+	if cfg.TLSConfig == nil || cfg.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected the TLS config to require TLS 1.3, got %+v", cfg.TLSConfig)
+	}
+	for _, fb := range cfg.Fallbacks {
+		if fb.TLSConfig != nil && fb.TLSConfig.MinVersion != tls.VersionTLS13 {
+			t.Errorf("Expected every TLS fallback to require TLS 1.3, got %x", fb.TLSConfig.MinVersion)
+		}
+	}
+
+	disabled, err := pgconn.ParseConfig("postgresql://history@localhost:26257/history?sslmode=disable")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	SetTLSMinVersion(disabled, tls.VersionTLS13)
+	if disabled.TLSConfig != nil {
+		t.Error("Expected a plaintext config to stay plaintext")
+	}
+}
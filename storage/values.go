@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// truncatedDigestLength is how many hex characters of the SHA-256 digest are kept
+// in the truncation marker. 16 characters (64 bits) is plenty to tell values apart.
+const truncatedDigestLength = 16
+
+// TruncateValue shortens a value longer than maxLen bytes to its first maxLen bytes
+// followed by a marker with the full length and a digest of the full value, e.g.
+// `{"constraints": …[truncated 48213 bytes sha256:1f2e3d4c5b6a7988]`.
+// Because the digest covers the whole value, two long values that share a prefix
+// still compare unequal, so change detection keeps working on truncated values.
+// A maxLen of 0 or less returns the value unchanged.
+func TruncateValue(value string, maxLen int) string {
+	if maxLen <= 0 || len(value) <= maxLen {
+		return value
+	}
+
+	// Cut on a rune boundary so the stored prefix stays valid UTF-8
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	digest := hex.EncodeToString(sum[:])[:truncatedDigestLength]
+	return fmt.Sprintf("%s…[truncated %d bytes sha256:%s]", value[:cut], len(value), digest)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateValue(t *testing.T) {
+	long := strings.Repeat("x", 100)
+
+	tests := []struct {
+		name   string
+		value  string
+		maxLen int
+		want   string
+	}{
+		{"disabled", long, 0, long},
+		{"negative disables", long, -1, long},
+		{"under limit", "short", 10, "short"},
+		{"at limit", "exactly10!", 10, "exactly10!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateValue(tt.value, tt.maxLen); got != tt.want {
+				t.Errorf("TruncateValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got := TruncateValue(long, 10)
+	if !strings.HasPrefix(got, strings.Repeat("x", 10)+"…[truncated 100 bytes sha256:") {
+		t.Errorf("Expected prefix and marker, got %q", got)
+	}
+	if got != TruncateValue(long, 10) {
+		t.Error("Expected truncation to be deterministic")
+	}
+}
+
+func TestTruncateValueDistinguishesSharedPrefix(t *testing.T) {
+	a := strings.Repeat("x", 100) + "a"
+	b := strings.Repeat("x", 100) + "b"
+
+	if TruncateValue(a, 10) == TruncateValue(b, 10) {
+		t.Error("Expected values differing after the cut to truncate differently")
+	}
+}
+
+func TestTruncateValueRuneBoundary(t *testing.T) {
+	// "é" is two bytes; cutting at 3 would split the second one
+	got := TruncateValue("ééééé", 3)
+	if !utf8.ValidString(got) {
+		t.Errorf("Expected valid UTF-8, got %q", got)
+	}
+	if !strings.HasPrefix(got, "é…") {
+		t.Errorf("Expected cut before the split rune, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// DefaultActiveWindow is how far back /api/clusters/active looks when no since is given.
+const DefaultActiveWindow = 24 * time.Hour
+
+// handleAPIActiveClusters handles GET /api/clusters/active, listing the clusters with
+// changes detected since the given time, busiest first. since accepts an RFC3339
+// time or a duration such as "6h" counted back from now.
+func (s *Server) handleAPIActiveClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since, err := parseSinceParam(r, time.Now())
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	active := []storage.ClusterChangeCount{}
+	for _, store := range s.allStores() {
+		counts, err := store.CountChangesByCluster(r.Context(), since)
+		if err != nil {
+			slog.Error("Error counting changes by cluster", "error", err)
+			s.jsonError(w, "Failed to count changes", http.StatusInternalServerError)
+			return
+		}
+		for _, c := range counts {
+			// A store may still hold rows for clusters since moved elsewhere or
+			// removed from the configuration; only count each where it lives now.
+			if s.storeFor(c.ClusterID) != store || !s.isValidCluster(c.ClusterID) {
+				continue
+			}
+			c.LastChanged = s.timeFormat.Apply(c.LastChanged)
+			active = append(active, c)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		if active[i].Count != active[j].Count {
+			return active[i].Count > active[j].Count
+		}
+		return active[i].ClusterID < active[j].ClusterID
+	})
+
+	jsonResponse(w, http.StatusOK, active)
+}
+
+// parseSinceParam parses the since query parameter as an RFC3339 time or a
+// positive duration before now, defaulting to DefaultActiveWindow.
+func parseSinceParam(r *http.Request, now time.Time) (time.Time, error) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return now.Add(-DefaultActiveWindow), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		if d <= 0 {
+			return time.Time{}, errors.New("invalid since: duration must be positive")
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New("invalid since: must be an RFC3339 timestamp or a duration such as 24h")
+	}
+	return t, nil
+}
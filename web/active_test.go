@@ -0,0 +1,102 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIActiveClusters(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	// The first snapshot of a cluster records no changes, so each later value is one change.
+	for cluster, values := range map[string][]string{
+		"busy":   {"1", "2", "3", "4"},
+		"quiet":  {"1", "2"},
+		"idle":   {"1"},
+		"hidden": {"1", "2", "3", "4", "5"},
+	} {
+		for _, v := range values {
+			if _, err := store.SaveSnapshotWithChanges(ctx, cluster, []storage.Setting{{Variable: "a.b", Value: v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+	}
+
+	get := func(t *testing.T, server *Server, url string) (int, []storage.ClusterChangeCount) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var got []storage.ClusterChangeCount
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+		}
+		return w.Code, got
+	}
+
+	t.Run("allowlist", func(t *testing.T) {
+		clusters := []config.ClusterConfig{{ID: "busy", Name: "Busy"}, {ID: "quiet", Name: "Quiet"}, {ID: "idle", Name: "Idle"}}
+		server, err := New(store, WithClusters(clusters), WithDefaultClusterID("busy"))
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		code, got := get(t, server, "/api/clusters/active")
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if len(got) != 2 || got[0].ClusterID != "busy" || got[0].Count != 3 || got[1].ClusterID != "quiet" || got[1].Count != 1 {
+			t.Errorf("Unexpected active clusters: %+v", got)
+		}
+	})
+
+	t.Run("no allowlist", func(t *testing.T) {
+		server, err := New(store)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		_, got := get(t, server, "/api/clusters/active?since=1h")
+		if len(got) != 3 || got[0].ClusterID != "hidden" || got[0].Count != 4 {
+			t.Errorf("Unexpected active clusters: %+v", got)
+		}
+	})
+
+	t.Run("window excludes older changes", func(t *testing.T) {
+		server, err := New(store)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		since := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+		code, got := get(t, server, "/api/clusters/active?since="+since)
+		if code != http.StatusOK || got == nil || len(got) != 0 {
+			t.Errorf("Expected an empty list, got %d %+v", code, got)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		server, err := New(store)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		for _, url := range []string{"/api/clusters/active?since=yesterday", "/api/clusters/active?since=-1h"} {
+			if code, _ := get(t, server, url); code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", url, code)
+			}
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/clusters/active", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405 for POST, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"crdb-cluster-history/storage"
+)
+
+// ChangeInContext is a change alongside where its setting stands in the latest snapshot.
+type ChangeInContext struct {
+	storage.Change
+	ID      int64           `json:"id,string"` // String to avoid JavaScript precision loss
+	Current *CurrentSetting `json:"current"`   // nil if the setting is not in the latest snapshot
+}
+
+// CurrentSetting is a setting as recorded in the latest snapshot.
+type CurrentSetting struct {
+	Value        string `json:"value"`
+	SettingType  string `json:"setting_type"`
+	Description  string `json:"description"`
+	DefaultValue string `json:"default_value"` // Empty for snapshots taken before defaults were recorded
+}
+
+// handleAPIChangesContext handles GET /api/changes/context, which returns recent
+// changes for a cluster, each with its setting's current value and type from the
+// latest snapshot. A setting removed since has a null current.
+func (s *Server) handleAPIChangesContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := s.limits.PageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= s.limits.MaxChanges {
+			limit = parsed
+		}
+	}
+
+	ctx := r.Context()
+	store := s.storeFor(clusterID)
+	changes, err := store.GetChangesWithAnnotations(ctx, clusterID, limit)
+	if err != nil {
+		slog.Error("Error getting changes", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	latest, err := s.latestSnapshot(ctx, clusterID)
+	if err != nil {
+		slog.Error("Error getting latest snapshot", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get latest snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]ChangeInContext, len(changes))
+	for i, c := range changes {
+		item := ChangeInContext{Change: c.Change, ID: c.ID}
+		if setting, ok := latest[c.Variable]; ok {
+			item.Current = &CurrentSetting{
+				Value:        setting.Value,
+				SettingType:  setting.SettingType,
+				Description:  setting.Description,
+				DefaultValue: setting.DefaultValue,
+			}
+		}
+		if s.redactor != nil {
+			item.Change = s.redactor.RedactChange(item.Change)
+			if item.Current != nil {
+				item.Current.Value = s.redactor.RedactValue(c.Variable, item.Current.Value)
+				item.Current.DefaultValue = redactNonEmpty(s.redactor, c.Variable, item.Current.DefaultValue)
+				item.Current.Description = s.redactor.RedactDescription(c.Variable, item.Current.Description)
+			}
+		}
+		item.DetectedAt = s.timeFormat.Apply(item.DetectedAt)
+		result[i] = item
+	}
+
+	jsonResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIChangesContext(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, settings := range [][]storage.Setting{
+		{{Variable: "changed", Value: "1", SettingType: "i"}, {Variable: "readded", Value: "x", SettingType: "s"}, {Variable: "removed", Value: "k", SettingType: "s"}, {Variable: "server.secret", Value: "a", SettingType: "s"}},
+		{{Variable: "changed", Value: "2", SettingType: "i"}, {Variable: "removed", Value: "k", SettingType: "s"}, {Variable: "server.secret", Value: "b", SettingType: "s"}},
+		{{Variable: "changed", Value: "3", SettingType: "i", Description: "a counter", DefaultValue: "0"}, {Variable: "readded", Value: "y", SettingType: "s"}, {Variable: "server.secret", Value: "b", SettingType: "s", DefaultValue: "c"}},
+	} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store,
+		WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}),
+		WithDefaultClusterID("prod"),
+		WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true})))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes/context?cluster=prod", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var got []ChangeInContext
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(got) != 6 {
+		t.Fatalf("Expected 6 changes, got %d: %+v", len(got), got)
+	}
+
+	type key struct{ variable, oldValue, newValue string }
+	byChange := make(map[key]ChangeInContext)
+	for _, c := range got {
+		if c.ID == 0 {
+			t.Errorf("Change %s has no ID", c.Variable)
+		}
+		byChange[key{c.Variable, c.OldValue, c.NewValue}] = c
+	}
+
+	tests := []struct {
+		name    string
+		change  key
+		current *CurrentSetting
+	}{
+		{"changed, earlier change", key{"changed", "1", "2"}, &CurrentSetting{Value: "3", SettingType: "i", Description: "a counter", DefaultValue: "0"}},
+		{"changed, latest change", key{"changed", "2", "3"}, &CurrentSetting{Value: "3", SettingType: "i", Description: "a counter", DefaultValue: "0"}},
+		{"removal of a re-added setting", key{"readded", "x", ""}, &CurrentSetting{Value: "y", SettingType: "s"}},
+		{"re-added", key{"readded", "", "y"}, &CurrentSetting{Value: "y", SettingType: "s"}},
+		{"removed", key{"removed", "k", ""}, nil},
+		{"redacted", key{"server.secret", storage.RedactedPlaceholder, storage.RedactedPlaceholder}, &CurrentSetting{Value: storage.RedactedPlaceholder, SettingType: "s", DefaultValue: storage.RedactedPlaceholder}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := byChange[tt.change]
+			if !ok {
+				t.Fatalf("Change %+v not returned", tt.change)
+			}
+			switch {
+			case tt.current == nil && c.Current != nil:
+				t.Errorf("Expected no current setting, got %+v", *c.Current)
+			case tt.current != nil && (c.Current == nil || *c.Current != *tt.current):
+				t.Errorf("Current = %+v, want %+v", c.Current, *tt.current)
+			}
+		})
+	}
+
+	t.Run("removed setting serializes as null", func(t *testing.T) {
+		var raw []map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		for _, c := range raw {
+			if string(c["variable"]) == `"removed"` && string(c["current"]) != "null" {
+				t.Errorf("current = %s, want null", c["current"])
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// groupByCollection is the /api/changes group value that buckets changes by the
+// collection that detected them.
+const groupByCollection = "collection"
+
+// ChangeGroup is the changes one collection detected, which share its detection
+// time and the cluster version it saw.
+type ChangeGroup struct {
+	DetectedAt time.Time      `json:"detected_at"`
+	Version    string         `json:"version"`
+	Changes    []linkedChange `json:"changes"`
+}
+
+// groupChangesByCollection buckets changes by detection time, in the order each
+// time first appears, so the newest-first order of GetChanges is kept.
+func groupChangesByCollection(changes []storage.Change) [][]storage.Change {
+	var groups [][]storage.Change
+	index := make(map[int64]int)
+	for _, c := range changes {
+		key := c.DetectedAt.UnixNano()
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], c)
+	}
+	return groups
+}
+
+// writeChangeGroups responds with changes grouped by collection. Groups are built
+// before timestamps are truncated to the configured precision, so collections
+// within the same second stay apart. The oldest group may be partial when the
+// limit cuts through it.
+func (s *Server) writeChangeGroups(w http.ResponseWriter, changes []storage.Change) {
+	groups := groupChangesByCollection(changes)
+	result := make([]ChangeGroup, len(groups))
+	for i, group := range groups {
+		g := ChangeGroup{
+			DetectedAt: s.timeFormat.Apply(group[0].DetectedAt),
+			Version:    group[0].Version,
+			Changes:    make([]linkedChange, len(group)),
+		}
+		for j, c := range group {
+			c.DetectedAt = g.DetectedAt
+			g.Changes[j] = linkedChange{Change: c}
+			if s.changeLink != nil {
+				g.Changes[j].Link = s.changeLink.Render(c)
+			}
+		}
+		result[i] = g
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIChangesGroupedByCollection(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	saves := []struct {
+		settings []storage.Setting
+		version  string
+	}{
+		{[]storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "1"}, {Variable: "c", Value: "1"}}, "v25.3.0"},
+		{[]storage.Setting{{Variable: "a", Value: "2"}, {Variable: "b", Value: "2"}, {Variable: "c", Value: "1"}}, "v25.3.0"},
+		{[]storage.Setting{{Variable: "a", Value: "2"}, {Variable: "b", Value: "2"}, {Variable: "c", Value: "2"}}, "v25.4.1"},
+	}
+	for _, save := range saves {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", save.settings, save.version); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get("/api/changes?group=collection")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var groups []ChangeGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected one group per save with changes, got %d: %+v", len(groups), groups)
+	}
+
+	// Newest first: the third save changed c, the second a and b together. The
+	// saves usually fall within the same second, the default timestamp precision,
+	// yet are still grouped apart.
+	if g := groups[0]; g.Version != "v25.4.1" || len(g.Changes) != 1 || g.Changes[0].Variable != "c" {
+		t.Errorf("Unexpected newest group: %+v", g)
+	}
+	if g := groups[1]; g.Version != "v25.3.0" || len(g.Changes) != 2 {
+		t.Errorf("Unexpected oldest group: %+v", g)
+	}
+	for _, g := range groups {
+		for _, c := range g.Changes {
+			if !c.DetectedAt.Equal(g.DetectedAt) {
+				t.Errorf("Change %s detected at %v, outside its group at %v", c.Variable, c.DetectedAt, g.DetectedAt)
+			}
+		}
+	}
+
+	for _, url := range []string{
+		"/api/changes?group=day",
+		"/api/changes?group=collection&format=text",
+		"/api/changes?group=collection&unacknowledged=true",
+	} {
+		if w := get(url); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// ChangeLinkPlaceholders are the placeholders a change link template may use.
+// Values are URL query escaped when substituted.
+var ChangeLinkPlaceholders = []string{
+	"{cluster}",        // Cluster ID
+	"{variable}",       // Setting name
+	"{detected_at}",    // Detection time, RFC3339 in UTC
+	"{detected_at_ms}", // Detection time, Unix milliseconds (e.g. for Grafana's from/to)
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ChangeLinkTemplate renders a per-change link to external tooling such as a
+// ticket system or a dashboard at the time of the change.
+type ChangeLinkTemplate struct {
+	template string
+}
+
+// ParseChangeLinkTemplate checks that tmpl uses only ChangeLinkPlaceholders and
+// renders to an absolute http or https URL. An empty tmpl returns nil, which
+// renders no links.
+func ParseChangeLinkTemplate(tmpl string) (*ChangeLinkTemplate, error) {
+	if tmpl == "" {
+		return nil, nil
+	}
+	for _, p := range placeholderPattern.FindAllString(tmpl, -1) {
+		if !slices.Contains(ChangeLinkPlaceholders, p) {
+			return nil, fmt.Errorf("unknown placeholder %s (use %s)", p, strings.Join(ChangeLinkPlaceholders, ", "))
+		}
+	}
+
+	t := &ChangeLinkTemplate{template: tmpl}
+	sample := t.Render(storage.Change{ClusterID: "cluster", Variable: "setting", DetectedAt: time.Unix(0, 0)})
+	u, err := url.Parse(sample)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("must be an absolute http or https URL")
+	}
+	return t, nil
+}
+
+// Render returns the link for a change. A nil template renders an empty string.
+func (t *ChangeLinkTemplate) Render(c storage.Change) string {
+	if t == nil {
+		return ""
+	}
+	detectedAt := c.DetectedAt.UTC()
+	return strings.NewReplacer(
+		"{cluster}", url.QueryEscape(c.ClusterID),
+		"{variable}", url.QueryEscape(c.Variable),
+		"{detected_at}", url.QueryEscape(detectedAt.Format(time.RFC3339)),
+		"{detected_at_ms}", strconv.FormatInt(detectedAt.UnixMilli(), 10),
+	).Replace(t.template)
+}
+
+// linkedChange is a change with its rendered change link, for the JSON API.
+type linkedChange struct {
+	storage.Change
+	Link string `json:"link,omitempty"`
+}
+
+// WithChangeLinkTemplate links each change to external tooling in the dashboard
+// and the changes API. A nil template adds no links.
+func WithChangeLinkTemplate(t *ChangeLinkTemplate) Option {
+	return func(s *Server) {
+		s.changeLink = t
+	}
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestChangeLinkTemplateRender(t *testing.T) {
+	tmpl, err := ParseChangeLinkTemplate("https://tickets.example.com/search?q={cluster}+{variable}&at={detected_at}&from={detected_at_ms}")
+	if err != nil {
+		t.Fatalf("ParseChangeLinkTemplate failed: %v", err)
+	}
+	change := storage.Change{
+		ClusterID:  "prod-east",
+		Variable:   "sql.defaults.distsql",
+		DetectedAt: time.Date(2024, 5, 1, 14, 30, 0, 0, time.FixedZone("EDT", -4*3600)),
+	}
+	want := "https://tickets.example.com/search?q=prod-east+sql.defaults.distsql&at=2024-05-01T18%3A30%3A00Z&from=1714588200000"
+	if got := tmpl.Render(change); got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	change.Variable = "a b&c"
+	if got := tmpl.Render(change); !strings.Contains(got, "q=prod-east+a+b%26c&") {
+		t.Errorf("Expected the variable to be escaped, got %q", got)
+	}
+
+	var none *ChangeLinkTemplate
+	if got := none.Render(change); got != "" {
+		t.Errorf("Expected no link from a nil template, got %q", got)
+	}
+}
+
+func TestParseChangeLinkTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr string
+	}{
+		{"", ""},
+		{"http://grafana:3000/d/x?var-cluster={cluster}", ""},
+		{"https://example.com/{cluster}/{varible}", "unknown placeholder {varible}"},
+		{"/relative?cluster={cluster}", "absolute http or https URL"},
+		{"javascript:alert({cluster})", "absolute http or https URL"},
+		{"https://exa mple.com/{cluster}", "invalid URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			_, err := ParseChangeLinkTemplate(tt.tmpl)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestChangeLinksInDashboardAndAPI(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.SaveSnapshotWithChanges(ctx, "default", []storage.Setting{{Variable: "a.b", Value: "1"}}, "v1.0")
+	store.SaveSnapshotWithChanges(ctx, "default", []storage.Setting{{Variable: "a.b", Value: "2"}}, "v1.0")
+
+	tmpl, err := ParseChangeLinkTemplate("https://tickets.example.com/?cluster={cluster}&setting={variable}")
+	if err != nil {
+		t.Fatalf("ParseChangeLinkTemplate failed: %v", err)
+	}
+	server, err := New(store, WithChangeLinkTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(w.Body.String(), `href="https://tickets.example.com/?cluster=default&amp;setting=a.b"`) {
+		t.Errorf("Expected the change link on the dashboard")
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes", nil))
+	var changes []struct {
+		Variable string `json:"variable"`
+		Link     string `json:"link"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Link != "https://tickets.example.com/?cluster=default&setting=a.b" {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+}
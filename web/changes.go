@@ -0,0 +1,665 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// MaxChangesLimit caps the limit accepted by /api/changes, unless
+	// configured with WithPageLimits.
+	MaxChangesLimit = config.DefaultMaxChanges
+
+	// DefaultTopChangesLimit and MaxTopChangesLimit bound /api/clusters/{id}/top-changes.
+	DefaultTopChangesLimit = 10
+	MaxTopChangesLimit     = 100
+
+	// DefaultTopChangesWindow is the lookback used when top-changes has no from= parameter.
+	DefaultTopChangesWindow = 30 * 24 * time.Hour
+
+	// DefaultStreamInterval is how often /api/changes/jsonl/stream checks for new changes.
+	DefaultStreamInterval = 2 * time.Second
+)
+
+// handleAPIChanges returns recent changes for a cluster.
+// JSON is returned by default; ?format=text or an Accept header preferring
+// text/plain returns an aligned, human-readable summary instead, and
+// ?format=markdown or text/markdown a Markdown table. ?group=collection returns
+// JSON changes grouped by the collection that detected them. ?from= and ?to=
+// (RFC3339) limit the changes to those detected in [from, to); either may be
+// omitted for an open-ended range. ?offset= pages back through history, returning
+// each change with its ID and annotation and the total in X-Total-Count.
+func (s *Server) handleAPIChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := s.limits.PageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= s.limits.MaxChanges {
+			limit = parsed
+		}
+	}
+
+	group := r.URL.Query().Get("group")
+	if group != "" && group != groupByCollection {
+		s.jsonError(w, "group must be collection", http.StatusBadRequest)
+		return
+	}
+	if f := r.URL.Query().Get("format"); group != "" && f != "" && f != "json" {
+		s.jsonError(w, "group is only supported for JSON", http.StatusBadRequest)
+		return
+	}
+	if group != "" && r.URL.Query().Has("unacknowledged") {
+		s.jsonError(w, "group cannot be combined with unacknowledged", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", time.Time{})
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inRange := !from.IsZero() || !to.IsZero()
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		s.jsonError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if inRange && r.URL.Query().Has("unacknowledged") {
+		s.jsonError(w, "from and to cannot be combined with unacknowledged", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Has("offset") {
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			s.jsonError(w, "offset must be an integer", http.StatusBadRequest)
+			return
+		}
+		if group != "" || inRange || r.URL.Query().Has("unacknowledged") {
+			s.jsonError(w, "offset cannot be combined with group, from, to, or unacknowledged", http.StatusBadRequest)
+			return
+		}
+		if wantsText(r) || wantsMarkdown(r) {
+			s.jsonError(w, "offset is only supported for JSON", http.StatusBadRequest)
+			return
+		}
+		s.writePagedChanges(w, r, clusterID, limit, offset)
+		return
+	}
+
+	if v := r.URL.Query().Get("unacknowledged"); v != "" {
+		unacknowledgedOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			s.jsonError(w, "unacknowledged must be true or false", http.StatusBadRequest)
+			return
+		}
+		s.writeAcknowledgementChanges(w, r, clusterID, unacknowledgedOnly, limit)
+		return
+	}
+
+	var changes []storage.Change
+	if inRange {
+		changes, err = s.storeFor(clusterID).GetChangesInRange(r.Context(), clusterID, from, to, limit)
+	} else {
+		changes, err = s.storeFor(clusterID).GetChanges(r.Context(), clusterID, limit)
+	}
+	if err != nil {
+		slog.Error("Error getting changes", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []storage.Change{}
+	}
+	if s.redactor != nil {
+		changes = s.redactor.RedactChanges(changes)
+	}
+	if group != "" {
+		s.writeChangeGroups(w, changes)
+		return
+	}
+	changes = s.timeFormat.ApplyToChanges(changes)
+
+	if wantsMarkdown(r) {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		if err := writeChangesMarkdown(w, changes, s.timeFormat); err != nil {
+			slog.Error("Error writing Markdown changes", "cluster", clusterID, "error", err)
+		}
+		return
+	}
+	if wantsText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := writeChangesText(w, changes, s.timeFormat); err != nil {
+			slog.Error("Error writing text changes", "cluster", clusterID, "error", err)
+		}
+		return
+	}
+
+	if s.changeLink != nil {
+		linked := make([]linkedChange, len(changes))
+		for i, c := range changes {
+			linked[i] = linkedChange{Change: c, Link: s.changeLink.Render(c)}
+		}
+		jsonResponse(w, http.StatusOK, linked)
+		return
+	}
+	jsonResponse(w, http.StatusOK, changes)
+}
+
+// writeAcknowledgementChanges responds with recent changes, their IDs, and their
+// acknowledgements, for triage. If unacknowledgedOnly is true, acknowledged
+// changes are left out.
+func (s *Server) writeAcknowledgementChanges(w http.ResponseWriter, r *http.Request, clusterID string, unacknowledgedOnly bool, limit int) {
+	changes, err := s.storeFor(clusterID).GetChangesWithAcknowledgements(r.Context(), clusterID, unacknowledgedOnly, limit)
+	if err != nil {
+		slog.Error("Error getting changes with acknowledgements", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	for i := range changes {
+		c := &changes[i]
+		if s.redactor != nil {
+			c.Change = s.redactor.RedactChange(c.Change)
+		}
+		c.DetectedAt = s.timeFormat.Apply(c.DetectedAt)
+		if c.Acknowledgement != nil {
+			c.Acknowledgement.AcknowledgedAt = s.timeFormat.Apply(c.Acknowledgement.AcknowledgedAt)
+		}
+	}
+	jsonResponse(w, http.StatusOK, changes)
+}
+
+// pagedChange is a change in a page of /api/changes?offset=.
+type pagedChange struct {
+	storage.Change
+	ID         int64               `json:"id,string"`
+	Annotation *AnnotationResponse `json:"annotation,omitempty"`
+}
+
+// writePagedChanges responds with the limit changes after the offset newest,
+// with their IDs and annotations, and sets X-Total-Count to the cluster's number
+// of changes so clients can number pages. The offset is clamped to [0, total]
+// rather than rejected.
+func (s *Server) writePagedChanges(w http.ResponseWriter, r *http.Request, clusterID string, limit, offset int) {
+	store := s.storeFor(clusterID)
+	total, err := store.CountChanges(r.Context(), clusterID)
+	if err != nil {
+		slog.Error("Error counting changes", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	offset = int(min(max(int64(offset), 0), total))
+
+	changes, err := store.GetChangesWithAnnotationsPaged(r.Context(), clusterID, limit, offset)
+	if err != nil {
+		slog.Error("Error getting changes", "cluster", clusterID, "offset", offset, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	if s.redactor != nil {
+		changes = s.redactChangesWithAnnotations(changes)
+	}
+
+	page := make([]pagedChange, len(changes))
+	for i, c := range changes {
+		page[i] = pagedChange{Change: c.Change, ID: c.ID}
+		page[i].DetectedAt = s.timeFormat.Apply(c.DetectedAt)
+		if c.Annotation != nil {
+			resp := s.annotationToResponse(c.Annotation)
+			page[i].Annotation = &resp
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	jsonResponse(w, http.StatusOK, page)
+}
+
+// handleAPIChangeByID handles POST /api/changes/{id}/ack, which marks a change as
+// reviewed by the requesting user, and GET /api/changes/{id}/annotation, which
+// returns the change's annotation.
+func (s *Server) handleAPIChangeByID(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/changes/"), "/")
+	var method string
+	switch action {
+	case "ack":
+		method = http.MethodPost
+	case "annotation":
+		method = http.MethodGet
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		s.jsonError(w, "Invalid change ID", http.StatusBadRequest)
+		return
+	}
+
+	clusterID, err := s.lookupCluster(r, "cluster")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if action == "annotation" {
+		s.getChangeAnnotation(w, r, clusterID, id)
+		return
+	}
+
+	store, err := s.storeForChange(r.Context(), clusterID, id)
+	if s.ambiguousID(w, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding change", "change", id, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	ack, err := store.AcknowledgeChange(r.Context(), id, s.getUsernameFromRequest(r))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation:
+			s.jsonError(w, "Change not found", http.StatusNotFound)
+		case errors.Is(err, storage.ErrNotSupported):
+			s.jsonError(w, "Acknowledgements are not supported by file storage", http.StatusNotImplemented)
+		default:
+			slog.Error("Error acknowledging change", "change", id, "error", err)
+			s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ack.AcknowledgedAt = s.timeFormat.Apply(ack.AcknowledgedAt)
+	jsonResponse(w, http.StatusOK, ack)
+}
+
+// getChangeAnnotation responds with the annotation of a change, or 404 if the
+// change has none, so a UI can edit a note by the change it is showing.
+func (s *Server) getChangeAnnotation(w http.ResponseWriter, r *http.Request, clusterID string, changeID int64) {
+	store, err := s.storeForChange(r.Context(), clusterID, changeID)
+	if s.ambiguousID(w, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding change", "change", changeID, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	ann, err := store.GetAnnotationByChangeID(r.Context(), changeID)
+	if err != nil {
+		slog.Error("Error getting annotation", "change", changeID, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if ann == nil {
+		s.jsonError(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.annotationToResponse(ann))
+}
+
+// handleAPIChangesStream holds the response open and writes each change detected
+// after the request arrived as one JSON object per line (JSON Lines), flushing after
+// every poll that found changes. It is meant for log shippers that read raw
+// line-delimited JSON; the stream ends when the client disconnects.
+func (s *Server) handleAPIChangesStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	latest, err := s.storeFor(clusterID).GetChangesWithAnnotations(ctx, clusterID, 1)
+	if err != nil {
+		slog.Error("Error getting latest change", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+	var cursor int64
+	if len(latest) > 0 {
+		cursor = latest[0].ID
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Warn("Failed to clear write deadline for change stream", "error", err)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(s.streamInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var writeErr error
+		sent := 0
+		err := s.storeFor(clusterID).StreamChangesAfter(ctx, clusterID, cursor, func(id int64, c storage.Change) error {
+			if s.redactor != nil {
+				c = s.redactor.RedactChange(c)
+			}
+			c.DetectedAt = s.timeFormat.Apply(c.DetectedAt)
+			if writeErr = enc.Encode(c); writeErr != nil {
+				return writeErr
+			}
+			cursor = max(cursor, id)
+			sent++
+			return nil
+		})
+		if writeErr != nil || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Retried on the next tick from the same cursor
+			slog.Warn("Error streaming changes", "cluster", clusterID, "error", err)
+		}
+		if sent > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wantsText reports whether the request asks for a text/plain response, either
+// via ?format=text or an Accept header listing text/plain before application/json.
+func wantsText(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "text":
+		return true
+	case "json":
+		return false
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/plain":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// wantsMarkdown reports whether the request asks for a Markdown response, either
+// via ?format=markdown or an Accept header listing text/markdown before
+// text/plain or application/json.
+func wantsMarkdown(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "markdown"
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/markdown":
+			return true
+		case "text/plain", "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// writeChangesMarkdown writes changes as a Markdown table: variable, old → new,
+// version, and time.
+func writeChangesMarkdown(w io.Writer, changes []storage.Change, tf storage.TimestampFormat) error {
+	var b strings.Builder
+	b.WriteString("| Variable | Change | Version | Time |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, c := range changes {
+		fmt.Fprintf(&b, "| %s | %s → %s | %s | %s |\n",
+			markdownCell(c.Variable),
+			markdownCell(textValue(c.OldValue)),
+			markdownCell(textValue(c.NewValue)),
+			markdownCell(c.Version),
+			markdownCell(tf.Format(c.DetectedAt)),
+		)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscaper escapes the characters that would end a table cell or be read
+// as Markdown formatting.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"|", `\|`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", "&lt;",
+	">", "&gt;",
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+// markdownCell renders a value for a Markdown table cell.
+func markdownCell(v string) string {
+	return markdownEscaper.Replace(v)
+}
+
+// writeChangesText writes changes as aligned columns: time, variable, old → new.
+func writeChangesText(w io.Writer, changes []storage.Change, tf storage.TimestampFormat) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tVARIABLE\tCHANGE")
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s → %s\n",
+			tf.Format(c.DetectedAt),
+			c.Variable,
+			textValue(c.OldValue),
+			textValue(c.NewValue),
+		)
+	}
+	return tw.Flush()
+}
+
+// textValue renders a setting value for the text summary, marking empty values
+// (added or removed settings) with a dash.
+func textValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// handleAPITopChanges returns the most frequently changed settings for a cluster.
+// Optional from/to (RFC3339) bound the window, defaulting to the last 30 days.
+func (s *Server) handleAPITopChanges(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(r, "from", now.Add(-DefaultTopChangesWindow))
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", now)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		s.jsonError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	limit := DefaultTopChangesLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= MaxTopChangesLimit {
+			limit = parsed
+		}
+	}
+
+	counts, err := s.storeFor(clusterID).GetTopChangedSettings(r.Context(), clusterID, from, to, limit)
+	if err != nil {
+		slog.Error("Error getting top changed settings", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get top changed settings", http.StatusInternalServerError)
+		return
+	}
+	for i := range counts {
+		counts[i].LastChanged = s.timeFormat.Apply(counts[i].LastChanged)
+	}
+
+	jsonResponse(w, http.StatusOK, counts)
+}
+
+// parseTimeParam parses an RFC3339 query parameter, returning def when it is absent.
+func parseTimeParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: must be an RFC3339 timestamp", name)
+	}
+	return t, nil
+}
+
+// LatestDiffResult is the diff between a cluster's two most recent snapshots.
+type LatestDiffResult struct {
+	ClusterID  string                `json:"cluster_id"`
+	Comparable bool                  `json:"comparable"`     // false when the cluster has fewer than two snapshots
+	From       *storage.SnapshotInfo `json:"from,omitempty"` // previous snapshot
+	To         *storage.SnapshotInfo `json:"to,omitempty"`   // latest snapshot
+	Changes    []storage.Change      `json:"changes"`
+}
+
+// handleAPILatestDiff returns what changed between the two most recent snapshots
+// of a cluster, as changes detected at the latest snapshot's collection time.
+func (s *Server) handleAPILatestDiff(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	snapshots, err := s.storeFor(clusterID).ListSnapshots(ctx, clusterID, 2)
+	if err != nil {
+		slog.Error("Error listing snapshots", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	result := LatestDiffResult{ClusterID: clusterID, Changes: []storage.Change{}}
+	for i := range snapshots {
+		snapshots[i].CollectedAt = s.timeFormat.Apply(snapshots[i].CollectedAt)
+	}
+	if len(snapshots) > 0 {
+		result.To = &snapshots[0]
+	}
+	if len(snapshots) < 2 {
+		jsonResponse(w, http.StatusOK, result)
+		return
+	}
+	result.From = &snapshots[1]
+	result.Comparable = true
+
+	previous, err := s.storeFor(clusterID).GetSnapshotByID(ctx, result.From.ID)
+	if err != nil {
+		slog.Error("Error getting snapshot", "snapshot", result.From.ID, "error", err)
+		s.jsonError(w, "Failed to get snapshot", http.StatusInternalServerError)
+		return
+	}
+	latest, err := s.storeFor(clusterID).GetSnapshotByID(ctx, result.To.ID)
+	if err != nil {
+		slog.Error("Error getting snapshot", "snapshot", result.To.ID, "error", err)
+		s.jsonError(w, "Failed to get snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	result.Changes = diffToChanges(clusterID, compareSettings(previous, latest), result.To.CollectedAt)
+	if s.redactor != nil {
+		result.Changes = s.redactor.RedactChanges(result.Changes)
+	}
+
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// diffToChanges converts a snapshot diff (A = before, B = after) into changes
+// detected at the given time, sorted by variable.
+func diffToChanges(clusterID string, diff diffResult, detectedAt time.Time) []storage.Change {
+	changes := make([]storage.Change, 0, len(diff.OnlyInA)+len(diff.OnlyInB)+len(diff.Different))
+	for _, d := range diff.Different {
+		changes = append(changes, storage.Change{ClusterID: clusterID, DetectedAt: detectedAt, Variable: d.Variable, OldValue: d.Value1, NewValue: d.Value2, Description: d.Description})
+	}
+	for _, d := range diff.OnlyInB {
+		changes = append(changes, storage.Change{ClusterID: clusterID, DetectedAt: detectedAt, Variable: d.Variable, NewValue: d.Value2, Description: d.Description})
+	}
+	for _, d := range diff.OnlyInA {
+		changes = append(changes, storage.Change{ClusterID: clusterID, DetectedAt: detectedAt, Variable: d.Variable, OldValue: d.Value1, Description: d.Description})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Variable < changes[j].Variable })
+	return changes
+}
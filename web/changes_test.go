@@ -0,0 +1,825 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestWriteChangesText(t *testing.T) {
+	detected := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	changes := []storage.Change{
+		{DetectedAt: detected, Variable: "kv.rangefeed.enabled", OldValue: "false", NewValue: "true"},
+		{DetectedAt: detected, Variable: "sql.stats.automatic_collection.enabled", OldValue: "", NewValue: "on"},
+	}
+
+	var buf strings.Builder
+	if err := writeChangesText(&buf, changes, storage.TimestampFormat{}); err != nil {
+		t.Fatalf("writeChangesText failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header plus 2 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "TIME VARIABLE CHANGE" {
+		t.Errorf("Unexpected header: %q", lines[0])
+	}
+
+	fields := strings.Fields(lines[1])
+	want := []string{"2025-01-15T10:30:00Z", "kv.rangefeed.enabled", "false", "→", "true"}
+	if strings.Join(fields, " ") != strings.Join(want, " ") {
+		t.Errorf("Row 1 = %v, want %v", fields, want)
+	}
+	if !strings.Contains(lines[2], "- → on") {
+		t.Errorf("Expected empty old value rendered as '-', got %q", lines[2])
+	}
+
+	// Columns are aligned: the variable column starts at the same offset on every line
+	col := strings.Index(lines[0], "VARIABLE")
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line[col:], "kv.") && !strings.HasPrefix(line[col:], "sql.") {
+			t.Errorf("Expected variable column at offset %d, got %q", col, line)
+		}
+	}
+}
+
+func TestWantsText(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   bool
+	}{
+		{"default", "", "", false},
+		{"format text", "format=text", "", true},
+		{"format json overrides accept", "format=json", "text/plain", false},
+		{"accept text", "", "text/plain", true},
+		{"accept json", "", "application/json", false},
+		{"accept json first", "", "application/json, text/plain", false},
+		{"accept text first", "", "text/plain;q=0.9, application/json", true},
+		{"accept wildcard", "", "*/*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/changes?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsText(req); got != tt.want {
+				t.Errorf("wantsText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteChangesMarkdown(t *testing.T) {
+	detected := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	changes := []storage.Change{
+		{DetectedAt: detected, Variable: "kv.rangefeed.enabled", OldValue: "false", NewValue: "true", Version: "v25.4.1"},
+		{DetectedAt: detected, Variable: "server.host_based_authentication.configuration", OldValue: "", NewValue: "host all root|admin *_x\nlocal `all`", Version: "v25.4.1"},
+	}
+
+	var buf strings.Builder
+	if err := writeChangesMarkdown(&buf, changes, storage.TimestampFormat{}); err != nil {
+		t.Fatalf("writeChangesMarkdown failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected header, separator and 2 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+	if lines[0] != "| Variable | Change | Version | Time |" || lines[1] != "| --- | --- | --- | --- |" {
+		t.Errorf("Unexpected header:\n%s\n%s", lines[0], lines[1])
+	}
+	if want := "| kv.rangefeed.enabled | false → true | v25.4.1 | 2025-01-15T10:30:00Z |"; lines[2] != want {
+		t.Errorf("Row 1 = %q, want %q", lines[2], want)
+	}
+	if want := "| server.host\\_based\\_authentication.configuration | - → host all root\\|admin \\*\\_x<br>local \\`all\\` | v25.4.1 | 2025-01-15T10:30:00Z |"; lines[3] != want {
+		t.Errorf("Row 2 = %q, want %q", lines[3], want)
+	}
+
+	// Every row has the header's four cells: no unescaped pipe splits a value
+	for i, line := range lines {
+		if cells := markdownCells(line); cells != 4 {
+			t.Errorf("Line %d has %d cells, want 4: %q", i+1, cells, line)
+		}
+	}
+}
+
+// markdownCells counts the cells of a Markdown table row, ignoring escaped pipes.
+func markdownCells(line string) int {
+	pipes := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			pipes++
+		}
+	}
+	return pipes - 1
+}
+
+func TestWantsMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   bool
+	}{
+		{"default", "", "", false},
+		{"format markdown", "format=markdown", "", true},
+		{"format text overrides accept", "format=text", "text/markdown", false},
+		{"accept markdown", "", "text/markdown", true},
+		{"accept text first", "", "text/plain, text/markdown", false},
+		{"accept markdown first", "", "text/markdown;q=0.9, application/json", true},
+		{"accept wildcard", "", "*/*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/changes?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsMarkdown(req); got != tt.want {
+				t.Errorf("wantsMarkdown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAPIChangesMarkdownRedacts(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, v := range []string{"old|secret", "new|secret"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "server.secret", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	server, err := New(store,
+		WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}),
+		WithDefaultClusterID("prod"),
+		WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true})))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes?format=markdown", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Expected text/markdown, got %s", ct)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "old") || strings.Contains(body, "new") {
+		t.Errorf("Expected redacted values, got:\n%s", body)
+	}
+	redacted := markdownCell(storage.RedactedPlaceholder)
+	if !strings.Contains(body, "| server.secret | "+redacted+" → "+redacted+" |") {
+		t.Errorf("Expected redacted change row, got:\n%s", body)
+	}
+}
+
+func TestHandleAPIChanges(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	store.CleanupOldChanges(ctx, testClusterID, 0)
+	store.SaveSnapshot(ctx, testClusterID, []storage.Setting{{Variable: "api.changes.setting", Value: "old", SettingType: "s"}}, "v1.0")
+	store.SaveSnapshot(ctx, testClusterID, []storage.Setting{{Variable: "api.changes.setting", Value: "new", SettingType: "s"}}, "v1.0")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/changes", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %s", ct)
+	}
+
+	var changes []storage.Change
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(changes) == 0 || changes[0].Variable != "api.changes.setting" {
+		t.Errorf("Expected api.changes.setting change, got %+v", changes)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/changes?format=text", nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain, got %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "api.changes.setting") || !strings.Contains(w.Body.String(), "old → new") {
+		t.Errorf("Expected text summary of the change, got %s", w.Body.String())
+	}
+}
+
+func TestHandleAPIChangesInRange(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, v := range []string{"1", "2", "3"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "range.setting", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct detection times
+	}
+	all, err := store.GetChanges(ctx, "prod", 10)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("GetChanges = %d changes, %v; want 2", len(all), err)
+	}
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes?"+query, nil))
+		return w
+	}
+	newer, older := all[0].DetectedAt.Format(time.RFC3339Nano), all[1].DetectedAt.Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string // new values, newest first
+	}{
+		{"closed range", "from=" + older + "&to=" + newer, []string{"2"}},
+		{"only from", "from=" + newer, []string{"3"}},
+		{"only to", "to=" + newer, []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var changes []storage.Change
+			if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			var values []string
+			for _, c := range changes {
+				values = append(values, c.NewValue)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, values)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"from=yesterday",
+		"from=" + newer + "&to=" + older,
+		"from=" + newer + "&to=" + newer,
+		"from=" + older + "&unacknowledged=true",
+	} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleAPIChangesPaged(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "paged.setting", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes?"+query, nil))
+		return w
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string // new values, newest first
+	}{
+		{"first page", "limit=2&offset=0", []string{"5", "4"}},
+		{"second page", "limit=2&offset=2", []string{"3", "2"}},
+		{"negative offset clamped", "limit=2&offset=-5", []string{"5", "4"}},
+		{"offset past the end clamped", "limit=2&offset=99999999999999999999", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if total := w.Header().Get("X-Total-Count"); total != "4" {
+				t.Errorf("Expected X-Total-Count 4, got %q", total)
+			}
+			var page []pagedChange
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			values := []string{}
+			for _, c := range page {
+				if c.ID == 0 {
+					t.Errorf("Expected change IDs, got %+v", c)
+				}
+				values = append(values, c.NewValue)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, values)
+			}
+		})
+	}
+
+	for _, query := range []string{"offset=x", "offset=2&group=collection", "offset=2&format=text", "offset=2&unacknowledged=true"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleAPIChangesMethodNotAllowed(t *testing.T) {
+	_, _, server := setupTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/changes", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestHandleAPIChangeAcknowledge(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	cleanupAnnotationTestData(t, store, ctx)
+	changeID := createTestChange(t, store, ctx)
+
+	unacknowledged := func() []storage.ChangeWithAcknowledgement {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes?unacknowledged=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var changes []storage.ChangeWithAcknowledgement
+		if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return changes
+	}
+
+	if changes := unacknowledged(); len(changes) != 1 || changes[0].ID != changeID {
+		t.Fatalf("Expected the new change to be unacknowledged, got %+v", changes)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/changes/%d/ack", changeID), nil)
+	req.SetBasicAuth("reviewer", "password")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var ack storage.Acknowledgement
+	if err := json.Unmarshal(w.Body.Bytes(), &ack); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if ack.ChangeID != changeID || ack.AcknowledgedBy != "reviewer" {
+		t.Errorf("Unexpected acknowledgement: %+v", ack)
+	}
+
+	if changes := unacknowledged(); len(changes) != 0 {
+		t.Errorf("Expected no unacknowledged changes after ack, got %+v", changes)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes?unacknowledged=false", nil))
+	var all []storage.ChangeWithAcknowledgement
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(all) != 1 || all[0].Acknowledgement == nil || all[0].Acknowledgement.AcknowledgedBy != "reviewer" {
+		t.Errorf("Expected the change with its acknowledgement, got %+v", all)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/changes/-1/ack", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown change, got %d", w.Code)
+	}
+}
+
+func TestHandleAPIChangeAcknowledgeValidation(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	server, err := New(store, WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/changes?unacknowledged=maybe", http.StatusBadRequest},
+		{http.MethodGet, "/api/changes?unacknowledged=true", http.StatusOK},
+		{http.MethodGet, "/api/changes/1/ack", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/changes/abc/ack", http.StatusBadRequest},
+		{http.MethodPost, "/api/changes/1/unknown", http.StatusNotFound},
+		{http.MethodPost, "/api/changes/1/ack", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+// annotatedStore serves annotations from memory over a file store, which has none.
+type annotatedStore struct {
+	*storage.FileStore
+	byChange map[int64]*storage.Annotation
+}
+
+func (s *annotatedStore) GetAnnotationByChangeID(ctx context.Context, changeID int64) (*storage.Annotation, error) {
+	return s.byChange[changeID], nil
+}
+
+func TestHandleAPIChangeAnnotation(t *testing.T) {
+	fs, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	created := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	store := &annotatedStore{FileStore: fs, byChange: map[int64]*storage.Annotation{
+		7: {ID: 3, ChangeID: 7, Content: "Raised for the backfill", Severity: storage.SeverityWarning, CreatedBy: "alice", CreatedAt: created},
+	}}
+	server, err := New(store, WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes/7/annotation", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var ann AnnotationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &ann); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if ann.ID != 3 || ann.ChangeID != 7 || ann.Content != "Raised for the backfill" || ann.Severity != storage.SeverityWarning {
+		t.Errorf("Unexpected annotation: %+v", ann)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/changes/8/annotation", http.StatusNotFound},
+		{http.MethodGet, "/api/changes/abc/annotation", http.StatusBadRequest},
+		{http.MethodPost, "/api/changes/7/annotation", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestHandleAPIChangesRedactedIndicator(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, v := range []string{"old-secret", "new-secret"} {
+		settings := []storage.Setting{{Variable: "server.secret.token", Value: v, SettingType: "s"}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, "redacted", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	server, err := New(store, WithDefaultClusterID("redacted"), WithRedactor(redactor))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "secret\"") {
+		t.Errorf("Expected sensitive values to stay hidden, got %s", w.Body.String())
+	}
+
+	var changes []storage.Change
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(changes) != 1 || !changes[0].Redacted || !changes[0].Changed {
+		t.Errorf("Expected one redacted change flagged as changed, got %+v", changes)
+	}
+}
+
+func TestHandleAPIChangesStream(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	save := func(settings ...storage.Setting) {
+		t.Helper()
+		if _, err := store.SaveSnapshotWithChanges(ctx, "stream", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	// A change from before the stream opened is not sent
+	save(storage.Setting{Variable: "a", Value: "1"}, storage.Setting{Variable: "server.secret.token", Value: "s1"})
+	save(storage.Setting{Variable: "a", Value: "2"}, storage.Setting{Variable: "server.secret.token", Value: "s1"})
+
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	server, err := New(store, WithDefaultClusterID("stream"), WithRedactor(redactor), WithStreamInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, ts.URL+"/api/changes/jsonl/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected application/x-ndjson, got %q", ct)
+	}
+
+	save(storage.Setting{Variable: "a", Value: "3"}, storage.Setting{Variable: "server.secret.token", Value: "s2"})
+
+	scanner := bufio.NewScanner(resp.Body)
+	got := map[string]storage.Change{}
+	for len(got) < 2 && scanner.Scan() {
+		if strings.Contains(scanner.Text(), "s2") {
+			t.Errorf("Expected the sensitive value to be redacted, got %s", scanner.Text())
+		}
+		var c storage.Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("Line is not a JSON change: %q: %v", scanner.Text(), err)
+		}
+		got[c.Variable] = c
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Reading stream failed: %v", err)
+	}
+	if c := got["a"]; c.OldValue != "2" || c.NewValue != "3" {
+		t.Errorf("Expected a: 2 → 3, got %+v", c)
+	}
+	if c := got["server.secret.token"]; !c.Redacted || !c.Changed {
+		t.Errorf("Expected a redacted change flagged as changed, got %+v", c)
+	}
+}
+
+func TestHandleAPIChangesStreamMethodNotAllowed(t *testing.T) {
+	server, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/changes/jsonl/stream", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestParseTimeParam(t *testing.T) {
+	def := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	req := httptest.NewRequest(http.MethodGet, "/?from=2025-02-01T10:00:00Z", nil)
+	got, err := parseTimeParam(req, "from", def)
+	if err != nil || !got.Equal(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseTimeParam(from) = %v, %v", got, err)
+	}
+
+	got, err = parseTimeParam(req, "to", def)
+	if err != nil || !got.Equal(def) {
+		t.Errorf("Expected default for missing param, got %v, %v", got, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/?from=yesterday", nil)
+	if _, err := parseTimeParam(req, "from", def); err == nil {
+		t.Error("Expected error for invalid timestamp")
+	}
+}
+
+func TestHandleAPITopChangesValidation(t *testing.T) {
+	server, err := New(nil, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"unknown cluster", http.MethodGet, "/api/clusters/unknown/top-changes", http.StatusNotFound},
+		{"invalid from", http.MethodGet, "/api/clusters/prod/top-changes?from=bad", http.StatusBadRequest},
+		{"from after to", http.MethodGet, "/api/clusters/prod/top-changes?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/api/clusters/prod/top-changes", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAPITopChanges(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	clusterID := "top-changes-api-" + time.Now().Format("20060102150405.000")
+	snapshots := [][2]string{{"1", "a"}, {"2", "a"}, {"3", "b"}}
+	for _, vals := range snapshots {
+		store.SaveSnapshot(ctx, clusterID, []storage.Setting{
+			{Variable: "top.api.churny", Value: vals[0], SettingType: "s"},
+			{Variable: "top.api.once", Value: vals[1], SettingType: "s"},
+		}, "v1.0")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/clusters/"+clusterID+"/top-changes", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var counts []storage.SettingChangeCount
+	if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(counts) != 2 || counts[0].Variable != "top.api.churny" || counts[0].Count != 2 {
+		t.Errorf("Expected top.api.churny (2 changes) first, got %+v", counts)
+	}
+}
+
+func TestDiffToChanges(t *testing.T) {
+	at := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	before := map[string]storage.Setting{
+		"b.changed": {Variable: "b.changed", Value: "1"},
+		"c.removed": {Variable: "c.removed", Value: "x"},
+		"d.same":    {Variable: "d.same", Value: "y"},
+	}
+	after := map[string]storage.Setting{
+		"a.added":   {Variable: "a.added", Value: "new"},
+		"b.changed": {Variable: "b.changed", Value: "2"},
+		"d.same":    {Variable: "d.same", Value: "y"},
+	}
+
+	changes := diffToChanges("prod", compareSettings(before, after), at)
+
+	want := []storage.Change{
+		{ClusterID: "prod", DetectedAt: at, Variable: "a.added", NewValue: "new"},
+		{ClusterID: "prod", DetectedAt: at, Variable: "b.changed", OldValue: "1", NewValue: "2"},
+		{ClusterID: "prod", DetectedAt: at, Variable: "c.removed", OldValue: "x"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("changes[%d] = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestHandleAPILatestDiffMethodNotAllowed(t *testing.T) {
+	server, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/clusters/prod/latest-diff", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestHandleAPILatestDiff(t *testing.T) {
+	ctx, store, server := setupTest(t)
+	clusterID := "latest-diff-api-" + time.Now().Format("20060102150405.000")
+
+	getDiff := func(t *testing.T) LatestDiffResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/clusters/"+clusterID+"/latest-diff", nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var result LatestDiffResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return result
+	}
+
+	// No snapshots
+	result := getDiff(t)
+	if result.Comparable || result.From != nil || result.To != nil || result.Changes == nil || len(result.Changes) != 0 {
+		t.Errorf("Expected an empty, non-comparable result with no snapshots, got %+v", result)
+	}
+
+	// One snapshot
+	store.SaveSnapshot(ctx, clusterID, []storage.Setting{
+		{Variable: "latest.diff.changed", Value: "1", SettingType: "s"},
+		{Variable: "latest.diff.removed", Value: "x", SettingType: "s"},
+	}, "v1.0")
+	result = getDiff(t)
+	if result.Comparable || result.From != nil || result.To == nil || len(result.Changes) != 0 {
+		t.Errorf("Expected a non-comparable result with one snapshot, got %+v", result)
+	}
+
+	// Two or more snapshots: only the latest two are compared
+	store.SaveSnapshot(ctx, clusterID, []storage.Setting{
+		{Variable: "latest.diff.changed", Value: "2", SettingType: "s"},
+		{Variable: "latest.diff.removed", Value: "x", SettingType: "s"},
+	}, "v1.0")
+	store.SaveSnapshot(ctx, clusterID, []storage.Setting{
+		{Variable: "latest.diff.added", Value: "new", SettingType: "s"},
+		{Variable: "latest.diff.changed", Value: "3", SettingType: "s"},
+	}, "v1.0")
+	result = getDiff(t)
+	if !result.Comparable || result.From == nil || result.To == nil || result.From.ID >= result.To.ID {
+		t.Fatalf("Expected a comparable result spanning the latest two snapshots, got %+v", result)
+	}
+
+	want := map[string][2]string{
+		"latest.diff.added":   {"", "new"},
+		"latest.diff.changed": {"2", "3"},
+		"latest.diff.removed": {"x", ""},
+	}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), result.Changes)
+	}
+	for _, c := range result.Changes {
+		if vals, ok := want[c.Variable]; !ok || c.OldValue != vals[0] || c.NewValue != vals[1] || c.ClusterID != clusterID {
+			t.Errorf("Unexpected change: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"crdb-cluster-history/collector"
+)
+
+// Collectors defines the collection controls exposed by the web server.
+type Collectors interface {
+	Pause(clusterID string) error
+	Resume(clusterID string) error
+	Status() []collector.Status
+	DryRun(ctx context.Context, clusterID string) (*collector.DryRunResult, error)
+	RecentErrors(clusterID string, limit int) ([]collector.CollectionError, error)
+}
+
+// WithCollectors enables the collection control endpoints.
+func WithCollectors(c Collectors) Option {
+	return func(s *Server) {
+		s.collectors = c
+	}
+}
+
+// handleAPICollectors returns the status of every collector as JSON.
+func (s *Server) handleAPICollectors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.collectors == nil {
+		s.jsonError(w, "Collection control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, s.collectors.Status())
+}
+
+// handleCollectorControl handles POST /api/clusters/{id}/pause and /api/clusters/{id}/resume.
+func (s *Server) handleCollectorControl(w http.ResponseWriter, r *http.Request, clusterID, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.collectors == nil {
+		s.jsonError(w, "Collection control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var err error
+	if action == "pause" {
+		err = s.collectors.Pause(clusterID)
+	} else {
+		err = s.collectors.Resume(clusterID)
+	}
+	if errors.Is(err, collector.ErrUnknownCluster) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error changing collector state", "cluster", clusterID, "action", action, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Collector state changed", "cluster", clusterID, "action", action, "user", s.getUsernameFromRequest(r))
+	jsonResponse(w, http.StatusOK, collector.Status{ClusterID: clusterID, Paused: action == "pause"})
+}
+
+// handleCollectorDryRun handles POST /api/clusters/{id}/dry-run, which runs one
+// collection without storing it and returns the settings count and the changes
+// it would record. It is a safe check of connectivity and privileges when
+// onboarding a cluster.
+func (s *Server) handleCollectorDryRun(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.collectors == nil {
+		s.jsonError(w, "Collection control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := s.collectors.DryRun(r.Context(), clusterID)
+	switch {
+	case errors.Is(err, collector.ErrUnknownCluster):
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	case errors.Is(err, collector.ErrSuspiciousCollection):
+		s.jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		slog.Error("Dry-run collection failed", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Collection failed", http.StatusBadGateway)
+		return
+	}
+
+	if s.redactor != nil {
+		result.Changes = s.redactor.RedactChanges(result.Changes)
+	}
+	result.Changes = s.timeFormat.ApplyToChanges(result.Changes)
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// handleCollectorErrors handles GET /api/clusters/{id}/errors, which returns the
+// cluster's most recent collection errors, newest first, so operators can see
+// why collection stopped without reading the server's logs. The errors are kept
+// in memory, so they start afresh when the server restarts.
+func (s *Server) handleCollectorErrors(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.collectors == nil {
+		s.jsonError(w, "Collection control is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			s.jsonError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	recent, err := s.collectors.RecentErrors(clusterID, limit)
+	if errors.Is(err, collector.ErrUnknownCluster) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error getting collection errors", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range recent {
+		recent[i].Time = s.timeFormat.Apply(recent[i].Time)
+	}
+	jsonResponse(w, http.StatusOK, recent)
+}
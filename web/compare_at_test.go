@@ -0,0 +1,152 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPICompareAt(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	save := func(clusterID string, settings []storage.Setting) time.Time {
+		t.Helper()
+		if _, err := store.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		snapshots, err := store.ListSnapshots(ctx, clusterID, 1)
+		if err != nil || len(snapshots) != 1 {
+			t.Fatalf("ListSnapshots = %d snapshots, %v; want 1", len(snapshots), err)
+		}
+		return snapshots[0].CollectedAt
+	}
+
+	prodBefore := save("prod", []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "b", Value: "x"}})
+	stagingFirst := save("staging", []storage.Setting{{Variable: "a", Value: "1"}, {Variable: "c", Value: "y"}})
+	prodAfter := save("prod", []storage.Setting{{Variable: "a", Value: "2"}, {Variable: "b", Value: "x"}})
+
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/compare-at?"+params.Encode(), nil))
+		return w
+	}
+	query := func(cluster1 string, at1 time.Time, cluster2 string, at2 time.Time) url.Values {
+		return url.Values{
+			"cluster1": {cluster1}, "at1": {at1.Format(time.RFC3339Nano)},
+			"cluster2": {cluster2}, "at2": {at2.Format(time.RFC3339Nano)},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		params    url.Values
+		cluster1  []string
+		cluster2  []string
+		different []string
+	}{
+		{
+			name:     "prod before the change matches staging on a",
+			params:   query("prod", prodBefore, "staging", stagingFirst),
+			cluster1: []string{"b"},
+			cluster2: []string{"c"},
+		},
+		{
+			name:      "prod after the change differs from staging on a",
+			params:    query("prod", prodAfter, "staging", prodAfter),
+			cluster1:  []string{"b"},
+			cluster2:  []string{"c"},
+			different: []string{"a"},
+		},
+		{
+			name:      "same cluster at two times",
+			params:    query("prod", prodBefore, "prod", prodAfter),
+			different: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.params)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var result CompareAtResult
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			for _, c := range []struct {
+				name string
+				got  []SettingDiff
+				want []string
+			}{
+				{"cluster1_only", result.Cluster1Only, tt.cluster1},
+				{"cluster2_only", result.Cluster2Only, tt.cluster2},
+				{"different", result.Different, tt.different},
+			} {
+				if len(c.got) != len(c.want) {
+					t.Fatalf("%s = %+v, want %v", c.name, c.got, c.want)
+				}
+				for i := range c.got {
+					if c.got[i].Variable != c.want[i] {
+						t.Errorf("%s[%d] = %q, want %q", c.name, i, c.got[i].Variable, c.want[i])
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("values come from each side's time", func(t *testing.T) {
+		w := get(query("prod", prodAfter, "staging", prodAfter))
+		var result CompareAtResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if len(result.Different) != 1 || result.Different[0].Value1 != "2" || result.Different[0].Value2 != "1" {
+			t.Errorf("different = %+v, want a: 2 vs 1", result.Different)
+		}
+		if result.Cluster1 != "prod" || result.Cluster2 != "staging" || !result.At1.Equal(prodAfter.Truncate(time.Second)) {
+			t.Errorf("result header = %s@%v vs %s, want prod@%v vs staging", result.Cluster1, result.At1, result.Cluster2, prodAfter)
+		}
+	})
+
+	errorTests := []struct {
+		name   string
+		params url.Values
+		status int
+	}{
+		{"missing cluster", url.Values{"cluster1": {"prod"}, "at1": {prodAfter.Format(time.RFC3339)}}, http.StatusBadRequest},
+		{"missing time", url.Values{"cluster1": {"prod"}, "cluster2": {"staging"}}, http.StatusBadRequest},
+		{"bad time", url.Values{"cluster1": {"prod"}, "at1": {"yesterday"}, "cluster2": {"staging"}, "at2": {"today"}}, http.StatusBadRequest},
+		{"same cluster and time", query("prod", prodAfter, "prod", prodAfter), http.StatusBadRequest},
+		{"unknown cluster", query("prod", prodAfter, "nope", prodAfter), http.StatusNotFound},
+		{"before any snapshot", query("prod", prodAfter, "staging", prodBefore.Add(-time.Hour)), http.StatusNotFound},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := get(tt.params); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/compare-at", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", w.Code)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+
+	"crdb-cluster-history/storage"
+)
+
+// DiagnosticsResponse is the JSON response for /api/diagnostics.
+type DiagnosticsResponse struct {
+	Version string `json:"version"`
+	*storage.Diagnostics
+	ClusterStores map[string]*storage.Diagnostics `json:"cluster_stores,omitempty"` // Clusters whose history has its own database
+}
+
+// handleAPIDiagnostics handles GET /api/diagnostics, reporting the storage backend,
+// the applied schema version, and whether each expected table, column, and index
+// exists, so a deployment's state can be checked without inspecting the database.
+func (s *Server) handleAPIDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	primary, err := s.store.Diagnostics(r.Context())
+	if err != nil {
+		slog.Error("Error collecting diagnostics", "error", err)
+		s.jsonError(w, "Failed to collect diagnostics", http.StatusInternalServerError)
+		return
+	}
+	resp := DiagnosticsResponse{Version: s.version, Diagnostics: primary}
+	for clusterID, store := range s.clusterStores {
+		d, err := store.Diagnostics(r.Context())
+		if err != nil {
+			slog.Error("Error collecting diagnostics", "cluster", clusterID, "error", err)
+			s.jsonError(w, "Failed to collect diagnostics", http.StatusInternalServerError)
+			return
+		}
+		if resp.ClusterStores == nil {
+			resp.ClusterStores = make(map[string]*storage.Diagnostics)
+		}
+		resp.ClusterStores[clusterID] = d
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIDiagnostics(t *testing.T) {
+	ctx, _, server := setupTest(t, WithVersion("v1.2.3"))
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diagnostics", nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp DiagnosticsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Version != "v1.2.3" || resp.Backend != storage.BackendCockroachDB {
+		t.Errorf("Expected version v1.2.3 on cockroachdb, got %q on %q", resp.Version, resp.Backend)
+	}
+	if resp.SchemaVersion != storage.LatestSchemaVersion() {
+		t.Errorf("Expected schema version %d, got %d", storage.LatestSchemaVersion(), resp.SchemaVersion)
+	}
+	if !resp.SchemaComplete || len(resp.Objects) == 0 {
+		t.Errorf("Expected every schema object present on a migrated database, got %+v", resp.Objects)
+	}
+}
+
+func TestHandleAPIDiagnosticsFileStore(t *testing.T) {
+	newStore := func() *storage.FileStore {
+		store, err := storage.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore failed: %v", err)
+		}
+		return store
+	}
+	server, err := New(newStore(), WithClusterStores(map[string]Store{"archive": newStore()}))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/diagnostics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp DiagnosticsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Backend != storage.BackendFile || resp.SchemaVersion != 0 || !resp.SchemaComplete {
+		t.Errorf("Expected a file backend with no schema, got %+v", resp.Diagnostics)
+	}
+	if archive := resp.ClusterStores["archive"]; archive == nil || archive.Backend != storage.BackendFile {
+		t.Errorf("Expected diagnostics for the archive cluster's store, got %+v", resp.ClusterStores)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/diagnostics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxConcurrentExports is how many /export requests may run at once.
+// Each streams a cluster's whole change history, so a few are plenty.
+const DefaultMaxConcurrentExports = 2
+
+// exportRetryAfter is the Retry-After sent with an export rejected because the
+// limit was reached.
+const exportRetryAfter = 10 * time.Second
+
+// WithMaxConcurrentExports limits how many /export requests may run at once.
+// Requests beyond the limit get 429 with Retry-After instead of waiting. Zero or
+// less keeps the default.
+func WithMaxConcurrentExports(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.exportSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquireExport takes an export slot, responding with 429 and reporting false
+// if none is free. The caller must call the returned release when done.
+func (s *Server) acquireExport(w http.ResponseWriter) (release func(), ok bool) {
+	select {
+	case s.exportSlots <- struct{}{}:
+		return func() { <-s.exportSlots }, true
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(exportRetryAfter.Seconds())))
+		http.Error(w, "Too many concurrent exports, try again later", http.StatusTooManyRequests)
+		return nil, false
+	}
+}
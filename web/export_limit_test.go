@@ -0,0 +1,71 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+// blockingExportStore holds every StreamChanges call until release is closed.
+type blockingExportStore struct {
+	*storage.FileStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingExportStore) StreamChanges(ctx context.Context, clusterID string, fn func(storage.Change) error) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.FileStore.StreamChanges(ctx, clusterID, fn)
+}
+
+func TestExportConcurrencyLimit(t *testing.T) {
+	fs, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store := &blockingExportStore{FileStore: fs, started: make(chan struct{}), release: make(chan struct{})}
+	const limit = 3
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}), WithMaxConcurrentExports(limit))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	export := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?cluster=prod&format=csv", nil))
+		return w
+	}
+
+	codes := make(chan int, limit)
+	for range limit {
+		go func() { codes <- export().Code }()
+	}
+	for range limit {
+		<-store.started
+	}
+
+	w := export()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected export beyond the limit to get 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	close(store.release)
+	for range limit {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Expected exports within the limit to succeed, got %d", code)
+		}
+	}
+
+	// Slots are returned once exports finish
+	go func() { <-store.started }()
+	if w := export(); w.Code != http.StatusOK {
+		t.Errorf("Expected an export after the others finished to succeed, got %d", w.Code)
+	}
+}
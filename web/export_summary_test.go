@@ -0,0 +1,129 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleExportSummary(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, settings := range [][]storage.Setting{
+		{{Variable: "a", Value: "1"}, {Variable: "b", Value: "1"}},
+		{{Variable: "a", Value: "2"}, {Variable: "c", Value: "1"}},
+		{{Variable: "a", Value: "3"}, {Variable: "c", Value: "1"}},
+	} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v25.3.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	readCSV := func(zr *zip.Reader, name string) [][]string {
+		t.Helper()
+		f, err := zr.Open(name)
+		if err != nil {
+			t.Fatalf("Missing %s: %v", name, err)
+		}
+		defer f.Close()
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		return rows
+	}
+
+	w := get("/export?summary=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	rows := readCSV(zr, "crdb-cluster-history-prod.csv")[1:]
+	summary := make(map[string]string)
+	for _, row := range readCSV(zr, "crdb-cluster-history-prod-summary.csv")[1:] {
+		summary[row[0]] = row[1]
+	}
+
+	// Recount the exported rows: a, b and c changed; b was removed, c added and
+	// a modified twice.
+	variables := make(map[string]bool)
+	kinds := make(map[string]int)
+	first, last := rows[0][1], rows[0][1]
+	for _, row := range rows {
+		variables[row[2]] = true
+		switch {
+		case row[4] == "":
+			kinds["added"]++
+		case row[5] == "":
+			kinds["removed"]++
+		default:
+			kinds["modified"]++
+		}
+		first, last = min(first, row[1]), max(last, row[1])
+	}
+	want := map[string]string{
+		"total_changes":      strconv.Itoa(len(rows)),
+		"distinct_variables": strconv.Itoa(len(variables)),
+		"first_detected_at":  first,
+		"last_detected_at":   last,
+		"added":              strconv.Itoa(kinds["added"]),
+		"removed":            strconv.Itoa(kinds["removed"]),
+		"modified":           strconv.Itoa(kinds["modified"]),
+	}
+	if len(rows) != 4 || kinds["added"] != 1 || kinds["removed"] != 1 || kinds["modified"] != 2 {
+		t.Fatalf("Unexpected exported rows: %v", rows)
+	}
+	for metric, value := range want {
+		if summary[metric] != value {
+			t.Errorf("%s: expected %q, got %q", metric, value, summary[metric])
+		}
+	}
+
+	// Without the parameter the archive has no summary
+	w = get("/export")
+	zr, err = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "-summary.csv") {
+			t.Errorf("Unexpected summary %s without summary=true", f.Name)
+		}
+	}
+
+	// The CSV alone stays purely data
+	w = get("/export?format=csv&summary=true")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a summary outside the zip, got %d", w.Code)
+	}
+	w = get("/export?summary=maybe")
+	if body, _ := io.ReadAll(w.Body); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid summary, got %d: %s", w.Code, body)
+	}
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+// WithFilterPresets sets the named variable globs offered as quick filters on the
+// changes dashboard. Selecting one with ?preset=<name> shows only the changes to
+// matching variables.
+func WithFilterPresets(presets []config.FilterPreset) Option {
+	return func(s *Server) {
+		s.filterPresets = presets
+	}
+}
+
+// presetLink is a quick-filter button on the changes dashboard.
+type presetLink struct {
+	Name   string
+	URL    string
+	Active bool
+}
+
+// selectedPreset returns the preset named by the preset query parameter, or nil
+// when none is selected.
+func (s *Server) selectedPreset(r *http.Request) (*config.FilterPreset, error) {
+	name := r.URL.Query().Get("preset")
+	if name == "" {
+		return nil, nil
+	}
+	for i := range s.filterPresets {
+		if s.filterPresets[i].Name == name {
+			return &s.filterPresets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown filter preset: %s", name)
+}
+
+// filterByPreset keeps the changes whose variable matches one of the preset's globs.
+func filterByPreset(changes []storage.ChangeWithAnnotation, preset config.FilterPreset) []storage.ChangeWithAnnotation {
+	kept := make([]storage.ChangeWithAnnotation, 0, len(changes))
+	for _, c := range changes {
+		for _, p := range preset.Variables {
+			if storage.MatchGlob(p, c.Variable) {
+				kept = append(kept, c)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// presetLinks builds the dashboard's quick-filter buttons: one clearing the
+// filter, then one per preset. Each keeps the request's other query parameters,
+// such as the cluster. It returns nil when no presets are configured.
+func (s *Server) presetLinks(r *http.Request, selected *config.FilterPreset) []presetLink {
+	if len(s.filterPresets) == 0 {
+		return nil
+	}
+	link := func(name string) string {
+		q := r.URL.Query()
+		if name == "" {
+			q.Del("preset")
+		} else {
+			q.Set("preset", name)
+		}
+		if len(q) == 0 {
+			return r.URL.Path
+		}
+		return r.URL.Path + "?" + q.Encode()
+	}
+	links := []presetLink{{Name: "All", URL: link(""), Active: selected == nil}}
+	for _, p := range s.filterPresets {
+		links = append(links, presetLink{Name: p.Name, URL: link(p.Name), Active: selected != nil && selected.Name == p.Name})
+	}
+	return links
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleIndexFilterPresets(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, v := range []string{"1", "2"} {
+		settings := []storage.Setting{
+			{Variable: "sql.defaults.distsql", Value: v},
+			{Variable: "kv.rangefeed.enabled", Value: v},
+			{Variable: "server.time_until_store_dead", Value: v},
+		}
+		if _, err := store.SaveSnapshotWithChanges(ctx, "default", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store, WithDefaultClusterID("default"), WithFilterPresets([]config.FilterPreset{
+		{Name: "SQL & KV", Variables: []string{"sql.defaults.*", "KV.rangefeed.*"}},
+		{Name: "Server", Variables: []string{"server.*"}},
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/dashboard?cluster=default&preset=SQL+%26+KV")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, variable := range []string{"sql.defaults.distsql", "kv.rangefeed.enabled"} {
+		if !strings.Contains(body, variable) {
+			t.Errorf("Expected %s in the filtered changes", variable)
+		}
+	}
+	if strings.Contains(body, "server.time_until_store_dead") {
+		t.Error("Expected server.time_until_store_dead to be filtered out")
+	}
+	if !strings.Contains(body, `href="/dashboard?cluster=default&amp;preset=Server" class="btn btn-outline">Server</a>`) {
+		t.Error("Expected a link to the Server preset keeping the cluster")
+	}
+	if !strings.Contains(body, `href="/dashboard?cluster=default" class="btn btn-outline">All</a>`) {
+		t.Error("Expected an All link clearing the preset")
+	}
+
+	if body := get("/dashboard").Body.String(); !strings.Contains(body, "server.time_until_store_dead") {
+		t.Error("Expected every change without a preset selected")
+	}
+
+	if w := get("/dashboard?preset=nope"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown preset, got %d", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// StaleAfterIntervals is how many poll intervals may pass since the latest
+// snapshot before a cluster's history is reported as stale.
+const StaleAfterIntervals = 2
+
+// FreshnessResult reports how current a cluster's stored history is.
+type FreshnessResult struct {
+	ClusterID           string     `json:"cluster_id"`
+	LatestSnapshotAt    *time.Time `json:"latest_snapshot_at"` // nil if nothing has been collected
+	AgeSeconds          int64      `json:"age_seconds"`        // Time since the latest snapshot (0 if none)
+	PollIntervalSeconds int64      `json:"poll_interval_seconds"`
+	Stale               bool       `json:"stale"` // No snapshot, or none within StaleAfterIntervals intervals
+}
+
+// handleAPIFreshness handles GET /api/clusters/{id}/freshness, a cheap trust signal
+// for how old the latest snapshot is. It never triggers a collection.
+func (s *Server) handleAPIFreshness(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	snapshots, err := s.storeFor(clusterID).ListSnapshots(r.Context(), clusterID, 1)
+	if err != nil {
+		slog.Error("Error listing snapshots", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	// The configured interval wins; the one recorded with the snapshot covers
+	// servers that were not told it.
+	interval := s.pollInterval
+	if interval <= 0 && len(snapshots) > 0 {
+		interval = time.Duration(snapshots[0].PollIntervalSeconds) * time.Second
+	}
+
+	result := FreshnessResult{
+		ClusterID:           clusterID,
+		PollIntervalSeconds: int64(interval / time.Second),
+		Stale:               true,
+	}
+	if len(snapshots) > 0 {
+		collectedAt := snapshots[0].CollectedAt
+		age := time.Since(collectedAt)
+		result.AgeSeconds = int64(age / time.Second)
+		result.Stale = interval > 0 && age > StaleAfterIntervals*interval
+		collectedAt = s.timeFormat.Apply(collectedAt)
+		result.LatestSnapshotAt = &collectedAt
+	}
+
+	jsonResponse(w, http.StatusOK, result)
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIFreshness(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	settings := []storage.Setting{{Variable: "a.b", Value: "1"}}
+	if _, err := store.SaveCollectedSnapshot(context.Background(), "prod", settings, "v1.0", "", time.Hour, "", nil); err != nil {
+		t.Fatalf("SaveCollectedSnapshot failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production"}, {ID: "empty", Name: "Empty"}}
+
+	tests := []struct {
+		name         string
+		cluster      string
+		pollInterval time.Duration
+		wantInterval int64
+		wantStale    bool
+		wantSnapshot bool
+	}{
+		{"fresh", "prod", time.Hour, 3600, false, true},
+		{"stale", "prod", time.Millisecond, 0, true, true},
+		{"interval recorded with the snapshot", "prod", 0, 3600, false, true},
+		{"never collected", "empty", time.Hour, 3600, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(store, WithClusters(clusters), WithDefaultClusterID("prod"), WithPollInterval(tt.pollInterval))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters/"+tt.cluster+"/freshness", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var got FreshnessResult
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			if got.ClusterID != tt.cluster || got.Stale != tt.wantStale || got.PollIntervalSeconds != tt.wantInterval {
+				t.Errorf("Unexpected freshness: %+v", got)
+			}
+			if (got.LatestSnapshotAt != nil) != tt.wantSnapshot {
+				t.Errorf("Expected latest_snapshot_at present = %v, got %v", tt.wantSnapshot, got.LatestSnapshotAt)
+			}
+		})
+	}
+
+	server, err := New(store, WithClusters(clusters), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters/unknown/freshness", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown cluster, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/clusters/prod/freshness", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
@@ -0,0 +1,698 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+// graphqlMaxDepth bounds how deeply a GraphQL query may nest, so a single
+// request cannot fan out into an unbounded number of store reads.
+const graphqlMaxDepth = 6
+
+// graphqlMaxSnapshotLoads bounds how many snapshots' settings one GraphQL request
+// may load. Depth does not limit breadth, and each load is a store read, so a
+// single snapshots query could otherwise read up to MaxSnapshots snapshots.
+const graphqlMaxSnapshotLoads = 10
+
+// graphqlSchema describes the data /graphql serves: the same clusters, changes,
+// snapshots, comparisons and annotations as the REST API. Timestamps are
+// strings rendered in the configured timestamp format, and int64 IDs are IDs.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	clusters: [Cluster!]!
+	# Most recent changes first. variable is a case-insensitive glob such as
+	# "sql.*", as in the REST API; filters apply to the newest changes, as many
+	# as the largest limit accepted.
+	changes(cluster: String, variable: String, limit: Int): [Change!]!
+	snapshots(cluster: String, limit: Int): [Snapshot!]!
+	# A snapshot looked up by ID has only its id and settings. The settings of
+	# at most 10 snapshots can be loaded per request.
+	#
+	# IDs are only unique within one history store. With several stores, pass
+	# the cluster an ID belongs to; without it, an ID more than one store holds
+	# is an error.
+	snapshot(id: ID!, cluster: String): Snapshot
+	compare(cluster1: String!, cluster2: String!): Comparison!
+	annotations(severity: String, limit: Int): [Annotation!]!
+	annotation(id: ID!, cluster: String): Annotation
+}
+
+type Mutation {
+	createAnnotation(changeId: ID!, content: String!, severity: String, cluster: String): Annotation!
+	updateAnnotation(id: ID!, content: String!, severity: String, cluster: String): Annotation!
+	deleteAnnotation(id: ID!, cluster: String): Boolean!
+}
+
+type Cluster {
+	id: String!
+	name: String!
+	environment: String!
+	region: String!
+	color: String!
+}
+
+type Change {
+	id: ID!
+	clusterId: String!
+	detectedAt: String!
+	variable: String!
+	oldValue: String!
+	newValue: String!
+	description: String!
+	version: String!
+	redacted: Boolean!
+	annotation: Annotation
+}
+
+type Snapshot {
+	id: ID!
+	clusterId: String!
+	collectedAt: String!
+	label: String!
+	settings(variable: String): [Setting!]!
+}
+
+type Setting {
+	variable: String!
+	value: String!
+	settingType: String!
+	description: String!
+	defaultValue: String!
+}
+
+type Comparison {
+	cluster1Only: [SettingDiff!]!
+	cluster2Only: [SettingDiff!]!
+	different: [SettingDiff!]!
+	excludedCount: Int!
+}
+
+type SettingDiff {
+	variable: String!
+	value1: String!
+	value2: String!
+	settingType: String!
+	description: String!
+}
+
+type Annotation {
+	id: ID!
+	changeId: ID!
+	content: String!
+	severity: String!
+	createdBy: String!
+	createdAt: String!
+	updatedBy: String!
+	updatedAt: String!
+}
+`
+
+// errGraphQLInternal is reported for store failures, which are logged instead
+// of being shown to the client.
+var errGraphQLInternal = errors.New("internal server error")
+
+// WithGraphQL serves the /graphql endpoint. It is off by default.
+func WithGraphQL(enabled bool) Option {
+	return func(s *Server) {
+		s.graphqlEnabled = enabled
+	}
+}
+
+// newGraphQLSchema parses the schema with resolvers backed by the server's stores.
+func newGraphQLSchema(s *Server) (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &gqlResolver{s: s}, graphql.MaxDepth(graphqlMaxDepth))
+}
+
+// graphqlRequest is the JSON body of a POST /graphql request.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// usernameKey carries the requesting user to the annotation mutations.
+type usernameKey struct{}
+
+// snapshotLoadsKey carries the count of snapshots whose settings a request has
+// loaded, an *atomic.Int32 since list fields resolve concurrently.
+type snapshotLoadsKey struct{}
+
+// handleGraphQL executes a GraphQL query or mutation sent as a JSON POST body.
+// It is not found unless enabled.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if s.graphql == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req graphqlRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		s.jsonError(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), usernameKey{}, s.getUsernameFromRequest(r))
+	ctx = context.WithValue(ctx, snapshotLoadsKey{}, new(atomic.Int32))
+	jsonResponse(w, http.StatusOK, s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// gqlResolver resolves the Query and Mutation root fields.
+type gqlResolver struct {
+	s *Server
+}
+
+// clusterID validates an optional cluster argument as getClusterID does.
+func (q *gqlResolver) clusterID(cluster *string) (string, error) {
+	if cluster == nil || *cluster == "" {
+		return q.s.defaultClusterID, nil
+	}
+	if !config.IsValidHistoryID(*cluster) {
+		return "", errInvalidClusterID
+	}
+	if !q.s.isValidCluster(*cluster) {
+		return "", errUnknownCluster
+	}
+	return *cluster, nil
+}
+
+// lookupCluster validates the cluster argument scoping a lookup by ID, returning
+// "" when it is absent so the lookup tries every store.
+func (q *gqlResolver) lookupCluster(cluster *string) (string, error) {
+	if cluster == nil || *cluster == "" {
+		return "", nil
+	}
+	return q.clusterID(cluster)
+}
+
+// limitArg returns limit when it is within 1..max, or def.
+func limitArg(limit *int32, def, max int) int {
+	if limit != nil && *limit > 0 && int(*limit) <= max {
+		return int(*limit)
+	}
+	return def
+}
+
+// parseID parses a GraphQL ID holding an int64.
+func parseID(id graphql.ID, what string) (int64, error) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", what, id)
+	}
+	return n, nil
+}
+
+func (q *gqlResolver) internal(msg string, err error) error {
+	if errors.Is(err, errAmbiguousID) {
+		return err // the client can repeat the query with the cluster
+	}
+	slog.Error(msg, "error", err)
+	return errGraphQLInternal
+}
+
+func (q *gqlResolver) Clusters(ctx context.Context) ([]*gqlCluster, error) {
+	if len(q.s.clusters) == 0 {
+		ids, err := q.s.store.ListClustersWithPrefix(ctx, "", 0)
+		if err != nil {
+			return nil, q.internal("Error listing clusters", err)
+		}
+		clusters := make([]*gqlCluster, len(ids))
+		for i, id := range ids {
+			clusters[i] = &gqlCluster{ClusterInfo{ID: id, Name: id}}
+		}
+		return clusters, nil
+	}
+	clusters := make([]*gqlCluster, len(q.s.clusters))
+	for i, c := range q.s.clusters {
+		clusters[i] = &gqlCluster{ClusterInfo{ID: c.ID, Name: c.Name, Environment: c.Environment, Region: c.Region, Color: c.Color}}
+	}
+	return clusters, nil
+}
+
+func (q *gqlResolver) Changes(ctx context.Context, args struct {
+	Cluster  *string
+	Variable *string
+	Limit    *int32
+}) ([]*gqlChange, error) {
+	clusterID, err := q.clusterID(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	limit := limitArg(args.Limit, q.s.limits.PageSize, q.s.limits.MaxChanges)
+	pattern := ""
+	if args.Variable != nil {
+		pattern = *args.Variable
+	}
+	fetch := limit
+	if pattern != "" {
+		fetch = q.s.limits.MaxChanges
+	}
+
+	changes, err := q.s.storeFor(clusterID).GetChangesWithAnnotations(ctx, clusterID, fetch)
+	if err != nil {
+		return nil, q.internal("Error getting changes", err)
+	}
+	result := []*gqlChange{}
+	for _, c := range changes {
+		if len(result) == limit {
+			break
+		}
+		if pattern != "" {
+			if !storage.MatchGlob(pattern, c.Variable) {
+				continue
+			}
+		}
+		if q.s.redactor != nil {
+			c.Change = q.s.redactor.RedactChange(c.Change)
+		}
+		result = append(result, &gqlChange{s: q.s, c: c})
+	}
+	return result, nil
+}
+
+func (q *gqlResolver) Snapshots(ctx context.Context, args struct {
+	Cluster *string
+	Limit   *int32
+}) ([]*gqlSnapshot, error) {
+	clusterID, err := q.clusterID(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := q.s.storeFor(clusterID).ListSnapshots(ctx, clusterID, limitArg(args.Limit, q.s.limits.SnapshotPageSize, q.s.limits.MaxSnapshots))
+	if err != nil {
+		return nil, q.internal("Error listing snapshots", err)
+	}
+	result := make([]*gqlSnapshot, len(infos))
+	for i, info := range infos {
+		result[i] = &gqlSnapshot{s: q.s, info: info}
+	}
+	return result, nil
+}
+
+func (q *gqlResolver) Snapshot(ctx context.Context, args struct {
+	ID      graphql.ID
+	Cluster *string
+}) (*gqlSnapshot, error) {
+	id, err := parseID(args.ID, "snapshot")
+	if err != nil {
+		return nil, err
+	}
+	clusterID, err := q.lookupCluster(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := countSnapshotLoad(ctx); err != nil {
+		return nil, err
+	}
+	settings, err := q.s.getSnapshotByID(ctx, clusterID, id)
+	if err != nil {
+		return nil, q.internal("Error getting snapshot", err)
+	}
+	if settings == nil {
+		return nil, nil
+	}
+	return &gqlSnapshot{s: q.s, info: storage.SnapshotInfo{ID: id, ClusterID: clusterID}, settings: settings}, nil
+}
+
+func (q *gqlResolver) Compare(ctx context.Context, args struct{ Cluster1, Cluster2 string }) (*gqlComparison, error) {
+	if args.Cluster1 == args.Cluster2 {
+		return nil, errors.New("cluster1 and cluster2 must be different")
+	}
+	for _, c := range []string{args.Cluster1, args.Cluster2} {
+		if _, err := q.clusterID(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.s.compareTimeout)
+	defer cancel()
+	settings1, err := q.s.latestSnapshot(ctx, args.Cluster1)
+	if err != nil {
+		return nil, q.internal("Failed to get settings for cluster1", err)
+	}
+	settings2, err := q.s.latestSnapshot(ctx, args.Cluster2)
+	if err != nil {
+		return nil, q.internal("Failed to get settings for cluster2", err)
+	}
+	if total := len(settings1) + len(settings2); total > q.s.maxCompare {
+		return nil, fmt.Errorf("comparison too large: %d settings exceeds the limit of %d", total, q.s.maxCompare)
+	}
+
+	diff, excluded := excludeExpected(compareSettings(settings1, settings2), q.s.expectedDiffs)
+	if q.s.redactor != nil {
+		for _, bucket := range [][]SettingDiff{diff.OnlyInA, diff.OnlyInB, diff.Different} {
+			for i, d := range bucket {
+				bucket[i].Value1 = redactNonEmpty(q.s.redactor, d.Variable, d.Value1)
+				bucket[i].Value2 = redactNonEmpty(q.s.redactor, d.Variable, d.Value2)
+				bucket[i].Description = q.s.redactor.RedactDescription(d.Variable, d.Description)
+			}
+		}
+	}
+	return &gqlComparison{diff: diff, excluded: excluded}, nil
+}
+
+func (q *gqlResolver) Annotations(ctx context.Context, args struct {
+	Severity *string
+	Limit    *int32
+}) ([]*gqlAnnotation, error) {
+	severity := ""
+	if args.Severity != nil {
+		severity = *args.Severity
+	}
+	if severity != "" && !storage.IsValidSeverity(severity) {
+		return nil, errors.New(msgInvalidSeverity)
+	}
+	annotations, err := q.s.recentAnnotations(ctx, severity, limitArg(args.Limit, q.s.limits.PageSize, q.s.limits.MaxChanges))
+	if err != nil {
+		return nil, q.internal("Error listing annotations", err)
+	}
+	result := make([]*gqlAnnotation, len(annotations))
+	for i := range annotations {
+		result[i] = &gqlAnnotation{s: q.s, a: &annotations[i]}
+	}
+	return result, nil
+}
+
+func (q *gqlResolver) Annotation(ctx context.Context, args struct {
+	ID      graphql.ID
+	Cluster *string
+}) (*gqlAnnotation, error) {
+	id, err := parseID(args.ID, "annotation")
+	if err != nil {
+		return nil, err
+	}
+	clusterID, err := q.lookupCluster(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	ann, _, err := q.s.findAnnotation(ctx, clusterID, id)
+	if err != nil {
+		return nil, q.internal("Error getting annotation", err)
+	}
+	if ann == nil {
+		return nil, nil
+	}
+	return &gqlAnnotation{s: q.s, a: ann}, nil
+}
+
+func (q *gqlResolver) CreateAnnotation(ctx context.Context, args struct {
+	ChangeID graphql.ID
+	Content  string
+	Severity *string
+	Cluster  *string
+}) (*gqlAnnotation, error) {
+	changeID, err := parseID(args.ChangeID, "change")
+	if err != nil {
+		return nil, err
+	}
+	clusterID, err := q.lookupCluster(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Content) == "" {
+		return nil, errors.New("content is required")
+	}
+	severity := storage.SeverityInfo
+	if args.Severity != nil && *args.Severity != "" {
+		severity = *args.Severity
+	}
+	if !storage.IsValidSeverity(severity) {
+		return nil, errors.New(msgInvalidSeverity)
+	}
+
+	username, _ := ctx.Value(usernameKey{}).(string)
+	store, err := q.s.storeForChange(ctx, clusterID, changeID)
+	if err != nil {
+		return nil, q.internal("Error finding change", err)
+	}
+	ann, err := store.CreateAnnotation(ctx, changeID, args.Content, severity, username)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation:
+			return nil, errors.New("change not found")
+		case errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation:
+			return nil, errors.New("annotation already exists for this change")
+		case errors.Is(err, storage.ErrNotSupported):
+			return nil, errors.New("annotations are not supported by file storage")
+		}
+		return nil, q.internal("Error creating annotation", err)
+	}
+	return &gqlAnnotation{s: q.s, a: ann}, nil
+}
+
+func (q *gqlResolver) UpdateAnnotation(ctx context.Context, args struct {
+	ID       graphql.ID
+	Content  string
+	Severity *string
+	Cluster  *string
+}) (*gqlAnnotation, error) {
+	id, err := parseID(args.ID, "annotation")
+	if err != nil {
+		return nil, err
+	}
+	clusterID, err := q.lookupCluster(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Content) == "" {
+		return nil, errors.New("content is required")
+	}
+	severity := ""
+	if args.Severity != nil {
+		severity = *args.Severity
+	}
+	if severity != "" && !storage.IsValidSeverity(severity) {
+		return nil, errors.New(msgInvalidSeverity)
+	}
+
+	username, _ := ctx.Value(usernameKey{}).(string)
+	_, store, err := q.s.findAnnotation(ctx, clusterID, id)
+	if err == nil {
+		err = store.UpdateAnnotation(ctx, id, args.Content, severity, username)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("annotation not found")
+		}
+		return nil, q.internal("Error updating annotation", err)
+	}
+	ann, err := store.GetAnnotation(ctx, id)
+	if err != nil || ann == nil {
+		return nil, q.internal("Error getting updated annotation", err)
+	}
+	return &gqlAnnotation{s: q.s, a: ann}, nil
+}
+
+func (q *gqlResolver) DeleteAnnotation(ctx context.Context, args struct {
+	ID      graphql.ID
+	Cluster *string
+}) (bool, error) {
+	id, err := parseID(args.ID, "annotation")
+	if err != nil {
+		return false, err
+	}
+	clusterID, err := q.lookupCluster(args.Cluster)
+	if err != nil {
+		return false, err
+	}
+	_, store, err := q.s.findAnnotation(ctx, clusterID, id)
+	if err == nil {
+		err = store.DeleteAnnotation(ctx, id)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, errors.New("annotation not found")
+		}
+		return false, q.internal("Error deleting annotation", err)
+	}
+	return true, nil
+}
+
+// gqlCluster resolves a Cluster from the cluster list entry.
+type gqlCluster struct {
+	c ClusterInfo
+}
+
+func (c *gqlCluster) ID() string          { return c.c.ID }
+func (c *gqlCluster) Name() string        { return c.c.Name }
+func (c *gqlCluster) Environment() string { return c.c.Environment }
+func (c *gqlCluster) Region() string      { return c.c.Region }
+func (c *gqlCluster) Color() string       { return c.c.Color }
+
+// gqlChange resolves a Change, already redacted.
+type gqlChange struct {
+	s *Server
+	c storage.ChangeWithAnnotation
+}
+
+func (c *gqlChange) ID() graphql.ID      { return graphql.ID(strconv.FormatInt(c.c.ID, 10)) }
+func (c *gqlChange) ClusterID() string   { return c.c.ClusterID }
+func (c *gqlChange) DetectedAt() string  { return c.s.timeFormat.Format(c.c.DetectedAt) }
+func (c *gqlChange) Variable() string    { return c.c.Variable }
+func (c *gqlChange) OldValue() string    { return c.c.OldValue }
+func (c *gqlChange) NewValue() string    { return c.c.NewValue }
+func (c *gqlChange) Description() string { return c.c.Description }
+func (c *gqlChange) Version() string     { return c.c.Version }
+func (c *gqlChange) Redacted() bool      { return c.c.Redacted }
+
+func (c *gqlChange) Annotation() *gqlAnnotation {
+	if c.c.Annotation == nil {
+		return nil
+	}
+	return &gqlAnnotation{s: c.s, a: c.c.Annotation}
+}
+
+// gqlSnapshot resolves a Snapshot. Its settings are loaded on first use, unless
+// the snapshot was looked up by ID with them.
+type gqlSnapshot struct {
+	s        *Server
+	info     storage.SnapshotInfo
+	settings map[string]storage.Setting
+}
+
+func (sn *gqlSnapshot) ID() graphql.ID      { return graphql.ID(strconv.FormatInt(sn.info.ID, 10)) }
+func (sn *gqlSnapshot) ClusterID() string   { return sn.info.ClusterID }
+func (sn *gqlSnapshot) CollectedAt() string { return sn.s.formatOptionalTime(sn.info.CollectedAt) }
+func (sn *gqlSnapshot) Label() string       { return sn.info.Label }
+
+func (sn *gqlSnapshot) Settings(ctx context.Context, args struct{ Variable *string }) ([]*gqlSetting, error) {
+	if sn.settings == nil {
+		if err := countSnapshotLoad(ctx); err != nil {
+			return nil, err
+		}
+		settings, err := sn.s.getSnapshotByID(ctx, sn.info.ClusterID, sn.info.ID)
+		if errors.Is(err, errAmbiguousID) {
+			return nil, err
+		}
+		if err != nil {
+			slog.Error("Error getting snapshot settings", "snapshot", sn.info.ID, "error", err)
+			return nil, errGraphQLInternal
+		}
+		sn.settings = settings
+	}
+	pattern := ""
+	if args.Variable != nil {
+		pattern = *args.Variable
+	}
+	result := []*gqlSetting{}
+	for _, setting := range sn.settings {
+		if pattern != "" {
+			if !storage.MatchGlob(pattern, setting.Variable) {
+				continue
+			}
+		}
+		if sn.s.redactor != nil {
+			setting.Value = redactNonEmpty(sn.s.redactor, setting.Variable, setting.Value)
+			setting.DefaultValue = redactNonEmpty(sn.s.redactor, setting.Variable, setting.DefaultValue)
+			setting.Description = sn.s.redactor.RedactDescription(setting.Variable, setting.Description)
+		}
+		result = append(result, &gqlSetting{setting})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].st.Variable < result[j].st.Variable })
+	return result, nil
+}
+
+// countSnapshotLoad counts a snapshot whose settings the request is about to load,
+// returning an error once it would exceed graphqlMaxSnapshotLoads.
+func countSnapshotLoad(ctx context.Context) error {
+	loads, ok := ctx.Value(snapshotLoadsKey{}).(*atomic.Int32)
+	if ok && loads.Add(1) > graphqlMaxSnapshotLoads {
+		return fmt.Errorf("settings can be loaded for at most %d snapshots per request", graphqlMaxSnapshotLoads)
+	}
+	return nil
+}
+
+// gqlSetting resolves a Setting.
+type gqlSetting struct {
+	st storage.Setting
+}
+
+func (st *gqlSetting) Variable() string     { return st.st.Variable }
+func (st *gqlSetting) Value() string        { return st.st.Value }
+func (st *gqlSetting) SettingType() string  { return st.st.SettingType }
+func (st *gqlSetting) Description() string  { return st.st.Description }
+func (st *gqlSetting) DefaultValue() string { return st.st.DefaultValue }
+
+// gqlComparison resolves a Comparison from the diff /api/compare responds with.
+type gqlComparison struct {
+	diff     diffResult
+	excluded int
+}
+
+func (c *gqlComparison) Cluster1Only() []*gqlSettingDiff { return gqlDiffs(c.diff.OnlyInA) }
+func (c *gqlComparison) Cluster2Only() []*gqlSettingDiff { return gqlDiffs(c.diff.OnlyInB) }
+func (c *gqlComparison) Different() []*gqlSettingDiff    { return gqlDiffs(c.diff.Different) }
+func (c *gqlComparison) ExcludedCount() int32            { return int32(c.excluded) }
+
+// gqlSettingDiff resolves a SettingDiff.
+type gqlSettingDiff struct {
+	d SettingDiff
+}
+
+func (d *gqlSettingDiff) Variable() string    { return d.d.Variable }
+func (d *gqlSettingDiff) Value1() string      { return d.d.Value1 }
+func (d *gqlSettingDiff) Value2() string      { return d.d.Value2 }
+func (d *gqlSettingDiff) SettingType() string { return d.d.SettingType }
+func (d *gqlSettingDiff) Description() string { return d.d.Description }
+
+func gqlDiffs(diffs []SettingDiff) []*gqlSettingDiff {
+	result := make([]*gqlSettingDiff, len(diffs))
+	for i, d := range diffs {
+		result[i] = &gqlSettingDiff{d}
+	}
+	return result
+}
+
+// gqlAnnotation resolves an Annotation, formatted as AnnotationResponse is.
+type gqlAnnotation struct {
+	s *Server
+	a *storage.Annotation
+}
+
+func (a *gqlAnnotation) ID() graphql.ID       { return graphql.ID(strconv.FormatInt(a.a.ID, 10)) }
+func (a *gqlAnnotation) ChangeID() graphql.ID { return graphql.ID(strconv.FormatInt(a.a.ChangeID, 10)) }
+func (a *gqlAnnotation) Content() string      { return a.a.Content }
+func (a *gqlAnnotation) Severity() string     { return a.a.Severity }
+func (a *gqlAnnotation) CreatedBy() string    { return a.a.CreatedBy }
+func (a *gqlAnnotation) CreatedAt() string    { return a.s.timeFormat.Format(a.a.CreatedAt) }
+func (a *gqlAnnotation) UpdatedBy() string    { return a.a.UpdatedBy }
+func (a *gqlAnnotation) UpdatedAt() string    { return a.s.formatOptionalTime(a.a.UpdatedAt) }
+
+// formatOptionalTime formats t, leaving a zero time empty: a snapshot looked up
+// by ID has no collection time, and an annotation never updated no update time.
+func (s *Server) formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return s.timeFormat.Format(t)
+}
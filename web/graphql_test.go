@@ -0,0 +1,280 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// mutableAnnotationStore keeps annotations in memory over a file store, which
+// has none.
+type mutableAnnotationStore struct {
+	*storage.FileStore
+	annotations map[int64]*storage.Annotation
+}
+
+func (s *mutableAnnotationStore) CreateAnnotation(ctx context.Context, changeID int64, content, severity, createdBy string) (*storage.Annotation, error) {
+	ann := &storage.Annotation{ID: int64(len(s.annotations) + 1), ChangeID: changeID, Content: content, Severity: severity, CreatedBy: createdBy, CreatedAt: time.Now()}
+	s.annotations[ann.ID] = ann
+	return ann, nil
+}
+
+func (s *mutableAnnotationStore) GetAnnotation(ctx context.Context, id int64) (*storage.Annotation, error) {
+	return s.annotations[id], nil
+}
+
+func (s *mutableAnnotationStore) UpdateAnnotation(ctx context.Context, id int64, content, severity, updatedBy string) error {
+	ann, ok := s.annotations[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	ann.Content = content
+	if severity != "" {
+		ann.Severity = severity
+	}
+	return nil
+}
+
+func newGraphQLTestServer(t *testing.T, opts ...Option) (*Server, *mutableAnnotationStore) {
+	t.Helper()
+	ctx := context.Background()
+	fs, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for cluster, saves := range map[string][][]storage.Setting{
+		"prod": {
+			{{Variable: "sql.a", Value: "1"}, {Variable: "kv.b", Value: "1"}},
+			{{Variable: "sql.a", Value: "2"}, {Variable: "kv.b", Value: "2"}},
+		},
+		"staging": {
+			{{Variable: "sql.a", Value: "3"}, {Variable: "kv.b", Value: "2"}},
+		},
+	} {
+		for _, settings := range saves {
+			if _, err := fs.SaveSnapshotWithChanges(ctx, cluster, settings, "v25.4.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+	}
+	store := &mutableAnnotationStore{FileStore: fs, annotations: map[int64]*storage.Annotation{}}
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production", Environment: "production"}, {ID: "staging", Name: "Staging"}}
+	server, err := New(store, append([]Option{WithClusters(clusters), WithDefaultClusterID("prod")}, opts...)...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return server, store
+}
+
+// graphqlResponse is a GraphQL response with data decoded into T.
+type graphqlResponse[T any] struct {
+	Data   T `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL[T any](t *testing.T, server *Server, query string, variables map[string]any) graphqlResponse[T] {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.SetBasicAuth("alice", "")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp graphqlResponse[T]
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v: %s", err, w.Body.String())
+	}
+	return resp
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	server, _ := newGraphQLTestServer(t, WithGraphQL(true))
+
+	// Clusters and their changes in one round trip, with only the fields asked for
+	resp := postGraphQL[struct {
+		Clusters []map[string]any `json:"clusters"`
+		Changes  []map[string]any `json:"changes"`
+	}](t, server, `{
+		clusters { id name environment }
+		changes(cluster: "prod", variable: "sql.*") { id variable oldValue newValue }
+	}`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", resp.Errors)
+	}
+	if len(resp.Data.Clusters) != 2 || resp.Data.Clusters[0]["name"] != "Production" || resp.Data.Clusters[0]["environment"] != "production" {
+		t.Errorf("Unexpected clusters: %+v", resp.Data.Clusters)
+	}
+	if len(resp.Data.Changes) != 1 {
+		t.Fatalf("Expected one sql.* change, got %+v", resp.Data.Changes)
+	}
+	if c := resp.Data.Changes[0]; c["variable"] != "sql.a" || c["oldValue"] != "1" || c["newValue"] != "2" || len(c) != 4 {
+		t.Errorf("Unexpected change: %+v", c)
+	}
+
+	// Compare and a snapshot's settings
+	cmp := postGraphQL[struct {
+		Compare struct {
+			Different []SettingDiff `json:"different"`
+		} `json:"compare"`
+		Snapshots []struct {
+			Settings []map[string]string `json:"settings"`
+		} `json:"snapshots"`
+	}](t, server, `query($other: String!) {
+		compare(cluster1: "prod", cluster2: $other) { different { variable value1 value2 } }
+		snapshots(cluster: "prod", limit: 1) { settings(variable: "kv.*") { variable value } }
+	}`, map[string]any{"other": "staging"})
+	if len(cmp.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", cmp.Errors)
+	}
+	if d := cmp.Data.Compare.Different; len(d) != 1 || d[0].Variable != "sql.a" || d[0].Value1 != "2" || d[0].Value2 != "3" {
+		t.Errorf("Unexpected comparison: %+v", d)
+	}
+	if s := cmp.Data.Snapshots; len(s) != 1 || len(s[0].Settings) != 1 || s[0].Settings[0]["value"] != "2" {
+		t.Errorf("Unexpected snapshots: %+v", s)
+	}
+
+	// Unknown clusters are errors, not empty results
+	bad := postGraphQL[map[string]any](t, server, `{ changes(cluster: "nope") { id } }`, nil)
+	if len(bad.Errors) == 0 {
+		t.Error("Expected an error for an unknown cluster")
+	}
+}
+
+func TestGraphQLCreateAnnotation(t *testing.T) {
+	server, store := newGraphQLTestServer(t, WithGraphQL(true))
+
+	resp := postGraphQL[struct {
+		CreateAnnotation map[string]string `json:"createAnnotation"`
+	}](t, server, `mutation($change: ID!) {
+		createAnnotation(changeId: $change, content: "Raised for the backfill", severity: "warning") {
+			id changeId content severity createdBy
+		}
+	}`, map[string]any{"change": "7"})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", resp.Errors)
+	}
+	want := map[string]string{"id": "1", "changeId": "7", "content": "Raised for the backfill", "severity": "warning", "createdBy": "alice"}
+	for k, v := range want {
+		if resp.Data.CreateAnnotation[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, resp.Data.CreateAnnotation[k])
+		}
+	}
+	if ann := store.annotations[1]; ann == nil || ann.CreatedBy != "alice" {
+		t.Errorf("Expected the annotation to be stored with its author, got %+v", ann)
+	}
+
+	for _, query := range []string{
+		`mutation { createAnnotation(changeId: "7", content: " ") { id } }`,
+		`mutation { createAnnotation(changeId: "7", content: "x", severity: "urgent") { id } }`,
+		`mutation { createAnnotation(changeId: "seven", content: "x") { id } }`,
+	} {
+		if resp := postGraphQL[map[string]any](t, server, query, nil); len(resp.Errors) == 0 {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+	if len(store.annotations) != 1 {
+		t.Errorf("Expected invalid mutations to store nothing, got %d annotations", len(store.annotations))
+	}
+}
+
+func TestGraphQLVariableGlobsMatchREST(t *testing.T) {
+	server, _ := newGraphQLTestServer(t, WithGraphQL(true))
+
+	// Globs match as storage.MatchGlob does for the REST API: case-insensitively,
+	// with brackets taken literally
+	for _, tt := range []struct {
+		pattern string
+		want    int
+	}{
+		{"SQL.*", 1},
+		{"sql.?", 1},
+		{"sql.[a]", 0},
+	} {
+		resp := postGraphQL[struct {
+			Changes   []map[string]any `json:"changes"`
+			Snapshots []struct {
+				Settings []map[string]string `json:"settings"`
+			} `json:"snapshots"`
+		}](t, server, `query($v: String) {
+			changes(cluster: "prod", variable: $v) { variable }
+			snapshots(cluster: "prod", limit: 1) { settings(variable: $v) { variable } }
+		}`, map[string]any{"v": tt.pattern})
+		if len(resp.Errors) > 0 {
+			t.Errorf("%q: unexpected errors: %+v", tt.pattern, resp.Errors)
+			continue
+		}
+		if len(resp.Data.Changes) != tt.want {
+			t.Errorf("%q: expected %d changes, got %+v", tt.pattern, tt.want, resp.Data.Changes)
+		}
+		if s := resp.Data.Snapshots; len(s) != 1 || len(s[0].Settings) != tt.want {
+			t.Errorf("%q: expected %d settings, got %+v", tt.pattern, tt.want, s)
+		}
+	}
+}
+
+func TestGraphQLSnapshotLoadsCapped(t *testing.T) {
+	server, _ := newGraphQLTestServer(t, WithGraphQL(true))
+
+	query := func(n int) string {
+		var b strings.Builder
+		b.WriteString("{")
+		for i := range n {
+			fmt.Fprintf(&b, ` s%d: snapshot(id: "1") { id }`, i)
+		}
+		b.WriteString(" }")
+		return b.String()
+	}
+	if resp := postGraphQL[map[string]any](t, server, query(graphqlMaxSnapshotLoads), nil); len(resp.Errors) > 0 {
+		t.Errorf("Expected %d snapshot loads to be allowed, got %+v", graphqlMaxSnapshotLoads, resp.Errors)
+	}
+	resp := postGraphQL[map[string]any](t, server, query(graphqlMaxSnapshotLoads+1), nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "at most") {
+		t.Errorf("Expected one error for the load past the cap, got %+v", resp.Errors)
+	}
+
+	// Listing snapshots without their settings loads none
+	list := postGraphQL[map[string]any](t, server, `{ a: snapshots(cluster: "prod") { id } b: snapshots(cluster: "prod") { id } }`, nil)
+	if len(list.Errors) > 0 {
+		t.Errorf("Unexpected errors listing snapshots: %+v", list.Errors)
+	}
+}
+
+func TestGraphQLDisabled(t *testing.T) {
+	server, _ := newGraphQLTestServer(t)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ clusters { id } }"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without WithGraphQL, got %d", w.Code)
+	}
+
+	server, _ = newGraphQLTestServer(t, WithGraphQL(true))
+	for _, tt := range []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "not json", http.StatusBadRequest},
+		{http.MethodPost, `{"query":""}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, "/graphql", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %q: expected %d, got %d", tt.method, tt.body, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// handleHealth reports "ok", or "unhealthy" with 503 when a history store can't
+// be reached. Each failing check follows on a line of its own with its error,
+// so a single request shows the cause: "error:" lines for the stores, which
+// make the server unhealthy, and "warning:" lines for collectors, which don't.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var storeErrors []error
+	for _, store := range s.allStores() {
+		if err := store.Ping(r.Context()); err != nil {
+			storeErrors = append(storeErrors, err)
+		}
+	}
+	if len(storeErrors) > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unhealthy"))
+		for _, err := range storeErrors {
+			fmt.Fprintf(w, "\nerror: history database unreachable: %s", scrubCredentials(err.Error()))
+		}
+	} else {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+
+	// Warnings leave the server healthy but are listed for whoever reads the body.
+	if s.collectors != nil {
+		for _, st := range s.collectors.Status() {
+			if st.MonitorsHistoryDatabase && !st.SelfMonitoringAllowed {
+				fmt.Fprintf(w, "\nwarning: cluster %s is the history database's own cluster", st.ClusterID)
+			}
+			if st.StartupError != "" {
+				fmt.Fprintf(w, "\nwarning: cluster %s is not being collected: %s", st.ClusterID, scrubCredentials(st.StartupError))
+			}
+			if st.LastError != "" {
+				fmt.Fprintf(w, "\nwarning: cluster %s last collection failed: %s", st.ClusterID, scrubCredentials(st.LastError))
+			}
+		}
+	}
+}
+
+var (
+	// urlPassword matches the password in a connection URL's user info.
+	urlPassword = regexp.MustCompile(`(://[^:/@\s]*):[^@\s]*@`)
+	// keywordPassword matches a password in a key=value connection string.
+	keywordPassword = regexp.MustCompile(`(?i)\b((?:ssl)?password\s*=\s*)('[^']*'|\S+)`)
+)
+
+// scrubCredentials masks passwords in an error message, which can quote the
+// connection string it failed with, before it is shown to unauthenticated
+// callers of /health.
+func scrubCredentials(msg string) string {
+	msg = urlPassword.ReplaceAllString(msg, "$1:xxxxx@")
+	return keywordPassword.ReplaceAllString(msg, "${1}xxxxx")
+}
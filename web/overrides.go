@@ -0,0 +1,78 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"crdb-cluster-history/storage"
+)
+
+// SnapshotOverridesResponse is the JSON response for /api/snapshots/{id}/overrides.
+type SnapshotOverridesResponse struct {
+	SnapshotID int64              `json:"snapshot_id"`
+	Overrides  []storage.Override `json:"overrides"`
+}
+
+// handleAPISnapshotByID serves the per-snapshot endpoints under
+// /api/snapshots/{id}/: overrides and raw.
+func (s *Server) handleAPISnapshotByID(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/snapshots/"), "/")
+	if action != "overrides" && action != "raw" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		s.jsonError(w, "Invalid snapshot ID", http.StatusBadRequest)
+		return
+	}
+
+	clusterID, err := s.lookupCluster(r, "cluster")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if action == "raw" {
+		s.writeRawOutput(w, r, clusterID, id)
+		return
+	}
+	s.writeSnapshotOverrides(w, r, clusterID, id)
+}
+
+// writeSnapshotOverrides responds with the settings of a stored snapshot whose
+// value differed from the default recorded with it.
+func (s *Server) writeSnapshotOverrides(w http.ResponseWriter, r *http.Request, clusterID string, id int64) {
+	settings, err := s.getSnapshotByID(r.Context(), clusterID, id)
+	if s.ambiguousID(w, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error getting snapshot", "snapshot", id, "error", err)
+		s.jsonError(w, "Failed to get snapshot", http.StatusInternalServerError)
+		return
+	}
+	if settings == nil {
+		s.jsonError(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	overrides, recorded := storage.FindOverrides(settings)
+	if !recorded {
+		s.jsonError(w, "Snapshot was collected before default values were recorded", http.StatusUnprocessableEntity)
+		return
+	}
+	if s.redactor != nil {
+		for i, o := range overrides {
+			overrides[i].Value = s.redactor.RedactValue(o.Variable, o.Value)
+			overrides[i].DefaultValue = s.redactor.RedactValue(o.Variable, o.DefaultValue)
+		}
+	}
+	jsonResponse(w, http.StatusOK, SnapshotOverridesResponse{SnapshotID: id, Overrides: overrides})
+}
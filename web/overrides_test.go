@@ -0,0 +1,89 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPISnapshotOverrides(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	save := func(settings []storage.Setting) int64 {
+		t.Helper()
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v25.4.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		snapshots, err := store.ListSnapshots(ctx, "prod", 1)
+		if err != nil || len(snapshots) != 1 {
+			t.Fatalf("ListSnapshots = %v, %v", snapshots, err)
+		}
+		return snapshots[0].ID
+	}
+
+	legacy := save([]storage.Setting{{Variable: "kv.enabled", Value: "false", SettingType: "b"}})
+	id := save([]storage.Setting{
+		{Variable: "kv.enabled", Value: "FALSE", SettingType: "b", DefaultValue: "false"},
+		{Variable: "kv.timeout", Value: "00:02:00", SettingType: "d", DefaultValue: "1m0s"},
+		{Variable: "sql.size", Value: "64 MiB", SettingType: "z", DefaultValue: "67108864"},
+		{Variable: "server.secret", Value: "hunter2", SettingType: "s", DefaultValue: ""},
+		{Variable: "server.token", Value: "abc", SettingType: "s", DefaultValue: "def"},
+	})
+
+	get := func(url string, opts ...Option) *httptest.ResponseRecorder {
+		t.Helper()
+		server, err := New(store, append(opts, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}))...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get(fmt.Sprintf("/api/snapshots/%d/overrides", id))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp SnapshotOverridesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.SnapshotID != id || len(resp.Overrides) != 2 {
+		t.Fatalf("Expected 2 overrides in snapshot %d, got %+v", id, resp)
+	}
+	if o := resp.Overrides[0]; o.Variable != "kv.timeout" || o.Value != "00:02:00" || o.DefaultValue != "1m0s" {
+		t.Errorf("Unexpected first override: %+v", o)
+	}
+	if o := resp.Overrides[1]; o.Variable != "server.token" || o.Value != "abc" {
+		t.Errorf("Unexpected second override: %+v", o)
+	}
+
+	w = get(fmt.Sprintf("/api/snapshots/%d/overrides", id), WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true})))
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Overrides) != 2 {
+		t.Fatalf("Unexpected redacted response %d: %s", w.Code, w.Body.String())
+	}
+	if o := resp.Overrides[1]; o.Value != storage.RedactedPlaceholder || o.DefaultValue != storage.RedactedPlaceholder {
+		t.Errorf("Expected a redacted override, got %+v", o)
+	}
+
+	for url, want := range map[string]int{
+		fmt.Sprintf("/api/snapshots/%d/overrides", legacy): http.StatusUnprocessableEntity,
+		"/api/snapshots/999999/overrides":                  http.StatusNotFound,
+		"/api/snapshots/abc/overrides":                     http.StatusBadRequest,
+		fmt.Sprintf("/api/snapshots/%d/other", id):         http.StatusNotFound,
+	} {
+		if w := get(url); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", url, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestPageLimits(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	// Four snapshots and three changes
+	for _, v := range []string{"1", "2", "3", "4"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "default", []storage.Setting{{Variable: "page.setting", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store, WithDefaultClusterID("default"), WithPageLimits(config.PageLimits{
+		PageSize: 1, MaxChanges: 2, SnapshotPageSize: 2, MaxSnapshots: 3,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	count := func(url string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", url, w.Code, w.Body.String())
+		}
+		var rows []json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+			t.Fatalf("%s: failed to parse JSON: %v", url, err)
+		}
+		return len(rows)
+	}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"/api/changes", 1},
+		{"/api/changes?limit=2", 2},
+		{"/api/changes?limit=3", 1}, // Above max_changes, so the page size
+		{"/api/changes/context?limit=2", 2},
+		{"/api/snapshots", 2},
+		{"/api/snapshots?limit=3", 3},
+		{"/api/snapshots?limit=4", 2},
+	}
+	for _, tt := range tests {
+		if got := count(tt.url); got != tt.want {
+			t.Errorf("%s: expected %d rows, got %d", tt.url, tt.want, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if got := strings.Count(w.Body.String(), "<tr data-change-id="); got != 1 {
+		t.Errorf("Expected the dashboard to show page_size changes, got %d", got)
+	}
+
+	// Zero fields keep the defaults
+	defaults, err := New(store, WithPageLimits(config.PageLimits{PageSize: 5}))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	want := config.PageLimits{PageSize: 5, MaxChanges: MaxChangesLimit, SnapshotPageSize: DefaultSnapshotLimit, MaxSnapshots: MaxSnapshotLimit}
+	if defaults.limits != want {
+		t.Errorf("Expected %+v, got %+v", want, defaults.limits)
+	}
+}
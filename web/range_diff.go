@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// RangeDiffResult is the diff between a cluster's effective settings at two times.
+type RangeDiffResult struct {
+	ClusterID     string           `json:"cluster_id"`
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	Changes       []storage.Change `json:"changes"`        // old_value as of from, new_value as of to
+	ExcludedCount int              `json:"excluded_count"` // Differences matching an expected-difference pattern
+}
+
+// rangeDiffFileTimeFmt renders the compared times in the CSV file name.
+const rangeDiffFileTimeFmt = "20060102T150405Z"
+
+// handleAPIRangeDiff handles GET /api/clusters/{id}/range-diff?from=...&to=..., which
+// reconstructs the cluster's settings at both times from the latest snapshot
+// collected at or before each and exports what differs, as JSON or (format=csv)
+// as CSV in the same layout as /export.
+func (s *Server) handleAPIRangeDiff(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = exportFormatJSON
+	case exportFormatJSON, exportFormatCSV:
+	default:
+		s.jsonError(w, fmt.Sprintf("invalid format %q (use csv or json)", format), http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", time.Time{})
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from.IsZero() || to.IsZero() {
+		s.jsonError(w, "from and to query parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		s.jsonError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.compareTimeout)
+	defer cancel()
+
+	before, err := s.storeFor(clusterID).GetSettingsAt(ctx, clusterID, from)
+	if err != nil {
+		s.compareLoadError(w, ctx, err, "Failed to get settings at from", "cluster", clusterID, "at", from)
+		return
+	}
+	if before == nil {
+		s.jsonError(w, "no snapshot collected at or before from", http.StatusNotFound)
+		return
+	}
+	after, err := s.storeFor(clusterID).GetSettingsAt(ctx, clusterID, to)
+	if err != nil {
+		s.compareLoadError(w, ctx, err, "Failed to get settings at to", "cluster", clusterID, "at", to)
+		return
+	}
+
+	if !s.checkCompareSize(w, before, after) {
+		return
+	}
+
+	diff, excluded := excludeExpected(compareSettings(before, after), s.ignorePatterns(r))
+	changes := diffToChanges(clusterID, diff, to)
+	if s.redactor != nil {
+		changes = s.redactor.RedactChanges(changes)
+	}
+
+	if format == exportFormatCSV {
+		filename := fmt.Sprintf("crdb-cluster-history-%s-%s-%s.csv", clusterID,
+			from.UTC().Format(rangeDiffFileTimeFmt), to.UTC().Format(rangeDiffFileTimeFmt))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		csvWriter := storage.NewCSVChangeWriter(w).WithTimestampFormat(s.timeFormat)
+		if err := csvWriter.WriteHeader(); err != nil {
+			slog.Error("Error writing CSV header", "error", err)
+			return
+		}
+		for _, c := range changes {
+			if err := csvWriter.WriteChange(c); err != nil {
+				slog.Error("Error writing range diff CSV", "cluster", clusterID, "error", err)
+				return
+			}
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			slog.Error("CSV flush error", "error", err)
+		}
+		return
+	}
+
+	for i := range changes {
+		changes[i].DetectedAt = s.timeFormat.Apply(changes[i].DetectedAt)
+	}
+	jsonResponse(w, http.StatusOK, RangeDiffResult{
+		ClusterID:     clusterID,
+		From:          s.timeFormat.Apply(from),
+		To:            s.timeFormat.Apply(to),
+		Changes:       changes,
+		ExcludedCount: excluded,
+	})
+}
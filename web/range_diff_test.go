@@ -0,0 +1,145 @@
+package web
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIRangeDiff(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, settings := range [][]storage.Setting{
+		{{Variable: "a", Value: "1"}, {Variable: "same", Value: "x"}, {Variable: "gone", Value: "y"}},
+		{{Variable: "a", Value: "2"}, {Variable: "same", Value: "x"}, {Variable: "gone", Value: "y"}},
+		{{Variable: "a", Value: "3"}, {Variable: "same", Value: "x"}, {Variable: "added", Value: "z"}},
+	} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	snapshots, err := store.ListSnapshots(ctx, "prod", 10)
+	if err != nil || len(snapshots) != 3 {
+		t.Fatalf("ListSnapshots = %d snapshots, %v; want 3", len(snapshots), err)
+	}
+	first, second, third := snapshots[2].CollectedAt, snapshots[1].CollectedAt, snapshots[0].CollectedAt
+
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(from, to time.Time, extra string) *httptest.ResponseRecorder {
+		q := url.Values{"from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters/prod/range-diff?"+q.Encode()+extra, nil))
+		return w
+	}
+	summarize := func(changes []storage.Change) string {
+		var parts []string
+		for _, c := range changes {
+			parts = append(parts, c.Variable+":"+c.OldValue+">"+c.NewValue)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	t.Run("json", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			from, to time.Time
+			want     string
+		}{
+			{"first to latest", first, third, "a:1>3 added:>z gone:y>"},
+			{"first to second", first, second, "a:1>2"},
+			{"between snapshots", second.Add(time.Nanosecond), time.Now().Add(time.Hour), "a:2>3 added:>z gone:y>"},
+			{"same snapshot", first, second.Add(-time.Nanosecond), ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := get(tt.from, tt.to, "")
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+				}
+				var got RangeDiffResult
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatalf("Failed to parse JSON: %v", err)
+				}
+				if got.ClusterID != "prod" {
+					t.Errorf("cluster_id = %q, want prod", got.ClusterID)
+				}
+				if s := summarize(got.Changes); s != tt.want {
+					t.Errorf("Changes = %q, want %q", s, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		w := get(first, third, "&ignore=gone")
+		var got RangeDiffResult
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		if s := summarize(got.Changes); s != "a:1>3 added:>z" || got.ExcludedCount != 1 {
+			t.Errorf("Changes = %q, excluded %d; want the gone setting excluded", s, got.ExcludedCount)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		w := get(first, third, "&format=csv")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Errorf("Content-Type = %q, want text/csv", ct)
+		}
+		if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "crdb-cluster-history-prod-") {
+			t.Errorf("Content-Disposition = %q", cd)
+		}
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v", err)
+		}
+		if len(records) != 4 || records[0][2] != "variable" {
+			t.Fatalf("Expected a header and 3 rows, got %v", records)
+		}
+		if got := records[1]; got[2] != "a" || got[4] != "1" || got[5] != "3" {
+			t.Errorf("Unexpected first row: %v", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			target string
+			want   int
+		}{
+			{"missing times", "/api/clusters/prod/range-diff", http.StatusBadRequest},
+			{"bad time", "/api/clusters/prod/range-diff?from=yesterday&to=2026-01-01T00:00:00Z", http.StatusBadRequest},
+			{"reversed", "/api/clusters/prod/range-diff?from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z", http.StatusBadRequest},
+			{"bad format", "/api/clusters/prod/range-diff?from=2026-01-01T00:00:00Z&to=2026-01-02T00:00:00Z&format=zip", http.StatusBadRequest},
+			{"before history", "/api/clusters/prod/range-diff?from=2000-01-01T00:00:00Z&to=2000-01-02T00:00:00Z", http.StatusNotFound},
+			{"unknown cluster", "/api/clusters/nope/range-diff?from=2026-01-01T00:00:00Z&to=2026-01-02T00:00:00Z", http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+				if w.Code != tt.want {
+					t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+				}
+			})
+		}
+	})
+}
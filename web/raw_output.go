@@ -0,0 +1,58 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"crdb-cluster-history/storage"
+)
+
+// writeRawOutput responds with the complete collection query output stored with
+// a snapshot, as an array of rows keyed by column name. Sensitive settings have
+// their value columns redacted.
+func (s *Server) writeRawOutput(w http.ResponseWriter, r *http.Request, clusterID string, id int64) {
+	raw, err := s.getRawOutput(r.Context(), clusterID, id)
+	if s.ambiguousID(w, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error getting raw output", "snapshot", id, "error", err)
+		s.jsonError(w, "Failed to get raw output", http.StatusInternalServerError)
+		return
+	}
+	if raw == nil {
+		s.jsonError(w, "No raw output stored for snapshot", http.StatusNotFound)
+		return
+	}
+
+	var rows []map[string]any
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		slog.Error("Error decoding raw output", "snapshot", id, "error", err)
+		s.jsonError(w, "Failed to decode raw output", http.StatusInternalServerError)
+		return
+	}
+	if s.redactor != nil {
+		redactRawRows(s.redactor, rows)
+	}
+	jsonResponse(w, http.StatusOK, rows)
+}
+
+// rawValueColumns are the columns of SHOW CLUSTER SETTINGS output that hold a
+// setting's value.
+var rawValueColumns = []string{"value", "default_value"}
+
+// redactRawRows redacts the value columns of rows whose variable is sensitive.
+func redactRawRows(redactor *storage.Redactor, rows []map[string]any) {
+	for _, row := range rows {
+		variable, _ := row["variable"].(string)
+		if !redactor.ShouldRedact(variable) {
+			continue
+		}
+		for _, col := range rawValueColumns {
+			if _, ok := row[col]; ok {
+				row[col] = storage.RedactedPlaceholder
+			}
+		}
+	}
+}
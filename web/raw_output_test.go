@@ -0,0 +1,89 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPISnapshotRawOutput(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	save := func(raw json.RawMessage) int64 {
+		t.Helper()
+		settings := []storage.Setting{{Variable: "kv.enabled", Value: "true"}, {Variable: "server.secret", Value: "hunter2"}}
+		if _, err := store.SaveCollectedSnapshot(ctx, "prod", settings, "v25.4.0", storage.DefaultCollectionQuery, time.Minute, "", raw); err != nil {
+			t.Fatalf("SaveCollectedSnapshot failed: %v", err)
+		}
+		snapshots, err := store.ListSnapshots(ctx, "prod", 1)
+		if err != nil || len(snapshots) != 1 {
+			t.Fatalf("ListSnapshots = %v, %v", snapshots, err)
+		}
+		return snapshots[0].ID
+	}
+
+	without := save(nil)
+	id := save(json.RawMessage(`[
+		{"variable": "kv.enabled", "value": "true", "default_value": "false", "origin": "override"},
+		{"variable": "server.secret", "value": "hunter2", "default_value": "", "origin": "override"}
+	]`))
+
+	get := func(url string, opts ...Option) *httptest.ResponseRecorder {
+		t.Helper()
+		server, err := New(store, append(opts, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}))...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+	rows := func(w *httptest.ResponseRecorder) map[string]map[string]any {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp []map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		byVariable := make(map[string]map[string]any)
+		for _, row := range resp {
+			byVariable[row["variable"].(string)] = row
+		}
+		return byVariable
+	}
+
+	got := rows(get(fmt.Sprintf("/api/snapshots/%d/raw", id)))
+	if got["kv.enabled"]["origin"] != "override" || got["server.secret"]["value"] != "hunter2" {
+		t.Errorf("Unexpected raw output: %v", got)
+	}
+
+	got = rows(get(fmt.Sprintf("/api/snapshots/%d/raw", id), WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true}))))
+	if secret := got["server.secret"]; secret["value"] != storage.RedactedPlaceholder || secret["default_value"] != storage.RedactedPlaceholder || secret["origin"] != "override" {
+		t.Errorf("Expected the secret's values redacted, got %v", secret)
+	}
+	if got["kv.enabled"]["value"] != "true" {
+		t.Errorf("Expected other values kept, got %v", got["kv.enabled"])
+	}
+
+	for url, want := range map[string]int{
+		fmt.Sprintf("/api/snapshots/%d/raw", without): http.StatusNotFound,
+		"/api/snapshots/999999/raw":                   http.StatusNotFound,
+		"/api/snapshots/abc/raw":                      http.StatusBadRequest,
+	} {
+		if w := get(url); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", url, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// RebaselineResponse confirms that a cluster's next snapshot will be a new baseline.
+type RebaselineResponse struct {
+	ClusterID         string `json:"cluster_id"`
+	RebaselinePending bool   `json:"rebaseline_pending"`
+}
+
+// handleAPIRebaseline handles POST /api/clusters/{id}/rebaseline. The cluster's
+// next snapshot is saved as a new baseline, without recording changes against
+// the previous one, so an intentional reconfiguration does not flood the
+// history. Earlier history is kept.
+func (s *Server) handleAPIRebaseline(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.storeFor(clusterID).RequestRebaseline(r.Context(), clusterID); err != nil {
+		slog.Error("Error requesting rebaseline", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to request rebaseline", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Rebaseline requested", "cluster", clusterID, "user", s.getUsernameFromRequest(r))
+	jsonResponse(w, http.StatusAccepted, RebaselineResponse{ClusterID: clusterID, RebaselinePending: true})
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPIRebaseline(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	save := func(value string) []storage.Change {
+		t.Helper()
+		changes, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a.b", Value: value}}, "v1.0")
+		if err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+		return changes
+	}
+	save("1")
+
+	server, err := New(store, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}}), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	serve := func(method, path string) int {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if code := serve(http.MethodPost, "/api/clusters/prod/rebaseline"); code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", code)
+	}
+	if changes := save("2"); len(changes) != 0 {
+		t.Errorf("Expected the snapshot after a rebaseline to record no changes, got %+v", changes)
+	}
+	if changes := save("3"); len(changes) != 1 {
+		t.Errorf("Expected changes to be recorded again after the baseline, got %+v", changes)
+	}
+
+	if code := serve(http.MethodPost, "/api/clusters/unknown/rebaseline"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown cluster, got %d", code)
+	}
+	if code := serve(http.MethodGet, "/api/clusters/prod/rebaseline"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", code)
+	}
+}
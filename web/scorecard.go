@@ -0,0 +1,95 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"crdb-cluster-history/storage"
+)
+
+// Scorecard rule outcomes.
+const (
+	ScorecardPass    = "pass"
+	ScorecardFail    = "fail"
+	ScorecardMissing = "missing" // the setting is not in the latest snapshot
+)
+
+// ScorecardRule is the outcome of one expected setting.
+type ScorecardRule struct {
+	Variable string `json:"variable"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Status   string `json:"status"`
+}
+
+// ScorecardResult compares a cluster's latest snapshot against its expected settings.
+type ScorecardResult struct {
+	ClusterID string          `json:"cluster_id"`
+	Passed    int             `json:"passed"`
+	Failed    int             `json:"failed"` // mismatched and missing settings
+	Rules     []ScorecardRule `json:"rules"`
+}
+
+// handleAPIScorecard handles GET /api/clusters/{id}/scorecard, checking the latest
+// snapshot against the cluster's expected_settings.
+func (s *Server) handleAPIScorecard(w http.ResponseWriter, r *http.Request, clusterID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isValidCluster(clusterID) {
+		s.jsonError(w, "Cluster not found", http.StatusNotFound)
+		return
+	}
+
+	var expected map[string]string
+	if cfg := s.clusterConfig(clusterID); cfg != nil {
+		expected = cfg.ExpectedSettings
+	}
+
+	latest, err := s.latestSnapshot(r.Context(), clusterID)
+	if err != nil {
+		slog.Error("Error getting latest snapshot", "cluster", clusterID, "error", err)
+		s.jsonError(w, "Failed to get latest snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	result := scoreSettings(expected, latest)
+	result.ClusterID = clusterID
+	if s.redactor != nil {
+		// Outcomes are computed on real values; only the values shown are hidden
+		for i, rule := range result.Rules {
+			result.Rules[i].Expected = s.redactor.RedactValue(rule.Variable, rule.Expected)
+			if rule.Status != ScorecardMissing {
+				result.Rules[i].Actual = s.redactor.RedactValue(rule.Variable, rule.Actual)
+			}
+		}
+	}
+
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// scoreSettings checks each expected value against the snapshot, sorted by variable.
+// Values must match exactly.
+func scoreSettings(expected map[string]string, snapshot map[string]storage.Setting) ScorecardResult {
+	result := ScorecardResult{Rules: make([]ScorecardRule, 0, len(expected))}
+	for variable, want := range expected {
+		rule := ScorecardRule{Variable: variable, Expected: want, Status: ScorecardMissing}
+		if setting, ok := snapshot[variable]; ok {
+			rule.Actual = setting.Value
+			rule.Status = ScorecardFail
+			if setting.Value == want {
+				rule.Status = ScorecardPass
+			}
+		}
+		if rule.Status == ScorecardPass {
+			result.Passed++
+		} else {
+			result.Failed++
+		}
+		result.Rules = append(result.Rules, rule)
+	}
+	sort.Slice(result.Rules, func(i, j int) bool { return result.Rules[i].Variable < result.Rules[j].Variable })
+	return result
+}
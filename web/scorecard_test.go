@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestScoreSettings(t *testing.T) {
+	snapshot := map[string]storage.Setting{
+		"sql.stats.automatic_collection.enabled": {Variable: "sql.stats.automatic_collection.enabled", Value: "true"},
+		"kv.rangefeed.enabled":                   {Variable: "kv.rangefeed.enabled", Value: "false"},
+	}
+	expected := map[string]string{
+		"sql.stats.automatic_collection.enabled": "true",
+		"kv.rangefeed.enabled":                   "true",
+		"server.time_until_store_dead":           "5m0s",
+	}
+
+	got := scoreSettings(expected, snapshot)
+	want := []ScorecardRule{
+		{Variable: "kv.rangefeed.enabled", Expected: "true", Actual: "false", Status: ScorecardFail},
+		{Variable: "server.time_until_store_dead", Expected: "5m0s", Status: ScorecardMissing},
+		{Variable: "sql.stats.automatic_collection.enabled", Expected: "true", Actual: "true", Status: ScorecardPass},
+	}
+	if len(got.Rules) != len(want) {
+		t.Fatalf("Expected %d rules, got %+v", len(want), got.Rules)
+	}
+	for i := range want {
+		if got.Rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, got.Rules[i], want[i])
+		}
+	}
+	if got.Passed != 1 || got.Failed != 2 {
+		t.Errorf("Expected 1 passed and 2 failed, got %d and %d", got.Passed, got.Failed)
+	}
+}
+
+func TestHandleAPIScorecard(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	settings := []storage.Setting{
+		{Variable: "sql.stats.automatic_collection.enabled", Value: "true"},
+		{Variable: "server.secret.token", Value: "actual-secret"},
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "prod", settings, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	clusters := []config.ClusterConfig{
+		{ID: "prod", Name: "Production", ExpectedSettings: map[string]string{
+			"sql.stats.automatic_collection.enabled": "true",
+			"server.secret.token":                    "expected-secret",
+			"kv.rangefeed.enabled":                   "true",
+		}},
+		{ID: "staging", Name: "Staging"},
+	}
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	server, err := New(store, WithClusters(clusters), WithRedactor(redactor))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters/prod/scorecard", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ScorecardResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.ClusterID != "prod" || result.Passed != 1 || result.Failed != 2 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	status := map[string]ScorecardRule{}
+	for _, rule := range result.Rules {
+		status[rule.Variable] = rule
+	}
+	if got := status["sql.stats.automatic_collection.enabled"]; got.Status != ScorecardPass {
+		t.Errorf("Expected matching setting to pass, got %+v", got)
+	}
+	if got := status["kv.rangefeed.enabled"]; got.Status != ScorecardMissing || got.Actual != "" {
+		t.Errorf("Expected missing setting, got %+v", got)
+	}
+	secret := status["server.secret.token"]
+	if secret.Status != ScorecardFail || secret.Actual != storage.RedactedPlaceholder || secret.Expected != storage.RedactedPlaceholder {
+		t.Errorf("Expected a redacted mismatch, got %+v", secret)
+	}
+
+	// A cluster without expectations has an empty scorecard
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters/staging/scorecard", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	result = ScorecardResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || len(result.Rules) != 0 {
+		t.Errorf("Expected no rules, got %+v, %v", result, err)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/clusters/unknown/scorecard", http.StatusNotFound},
+		{http.MethodPost, "/api/clusters/prod/scorecard", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"crdb-cluster-history/storage"
+)
+
+// handleAPISearch handles GET /api/search?q=...&cluster=...&limit=..., which
+// returns the changes whose variable, old or new value, or description contains
+// q, ignoring case, newest first. Without cluster it searches every cluster.
+// Matches only in redacted values are left out, so a page can hold fewer than
+// limit changes.
+func (s *Server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		s.jsonError(w, "q query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	var clusterID string
+	if r.URL.Query().Get("cluster") != "" {
+		var err error
+		if clusterID, err = s.getClusterID(r); err != nil {
+			s.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := s.limits.PageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= s.limits.MaxChanges {
+			limit = parsed
+		}
+	}
+
+	// Search each configured cluster in its own store, so that rows a store
+	// still holds for removed clusters can't use up the limit. Without a
+	// configured list, every cluster in the store is searched at once.
+	type search struct {
+		store     Store
+		clusterID string
+	}
+	var searches []search
+	switch {
+	case clusterID != "":
+		searches = []search{{s.storeFor(clusterID), clusterID}}
+	case len(s.clusters) > 0:
+		for _, c := range s.clusters {
+			searches = append(searches, search{s.storeFor(c.ID), c.ID})
+		}
+	default:
+		searches = []search{{s.store, ""}}
+	}
+
+	var changes []storage.Change
+	for _, search := range searches {
+		found, err := search.store.SearchChanges(r.Context(), search.clusterID, query, limit)
+		if err != nil {
+			slog.Error("Error searching changes", "cluster", search.clusterID, "error", err)
+			s.jsonError(w, "Failed to search changes", http.StatusInternalServerError)
+			return
+		}
+		changes = append(changes, found...)
+	}
+	if len(searches) > 1 {
+		sort.SliceStable(changes, func(i, j int) bool {
+			return changes[i].DetectedAt.After(changes[j].DetectedAt)
+		})
+		if len(changes) > limit {
+			changes = changes[:limit]
+		}
+	}
+
+	if s.redactor != nil {
+		// Drop the changes matched only by a redacted value, which would
+		// otherwise reveal what the value contains
+		redacted := s.redactor.RedactChanges(changes)
+		changes = changes[:0]
+		for _, c := range redacted {
+			if changeContains(c, query) {
+				changes = append(changes, c)
+			}
+		}
+	}
+	if changes == nil {
+		changes = []storage.Change{}
+	}
+	jsonResponse(w, http.StatusOK, s.timeFormat.ApplyToChanges(changes))
+}
+
+// changeContains reports whether the change's variable, old or new value, or
+// description contains query, ignoring case, as storage SearchChanges matches.
+func changeContains(c storage.Change, query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range []string{c.Variable, c.OldValue, c.NewValue, c.Description} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPISearch(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, cluster := range []string{"prod", "staging", "removed"} {
+		for _, v := range []string{"false", "true"} {
+			if _, err := store.SaveSnapshotWithChanges(ctx, cluster, []storage.Setting{
+				{Variable: "kv.rangefeed.enabled", Value: v},
+				{Variable: "server.secret_token", Value: "hunter2-" + v},
+			}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+	}
+
+	server, err := New(store,
+		WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}),
+		WithDefaultClusterID("prod"),
+		WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true})))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/search?"+params.Encode(), nil))
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		params   url.Values
+		clusters []string
+	}{
+		{"one cluster", url.Values{"q": {"RANGEFEED"}, "cluster": {"prod"}}, []string{"prod"}},
+		{"all configured clusters", url.Values{"q": {"rangefeed"}}, []string{"prod", "staging"}},
+		{"limit", url.Values{"q": {"rangefeed"}, "limit": {"1"}}, []string{"any"}},
+		{"redacted values are not searched", url.Values{"q": {"hunter2"}}, nil},
+		{"sensitive variable names are", url.Values{"q": {"secret_token"}, "cluster": {"prod"}}, []string{"prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.params)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var changes []storage.Change
+			if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			if changes == nil {
+				t.Fatal("Expected a JSON array, got null")
+			}
+			if len(changes) != len(tt.clusters) {
+				t.Fatalf("Expected %d changes, got %+v", len(tt.clusters), changes)
+			}
+			seen := map[string]bool{}
+			for _, c := range changes {
+				seen[c.ClusterID] = true
+				if c.Variable == "server.secret_token" && c.NewValue != storage.RedactedPlaceholder {
+					t.Errorf("Expected a redacted value, got %q", c.NewValue)
+				}
+			}
+			for _, id := range tt.clusters {
+				if id != "any" && !seen[id] {
+					t.Errorf("Expected a change of %s, got %+v", id, changes)
+				}
+			}
+		})
+	}
+
+	for _, params := range []url.Values{{}, {"q": {"  "}}, {"q": {"x"}, "cluster": {"removed"}}} {
+		if w := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d: %s", params, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/search?q=x", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
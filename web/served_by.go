@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// servedByHeader names the instance, build version, cluster and store behind a
+// response, to trace requests across load-balanced replicas.
+const servedByHeader = "X-Served-By"
+
+// WithServedByHeader sets the X-Served-By header on every response passing
+// through ServedBy.
+func WithServedByHeader(enabled bool) Option {
+	return func(s *Server) {
+		s.servedBy = enabled
+		if enabled {
+			s.hostname, _ = os.Hostname()
+		}
+	}
+}
+
+// ServedBy is middleware that sets the X-Served-By header, for example
+// "v1.4.0; host=web-1; cluster=prod; store=primary". The cluster is the one the
+// request selects with ?cluster= (or the default), and store is "primary" when
+// its history is in the main store and "cluster" when in its own history
+// database. It passes requests through unchanged unless WithServedByHeader is set.
+func (s *Server) ServedBy(next http.Handler) http.Handler {
+	if !s.servedBy {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(servedByHeader, s.servedByValue(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) servedByValue(r *http.Request) string {
+	version := s.version
+	if version == "" {
+		version = "unknown"
+	}
+	parts := []string{version}
+	if s.hostname != "" {
+		parts = append(parts, "host="+s.hostname)
+	}
+
+	// An invalid ?cluster= is left for the handler to reject; it isn't echoed back
+	if clusterID, err := s.getClusterID(r); err == nil && clusterID != "" {
+		store := "primary"
+		if _, ok := s.clusterStores[clusterID]; ok {
+			store = "cluster"
+		}
+		parts = append(parts, "cluster="+clusterID, "store="+store)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestServedByHeader(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	staging, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production"}, {ID: "staging", Name: "Staging"}}
+	newServer := func(opts ...Option) *Server {
+		t.Helper()
+		server, err := New(store, append(opts,
+			WithClusters(clusters),
+			WithDefaultClusterID("prod"),
+			WithVersion("v1.4.0"),
+			WithClusterStores(map[string]Store{"staging": staging}),
+		)...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		return server
+	}
+	get := func(server *Server, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServedBy(server.Handler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	if h := get(newServer(), "/version").Header().Get(servedByHeader); h != "" {
+		t.Errorf("Expected no %s header unless enabled, got %q", servedByHeader, h)
+	}
+
+	server := newServer(WithServedByHeader(true))
+	tests := []struct {
+		url  string
+		want []string
+		not  string
+	}{
+		{"/version", []string{"v1.4.0", "cluster=prod", "store=primary"}, ""},
+		{"/api/changes?cluster=staging", []string{"v1.4.0", "cluster=staging", "store=cluster"}, ""},
+		{"/api/changes?cluster=nope", []string{"v1.4.0"}, "cluster="},
+		{"/no-such-page", []string{"v1.4.0"}, ""},
+	}
+	for _, tt := range tests {
+		h := get(server, tt.url).Header().Get(servedByHeader)
+		if !strings.HasPrefix(h, "v1.4.0") {
+			t.Errorf("%s: %s = %q, want the build version first", tt.url, servedByHeader, h)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(h, want) {
+				t.Errorf("%s: %s = %q, want it to contain %q", tt.url, servedByHeader, h, want)
+			}
+		}
+		if tt.not != "" && strings.Contains(h, tt.not) {
+			t.Errorf("%s: %s = %q, should not contain %q", tt.url, servedByHeader, h, tt.not)
+		}
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,6 +22,7 @@ import (
 	"crdb-cluster-history/config"
 	"crdb-cluster-history/storage"
 
+	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
@@ -27,6 +31,7 @@ import (
 type AnnotationRequest struct {
 	ChangeID int64  `json:"change_id,omitempty"`
 	Content  string `json:"content"`
+	Severity string `json:"severity,omitempty"` // Defaults to info on create; unchanged on update if empty
 }
 
 // AnnotationResponse is the JSON response for annotation operations.
@@ -34,6 +39,7 @@ type AnnotationResponse struct {
 	ID        int64  `json:"id"`
 	ChangeID  int64  `json:"change_id"`
 	Content   string `json:"content"`
+	Severity  string `json:"severity"`
 	CreatedBy string `json:"created_by"`
 	CreatedAt string `json:"created_at"`
 	UpdatedBy string `json:"updated_by,omitempty"`
@@ -46,10 +52,20 @@ type ErrorResponse struct {
 }
 
 const (
-	DefaultPageLimit     = 100
-	MaxExportLimit       = 100_000
-	DefaultSnapshotLimit = 100
-	MaxSnapshotLimit     = 1000
+	DefaultPageLimit     = config.DefaultPageSize
+	DefaultSnapshotLimit = config.DefaultSnapshotPageSize
+	MaxSnapshotLimit     = config.DefaultMaxSnapshots
+	MaxSnapshotBatch     = 50
+
+	// DefaultCompareTimeout bounds how long a compare request may spend loading snapshots.
+	DefaultCompareTimeout = 30 * time.Second
+	// DefaultRecentWindow is how long after detection a change is highlighted as new
+	// on the dashboard.
+	DefaultRecentWindow = 24 * time.Hour
+
+	// DefaultMaxCompareSettings caps the combined size of the two snapshots a compare
+	// request diffs. A cluster has on the order of a thousand settings.
+	DefaultMaxCompareSettings = 50_000
 
 	defaultClusterIDValue = "default"
 
@@ -65,17 +81,41 @@ var templateFS embed.FS
 type Store interface {
 	Ping(ctx context.Context) error
 	GetChanges(ctx context.Context, clusterID string, limit int) ([]storage.Change, error)
+	GetChangesInRange(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]storage.Change, error)
+	SearchChanges(ctx context.Context, clusterID, query string, limit int) ([]storage.Change, error)
+	GetTopChangedSettings(ctx context.Context, clusterID string, from, to time.Time, limit int) ([]storage.SettingChangeCount, error)
+	CountChangesByCluster(ctx context.Context, since time.Time) ([]storage.ClusterChangeCount, error)
 	StreamChanges(ctx context.Context, clusterID string, fn func(storage.Change) error) error
+	StreamChangesAfter(ctx context.Context, clusterID string, afterID int64, fn func(int64, storage.Change) error) error
 	GetChangesWithAnnotations(ctx context.Context, clusterID string, limit int) ([]storage.ChangeWithAnnotation, error)
+	GetChangesWithAnnotationsPaged(ctx context.Context, clusterID string, limit, offset int) ([]storage.ChangeWithAnnotation, error)
+	CountChanges(ctx context.Context, clusterID string) (int64, error)
+	HasChange(ctx context.Context, changeID int64) (bool, error)
+	GetChangesWithAcknowledgements(ctx context.Context, clusterID string, unacknowledgedOnly bool, limit int) ([]storage.ChangeWithAcknowledgement, error)
+	AcknowledgeChange(ctx context.Context, changeID int64, acknowledgedBy string) (*storage.Acknowledgement, error)
 	GetSourceClusterID(ctx context.Context, clusterID string) (string, error)
+	RequestRebaseline(ctx context.Context, clusterID string) error
+	ListClustersWithPrefix(ctx context.Context, prefix string, limit int) ([]string, error)
 	GetDatabaseVersion(ctx context.Context, clusterID string) (string, error)
+	GetAllMetadata(ctx context.Context, clusterID string) (map[string]string, error)
 	GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]storage.Setting, error)
 	ListSnapshots(ctx context.Context, clusterID string, limit int) ([]storage.SnapshotInfo, error)
 	GetSnapshotByID(ctx context.Context, snapshotID int64) (map[string]storage.Setting, error)
-	CreateAnnotation(ctx context.Context, changeID int64, content, createdBy string) (*storage.Annotation, error)
+	GetRawOutput(ctx context.Context, snapshotID int64) (json.RawMessage, error)
+	GetSettingsAt(ctx context.Context, clusterID string, at time.Time) (map[string]storage.Setting, error)
+	CreateAnnotation(ctx context.Context, changeID int64, content, severity, createdBy string) (*storage.Annotation, error)
 	GetAnnotation(ctx context.Context, id int64) (*storage.Annotation, error)
-	UpdateAnnotation(ctx context.Context, id int64, content, updatedBy string) error
+	GetAnnotationByChangeID(ctx context.Context, changeID int64) (*storage.Annotation, error)
+	ListAnnotations(ctx context.Context, severity string, limit int) ([]storage.Annotation, error)
+	UpdateAnnotation(ctx context.Context, id int64, content, severity, updatedBy string) error
 	DeleteAnnotation(ctx context.Context, id int64) error
+	CreateSubscription(ctx context.Context, clusterID, variablePattern, targetURL, createdBy string) (*storage.Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*storage.Subscription, error)
+	ListSubscriptions(ctx context.Context, clusterID string) ([]storage.Subscription, error)
+	UpdateSubscription(ctx context.Context, id int64, variablePattern, targetURL string) error
+	DeleteSubscription(ctx context.Context, id int64) error
+	SchemaMigrations(ctx context.Context) ([]storage.AppliedMigration, error)
+	Diagnostics(ctx context.Context) (*storage.Diagnostics, error)
 }
 
 // Server handles HTTP requests for the web UI.
@@ -83,9 +123,30 @@ type Server struct {
 	store            Store
 	tmpl             *template.Template
 	redactor         *storage.Redactor
-	defaultClusterID string                 // Default cluster ID for single-cluster mode
-	clusters         []config.ClusterConfig // List of configured clusters
-	authCfg          auth.Config            // Authentication configuration
+	defaultClusterID string                  // Default cluster ID for single-cluster mode
+	clusters         []config.ClusterConfig  // List of configured clusters
+	authCfg          auth.Config             // Authentication configuration
+	expectedDiffs    []string                // Variable globs excluded from comparisons
+	collectors       Collectors              // Collection controls (nil disables the endpoints)
+	timeFormat       storage.TimestampFormat // Timezone and precision for rendered timestamps
+	metrics          http.Handler            // Serves /metrics (nil disables the endpoint)
+	version          string                  // Build version reported by /version
+	compareTimeout   time.Duration           // Time limit for loading the snapshots of a compare request
+	maxCompare       int                     // Most settings (both sides combined) a compare request may diff
+	landingPage      string                  // Page "/" redirects to (empty serves the dashboard)
+	streamInterval   time.Duration           // How often change streams poll the store for new changes
+	clusterStores    map[string]Store        // Stores for clusters whose history is not in store
+	pollInterval     time.Duration           // Configured collection interval, for freshness checks
+	recentWindow     time.Duration           // Changes detected within this long are highlighted as new (0 disables)
+	changeLink       *ChangeLinkTemplate     // Per-change link to external tooling (nil for none)
+	snapshotCache    *SnapshotCache          // Recently loaded latest snapshots (nil reads the store every time)
+	servedBy         bool                    // ServedBy sets the X-Served-By header
+	hostname         string                  // Instance name reported in X-Served-By
+	exportSlots      chan struct{}           // One token per /export request in progress
+	graphqlEnabled   bool                    // Serve /graphql
+	graphql          *graphql.Schema         // Executes /graphql requests (nil when disabled)
+	filterPresets    []config.FilterPreset   // Named variable globs offered as dashboard quick filters
+	limits           config.PageLimits       // Default and maximum rows returned by list endpoints
 }
 
 // Option configures the Server.
@@ -98,6 +159,28 @@ func WithRedactor(r *storage.Redactor) Option {
 	}
 }
 
+// WithPollInterval sets the collection interval freshness is judged against.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = d
+	}
+}
+
+// WithRecentWindow sets how long after detection a change is highlighted as new on
+// the dashboard. Zero or negative disables the highlighting.
+func WithRecentWindow(d time.Duration) Option {
+	return func(s *Server) {
+		s.recentWindow = d
+	}
+}
+
+// WithVersion sets the build version reported by /version.
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
 // WithDefaultClusterID sets the default cluster ID for the server.
 func WithDefaultClusterID(clusterID string) Option {
 	return func(s *Server) {
@@ -112,6 +195,80 @@ func WithClusters(clusters []config.ClusterConfig) Option {
 	}
 }
 
+// WithExpectedDifferences sets variable globs whose differences are excluded from comparison results.
+func WithExpectedDifferences(patterns []string) Option {
+	return func(s *Server) {
+		s.expectedDiffs = patterns
+	}
+}
+
+// WithTimestampFormat sets the timezone and precision used for timestamps in exports, JSON, and the UI.
+func WithTimestampFormat(f storage.TimestampFormat) Option {
+	return func(s *Server) {
+		s.timeFormat = f
+	}
+}
+
+// WithMetrics serves h at /metrics.
+func WithMetrics(h http.Handler) Option {
+	return func(s *Server) {
+		s.metrics = h
+	}
+}
+
+// WithPageLimits sets the number of rows the dashboard and list endpoints
+// return without a limit parameter, and the largest limit they accept. Zero
+// fields keep the defaults.
+func WithPageLimits(limits config.PageLimits) Option {
+	return func(s *Server) {
+		if limits.PageSize > 0 {
+			s.limits.PageSize = limits.PageSize
+		}
+		if limits.MaxChanges > 0 {
+			s.limits.MaxChanges = limits.MaxChanges
+		}
+		if limits.SnapshotPageSize > 0 {
+			s.limits.SnapshotPageSize = limits.SnapshotPageSize
+		}
+		if limits.MaxSnapshots > 0 {
+			s.limits.MaxSnapshots = limits.MaxSnapshots
+		}
+	}
+}
+
+// WithCompareLimits bounds the compare endpoints: loading both snapshots must finish
+// within timeout (503 otherwise), and together they may hold at most maxSettings
+// settings (413 otherwise). Zero values keep the defaults.
+func WithCompareLimits(timeout time.Duration, maxSettings int) Option {
+	return func(s *Server) {
+		if timeout > 0 {
+			s.compareTimeout = timeout
+		}
+		if maxSettings > 0 {
+			s.maxCompare = maxSettings
+		}
+	}
+}
+
+// WithLandingPage makes "/" redirect to path (e.g. "/compare"). The changes
+// dashboard stays reachable at /dashboard. Empty or "/" serves the dashboard at "/".
+func WithLandingPage(path string) Option {
+	return func(s *Server) {
+		if path != "/" {
+			s.landingPage = path
+		}
+	}
+}
+
+// WithStreamInterval sets how often change streams poll the store for new changes.
+func WithStreamInterval(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.streamInterval = d
+		}
+	}
+}
+
 // WithAuthConfig sets the authentication configuration.
 func WithAuthConfig(cfg auth.Config) Option {
 	return func(s *Server) {
@@ -121,8 +278,27 @@ func WithAuthConfig(cfg auth.Config) Option {
 
 // New creates a new web server.
 func New(store Store, opts ...Option) (*Server, error) {
+	s := &Server{
+		store:            store,
+		defaultClusterID: defaultClusterIDValue,
+		compareTimeout:   DefaultCompareTimeout,
+		maxCompare:       DefaultMaxCompareSettings,
+		streamInterval:   DefaultStreamInterval,
+		recentWindow:     DefaultRecentWindow,
+		exportSlots:      make(chan struct{}, DefaultMaxConcurrentExports),
+		limits: config.PageLimits{
+			PageSize:         DefaultPageLimit,
+			MaxChanges:       MaxChangesLimit,
+			SnapshotPageSize: DefaultSnapshotLimit,
+			MaxSnapshots:     MaxSnapshotLimit,
+		},
+	}
+
 	// Register custom template functions
 	funcMap := template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return s.timeFormat.FormatDisplay(t)
+		},
 		"js": func(s string) template.JS {
 			// Escape string for safe embedding in JavaScript string literals
 			encoded, _ := json.Marshal(s)
@@ -137,31 +313,42 @@ func New(store Store, opts ...Option) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	s := &Server{
-		store:            store,
-		tmpl:             tmpl,
-		defaultClusterID: defaultClusterIDValue,
-	}
+	s.tmpl = tmpl
 
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	if s.graphqlEnabled {
+		if s.graphql, err = newGraphQLSchema(s); err != nil {
+			return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+		}
+	}
+
 	return s, nil
 }
 
-// getClusterID returns the cluster ID from the request, or the default.
-// Returns empty string if the cluster ID is not in the configured list.
-func (s *Server) getClusterID(r *http.Request) string {
+// Errors returned by getClusterID for a bad ?cluster= parameter.
+var (
+	errInvalidClusterID = errors.New("invalid cluster ID")
+	errUnknownCluster   = errors.New("unknown cluster")
+)
+
+// getClusterID returns the cluster ID from the ?cluster= parameter, or the default
+// when it is absent. Malformed IDs and IDs outside the configured list are rejected
+// so they never reach the store.
+func (s *Server) getClusterID(r *http.Request) (string, error) {
 	clusterID := r.URL.Query().Get("cluster")
 	if clusterID == "" {
-		return s.defaultClusterID
+		return s.defaultClusterID, nil
+	}
+	if !config.IsValidHistoryID(clusterID) {
+		return "", errInvalidClusterID
 	}
-	if s.isValidCluster(clusterID) {
-		return clusterID
+	if !s.isValidCluster(clusterID) {
+		return "", errUnknownCluster
 	}
-	return s.defaultClusterID
+	return clusterID, nil
 }
 
 // isValidCluster checks if the given cluster ID is in the configured list.
@@ -177,23 +364,54 @@ func (s *Server) isValidCluster(id string) bool {
 	return false
 }
 
+// clusterConfig returns the configuration for the given cluster ID, or nil if it isn't configured.
+func (s *Server) clusterConfig(id string) *config.ClusterConfig {
+	for i := range s.clusters {
+		if s.clusters[i].ID == id {
+			return &s.clusters[i]
+		}
+	}
+	return nil
+}
+
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/dashboard", s.handleIndex)
 	mux.HandleFunc("/login", s.handleLogin)
 	mux.HandleFunc("/logout", s.handleLogout)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/version", s.handleVersion)
 	mux.HandleFunc("/export", s.handleExport)
 	mux.HandleFunc("/compare", s.handleCompare)
 	mux.HandleFunc("/fleet", s.handleFleet)
 	mux.HandleFunc("/history", s.handleHistory)
 	mux.HandleFunc("/api/clusters", s.handleAPIClusters)
+	mux.HandleFunc("/api/clusters/", s.handleAPIClusterByID)
+	mux.HandleFunc("/api/clusters/active", s.handleAPIActiveClusters)
+	mux.HandleFunc("/api/collectors", s.handleAPICollectors)
+	mux.HandleFunc("/api/diagnostics", s.handleAPIDiagnostics)
+	mux.HandleFunc("/api/changes", s.handleAPIChanges)
+	mux.HandleFunc("/api/search", s.handleAPISearch)
+	mux.HandleFunc("/api/changes/jsonl/stream", s.handleAPIChangesStream)
+	mux.HandleFunc("/api/changes/context", s.handleAPIChangesContext)
+	mux.HandleFunc("/api/changes/", s.handleAPIChangeByID)
 	mux.HandleFunc("/api/cluster-settings", s.handleAPIClusterSettings)
 	mux.HandleFunc("/api/compare", s.handleAPICompare)
+	mux.HandleFunc("/api/compare-at", s.handleAPICompareAt)
 	mux.HandleFunc("/api/snapshots", s.handleAPISnapshots)
+	mux.HandleFunc("/api/snapshots/batch", s.handleAPISnapshotsBatch)
+	mux.HandleFunc("/api/snapshots/", s.handleAPISnapshotByID)
 	mux.HandleFunc("/api/compare-snapshots", s.handleAPICompareSnapshots)
+	mux.HandleFunc("/api/compare-template", s.handleAPICompareTemplate)
 	mux.HandleFunc("/api/annotations", s.handleAnnotations)
 	mux.HandleFunc("/api/annotations/", s.handleAnnotationByID)
+	mux.HandleFunc("/api/subscriptions", s.handleSubscriptions)
+	mux.HandleFunc("/api/subscriptions/", s.handleSubscriptionByID)
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics)
+	}
+	mux.HandleFunc("/graphql", s.handleGraphQL)
 	return mux
 }
 
@@ -255,38 +473,85 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	if err := s.store.Ping(r.Context()); err != nil {
-		http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+// VersionResponse is the JSON response for /version.
+type VersionResponse struct {
+	Version             string                     `json:"version"`
+	SchemaVersion       int                        `json:"schema_version"`        // Newest applied migration (0 for file storage)
+	LatestSchemaVersion int                        `json:"latest_schema_version"` // Newest migration this build knows
+	Migrations          []storage.AppliedMigration `json:"migrations"`
+}
+
+// handleVersion reports the build version and the applied schema migrations.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	migrations, err := s.store.SchemaMigrations(r.Context())
+	if err != nil {
+		slog.Error("Error reading schema migrations", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
+
+	resp := VersionResponse{
+		Version:             s.version,
+		LatestSchemaVersion: storage.LatestSchemaVersion(),
+		Migrations:          migrations,
+	}
+	for i := range resp.Migrations {
+		resp.Migrations[i].AppliedAt = s.timeFormat.Apply(resp.Migrations[i].AppliedAt)
+		resp.SchemaVersion = max(resp.SchemaVersion, resp.Migrations[i].Version)
+	}
+	jsonResponse(w, http.StatusOK, resp)
 }
 
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if s.landingPage != "" && r.URL.Path == "/" {
+		target := s.landingPage
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
 	ctx := r.Context()
-	clusterID := s.getClusterID(r)
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	changes, err := s.store.GetChangesWithAnnotations(ctx, clusterID, DefaultPageLimit)
+	preset, err := s.selectedPreset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := s.storeFor(clusterID).GetChangesWithAnnotations(ctx, clusterID, s.limits.PageSize)
 	if err != nil {
 		slog.Error("Error getting changes", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if preset != nil {
+		changes = filterByPreset(changes, *preset)
+	}
 
 	// Apply redaction if configured
 	if s.redactor != nil {
 		changes = s.redactChangesWithAnnotations(changes)
 	}
 
-	sourceClusterID, err := s.store.GetSourceClusterID(ctx, clusterID)
+	sourceClusterID, err := s.storeFor(clusterID).GetSourceClusterID(ctx, clusterID)
 	if err != nil {
 		slog.Error("Error getting source cluster ID", "error", err)
 		// Don't fail, just leave it empty
 	}
 
-	dbVersion, err := s.store.GetDatabaseVersion(ctx, clusterID)
+	dbVersion, err := s.storeFor(clusterID).GetDatabaseVersion(ctx, clusterID)
 	if err != nil {
 		slog.Error("Error getting database version", "error", err)
 		// Don't fail, just leave it empty
@@ -296,15 +561,21 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		ClusterID       string
 		CurrentCluster  string
 		DatabaseVersion string
-		Changes         []storage.ChangeWithAnnotation
+		Changes         []indexChange
 		Clusters        []config.ClusterConfig
+		Cluster         *config.ClusterConfig // Display metadata for the current cluster (nil if not configured)
+		Presets         []presetLink
+		ScopeTabs       []presetLink // Cluster settings and zone configuration tabs (nil without zone configs)
 		Nonce           string
 	}{
 		ClusterID:       sourceClusterID,
 		CurrentCluster:  clusterID,
 		DatabaseVersion: dbVersion,
-		Changes:         changes,
+		Changes:         s.indexChanges(changes),
 		Clusters:        s.clusters,
+		Cluster:         s.clusterConfig(clusterID),
+		Presets:         s.presetLinks(r, preset),
+		ScopeTabs:       s.scopeTabs(r, clusterID),
 		Nonce:           GetNonce(ctx),
 	}
 
@@ -314,12 +585,126 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// indexChange is a dashboard row: a change, whether to highlight it as new, and
+// its change link.
+type indexChange struct {
+	storage.ChangeWithAnnotation
+	IsRecent bool   // Detected within the recent window
+	Link     string // Rendered change link (empty if none is configured)
+}
+
+// indexChanges builds the dashboard rows for changes.
+func (s *Server) indexChanges(changes []storage.ChangeWithAnnotation) []indexChange {
+	rows := markRecent(changes, s.recentWindow, time.Now())
+	for i := range rows {
+		rows[i].Link = s.changeLink.Render(rows[i].Change)
+	}
+	return rows
+}
+
+// markRecent flags the changes detected within window before now. A window of
+// zero or less flags none.
+func markRecent(changes []storage.ChangeWithAnnotation, window time.Duration, now time.Time) []indexChange {
+	rows := make([]indexChange, len(changes))
+	for i, c := range changes {
+		rows[i] = indexChange{
+			ChangeWithAnnotation: c,
+			IsRecent:             window > 0 && now.Sub(c.DetectedAt) <= window,
+		}
+	}
+	return rows
+}
+
+// Export formats, chosen with ?format= or the Accept header.
+const (
+	exportFormatZip  = "zip"  // CSV plus metadata JSON in a zip archive (default)
+	exportFormatCSV  = "csv"  // the changes CSV alone
+	exportFormatJSON = "json" // the changes as a JSON array
+)
+
+// exportFormat returns the format requested for /export. A ?format= parameter takes
+// precedence; otherwise the first of application/zip, text/csv, or application/json
+// listed in the Accept header is used. Browsers, which list text/html or */*, get
+// the zip archive.
+func exportFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case "":
+	case exportFormatZip, exportFormatCSV, exportFormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid format %q (use zip, csv, or json)", f)
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return exportFormatCSV, nil
+		case "application/json":
+			return exportFormatJSON, nil
+		case "application/zip", "text/html", "*/*":
+			return exportFormatZip, nil
+		}
+	}
+	return exportFormatZip, nil
+}
+
 func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	clusterID := s.getClusterID(r)
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The changes file inside the zip archive is CSV unless ?changes_format=json
+	changesFormat := exportFormatCSV
+	switch f := r.URL.Query().Get("changes_format"); f {
+	case "", exportFormatCSV:
+	case exportFormatJSON:
+		if format != exportFormatZip {
+			http.Error(w, "changes_format is only available in the zip format", http.StatusBadRequest)
+			return
+		}
+		changesFormat = f
+	default:
+		http.Error(w, fmt.Sprintf("invalid changes_format %q (use csv or json)", f), http.StatusBadRequest)
+		return
+	}
+	// The summary is a separate file, so it is only offered in the zip archive
+	// and the CSV stays purely data.
+	var summary *storage.ExportSummary
+	if v := r.URL.Query().Get("summary"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "summary must be true or false", http.StatusBadRequest)
+			return
+		}
+		if include && format != exportFormatZip {
+			http.Error(w, "summary is only available in the zip format", http.StatusBadRequest)
+			return
+		}
+		if include {
+			summary = &storage.ExportSummary{}
+		}
+	}
+	w.Header().Set("Vary", "Accept")
+
+	release, ok := s.acquireExport(w)
+	if !ok {
+		return
+	}
+	defer release()
 
 	// Get source cluster ID for filename
-	sourceClusterID, err := s.store.GetSourceClusterID(ctx, clusterID)
+	sourceClusterID, err := s.storeFor(clusterID).GetSourceClusterID(ctx, clusterID)
 	if err != nil {
 		slog.Error("Error getting source cluster ID", "error", err)
 		sourceClusterID = clusterID
@@ -328,6 +713,18 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		sourceClusterID = clusterID
 	}
 
+	switch format {
+	case exportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("crdb-cluster-history-%s.csv", sourceClusterID)))
+		s.writeExportChanges(ctx, s.newChangeWriter(w, format), clusterID, nil)
+		return
+	case exportFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		s.writeExportChanges(ctx, s.newChangeWriter(w, format), clusterID, nil)
+		return
+	}
+
 	// Set headers for zip download
 	filename := fmt.Sprintf("crdb-cluster-history-export-%s.zip", time.Now().Format("20060102-150405"))
 	w.Header().Set("Content-Type", "application/zip")
@@ -337,64 +734,209 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	zipWriter := zip.NewWriter(w)
 	defer zipWriter.Close()
 
-	// Create CSV file inside zip
-	csvFileName := fmt.Sprintf("crdb-cluster-history-%s.csv", sourceClusterID)
-	csvFile, err := zipWriter.Create(csvFileName)
+	// Create the changes file inside zip, named for its format
+	changesFileName := fmt.Sprintf("crdb-cluster-history-%s.%s", sourceClusterID, changesFormat)
+	changesFile, err := zipWriter.Create(changesFileName)
 	if err != nil {
-		slog.Error("Error creating CSV in zip", "error", err)
+		slog.Error("Error creating changes file in zip", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if !s.writeExportChanges(ctx, s.newChangeWriter(changesFile, changesFormat), clusterID, summary) {
+		return
+	}
+
+	if summary != nil {
+		summaryFile, err := zipWriter.Create(fmt.Sprintf("crdb-cluster-history-%s-summary.csv", sourceClusterID))
+		if err != nil {
+			slog.Error("Error creating summary in zip", "error", err)
+			return
+		}
+		if err := summary.WriteCSV(summaryFile, s.timeFormat); err != nil {
+			slog.Error("Error writing export summary", "error", err)
+			return
+		}
+	}
 
-	// Stream changes directly to CSV without buffering all in memory
-	csvWriter := storage.NewCSVChangeWriter(csvFile)
-	if err := csvWriter.WriteHeader(); err != nil {
-		slog.Error("Error writing CSV header", "error", err)
+	// Include the cluster's metadata (database version, source cluster ID, ...) alongside the CSV
+	md, err := s.storeFor(clusterID).GetAllMetadata(ctx, clusterID)
+	if err != nil {
+		slog.Error("Error getting cluster metadata", "cluster", clusterID, "error", err)
 		return
 	}
+	md = storage.ExportedMetadata(md, s.redactor)
+	mdFile, err := zipWriter.Create(fmt.Sprintf("crdb-cluster-history-%s-metadata.json", sourceClusterID))
+	if err != nil {
+		slog.Error("Error creating metadata in zip", "error", err)
+		return
+	}
+	if err := storage.WriteMetadataJSON(mdFile, clusterID, md); err != nil {
+		slog.Error("Error writing metadata JSON", "error", err)
+	}
+}
 
-	err = s.store.StreamChanges(ctx, clusterID, func(c storage.Change) error {
+// newChangeWriter returns a writer of changes in the given export format, csv
+// or json, with the same columns the CLI export writes.
+func (s *Server) newChangeWriter(w io.Writer, format string) storage.ChangeWriter {
+	if format == exportFormatJSON {
+		return storage.NewJSONChangeWriter(w).WithTimestampFormat(s.timeFormat)
+	}
+	return storage.NewCSVChangeWriter(w).WithTimestampFormat(s.timeFormat)
+}
+
+// writeExportChanges streams the cluster's changes to cw, reporting whether
+// every change was written. Each written change is added to summary, if any.
+func (s *Server) writeExportChanges(ctx context.Context, cw storage.ChangeWriter, clusterID string, summary *storage.ExportSummary) bool {
+	// Stream changes directly to the writer without buffering all in memory
+	if err := cw.WriteHeader(); err != nil {
+		slog.Error("Error writing export header", "error", err)
+		return false
+	}
+	write := cw.WriteChange
+	if summary != nil {
+		write = func(c storage.Change) error {
+			if err := cw.WriteChange(c); err != nil {
+				return err
+			}
+			summary.Add(c)
+			return nil
+		}
+	}
+	if !s.streamExportChanges(ctx, clusterID, write) {
+		return false
+	}
+	if err := cw.Close(); err != nil {
+		slog.Error("Error finishing export", "error", err)
+		return false
+	}
+	return true
+}
+
+// streamExportChanges passes the cluster's redacted changes to fn, reporting
+// whether every change was passed. It stops as soon as the client goes away.
+func (s *Server) streamExportChanges(ctx context.Context, clusterID string, fn func(storage.Change) error) bool {
+	err := s.storeFor(clusterID).StreamChanges(ctx, clusterID, func(c storage.Change) error {
+		// Stop streaming as soon as the client goes away
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if s.redactor != nil {
 			c = s.redactor.RedactChange(c)
 		}
-		return csvWriter.WriteChange(c)
+		return fn(c)
 	})
-	if err != nil {
-		slog.Error("Error streaming changes to CSV", "error", err)
+	if ctx.Err() != nil {
+		slog.Warn("Export aborted, client disconnected", "cluster", clusterID, "error", ctx.Err())
+		return false
 	}
-
-	csvWriter.Flush()
-	if err := csvWriter.Error(); err != nil {
-		slog.Error("CSV flush error", "error", err)
+	if err != nil {
+		slog.Error("Error streaming changes for export", "error", err)
+		return false
 	}
+	return true
 }
 
 // ClusterInfo represents cluster information for the API response.
 type ClusterInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Environment string `json:"environment,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Color       string `json:"color,omitempty"`
 }
 
-// handleAPIClusters returns the list of configured clusters as JSON.
+// handleAPIClusters returns the list of configured clusters as JSON. For
+// type-ahead, ?prefix= keeps the clusters whose ID or name starts with it
+// (ignoring case) and ?limit= caps how many are returned. Without configured
+// clusters, the IDs of the clusters with stored history are listed instead.
 func (s *Server) handleAPIClusters(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	clusters := make([]ClusterInfo, len(s.clusters))
-	for i, c := range s.clusters {
-		clusters[i] = ClusterInfo{ID: c.ID, Name: c.Name}
+	prefix := r.URL.Query().Get("prefix")
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	if len(s.clusters) == 0 {
+		ids, err := s.store.ListClustersWithPrefix(r.Context(), prefix, limit)
+		if err != nil {
+			slog.Error("Error listing clusters", "error", err)
+			s.jsonError(w, "Failed to list clusters", http.StatusInternalServerError)
+			return
+		}
+		clusters := make([]ClusterInfo, len(ids))
+		for i, id := range ids {
+			clusters[i] = ClusterInfo{ID: id, Name: id}
+		}
+		jsonResponse(w, http.StatusOK, clusters)
+		return
+	}
+
+	clusters := []ClusterInfo{}
+	lowerPrefix := strings.ToLower(prefix)
+	for _, c := range s.clusters {
+		if limit > 0 && len(clusters) == limit {
+			break
+		}
+		if !strings.HasPrefix(strings.ToLower(c.ID), lowerPrefix) && !strings.HasPrefix(strings.ToLower(c.Name), lowerPrefix) {
+			continue
+		}
+		clusters = append(clusters, ClusterInfo{
+			ID:          c.ID,
+			Name:        c.Name,
+			Environment: c.Environment,
+			Region:      c.Region,
+			Color:       c.Color,
+		})
 	}
 
 	jsonResponse(w, http.StatusOK, clusters)
 }
 
+// handleAPIClusterByID routes /api/clusters/{id}/{action} requests.
+func (s *Server) handleAPIClusterByID(w http.ResponseWriter, r *http.Request) {
+	clusterID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/clusters/"), "/")
+	if clusterID == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "pause", "resume":
+		s.handleCollectorControl(w, r, clusterID, action)
+	case "top-changes":
+		s.handleAPITopChanges(w, r, clusterID)
+	case "latest-diff":
+		s.handleAPILatestDiff(w, r, clusterID)
+	case "range-diff":
+		s.handleAPIRangeDiff(w, r, clusterID)
+	case "scorecard":
+		s.handleAPIScorecard(w, r, clusterID)
+	case "freshness":
+		s.handleAPIFreshness(w, r, clusterID)
+	case "rebaseline":
+		s.handleAPIRebaseline(w, r, clusterID)
+	case "dry-run":
+		s.handleCollectorDryRun(w, r, clusterID)
+	case "errors":
+		s.handleCollectorErrors(w, r, clusterID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 // CompareResult represents the comparison between two clusters.
 type CompareResult struct {
-	Cluster1Only []SettingDiff `json:"cluster1_only"`
-	Cluster2Only []SettingDiff `json:"cluster2_only"`
-	Different    []SettingDiff `json:"different"`
+	Cluster1Only  []SettingDiff `json:"cluster1_only"`
+	Cluster2Only  []SettingDiff `json:"cluster2_only"`
+	Different     []SettingDiff `json:"different"`
+	ExcludedCount int           `json:"excluded_count"` // Differences matching an expected-difference pattern
 }
 
 // SettingDiff represents a difference in a setting between clusters.
@@ -402,14 +944,16 @@ type SettingDiff struct {
 	Variable    string `json:"variable"`
 	Value1      string `json:"value1,omitempty"`
 	Value2      string `json:"value2,omitempty"`
+	SettingType string `json:"setting_type,omitempty"`
 	Description string `json:"description,omitempty"`
 }
 
 // TimeCompareResult represents the comparison between two snapshots in time.
 type TimeCompareResult struct {
-	BeforeOnly []SettingDiff `json:"before_only"` // Settings only in the earlier snapshot
-	AfterOnly  []SettingDiff `json:"after_only"`  // Settings only in the later snapshot
-	Different  []SettingDiff `json:"different"`   // Settings with different values
+	BeforeOnly    []SettingDiff `json:"before_only"`    // Settings only in the earlier snapshot
+	AfterOnly     []SettingDiff `json:"after_only"`     // Settings only in the later snapshot
+	Different     []SettingDiff `json:"different"`      // Settings with different values
+	ExcludedCount int           `json:"excluded_count"` // Differences matching an expected-difference pattern
 }
 
 // diffResult holds the three-way diff of two setting maps.
@@ -433,6 +977,7 @@ func compareSettings(a, b map[string]storage.Setting) diffResult {
 			result.OnlyInA = append(result.OnlyInA, SettingDiff{
 				Variable:    variable,
 				Value1:      sa.Value,
+				SettingType: sa.SettingType,
 				Description: sa.Description,
 			})
 		} else if sa.Value != sb.Value {
@@ -440,6 +985,7 @@ func compareSettings(a, b map[string]storage.Setting) diffResult {
 				Variable:    variable,
 				Value1:      sa.Value,
 				Value2:      sb.Value,
+				SettingType: sa.SettingType,
 				Description: sa.Description,
 			})
 		}
@@ -450,6 +996,7 @@ func compareSettings(a, b map[string]storage.Setting) diffResult {
 			result.OnlyInB = append(result.OnlyInB, SettingDiff{
 				Variable:    variable,
 				Value2:      sb.Value,
+				SettingType: sb.SettingType,
 				Description: sb.Description,
 			})
 		}
@@ -462,6 +1009,101 @@ func compareSettings(a, b map[string]storage.Setting) diffResult {
 	return result
 }
 
+// Sort modes accepted by the sort= query parameter of the compare endpoints.
+const (
+	SortByVariable    = "variable"
+	SortByType        = "type"
+	SortBySensitivity = "sensitivity"
+)
+
+// parseSortMode returns the sort= query parameter, defaulting to SortByVariable.
+func parseSortMode(r *http.Request) (string, bool) {
+	switch mode := r.URL.Query().Get("sort"); mode {
+	case "", SortByVariable:
+		return SortByVariable, true
+	case SortByType, SortBySensitivity:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// isSensitive reports whether a variable is sensitive under the default or configured redaction patterns.
+func (s *Server) isSensitive(variable string) bool {
+	if s.redactor != nil && s.redactor.ShouldRedact(variable) {
+		return true
+	}
+	return storage.IsSensitive(variable)
+}
+
+// sortDiff orders each bucket of a diff by the given mode, using the variable name as a tie-breaker.
+// compareSettings already returns buckets sorted by variable, so SortByVariable is a no-op.
+func (s *Server) sortDiff(diff diffResult, mode string) {
+	var less func(a, b SettingDiff) bool
+	switch mode {
+	case SortByType:
+		less = func(a, b SettingDiff) bool { return a.SettingType < b.SettingType }
+	case SortBySensitivity:
+		// Sensitive settings first
+		less = func(a, b SettingDiff) bool { return s.isSensitive(a.Variable) && !s.isSensitive(b.Variable) }
+	default:
+		return
+	}
+
+	for _, bucket := range [][]SettingDiff{diff.OnlyInA, diff.OnlyInB, diff.Different} {
+		sort.SliceStable(bucket, func(i, j int) bool { return less(bucket[i], bucket[j]) })
+	}
+}
+
+// ignorePatterns returns the configured expected-difference globs plus any
+// comma-separated globs passed in the ignore= query parameter.
+func (s *Server) ignorePatterns(r *http.Request) []string {
+	patterns := append([]string(nil), s.expectedDiffs...)
+	for _, p := range strings.Split(r.URL.Query().Get("ignore"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// excludeExpected removes diffs whose variable matches any of the patterns,
+// returning the filtered diff and the number of entries removed.
+func excludeExpected(diff diffResult, patterns []string) (diffResult, int) {
+	if len(patterns) == 0 {
+		return diff, 0
+	}
+
+	excluded := 0
+	filter := func(diffs []SettingDiff) []SettingDiff {
+		kept := make([]SettingDiff, 0, len(diffs))
+		for _, d := range diffs {
+			if matchesAny(patterns, d.Variable) {
+				excluded++
+				continue
+			}
+			kept = append(kept, d)
+		}
+		return kept
+	}
+
+	result := diffResult{
+		OnlyInA:   filter(diff.OnlyInA),
+		OnlyInB:   filter(diff.OnlyInB),
+		Different: filter(diff.Different),
+	}
+	return result, excluded
+}
+
+func matchesAny(patterns []string, variable string) bool {
+	for _, p := range patterns {
+		if storage.MatchGlob(p, variable) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleCompare renders the comparison page.
 func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 	data := struct {
@@ -487,6 +1129,11 @@ func (s *Server) handleAPICompare(w http.ResponseWriter, r *http.Request) {
 
 	cluster1 := r.URL.Query().Get("cluster1")
 	cluster2 := r.URL.Query().Get("cluster2")
+	sortMode, ok := parseSortMode(r)
+	if !ok {
+		s.jsonError(w, "sort must be one of: variable, type, sensitivity", http.StatusBadRequest)
+		return
+	}
 
 	if cluster1 == "" || cluster2 == "" {
 		s.jsonError(w, "cluster1 and cluster2 query parameters are required", http.StatusBadRequest)
@@ -498,33 +1145,61 @@ func (s *Server) handleAPICompare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(r.Context(), s.compareTimeout)
+	defer cancel()
 
 	// Get settings for both clusters
-	settings1, err := s.store.GetLatestSnapshot(ctx, cluster1)
+	settings1, err := s.latestSnapshot(ctx, cluster1)
 	if err != nil {
-		slog.Error("Error getting settings for cluster", "cluster", cluster1, "error", err)
-		s.jsonError(w, "Failed to get settings for cluster1", http.StatusInternalServerError)
+		s.compareLoadError(w, ctx, err, "Failed to get settings for cluster1", "cluster", cluster1)
 		return
 	}
 
-	settings2, err := s.store.GetLatestSnapshot(ctx, cluster2)
+	settings2, err := s.latestSnapshot(ctx, cluster2)
 	if err != nil {
-		slog.Error("Error getting settings for cluster", "cluster", cluster2, "error", err)
-		s.jsonError(w, "Failed to get settings for cluster2", http.StatusInternalServerError)
+		s.compareLoadError(w, ctx, err, "Failed to get settings for cluster2", "cluster", cluster2)
 		return
 	}
 
-	diff := compareSettings(settings1, settings2)
+	if !s.checkCompareSize(w, settings1, settings2) {
+		return
+	}
+
+	diff, excluded := excludeExpected(compareSettings(settings1, settings2), s.ignorePatterns(r))
+	s.sortDiff(diff, sortMode)
+	s.redactDiff(diff)
 	result := CompareResult{
-		Cluster1Only: diff.OnlyInA,
-		Cluster2Only: diff.OnlyInB,
-		Different:    diff.Different,
+		Cluster1Only:  diff.OnlyInA,
+		Cluster2Only:  diff.OnlyInB,
+		Different:     diff.Different,
+		ExcludedCount: excluded,
 	}
 
 	jsonResponse(w, http.StatusOK, result)
 }
 
+// compareLoadError reports a failure to load one side of a comparison: 503 when the
+// compare timeout ran out, 500 otherwise.
+func (s *Server) compareLoadError(w http.ResponseWriter, ctx context.Context, err error, msg string, logArgs ...any) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("Compare timed out", append(logArgs, "timeout", s.compareTimeout)...)
+		s.jsonError(w, fmt.Sprintf("comparison timed out after %s; try again later", s.compareTimeout), http.StatusServiceUnavailable)
+		return
+	}
+	slog.Error(msg, append(logArgs, "error", err)...)
+	s.jsonError(w, msg, http.StatusInternalServerError)
+}
+
+// checkCompareSize rejects comparisons of more than maxCompare settings with 413.
+func (s *Server) checkCompareSize(w http.ResponseWriter, a, b map[string]storage.Setting) bool {
+	if total := len(a) + len(b); total > s.maxCompare {
+		slog.Warn("Compare too large", "settings", total, "max", s.maxCompare)
+		s.jsonError(w, fmt.Sprintf("comparison too large: %d settings exceeds the limit of %d", total, s.maxCompare), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
+
 // handleFleet renders the multi-cluster fleet comparison page.
 func (s *Server) handleFleet(w http.ResponseWriter, r *http.Request) {
 	data := struct {
@@ -558,12 +1233,12 @@ func (s *Server) handleAPIClusterSettings(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if !s.isValidCluster(clusterID) {
+	if !config.IsValidHistoryID(clusterID) || !s.isValidCluster(clusterID) {
 		s.jsonError(w, "invalid cluster ID", http.StatusBadRequest)
 		return
 	}
 
-	settings, err := s.store.GetLatestSnapshot(r.Context(), clusterID)
+	settings, err := s.latestSnapshot(r.Context(), clusterID)
 	if err != nil {
 		slog.Error("Error getting settings for cluster", "cluster", clusterID, "error", err)
 		s.jsonError(w, "Failed to get settings", http.StatusInternalServerError)
@@ -572,6 +1247,10 @@ func (s *Server) handleAPIClusterSettings(w http.ResponseWriter, r *http.Request
 
 	result := make(map[string]ClusterSettingResponse, len(settings))
 	for variable, setting := range settings {
+		if s.redactor != nil {
+			setting.Value = s.redactor.RedactValue(variable, setting.Value)
+			setting.Description = s.redactor.RedactDescription(variable, setting.Description)
+		}
 		result[variable] = ClusterSettingResponse{
 			Value:       setting.Value,
 			Description: setting.Description,
@@ -583,13 +1262,19 @@ func (s *Server) handleAPIClusterSettings(w http.ResponseWriter, r *http.Request
 
 // handleHistory renders the time-based comparison page.
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	data := struct {
 		Clusters       []config.ClusterConfig
 		CurrentCluster string
 		Nonce          string
 	}{
 		Clusters:       s.clusters,
-		CurrentCluster: s.getClusterID(r),
+		CurrentCluster: clusterID,
 		Nonce:          GetNonce(r.Context()),
 	}
 
@@ -606,30 +1291,118 @@ func (s *Server) handleAPISnapshots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clusterID := r.URL.Query().Get("cluster")
-	if clusterID == "" {
-		clusterID = s.defaultClusterID
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	limitStr := r.URL.Query().Get("limit")
-	limit := DefaultSnapshotLimit
+	limit := s.limits.SnapshotPageSize
 	if limitStr != "" {
-		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= MaxSnapshotLimit {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= s.limits.MaxSnapshots {
 			limit = parsed
 		}
 	}
 
 	ctx := r.Context()
-	snapshots, err := s.store.ListSnapshots(ctx, clusterID, limit)
+	snapshots, err := s.storeFor(clusterID).ListSnapshots(ctx, clusterID, limit)
 	if err != nil {
 		slog.Error("Error listing snapshots", "cluster", clusterID, "error", err)
 		s.jsonError(w, "Failed to list snapshots", http.StatusInternalServerError)
 		return
 	}
+	for i := range snapshots {
+		snapshots[i].CollectedAt = s.timeFormat.Apply(snapshots[i].CollectedAt)
+	}
 
 	jsonResponse(w, http.StatusOK, snapshots)
 }
 
+// SnapshotBatchRequest is the request body for POST /api/snapshots/batch.
+type SnapshotBatchRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// SnapshotBatchResponse maps each found snapshot ID to its settings. IDs that do
+// not exist are listed in Missing rather than failing the whole request.
+type SnapshotBatchResponse struct {
+	Snapshots map[int64]map[string]ClusterSettingResponse `json:"snapshots"`
+	Missing   []int64                                     `json:"missing"`
+}
+
+// handleAPISnapshotsBatch returns the settings of up to MaxSnapshotBatch snapshots
+// in one request, so a timeline view does not need one request per snapshot.
+func (s *Server) handleAPISnapshotsBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SnapshotBatchRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		s.jsonError(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > MaxSnapshotBatch {
+		s.jsonError(w, fmt.Sprintf("at most %d snapshot IDs may be requested at once", MaxSnapshotBatch), http.StatusBadRequest)
+		return
+	}
+	clusterID, err := s.lookupCluster(r, "cluster")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	resp := SnapshotBatchResponse{
+		Snapshots: make(map[int64]map[string]ClusterSettingResponse, len(req.IDs)),
+		Missing:   []int64{},
+	}
+	seen := make(map[int64]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		settings, err := s.getSnapshotByID(ctx, clusterID, id)
+		if s.ambiguousID(w, err) {
+			return
+		}
+		if err != nil {
+			slog.Error("Error getting snapshot", "snapshot", id, "error", err)
+			s.jsonError(w, "Failed to get snapshots", http.StatusInternalServerError)
+			return
+		}
+		if settings == nil {
+			resp.Missing = append(resp.Missing, id)
+			continue
+		}
+
+		result := make(map[string]ClusterSettingResponse, len(settings))
+		for variable, setting := range settings {
+			value, description := setting.Value, setting.Description
+			if s.redactor != nil {
+				value = s.redactor.RedactValue(variable, value)
+				description = s.redactor.RedactDescription(variable, description)
+			}
+			result[variable] = ClusterSettingResponse{
+				Value:       value,
+				Description: description,
+			}
+		}
+		resp.Snapshots[id] = result
+	}
+
+	jsonResponse(w, http.StatusOK, resp)
+}
+
 // handleAPICompareSnapshots returns the comparison between two snapshots as JSON.
 func (s *Server) handleAPICompareSnapshots(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -662,13 +1435,33 @@ func (s *Server) handleAPICompareSnapshots(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	ctx := r.Context()
+	cluster1, err := s.lookupCluster(r, "cluster1")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cluster2, err := s.lookupCluster(r, "cluster2")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortMode, ok := parseSortMode(r)
+	if !ok {
+		s.jsonError(w, "sort must be one of: variable, type, sensitivity", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.compareTimeout)
+	defer cancel()
 
 	// Get settings for both snapshots
-	settings1, err := s.store.GetSnapshotByID(ctx, snapshot1ID)
+	settings1, err := s.getSnapshotByID(ctx, cluster1, snapshot1ID)
+	if s.ambiguousID(w, err) {
+		return
+	}
 	if err != nil {
-		slog.Error("Error getting snapshot", "snapshot", snapshot1ID, "error", err)
-		s.jsonError(w, "Failed to get snapshot1", http.StatusInternalServerError)
+		s.compareLoadError(w, ctx, err, "Failed to get snapshot1", "snapshot", snapshot1ID)
 		return
 	}
 	if settings1 == nil {
@@ -676,10 +1469,12 @@ func (s *Server) handleAPICompareSnapshots(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	settings2, err := s.store.GetSnapshotByID(ctx, snapshot2ID)
+	settings2, err := s.getSnapshotByID(ctx, cluster2, snapshot2ID)
+	if s.ambiguousID(w, err) {
+		return
+	}
 	if err != nil {
-		slog.Error("Error getting snapshot", "snapshot", snapshot2ID, "error", err)
-		s.jsonError(w, "Failed to get snapshot2", http.StatusInternalServerError)
+		s.compareLoadError(w, ctx, err, "Failed to get snapshot2", "snapshot", snapshot2ID)
 		return
 	}
 	if settings2 == nil {
@@ -687,27 +1482,94 @@ func (s *Server) handleAPICompareSnapshots(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	diff := compareSettings(settings1, settings2)
+	if !s.checkCompareSize(w, settings1, settings2) {
+		return
+	}
+
+	diff, excluded := excludeExpected(compareSettings(settings1, settings2), s.ignorePatterns(r))
+	s.sortDiff(diff, sortMode)
+	s.redactDiff(diff)
 	result := TimeCompareResult{
-		BeforeOnly: diff.OnlyInA,
-		AfterOnly:  diff.OnlyInB,
-		Different:  diff.Different,
+		BeforeOnly:    diff.OnlyInA,
+		AfterOnly:     diff.OnlyInB,
+		Different:     diff.Different,
+		ExcludedCount: excluded,
 	}
 
 	jsonResponse(w, http.StatusOK, result)
 }
 
-// handleAnnotations handles POST /api/annotations to create a new annotation.
-func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// msgInvalidSeverity is reported for a severity other than info, warning, or critical.
+const msgInvalidSeverity = "severity must be one of info, warning, critical"
+
+// Methods served by the annotation routes, advertised in the Allow header.
+var (
+	annotationsMethods    = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	annotationByIDMethods = []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions}
+)
+
+// checkMethod answers OPTIONS with 204 and rejects methods not in allowed with
+// 405, setting the Allow header in both cases. It reports whether the caller
+// should go on to serve the request.
+func checkMethod(w http.ResponseWriter, r *http.Request, allowed []string) bool {
+	if r.Method != http.MethodOptions && slices.Contains(allowed, r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+	return false
+}
+
+// handleAnnotations handles GET /api/annotations to list annotations and
+// POST /api/annotations to create a new annotation.
+func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, annotationsMethods) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		s.listAnnotations(w, r)
+	} else {
+		s.createAnnotation(w, r)
+	}
+}
+
+// listAnnotations returns recent annotations, newest first, optionally filtered
+// by ?severity=.
+func (s *Server) listAnnotations(w http.ResponseWriter, r *http.Request) {
+	severity := r.URL.Query().Get("severity")
+	if severity != "" && !storage.IsValidSeverity(severity) {
+		s.jsonError(w, msgInvalidSeverity, http.StatusBadRequest)
+		return
+	}
+
+	limit := s.limits.PageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= s.limits.MaxChanges {
+			limit = parsed
+		}
+	}
+
+	annotations, err := s.recentAnnotations(r.Context(), severity, limit)
+	if err != nil {
+		slog.Error("Error listing annotations", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	resp := make([]AnnotationResponse, len(annotations))
+	for i := range annotations {
+		resp[i] = s.annotationToResponse(&annotations[i])
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (s *Server) createAnnotation(w http.ResponseWriter, r *http.Request) {
 	var req AnnotationRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+	if !s.decodeAnnotationRequest(w, r, &req) {
 		return
 	}
 
@@ -719,10 +1581,31 @@ func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
 		s.jsonError(w, "content is required", http.StatusBadRequest)
 		return
 	}
+	if req.Severity == "" {
+		req.Severity = storage.SeverityInfo
+	}
+	if !storage.IsValidSeverity(req.Severity) {
+		s.jsonError(w, msgInvalidSeverity, http.StatusBadRequest)
+		return
+	}
 
 	username := s.getUsernameFromRequest(r)
 
-	ann, err := s.store.CreateAnnotation(r.Context(), req.ChangeID, req.Content, username)
+	clusterID, err := s.lookupCluster(r, "cluster")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, err := s.storeForChange(r.Context(), clusterID, req.ChangeID)
+	if s.ambiguousID(w, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding change", "change", req.ChangeID, "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	ann, err := store.CreateAnnotation(r.Context(), req.ChangeID, req.Content, req.Severity, username)
 	if err != nil {
 		slog.Error("Error creating annotation", "error", err)
 		var pgErr *pgconn.PgError
@@ -745,6 +1628,9 @@ func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
 
 // handleAnnotationByID handles GET, PUT, DELETE /api/annotations/{id}
 func (s *Server) handleAnnotationByID(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, annotationByIDMethods) {
+		return
+	}
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/annotations/")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -752,20 +1638,27 @@ func (s *Server) handleAnnotationByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	clusterID, err := s.lookupCluster(r, "cluster")
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		s.getAnnotation(w, r, id)
+		s.getAnnotation(w, r, clusterID, id)
 	case http.MethodPut:
-		s.updateAnnotation(w, r, id)
+		s.updateAnnotation(w, r, clusterID, id)
 	case http.MethodDelete:
-		s.deleteAnnotation(w, r, id)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.deleteAnnotation(w, r, clusterID, id)
 	}
 }
 
-func (s *Server) getAnnotation(w http.ResponseWriter, r *http.Request, id int64) {
-	ann, err := s.store.GetAnnotation(r.Context(), id)
+func (s *Server) getAnnotation(w http.ResponseWriter, r *http.Request, clusterID string, id int64) {
+	ann, _, err := s.findAnnotation(r.Context(), clusterID, id)
+	if s.ambiguousID(w, err) {
+		return
+	}
 	if err != nil {
 		slog.Error("Error getting annotation", "error", err)
 		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
@@ -779,11 +1672,9 @@ func (s *Server) getAnnotation(w http.ResponseWriter, r *http.Request, id int64)
 	jsonResponse(w, http.StatusOK, s.annotationToResponse(ann))
 }
 
-func (s *Server) updateAnnotation(w http.ResponseWriter, r *http.Request, id int64) {
+func (s *Server) updateAnnotation(w http.ResponseWriter, r *http.Request, clusterID string, id int64) {
 	var req AnnotationRequest
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+	if !s.decodeAnnotationRequest(w, r, &req) {
 		return
 	}
 
@@ -791,10 +1682,20 @@ func (s *Server) updateAnnotation(w http.ResponseWriter, r *http.Request, id int
 		s.jsonError(w, "content is required", http.StatusBadRequest)
 		return
 	}
+	if req.Severity != "" && !storage.IsValidSeverity(req.Severity) {
+		s.jsonError(w, msgInvalidSeverity, http.StatusBadRequest)
+		return
+	}
 
 	username := s.getUsernameFromRequest(r)
 
-	err := s.store.UpdateAnnotation(r.Context(), id, req.Content, username)
+	_, store, err := s.findAnnotation(r.Context(), clusterID, id)
+	if err == nil {
+		err = store.UpdateAnnotation(r.Context(), id, req.Content, req.Severity, username)
+	}
+	if s.ambiguousID(w, err) {
+		return
+	}
 	if err == pgx.ErrNoRows {
 		s.jsonError(w, "Annotation not found", http.StatusNotFound)
 		return
@@ -805,7 +1706,7 @@ func (s *Server) updateAnnotation(w http.ResponseWriter, r *http.Request, id int
 		return
 	}
 
-	ann, err := s.store.GetAnnotation(r.Context(), id)
+	ann, err := store.GetAnnotation(r.Context(), id)
 	if err != nil || ann == nil {
 		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -814,8 +1715,14 @@ func (s *Server) updateAnnotation(w http.ResponseWriter, r *http.Request, id int
 	jsonResponse(w, http.StatusOK, s.annotationToResponse(ann))
 }
 
-func (s *Server) deleteAnnotation(w http.ResponseWriter, r *http.Request, id int64) {
-	err := s.store.DeleteAnnotation(r.Context(), id)
+func (s *Server) deleteAnnotation(w http.ResponseWriter, r *http.Request, clusterID string, id int64) {
+	_, store, err := s.findAnnotation(r.Context(), clusterID, id)
+	if err == nil {
+		err = store.DeleteAnnotation(r.Context(), id)
+	}
+	if s.ambiguousID(w, err) {
+		return
+	}
 	if err == pgx.ErrNoRows {
 		s.jsonError(w, "Annotation not found", http.StatusNotFound)
 		return
@@ -841,22 +1748,46 @@ func (s *Server) jsonError(w http.ResponseWriter, message string, status int) {
 	jsonResponse(w, status, ErrorResponse{Error: message})
 }
 
+// decodeAnnotationRequest decodes an annotation request body of at most 1 MB,
+// rejecting fields AnnotationRequest doesn't have so a misspelled field isn't
+// silently dropped. It writes a 400 naming the unexpected field, or reporting
+// invalid JSON, and returns false when the body can't be decoded.
+func (s *Server) decodeAnnotationRequest(w http.ResponseWriter, r *http.Request, req *AnnotationRequest) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			s.jsonError(w, "Unknown field "+field, http.StatusBadRequest)
+		} else {
+			s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		}
+		return false
+	}
+	return true
+}
+
 func (s *Server) annotationToResponse(a *storage.Annotation) AnnotationResponse {
 	resp := AnnotationResponse{
 		ID:        a.ID,
 		ChangeID:  a.ChangeID,
 		Content:   a.Content,
+		Severity:  a.Severity,
 		CreatedBy: a.CreatedBy,
-		CreatedAt: a.CreatedAt.Format(time.RFC3339),
+		CreatedAt: s.timeFormat.Format(a.CreatedAt),
 		UpdatedBy: a.UpdatedBy,
 	}
 	if !a.UpdatedAt.IsZero() {
-		resp.UpdatedAt = a.UpdatedAt.Format(time.RFC3339)
+		resp.UpdatedAt = s.timeFormat.Format(a.UpdatedAt)
 	}
 	return resp
 }
 
 func (s *Server) getUsernameFromRequest(r *http.Request) string {
+	// Set by the auth middleware for bearer tokens
+	if username := auth.UsernameFromContext(r.Context()); username != "" {
+		return username
+	}
 	username, _, _ := r.BasicAuth()
 	if username != "" {
 		return username
@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -133,6 +134,102 @@ func TestHandleIndexWithChanges(t *testing.T) {
 	}
 }
 
+func TestMarkRecent(t *testing.T) {
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	changes := []storage.ChangeWithAnnotation{
+		{ID: 1, Change: storage.Change{Variable: "recent", DetectedAt: now.Add(-time.Hour)}},
+		{ID: 2, Change: storage.Change{Variable: "old", DetectedAt: now.Add(-25 * time.Hour)}},
+	}
+
+	rows := markRecent(changes, 24*time.Hour, now)
+	if len(rows) != 2 || !rows[0].IsRecent || rows[1].IsRecent {
+		t.Errorf("Expected only the change within 24h to be recent, got %+v", rows)
+	}
+	if rows[0].ID != 1 || rows[0].Variable != "recent" {
+		t.Errorf("Expected the change fields to be kept, got %+v", rows[0])
+	}
+
+	for _, row := range markRecent(changes, 0, now) {
+		if row.IsRecent {
+			t.Errorf("Expected no recent changes with the window disabled, got %+v", row)
+		}
+	}
+}
+
+func TestHandleIndexHighlightsRecentChanges(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.SaveSnapshotWithChanges(ctx, "default", []storage.Setting{{Variable: "a.b", Value: "1"}}, "v1.0")
+	store.SaveSnapshotWithChanges(ctx, "default", []storage.Setting{{Variable: "a.b", Value: "2"}}, "v1.0")
+
+	for _, tt := range []struct {
+		window time.Duration
+		want   bool
+	}{
+		{time.Hour, true},
+		{0, false},
+	} {
+		server, err := New(store, WithRecentWindow(tt.window))
+		if err != nil {
+			t.Fatalf("Failed to create web server: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := strings.Contains(w.Body.String(), `class="new-badge"`); got != tt.want {
+			t.Errorf("window %v: expected new badge = %v, got %v", tt.window, tt.want, got)
+		}
+	}
+}
+
+func TestLandingPageRedirect(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	server, err := New(store, WithDefaultClusterID("default"), WithLandingPage("/compare"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantLoc  string
+	}{
+		{"/", http.StatusFound, "/compare"},
+		{"/?cluster=default", http.StatusFound, "/compare?cluster=default"},
+		{"/dashboard", http.StatusOK, ""},
+		{"/compare", http.StatusOK, ""},
+		{"/history", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.wantLoc {
+				t.Errorf("Expected Location %q, got %q", tt.wantLoc, loc)
+			}
+		})
+	}
+
+	// Without the option, "/" serves the dashboard
+	server, err = New(store, WithDefaultClusterID("default"), WithLandingPage("/"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
 func TestHandleIndexNoChanges(t *testing.T) {
 	_, _, server := setupTest(t)
 
@@ -213,6 +310,41 @@ func TestHandleExportZipContainsCSV(t *testing.T) {
 	}
 }
 
+func TestHandleExportClientDisconnected(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	store.CleanupOldChanges(ctx, testClusterID, 0)
+	for i := range 3 {
+		settings := []storage.Setting{{Variable: "export.disconnect.setting", Value: fmt.Sprint(i), SettingType: "s"}}
+		if err := store.SaveSnapshot(ctx, testClusterID, settings, "v25.1.0"); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(reqCtx)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	body := w.Body.Bytes()
+	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	for _, f := range zipReader.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if strings.Contains(string(content), "export.disconnect.setting") {
+			t.Error("Expected no rows to be streamed after the client disconnected")
+		}
+	}
+}
+
 func TestHandleExportWithChanges(t *testing.T) {
 	ctx, store, server := setupTest(t)
 
@@ -307,6 +439,234 @@ func TestHandleExportWithClusterID(t *testing.T) {
 	}
 }
 
+func TestHandleExportIncludesMetadata(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	const clusterID = "export-metadata"
+	for k, v := range map[string]string{
+		"source_cluster_id":          "src-1234",
+		"database_version":           "CockroachDB CCL v25.1.0",
+		"license.key":                "secret-value",
+		storage.MetadataExportMarker: "42",
+	} {
+		if err := store.SetMetadata(ctx, clusterID, k, v); err != nil {
+			t.Fatalf("SetMetadata(%s) failed: %v", k, err)
+		}
+	}
+
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	server, err := New(store, WithDefaultClusterID(clusterID), WithRedactor(redactor))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body := w.Body.Bytes()
+	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+
+	var mdFile *zip.File
+	for _, f := range zipReader.File {
+		if f.Name == "crdb-cluster-history-src-1234-metadata.json" {
+			mdFile = f
+		}
+	}
+	if mdFile == nil {
+		t.Fatalf("Expected metadata file in zip, got %d files", len(zipReader.File))
+	}
+
+	rc, err := mdFile.Open()
+	if err != nil {
+		t.Fatalf("Failed to open metadata file: %v", err)
+	}
+	defer rc.Close()
+	var md storage.MetadataExport
+	if err := json.NewDecoder(rc).Decode(&md); err != nil {
+		t.Fatalf("Failed to parse metadata JSON: %v", err)
+	}
+
+	if md.ClusterID != clusterID {
+		t.Errorf("Expected cluster_id %q, got %q", clusterID, md.ClusterID)
+	}
+	if got := md.Metadata["database_version"]; got != "CockroachDB CCL v25.1.0" {
+		t.Errorf("Expected database_version in metadata, got %q", got)
+	}
+	if got := md.Metadata["license.key"]; got != storage.RedactedPlaceholder {
+		t.Errorf("Expected sensitive metadata to be redacted, got %q", got)
+	}
+	if got, ok := md.Metadata[storage.MetadataExportMarker]; ok {
+		t.Errorf("Expected the export marker left out of the metadata, got %q", got)
+	}
+}
+
+func TestHandleExportContentNegotiation(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	const clusterID = "export-formats"
+	for _, v := range []string{"1", "2"} {
+		settings := []storage.Setting{{Variable: "kv.format.test", Value: v}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, clusterID, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	server, err := New(store, WithDefaultClusterID(clusterID))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantType   string
+		wantPrefix string
+	}{
+		{"no accept header", "", "", "application/zip", "PK"},
+		{"browser", "", "text/html,application/xhtml+xml,*/*;q=0.8", "application/zip", "PK"},
+		{"zip", "", "application/zip", "application/zip", "PK"},
+		{"csv", "", "text/csv", "text/csv; charset=utf-8", "cluster_id,detected_at,"},
+		{"json", "", "application/json", "application/json", "[\n{"},
+		{"first listed wins", "", "application/json, text/csv", "application/json", "[\n{"},
+		{"query beats accept", "?format=csv", "application/json", "text/csv; charset=utf-8", "cluster_id,detected_at,"},
+		{"query zip", "?format=zip", "text/csv", "application/zip", "PK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/export"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.wantType, got)
+			}
+			if !strings.HasPrefix(w.Body.String(), tt.wantPrefix) {
+				t.Errorf("Expected body starting with %q, got %.40q", tt.wantPrefix, w.Body.String())
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+
+	// The JSON export is an array of changes with the CSV's columns, as the
+	// CLI export writes them
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	var changes []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Failed to parse JSON export: %v", err)
+	}
+	if len(changes) != 1 || changes[0]["variable"] != "kv.format.test" || changes[0]["new_value"] != "2" || changes[0]["cluster_id"] != clusterID {
+		t.Errorf("Unexpected JSON export: %+v", changes)
+	}
+	stored, err := store.GetChanges(ctx, clusterID, 10)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	var want strings.Builder
+	if err := storage.WriteChangesJSON(&want, clusterID, stored); err != nil {
+		t.Fatalf("WriteChangesJSON failed: %v", err)
+	}
+	if w.Body.String() != want.String() {
+		t.Errorf("JSON export = %s, want the CLI's %s", w.Body.String(), want.String())
+	}
+
+	// The zip archive can hold the changes as JSON instead of CSV
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?format=zip&changes_format=json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	var entry *zip.File
+	for _, f := range zipReader.File {
+		if f.Name == "crdb-cluster-history-"+clusterID+".json" {
+			entry = f
+		}
+		if strings.HasSuffix(f.Name, clusterID+".csv") {
+			t.Errorf("Expected no CSV changes file with changes_format=json, got %s", f.Name)
+		}
+	}
+	if entry == nil {
+		t.Fatalf("Expected a JSON changes file in the zip")
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", entry.Name, err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != want.String() {
+		t.Errorf("Zip JSON entry = %s, want %s", body, want.String())
+	}
+
+	for _, query := range []string{"?format=csv&changes_format=json", "?changes_format=xml"} {
+		w = httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	// The CSV export names the file after the cluster
+	req = httptest.NewRequest(http.MethodGet, "/export?format=csv", nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "crdb-cluster-history-"+clusterID+".csv") {
+		t.Errorf("Expected CSV filename in Content-Disposition, got %q", got)
+	}
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 2 {
+		t.Errorf("Expected a header and one row, got %q", w.Body.String())
+	}
+}
+
+func TestHandleExportEmptyJSONAndInvalidFormat(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	server, err := New(store, WithDefaultClusterID("empty"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?format=json", nil))
+	if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+		t.Errorf("Expected an empty JSON array, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?format=xml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+}
+
 func cleanupAnnotationTestData(t *testing.T, store *storage.Store, ctx context.Context) {
 	t.Helper()
 	store.CleanupOldChanges(ctx, testClusterID, 0)
@@ -436,7 +796,7 @@ func TestAnnotationAPI_Update(t *testing.T) {
 	cleanupAnnotationTestData(t, store, ctx)
 	changeID := createTestChange(t, store, ctx)
 
-	ann, err := store.CreateAnnotation(ctx, changeID, "Original content", "user1")
+	ann, err := store.CreateAnnotation(ctx, changeID, "Original content", storage.SeverityInfo, "user1")
 	if err != nil {
 		t.Fatalf("Failed to create annotation: %v", err)
 	}
@@ -468,7 +828,7 @@ func TestAnnotationAPI_Delete(t *testing.T) {
 	cleanupAnnotationTestData(t, store, ctx)
 	changeID := createTestChange(t, store, ctx)
 
-	ann, err := store.CreateAnnotation(ctx, changeID, "To be deleted", "user")
+	ann, err := store.CreateAnnotation(ctx, changeID, "To be deleted", storage.SeverityInfo, "user")
 	if err != nil {
 		t.Fatalf("Failed to create annotation: %v", err)
 	}
@@ -504,7 +864,7 @@ func TestAnnotationAPI_InvalidID(t *testing.T) {
 func TestAnnotationAPI_MethodNotAllowed(t *testing.T) {
 	_, _, server := setupTest(t)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/annotations", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/api/annotations", nil)
 	w := httptest.NewRecorder()
 
 	server.Handler().ServeHTTP(w, req)
@@ -514,6 +874,153 @@ func TestAnnotationAPI_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestAnnotationAPI_AllowedMethods(t *testing.T) {
+	server, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		method    string
+		path      string
+		wantCode  int
+		wantAllow string
+	}{
+		{http.MethodOptions, "/api/annotations", http.StatusNoContent, "GET, POST, OPTIONS"},
+		{http.MethodDelete, "/api/annotations", http.StatusMethodNotAllowed, "GET, POST, OPTIONS"},
+		{http.MethodPatch, "/api/annotations", http.StatusMethodNotAllowed, "GET, POST, OPTIONS"},
+		{http.MethodOptions, "/api/annotations/1", http.StatusNoContent, "GET, PUT, DELETE, OPTIONS"},
+		{http.MethodPost, "/api/annotations/1", http.StatusMethodNotAllowed, "GET, PUT, DELETE, OPTIONS"},
+		{http.MethodOptions, "/api/annotations/not-a-number", http.StatusNoContent, "GET, PUT, DELETE, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected %d, got %d", tt.wantCode, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.wantAllow, got)
+			}
+			if tt.wantCode == http.StatusNoContent && w.Body.Len() != 0 {
+				t.Errorf("Expected an empty body, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnnotationAPI_InvalidSeverity(t *testing.T) {
+	server, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"create", http.MethodPost, "/api/annotations", `{"change_id":1,"content":"note","severity":"urgent"}`},
+		{"update", http.MethodPut, "/api/annotations/1", `{"content":"note","severity":"CRITICAL"}`},
+		{"list filter", http.MethodGet, "/api/annotations?severity=high", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), "severity must be one of") {
+				t.Errorf("Expected severity error, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnnotationAPI_UnknownFields(t *testing.T) {
+	server, store := newGraphQLTestServer(t)
+	store.annotations[1] = &storage.Annotation{ID: 1, ChangeID: 1, Content: "old", Severity: storage.SeverityInfo}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create with a typo", http.MethodPost, "/api/annotations", `{"change_id":2,"contnet":"note"}`, http.StatusBadRequest, `Unknown field \"contnet\"`},
+		{"update with a typo", http.MethodPut, "/api/annotations/1", `{"content":"note","severtiy":"critical"}`, http.StatusBadRequest, `Unknown field \"severtiy\"`},
+		{"create", http.MethodPost, "/api/annotations", `{"change_id":2,"content":"note","severity":"warning"}`, http.StatusCreated, `"content":"note"`},
+		{"update", http.MethodPut, "/api/annotations/1", `{"content":"updated","severity":"critical"}`, http.StatusOK, `"content":"updated"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected %s in the response, got %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnnotationAPI_ListBySeverity(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	cleanupAnnotationTestData(t, store, ctx)
+	changeID := createTestChange(t, store, ctx)
+
+	body := strings.NewReader(fmt.Sprintf(`{"change_id":%d,"content":"Breaks rangefeeds","severity":"critical"}`, changeID))
+	req := httptest.NewRequest(http.MethodPost, "/api/annotations", body)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created AnnotationResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Severity != storage.SeverityCritical {
+		t.Errorf("Expected severity critical, got %q", created.Severity)
+	}
+
+	list := func(query string) []AnnotationResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/annotations"+query, nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var anns []AnnotationResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &anns); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return anns
+	}
+
+	critical := list("?severity=critical")
+	if len(critical) == 0 || critical[0].ID != created.ID {
+		t.Errorf("Expected the critical annotation, got %+v", critical)
+	}
+	for _, a := range list("?severity=info") {
+		if a.ID == created.ID {
+			t.Error("Expected critical annotation to be excluded from info")
+		}
+	}
+}
+
 func TestHandleAPIClusters(t *testing.T) {
 	_, _, server := setupTest(t)
 
@@ -646,6 +1153,187 @@ func TestHandleAPICompareMissingParams(t *testing.T) {
 	}
 }
 
+func TestSortDiffModes(t *testing.T) {
+	a := map[string]storage.Setting{
+		"b.setting":       {Variable: "b.setting", Value: "1", SettingType: "i"},
+		"a.setting":       {Variable: "a.setting", Value: "1", SettingType: "s"},
+		"server.password": {Variable: "server.password", Value: "x", SettingType: "s"},
+		"c.setting":       {Variable: "c.setting", Value: "1", SettingType: "b"},
+	}
+	b := map[string]storage.Setting{
+		"b.setting":       {Variable: "b.setting", Value: "2", SettingType: "i"},
+		"a.setting":       {Variable: "a.setting", Value: "2", SettingType: "s"},
+		"server.password": {Variable: "server.password", Value: "y", SettingType: "s"},
+		"c.setting":       {Variable: "c.setting", Value: "2", SettingType: "b"},
+	}
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{SortByVariable, []string{"a.setting", "b.setting", "c.setting", "server.password"}},
+		{SortByType, []string{"c.setting", "b.setting", "a.setting", "server.password"}},
+		{SortBySensitivity, []string{"server.password", "a.setting", "b.setting", "c.setting"}},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			diff := compareSettings(a, b)
+			s.sortDiff(diff, tt.mode)
+
+			var got []string
+			for _, d := range diff.Different {
+				got = append(got, d.Variable)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected order %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExcludeExpected(t *testing.T) {
+	a := map[string]storage.Setting{
+		"kv.snapshot_rebalance.max_rate": {Value: "32 MiB"},
+		"sql.defaults.distsql":           {Value: "auto"},
+		"server.mem_budget":              {Value: "1GiB"},
+	}
+	b := map[string]storage.Setting{
+		"kv.snapshot_rebalance.max_rate": {Value: "64 MiB"},
+		"sql.defaults.distsql":           {Value: "on"},
+		"kv.snapshot_rebalance.burst":    {Value: "1"},
+	}
+
+	diff, excluded := excludeExpected(compareSettings(a, b), []string{"kv.snapshot_rebalance.*", "server.mem_budget"})
+
+	if excluded != 3 {
+		t.Errorf("Expected 3 excluded differences, got %d", excluded)
+	}
+	if len(diff.Different) != 1 || diff.Different[0].Variable != "sql.defaults.distsql" {
+		t.Errorf("Expected only sql.defaults.distsql in Different, got %+v", diff.Different)
+	}
+	if len(diff.OnlyInA) != 0 || len(diff.OnlyInB) != 0 {
+		t.Errorf("Expected excluded settings to be removed from only buckets, got %+v / %+v", diff.OnlyInA, diff.OnlyInB)
+	}
+
+	diff, excluded = excludeExpected(compareSettings(a, b), nil)
+	if excluded != 0 || len(diff.Different) != 2 {
+		t.Errorf("Expected no exclusions without patterns, got %d excluded and %d different", excluded, len(diff.Different))
+	}
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	s := &Server{expectedDiffs: []string{"kv.*"}}
+	req := httptest.NewRequest(http.MethodGet, "/api/compare?ignore=sql.*,%20server.mem_budget,", nil)
+
+	got := s.ignorePatterns(req)
+	want := []string{"kv.*", "sql.*", "server.mem_budget"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ignorePatterns() = %v, want %v", got, want)
+	}
+	if len(s.expectedDiffs) != 1 {
+		t.Error("ignorePatterns must not modify the configured patterns")
+	}
+}
+
+func TestHandleAPICompareExpectedDifferences(t *testing.T) {
+	ctx, store, server := setupTest(t, WithExpectedDifferences([]string{"expected.capacity.*"}))
+
+	store.SaveSnapshot(ctx, "expected-cluster1", []storage.Setting{
+		{Variable: "expected.capacity.rate", Value: "1", SettingType: "z"},
+		{Variable: "expected.other", Value: "1", SettingType: "s"},
+		{Variable: "expected.unexpected", Value: "1", SettingType: "s"},
+	}, "v1.0")
+	store.SaveSnapshot(ctx, "expected-cluster2", []storage.Setting{
+		{Variable: "expected.capacity.rate", Value: "2", SettingType: "z"},
+		{Variable: "expected.other", Value: "2", SettingType: "s"},
+		{Variable: "expected.unexpected", Value: "2", SettingType: "s"},
+	}, "v1.0")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/compare?cluster1=expected-cluster1&cluster2=expected-cluster2&ignore=expected.other", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result CompareResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.ExcludedCount != 2 {
+		t.Errorf("Expected 2 excluded differences, got %d", result.ExcludedCount)
+	}
+	if len(result.Different) != 1 || result.Different[0].Variable != "expected.unexpected" {
+		t.Errorf("Expected only expected.unexpected in Different, got %+v", result.Different)
+	}
+}
+
+func TestParseSortMode(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   string
+		wantOK bool
+	}{
+		{"", SortByVariable, true},
+		{"sort=variable", SortByVariable, true},
+		{"sort=type", SortByType, true},
+		{"sort=sensitivity", SortBySensitivity, true},
+		{"sort=bogus", "", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/compare?"+tt.query, nil)
+		got, ok := parseSortMode(req)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseSortMode(%q) = %q, %v; want %q, %v", tt.query, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestHandleAPICompareSortParam(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	settings1 := []storage.Setting{
+		{Variable: "sort.test.a", Value: "1", SettingType: "s"},
+		{Variable: "sort.test.b", Value: "1", SettingType: "b"},
+	}
+	store.SaveSnapshot(ctx, "sort-cluster1", settings1, "v1.0")
+	settings2 := []storage.Setting{
+		{Variable: "sort.test.a", Value: "2", SettingType: "s"},
+		{Variable: "sort.test.b", Value: "2", SettingType: "b"},
+	}
+	store.SaveSnapshot(ctx, "sort-cluster2", settings2, "v1.0")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/compare?cluster1=sort-cluster1&cluster2=sort-cluster2&sort=type", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result CompareResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(result.Different) != 2 || result.Different[0].Variable != "sort.test.b" {
+		t.Errorf("Expected sort.test.b (type b) first, got %+v", result.Different)
+	}
+
+	for _, path := range []string{
+		"/api/compare?cluster1=sort-cluster1&cluster2=sort-cluster2&sort=bogus",
+		"/api/compare-snapshots?snapshot1=1&snapshot2=2&sort=bogus",
+	} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		w = httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for invalid sort, got %d", path, w.Code)
+		}
+	}
+}
+
 func TestHandleIndexWithClusterParam(t *testing.T) {
 	ctx, store, server := setupTest(t, WithDefaultClusterID("other-cluster"))
 
@@ -674,7 +1362,7 @@ func TestHandleIndexWithClusterParam(t *testing.T) {
 }
 
 func TestHandleAPISnapshots(t *testing.T) {
-	clusterID := "api-snapshots-test-" + time.Now().Format("20060102150405.000")
+	clusterID := fmt.Sprintf("api-snapshots-test-%d", time.Now().UnixNano())
 	ctx, store, server := setupTest(t, WithDefaultClusterID(clusterID))
 
 	settings := []storage.Setting{
@@ -836,6 +1524,210 @@ func TestHandleAPICompareSnapshots(t *testing.T) {
 	}
 }
 
+func TestHandleAPICompareSnapshotsAcrossClusters(t *testing.T) {
+	suffix := time.Now().Format("20060102150405.000")
+	prodID, stagingID := "compare-prod-"+suffix, "compare-staging-"+suffix
+	ctx, store, server := setupTest(t)
+
+	// Staging before the release, then prod now
+	store.SaveSnapshot(ctx, stagingID, []storage.Setting{
+		{Variable: "compare.release.flag", Value: "off", SettingType: "b"},
+		{Variable: "compare.release.shared", Value: "same", SettingType: "s"},
+	}, "v1.0")
+	store.SaveSnapshot(ctx, prodID, []storage.Setting{
+		{Variable: "compare.release.flag", Value: "on", SettingType: "b"},
+		{Variable: "compare.release.shared", Value: "same", SettingType: "s"},
+	}, "v1.0")
+
+	staging, err := store.ListSnapshots(ctx, stagingID, 1)
+	if err != nil || len(staging) != 1 {
+		t.Fatalf("Failed to get staging snapshot: %v", err)
+	}
+	prod, err := store.ListSnapshots(ctx, prodID, 1)
+	if err != nil || len(prod) != 1 {
+		t.Fatalf("Failed to get prod snapshot: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/compare-snapshots?snapshot1=%d&snapshot2=%d", staging[0].ID, prod[0].ID), nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result TimeCompareResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(result.Different) != 1 || result.Different[0].Variable != "compare.release.flag" ||
+		result.Different[0].Value1 != "off" || result.Different[0].Value2 != "on" {
+		t.Errorf("Expected compare.release.flag off → on, got %+v", result.Different)
+	}
+	if len(result.BeforeOnly) != 0 || len(result.AfterOnly) != 0 {
+		t.Errorf("Expected no one-sided settings, got %+v / %+v", result.BeforeOnly, result.AfterOnly)
+	}
+}
+
+// blockingSnapshotStore is a Store whose snapshot reads wait for the request
+// context to end, simulating a history database that is too slow to answer.
+type blockingSnapshotStore struct{ Store }
+
+func (blockingSnapshotStore) GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]storage.Setting, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingSnapshotStore) GetSnapshotByID(ctx context.Context, snapshotID int64) (map[string]storage.Setting, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHandleAPICompareLimits(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, cluster := range []string{"big1", "big2"} {
+		settings := []storage.Setting{
+			{Variable: "a", Value: "1", SettingType: "s"},
+			{Variable: "b", Value: "2", SettingType: "s"},
+		}
+		if _, err := store.SaveSnapshotWithChanges(ctx, cluster, settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	snapshots, err := store.ListSnapshots(ctx, "big1", 1)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("ListSnapshots = %+v, %v", snapshots, err)
+	}
+	others, err := store.ListSnapshots(ctx, "big2", 1)
+	if err != nil || len(others) != 1 {
+		t.Fatalf("ListSnapshots = %+v, %v", others, err)
+	}
+	compareSnapshotsURL := fmt.Sprintf("/api/compare-snapshots?snapshot1=%d&snapshot2=%d", snapshots[0].ID, others[0].ID)
+
+	tests := []struct {
+		name  string
+		store Store
+		max   int
+		url   string
+		want  int
+	}{
+		{"clusters within limit", store, 4, "/api/compare?cluster1=big1&cluster2=big2", http.StatusOK},
+		{"clusters over limit", store, 3, "/api/compare?cluster1=big1&cluster2=big2", http.StatusRequestEntityTooLarge},
+		{"snapshots over limit", store, 3, compareSnapshotsURL, http.StatusRequestEntityTooLarge},
+		{"clusters timeout", blockingSnapshotStore{}, 0, "/api/compare?cluster1=big1&cluster2=big2", http.StatusServiceUnavailable},
+		{"snapshots timeout", blockingSnapshotStore{}, 0, "/api/compare-snapshots?snapshot1=1&snapshot2=2", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(tt.store, WithCompareLimits(50*time.Millisecond, tt.max))
+			if err != nil {
+				t.Fatalf("Failed to create web server: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAPISnapshotsBatch(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, v := range []string{"1", "2"} {
+		settings := []storage.Setting{
+			{Variable: "batch.setting", Value: v, SettingType: "s"},
+			{Variable: "server.secret.token", Value: "hunter2", SettingType: "s", Description: "Token, e.g. hunter2"},
+		}
+		if _, err := store.SaveSnapshotWithChanges(ctx, "batch", settings, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	snapshots, err := store.ListSnapshots(ctx, "batch", 10)
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("ListSnapshots = %+v, %v", snapshots, err)
+	}
+
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true})
+	server, err := New(store, WithRedactor(redactor))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	newest, oldest := snapshots[0].ID, snapshots[1].ID
+	missing := newest + 1000
+	body := fmt.Sprintf(`{"ids":[%d,%d,%d,%d]}`, newest, missing, oldest, newest)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/snapshots/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp SnapshotBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(resp.Snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(resp.Snapshots))
+	}
+	if got := resp.Snapshots[oldest]["batch.setting"].Value; got != "1" {
+		t.Errorf("Expected oldest snapshot value 1, got %q", got)
+	}
+	if got := resp.Snapshots[newest]["batch.setting"].Value; got != "2" {
+		t.Errorf("Expected newest snapshot value 2, got %q", got)
+	}
+	if got := resp.Snapshots[newest]["server.secret.token"].Value; got != storage.RedactedPlaceholder {
+		t.Errorf("Expected sensitive value to be redacted, got %q", got)
+	}
+	if got := resp.Snapshots[newest]["server.secret.token"].Description; got != "Token, e.g. hunter2" {
+		t.Errorf("Expected description to be kept without description redaction, got %q", got)
+	}
+	if len(resp.Missing) != 1 || resp.Missing[0] != missing {
+		t.Errorf("Expected missing [%d], got %v", missing, resp.Missing)
+	}
+}
+
+func TestHandleAPISnapshotsBatchValidation(t *testing.T) {
+	server, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	ids := make([]string, MaxSnapshotBatch+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, "{", http.StatusBadRequest},
+		{"no IDs", http.MethodPost, `{"ids":[]}`, http.StatusBadRequest},
+		{"over cap", http.MethodPost, `{"ids":[` + strings.Join(ids, ",") + `]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, "/api/snapshots/batch", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestHandleHistory(t *testing.T) {
 	clusters := []config.ClusterConfig{
 		{ID: "prod", Name: "Production", DatabaseURL: "postgresql://prod"},
@@ -896,6 +1788,270 @@ func TestWithClusters(t *testing.T) {
 	}
 }
 
+func TestWithMetrics(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("crdb_cluster_history_setting_changes_total 0\n"))
+	})
+
+	server, err := New(nil, WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "setting_changes_total") {
+		t.Errorf("Expected metrics output, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	ctx, store, server := setupTest(t, WithVersion("v1.2.3"))
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp VersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Version != "v1.2.3" {
+		t.Errorf("Expected version v1.2.3, got %q", resp.Version)
+	}
+	if resp.SchemaVersion != storage.LatestSchemaVersion() || resp.LatestSchemaVersion != storage.LatestSchemaVersion() {
+		t.Errorf("Expected schema at the latest version %d, got %+v", storage.LatestSchemaVersion(), resp)
+	}
+	applied, _ := store.SchemaMigrations(ctx)
+	if len(resp.Migrations) != len(applied) {
+		t.Errorf("Expected %d migrations, got %d", len(applied), len(resp.Migrations))
+	}
+}
+
+func TestHandleVersionFileStore(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	server, err := New(store, WithVersion("dev"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp VersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Version != "dev" || resp.SchemaVersion != 0 || resp.Migrations == nil || len(resp.Migrations) != 0 {
+		t.Errorf("Expected dev with no schema migrations, got %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestGetClusterID(t *testing.T) {
+	clusters := []config.ClusterConfig{
+		{ID: "prod", Name: "Production"},
+		{ID: "staging", Name: "Staging"},
+		{ID: "prod.app", Name: "Production (app)", Tenant: "app"},
+	}
+	server, err := New(nil, WithClusters(clusters), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr error
+	}{
+		{"default", "", "prod", nil},
+		{"known cluster", "cluster=staging", "staging", nil},
+		{"unknown cluster", "cluster=dev", "", errUnknownCluster},
+		{"invalid characters", "cluster=" + url.QueryEscape("prod' OR 1=1"), "", errInvalidClusterID},
+		{"tenant", "cluster=prod.app", "prod.app", nil},
+		{"unknown tenant", "cluster=prod.us", "", errUnknownCluster},
+		{"invalid tenant", "cluster=prod.US", "", errInvalidClusterID},
+		{"two dots", "cluster=prod.app.us", "", errInvalidClusterID},
+		{"slash", "cluster=" + url.QueryEscape("../prod"), "", errInvalidClusterID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			got, err := server.getClusterID(req)
+			if err != tt.wantErr {
+				t.Fatalf("getClusterID() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getClusterID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClusterIDWithoutConfiguredClusters(t *testing.T) {
+	server, err := New(nil, WithDefaultClusterID("default"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?cluster=anything-goes", nil)
+	if got, err := server.getClusterID(req); err != nil || got != "anything-goes" {
+		t.Errorf("Expected well-formed ID to pass without configured clusters, got %q, %v", got, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/?cluster=bad%20id", nil)
+	if _, err := server.getClusterID(req); err != errInvalidClusterID {
+		t.Errorf("Expected errInvalidClusterID, got %v", err)
+	}
+}
+
+func TestClusterScopedEndpointsRejectBadClusterParam(t *testing.T) {
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production"}}
+	server, err := New(nil, WithClusters(clusters), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	for _, path := range []string{"/", "/export", "/history", "/api/changes", "/api/snapshots", "/api/cluster-settings"} {
+		for _, cluster := range []string{"unknown", "bad%3Bid"} {
+			req := httptest.NewRequest(http.MethodGet, path+"?cluster="+cluster, nil)
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s?cluster=%s: expected 400, got %d", path, cluster, w.Code)
+			}
+		}
+	}
+}
+
+func TestHandleAPIClustersDisplayMetadata(t *testing.T) {
+	clusters := []config.ClusterConfig{
+		{ID: "prod", Name: "Production", DatabaseURL: "postgresql://prod", Environment: "production", Region: "us-east-1", Color: "#d32f2f"},
+		{ID: "dev", Name: "Dev", DatabaseURL: "postgresql://dev"},
+	}
+
+	_, _, server := setupTest(t, WithClusters(clusters))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/clusters", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var result []ClusterInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 clusters, got %d", len(result))
+	}
+
+	want := ClusterInfo{ID: "prod", Name: "Production", Environment: "production", Region: "us-east-1", Color: "#d32f2f"}
+	if result[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, result[0])
+	}
+	if result[1].Environment != "" || result[1].Region != "" || result[1].Color != "" {
+		t.Errorf("Expected no display metadata for dev, got %+v", result[1])
+	}
+	if strings.Contains(w.Body.String(), `"environment":""`) {
+		t.Error("Expected empty display metadata to be omitted from JSON")
+	}
+}
+
+func TestHandleAPIClustersPrefixAndLimit(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	clusters := []config.ClusterConfig{
+		{ID: "prod-east", Name: "Production East"},
+		{ID: "prod-west", Name: "Production West"},
+		{ID: "staging", Name: "Staging"},
+		{ID: "qa", Name: "Pre-production"},
+	}
+	configured, err := New(store, WithClusters(clusters))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, id := range []string{"fleet-a", "fleet-b", "other"} {
+		if err := store.SetDatabaseVersion(context.Background(), id, "v25.4.2"); err != nil {
+			t.Fatalf("SetDatabaseVersion failed: %v", err)
+		}
+	}
+	unconfigured, err := New(store)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		server *Server
+		query  string
+		want   []string
+	}{
+		{"no filter", configured, "", []string{"prod-east", "prod-west", "staging", "qa"}},
+		{"id prefix", configured, "?prefix=prod", []string{"prod-east", "prod-west"}},
+		{"name prefix ignoring case", configured, "?prefix=pre", []string{"qa"}},
+		{"limit", configured, "?prefix=prod&limit=1", []string{"prod-east"}},
+		{"no match", configured, "?prefix=dev", []string{}},
+		{"stored clusters", unconfigured, "?prefix=fleet-", []string{"fleet-a", "fleet-b"}},
+		{"stored clusters with limit", unconfigured, "?limit=2", []string{"fleet-a", "fleet-b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/clusters"+tt.query, nil))
+			var result []ClusterInfo
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			got := []string{}
+			for _, c := range result {
+				got = append(got, c.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleIndexDisplayMetadata(t *testing.T) {
+	clusters := []config.ClusterConfig{
+		{ID: "prod", Name: "Production", DatabaseURL: "postgresql://prod", Environment: "production", Region: "us-east-1", Color: "#d32f2f"},
+		{ID: "dev", Name: "Dev", DatabaseURL: "postgresql://dev"},
+	}
+
+	_, _, server := setupTest(t, WithClusters(clusters), WithDefaultClusterID("prod"))
+
+	req := httptest.NewRequest(http.MethodGet, "/?cluster=prod", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Production [production]") {
+		t.Error("Expected environment label in cluster selector")
+	}
+	if !strings.Contains(body, "env-badge") || !strings.Contains(body, "us-east-1") {
+		t.Error("Expected environment/region badge in page header")
+	}
+	if !strings.Contains(body, "#d32f2f") {
+		t.Error("Expected cluster color in page header")
+	}
+}
+
 func testAuthConfig() auth.Config {
 	hash, _ := auth.HashPassword("secret")
 	return auth.Config{
@@ -935,7 +2091,7 @@ func TestHandleFleet(t *testing.T) {
 func TestHandleAPIClusterSettings(t *testing.T) {
 	ctx, store, server := setupTest(t)
 
-	clusterID := "fleet-test-cluster-" + time.Now().Format("20060102150405.000")
+	clusterID := fmt.Sprintf("fleet-test-cluster-%d", time.Now().UnixNano())
 
 	settings := []storage.Setting{
 		{Variable: "fleet.test.setting1", Value: "value1", SettingType: "s", Description: "Test setting 1"},
@@ -1119,3 +2275,47 @@ func TestHandleLogout(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleAPISnapshotsBatchRedactsDescriptions(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	settings := []storage.Setting{
+		{Variable: "batch.setting", Value: "1", SettingType: "s", Description: "A plain setting"},
+		{Variable: "server.secret.token", Value: "hunter2", SettingType: "s", Description: "Token, e.g. hunter2"},
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "batch", settings, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	snapshots, err := store.ListSnapshots(ctx, "batch", 1)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("ListSnapshots = %+v, %v", snapshots, err)
+	}
+
+	redactor := storage.NewRedactor(storage.RedactorConfig{Enabled: true, Descriptions: true})
+	server, err := New(store, WithRedactor(redactor))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+
+	body := fmt.Sprintf(`{"ids":[%d]}`, snapshots[0].ID)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/snapshots/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp SnapshotBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	got := resp.Snapshots[snapshots[0].ID]
+	if d := got["server.secret.token"].Description; d != storage.RedactedPlaceholder {
+		t.Errorf("Expected sensitive description to be redacted, got %q", d)
+	}
+	if d := got["batch.setting"].Description; d != "A plain setting" {
+		t.Errorf("Expected non-sensitive description to be kept, got %q", d)
+	}
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"crdb-cluster-history/storage"
+)
+
+// DefaultSnapshotCacheTTL is how long the server reuses a cluster's latest snapshot.
+const DefaultSnapshotCacheTTL = 10 * time.Second
+
+// SnapshotCache keeps each cluster's latest snapshot for a short time, so busy
+// dashboards and compares don't reload it from the history database on every
+// request. It holds one entry per cluster. Values are cached unredacted; callers
+// redact what they return.
+//
+// A SnapshotCache is also a collector.Notifier: a collection that detected
+// changes drops the cluster's entry, so the new snapshot is seen at once.
+type SnapshotCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]snapshotCacheEntry
+	drops   uint64 // incremented by Invalidate, so a load racing it isn't cached
+}
+
+type snapshotCacheEntry struct {
+	settings map[string]storage.Setting
+	loadedAt time.Time
+}
+
+// NewSnapshotCache creates a cache whose entries expire after ttl.
+func NewSnapshotCache(ttl time.Duration) *SnapshotCache {
+	return &SnapshotCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]snapshotCacheEntry),
+	}
+}
+
+// WithSnapshotCache serves latest snapshots through c. Without it every request
+// reads the history database.
+func WithSnapshotCache(c *SnapshotCache) Option {
+	return func(s *Server) {
+		s.snapshotCache = c
+	}
+}
+
+// Notify drops the cached snapshot of a cluster whose collection detected changes.
+func (c *SnapshotCache) Notify(ctx context.Context, clusterID string, changes []storage.Change) {
+	c.Invalidate(clusterID)
+}
+
+// Invalidate drops the cached snapshot of a cluster.
+func (c *SnapshotCache) Invalidate(clusterID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, clusterID)
+	c.drops++
+}
+
+// latest returns the cluster's latest snapshot, loading it from store when it is
+// not cached or has expired. The returned map is the caller's to modify.
+func (c *SnapshotCache) latest(ctx context.Context, store Store, clusterID string) (map[string]storage.Setting, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[clusterID]
+	drops := c.drops
+	c.mu.Unlock()
+	if ok && now.Sub(entry.loadedAt) < c.ttl {
+		return maps.Clone(entry.settings), nil
+	}
+
+	settings, err := store.GetLatestSnapshot(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.drops == drops {
+		c.entries[clusterID] = snapshotCacheEntry{settings: settings, loadedAt: now}
+	}
+	c.mu.Unlock()
+	return maps.Clone(settings), nil
+}
+
+// latestSnapshot returns a cluster's latest snapshot, through the snapshot cache
+// if one is configured.
+func (s *Server) latestSnapshot(ctx context.Context, clusterID string) (map[string]storage.Setting, error) {
+	if s.snapshotCache == nil {
+		return s.storeFor(clusterID).GetLatestSnapshot(ctx, clusterID)
+	}
+	return s.snapshotCache.latest(ctx, s.storeFor(clusterID), clusterID)
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+// countingSnapshotStore counts GetLatestSnapshot calls reaching the store.
+type countingSnapshotStore struct {
+	Store
+	loads atomic.Int64
+}
+
+func (s *countingSnapshotStore) GetLatestSnapshot(ctx context.Context, clusterID string) (map[string]storage.Setting, error) {
+	s.loads.Add(1)
+	return s.Store.GetLatestSnapshot(ctx, clusterID)
+}
+
+func newCountingSnapshotStore(t *testing.T) (*countingSnapshotStore, *storage.FileStore) {
+	t.Helper()
+	fs, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if _, err := fs.SaveSnapshotWithChanges(context.Background(), "prod", []storage.Setting{{Variable: "a", Value: "1"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	return &countingSnapshotStore{Store: fs}, fs
+}
+
+func TestSnapshotCache(t *testing.T) {
+	ctx := context.Background()
+	store, fs := newCountingSnapshotStore(t)
+	cache := NewSnapshotCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	get := func() string {
+		t.Helper()
+		settings, err := cache.latest(ctx, store, "prod")
+		if err != nil {
+			t.Fatalf("latest failed: %v", err)
+		}
+		return settings["a"].Value
+	}
+
+	if v := get(); v != "1" || store.loads.Load() != 1 {
+		t.Fatalf("First load = %q after %d store reads, want 1 after 1", v, store.loads.Load())
+	}
+
+	// A hit serves the cached snapshot, even though the store has moved on
+	if _, err := fs.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a", Value: "2"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	now = now.Add(59 * time.Second)
+	if v := get(); v != "1" || store.loads.Load() != 1 {
+		t.Errorf("Cache hit = %q after %d store reads, want 1 after 1", v, store.loads.Load())
+	}
+
+	// An expired entry is reloaded
+	now = now.Add(time.Second)
+	if v := get(); v != "2" || store.loads.Load() != 2 {
+		t.Errorf("After expiry = %q after %d store reads, want 2 after 2", v, store.loads.Load())
+	}
+
+	// A collection that detected changes drops the entry
+	changes, err := fs.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a", Value: "3"}}, "v1.0")
+	if err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	cache.Notify(ctx, "prod", changes)
+	if v := get(); v != "3" || store.loads.Load() != 3 {
+		t.Errorf("After Notify = %q after %d store reads, want 3 after 3", v, store.loads.Load())
+	}
+
+	// Callers may modify what they get without affecting the cache
+	settings, _ := cache.latest(ctx, store, "prod")
+	delete(settings, "a")
+	if v := get(); v != "3" {
+		t.Errorf("Cached snapshot modified through a returned map: a = %q", v)
+	}
+}
+
+func TestSnapshotCacheRedactsAfterCaching(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, v := range []string{"old", "new"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "server.secret", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	// Both servers share one cache; the plain server fills it first
+	cache := NewSnapshotCache(time.Minute)
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production"}}
+	current := func(opts ...Option) string {
+		t.Helper()
+		server, err := New(store, append(opts, WithClusters(clusters), WithDefaultClusterID("prod"), WithSnapshotCache(cache))...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/changes/context", nil))
+		var got []ChangeInContext
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].Current == nil {
+			t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		return got[0].Current.Value
+	}
+
+	if v := current(); v != "new" {
+		t.Errorf("Unredacted current = %q, want new", v)
+	}
+	if v := current(WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true}))); v != storage.RedactedPlaceholder {
+		t.Errorf("Redacted current = %q, want %q", v, storage.RedactedPlaceholder)
+	}
+}
+
+func TestCachedSettingsAreRedacted(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, cluster := range []string{"prod", "staging"} {
+		if _, err := store.SaveSnapshotWithChanges(ctx, cluster, []storage.Setting{{Variable: "server.secret", Value: "hunter2-" + cluster, Description: "e.g. hunter2"}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	server, err := New(store,
+		WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}),
+		WithDefaultClusterID("prod"),
+		WithSnapshotCache(NewSnapshotCache(time.Minute)),
+		WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true, Descriptions: true})))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(target string, v any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", target, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: failed to parse JSON: %v", target, err)
+		}
+	}
+
+	// Twice, so that the second request is served from the cache
+	for range 2 {
+		var settings map[string]ClusterSettingResponse
+		get("/api/cluster-settings?cluster=prod", &settings)
+		if got := settings["server.secret"]; got.Value != storage.RedactedPlaceholder || got.Description != storage.RedactedPlaceholder {
+			t.Errorf("cluster-settings server.secret = %+v, want both redacted", got)
+		}
+
+		var result CompareResult
+		get("/api/compare?cluster1=prod&cluster2=staging", &result)
+		if len(result.Different) != 1 {
+			t.Fatalf("Expected the secret to differ, got %+v", result)
+		}
+		if d := result.Different[0]; d.Value1 != storage.RedactedPlaceholder || d.Value2 != storage.RedactedPlaceholder || d.Description != storage.RedactedPlaceholder {
+			t.Errorf("compare diff = %+v, want values and description redacted", d)
+		}
+	}
+}
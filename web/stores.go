@@ -0,0 +1,205 @@
+package web
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"crdb-cluster-history/config"
+
+	"crdb-cluster-history/storage"
+)
+
+// WithClusterStores routes the history of the given clusters to their own
+// stores, for fleets that split history across several databases. Clusters not
+// in the map and subscriptions use the store passed to New. Annotations are kept
+// in the store holding the change they describe.
+//
+// Snapshot, change and annotation IDs are only unique within a store, since each
+// database and file store numbers its own rows. Lookups by ID take the cluster
+// the ID belongs to when the client gives one, and otherwise try every store.
+func WithClusterStores(stores map[string]Store) Option {
+	return func(s *Server) {
+		s.clusterStores = stores
+	}
+}
+
+// storeFor returns the store holding a cluster's history.
+func (s *Server) storeFor(clusterID string) Store {
+	if store, ok := s.clusterStores[clusterID]; ok {
+		return store
+	}
+	return s.store
+}
+
+// allStores returns every distinct store, the primary first.
+func (s *Server) allStores() []Store {
+	stores := []Store{s.store}
+	for _, store := range s.clusterStores {
+		if !slices.Contains(stores, store) {
+			stores = append(stores, store)
+		}
+	}
+	return stores
+}
+
+// errAmbiguousID is returned by the lookups by ID when no cluster was given and
+// more than one store holds the ID.
+var errAmbiguousID = errors.New("ID exists in more than one history store; pass the cluster it belongs to")
+
+// lookupStores returns the stores a lookup by ID tries: the cluster's store when
+// a cluster is given, or every store.
+func (s *Server) lookupStores(clusterID string) []Store {
+	if clusterID != "" {
+		return []Store{s.storeFor(clusterID)}
+	}
+	return s.allStores()
+}
+
+// lookupCluster returns the cluster named by the given query parameter to scope
+// a lookup by ID, or "" when it is absent. Unlike getClusterID there is no
+// default, so an absent parameter tries every store.
+func (s *Server) lookupCluster(r *http.Request, param string) (string, error) {
+	clusterID := r.URL.Query().Get(param)
+	if clusterID == "" {
+		return "", nil
+	}
+	if !config.IsValidHistoryID(clusterID) {
+		return "", errInvalidClusterID
+	}
+	if !s.isValidCluster(clusterID) {
+		return "", errUnknownCluster
+	}
+	return clusterID, nil
+}
+
+// ambiguousID responds 409 and returns true when err is errAmbiguousID, so the
+// client can repeat the request with the cluster.
+func (s *Server) ambiguousID(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, errAmbiguousID) {
+		return false
+	}
+	s.jsonError(w, err.Error(), http.StatusConflict)
+	return true
+}
+
+// getSnapshotByID looks a snapshot up in the stores given by lookupStores. It
+// returns nil if none has it, and errAmbiguousID if more than one does.
+func (s *Server) getSnapshotByID(ctx context.Context, clusterID string, snapshotID int64) (map[string]storage.Setting, error) {
+	var found map[string]storage.Setting
+	for _, store := range s.lookupStores(clusterID) {
+		settings, err := store.GetSnapshotByID(ctx, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if settings != nil {
+			if found != nil {
+				return nil, errAmbiguousID
+			}
+			found = settings
+		}
+	}
+	return found, nil
+}
+
+// getRawOutput looks a snapshot's raw collection output up in the stores given
+// by lookupStores. It returns nil if none has any, and errAmbiguousID if more
+// than one does.
+func (s *Server) getRawOutput(ctx context.Context, clusterID string, snapshotID int64) (json.RawMessage, error) {
+	var found json.RawMessage
+	for _, store := range s.lookupStores(clusterID) {
+		raw, err := store.GetRawOutput(ctx, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			if found != nil {
+				return nil, errAmbiguousID
+			}
+			found = raw
+		}
+	}
+	return found, nil
+}
+
+// storeForChange returns the store holding a change: the cluster's store when a
+// cluster is given, or else the one store that has the change, and
+// errAmbiguousID if more than one does. A change no store holds is left to the
+// primary store, which reports it as missing.
+func (s *Server) storeForChange(ctx context.Context, clusterID string, changeID int64) (Store, error) {
+	if clusterID != "" {
+		return s.storeFor(clusterID), nil
+	}
+	if len(s.clusterStores) == 0 {
+		return s.store, nil
+	}
+	var found Store
+	for _, store := range s.allStores() {
+		ok, err := store.HasChange(ctx, changeID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if found != nil {
+				return nil, errAmbiguousID
+			}
+			found = store
+		}
+	}
+	if found == nil {
+		return s.store, nil
+	}
+	return found, nil
+}
+
+// findAnnotation looks an annotation up in the stores given by lookupStores,
+// returning it with the store holding it, and errAmbiguousID if more than one
+// store has it. An annotation no store holds is returned as nil with the primary
+// store, which reports it as missing to updates and deletes.
+func (s *Server) findAnnotation(ctx context.Context, clusterID string, id int64) (*storage.Annotation, Store, error) {
+	var found *storage.Annotation
+	var holder Store
+	for _, store := range s.lookupStores(clusterID) {
+		ann, err := store.GetAnnotation(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ann != nil {
+			if found != nil {
+				return nil, nil, errAmbiguousID
+			}
+			found, holder = ann, store
+		}
+	}
+	if found == nil {
+		return nil, s.store, nil
+	}
+	return found, holder, nil
+}
+
+// recentAnnotations returns the most recently created annotations across every
+// store, newest first, optionally only those with the given severity.
+func (s *Server) recentAnnotations(ctx context.Context, severity string, limit int) ([]storage.Annotation, error) {
+	stores := s.allStores()
+	if len(stores) == 1 {
+		return s.store.ListAnnotations(ctx, severity, limit)
+	}
+	annotations := []storage.Annotation{}
+	for _, store := range stores {
+		found, err := store.ListAnnotations(ctx, severity, limit)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, found...)
+	}
+	slices.SortStableFunc(annotations, func(a, b storage.Annotation) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	if len(annotations) > limit {
+		annotations = annotations[:limit]
+	}
+	return annotations, nil
+}
@@ -0,0 +1,365 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// unreachableStore is a store whose database can't be reached.
+type unreachableStore struct {
+	*storage.FileStore
+	err error
+}
+
+func (s unreachableStore) Ping(ctx context.Context) error { return s.err }
+
+func TestHealthReportsUnreachableStore(t *testing.T) {
+	primary, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	shard, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	down := unreachableStore{shard, errors.New("failed to connect to `host=history-b user=history password=hunter2 database=cluster_history`: dial error")}
+	server, err := New(primary, WithClusterStores(map[string]Store{"staging": down}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+	want := "unhealthy\nerror: history database unreachable: failed to connect to `host=history-b user=history password=xxxxx database=cluster_history`: dial error"
+	if rec.Body.String() != want {
+		t.Errorf("Expected body %q, got %q", want, rec.Body.String())
+	}
+}
+
+func TestClusterStoresRouteByCluster(t *testing.T) {
+	ctx := context.Background()
+	primary, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	shard, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if _, err := primary.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a.b", Value: "1"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	if _, err := shard.SaveSnapshotWithChanges(ctx, "staging", []storage.Setting{{Variable: "a.b", Value: "2"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	clusters := []config.ClusterConfig{{ID: "prod", Name: "Production"}, {ID: "staging", Name: "Staging"}}
+	server, err := New(primary,
+		WithClusters(clusters),
+		WithDefaultClusterID("prod"),
+		WithClusterStores(map[string]Store{"staging": shard}),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	t.Run("Compare", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/compare?cluster1=prod&cluster2=staging", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result CompareResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(result.Different) != 1 || result.Different[0].Value1 != "1" || result.Different[0].Value2 != "2" {
+			t.Errorf("Expected a.b to differ between the two stores, got %+v", result)
+		}
+	})
+
+	t.Run("Snapshots", func(t *testing.T) {
+		for clusterID, want := range map[string]int{"prod": 1, "staging": 1} {
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/snapshots?cluster="+clusterID, nil))
+			var snapshots []storage.SnapshotInfo
+			if err := json.NewDecoder(rec.Body).Decode(&snapshots); err != nil {
+				t.Fatalf("%s: failed to decode response: %v", clusterID, err)
+			}
+			if len(snapshots) != want {
+				t.Errorf("%s: expected %d snapshots, got %d", clusterID, want, len(snapshots))
+			}
+		}
+	})
+
+	t.Run("Health", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+}
+
+// annotatingStore keeps annotations and acknowledgements in memory over a file
+// store, which has neither. Like the tables' foreign keys, it refuses those of
+// changes it doesn't hold.
+type annotatingStore struct {
+	*storage.FileStore
+	annotations map[int64]*storage.Annotation
+	acks        map[int64]*storage.Acknowledgement
+}
+
+func newAnnotatingStore(t *testing.T) *annotatingStore {
+	t.Helper()
+	fs, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	return &annotatingStore{FileStore: fs, annotations: map[int64]*storage.Annotation{}, acks: map[int64]*storage.Acknowledgement{}}
+}
+
+func (s *annotatingStore) AcknowledgeChange(ctx context.Context, changeID int64, acknowledgedBy string) (*storage.Acknowledgement, error) {
+	if ok, err := s.HasChange(ctx, changeID); err != nil || !ok {
+		return nil, &pgconn.PgError{Code: pgForeignKeyViolation}
+	}
+	if _, ok := s.acks[changeID]; !ok {
+		s.acks[changeID] = &storage.Acknowledgement{ChangeID: changeID, AcknowledgedBy: acknowledgedBy, AcknowledgedAt: time.Now()}
+	}
+	return s.acks[changeID], nil
+}
+
+func (s *annotatingStore) CreateAnnotation(ctx context.Context, changeID int64, content, severity, createdBy string) (*storage.Annotation, error) {
+	if ok, err := s.HasChange(ctx, changeID); err != nil || !ok {
+		return nil, &pgconn.PgError{Code: pgForeignKeyViolation}
+	}
+	ann := &storage.Annotation{ID: int64(len(s.annotations) + 1), ChangeID: changeID, Content: content, Severity: severity, CreatedBy: createdBy, CreatedAt: time.Now()}
+	s.annotations[ann.ID] = ann
+	return ann, nil
+}
+
+func (s *annotatingStore) GetAnnotation(ctx context.Context, id int64) (*storage.Annotation, error) {
+	return s.annotations[id], nil
+}
+
+func (s *annotatingStore) GetAnnotationByChangeID(ctx context.Context, changeID int64) (*storage.Annotation, error) {
+	for _, ann := range s.annotations {
+		if ann.ChangeID == changeID {
+			return ann, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *annotatingStore) ListAnnotations(ctx context.Context, severity string, limit int) ([]storage.Annotation, error) {
+	annotations := []storage.Annotation{}
+	for _, ann := range s.annotations {
+		annotations = append(annotations, *ann)
+	}
+	return annotations, nil
+}
+
+func (s *annotatingStore) UpdateAnnotation(ctx context.Context, id int64, content, severity, updatedBy string) error {
+	ann, ok := s.annotations[id]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	ann.Content = content
+	return nil
+}
+
+func (s *annotatingStore) DeleteAnnotation(ctx context.Context, id int64) error {
+	if _, ok := s.annotations[id]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(s.annotations, id)
+	return nil
+}
+
+func TestAnnotationsFollowTheChangesStore(t *testing.T) {
+	ctx := context.Background()
+	primary, shard := newAnnotatingStore(t), newAnnotatingStore(t)
+	// One change, held by the shard: a single prod snapshot detects none
+	if _, err := primary.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{{Variable: "a.b", Value: "1"}}, "v1.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+	for _, v := range []string{"1", "2"} {
+		if _, err := shard.SaveSnapshotWithChanges(ctx, "staging", []storage.Setting{{Variable: "a.b", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	changes, err := shard.GetChangesWithAnnotations(ctx, "staging", 1)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("GetChangesWithAnnotations = %v, %v", changes, err)
+	}
+	changeID := changes[0].ID
+
+	server, err := New(primary,
+		WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}),
+		WithDefaultClusterID("prod"),
+		WithClusterStores(map[string]Store{"staging": shard}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/annotations", `{"change_id": `+strconv.FormatInt(changeID, 10)+`, "content": "Raised for the backfill"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created AnnotationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(shard.annotations) != 1 || len(primary.annotations) != 0 {
+		t.Fatalf("Expected the annotation in the shard only, got %d there and %d in the primary", len(shard.annotations), len(primary.annotations))
+	}
+	annotation := "/api/annotations/" + strconv.FormatInt(created.ID, 10)
+
+	if w := do(http.MethodGet, annotation, ""); w.Code != http.StatusOK {
+		t.Errorf("Get: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, annotation, `{"content": "Raised for the reindex"}`); w.Code != http.StatusOK {
+		t.Errorf("Update: expected 200, got %d: %s", w.Code, w.Body.String())
+	} else if got := shard.annotations[created.ID].Content; got != "Raised for the reindex" {
+		t.Errorf("Update: content = %q, want the new content", got)
+	}
+	if w := do(http.MethodGet, "/api/changes/"+strconv.FormatInt(changeID, 10)+"/annotation", ""); w.Code != http.StatusOK {
+		t.Errorf("Get by change: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var listed []AnnotationResponse
+	if err := json.Unmarshal(do(http.MethodGet, "/api/annotations", "").Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].ID != created.ID {
+		t.Errorf("List = %+v, %v; want the shard's annotation", listed, err)
+	}
+	if w := do(http.MethodDelete, annotation, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Delete: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(shard.annotations) != 0 {
+		t.Errorf("Expected the annotation deleted from the shard, got %+v", shard.annotations)
+	}
+
+	if w := do(http.MethodPost, "/api/annotations", `{"change_id": 999, "content": "x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Create for an unknown change: expected 404, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, annotation, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Get after delete: expected 404, got %d", w.Code)
+	}
+}
+
+func TestAcknowledgementsFollowTheChangesStore(t *testing.T) {
+	ctx := context.Background()
+	primary, shard := newAnnotatingStore(t), newAnnotatingStore(t)
+	for _, v := range []string{"1", "2"} {
+		if _, err := shard.SaveSnapshotWithChanges(ctx, "staging", []storage.Setting{{Variable: "a.b", Value: v}}, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+	changes, err := shard.GetChangesWithAnnotations(ctx, "staging", 1)
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("GetChangesWithAnnotations = %v, %v", changes, err)
+	}
+
+	server, err := New(primary,
+		WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}),
+		WithDefaultClusterID("prod"),
+		WithClusterStores(map[string]Store{"staging": shard}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ack := func(changeID int64) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/changes/"+strconv.FormatInt(changeID, 10)+"/ack", nil))
+		return w
+	}
+
+	if w := ack(changes[0].ID); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(shard.acks) != 1 || len(primary.acks) != 0 {
+		t.Errorf("Expected the acknowledgement in the shard only, got %d there and %d in the primary", len(shard.acks), len(primary.acks))
+	}
+	if w := ack(999); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown change: expected 404, got %d", w.Code)
+	}
+}
+
+func TestIDsHeldByMoreThanOneStore(t *testing.T) {
+	ctx := context.Background()
+	primary, shard := newAnnotatingStore(t), newAnnotatingStore(t)
+	// Each file store numbers its own snapshots and changes from 1
+	for store, cluster := range map[*annotatingStore]string{primary: "prod", shard: "staging"} {
+		for _, v := range []string{"1", "2"} {
+			if _, err := store.SaveSnapshotWithChanges(ctx, cluster, []storage.Setting{{Variable: "a.b", Value: cluster + v}}, "v1.0"); err != nil {
+				t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+			}
+		}
+	}
+
+	server, err := New(primary,
+		WithClusters([]config.ClusterConfig{{ID: "prod"}, {ID: "staging"}}),
+		WithDefaultClusterID("prod"),
+		WithClusterStores(map[string]Store{"staging": shard}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	do := func(method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	// Without a cluster the IDs are ambiguous rather than resolved to either store
+	if w := do(http.MethodGet, "/api/compare-snapshots?snapshot1=1&snapshot2=2"); w.Code != http.StatusConflict {
+		t.Errorf("Compare without clusters: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/changes/1/ack"); w.Code != http.StatusConflict {
+		t.Errorf("Ack without a cluster: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(primary.acks)+len(shard.acks) != 0 {
+		t.Errorf("Expected no acknowledgement for an ambiguous change, got %d and %d", len(primary.acks), len(shard.acks))
+	}
+
+	// The cluster picks the store
+	w := do(http.MethodGet, "/api/compare-snapshots?snapshot1=1&snapshot2=2&cluster1=staging&cluster2=staging")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Compare with clusters: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result TimeCompareResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(result.Different) != 1 || result.Different[0].Value1 != "staging1" || result.Different[0].Value2 != "staging2" {
+		t.Errorf("Expected the staging snapshots compared, got %+v", result.Different)
+	}
+	if w := do(http.MethodPost, "/api/changes/1/ack?cluster=staging"); w.Code != http.StatusOK {
+		t.Errorf("Ack with a cluster: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(shard.acks) != 1 || len(primary.acks) != 0 {
+		t.Errorf("Expected the acknowledgement in the shard only, got %d there and %d in the primary", len(shard.acks), len(primary.acks))
+	}
+	if w := do(http.MethodPost, "/api/changes/1/ack?cluster=nope"); w.Code != http.StatusBadRequest {
+		t.Errorf("Ack with an unknown cluster: expected 400, got %d", w.Code)
+	}
+}
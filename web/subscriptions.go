@@ -0,0 +1,183 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"crdb-cluster-history/config"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SubscriptionRequest is the JSON body for creating/updating subscriptions.
+type SubscriptionRequest struct {
+	ClusterID       string `json:"cluster_id,omitempty"`
+	VariablePattern string `json:"variable_pattern"`
+	TargetURL       string `json:"target_url"`
+}
+
+// handleSubscriptions handles GET /api/subscriptions (list) and POST /api/subscriptions (create).
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listSubscriptions(w, r)
+	case http.MethodPost:
+		s.createSubscription(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	clusterID := r.URL.Query().Get("cluster")
+	if clusterID != "" && (!config.IsValidHistoryID(clusterID) || !s.isValidCluster(clusterID)) {
+		s.jsonError(w, "Unknown cluster", http.StatusBadRequest)
+		return
+	}
+
+	subs, err := s.store.ListSubscriptions(r.Context(), clusterID)
+	if err != nil {
+		slog.Error("Error listing subscriptions", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, subs)
+}
+
+func (s *Server) createSubscription(w http.ResponseWriter, r *http.Request) {
+	var req SubscriptionRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ClusterID == "" {
+		s.jsonError(w, "cluster_id is required", http.StatusBadRequest)
+		return
+	}
+	if !s.isValidCluster(req.ClusterID) {
+		s.jsonError(w, "Unknown cluster", http.StatusBadRequest)
+		return
+	}
+	if msg := validateSubscription(req); msg != "" {
+		s.jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	username := s.getUsernameFromRequest(r)
+
+	sub, err := s.store.CreateSubscription(r.Context(), req.ClusterID, strings.TrimSpace(req.VariablePattern), req.TargetURL, username)
+	if err != nil {
+		slog.Error("Error creating subscription", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, sub)
+}
+
+// handleSubscriptionByID handles GET, PUT, DELETE /api/subscriptions/{id}
+func (s *Server) handleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/subscriptions/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		s.jsonError(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getSubscription(w, r, id)
+	case http.MethodPut:
+		s.updateSubscription(w, r, id)
+	case http.MethodDelete:
+		s.deleteSubscription(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) getSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	sub, err := s.store.GetSubscription(r.Context(), id)
+	if err != nil {
+		slog.Error("Error getting subscription", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		s.jsonError(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, sub)
+}
+
+func (s *Server) updateSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	var req SubscriptionRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.jsonError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateSubscription(req); msg != "" {
+		s.jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.UpdateSubscription(r.Context(), id, strings.TrimSpace(req.VariablePattern), req.TargetURL)
+	if err == pgx.ErrNoRows {
+		s.jsonError(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error updating subscription", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := s.store.GetSubscription(r.Context(), id)
+	if err != nil || sub == nil {
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, sub)
+}
+
+func (s *Server) deleteSubscription(w http.ResponseWriter, r *http.Request, id int64) {
+	err := s.store.DeleteSubscription(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		s.jsonError(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error deleting subscription", "error", err)
+		s.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateSubscription checks the pattern and target URL of a subscription request.
+// Returns an error message, or an empty string if the request is valid.
+func validateSubscription(req SubscriptionRequest) string {
+	if strings.TrimSpace(req.VariablePattern) == "" {
+		return "variable_pattern is required"
+	}
+	if req.TargetURL == "" {
+		return "target_url is required"
+	}
+	u, err := url.Parse(req.TargetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "target_url must be an absolute http or https URL"
+	}
+	return ""
+}
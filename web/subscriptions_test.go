@@ -0,0 +1,194 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestValidateSubscription(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     SubscriptionRequest
+		wantErr bool
+	}{
+		{"valid http", SubscriptionRequest{VariablePattern: "kv.*", TargetURL: "http://example.com/hook"}, false},
+		{"valid https", SubscriptionRequest{VariablePattern: "*", TargetURL: "https://example.com"}, false},
+		{"empty pattern", SubscriptionRequest{VariablePattern: "  ", TargetURL: "https://example.com"}, true},
+		{"empty url", SubscriptionRequest{VariablePattern: "kv.*"}, true},
+		{"relative url", SubscriptionRequest{VariablePattern: "kv.*", TargetURL: "/hook"}, true},
+		{"unsupported scheme", SubscriptionRequest{VariablePattern: "kv.*", TargetURL: "ftp://example.com"}, true},
+		{"missing host", SubscriptionRequest{VariablePattern: "kv.*", TargetURL: "http://"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := validateSubscription(tt.req)
+			if (msg != "") != tt.wantErr {
+				t.Errorf("validateSubscription() = %q, wantErr %v", msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubscriptionAPI_CreateAndGet(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	body := strings.NewReader(`{"cluster_id":"` + testClusterID + `","variable_pattern":"kv.*","target_url":"https://example.com/hook"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/subscriptions", body)
+	req.SetBasicAuth("subscriber", "password")
+	w := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created storage.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	t.Cleanup(func() { store.DeleteSubscription(ctx, created.ID) })
+
+	if created.VariablePattern != "kv.*" || created.CreatedBy != "subscriber" {
+		t.Errorf("Unexpected subscription: %+v", created)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/subscriptions/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "https://example.com/hook") {
+		t.Errorf("Expected target_url in response, got %s", w.Body.String())
+	}
+}
+
+func TestSubscriptionAPI_List(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	sub, err := store.CreateSubscription(ctx, testClusterID, "sql.*", "https://example.com/list", "user")
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	t.Cleanup(func() { store.DeleteSubscription(ctx, sub.ID) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/subscriptions?cluster="+testClusterID, nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var subs []storage.Subscription
+	if err := json.NewDecoder(w.Body).Decode(&subs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	found := false
+	for _, s := range subs {
+		if s.ID == sub.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected subscription %d in list, got %+v", sub.ID, subs)
+	}
+}
+
+func TestSubscriptionAPI_UpdateAndDelete(t *testing.T) {
+	ctx, store, server := setupTest(t)
+
+	sub, err := store.CreateSubscription(ctx, testClusterID, "kv.*", "https://example.com/old", "user")
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+	t.Cleanup(func() { store.DeleteSubscription(ctx, sub.ID) })
+
+	body := strings.NewReader(`{"variable_pattern":"server.*","target_url":"https://example.com/new"}`)
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/subscriptions/%d", sub.ID), body)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "server.*") {
+		t.Errorf("Expected updated pattern in response, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/subscriptions/%d", sub.ID), nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deleted, _ := store.GetSubscription(ctx, sub.ID)
+	if deleted != nil {
+		t.Error("Expected subscription to be deleted")
+	}
+}
+
+func TestSubscriptionAPI_NotFound(t *testing.T) {
+	_, _, server := setupTest(t)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/api/subscriptions/999999", nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", method, w.Code)
+		}
+	}
+}
+
+func TestSubscriptionAPI_Validation(t *testing.T) {
+	_, _, server := setupTest(t, WithClusters([]config.ClusterConfig{{ID: testClusterID, Name: "Test"}}))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", "not json"},
+		{"missing cluster", `{"variable_pattern":"kv.*","target_url":"https://example.com"}`},
+		{"unknown cluster", `{"cluster_id":"nope","variable_pattern":"kv.*","target_url":"https://example.com"}`},
+		{"missing pattern", `{"cluster_id":"` + testClusterID + `","target_url":"https://example.com"}`},
+		{"bad url", `{"cluster_id":"` + testClusterID + `","variable_pattern":"kv.*","target_url":"file:///etc/passwd"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/subscriptions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSubscriptionAPI_InvalidID(t *testing.T) {
+	_, _, server := setupTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/subscriptions/notanumber", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"crdb-cluster-history/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateCompareResult is the JSON response for /api/compare-template. In each
+// SettingDiff, Value1 is the cluster's value and Value2 the template's.
+type TemplateCompareResult struct {
+	ClusterID     string        `json:"cluster_id"`
+	Missing       []SettingDiff `json:"missing"`        // In the template but not the cluster's latest snapshot
+	Extra         []SettingDiff `json:"extra"`          // In the cluster's latest snapshot but not the template
+	Different     []SettingDiff `json:"different"`      // In both, with a value other than the template's
+	ExcludedCount int           `json:"excluded_count"` // Differences matching an expected-difference pattern
+}
+
+// parseSettingsTemplate reads a YAML map of variable to expected value.
+func parseSettingsTemplate(data []byte) (map[string]storage.Setting, error) {
+	var values map[string]string
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("template lists no settings")
+	}
+	template := make(map[string]storage.Setting, len(values))
+	for variable, value := range values {
+		template[variable] = storage.Setting{Variable: variable, Value: value}
+	}
+	return template, nil
+}
+
+// handleAPICompareTemplate diffs a cluster's latest snapshot against a template
+// of expected settings, POSTed as a YAML map of variable to value. Values are
+// compared by setting type, so a template's "1m" matches a stored "1m0s". The
+// sort= and ignore= parameters work as for /api/compare.
+func (s *Server) handleAPICompareTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clusterID, err := s.getClusterID(r)
+	if err != nil {
+		s.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sortMode, ok := parseSortMode(r)
+	if !ok {
+		s.jsonError(w, "sort must be one of: variable, type, sensitivity", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB limit
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.jsonError(w, "Failed to read template", http.StatusBadRequest)
+		return
+	}
+	template, err := parseSettingsTemplate(body)
+	if err != nil {
+		s.jsonError(w, fmt.Sprintf("Invalid template: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.compareTimeout)
+	defer cancel()
+	settings, err := s.latestSnapshot(ctx, clusterID)
+	if err != nil {
+		s.compareLoadError(w, ctx, err, "Failed to get settings", "cluster", clusterID)
+		return
+	}
+	if settings == nil {
+		s.jsonError(w, "No snapshot found for cluster", http.StatusNotFound)
+		return
+	}
+	if !s.checkCompareSize(w, settings, template) {
+		return
+	}
+
+	diff := compareSettings(settings, template)
+	different := diff.Different[:0]
+	for _, d := range diff.Different {
+		if !storage.EqualSettingValues(d.SettingType, d.Value1, d.Value2) {
+			different = append(different, d)
+		}
+	}
+	diff.Different = different
+
+	diff, excluded := excludeExpected(diff, s.ignorePatterns(r))
+	s.sortDiff(diff, sortMode)
+	s.redactDiff(diff)
+
+	jsonResponse(w, http.StatusOK, TemplateCompareResult{
+		ClusterID:     clusterID,
+		Missing:       diff.OnlyInB,
+		Extra:         diff.OnlyInA,
+		Different:     diff.Different,
+		ExcludedCount: excluded,
+	})
+}
+
+// redactDiff redacts the values and descriptions of sensitive settings in diff
+// in place, after the values have been compared.
+func (s *Server) redactDiff(diff diffResult) {
+	if s.redactor == nil {
+		return
+	}
+	for _, bucket := range [][]SettingDiff{diff.OnlyInA, diff.OnlyInB, diff.Different} {
+		for i, d := range bucket {
+			bucket[i].Value1 = redactNonEmpty(s.redactor, d.Variable, d.Value1)
+			bucket[i].Value2 = redactNonEmpty(s.redactor, d.Variable, d.Value2)
+			bucket[i].Description = s.redactor.RedactDescription(d.Variable, d.Description)
+		}
+	}
+}
+
+// redactNonEmpty redacts a sensitive value, leaving an absent one empty.
+func redactNonEmpty(redactor *storage.Redactor, variable, value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactor.RedactValue(variable, value)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleAPICompareTemplate(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if _, err := store.SaveSnapshotWithChanges(ctx, "prod", []storage.Setting{
+		{Variable: "kv.rangefeed.enabled", Value: "true", SettingType: "b"},
+		{Variable: "sql.stats.automatic_collection.enabled", Value: "false", SettingType: "b"},
+		{Variable: "server.time_until_store_dead", Value: "5m0s", SettingType: "d"},
+		{Variable: "server.secret", Value: "hunter2", SettingType: "s"},
+		{Variable: "cluster.organization", Value: "Acme", SettingType: "s"},
+	}, "v25.4.0"); err != nil {
+		t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+	}
+
+	post := func(url, body string, opts ...Option) *httptest.ResponseRecorder {
+		t.Helper()
+		server, err := New(store, append(opts, WithClusters([]config.ClusterConfig{{ID: "prod", Name: "Production"}, {ID: "empty", Name: "Empty"}}))...)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		return w
+	}
+
+	template := `
+kv.rangefeed.enabled: true
+sql.stats.automatic_collection.enabled: true
+server.time_until_store_dead: 5m
+server.secret: swordfish
+admission.kv.enabled: true
+`
+	w := post("/api/compare-template?cluster=prod", template, WithRedactor(storage.NewRedactor(storage.RedactorConfig{Enabled: true})))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result TemplateCompareResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.ClusterID != "prod" {
+		t.Errorf("Expected cluster_id prod, got %q", result.ClusterID)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].Variable != "admission.kv.enabled" || result.Missing[0].Value2 != "true" {
+		t.Errorf("Unexpected missing settings: %+v", result.Missing)
+	}
+	if len(result.Extra) != 1 || result.Extra[0].Variable != "cluster.organization" {
+		t.Errorf("Unexpected extra settings: %+v", result.Extra)
+	}
+	// 5m matches 5m0s; the secret differs but both values are redacted
+	if len(result.Different) != 2 {
+		t.Fatalf("Expected 2 differences, got %+v", result.Different)
+	}
+	if d := result.Different[0]; d.Variable != "server.secret" || d.Value1 != storage.RedactedPlaceholder || d.Value2 != storage.RedactedPlaceholder {
+		t.Errorf("Expected the secret's difference redacted, got %+v", d)
+	}
+	if d := result.Different[1]; d.Variable != "sql.stats.automatic_collection.enabled" || d.Value1 != "false" || d.Value2 != "true" {
+		t.Errorf("Unexpected difference: %+v", d)
+	}
+
+	w = post("/api/compare-template?cluster=prod&ignore=server.*,cluster.*", template)
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.ExcludedCount != 2 || len(result.Extra) != 0 || len(result.Different) != 1 {
+		t.Errorf("Expected ignored variables excluded, got %+v", result)
+	}
+
+	for _, tt := range []struct {
+		name, url, body string
+		want            int
+	}{
+		{"not a map", "/api/compare-template?cluster=prod", "- a\n- b\n", http.StatusBadRequest},
+		{"nested value", "/api/compare-template?cluster=prod", "a:\n  b: c\n", http.StatusBadRequest},
+		{"empty", "/api/compare-template?cluster=prod", "", http.StatusBadRequest},
+		{"unknown cluster", "/api/compare-template?cluster=other", template, http.StatusBadRequest},
+		{"no snapshot", "/api/compare-template?cluster=empty", template, http.StatusNotFound},
+	} {
+		if w := post(tt.url, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+
+	"crdb-cluster-history/config"
+)
+
+// scopeTabs builds the dashboard's tabs switching between a cluster's settings
+// and its zone configurations, which are tracked as a history cluster of their
+// own. It returns nil when the cluster doesn't collect zone configurations.
+func (s *Server) scopeTabs(r *http.Request, clusterID string) []presetLink {
+	current := s.clusterConfig(clusterID)
+	if current == nil {
+		return nil
+	}
+	settingsID := clusterID
+	if current.ZoneConfigsOf != "" {
+		settingsID = current.ZoneConfigsOf
+	} else if !current.ZoneConfigs {
+		return nil
+	}
+	zonesID := config.ZoneConfigClusterID(settingsID)
+	link := func(id string) string {
+		return r.URL.Path + "?" + url.Values{"cluster": {id}}.Encode()
+	}
+	return []presetLink{
+		{Name: "Cluster Settings", URL: link(settingsID), Active: clusterID == settingsID},
+		{Name: "Zone Configurations", URL: link(zonesID), Active: clusterID == zonesID},
+	}
+}
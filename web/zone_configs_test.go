@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crdb-cluster-history/config"
+	"crdb-cluster-history/storage"
+)
+
+func TestHandleIndexZoneConfigTabs(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	for _, ttl := range []string{"14400", "600"} {
+		zones := []storage.Setting{{
+			Variable:    "DATABASE app",
+			Value:       "ALTER DATABASE app CONFIGURE ZONE USING\n\tgc.ttlseconds = " + ttl,
+			SettingType: storage.ZoneConfigType,
+		}}
+		if _, err := store.SaveSnapshotWithChanges(ctx, "prod.zones", zones, "v1.0"); err != nil {
+			t.Fatalf("SaveSnapshotWithChanges failed: %v", err)
+		}
+	}
+
+	cfg := config.Config{Clusters: []config.ClusterConfig{
+		{ID: "prod", Name: "Production", ZoneConfigs: true},
+		{ID: "staging", Name: "Staging"},
+	}}
+	server, err := New(store, WithClusters(cfg.HistoryClusters()), WithDefaultClusterID("prod"))
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	get := func(target string) string {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", target, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	settingsTab := `href="/dashboard?cluster=prod" class="btn %s">Cluster Settings</a>`
+	zonesTab := `href="/dashboard?cluster=prod.zones" class="btn %s">Zone Configurations</a>`
+	tests := []struct {
+		cluster   string
+		wantTabs  []string
+		wantValue string
+	}{
+		{"prod", []string{fmt.Sprintf(settingsTab, "btn-primary"), fmt.Sprintf(zonesTab, "btn-outline")}, ""},
+		{"prod.zones", []string{fmt.Sprintf(settingsTab, "btn-outline"), fmt.Sprintf(zonesTab, "btn-primary")}, "gc.ttlseconds = 600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cluster, func(t *testing.T) {
+			body := get("/dashboard?cluster=" + tt.cluster)
+			for _, tab := range tt.wantTabs {
+				if !strings.Contains(body, tab) {
+					t.Errorf("Expected tab %s", tab)
+				}
+			}
+			if !strings.Contains(body, tt.wantValue) {
+				t.Errorf("Expected %q in the changes", tt.wantValue)
+			}
+		})
+	}
+
+	if body := get("/dashboard?cluster=staging"); strings.Contains(body, "Zone Configurations") {
+		t.Error("Expected no zone configuration tab for a cluster not collecting them")
+	}
+}